@@ -35,6 +35,8 @@ func init() {
 	cmd.Perform("public-connection", &compute.DBInstancePublicConnectionOptions{})
 	cmd.Perform("recovery", &compute.DBInstanceRecoveryOptions{})
 	cmd.Perform("reboot", &compute.DBInstanceIdOptions{})
+	cmd.Perform("start", &compute.DBInstanceIdOptions{})
+	cmd.Perform("stop", &compute.DBInstanceIdOptions{})
 	cmd.Perform("purge", &compute.DBInstanceIdOptions{})
 	cmd.Perform("syncstatus", &compute.DBInstanceIdOptions{})
 	cmd.Perform("sync", &compute.DBInstanceIdOptions{})
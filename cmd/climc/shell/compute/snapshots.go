@@ -100,6 +100,8 @@ func init() {
 	type SnapshotCreateOptions struct {
 		Disk string `help:"Id of disk to take snapshot" json:"disk" required:"true"`
 		NAME string `help:"Name of snapshot" json:"name"`
+
+		Fsfreeze bool `help:"Freeze guest filesystems by qemu guest agent before taking snapshot" json:"fsfreeze"`
 	}
 	R(&SnapshotCreateOptions{}, "snapshot-create", "Create a snapshot", func(s *mcclient.ClientSession, args *SnapshotCreateOptions) error {
 		params, err := options.StructToParams(args)
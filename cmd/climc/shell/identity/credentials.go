@@ -97,6 +97,27 @@ func init() {
 		return nil
 	})
 
+	type CredentialWebauthnEnrollmentOptions struct {
+		USER       string `help:"User"`
+		UserDomain string `help:"domain of user"`
+		Hours      int    `help:"hours before the token expires" default:"24"`
+	}
+	R(&CredentialWebauthnEnrollmentOptions{}, "credential-create-webauthn-enrollment", "Issue a token for user to register the first webauthn authenticator", func(s *mcclient.ClientSession, args *CredentialWebauthnEnrollmentOptions) error {
+		uid, err := modules.UsersV3.FetchId(s, args.USER, args.UserDomain)
+		if err != nil {
+			return err
+		}
+		if args.Hours <= 0 {
+			args.Hours = 24
+		}
+		token, err := modules.Credentials.CreateWebauthnEnrollmentToken(s, uid, time.Now().Add(time.Duration(args.Hours)*time.Hour))
+		if err != nil {
+			return err
+		}
+		fmt.Println("enrollment token:", token)
+		return nil
+	})
+
 	type CredentialCreateRecoverySecretsOptions struct {
 		USER       string   `help:"User"`
 		UserDomain string   `help:"domain of user"`
@@ -247,7 +268,9 @@ func init() {
 	}
 
 	type OIDCCredentialCreateOptions struct {
-		RedirectUri string `help:"redirect URL"`
+		RedirectUri  string   `help:"redirect URL"`
+		PublicClient bool     `help:"public client without secret, e.g. SPA, mobile app or CLI tool, which must use PKCE"`
+		GrantType    []string `help:"allowed grant types, default is authorization_code only" choices:"authorization_code|refresh_token|client_credentials|urn:ietf:params:oauth:grant-type:device_code"`
 		OIDCCredentialOptions
 	}
 	R(&OIDCCredentialCreateOptions{}, "credential-create-oidc", "Create OpenID Connection Credential", func(s *mcclient.ClientSession, args *OIDCCredentialCreateOptions) error {
@@ -266,7 +289,11 @@ func init() {
 				return err
 			}
 		}
-		secret, err := modules.Credentials.CreateOIDCSecret(s, uid, pid, args.RedirectUri)
+		secret, err := modules.Credentials.CreateOIDCClient(s, uid, pid, modules.SOpenIDConnectCredential{
+			RedirectUri:  args.RedirectUri,
+			PublicClient: args.PublicClient,
+			GrantTypes:   args.GrantType,
+		})
 		if err != nil {
 			return err
 		}
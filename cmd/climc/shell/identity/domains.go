@@ -78,6 +78,10 @@ func init() {
 		Disabled bool   `help:"Set the domain disabled"`
 
 		Displayname string `help:"display name"`
+
+		AdminRequireWebauthn bool `help:"Require users with domain or system admin privileges to verify with WebAuthn"`
+
+		ImageSignaturePolicy string `help:"Image signature policy, enforce to boot servers only from images with verified signatures" choices:"none|enforce"`
 	}
 	R(&DomainCreateOptions{}, "domain-create", "Create a new domain", func(s *mcclient.ClientSession, args *DomainCreateOptions) error {
 		params := jsonutils.NewDict()
@@ -93,6 +97,12 @@ func init() {
 		if len(args.Displayname) > 0 {
 			params.Add(jsonutils.NewString(args.Displayname), "displayname")
 		}
+		if args.AdminRequireWebauthn {
+			params.Add(jsonutils.JSONTrue, "admin_require_webauthn")
+		}
+		if len(args.ImageSignaturePolicy) > 0 {
+			params.Add(jsonutils.NewString(args.ImageSignaturePolicy), "image_signature_policy")
+		}
 		result, err := modules.Domains.Create(s, params)
 		if err != nil {
 			return err
@@ -159,4 +169,37 @@ func init() {
 		return nil
 	})
 
+	type DomainMfaPolicyOptions struct {
+		DOMAIN string `help:"ID or name of domain to operate" json:"-"`
+
+		AdminRequireWebauthn string `help:"Require users with domain or system admin privileges to verify with WebAuthn" choices:"true|false"`
+	}
+	R(&DomainMfaPolicyOptions{}, "domain-mfa-policy", "Set multi-factor authentication policy of a domain", func(s *mcclient.ClientSession, args *DomainMfaPolicyOptions) error {
+		params := jsonutils.NewDict()
+		if len(args.AdminRequireWebauthn) > 0 {
+			params.Add(jsonutils.NewBool(args.AdminRequireWebauthn == "true"), "admin_require_webauthn")
+		}
+		result, err := modules.Domains.PerformAction(s, args.DOMAIN, "mfa-policy", params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+	type DomainImageSignaturePolicyOptions struct {
+		DOMAIN string `help:"ID or name of domain to operate" json:"-"`
+
+		POLICY string `help:"Image signature policy, enforce to boot servers only from images with verified signatures" choices:"none|enforce" json:"image_signature_policy"`
+	}
+	R(&DomainImageSignaturePolicyOptions{}, "domain-image-signature-policy", "Set image signature policy of a domain", func(s *mcclient.ClientSession, args *DomainImageSignaturePolicyOptions) error {
+		params := jsonutils.NewDict()
+		params.Add(jsonutils.NewString(args.POLICY), "image_signature_policy")
+		result, err := modules.Domains.PerformAction(s, args.DOMAIN, "image-signature-policy", params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
 }
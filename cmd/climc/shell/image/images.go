@@ -15,8 +15,13 @@
 package image
 
 import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"strings"
 
@@ -25,12 +30,14 @@ import (
 	"yunion.io/x/jsonutils"
 
 	"yunion.io/x/onecloud/cmd/climc/shell"
+	api "yunion.io/x/onecloud/pkg/apis/image"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
 	"yunion.io/x/onecloud/pkg/mcclient/modules/identity"
 	modules "yunion.io/x/onecloud/pkg/mcclient/modules/image"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
 	"yunion.io/x/onecloud/pkg/mcclient/options/glance"
+	"yunion.io/x/onecloud/pkg/util/httputils"
 )
 
 type ImageOptionalOptions struct {
@@ -154,6 +161,132 @@ func addImageOptionalOptions(s *mcclient.ClientSession, params *jsonutils.JSONDi
 	return nil
 }
 
+type ImageSignatureOptions struct {
+	SignatureFormat      string `help:"Format of the image signature" choices:"cosign|x509"`
+	SignatureFile        string `help:"File of the detached image signature, raw or base64 encoded"`
+	SignaturePayloadFile string `help:"File of the cosign simple signing payload"`
+	SignatureCertFile    string `help:"File of the PEM encoded signing certificate followed by the intermediates"`
+}
+
+func readBase64File(fn string) (string, error) {
+	content, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return "", err
+	}
+	str := strings.TrimSpace(string(content))
+	if _, err := base64.StdEncoding.DecodeString(str); err == nil {
+		return str, nil
+	}
+	return base64.StdEncoding.EncodeToString(content), nil
+}
+
+// resumableUpload uploads the file in chunks, it continues from the offset
+// received by the server if an upload of the image with the same name is
+// unfinished, so an interrupted upload can be resumed by running it again
+func resumableUpload(s *mcclient.ClientSession, params *jsonutils.JSONDict, f *os.File, size int64, chunkSize int64) (jsonutils.JSONObject, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	name, _ := params.GetString("name")
+	imgId, err := modules.Images.GetId(s, name, nil)
+	if err == nil {
+		img, err := modules.Images.Get(s, imgId, nil)
+		if err != nil {
+			return nil, err
+		}
+		status, _ := img.GetString("status")
+		if status != api.IMAGE_STATUS_QUEUED && status != api.IMAGE_STATUS_UPLOADING {
+			return nil, fmt.Errorf("image %s already exists in status %s", name, status)
+		}
+	} else if httputils.ErrorCode(err) == http.StatusNotFound {
+		img, err := modules.Images.Create(s, params)
+		if err != nil {
+			return nil, err
+		}
+		imgId, _ = img.GetString("id")
+	} else {
+		return nil, err
+	}
+
+	result, err := modules.Images.PerformAction(s, imgId, "start-upload", jsonutils.Marshal(api.ImageStartUploadInput{Size: size}))
+	if err != nil {
+		return nil, err
+	}
+	upload := api.ImageUploadOutput{}
+	err = result.Unmarshal(&upload)
+	if err != nil {
+		return nil, err
+	}
+
+	bar := pb.Full.Start64(size)
+	bar.SetCurrent(upload.Offset)
+	buf := make([]byte, chunkSize)
+	retried := 0
+	for upload.Offset < upload.Size {
+		n, err := f.ReadAt(buf, upload.Offset)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		chunk := buf[:n]
+		query := jsonutils.NewDict()
+		query.Set("upload_id", jsonutils.NewString(upload.UploadId))
+		query.Set("offset", jsonutils.NewInt(upload.Offset))
+		query.Set("checksum", jsonutils.NewString(fmt.Sprintf("%x", md5.Sum(chunk))))
+		result, err := modules.Images.UploadChunk(s, imgId, query, bytes.NewReader(chunk), int64(n))
+		if err != nil {
+			retried += 1
+			if retried > 3 {
+				return nil, fmt.Errorf("upload chunk at %d: %s, run again with --resume to continue", upload.Offset, err)
+			}
+			// the chunk may have been received, continue from the offset of the server
+			result, err = modules.Images.GetSpecific(s, imgId, "upload", nil)
+			if err != nil {
+				continue
+			}
+		} else {
+			retried = 0
+		}
+		err = result.Unmarshal(&upload)
+		if err != nil {
+			return nil, err
+		}
+		bar.SetCurrent(upload.Offset)
+	}
+	bar.Finish()
+
+	return modules.Images.PerformAction(s, imgId, "finish-upload", jsonutils.Marshal(api.ImageFinishUploadInput{UploadId: upload.UploadId}))
+}
+
+func addImageSignatureOptions(params *jsonutils.JSONDict, args ImageSignatureOptions) error {
+	if len(args.SignatureFile) == 0 {
+		return nil
+	}
+	if len(args.SignatureFormat) > 0 {
+		params.Add(jsonutils.NewString(args.SignatureFormat), "signature_format")
+	}
+	sig, err := readBase64File(args.SignatureFile)
+	if err != nil {
+		return err
+	}
+	params.Add(jsonutils.NewString(sig), "signature")
+	if len(args.SignaturePayloadFile) > 0 {
+		payload, err := ioutil.ReadFile(args.SignaturePayloadFile)
+		if err != nil {
+			return err
+		}
+		params.Add(jsonutils.NewString(base64.StdEncoding.EncodeToString(payload)), "signature_payload")
+	}
+	if len(args.SignatureCertFile) > 0 {
+		// certificate in base64 to be carried by the upload headers
+		cert, err := ioutil.ReadFile(args.SignatureCertFile)
+		if err != nil {
+			return err
+		}
+		params.Add(jsonutils.NewString(base64.StdEncoding.EncodeToString(cert)), "signature_certificate")
+	}
+	return nil
+}
+
 func init() {
 
 	cmd := shell.NewResourceCmd(&modules.Images)
@@ -256,7 +389,11 @@ func init() {
 
 		EncryptKey string `help:"encrypt key id"`
 
+		Resume      bool  `help:"Upload in chunks, resume the unfinished upload of the image with the same name if exists"`
+		ChunkSizeMb int64 `help:"Chunk size in MB of a resumable upload" default:"64"`
+
 		ImageOptionalOptions
+		ImageSignatureOptions
 	}
 	R(&ImageUploadOptions{}, "image-upload", "Upload a local image", func(s *mcclient.ClientSession, args *ImageUploadOptions) error {
 		params := jsonutils.NewDict()
@@ -268,6 +405,10 @@ func init() {
 		if err != nil {
 			return err
 		}
+		err = addImageSignatureOptions(params, args.ImageSignatureOptions)
+		if err != nil {
+			return err
+		}
 		f, err := os.Open(args.FILE)
 		if err != nil {
 			return err
@@ -278,6 +419,14 @@ func init() {
 			return err
 		}
 		size := finfo.Size()
+		if args.Resume {
+			img, err := resumableUpload(s, params, f, size, args.ChunkSizeMb*1024*1024)
+			if err != nil {
+				return err
+			}
+			printObject(img)
+			return nil
+		}
 		bar := pb.Full.Start64(size)
 		barReader := bar.NewProxyReader(f)
 		img, err := modules.Images.Upload(s, params, barReader, size)
@@ -317,6 +466,60 @@ func init() {
 		return nil
 	})
 
+	type ImageImportOciOptions struct {
+		ImageOptionalOptions
+		NAME       string `help:"Image Name"`
+		REFERENCE  string `help:"OCI image reference, e.g. harbor.example.com/disks/centos:7"`
+		Username   string `help:"Username of the registry"`
+		Password   string `help:"Password of the registry"`
+		EncryptKey string `help:"encrypt key id"`
+	}
+	R(&ImageImportOciOptions{}, "image-import-oci", "Import an image from a containerDisk or disk artifact of an OCI registry", func(s *mcclient.ClientSession, args *ImageImportOciOptions) error {
+		params := jsonutils.NewDict()
+		params.Add(jsonutils.NewString(args.NAME), "name")
+		params.Add(jsonutils.NewString(args.REFERENCE), "oci_reference")
+		if len(args.Username) > 0 {
+			params.Add(jsonutils.NewString(args.Username), "oci_username")
+		}
+		if len(args.Password) > 0 {
+			params.Add(jsonutils.NewString(args.Password), "oci_password")
+		}
+		if len(args.EncryptKey) > 0 {
+			params.Add(jsonutils.NewString(args.EncryptKey), "encrypt_key_id")
+		}
+		err := addImageOptionalOptions(s, params, args.ImageOptionalOptions)
+		if err != nil {
+			return err
+		}
+		img, err := modules.Images.Create(s, params)
+		if err != nil {
+			return err
+		}
+		printObject(img)
+		return nil
+	})
+
+	type ImageExportOciOptions struct {
+		ID        string `help:"ID or Name of image"`
+		REFERENCE string `help:"OCI image reference to push to, e.g. harbor.example.com/disks/centos:7"`
+		Username  string `help:"Username of the registry"`
+		Password  string `help:"Password of the registry"`
+		Format    string `help:"Image format to export, default the format of the image" choices:"qcow2|raw|vmdk|vhd|iso"`
+	}
+	R(&ImageExportOciOptions{}, "image-export-oci", "Push an image to an OCI registry as a disk artifact", func(s *mcclient.ClientSession, args *ImageExportOciOptions) error {
+		input := api.ImageExportOciInput{}
+		input.OciReference = args.REFERENCE
+		input.OciUsername = args.Username
+		input.OciPassword = args.Password
+		input.Format = args.Format
+		img, err := modules.Images.PerformAction(s, args.ID, "export-oci", jsonutils.Marshal(input))
+		if err != nil {
+			return err
+		}
+		printObject(img)
+		return nil
+	})
+
 	type ImageDownloadOptions struct {
 		ID      string `help:"ID or Name of image"`
 		Output  string `help:"Destination file, if omitted, output to stdout"`
@@ -470,4 +673,50 @@ func init() {
 		printObject(img)
 		return nil
 	})
+	type ImageAddSignatureOptions struct {
+		ID string `help:"ID or name of image to sign"`
+
+		ImageSignatureOptions
+	}
+	R(&ImageAddSignatureOptions{}, "image-add-signature", "Add a detached signature to image", func(s *mcclient.ClientSession, opts *ImageAddSignatureOptions) error {
+		if len(opts.SignatureFile) == 0 {
+			return fmt.Errorf("--signature-file is required")
+		}
+		params := jsonutils.NewDict()
+		err := addImageSignatureOptions(params, opts.ImageSignatureOptions)
+		if err != nil {
+			return err
+		}
+		img, err := modules.Images.PerformAction(s, opts.ID, "add-signature", params)
+		if err != nil {
+			return err
+		}
+		printObject(img)
+		return nil
+	})
+
+	type ImageSignaturesOptions struct {
+		ID string `help:"ID or name of image"`
+	}
+	R(&ImageSignaturesOptions{}, "image-verify-signature", "Verify image signatures against the trusted keys and certificates", func(s *mcclient.ClientSession, opts *ImageSignaturesOptions) error {
+		img, err := modules.Images.PerformAction(s, opts.ID, "verify-signature", nil)
+		if err != nil {
+			return err
+		}
+		printObject(img)
+		return nil
+	})
+
+	R(&ImageSignaturesOptions{}, "image-signatures", "Show signatures of a image", func(s *mcclient.ClientSession, opts *ImageSignaturesOptions) error {
+		result, err := modules.Images.GetSpecific(s, opts.ID, "signatures", nil)
+		if err != nil {
+			return err
+		}
+		sigs, _ := result.GetArray("signatures")
+		if sigs != nil {
+			printList(&modulebase.ListResult{Data: sigs}, []string{"id", "format", "signer", "status", "reason", "created_at"})
+		}
+		printObject(result.(*jsonutils.JSONDict).CopyExcludes("signatures"))
+		return nil
+	})
 }
@@ -132,6 +132,21 @@ func init() {
 		return nil
 	})
 
+	type ActionVerifyOptions struct {
+		StartId int64 `help:"Verify action logs from this id"`
+		EndId   int64 `help:"Verify action logs until this id"`
+		Limit   int   `help:"Maximal number of action logs to verify"`
+	}
+
+	R(&ActionVerifyOptions{}, "action-verify", "Verify hash chain of action logs", func(s *mcclient.ClientSession, args *ActionVerifyOptions) error {
+		resp, err := modules.Actions.Get(s, "verify", jsonutils.Marshal(args))
+		if err != nil {
+			return err
+		}
+		printObject(resp)
+		return nil
+	})
+
 	type ActionPurgeOptions struct {
 		Tables []string
 	}
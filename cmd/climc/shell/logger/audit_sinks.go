@@ -0,0 +1,210 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"strings"
+
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/logger"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type AuditSinkFilterOptions struct {
+	Service  []string `help:"Export action logs of these services only"`
+	Action   []string `help:"Export these actions only"`
+	ObjType  []string `help:"Export action logs of these object types only"`
+	Severity []string `help:"Export action logs of these severities only" choices:"EMERGENCY|ALERT|CRITICAL|ERROR|WARNING|NOTICE|INFO|DEBUG"`
+	Kind     []string `help:"Export action logs of these kinds only" choices:"NORMAL|ABNORMAL|ILLEGAL"`
+	Succ     bool     `help:"Export success action logs only"`
+	Fail     bool     `help:"Export failed action logs only"`
+}
+
+func (o *AuditSinkFilterOptions) filter() *api.AuditSinkFilter {
+	filter := &api.AuditSinkFilter{
+		Services:   o.Service,
+		Actions:    o.Action,
+		ObjTypes:   o.ObjType,
+		Severities: o.Severity,
+		Kinds:      o.Kind,
+	}
+	if o.Succ != o.Fail {
+		succ := o.Succ
+		filter.Success = &succ
+	}
+	if filter.IsZero() {
+		return nil
+	}
+	return filter
+}
+
+type AuditSinkConfigOptions struct {
+	AppName            string   `help:"Syslog APP-NAME, default cloudaudit"`
+	Facility           *int     `help:"Syslog facility, default 13 (log audit)"`
+	SdId               string   `help:"RFC5424 structured data ID, default cloudaudit@32473"`
+	Header             []string `help:"HTTP header of jsonl sink, e.g. Authorization=Bearer xxx"`
+	Topic              string   `help:"Kafka topic"`
+	InsecureSkipVerify bool     `help:"Skip TLS certificate verification"`
+	BatchSize          int      `help:"Number of action logs exported in a batch, default 100"`
+}
+
+func (o *AuditSinkConfigOptions) config() *api.AuditSinkConfig {
+	conf := &api.AuditSinkConfig{
+		AppName:            o.AppName,
+		Facility:           o.Facility,
+		SdId:               o.SdId,
+		Topic:              o.Topic,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		BatchSize:          o.BatchSize,
+	}
+	for _, header := range o.Header {
+		if i := strings.Index(header, "="); i > 0 {
+			if conf.Headers == nil {
+				conf.Headers = map[string]string{}
+			}
+			conf.Headers[header[:i]] = header[i+1:]
+		}
+	}
+	if conf.IsZero() {
+		return nil
+	}
+	return conf
+}
+
+func init() {
+	type AuditSinkListOptions struct {
+		options.BaseListOptions
+		Type []string `help:"Filter by sink type" choices:"syslog|cef|http_jsonl|kafka"`
+	}
+	R(&AuditSinkListOptions{}, "audit-sink-list", "List audit sinks", func(s *mcclient.ClientSession, args *AuditSinkListOptions) error {
+		params, err := options.ListStructToParams(args)
+		if err != nil {
+			return err
+		}
+		result, err := modules.AuditSinks.List(s, params)
+		if err != nil {
+			return err
+		}
+		printList(result, modules.AuditSinks.GetColumns(s))
+		return nil
+	})
+
+	type AuditSinkCreateOptions struct {
+		AuditSinkFilterOptions
+		AuditSinkConfigOptions
+
+		NAME          string `help:"Name of the audit sink"`
+		TYPE          string `help:"Type of the audit sink" choices:"syslog|cef|http_jsonl|kafka"`
+		URL           string `help:"URL of the audit sink, e.g. tcp://host:514, tls://host:6514, https://host/path, kafka://broker1:9092,broker2:9092"`
+		Desc          string `help:"Description"`
+		FromBeginning bool   `help:"Export all existing action logs, otherwise only action logs created afterwards"`
+	}
+	R(&AuditSinkCreateOptions{}, "audit-sink-create", "Create an audit sink", func(s *mcclient.ClientSession, args *AuditSinkCreateOptions) error {
+		input := api.AuditSinkCreateInput{
+			Type:          args.TYPE,
+			Url:           args.URL,
+			Config:        args.config(),
+			Filter:        args.filter(),
+			FromBeginning: args.FromBeginning,
+		}
+		input.Name = args.NAME
+		input.Description = args.Desc
+		result, err := modules.AuditSinks.Create(s, jsonutils.Marshal(input))
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type AuditSinkIdOptions struct {
+		ID string `help:"ID or name of the audit sink"`
+	}
+	R(&AuditSinkIdOptions{}, "audit-sink-show", "Show an audit sink", func(s *mcclient.ClientSession, args *AuditSinkIdOptions) error {
+		result, err := modules.AuditSinks.Get(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	type AuditSinkUpdateOptions struct {
+		AuditSinkFilterOptions
+		AuditSinkConfigOptions
+
+		ID   string `help:"ID or name of the audit sink"`
+		Name string `help:"New name"`
+		Desc string `help:"Description"`
+		Url  string `help:"URL of the audit sink"`
+	}
+	R(&AuditSinkUpdateOptions{}, "audit-sink-update", "Update an audit sink", func(s *mcclient.ClientSession, args *AuditSinkUpdateOptions) error {
+		input := api.AuditSinkUpdateInput{
+			Url:    args.Url,
+			Config: args.config(),
+			Filter: args.filter(),
+		}
+		input.Name = args.Name
+		input.Description = args.Desc
+		result, err := modules.AuditSinks.Update(s, args.ID, jsonutils.Marshal(input))
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	R(&AuditSinkIdOptions{}, "audit-sink-delete", "Delete an audit sink", func(s *mcclient.ClientSession, args *AuditSinkIdOptions) error {
+		result, err := modules.AuditSinks.Delete(s, args.ID, nil)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+
+	for _, action := range []string{"enable", "disable"} {
+		action := action
+		R(&AuditSinkIdOptions{}, "audit-sink-"+action, action+" an audit sink", func(s *mcclient.ClientSession, args *AuditSinkIdOptions) error {
+			result, err := modules.AuditSinks.PerformAction(s, args.ID, action, nil)
+			if err != nil {
+				return err
+			}
+			printObject(result)
+			return nil
+		})
+	}
+
+	type AuditSinkResetCursorOptions struct {
+		ID            string `help:"ID or name of the audit sink"`
+		ActionId      int64  `help:"Export action logs after this id"`
+		AdminActionId int64  `help:"Export admin action logs after this id"`
+	}
+	R(&AuditSinkResetCursorOptions{}, "audit-sink-reset-cursor", "Export action logs again from the given ids", func(s *mcclient.ClientSession, args *AuditSinkResetCursorOptions) error {
+		input := api.AuditSinkResetCursorInput{
+			ActionId:      args.ActionId,
+			AdminActionId: args.AdminActionId,
+		}
+		result, err := modules.AuditSinks.PerformAction(s, args.ID, "reset-cursor", jsonutils.Marshal(input))
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/manifest"
+)
+
+func init() {
+	type ManifestPlanOptions struct {
+		File  []string `help:"manifest files in YAML or JSON" short-token:"f" required:"true"`
+		Stack string   `help:"stack name, overrides the stack of the manifest"`
+		Prune bool     `help:"delete the resources of the stack which are removed from the manifest"`
+	}
+	type ManifestApplyOptions struct {
+		ManifestPlanOptions
+		AutoApprove bool `help:"apply without confirmation"`
+		NoWait      bool `help:"do not wait for the resources to become ready unless they are referenced"`
+		Timeout     int  `help:"timeout in minutes of waiting for each resource" default:"30"`
+	}
+	type ManifestDestroyOptions struct {
+		STACK       string `help:"stack name"`
+		AutoApprove bool   `help:"destroy without confirmation"`
+		Timeout     int    `help:"timeout in minutes of waiting for each resource" default:"30"`
+	}
+
+	planManifest := func(s *mcclient.ClientSession, args *ManifestPlanOptions) (*manifest.SPlan, error) {
+		m, err := manifest.LoadManifests(args.File)
+		if err != nil {
+			return nil, err
+		}
+		if len(args.Stack) > 0 {
+			m.Stack = args.Stack
+		}
+		return manifest.Plan(manifest.NewSessionClient(s), m, args.Prune)
+	}
+	confirm := func(prompt string) bool {
+		fmt.Printf("%s Only 'yes' will be accepted: ", prompt)
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		return strings.TrimSpace(line) == "yes"
+	}
+	apply := func(s *mcclient.ClientSession, plan *manifest.SPlan, autoApprove, wait bool, timeout int) error {
+		plan.Print(os.Stdout)
+		if !plan.HasChanges() {
+			return nil
+		}
+		if !autoApprove && !confirm("Do you want to perform these actions?") {
+			return fmt.Errorf("cancelled")
+		}
+		err := manifest.Apply(manifest.NewSessionClient(s), plan, manifest.SApplyOptions{
+			Wait:    wait,
+			Timeout: time.Duration(timeout) * time.Minute,
+			Output:  os.Stdout,
+		})
+		if err != nil {
+			return err
+		}
+		create, update, delete := plan.Summary()
+		fmt.Printf("Apply complete! Resources: %d created, %d updated, %d deleted.\n", create, update, delete)
+		return nil
+	}
+
+	R(&ManifestPlanOptions{}, "plan", "Show the changes required by the infrastructure manifests", func(s *mcclient.ClientSession, args *ManifestPlanOptions) error {
+		plan, err := planManifest(s, args)
+		if err != nil {
+			return err
+		}
+		plan.Print(os.Stdout)
+		return nil
+	})
+
+	R(&ManifestApplyOptions{}, "apply", "Create or update the resources of the infrastructure manifests", func(s *mcclient.ClientSession, args *ManifestApplyOptions) error {
+		plan, err := planManifest(s, &args.ManifestPlanOptions)
+		if err != nil {
+			return err
+		}
+		return apply(s, plan, args.AutoApprove, !args.NoWait, args.Timeout)
+	})
+
+	R(&ManifestDestroyOptions{}, "destroy", "Delete all resources of a stack created by apply", func(s *mcclient.ClientSession, args *ManifestDestroyOptions) error {
+		plan, err := manifest.PlanDestroy(manifest.NewSessionClient(s), args.STACK)
+		if err != nil {
+			return err
+		}
+		return apply(s, plan, args.AutoApprove, true, args.Timeout)
+	})
+}
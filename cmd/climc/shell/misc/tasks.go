@@ -82,4 +82,20 @@ func init() {
 		return nil
 	})
 
+	type TaskCancelOptions struct {
+		ID          string `help:"ID of the task"`
+		Reason      string `help:"reason of cancellation"`
+		ServiceType string `choices:"image|cloudid|cloudevent|devtool|ansible|identity|notify|log|compute|compute_v2"`
+	}
+
+	R(&TaskCancelOptions{}, "task-cancel", "Cancel a running task", func(s *mcclient.ClientSession, args *TaskCancelOptions) error {
+		man := compute.TasksManager{}
+		params := jsonutils.Marshal(args)
+		result, err := man.Cancel(s, args.ID, params)
+		if err != nil {
+			return err
+		}
+		printObject(result)
+		return nil
+	})
 }
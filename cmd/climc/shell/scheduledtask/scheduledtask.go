@@ -38,7 +38,7 @@ func init() {
 	type ScheduledTaskListOptions struct {
 		options.BaseListOptions
 
-		ScheduledType string `help:"scheduled type" choices:"timing|cycle"`
+		ScheduledType string `help:"scheduled type" choices:"timing|cycle|cron"`
 		ResourceType  string `help:"resource type"`
 		Operation     string `help:"operation"`
 		UtcOffset     int    `help:"utc offset"`
@@ -82,12 +82,31 @@ func init() {
 		CycleEndTime   string `help:"End time for cycle timer, format:'2006-01-02 15:04:05'" json:"end_time"`
 	}
 
+	type CronTimer struct {
+		CronExpression string `help:"Cron expression for cron timer, e.g. '0 9 * * 1-5'"`
+		CronTimezone   string `help:"Timezone in which cron expression is evaluated, e.g. Asia/Shanghai"`
+		CronStartTime  string `help:"Start time for cron timer, format:'2006-01-02 15:04:05'"`
+		CronEndTime    string `help:"End time for cron timer, format:'2006-01-02 15:04:05'"`
+	}
+
+	type OperationParams struct {
+		SnapshotRetention int    `help:"Number of snapshots created by this task to keep for each resource, 0 means unlimited"`
+		WithMemory        bool   `help:"Whether server snapshot includes memory"`
+		InstanceType      string `help:"Instance type for change_config"`
+		VcpuCount         int    `help:"Vcpu count for change_config"`
+		VmemSize          string `help:"Memory size for change_config, e.g. 1024M, 1G"`
+		AutoStart         bool   `help:"Start server after change_config"`
+		ScriptId          string `help:"Devtool script id or name for run_script"`
+	}
+
 	type ScheduledTaskCreateOptions struct {
 		NAME          string `help:"ScheduledTask Name" json:"name"`
-		ScheduledType string `help:"Scheudled Type" choices:"timing|cycle" json:"scheduled_type"`
+		ScheduledType string `help:"Scheudled Type" choices:"timing|cycle|cron" json:"scheduled_type"`
 
 		Timer
 		CycleTimer
+		CronTimer
+		OperationParams
 
 		ResourceType string   `help:"resource type"`
 		Operation    string   `help:"operation"`
@@ -116,6 +135,19 @@ func init() {
 				return fmt.Errorf("invalid time format for 'end_time'")
 			}
 		}
+		var cronStartTime, cronEndTime time.Time
+		if len(args.CronStartTime) > 0 {
+			cronStartTime, err = time.Parse(formatStr, args.CronStartTime)
+			if err != nil {
+				return fmt.Errorf("invalid time format for 'start_time'")
+			}
+		}
+		if len(args.CronEndTime) > 0 {
+			cronEndTime, err = time.Parse(formatStr, args.CronEndTime)
+			if err != nil {
+				return fmt.Errorf("invalid time format for 'end_time'")
+			}
+		}
 		stCreateInput := apis.ScheduledTaskCreateInput{
 			ScheduledType: args.ScheduledType,
 			Timer: apis.TimerCreateInput{
@@ -130,10 +162,25 @@ func init() {
 				StartTime: starttime,
 				EndTime:   endtime,
 			},
+			CronTimer: apis.CronTimerCreateInput{
+				Expression: args.CronExpression,
+				Timezone:   args.CronTimezone,
+				StartTime:  cronStartTime,
+				EndTime:    cronEndTime,
+			},
 			ResourceType: args.ResourceType,
 			Operation:    args.Operation,
-			LabelType:    args.LabelType,
-			Labels:       args.Labels,
+			OperationParams: &apis.ScheduledTaskOperationParams{
+				SnapshotRetention: args.SnapshotRetention,
+				WithMemory:        args.WithMemory,
+				InstanceType:      args.InstanceType,
+				VcpuCount:         args.VcpuCount,
+				VmemSize:          args.VmemSize,
+				AutoStart:         args.AutoStart,
+				ScriptId:          args.ScriptId,
+			},
+			LabelType: args.LabelType,
+			Labels:    args.Labels,
 		}
 		stCreateInput.Name = args.NAME
 		ret, err := modules.ScheduledTask.Create(s, jsonutils.Marshal(stCreateInput))
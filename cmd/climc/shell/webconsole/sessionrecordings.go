@@ -0,0 +1,120 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webconsole
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/cmd/climc/shell"
+	"yunion.io/x/onecloud/cmd/climc/shell/events"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/webconsole"
+)
+
+// playAsciicast writes the output events of an asciicast v2 recording to w
+// in the recorded pace
+func playAsciicast(r io.Reader, w io.Writer, speed float64, maxIdle float64) error {
+	reader := bufio.NewReader(r)
+	// the first line is the header
+	if _, err := reader.ReadBytes('\n'); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return errors.Wrap(err, "read header")
+	}
+	last := 0.0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			ev := []interface{}{}
+			if err := json.Unmarshal(line, &ev); err != nil {
+				return errors.Wrapf(err, "invalid event %q", line)
+			}
+			if len(ev) != 3 {
+				return errors.Errorf("invalid event %q", line)
+			}
+			at, _ := ev[0].(float64)
+			evType, _ := ev[1].(string)
+			data, _ := ev[2].(string)
+			if evType == "o" {
+				idle := at - last
+				if maxIdle > 0 && idle > maxIdle {
+					idle = maxIdle
+				}
+				if idle > 0 {
+					time.Sleep(time.Duration(idle / speed * float64(time.Second)))
+				}
+				last = at
+				fmt.Fprint(w, data)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "read event")
+		}
+	}
+}
+
+func init() {
+	type SessionRecordingListOptions struct {
+		events.EventListOptions
+		SessionId []string `help:"webconsole session ids"`
+	}
+	R(&SessionRecordingListOptions{}, "webconsole-session-recording-list", "List webconsole session recordings", func(s *mcclient.ClientSession, args *SessionRecordingListOptions) error {
+		ret, err := webconsole.SessionRecording.List(s, jsonutils.Marshal(args))
+		if err != nil {
+			return err
+		}
+		shell.PrintList(ret, webconsole.SessionRecording.GetColumns(s))
+		return nil
+	})
+
+	type SessionRecordingPlaybackOptions struct {
+		ID      string  `help:"id of the session recording"`
+		Speed   float64 `help:"playback speed" default:"1"`
+		MaxIdle float64 `help:"limit idle time between outputs to the given seconds, 0 means no limit" default:"2"`
+		Output  string  `help:"save the asciicast file instead of playing it"`
+	}
+	R(&SessionRecordingPlaybackOptions{}, "webconsole-session-recording-playback", "Replay a webconsole session recording in terminal", func(s *mcclient.ClientSession, args *SessionRecordingPlaybackOptions) error {
+		if args.Speed <= 0 {
+			return fmt.Errorf("invalid speed %f", args.Speed)
+		}
+		reader, err := webconsole.SessionRecording.Playback(s, args.ID)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		if len(args.Output) > 0 {
+			f, err := os.Create(args.Output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			_, err = io.Copy(f, reader)
+			return err
+		}
+		return playAsciicast(reader, os.Stdout, args.Speed, args.MaxIdle)
+	})
+}
@@ -42,6 +42,10 @@ import (
 const (
 	TotpEnable  = '1'
 	TotpDisable = '0'
+
+	// the first two flag bytes carry the webauthn state in the second bit,
+	// so that cookies issued by earlier versions decode unchanged
+	webauthnFlag = 0x02
 )
 
 var (
@@ -59,22 +63,37 @@ type SAuthToken struct {
 	initTotp   bool
 	isSsoLogin bool
 
+	// verified by a webauthn authenticator
+	verifyWebauthn bool
+	// domain policy requires webauthn for the session
+	requireWebauthn bool
+
 	retryCount     int    // 重试计数器
 	lockExpireTime uint32 // 锁定时间
 }
 
-func (t SAuthToken) encodeBytes() []byte {
-	msg := bytes.Buffer{}
-	if t.verifyTotp {
-		msg.WriteByte(TotpEnable)
-	} else {
-		msg.WriteByte(TotpDisable)
+func encodeFlag(totp bool, webauthn bool) byte {
+	flag := byte(TotpDisable)
+	if totp {
+		flag = TotpEnable
 	}
-	if t.enableTotp {
-		msg.WriteByte(TotpEnable)
-	} else {
-		msg.WriteByte(TotpDisable)
+	if webauthn {
+		flag |= webauthnFlag
 	}
+	return flag
+}
+
+func decodeFlag(b byte) (totp bool, webauthn bool) {
+	if b < TotpDisable {
+		return false, false
+	}
+	return (b-TotpDisable)&0x01 != 0, (b-TotpDisable)&webauthnFlag != 0
+}
+
+func (t SAuthToken) encodeBytes() []byte {
+	msg := bytes.Buffer{}
+	msg.WriteByte(encodeFlag(t.verifyTotp, t.verifyWebauthn))
+	msg.WriteByte(encodeFlag(t.enableTotp, t.requireWebauthn))
 	if t.initTotp {
 		msg.WriteByte(TotpEnable)
 	} else {
@@ -125,16 +144,8 @@ func decodeBytes(tt []byte) (*SAuthToken, error) {
 	if len(tt) < 10 {
 		return nil, errors.Wrap(errors.ErrInvalidStatus, "too short")
 	}
-	if tt[0] == TotpEnable {
-		ret.verifyTotp = true
-	} else {
-		ret.verifyTotp = false
-	}
-	if tt[1] == TotpEnable {
-		ret.enableTotp = true
-	} else {
-		ret.enableTotp = false
-	}
+	ret.verifyTotp, ret.verifyWebauthn = decodeFlag(tt[0])
+	ret.enableTotp, ret.requireWebauthn = decodeFlag(tt[1])
 	if tt[2] == TotpEnable {
 		ret.initTotp = true
 	} else {
@@ -198,12 +209,23 @@ func (t SAuthToken) GetAuthCookie(token mcclient.TokenCredential) string {
 	info.Add(jsonutils.NewBool(t.enableTotp), "totp_on")                      // 用户totp 开启状态。 True（已开启）|False(未开启)
 	info.Add(jsonutils.NewBool(t.isSsoLogin), "is_sso")                       // 用户是否通过SSO登录
 	info.Add(jsonutils.NewBool(options.Options.EnableTotp), "system_totp_on") // 全局totp 开启状态。 True（已开启）|False(未开启)
+	info.Add(jsonutils.NewBool(t.verifyWebauthn), "webauthn_verified")        // 用户webauthn验证通过
+	info.Add(jsonutils.NewBool(t.requireWebauthn), "webauthn_required")       // 域策略要求使用webauthn验证
 	info.Add(jsonutils.NewString(token.GetUserId()), "user_id")
 	info.Add(jsonutils.NewString(token.GetUserName()), "user")
 	return info.String()
 }
 
+// IsTotpVerified reports whether the session has passed the second factor
+// it requires. A webauthn assertion satisfies TOTP as well, while a session
+// required to use webauthn by the domain policy is not satisfied by TOTP.
 func (t SAuthToken) IsTotpVerified() bool {
+	if t.requireWebauthn {
+		return t.verifyWebauthn
+	}
+	if t.verifyWebauthn {
+		return true
+	}
 	if !options.Options.EnableTotp {
 		return true
 	}
@@ -213,6 +235,12 @@ func (t SAuthToken) IsTotpVerified() bool {
 	return t.verifyTotp
 }
 
+// IsTotpPasscodeVerified reports whether a TOTP passcode has been verified
+// in the session
+func (t SAuthToken) IsTotpPasscodeVerified() bool {
+	return t.verifyTotp
+}
+
 func (t SAuthToken) IsTotpEnabled() bool {
 	return t.enableTotp
 }
@@ -225,6 +253,22 @@ func (t *SAuthToken) SetTotpInitialized() {
 	t.initTotp = true
 }
 
+func (t SAuthToken) IsWebauthnVerified() bool {
+	return t.verifyWebauthn
+}
+
+func (t *SAuthToken) SetWebauthnVerified() {
+	t.verifyWebauthn = true
+}
+
+func (t SAuthToken) IsWebauthnRequired() bool {
+	return t.requireWebauthn
+}
+
+func (t *SAuthToken) SetWebauthnRequired() {
+	t.requireWebauthn = true
+}
+
 func (t *SAuthToken) SetToken(tid string) {
 	t.token = tid
 }
@@ -54,3 +54,39 @@ func TestEncoeDecode(t *testing.T) {
 		t.Fatalf("token2 != token")
 	}
 }
+
+func TestWebauthnFlags(t *testing.T) {
+	SetupTest()
+	for _, token := range []SAuthToken{
+		{token: "t1", verifyTotp: true, enableTotp: true},
+		{token: "t2", verifyWebauthn: true, requireWebauthn: true},
+		{token: "t3", verifyTotp: true, enableTotp: true, initTotp: true, verifyWebauthn: true, requireWebauthn: true},
+	} {
+		token2, err := decodeBytes(token.encodeBytes())
+		if err != nil {
+			t.Fatalf("decodeBytes fail %s", err)
+		}
+		if *token2 != token {
+			t.Errorf("decoded %#v != %#v", *token2, token)
+		}
+	}
+
+	// cookies issued before webauthn support
+	old := []byte{TotpEnable, TotpEnable, TotpDisable, TotpDisable, 0, 0, 0, 0, 0, 0, 't'}
+	token, err := decodeBytes(old)
+	if err != nil {
+		t.Fatalf("decodeBytes fail %s", err)
+	}
+	if !token.verifyTotp || !token.enableTotp || token.verifyWebauthn || token.requireWebauthn {
+		t.Errorf("unexpected decoded legacy token %#v", *token)
+	}
+
+	required := SAuthToken{verifyTotp: true, enableTotp: true, requireWebauthn: true}
+	if required.IsTotpVerified() {
+		t.Errorf("totp should not satisfy required webauthn")
+	}
+	required.SetWebauthnVerified()
+	if !required.IsTotpVerified() {
+		t.Errorf("webauthn should satisfy the second factor")
+	}
+}
@@ -79,6 +79,7 @@ func (h *AuthHandlers) AddMethods() {
 		NewHP(handleOIDCJWKeys, "oidc", "keys"),
 		NewHP(handleOIDCUserInfo, "oidc", "user"),
 		NewHP(handleOIDCRPInitLogout, "oidc", "logout"),
+		NewHP(handleOIDCDeviceVerify, "oidc", "device"),
 	)
 	h.AddByMethod(POST, nil,
 		NewHP(h.initTotpSecrets, "initcredential"),
@@ -91,6 +92,13 @@ func (h *AuthHandlers) AddMethods() {
 		NewHP(h.handleIdpInitSsoLogin, "ssologin", "<idp_id>"),
 		NewHP(handleOIDCToken, "oidc", "token"),
 		NewHP(handleOIDCRPInitLogout, "oidc", "logout"),
+		NewHP(handleOIDCDeviceAuthorize, "oidc", "device", "authorize"),
+		NewHP(handleOIDCDeviceConfirm, "oidc", "device"),
+		// webauthn
+		NewHP(handleWebauthnRegisterBegin, "webauthn", "register", "begin"),
+		NewHP(handleWebauthnRegisterFinish, "webauthn", "register", "finish"),
+		NewHP(handleWebauthnLoginBegin, "webauthn", "login", "begin"),
+		NewHP(handleWebauthnLoginFinish, "webauthn", "login", "finish"),
 	)
 
 	// auth middleware handler
@@ -102,6 +110,7 @@ func (h *AuthHandlers) AddMethods() {
 		NewHP(h.getResources, "scoped_resources"),
 		NewHP(fetchIdpBasicConfig, "idp", "<idp_id>", "info"),
 		NewHP(fetchIdpSAMLMetadata, "idp", "<idp_id>", "saml-metadata"),
+		NewHP(handleWebauthnListCredentials, "webauthn", "credentials"),
 	)
 	h.AddByMethod(POST, FetchAuthToken,
 		NewHP(h.resetUserPassword, "password"),
@@ -111,9 +120,11 @@ func (h *AuthHandlers) AddMethods() {
 	)
 	h.AddByMethod(PATCH, FetchAuthToken,
 		NewHP(h.doPatchPolicy, "policies", "<policy_id>"),
+		NewHP(handleWebauthnUpdateCredential, "webauthn", "credentials", "<credential_id>"),
 	)
 	h.AddByMethod(DELETE, FetchAuthToken,
 		NewHP(h.doDeletePolicies, "policies"),
+		NewHP(handleWebauthnDeleteCredential, "webauthn", "credentials", "<credential_id>"),
 	)
 }
 
@@ -597,6 +608,13 @@ func (h *AuthHandlers) doLogin(ctx context.Context, w http.ResponseWriter, req *
 		return httperrors.NewForbiddenError("user forbidden login from web")
 	}
 
+	// checked for every login and project switch, the new scope may
+	// require webauthn and the session has to authenticate again
+	_, err = refreshWebauthnPolicy(ctx, req, authToken, token)
+	if err != nil {
+		return err
+	}
+
 	saveAuthCookie(w, authToken, token)
 
 	if len(token.GetProjectId()) > 0 {
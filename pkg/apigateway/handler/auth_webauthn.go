@@ -0,0 +1,562 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apigateway/clientman"
+	"yunion.io/x/onecloud/pkg/apigateway/options"
+	"yunion.io/x/onecloud/pkg/appctx"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/policy"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+	"yunion.io/x/onecloud/pkg/util/hashcache"
+	"yunion.io/x/onecloud/pkg/util/rbacutils"
+	"yunion.io/x/onecloud/pkg/util/webauthn"
+)
+
+const (
+	// WebAuthn ceremonies must be completed in 5 minutes
+	WEBAUTHN_CEREMONY_TIMEOUT_SECONDS = 300
+
+	webauthnStateType = "webauthn"
+)
+
+func getWebauthnRelyingParty() (webauthn.SRelyingParty, error) {
+	rp := webauthn.SRelyingParty{
+		Id:      options.Options.WebauthnRpId,
+		Name:    options.Options.WebauthnRpName,
+		Origins: options.Options.WebauthnOrigins,
+	}
+	if len(options.Options.ApiServer) > 0 {
+		apiUrl, err := url.Parse(options.Options.ApiServer)
+		if err == nil && len(apiUrl.Host) > 0 {
+			if len(rp.Id) == 0 {
+				rp.Id = apiUrl.Hostname()
+			}
+			if len(rp.Origins) == 0 {
+				rp.Origins = []string{apiUrl.Scheme + "://" + apiUrl.Host}
+			}
+		}
+	}
+	if len(rp.Id) == 0 || len(rp.Origins) == 0 {
+		return rp, errors.Wrap(httperrors.ErrNotSupported, "webauthn relying party is not configured, set api_server or webauthn_rp_id and webauthn_origins")
+	}
+	if len(rp.Name) == 0 {
+		rp.Name = rp.Id
+	}
+	return rp, nil
+}
+
+// sWebauthnState binds the challenge of a ceremony to the user, it is
+// encrypted and handed to the browser so that any apigateway instance can
+// finish the ceremony
+type sWebauthnState struct {
+	Ceremony  string
+	Challenge string
+	UserId    string
+	Expires   time.Time
+}
+
+func newWebauthnState(ceremony string, userId string) sWebauthnState {
+	return sWebauthnState{
+		Ceremony:  ceremony,
+		Challenge: randomOIDCString(32),
+		UserId:    userId,
+		Expires:   time.Now().Add(WEBAUTHN_CEREMONY_TIMEOUT_SECONDS * time.Second),
+	}
+}
+
+func (state sWebauthnState) encode() string {
+	json := jsonutils.NewDict()
+	json.Add(jsonutils.NewString(state.Ceremony), "ceremony")
+	json.Add(jsonutils.NewString(state.Challenge), "challenge")
+	json.Add(jsonutils.NewString(state.UserId), "user_id")
+	json.Add(jsonutils.NewTimeString(state.Expires), "expires")
+	json.Add(jsonutils.NewString(webauthnStateType), "type")
+	return clientman.EncryptString([]byte(json.String()))
+}
+
+func decodeWebauthnState(str string, ceremony string, userId string) (sWebauthnState, error) {
+	state := sWebauthnState{}
+	json, err := decryptOIDCJson(str)
+	if err != nil {
+		return state, errors.Wrap(httperrors.ErrInputParameter, "invalid state")
+	}
+	if tokenType, _ := json.GetString("type"); tokenType != webauthnStateType {
+		return state, errors.Wrap(httperrors.ErrInputParameter, "invalid state")
+	}
+	state.Ceremony, _ = json.GetString("ceremony")
+	state.Challenge, _ = json.GetString("challenge")
+	state.UserId, _ = json.GetString("user_id")
+	state.Expires, _ = json.GetTime("expires")
+	if state.Ceremony != ceremony || state.UserId != userId {
+		return state, errors.Wrap(httperrors.ErrInputParameter, "state mismatch")
+	}
+	if state.Expires.Before(time.Now()) {
+		return state, errors.Wrap(httperrors.ErrTimeout, "ceremony expired")
+	}
+	return state, nil
+}
+
+// consumeWebauthnState decodes the state and marks its challenge used in
+// keystone, so that the challenge can not be replayed on any instance
+func consumeWebauthnState(s *mcclient.ClientSession, str string, ceremony string, userId string) ([]byte, error) {
+	state, err := decodeWebauthnState(str, ceremony, userId)
+	if err != nil {
+		return nil, err
+	}
+	unused, err := modules.Credentials.MarkTokenUsed(s, webauthnStateType+":"+state.Challenge, state.Expires)
+	if err != nil {
+		return nil, errors.Wrap(err, "MarkTokenUsed")
+	}
+	if !unused {
+		return nil, errors.Wrap(httperrors.ErrInputParameter, "challenge has been used")
+	}
+	return webauthn.DecodeBase64(state.Challenge)
+}
+
+func webauthnCredentialDescriptors(creds []modules.SWebauthnCredential) []webauthn.SCredentialDescriptor {
+	ret := make([]webauthn.SCredentialDescriptor, len(creds))
+	for i := range creds {
+		ret[i] = webauthn.SCredentialDescriptor{
+			Type:       webauthn.PUBLIC_KEY_CREDENTIAL_TYPE,
+			Id:         creds[i].CredentialId,
+			Transports: creds[i].Transports,
+		}
+	}
+	return ret
+}
+
+// 是否允许当前会话注册新的WebAuthn认证器：
+// 已完成WebAuthn认证的会话；
+// 或者用户尚未注册任何认证器，域策略要求WebAuthn时须已通过TOTP验证或持有管理员签发的注册凭证，
+// 否则须已通过（或无需）TOTP验证
+func isWebauthnRegisterAllowed(authToken *clientman.SAuthToken, creds []modules.SWebauthnCredential, enrolled bool) bool {
+	if authToken.IsWebauthnVerified() {
+		return true
+	}
+	if len(creds) > 0 {
+		return !authToken.IsWebauthnRequired() && authToken.IsTotpVerified()
+	}
+	if authToken.IsWebauthnRequired() {
+		return enrolled || authToken.IsTotpPasscodeVerified()
+	}
+	if !options.Options.EnableTotp || !authToken.IsTotpEnabled() || !authToken.IsTotpInitialized() {
+		return true
+	}
+	return authToken.IsTotpPasscodeVerified()
+}
+
+// the policy is checked for every request, so that it is cached briefly
+var domainWebauthnPolicyCache = hashcache.NewCache(1024, time.Minute)
+
+// 用户所属域要求管理员使用WebAuthn，且token具有域或系统管理权限
+func isWebauthnRequired(ctx context.Context, region string, token mcclient.TokenCredential) (bool, error) {
+	if !policy.PolicyManager.IsScopeCapable(token, rbacutils.ScopeDomain) && !policy.PolicyManager.IsScopeCapable(token, rbacutils.ScopeSystem) {
+		return false, nil
+	}
+	domainId := token.GetDomainId()
+	if required := domainWebauthnPolicyCache.AtomicGet(domainId); required != nil {
+		return required.(bool), nil
+	}
+	s := auth.GetAdminSession(ctx, region, "")
+	domain, err := modules.Domains.GetById(s, domainId, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "Domains.GetById %s", domainId)
+	}
+	required := jsonutils.QueryBoolean(domain, "admin_require_webauthn", false)
+	domainWebauthnPolicyCache.AtomicSet(domainId, required)
+	return required, nil
+}
+
+// refreshWebauthnPolicy marks the session required to use webauthn once the
+// token gains domain or system privileges in a domain with the policy on,
+// the session has to pass a webauthn assertion before it is accepted again
+func refreshWebauthnPolicy(ctx context.Context, req *http.Request, authToken *clientman.SAuthToken, token mcclient.TokenCredential) (bool, error) {
+	if authToken.IsWebauthnRequired() {
+		return false, nil
+	}
+	required, err := isWebauthnRequired(ctx, FetchRegion(req), token)
+	if err != nil {
+		return false, errors.Wrap(err, "isWebauthnRequired")
+	}
+	if required {
+		authToken.SetWebauthnRequired()
+	}
+	return required, nil
+}
+
+// isWebauthnEnrolled verifies the enrollment token issued by the admin
+func isWebauthnEnrolled(s *mcclient.ClientSession, userId string, token string) bool {
+	if len(token) == 0 {
+		return false
+	}
+	_, err := modules.Credentials.VerifyWebauthnEnrollmentToken(s, userId, token)
+	if err != nil {
+		log.Warningf("verify webauthn enrollment token of user %s fail: %s", userId, err)
+		return false
+	}
+	return true
+}
+
+// 开始注册WebAuthn认证器，返回navigator.credentials.create()的参数
+func handleWebauthnRegisterBegin(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t, authToken, err := fetchAuthInfo(ctx, req)
+	if err != nil {
+		httperrors.InvalidCredentialError(ctx, w, "fetchAuthInfo fail: %s", err)
+		return
+	}
+	rp, err := getWebauthnRelyingParty()
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+
+	input := sWebauthnRegisterInput{}
+	if _, _, body := appsrv.FetchEnv(ctx, w, req); body != nil {
+		body.Unmarshal(&input)
+	}
+
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	creds, err := modules.Credentials.GetWebauthnCredentials(s, t.GetUserId())
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	if !isWebauthnRegisterAllowed(authToken, creds, isWebauthnEnrolled(s, t.GetUserId(), input.EnrollmentToken)) {
+		httperrors.ForbiddenError(ctx, w, "second factor authentication or an enrollment token is required to register a new authenticator")
+		return
+	}
+
+	state := newWebauthnState(webauthn.CLIENT_DATA_TYPE_CREATE, t.GetUserId())
+	params := make([]webauthn.SCredentialParameter, len(webauthn.SupportedAlgorithms))
+	for i, alg := range webauthn.SupportedAlgorithms {
+		params[i] = webauthn.SCredentialParameter{Type: webauthn.PUBLIC_KEY_CREDENTIAL_TYPE, Alg: alg}
+	}
+	opts := webauthn.SCredentialCreationOptions{
+		Rp: webauthn.SRelyingPartyEntity{
+			Id:   rp.Id,
+			Name: rp.Name,
+		},
+		User: webauthn.SUserEntity{
+			Id:          webauthn.EncodeBase64([]byte(t.GetUserId())),
+			Name:        t.GetUserName(),
+			DisplayName: t.GetUserName(),
+		},
+		Challenge:          state.Challenge,
+		PubKeyCredParams:   params,
+		Timeout:            WEBAUTHN_CEREMONY_TIMEOUT_SECONDS * 1000,
+		ExcludeCredentials: webauthnCredentialDescriptors(creds),
+		AuthenticatorSelection: webauthn.SAuthenticatorSelection{
+			UserVerification: webauthn.USER_VERIFICATION_PREFERRED,
+		},
+		Attestation: webauthn.ATTESTATION_NONE,
+	}
+
+	resp := jsonutils.NewDict()
+	resp.Add(jsonutils.Marshal(opts), "public_key")
+	resp.Add(jsonutils.NewString(state.encode()), "state")
+	appsrv.SendJSON(w, resp)
+}
+
+type sWebauthnRegisterInput struct {
+	State      string                        `json:"state"`
+	Name       string                        `json:"name"`
+	Credential webauthn.SAttestationResponse `json:"credential"`
+	// 管理员签发的注册凭证，域策略要求WebAuthn且未通过TOTP验证时注册首个认证器需要
+	EnrollmentToken string `json:"enrollment_token"`
+}
+
+// 完成注册WebAuthn认证器
+func handleWebauthnRegisterFinish(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t, authToken, err := fetchAuthInfo(ctx, req)
+	if err != nil {
+		httperrors.InvalidCredentialError(ctx, w, "fetchAuthInfo fail: %s", err)
+		return
+	}
+	rp, err := getWebauthnRelyingParty()
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	input := sWebauthnRegisterInput{}
+	err = fetchWebauthnInput(ctx, w, req, &input)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	creds, err := modules.Credentials.GetWebauthnCredentials(s, t.GetUserId())
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	enrolled := isWebauthnEnrolled(s, t.GetUserId(), input.EnrollmentToken)
+	if !isWebauthnRegisterAllowed(authToken, creds, enrolled) {
+		httperrors.ForbiddenError(ctx, w, "second factor authentication or an enrollment token is required to register a new authenticator")
+		return
+	}
+	challenge, err := consumeWebauthnState(s, input.State, webauthn.CLIENT_DATA_TYPE_CREATE, t.GetUserId())
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	cred, err := rp.VerifyRegistration(input.Credential, challenge, false)
+	if err != nil {
+		log.Warningf("webauthn registration of user %s fail: %s", t.GetUserName(), err)
+		httperrors.InputParameterError(ctx, w, "webauthn registration fail: %v", err)
+		return
+	}
+
+	if len(creds) == 0 && authToken.IsWebauthnRequired() && !authToken.IsTotpPasscodeVerified() {
+		// the enrollment token is single use
+		err = modules.Credentials.ConsumeWebauthnEnrollmentToken(s, t.GetUserId(), input.EnrollmentToken)
+		if err != nil {
+			httperrors.GeneralServerError(ctx, w, err)
+			return
+		}
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if len(name) == 0 {
+		name = "security-key"
+	}
+	saved, err := modules.Credentials.CreateWebauthnCredential(s, t.GetUserId(), modules.SWebauthnCredential{
+		Name:         name,
+		CredentialId: webauthn.EncodeBase64(cred.Id),
+		PublicKey:    webauthn.EncodeBase64(cred.PublicKey),
+		SignCount:    cred.SignCount,
+		Aaguid:       webauthn.EncodeBase64(cred.Aaguid),
+		Transports:   input.Credential.Response.Transports,
+	})
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+
+	// the session still has to pass an assertion with the new authenticator
+	appsrv.SendJSON(w, saved.Marshal())
+}
+
+// 开始WebAuthn二次认证，返回navigator.credentials.get()的参数
+func handleWebauthnLoginBegin(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t, _, err := fetchAuthInfo(ctx, req)
+	if err != nil {
+		httperrors.InvalidCredentialError(ctx, w, "fetchAuthInfo fail: %s", err)
+		return
+	}
+	rp, err := getWebauthnRelyingParty()
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	creds, err := modules.Credentials.GetWebauthnCredentials(s, t.GetUserId())
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	if len(creds) == 0 {
+		httperrors.NotFoundError(ctx, w, "no webauthn authenticator registered")
+		return
+	}
+
+	state := newWebauthnState(webauthn.CLIENT_DATA_TYPE_GET, t.GetUserId())
+	opts := webauthn.SCredentialRequestOptions{
+		Challenge:        state.Challenge,
+		Timeout:          WEBAUTHN_CEREMONY_TIMEOUT_SECONDS * 1000,
+		RpId:             rp.Id,
+		AllowCredentials: webauthnCredentialDescriptors(creds),
+		UserVerification: webauthn.USER_VERIFICATION_PREFERRED,
+	}
+
+	resp := jsonutils.NewDict()
+	resp.Add(jsonutils.Marshal(opts), "public_key")
+	resp.Add(jsonutils.NewString(state.encode()), "state")
+	appsrv.SendJSON(w, resp)
+}
+
+type sWebauthnLoginInput struct {
+	State      string                      `json:"state"`
+	Credential webauthn.SAssertionResponse `json:"credential"`
+}
+
+// 完成WebAuthn二次认证
+func handleWebauthnLoginFinish(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t, authToken, err := fetchAuthInfo(ctx, req)
+	if err != nil {
+		httperrors.InvalidCredentialError(ctx, w, "fetchAuthInfo fail: %s", err)
+		return
+	}
+	rp, err := getWebauthnRelyingParty()
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	input := sWebauthnLoginInput{}
+	err = fetchWebauthnInput(ctx, w, req, &input)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	challenge, err := consumeWebauthnState(s, input.State, webauthn.CLIENT_DATA_TYPE_GET, t.GetUserId())
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	cred, err := fetchUserWebauthnCredential(s, t.GetUserId(), input.Credential.RawId)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	credId, _ := webauthn.DecodeBase64(cred.CredentialId)
+	pubKey, _ := webauthn.DecodeBase64(cred.PublicKey)
+	signCount, err := rp.VerifyAssertion(input.Credential, challenge, webauthn.SCredential{
+		Id:        credId,
+		PublicKey: pubKey,
+		SignCount: cred.SignCount,
+	}, false)
+	if err != nil {
+		log.Warningf("webauthn assertion of user %s fail: %s", t.GetUserName(), err)
+		httperrors.InvalidCredentialError(ctx, w, "webauthn authentication fail: %v", err)
+		return
+	}
+
+	cred.SignCount = signCount
+	cred.LastUsedAt = time.Now().Unix()
+	err = modules.Credentials.UpdateWebauthnCredential(s, *cred)
+	if err != nil {
+		log.Errorf("update webauthn credential %s fail: %s", cred.Id, err)
+	}
+
+	authToken.SetWebauthnVerified()
+	saveAuthCookie(w, authToken, t)
+
+	appsrv.SendJSON(w, jsonutils.NewDict())
+}
+
+func fetchWebauthnInput(ctx context.Context, w http.ResponseWriter, req *http.Request, input interface{}) error {
+	_, _, body := appsrv.FetchEnv(ctx, w, req)
+	if body == nil {
+		return errors.Wrap(httperrors.ErrInputParameter, "request body is empty")
+	}
+	err := body.Unmarshal(input)
+	if err != nil {
+		return errors.Wrapf(httperrors.ErrInputParameter, "unmarshal input: %v", err)
+	}
+	return nil
+}
+
+// fetchUserWebauthnCredential finds the credential of the user by either
+// the keystone credential id or the base64url encoded webauthn credential id
+func fetchUserWebauthnCredential(s *mcclient.ClientSession, uid string, id string) (*modules.SWebauthnCredential, error) {
+	creds, err := modules.Credentials.GetWebauthnCredentials(s, uid)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetWebauthnCredentials")
+	}
+	rawId, _ := webauthn.DecodeBase64(id)
+	for i := range creds {
+		if creds[i].Id == id {
+			return &creds[i], nil
+		}
+		if credId, err := webauthn.DecodeBase64(creds[i].CredentialId); err == nil && len(rawId) > 0 && string(credId) == string(rawId) {
+			return &creds[i], nil
+		}
+	}
+	return nil, httperrors.NewResourceNotFoundError2("webauthn credential", id)
+}
+
+// 列出当前用户注册的WebAuthn认证器
+func handleWebauthnListCredentials(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t := AppContextToken(ctx)
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	creds, err := modules.Credentials.GetWebauthnCredentials(s, t.GetUserId())
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	data := jsonutils.NewArray()
+	for i := range creds {
+		data.Add(creds[i].Marshal())
+	}
+	resp := jsonutils.NewDict()
+	resp.Add(data, "data")
+	resp.Add(jsonutils.NewInt(int64(len(creds))), "total")
+	appsrv.SendJSON(w, resp)
+}
+
+// 重命名WebAuthn认证器
+func handleWebauthnUpdateCredential(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t := AppContextToken(ctx)
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	params := appctx.AppContextParams(ctx)
+	cred, err := fetchUserWebauthnCredential(s, t.GetUserId(), params["<credential_id>"])
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	_, _, body := appsrv.FetchEnv(ctx, w, req)
+	if body == nil {
+		httperrors.InvalidInputError(ctx, w, "request body is empty")
+		return
+	}
+	name, _ := body.GetString("name")
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		httperrors.MissingParameterError(ctx, w, "name")
+		return
+	}
+	cred.Name = name
+	err = modules.Credentials.UpdateWebauthnCredential(s, *cred)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	appsrv.SendJSON(w, cred.Marshal())
+}
+
+// 吊销WebAuthn认证器
+func handleWebauthnDeleteCredential(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	t := AppContextToken(ctx)
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	params := appctx.AppContextParams(ctx)
+	cred, err := fetchUserWebauthnCredential(s, t.GetUserId(), params["<credential_id>"])
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	_, err = modules.Credentials.Delete(s, cred.Id, nil)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	appsrv.SendJSON(w, cred.Marshal())
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/apigateway/clientman"
+	"yunion.io/x/onecloud/pkg/apigateway/options"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+	"yunion.io/x/onecloud/pkg/util/webauthn"
+)
+
+func TestWebauthnState(t *testing.T) {
+	clientman.SetupTest()
+
+	state := newWebauthnState(webauthn.CLIENT_DATA_TYPE_GET, "user1")
+	encoded := state.encode()
+
+	if _, err := decodeOIDCAuthCode(encoded); err == nil {
+		t.Errorf("webauthn state should not be accepted as an authorization code")
+	}
+	if _, err := decodeWebauthnState(encoded, webauthn.CLIENT_DATA_TYPE_CREATE, "user1"); err == nil {
+		t.Errorf("state of another ceremony should be rejected")
+	}
+	if _, err := decodeWebauthnState(encoded, webauthn.CLIENT_DATA_TYPE_GET, "user2"); err == nil {
+		t.Errorf("state of another user should be rejected")
+	}
+	decoded, err := decodeWebauthnState(encoded, webauthn.CLIENT_DATA_TYPE_GET, "user1")
+	if err != nil {
+		t.Fatalf("decodeWebauthnState fail %s", err)
+	}
+	if decoded.Challenge != state.Challenge {
+		t.Errorf("challenge mismatch")
+	}
+}
+
+func TestIsWebauthnRegisterAllowed(t *testing.T) {
+	options.Options = &options.GatewayOptions{EnableTotp: true}
+	creds := []modules.SWebauthnCredential{{Id: "cred1"}}
+
+	// totp disabled, bootstrap with password only
+	token := clientman.NewAuthToken("t", false, false, false)
+	if !isWebauthnRegisterAllowed(token, nil, false) {
+		t.Errorf("first authenticator should be allowed without totp")
+	}
+	if !isWebauthnRegisterAllowed(token, creds, false) {
+		t.Errorf("session without second factor should add authenticators")
+	}
+	token.SetWebauthnRequired()
+	if isWebauthnRegisterAllowed(token, creds, true) {
+		t.Errorf("webauthn required session should verify before adding authenticators")
+	}
+	if isWebauthnRegisterAllowed(token, nil, false) {
+		t.Errorf("first authenticator of webauthn required session needs totp or enrollment token")
+	}
+	if !isWebauthnRegisterAllowed(token, nil, true) {
+		t.Errorf("first authenticator should be allowed with an enrollment token")
+	}
+
+	// totp enabled and initialized
+	token = clientman.NewAuthToken("t", true, true, false)
+	if isWebauthnRegisterAllowed(token, nil, false) {
+		t.Errorf("totp should be verified before the first authenticator")
+	}
+	token.SetWebauthnVerified()
+	if !isWebauthnRegisterAllowed(token, creds, false) {
+		t.Errorf("webauthn verified session should add authenticators")
+	}
+}
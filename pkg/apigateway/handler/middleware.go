@@ -115,6 +115,14 @@ func fetchAndSetAuthContext(ctx context.Context, w http.ResponseWriter, r *http.
 	if err != nil {
 		return ctx, errors.Wrap(err, "fetchAuthInfo")
 	}
+	// the domain policy or the privileges of the token may change after login
+	required, err := refreshWebauthnPolicy(ctx, r, authToken, token)
+	if err != nil {
+		return ctx, errors.Wrap(err, "refreshWebauthnPolicy")
+	}
+	if required {
+		saveAuthCookie(w, authToken, token)
+	}
 	// 启用双因子认证
 	if !authToken.IsTotpVerified() {
 		return ctx, errors.Wrap(httperrors.ErrInvalidCredential, "TOTP authentication failed")
@@ -16,6 +16,7 @@ package handler
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
@@ -32,6 +33,7 @@ import (
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/pkg/utils"
 
 	"yunion.io/x/onecloud/pkg/apigateway/clientman"
 	"yunion.io/x/onecloud/pkg/apigateway/options"
@@ -73,18 +75,24 @@ func addQuery(urlstr string, qs jsonutils.JSONObject) string {
 	}
 }
 
+// redirectToLogin redirects to the login page, which redirects back to
+// the request url after successful login
+func redirectToLogin(w http.ResponseWriter, req *http.Request) {
+	qs := jsonutils.NewDict()
+	oUrl := req.URL.String()
+	if !strings.HasPrefix(oUrl, "http") {
+		oUrl = httputils.JoinPath(options.Options.ApiServer, oUrl)
+	}
+	qs.Set(getLoginCallbackParam(), jsonutils.NewString(oUrl))
+	loginUrl := addQuery(getSsoAuthCallbackUrl(), qs)
+	appsrv.SendRedirect(w, loginUrl)
+}
+
 func handleOIDCAuth(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	ctx, err := fetchAndSetAuthContext(ctx, w, req)
 	if err != nil {
 		// not login redirect to login page
-		qs := jsonutils.NewDict()
-		oUrl := req.URL.String()
-		if !strings.HasPrefix(oUrl, "http") {
-			oUrl = httputils.JoinPath(options.Options.ApiServer, oUrl)
-		}
-		qs.Set(getLoginCallbackParam(), jsonutils.NewString(oUrl))
-		loginUrl := addQuery(getSsoAuthCallbackUrl(), qs)
-		appsrv.SendRedirect(w, loginUrl)
+		redirectToLogin(w, req)
 		return
 	}
 	query, _ := jsonutils.ParseQueryString(req.URL.RawQuery)
@@ -106,17 +114,26 @@ func handleOIDCAuth(ctx context.Context, w http.ResponseWriter, req *http.Reques
 }
 
 func fetchOIDCCredential(ctx context.Context, req *http.Request, clientId string) (modules.SOpenIDConnectCredential, error) {
+	oidcSecret, _, err := fetchOIDCCredentialObject(ctx, req, clientId)
+	return oidcSecret, err
+}
+
+// fetchOIDCCredentialObject returns the client registration and the
+// credential, of which user_id and project_id are the owner of the client
+func fetchOIDCCredentialObject(ctx context.Context, req *http.Request, clientId string) (modules.SOpenIDConnectCredential, jsonutils.JSONObject, error) {
 	var oidcSecret modules.SOpenIDConnectCredential
 	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
 	secret, err := modules.Credentials.GetById(s, clientId, nil)
 	if err != nil {
-		return oidcSecret, errors.Wrap(err, "Request Credential")
+		return oidcSecret, nil, errors.Wrap(err, "Request Credential")
 	}
 	oidcSecret, err = modules.DecodeOIDCSecret(secret)
 	if err != nil {
-		return oidcSecret, errors.Wrap(err, "DecodeOIDCSecret")
+		return oidcSecret, nil, errors.Wrap(err, "DecodeOIDCSecret")
 	}
-	return oidcSecret, nil
+	// client_id is not saved in the blob
+	oidcSecret.ClientId, _ = secret.GetString("id")
+	return oidcSecret, secret, nil
 }
 
 func doOIDCAuth(ctx context.Context, req *http.Request, query jsonutils.JSONObject) (oidcutils.SOIDCAuthRequest, string, error) {
@@ -139,12 +156,34 @@ func doOIDCAuth(ctx context.Context, req *http.Request, query jsonutils.JSONObje
 	if oidcSecret.RedirectUri != oidcAuth.RedirectUri {
 		return oidcAuth, "", errors.Wrap(httperrors.ErrInvalidCredential, "redirect uri not match")
 	}
+	if !oidcSecret.IsGrantTypeAllowed(oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE) {
+		return oidcAuth, "", errors.Wrap(httperrors.ErrInvalidCredential, "authorization code grant is not allowed for the client")
+	}
+	if len(oidcAuth.CodeChallenge) > 0 {
+		if len(oidcAuth.CodeChallengeMethod) == 0 {
+			oidcAuth.CodeChallengeMethod = oidcutils.OIDC_CODE_CHALLENGE_METHOD_PLAIN
+		}
+		err := validateCodeChallengeMethod(oidcAuth.CodeChallengeMethod)
+		if err != nil {
+			return oidcAuth, "", errors.Wrap(httperrors.ErrInputParameter, err.Error())
+		}
+	} else if oidcSecret.PublicClient {
+		return oidcAuth, "", errors.Wrap(httperrors.ErrInputParameter, "code_challenge is required for public client")
+	}
 
 	token := AppContextToken(ctx)
 
 	cliIp := netutils2.GetHttpRequestIp(req)
-	codeInfo := newOIDCClientInfo(token, cliIp, FetchRegion(req))
-	code := clientman.EncryptString(codeInfo.toBytes())
+	authCode := SOIDCAuthCode{
+		Id:                  randomOIDCString(16),
+		Info:                newOIDCClientInfo(token, cliIp, FetchRegion(req)),
+		ClientId:            oidcAuth.ClientId,
+		RedirectUri:         oidcAuth.RedirectUri,
+		Scope:               oidcAuth.Scope,
+		CodeChallenge:       oidcAuth.CodeChallenge,
+		CodeChallengeMethod: oidcAuth.CodeChallengeMethod,
+	}
+	code := authCode.encode()
 
 	return oidcAuth, code, nil
 }
@@ -152,13 +191,35 @@ func doOIDCAuth(ctx context.Context, req *http.Request, query jsonutils.JSONObje
 func handleOIDCToken(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	resp, err := validateOIDCToken(ctx, req)
 	if err != nil {
-		httperrors.GeneralServerError(ctx, w, err)
+		sendOIDCError(ctx, w, err)
 		return
 	}
+	appsrv.DisableClientCache(w)
 	appsrv.SendJSON(w, jsonutils.Marshal(resp))
 	return
 }
 
+// sendOIDCError sends the errors of the token endpoint in the form of
+// RFC 6749 section 5.2
+func sendOIDCError(ctx context.Context, w http.ResponseWriter, err error) {
+	oidcErr, ok := errors.Cause(err).(*oidcutils.SOIDCError)
+	if !ok {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	log.Debugf("oidc token error: %s", err)
+	status := http.StatusBadRequest
+	if oidcErr.ErrorCode == oidcutils.OIDC_ERROR_INVALID_CLIENT {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oidc"`)
+	}
+	body := []byte(jsonutils.Marshal(oidcErr).String())
+	appsrv.DisableClientCache(w)
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
 type SOIDCClientInfo struct {
 	Timestamp int64
 	Ip        netutils.IPV4Addr
@@ -236,6 +297,9 @@ func decodeOIDCClientToken(token string) (SOIDCClientToken, error) {
 	if err != nil {
 		return ret, errors.Wrap(err, "json.Parse")
 	}
+	if json.Contains("type") {
+		return ret, errors.Wrap(httperrors.ErrInvalidCredential, "not an access token")
+	}
 	info, err := json.GetString("info")
 	if err != nil {
 		return ret, errors.Wrap(err, "getString(info)")
@@ -247,77 +311,249 @@ func decodeOIDCClientToken(token string) (SOIDCClientToken, error) {
 	return ret, nil
 }
 
-func validateOIDCToken(ctx context.Context, req *http.Request) (oidcutils.SOIDCAccessTokenResponse, error) {
-	var tokenResp oidcutils.SOIDCAccessTokenResponse
+func fetchOIDCTokenRequest(req *http.Request) (oidcutils.SOIDCAccessTokenRequest, error) {
+	authReq := oidcutils.SOIDCAccessTokenRequest{}
 	bodyBytes, err := appsrv.Fetch(req)
 	if err != nil {
-		return tokenResp, errors.Wrap(err, "Fetch Body")
+		return authReq, errors.Wrap(err, "Fetch Body")
 	}
-	log.Debugf("validateOIDCToken body: %s", string(bodyBytes))
 	bodyJson, err := jsonutils.ParseQueryString(string(bodyBytes))
 	if err != nil {
-		return tokenResp, errors.Wrap(err, "Decode body form data")
+		return authReq, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_REQUEST, "invalid form data")
 	}
-	authReq := oidcutils.SOIDCAccessTokenRequest{}
 	err = bodyJson.Unmarshal(&authReq)
 	if err != nil {
-		return tokenResp, errors.Wrap(err, "Unmarshal Access Token Request")
+		return authReq, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_REQUEST, "invalid form data")
+	}
+	return authReq, nil
+}
+
+// authenticateOIDCClient authenticates the client by client_secret_basic,
+// client_secret_post or, for public clients, client_id only
+func authenticateOIDCClient(ctx context.Context, req *http.Request, authReq oidcutils.SOIDCAccessTokenRequest, grantType string) (modules.SOpenIDConnectCredential, error) {
+	cred, _, err := authenticateOIDCClientObject(ctx, req, authReq, grantType)
+	return cred, err
+}
+
+func authenticateOIDCClientObject(ctx context.Context, req *http.Request, authReq oidcutils.SOIDCAccessTokenRequest, grantType string) (modules.SOpenIDConnectCredential, jsonutils.JSONObject, error) {
+	var cred modules.SOpenIDConnectCredential
+	clientId := authReq.ClientId
+	clientSecret := authReq.ClientSecret
+	authStr := req.Header.Get("Authorization")
+	if len(authStr) > 0 {
+		authParts := strings.Split(authStr, " ")
+		if len(authParts) != 2 || authParts[0] != "Basic" {
+			return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "unsupported authorization header, only Basic supported")
+		}
+		authBytes, err := base64.StdEncoding.DecodeString(authParts[1])
+		if err != nil {
+			return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "illegal authorization header")
+		}
+		authParts = strings.Split(string(authBytes), ":")
+		if len(authParts) != 2 {
+			return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "illegal authorization header")
+		}
+		clientId, _ = url.QueryUnescape(authParts[0])
+		clientSecret, _ = url.QueryUnescape(authParts[1])
+		if len(authReq.ClientId) > 0 && authReq.ClientId != clientId {
+			return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_REQUEST, "client_id not match")
+		}
+	}
+	if len(clientId) == 0 {
+		return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "missing client_id")
+	}
+	cred, secret, err := fetchOIDCCredentialObject(ctx, req, clientId)
+	if err != nil {
+		log.Errorf("fetchOIDCCredential %s fail %s", clientId, err)
+		return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "unknown client")
 	}
-	if authReq.GrantType != oidcutils.OIDC_REQUEST_GRANT_TYPE {
-		return tokenResp, errors.Wrapf(httperrors.ErrInvalidCredential, "invalid grant type %s", authReq.GrantType)
+	if !cred.IsValid() {
+		return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "client expired")
 	}
+	if !cred.PublicClient && (len(clientSecret) == 0 || subtle.ConstantTimeCompare([]byte(cred.Secret), []byte(clientSecret)) != 1) {
+		return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_CLIENT, "client secret not match")
+	}
+	if !cred.IsGrantTypeAllowed(grantType) {
+		return cred, nil, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_UNAUTHORIZED_CLIENT, fmt.Sprintf("grant type %s is not allowed for the client", grantType))
+	}
+	return cred, secret, nil
+}
+
+func validateOIDCToken(ctx context.Context, req *http.Request) (oidcutils.SOIDCAccessTokenResponse, error) {
+	var tokenResp oidcutils.SOIDCAccessTokenResponse
+	authReq, err := fetchOIDCTokenRequest(req)
+	if err != nil {
+		return tokenResp, err
+	}
+	switch authReq.GrantType {
+	case oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE:
+		return grantOIDCAuthorizationCode(ctx, req, authReq)
+	case oidcutils.OIDC_GRANT_TYPE_REFRESH_TOKEN:
+		return grantOIDCRefreshToken(ctx, req, authReq)
+	case oidcutils.OIDC_GRANT_TYPE_CLIENT_CREDENTIALS:
+		return grantOIDCClientCredentials(ctx, req, authReq)
+	case oidcutils.OIDC_GRANT_TYPE_DEVICE_CODE:
+		return grantOIDCDeviceCode(ctx, req, authReq)
+	}
+	return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_UNSUPPORTED_GRANT_TYPE, fmt.Sprintf("invalid grant type %s", authReq.GrantType))
+}
 
-	codeTimeBytes, err := clientman.DecryptString(authReq.Code)
+func grantOIDCAuthorizationCode(ctx context.Context, req *http.Request, authReq oidcutils.SOIDCAccessTokenRequest) (oidcutils.SOIDCAccessTokenResponse, error) {
+	var tokenResp oidcutils.SOIDCAccessTokenResponse
+	client, err := authenticateOIDCClient(ctx, req, authReq, oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE)
 	if err != nil {
-		return tokenResp, errors.Wrapf(httperrors.ErrInvalidCredential, "invalid code %s", authReq.Code)
+		return tokenResp, err
+	}
+	code, err := decodeOIDCAuthCode(authReq.Code)
+	if err != nil {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "invalid code")
+	}
+	if code.Info.isExpired() {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "code expires")
 	}
-	codeInfo, err := decodeOIDCClientInfo(codeTimeBytes)
+	if code.ClientId != client.ClientId {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "code was issued to another client")
+	}
+	if code.RedirectUri != authReq.RedirectUri || client.RedirectUri != authReq.RedirectUri {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "redirect uri not match")
+	}
+	if len(code.CodeChallenge) > 0 {
+		if !verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, authReq.CodeVerifier) {
+			return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "code_verifier not match")
+		}
+	} else if client.PublicClient {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "code_challenge is required for public client")
+	}
+	// code is single use
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	unused, err := oidcStore.MarkUsed(s, "code:"+code.Id, code.Info.expiresAt(OIDC_CODE_EXPIRE_SECONDS))
 	if err != nil {
-		return tokenResp, errors.Wrap(httperrors.ErrInvalidCredential, "fail to decode code")
+		return tokenResp, errors.Wrap(err, "MarkUsed")
 	}
-	if codeInfo.isExpired() {
-		return tokenResp, errors.Wrapf(httperrors.ErrInvalidCredential, "code expires")
+	if !unused {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "code has been used")
 	}
+	return issueOIDCTokens(code.Info, client, code.Scope, ""), nil
+}
 
-	authStr := req.Header.Get("Authorization")
-	log.Debugf("Authorization: %s", authStr)
-	authParts := strings.Split(string(authStr), " ")
-	if len(authParts) != 2 {
-		return tokenResp, errors.Wrap(httperrors.ErrInvalidCredential, "illegal authorization header")
+func grantOIDCRefreshToken(ctx context.Context, req *http.Request, authReq oidcutils.SOIDCAccessTokenRequest) (oidcutils.SOIDCAccessTokenResponse, error) {
+	var tokenResp oidcutils.SOIDCAccessTokenResponse
+	client, err := authenticateOIDCClient(ctx, req, authReq, oidcutils.OIDC_GRANT_TYPE_REFRESH_TOKEN)
+	if err != nil {
+		return tokenResp, err
+	}
+	refresh, err := decodeOIDCRefreshToken(authReq.RefreshToken)
+	if err != nil {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "invalid refresh token")
+	}
+	if refresh.isExpired() {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "refresh token expires")
+	}
+	if refresh.ClientId != client.ClientId {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "refresh token was issued to another client")
+	}
+	s := auth.GetAdminSession(ctx, refresh.Info.Region, "")
+	familyKey := "refresh_family:" + refresh.FamilyId
+	revoked, err := oidcStore.IsUsed(s, familyKey)
+	if err != nil {
+		return tokenResp, errors.Wrap(err, "IsUsed")
+	}
+	if revoked {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "refresh token revoked")
+	}
+	unused, err := oidcStore.MarkUsed(s, "refresh:"+refresh.Id, refresh.expiresAt())
+	if err != nil {
+		return tokenResp, errors.Wrap(err, "MarkUsed")
 	}
-	if authParts[0] != "Basic" {
-		return tokenResp, errors.Wrapf(httperrors.ErrInvalidCredential, "unsupport auth method %s, only Basic supported", authParts)
+	if !unused {
+		// a rotated token is replayed, revoke all tokens of the grant
+		log.Warningf("refresh token %s of client %s replayed, revoke family %s", refresh.Id, client.ClientId, refresh.FamilyId)
+		_, err := oidcStore.MarkUsed(s, familyKey, time.Now().Add(OIDC_REFRESH_TOKEN_EXPIRE_SECONDS*time.Second))
+		if err != nil {
+			log.Errorf("revoke refresh token family %s fail %s", refresh.FamilyId, err)
+		}
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "refresh token has been used")
+	}
+	usr, err := modules.UsersV3.GetById(s, refresh.Info.UserId, nil)
+	if err != nil {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "user not found")
+	}
+	if enabled, _ := usr.Bool("enabled"); !enabled {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "user disabled")
+	}
+	scope := refresh.Scope
+	if len(authReq.Scope) > 0 {
+		// the requested scope must not exceed the original grant
+		for _, sc := range strings.Fields(authReq.Scope) {
+			if !utils.IsInStringArray(sc, strings.Fields(refresh.Scope)) {
+				return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_SCOPE, fmt.Sprintf("scope %s is not granted", sc))
+			}
+		}
+		scope = authReq.Scope
 	}
-	authBytes, err := base64.StdEncoding.DecodeString(authParts[1])
+	info := refresh.Info
+	info.Timestamp = time.Now().UnixNano()
+	return issueOIDCTokens(info, client, scope, refresh.FamilyId), nil
+}
+
+func grantOIDCClientCredentials(ctx context.Context, req *http.Request, authReq oidcutils.SOIDCAccessTokenRequest) (oidcutils.SOIDCAccessTokenResponse, error) {
+	var tokenResp oidcutils.SOIDCAccessTokenResponse
+	client, secret, err := authenticateOIDCClientObject(ctx, req, authReq, oidcutils.OIDC_GRANT_TYPE_CLIENT_CREDENTIALS)
 	if err != nil {
-		return tokenResp, errors.Wrap(err, "Decode Authorization Header")
+		return tokenResp, err
 	}
-	log.Debugf("Authorization basic: %s", string(authBytes))
-	authParts = strings.Split(string(authBytes), ":")
-	if len(authParts) != 2 {
-		return tokenResp, errors.Wrap(httperrors.ErrInvalidCredential, "illegal authorization header")
+	if client.PublicClient {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_UNAUTHORIZED_CLIENT, "public client cannot use client_credentials grant")
 	}
-	clientId, _ := url.QueryUnescape(authParts[0])
-	clientSecret, _ := url.QueryUnescape(authParts[1])
-	log.Debugf("clientId %s clientSecret: %s authReq.ClientId %s", clientId, clientSecret, authReq.ClientId)
+	// the client acts on behalf of the owner of the credential
+	info := SOIDCClientInfo{
+		Timestamp: time.Now().UnixNano(),
+		Region:    FetchRegion(req),
+	}
+	info.Ip, _ = netutils.NewIPV4Addr(netutils2.GetHttpRequestIp(req))
+	info.UserId, _ = secret.GetString("user_id")
+	info.ProjectId, _ = secret.GetString("project_id")
+	if len(info.UserId) == 0 {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_UNAUTHORIZED_CLIENT, "client has no owner user")
+	}
+	// no refresh token and id token as no end-user is involved (RFC 6749 section 4.4.3)
+	resp := oidcutils.SOIDCAccessTokenResponse{}
+	resp.AccessToken = SOIDCClientToken{Info: info}.encode()
+	resp.TokenType = oidcutils.OIDC_BEARER_TOKEN_TYPE
+	resp.ExpiresIn = OIDC_TOKEN_EXPIRE_SECONDS
+	resp.Scope = authReq.Scope
+	return resp, nil
+}
 
-	oidcSecret, err := fetchOIDCCredential(ctx, req, clientId)
+func grantOIDCDeviceCode(ctx context.Context, req *http.Request, authReq oidcutils.SOIDCAccessTokenRequest) (oidcutils.SOIDCAccessTokenResponse, error) {
+	var tokenResp oidcutils.SOIDCAccessTokenResponse
+	client, err := authenticateOIDCClient(ctx, req, authReq, oidcutils.OIDC_GRANT_TYPE_DEVICE_CODE)
 	if err != nil {
-		return tokenResp, errors.Wrap(err, "fetchOIDCCredential")
+		return tokenResp, err
 	}
-	if oidcSecret.RedirectUri != authReq.RedirectUri {
-		return tokenResp, errors.Wrap(httperrors.ErrInvalidCredential, "redirect uri not match")
+	if len(authReq.DeviceCode) == 0 {
+		return tokenResp, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_REQUEST, "missing device_code")
 	}
-	if oidcSecret.Secret != clientSecret {
-		return tokenResp, errors.Wrap(httperrors.ErrInvalidCredential, "client secret not match")
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	dev, info, err := oidcDevices.poll(s, authReq.DeviceCode, client.ClientId)
+	if err != nil {
+		return tokenResp, err
 	}
+	return issueOIDCTokens(info, client, dev.Scope, ""), nil
+}
 
+// issueOIDCTokens issues the access token, the id token and, if allowed
+// for the client, the refresh token of the family
+func issueOIDCTokens(info SOIDCClientInfo, client modules.SOpenIDConnectCredential, scope string, familyId string) oidcutils.SOIDCAccessTokenResponse {
 	token := SOIDCClientToken{
-		Info: codeInfo,
+		Info: info,
 	}
-
-	tokenResp = token2AccessTokenResponse(token, clientId)
-	return tokenResp, nil
+	resp := token2AccessTokenResponse(token, client.ClientId)
+	resp.Scope = scope
+	if client.IsGrantTypeAllowed(oidcutils.OIDC_GRANT_TYPE_REFRESH_TOKEN) {
+		resp.RefreshToken = newOIDCRefreshToken(info, client.ClientId, scope, familyId).encode()
+	}
+	return resp
 }
 
 func token2AccessTokenResponse(token SOIDCClientToken, clientId string) oidcutils.SOIDCAccessTokenResponse {
@@ -345,6 +581,7 @@ func handleOIDCConfiguration(ctx context.Context, w http.ResponseWriter, req *ht
 	userinfoUrl := httputils.JoinPath(options.Options.ApiServer, "api/v1/auth/oidc/user")
 	logoutUrl := httputils.JoinPath(options.Options.ApiServer, "api/v1/auth/oidc/logout")
 	jwksUrl := httputils.JoinPath(options.Options.ApiServer, "api/v1/auth/oidc/keys")
+	deviceUrl := httputils.JoinPath(options.Options.ApiServer, "api/v1/auth/oidc/device/authorize")
 	conf := oidcutils.SOIDCConfiguration{
 		Issuer:                httputils.JoinPath(options.Options.ApiServer, "api/v1/auth/oidc"),
 		AuthorizationEndpoint: authUrl,
@@ -352,6 +589,8 @@ func handleOIDCConfiguration(ctx context.Context, w http.ResponseWriter, req *ht
 		UserinfoEndpoint:      userinfoUrl,
 		EndSessionEndpoint:    logoutUrl,
 		JwksUri:               jwksUrl,
+
+		DeviceAuthorizationEndpoint: deviceUrl,
 		ResponseTypesSupported: []string{
 			oidcutils.OIDC_RESPONSE_TYPE_CODE,
 		},
@@ -367,6 +606,18 @@ func handleOIDCConfiguration(ctx context.Context, w http.ResponseWriter, req *ht
 		},
 		TokenEndpointAuthMethodsSupported: []string{
 			"client_secret_basic",
+			"client_secret_post",
+			"none",
+		},
+		GrantTypesSupported: []string{
+			oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE,
+			oidcutils.OIDC_GRANT_TYPE_REFRESH_TOKEN,
+			oidcutils.OIDC_GRANT_TYPE_CLIENT_CREDENTIALS,
+			oidcutils.OIDC_GRANT_TYPE_DEVICE_CODE,
+		},
+		CodeChallengeMethodsSupported: []string{
+			oidcutils.OIDC_CODE_CHALLENGE_METHOD_S256,
+			oidcutils.OIDC_CODE_CHALLENGE_METHOD_PLAIN,
 		},
 		ClaimsSupported: []string{
 			jwt.IssuerKey,
@@ -0,0 +1,441 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apigateway/clientman"
+	"yunion.io/x/onecloud/pkg/apigateway/options"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+	"yunion.io/x/onecloud/pkg/util/netutils2"
+	"yunion.io/x/onecloud/pkg/util/oidcutils"
+)
+
+const (
+	// OIDC device code expires in 10 minutes
+	OIDC_DEVICE_CODE_EXPIRE_SECONDS = 600
+	// minimal interval of polling the token endpoint
+	OIDC_DEVICE_POLL_INTERVAL_SECONDS = 5
+
+	// user code alphabet without vowels and ambiguous characters (RFC 8628 section 6.1)
+	oidcUserCodeChars = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+type sOIDCDeviceAuth struct {
+	DeviceId string `json:"device_id"`
+	UserCode string `json:"user_code"`
+	ClientId string `json:"client_id"`
+	Scope    string `json:"scope"`
+	Expire   int64  `json:"expire"`
+	// polling interval in seconds
+	Interval int64 `json:"interval"`
+	// unix time in milliseconds of the last poll
+	LastPoll int64 `json:"last_poll"`
+}
+
+func (dev sOIDCDeviceAuth) isExpired() bool {
+	return dev.Expire <= time.Now().Unix()
+}
+
+// sOIDCDeviceGrant is the decision of the user on a device authorization
+type sOIDCDeviceGrant struct {
+	Approved bool
+	Info     SOIDCClientInfo
+}
+
+// sOIDCDeviceStore keeps the pending device authorizations and the
+// decisions of the users in the state store shared by all apigateway
+// instances. The device code and the confirmation nonce are encrypted
+// tokens, so that no more state is needed to verify them.
+type sOIDCDeviceStore struct {
+	store IOIDCStateStore
+}
+
+var oidcDevices = newOIDCDeviceStore(oidcStore)
+
+func newOIDCDeviceStore(store IOIDCStateStore) *sOIDCDeviceStore {
+	return &sOIDCDeviceStore{store: store}
+}
+
+func newOIDCUserCode() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	code := make([]byte, 8)
+	for i := range b {
+		code[i] = oidcUserCodeChars[int(b[i])%len(oidcUserCodeChars)]
+	}
+	return fmt.Sprintf("%s-%s", code[:4], code[4:])
+}
+
+// normalizeUserCode accepts user codes typed in lower case or without dash
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func oidcDeviceRecord(userCode string) string {
+	return "device:" + userCode
+}
+
+func oidcDeviceGrantRecord(userCode string) string {
+	return "device_grant:" + userCode
+}
+
+func hashOIDCSession(session string) string {
+	sum := sha256.Sum256([]byte(session))
+	return hex.EncodeToString(sum[:])
+}
+
+func encodeOIDCDeviceToken(tokenType string, fields map[string]string) string {
+	json := jsonutils.NewDict()
+	for k, v := range fields {
+		json.Add(jsonutils.NewString(v), k)
+	}
+	json.Add(jsonutils.NewString(tokenType), "type")
+	return clientman.EncryptString([]byte(json.String()))
+}
+
+func decodeOIDCDeviceToken(tokenType string, token string) (jsonutils.JSONObject, error) {
+	json, err := decryptOIDCJson(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "decryptOIDCJson")
+	}
+	if typeStr, _ := json.GetString("type"); typeStr != tokenType {
+		return nil, errors.Wrapf(httperrors.ErrInvalidFormat, "not a %s", tokenType)
+	}
+	return json, nil
+}
+
+// create saves a pending authorization and returns it with the device code
+func (s *sOIDCDeviceStore) create(session *mcclient.ClientSession, clientId, scope string) (sOIDCDeviceAuth, string, error) {
+	dev := sOIDCDeviceAuth{
+		DeviceId: randomOIDCString(32),
+		ClientId: clientId,
+		Scope:    scope,
+		Expire:   time.Now().Add(OIDC_DEVICE_CODE_EXPIRE_SECONDS * time.Second).Unix(),
+		Interval: OIDC_DEVICE_POLL_INTERVAL_SECONDS,
+	}
+	for i := 0; ; i++ {
+		if i >= 5 {
+			return dev, "", errors.Wrap(httperrors.ErrConflict, "no available user code")
+		}
+		dev.UserCode = newOIDCUserCode()
+		created, err := s.store.Create(session, oidcDeviceRecord(dev.UserCode), jsonutils.Marshal(&dev))
+		if err != nil {
+			return dev, "", errors.Wrap(err, "Create")
+		}
+		if created {
+			break
+		}
+	}
+	deviceCode := encodeOIDCDeviceToken("device_code", map[string]string{
+		"user_code": dev.UserCode,
+		"device_id": dev.DeviceId,
+	})
+	return dev, deviceCode, nil
+}
+
+func (s *sOIDCDeviceStore) get(session *mcclient.ClientSession, userCode string) (*sOIDCDeviceAuth, error) {
+	blob, err := s.store.Get(session, oidcDeviceRecord(userCode))
+	if err != nil {
+		return nil, errors.Wrap(err, "Get")
+	}
+	dev := &sOIDCDeviceAuth{}
+	err = blob.Unmarshal(dev)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+	return dev, nil
+}
+
+func (s *sOIDCDeviceStore) getGrant(session *mcclient.ClientSession, userCode string) (*sOIDCDeviceGrant, error) {
+	blob, err := s.store.Get(session, oidcDeviceGrantRecord(userCode))
+	if err != nil {
+		return nil, errors.Wrap(err, "Get")
+	}
+	grantStr, _ := blob.GetString("grant")
+	json, err := decodeOIDCDeviceToken("device_grant", grantStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeOIDCDeviceToken")
+	}
+	grant := &sOIDCDeviceGrant{}
+	approved, _ := json.GetString("approved")
+	grant.Approved = approved == "true"
+	info, _ := json.GetString("info")
+	grant.Info, err = decodeOIDCClientInfo([]byte(info))
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeOIDCClientInfo")
+	}
+	return grant, nil
+}
+
+func (s *sOIDCDeviceStore) remove(session *mcclient.ClientSession, userCode string) {
+	s.store.Delete(session, oidcDeviceGrantRecord(userCode))
+	s.store.Delete(session, oidcDeviceRecord(userCode))
+}
+
+// prepareConfirm returns the pending authorization of the user code with a
+// confirmation nonce bound to the login session of the user
+func (s *sOIDCDeviceStore) prepareConfirm(session *mcclient.ClientSession, userCode string, loginSession string) (sOIDCDeviceAuth, string, bool) {
+	userCode = normalizeUserCode(userCode)
+	dev, err := s.get(session, userCode)
+	if err != nil || dev.isExpired() {
+		return sOIDCDeviceAuth{}, "", false
+	}
+	if _, err := s.getGrant(session, userCode); err == nil {
+		// decided already
+		return sOIDCDeviceAuth{}, "", false
+	}
+	nonce := encodeOIDCDeviceToken("device_nonce", map[string]string{
+		"user_code": userCode,
+		"device_id": dev.DeviceId,
+		"session":   hashOIDCSession(loginSession),
+	})
+	return *dev, nonce, true
+}
+
+// confirm approves or denies the pending authorization of the user code,
+// the nonce must be issued to the same login session and the decision can
+// only be made once
+func (s *sOIDCDeviceStore) confirm(session *mcclient.ClientSession, userCode, nonce string, loginSession string, approve bool, info SOIDCClientInfo) bool {
+	userCode = normalizeUserCode(userCode)
+	json, err := decodeOIDCDeviceToken("device_nonce", nonce)
+	if err != nil {
+		return false
+	}
+	nonceCode, _ := json.GetString("user_code")
+	deviceId, _ := json.GetString("device_id")
+	sessionHash, _ := json.GetString("session")
+	if nonceCode != userCode || subtle.ConstantTimeCompare([]byte(sessionHash), []byte(hashOIDCSession(loginSession))) != 1 {
+		return false
+	}
+	dev, err := s.get(session, userCode)
+	if err != nil || dev.isExpired() || dev.DeviceId != deviceId {
+		return false
+	}
+	blob := jsonutils.NewDict()
+	blob.Add(jsonutils.NewString(encodeOIDCDeviceToken("device_grant", map[string]string{
+		"approved": fmt.Sprintf("%v", approve),
+		"info":     string(info.toBytes()),
+	})), "grant")
+	blob.Add(jsonutils.NewInt(dev.Expire), "expire")
+	created, err := s.store.Create(session, oidcDeviceGrantRecord(userCode), blob)
+	if err != nil {
+		log.Errorf("save decision of device authorization %s fail %s", userCode, err)
+		return false
+	}
+	return created
+}
+
+// poll returns the approved authorization of the device code, or the error
+// the client should receive, the authorization is consumed once returned
+func (s *sOIDCDeviceStore) poll(session *mcclient.ClientSession, deviceCode, clientId string) (sOIDCDeviceAuth, SOIDCClientInfo, error) {
+	invalidErr := oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_GRANT, "invalid device_code")
+	json, err := decodeOIDCDeviceToken("device_code", deviceCode)
+	if err != nil {
+		return sOIDCDeviceAuth{}, SOIDCClientInfo{}, invalidErr
+	}
+	userCode, _ := json.GetString("user_code")
+	deviceId, _ := json.GetString("device_id")
+	dev, err := s.get(session, userCode)
+	if err != nil {
+		if errors.Cause(err) == httperrors.ErrNotFound {
+			return sOIDCDeviceAuth{}, SOIDCClientInfo{}, invalidErr
+		}
+		return sOIDCDeviceAuth{}, SOIDCClientInfo{}, errors.Wrap(err, "get")
+	}
+	if dev.DeviceId != deviceId || dev.ClientId != clientId {
+		return sOIDCDeviceAuth{}, SOIDCClientInfo{}, invalidErr
+	}
+	if dev.isExpired() {
+		s.remove(session, userCode)
+		return sOIDCDeviceAuth{}, SOIDCClientInfo{}, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_EXPIRED_TOKEN, "device_code expired")
+	}
+	grant, err := s.getGrant(session, userCode)
+	if err == nil {
+		if !grant.Approved {
+			s.remove(session, userCode)
+			return sOIDCDeviceAuth{}, SOIDCClientInfo{}, oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_ACCESS_DENIED, "authorization denied by user")
+		}
+		unused, err := s.store.MarkUsed(session, "device:"+dev.DeviceId, time.Unix(dev.Expire, 0))
+		if err != nil {
+			return sOIDCDeviceAuth{}, SOIDCClientInfo{}, errors.Wrap(err, "MarkUsed")
+		}
+		if !unused {
+			return sOIDCDeviceAuth{}, SOIDCClientInfo{}, invalidErr
+		}
+		s.remove(session, userCode)
+		return *dev, grant.Info, nil
+	} else if errors.Cause(err) != httperrors.ErrNotFound {
+		return sOIDCDeviceAuth{}, SOIDCClientInfo{}, errors.Wrap(err, "getGrant")
+	}
+	now := time.Now()
+	pollErr := oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_AUTHORIZATION_PENDING, "")
+	if now.Sub(time.Unix(0, dev.LastPoll*int64(time.Millisecond))) < time.Duration(dev.Interval)*time.Second {
+		// RFC 8628 section 3.5, the interval is increased by 5 seconds
+		dev.Interval += 5
+		pollErr = oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_SLOW_DOWN, "")
+	}
+	dev.LastPoll = now.UnixNano() / int64(time.Millisecond)
+	err = s.store.Update(session, oidcDeviceRecord(userCode), jsonutils.Marshal(dev))
+	if err != nil {
+		log.Errorf("update device authorization %s fail %s", userCode, err)
+	}
+	return sOIDCDeviceAuth{}, SOIDCClientInfo{}, pollErr
+}
+
+func getOIDCDeviceVerificationUrl() string {
+	return httputils.JoinPath(options.Options.ApiServer, "api/v1/auth/oidc/device")
+}
+
+// handleOIDCDeviceAuthorize is the device authorization endpoint
+func handleOIDCDeviceAuthorize(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	resp, err := doOIDCDeviceAuthorize(ctx, req)
+	if err != nil {
+		sendOIDCError(ctx, w, err)
+		return
+	}
+	appsrv.DisableClientCache(w)
+	appsrv.SendJSON(w, jsonutils.Marshal(resp))
+}
+
+func doOIDCDeviceAuthorize(ctx context.Context, req *http.Request) (oidcutils.SOIDCDeviceAuthorizationResponse, error) {
+	var resp oidcutils.SOIDCDeviceAuthorizationResponse
+	authReq, err := fetchOIDCTokenRequest(req)
+	if err != nil {
+		return resp, err
+	}
+	client, err := authenticateOIDCClient(ctx, req, authReq, oidcutils.OIDC_GRANT_TYPE_DEVICE_CODE)
+	if err != nil {
+		return resp, err
+	}
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	dev, deviceCode, err := oidcDevices.create(s, client.ClientId, authReq.Scope)
+	if err != nil {
+		return resp, errors.Wrap(err, "create device authorization")
+	}
+	verifyUrl := getOIDCDeviceVerificationUrl()
+	resp.DeviceCode = deviceCode
+	resp.UserCode = dev.UserCode
+	resp.VerificationUri = verifyUrl
+	resp.VerificationUriComplete = addQuery(verifyUrl, jsonutils.Marshal(map[string]string{"user_code": dev.UserCode}))
+	resp.ExpiresIn = OIDC_DEVICE_CODE_EXPIRE_SECONDS
+	resp.Interval = OIDC_DEVICE_POLL_INTERVAL_SECONDS
+	return resp, nil
+}
+
+const oidcDevicePageTemplate = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Device Login</title></head>
+<body style="font-family: sans-serif; margin: 4em auto; max-width: 32em;">
+<h2>Device Login</h2>
+%s
+</body></html>`
+
+func sendOIDCDevicePage(w http.ResponseWriter, body string) {
+	appsrv.DisableClientCache(w)
+	appsrv.SendHTML(w, fmt.Sprintf(oidcDevicePageTemplate, body))
+}
+
+// handleOIDCDeviceVerify shows the page where the logged in user enters
+// the user code displayed on the device and confirms the authorization
+func handleOIDCDeviceVerify(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	ctx, err := fetchAndSetAuthContext(ctx, w, req)
+	if err != nil {
+		redirectToLogin(w, req)
+		return
+	}
+	query, _ := jsonutils.ParseQueryString(req.URL.RawQuery)
+	userCode := ""
+	if query != nil {
+		userCode, _ = query.GetString("user_code")
+	}
+	if len(userCode) == 0 {
+		sendOIDCDevicePage(w, `<form method="GET">
+<p>Enter the code displayed on your device:</p>
+<p><input name="user_code" autofocus autocomplete="off"> <button type="submit">Continue</button></p>
+</form>`)
+		return
+	}
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	dev, nonce, ok := oidcDevices.prepareConfirm(s, userCode, AppContextToken(ctx).GetTokenString())
+	if !ok {
+		sendOIDCDevicePage(w, `<p>The code is invalid or expired, please restart the login on your device.</p>`)
+		return
+	}
+	sendOIDCDevicePage(w, fmt.Sprintf(`<form method="POST">
+<p>Client <b>%s</b> requests access to your account with code <b>%s</b>.</p>
+<p>Only continue if the code matches the one displayed on your device.</p>
+<input type="hidden" name="user_code" value="%s">
+<input type="hidden" name="nonce" value="%s">
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>`, html.EscapeString(dev.ClientId), html.EscapeString(dev.UserCode), html.EscapeString(dev.UserCode), html.EscapeString(nonce)))
+}
+
+func handleOIDCDeviceConfirm(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	ctx, err := fetchAndSetAuthContext(ctx, w, req)
+	if err != nil {
+		httperrors.InvalidCredentialError(ctx, w, "not login: %v", err)
+		return
+	}
+	body, err := appsrv.Fetch(req)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	form, err := jsonutils.ParseQueryString(string(body))
+	if err != nil {
+		httperrors.InputParameterError(ctx, w, "invalid form data")
+		return
+	}
+	userCode, _ := form.GetString("user_code")
+	nonce, _ := form.GetString("nonce")
+	action, _ := form.GetString("action")
+	approve := action == "approve"
+	info := newOIDCClientInfo(AppContextToken(ctx), netutils2.GetHttpRequestIp(req), FetchRegion(req))
+	s := auth.GetAdminSession(ctx, FetchRegion(req), "")
+	if !oidcDevices.confirm(s, userCode, nonce, AppContextToken(ctx).GetTokenString(), approve, info) {
+		sendOIDCDevicePage(w, `<p>The code is invalid or expired, please restart the login on your device.</p>`)
+		return
+	}
+	log.Infof("device authorization %s %s by user %s", userCode, action, info.UserId)
+	if approve {
+		sendOIDCDevicePage(w, `<p>The device is logged in, you can close this window now.</p>`)
+	} else {
+		sendOIDCDevicePage(w, `<p>The login of the device is denied.</p>`)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+)
+
+// IOIDCStateStore keeps the state of the OIDC provider shared by all
+// apigateway instances, i.e. the used single-use tokens and the records of
+// the pending device authorizations
+type IOIDCStateStore interface {
+	// MarkUsed records the key and returns false if it has been used
+	MarkUsed(s *mcclient.ClientSession, key string, expire time.Time) (bool, error)
+	IsUsed(s *mcclient.ClientSession, key string) (bool, error)
+
+	// Create saves the record and returns false if the name exists
+	Create(s *mcclient.ClientSession, name string, blob jsonutils.JSONObject) (bool, error)
+	// Get returns httperrors.ErrNotFound if the record does not exist
+	Get(s *mcclient.ClientSession, name string) (jsonutils.JSONObject, error)
+	Update(s *mcclient.ClientSession, name string, blob jsonutils.JSONObject) error
+	Delete(s *mcclient.ClientSession, name string) error
+}
+
+var oidcStore IOIDCStateStore = &sKeystoneOIDCStore{}
+
+// sKeystoneOIDCStore saves the state as keystone credentials of the
+// service account
+type sKeystoneOIDCStore struct{}
+
+func (store *sKeystoneOIDCStore) MarkUsed(s *mcclient.ClientSession, key string, expire time.Time) (bool, error) {
+	return modules.Credentials.MarkTokenUsed(s, "oidc:"+key, expire)
+}
+
+func (store *sKeystoneOIDCStore) IsUsed(s *mcclient.ClientSession, key string) (bool, error) {
+	return modules.Credentials.IsTokenUsed(s, "oidc:"+key)
+}
+
+func oidcStoreRecordName(name string) string {
+	return fmt.Sprintf("%s-%s", modules.OIDC_DEVICE_TYPE, name)
+}
+
+func (store *sKeystoneOIDCStore) Create(s *mcclient.ClientSession, name string, blob jsonutils.JSONObject) (bool, error) {
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(modules.DEFAULT_PROJECT), "project_id")
+	params.Add(jsonutils.NewString(modules.OIDC_DEVICE_TYPE), "type")
+	params.Add(jsonutils.NewString(oidcStoreRecordName(name)), "name")
+	params.Add(jsonutils.NewString(blob.String()), "blob")
+	_, err := modules.Credentials.Create(s, params)
+	if err != nil {
+		if httputils.ErrorCode(err) == http.StatusConflict {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "Create")
+	}
+	return true, nil
+}
+
+func (store *sKeystoneOIDCStore) fetch(s *mcclient.ClientSession, name string) (string, jsonutils.JSONObject, error) {
+	query := jsonutils.NewDict()
+	query.Add(jsonutils.NewString(modules.OIDC_DEVICE_TYPE), "type")
+	query.Add(jsonutils.NewString(oidcStoreRecordName(name)), "name")
+	query.Add(jsonutils.NewString("system"), "scope")
+	query.Add(jsonutils.JSONTrue, "details")
+	results, err := modules.Credentials.List(s, query)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "List")
+	}
+	if len(results.Data) == 0 {
+		return "", nil, errors.Wrapf(httperrors.ErrNotFound, "oidc record %s", name)
+	}
+	id, _ := results.Data[0].GetString("id")
+	blobStr, _ := results.Data[0].GetString("blob")
+	blob, err := jsonutils.ParseString(blobStr)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "ParseString")
+	}
+	return id, blob, nil
+}
+
+func (store *sKeystoneOIDCStore) Get(s *mcclient.ClientSession, name string) (jsonutils.JSONObject, error) {
+	_, blob, err := store.fetch(s, name)
+	return blob, err
+}
+
+func (store *sKeystoneOIDCStore) Update(s *mcclient.ClientSession, name string, blob jsonutils.JSONObject) error {
+	id, _, err := store.fetch(s, name)
+	if err != nil {
+		return err
+	}
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(blob.String()), "blob")
+	_, err = modules.Credentials.Update(s, id, params)
+	if err != nil {
+		return errors.Wrap(err, "Update")
+	}
+	return nil
+}
+
+func (store *sKeystoneOIDCStore) Delete(s *mcclient.ClientSession, name string) error {
+	id, _, err := store.fetch(s, name)
+	if err != nil {
+		if errors.Cause(err) == httperrors.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	_, err = modules.Credentials.Delete(s, id, nil)
+	if err != nil {
+		return errors.Wrap(err, "Delete")
+	}
+	return nil
+}
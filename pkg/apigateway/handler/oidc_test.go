@@ -16,12 +16,18 @@ package handler
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/netutils"
 
 	"yunion.io/x/onecloud/pkg/apigateway/clientman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/oidcutils"
 )
 
 func TestClientInfo(t *testing.T) {
@@ -91,3 +97,214 @@ func TestClientInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636 Appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	cases := []struct {
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidcutils.OIDC_CODE_CHALLENGE_METHOD_S256, verifier, true},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidcutils.OIDC_CODE_CHALLENGE_METHOD_S256, verifier + "x", false},
+		{verifier, oidcutils.OIDC_CODE_CHALLENGE_METHOD_PLAIN, verifier, true},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidcutils.OIDC_CODE_CHALLENGE_METHOD_PLAIN, verifier, false},
+		// verifier too short
+		{"short", oidcutils.OIDC_CODE_CHALLENGE_METHOD_PLAIN, "short", false},
+	}
+	for _, c := range cases {
+		if got := verifyCodeChallenge(c.challenge, c.method, c.verifier); got != c.want {
+			t.Errorf("verifyCodeChallenge(%s, %s, %s) = %v, want %v", c.challenge, c.method, c.verifier, got, c.want)
+		}
+	}
+}
+
+func TestOIDCCodeAndRefreshToken(t *testing.T) {
+	clientman.SetupTest()
+
+	info := SOIDCClientInfo{
+		Timestamp: time.Now().UnixNano(),
+		UserId:    "sysadmin",
+		ProjectId: "system",
+		Region:    "region0",
+	}
+	code := SOIDCAuthCode{
+		Id:                  randomOIDCString(16),
+		Info:                info,
+		ClientId:            "client",
+		RedirectUri:         "https://app/cb",
+		Scope:               "openid profile",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: oidcutils.OIDC_CODE_CHALLENGE_METHOD_S256,
+	}
+	codeStr := code.encode()
+	code2, err := decodeOIDCAuthCode(codeStr)
+	if err != nil {
+		t.Fatalf("decodeOIDCAuthCode fail %s", err)
+	}
+	if !reflect.DeepEqual(code, code2) {
+		t.Fatalf("code %#v not equal to %#v", code2, code)
+	}
+
+	refresh := newOIDCRefreshToken(info, "client", "openid", "")
+	refreshStr := refresh.encode()
+	refresh2, err := decodeOIDCRefreshToken(refreshStr)
+	if err != nil {
+		t.Fatalf("decodeOIDCRefreshToken fail %s", err)
+	}
+	if !reflect.DeepEqual(refresh, refresh2) {
+		t.Fatalf("refresh token %#v not equal to %#v", refresh2, refresh)
+	}
+	if refresh2.isExpired() {
+		t.Fatalf("refresh token expired")
+	}
+
+	// codes and refresh tokens are not accepted in place of each other or
+	// as access tokens
+	if _, err := decodeOIDCClientToken(codeStr); err == nil {
+		t.Errorf("code accepted as access token")
+	}
+	if _, err := decodeOIDCClientToken(refreshStr); err == nil {
+		t.Errorf("refresh token accepted as access token")
+	}
+	if _, err := decodeOIDCRefreshToken(codeStr); err == nil {
+		t.Errorf("code accepted as refresh token")
+	}
+	if _, err := decodeOIDCAuthCode(refreshStr); err == nil {
+		t.Errorf("refresh token accepted as code")
+	}
+}
+
+// sMemoryOIDCStore is the state store of a single instance for testing
+type sMemoryOIDCStore struct {
+	used    map[string]time.Time
+	records map[string]jsonutils.JSONObject
+}
+
+func newMemoryOIDCStore() *sMemoryOIDCStore {
+	return &sMemoryOIDCStore{
+		used:    map[string]time.Time{},
+		records: map[string]jsonutils.JSONObject{},
+	}
+}
+
+func (store *sMemoryOIDCStore) MarkUsed(s *mcclient.ClientSession, key string, expire time.Time) (bool, error) {
+	if _, ok := store.used[key]; ok {
+		return false, nil
+	}
+	store.used[key] = expire
+	return true, nil
+}
+
+func (store *sMemoryOIDCStore) IsUsed(s *mcclient.ClientSession, key string) (bool, error) {
+	_, ok := store.used[key]
+	return ok, nil
+}
+
+func (store *sMemoryOIDCStore) Create(s *mcclient.ClientSession, name string, blob jsonutils.JSONObject) (bool, error) {
+	if _, ok := store.records[name]; ok {
+		return false, nil
+	}
+	store.records[name] = blob
+	return true, nil
+}
+
+func (store *sMemoryOIDCStore) Get(s *mcclient.ClientSession, name string) (jsonutils.JSONObject, error) {
+	blob, ok := store.records[name]
+	if !ok {
+		return nil, httperrors.ErrNotFound
+	}
+	return blob, nil
+}
+
+func (store *sMemoryOIDCStore) Update(s *mcclient.ClientSession, name string, blob jsonutils.JSONObject) error {
+	if _, ok := store.records[name]; !ok {
+		return httperrors.ErrNotFound
+	}
+	store.records[name] = blob
+	return nil
+}
+
+func (store *sMemoryOIDCStore) Delete(s *mcclient.ClientSession, name string) error {
+	delete(store.records, name)
+	return nil
+}
+
+func oidcErrorCode(err error) string {
+	if oidcErr, ok := errors.Cause(err).(*oidcutils.SOIDCError); ok {
+		return oidcErr.ErrorCode
+	}
+	return ""
+}
+
+func TestOIDCDeviceStore(t *testing.T) {
+	clientman.SetupTest()
+
+	store := newOIDCDeviceStore(newMemoryOIDCStore())
+	dev, deviceCode, err := store.create(nil, "client", "openid")
+	if err != nil {
+		t.Fatalf("create fail %s", err)
+	}
+	if len(dev.UserCode) != 9 || normalizeUserCode(dev.UserCode) != dev.UserCode {
+		t.Fatalf("invalid user code %s", dev.UserCode)
+	}
+
+	_, _, err = store.poll(nil, deviceCode, "other")
+	if code := oidcErrorCode(err); code != oidcutils.OIDC_ERROR_INVALID_GRANT {
+		t.Fatalf("poll by other client got %s", code)
+	}
+	_, _, err = store.poll(nil, deviceCode, "client")
+	if code := oidcErrorCode(err); code != oidcutils.OIDC_ERROR_AUTHORIZATION_PENDING {
+		t.Fatalf("first poll got %s", code)
+	}
+	_, _, err = store.poll(nil, deviceCode, "client")
+	if code := oidcErrorCode(err); code != oidcutils.OIDC_ERROR_SLOW_DOWN {
+		t.Fatalf("fast poll got %s", code)
+	}
+
+	info := SOIDCClientInfo{Timestamp: time.Now().UnixNano(), UserId: "sysadmin"}
+	// the user code is accepted in lower case without dash
+	userCode := strings.ToLower(strings.Replace(dev.UserCode, "-", "", 1))
+	_, nonce, ok := store.prepareConfirm(nil, userCode, "session1")
+	if !ok {
+		t.Fatalf("prepareConfirm fail")
+	}
+	if store.confirm(nil, userCode, "wrong", "session1", true, info) {
+		t.Fatalf("confirm with wrong nonce accepted")
+	}
+	if store.confirm(nil, userCode, nonce, "session2", true, info) {
+		t.Fatalf("confirm from another session accepted")
+	}
+	if !store.confirm(nil, userCode, nonce, "session1", true, info) {
+		t.Fatalf("confirm fail")
+	}
+	if store.confirm(nil, userCode, nonce, "session1", false, info) {
+		t.Fatalf("confirm twice accepted")
+	}
+	if _, _, ok := store.prepareConfirm(nil, userCode, "session1"); ok {
+		t.Fatalf("prepareConfirm after decision accepted")
+	}
+
+	approved, approvedInfo, err := store.poll(nil, deviceCode, "client")
+	if err != nil {
+		t.Fatalf("poll after approval fail %s", err)
+	}
+	if approvedInfo.UserId != "sysadmin" || approved.Scope != "openid" {
+		t.Fatalf("unexpected approval %#v %#v", approved, approvedInfo)
+	}
+	// device code is single use
+	_, _, err = store.poll(nil, deviceCode, "client")
+	if code := oidcErrorCode(err); code != oidcutils.OIDC_ERROR_INVALID_GRANT {
+		t.Fatalf("poll after consumed got %s", code)
+	}
+
+	denied, deniedCode, _ := store.create(nil, "client", "")
+	_, nonce, _ = store.prepareConfirm(nil, denied.UserCode, "session1")
+	store.confirm(nil, denied.UserCode, nonce, "session1", false, info)
+	_, _, err = store.poll(nil, deniedCode, "client")
+	if code := oidcErrorCode(err); code != oidcutils.OIDC_ERROR_ACCESS_DENIED {
+		t.Fatalf("poll after denial got %s", code)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apigateway/clientman"
+	"yunion.io/x/onecloud/pkg/util/oidcutils"
+)
+
+const (
+	// OIDC refresh token expires in 30 days
+	OIDC_REFRESH_TOKEN_EXPIRE_SECONDS = 30 * 86400
+
+	// codes and refresh tokens are typed so that they are not accepted as
+	// access tokens, which have no type
+	oidcTokenTypeCode    = "code"
+	oidcTokenTypeRefresh = "refresh"
+)
+
+func randomOIDCString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// code verifier is 43-128 characters of [A-Za-z0-9-._~] (RFC 7636 section 4.1)
+var pkceVerifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+func validateCodeChallengeMethod(method string) error {
+	switch method {
+	case oidcutils.OIDC_CODE_CHALLENGE_METHOD_PLAIN, oidcutils.OIDC_CODE_CHALLENGE_METHOD_S256:
+		return nil
+	}
+	return oidcutils.NewOIDCError(oidcutils.OIDC_ERROR_INVALID_REQUEST, "unsupported code_challenge_method "+method)
+}
+
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if !pkceVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	expect := verifier
+	if method == oidcutils.OIDC_CODE_CHALLENGE_METHOD_S256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expect = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expect), []byte(challenge)) == 1
+}
+
+// SOIDCAuthCode is the authorization code bound to the client, the
+// redirect uri and the PKCE challenge of the authorization request
+type SOIDCAuthCode struct {
+	Id                  string
+	Info                SOIDCClientInfo
+	ClientId            string
+	RedirectUri         string
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func (c SOIDCAuthCode) encode() string {
+	json := jsonutils.NewDict()
+	json.Add(jsonutils.NewString(c.Id), "id")
+	json.Add(jsonutils.NewString(string(c.Info.toBytes())), "info")
+	json.Add(jsonutils.NewString(c.ClientId), "client_id")
+	json.Add(jsonutils.NewString(c.RedirectUri), "redirect_uri")
+	json.Add(jsonutils.NewString(c.Scope), "scope")
+	json.Add(jsonutils.NewString(c.CodeChallenge), "code_challenge")
+	json.Add(jsonutils.NewString(c.CodeChallengeMethod), "code_challenge_method")
+	json.Add(jsonutils.NewString(oidcTokenTypeCode), "type")
+	return clientman.EncryptString([]byte(json.String()))
+}
+
+func decodeOIDCAuthCode(code string) (SOIDCAuthCode, error) {
+	ret := SOIDCAuthCode{}
+	json, err := decryptOIDCJson(code)
+	if err != nil {
+		return ret, err
+	}
+	if tokenType, _ := json.GetString("type"); tokenType != oidcTokenTypeCode {
+		return ret, errors.Error("not an authorization code")
+	}
+	info, _ := json.GetString("info")
+	ret.Info, err = decodeOIDCClientInfo([]byte(info))
+	if err != nil {
+		return ret, errors.Wrap(err, "decodeOIDCClientInfo")
+	}
+	ret.Id, _ = json.GetString("id")
+	ret.ClientId, _ = json.GetString("client_id")
+	ret.RedirectUri, _ = json.GetString("redirect_uri")
+	ret.Scope, _ = json.GetString("scope")
+	ret.CodeChallenge, _ = json.GetString("code_challenge")
+	ret.CodeChallengeMethod, _ = json.GetString("code_challenge_method")
+	return ret, nil
+}
+
+// SOIDCRefreshToken is rotated on each use, all tokens rotated from the
+// same grant share the FamilyId so that the whole family is revoked once
+// a used token is replayed
+type SOIDCRefreshToken struct {
+	Id       string
+	FamilyId string
+	Info     SOIDCClientInfo
+	ClientId string
+	Scope    string
+}
+
+func newOIDCRefreshToken(info SOIDCClientInfo, clientId, scope, familyId string) SOIDCRefreshToken {
+	if len(familyId) == 0 {
+		familyId = randomOIDCString(16)
+	}
+	return SOIDCRefreshToken{
+		Id:       randomOIDCString(16),
+		FamilyId: familyId,
+		Info:     info,
+		ClientId: clientId,
+		Scope:    scope,
+	}
+}
+
+func (t SOIDCRefreshToken) isExpired() bool {
+	return t.expiresAt().Before(time.Now())
+}
+
+func (t SOIDCRefreshToken) expiresAt() time.Time {
+	return t.Info.expiresAt(OIDC_REFRESH_TOKEN_EXPIRE_SECONDS)
+}
+
+func (t SOIDCRefreshToken) encode() string {
+	json := jsonutils.NewDict()
+	json.Add(jsonutils.NewString(t.Id), "id")
+	json.Add(jsonutils.NewString(t.FamilyId), "family_id")
+	json.Add(jsonutils.NewString(string(t.Info.toBytes())), "info")
+	json.Add(jsonutils.NewString(t.ClientId), "client_id")
+	json.Add(jsonutils.NewString(t.Scope), "scope")
+	json.Add(jsonutils.NewString(oidcTokenTypeRefresh), "type")
+	return clientman.EncryptString([]byte(json.String()))
+}
+
+func decodeOIDCRefreshToken(token string) (SOIDCRefreshToken, error) {
+	ret := SOIDCRefreshToken{}
+	json, err := decryptOIDCJson(token)
+	if err != nil {
+		return ret, err
+	}
+	if tokenType, _ := json.GetString("type"); tokenType != oidcTokenTypeRefresh {
+		return ret, errors.Error("not a refresh token")
+	}
+	info, _ := json.GetString("info")
+	ret.Info, err = decodeOIDCClientInfo([]byte(info))
+	if err != nil {
+		return ret, errors.Wrap(err, "decodeOIDCClientInfo")
+	}
+	ret.Id, _ = json.GetString("id")
+	ret.FamilyId, _ = json.GetString("family_id")
+	ret.ClientId, _ = json.GetString("client_id")
+	ret.Scope, _ = json.GetString("scope")
+	return ret, nil
+}
+
+func decryptOIDCJson(str string) (jsonutils.JSONObject, error) {
+	tBytes, err := clientman.DecryptString(str)
+	if err != nil {
+		return nil, errors.Wrap(err, "DecryptString")
+	}
+	json, err := jsonutils.Parse(tBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Parse")
+	}
+	return json, nil
+}
@@ -291,6 +291,7 @@ func (f *ResourceHandlers) getHandler(ctx context.Context, w http.ResponseWriter
 			return
 		}
 	}
+	setETag(w, obj)
 	appsrv.SendJSON(w, obj)
 }
 
@@ -501,14 +502,36 @@ func (f *ResourceHandlers) performActionHandler(ctx context.Context, w http.Resp
 			}
 		}
 	} else {
-		if obj, e = module.PerformAction(session, req.ResID(), req.Action(), body); e != nil {
+		version, withVersion, e := appsrv.ParseVersionETag(r.Header.Get("If-Match"))
+		if e != nil {
+			httperrors.InputParameterError(ctx, w, "%v", e)
+			return
+		}
+		if withVersion {
+			obj, e = module.PerformActionWithVersion(session, req.ResID(), req.Action(), version, body)
+		} else {
+			obj, e = module.PerformAction(session, req.ResID(), req.Action(), body)
+		}
+		if e != nil {
 			httperrors.GeneralServerError(ctx, w, e)
 		} else {
+			setETag(w, obj)
 			appsrv.SendJSON(w, obj)
 		}
 	}
 }
 
+// setETag forwards ETag of the resource, which is expected in If-Match
+// header of later update requests
+func setETag(w http.ResponseWriter, obj jsonutils.JSONObject) {
+	if obj == nil {
+		return
+	}
+	if version, err := obj.Int("update_version"); err == nil {
+		w.Header().Set("ETag", appsrv.VersionETag(int(version)))
+	}
+}
+
 // joint attach
 // /<resname>/<resid>/<resname2>/<resid2>
 func (f *ResourceHandlers) attachHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
@@ -603,10 +626,21 @@ func (f *ResourceHandlers) updateHandler(ctx context.Context, w http.ResponseWri
 	module := req.Mod1()
 	body := req.Body()
 
-	obj, e := module.Update(req.Session(), req.ResID(), body)
+	version, withVersion, e := appsrv.ParseVersionETag(r.Header.Get("If-Match"))
+	if e != nil {
+		httperrors.InputParameterError(ctx, w, "%v", e)
+		return
+	}
+	var obj jsonutils.JSONObject
+	if withVersion {
+		obj, e = module.UpdateWithVersion(req.Session(), req.ResID(), version, body)
+	} else {
+		obj, e = module.Update(req.Session(), req.ResID(), body)
+	}
 	if e != nil {
 		httperrors.GeneralServerError(ctx, w, e)
 	} else {
+		setETag(w, obj)
 		appsrv.SendJSON(w, obj)
 	}
 }
@@ -29,6 +29,10 @@ type GatewayOptions struct {
 	EnableTotp bool   `help:"Enable two-factor authentication" default:"false"`
 	TotpIssuer string `help:"TOTP issuer" default:"Cloudpods"`
 
+	WebauthnRpId    string   `help:"WebAuthn relying party ID, default is the host of api_server"`
+	WebauthnRpName  string   `help:"WebAuthn relying party name shown by authenticators" default:"Cloudpods"`
+	WebauthnOrigins []string `help:"Origins allowed for WebAuthn ceremonies, default is the origin of api_server"`
+
 	SsoRedirectUrl     string `help:"SSO idp redirect URL"`
 	SsoAuthCallbackUrl string `help:"SSO idp auth callback URL"`
 	SsoLinkCallbackUrl string `help:"SSO idp link user callback URL"`
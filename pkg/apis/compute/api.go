@@ -334,6 +334,11 @@ type ServerConfigs struct {
 	// 主机组列表, 参数可以是主机组名称或ID,建议使用ID
 	InstanceGroupIds []string `json:"groups"`
 
+	// 是否启用NUMA感知调度, 虚拟机vCPU和内存会绑定到宿主机NUMA节点,
+	// 单个节点放不下时拆分为多个虚拟NUMA节点, 仅对KVM生效
+	// default: false
+	EnableNuma bool `json:"enable_numa"`
+
 	// DEPRECATE
 	Suggestion bool `json:"suggestion"`
 }
@@ -416,6 +421,10 @@ type ServerCreateInput struct {
 	// emulate: pc, q35
 	Machine string `json:"machine"`
 
+	// 是否启用虚拟TPM设备, 仅支持x86_64架构的KVM虚拟机, 需要同时指定encrypt_key_id或encrypt_key_new加密虚拟机
+	// default: false
+	Vtpm bool `json:"vtpm"`
+
 	// 启动顺序
 	// c: cdrome
 	// d: disk
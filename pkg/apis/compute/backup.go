@@ -21,9 +21,10 @@ import (
 )
 
 const (
-	BACKUPSTORAGE_TYPE_NFS       = "nfs"
-	BACKUPSTORAGE_STATUS_ONLINE  = "online"
-	BACKUPSTORAGE_STATUS_OFFLINE = "offline"
+	BACKUPSTORAGE_TYPE_NFS            = "nfs"
+	BACKUPSTORAGE_TYPE_OBJECT_STORAGE = "object"
+	BACKUPSTORAGE_STATUS_ONLINE       = "online"
+	BACKUPSTORAGE_STATUS_OFFLINE      = "offline"
 
 	BACKUP_STATUS_CREATING                = "creating"
 	BACKUP_STATUS_CREATE_FAILED           = "create_failed"
@@ -40,6 +41,11 @@ const (
 	BACKUP_STATUS_RECOVERY_FAILED         = "recovery_failed"
 	BACKUP_STATUS_UNKNOWN                 = "unknown"
 
+	// a full copy of the disk
+	BACKUP_MODE_FULL = "full"
+	// only the blocks changed since the parent backup
+	BACKUP_MODE_INCREMENTAL = "incremental"
+
 	BACKUP_EXIST     = "exist"
 	BACKUP_NOT_EXIST = "not_exist"
 )
@@ -52,7 +58,7 @@ type BackupStorageCreateInput struct {
 	apis.EnabledStatusInfrasResourceBaseCreateInput
 
 	// description: storage type
-	// enum: nfs
+	// enum: nfs,object
 	StorageType string `json:"storage_type"`
 
 	// description: host of nfs, storage_type 为 nfs 时, 此参数必传
@@ -63,6 +69,20 @@ type BackupStorageCreateInput struct {
 	// example: /nfs_root/
 	NfsSharedDir string `json:"nfs_shared_dir"`
 
+	// description: url of the bucket, storage_type 为 object 时, 此参数必传
+	// example: https://minio.example.com:9000/backups
+	ObjectBucketUrl string `json:"object_bucket_url"`
+
+	// description: access key of object storage, storage_type 为 object 时, 此参数必传
+	ObjectAccessKey string `json:"object_access_key"`
+
+	// description: secret of object storage, storage_type 为 object 时, 此参数必传
+	ObjectSecret string `json:"object_secret"`
+
+	// description: 不校验对象存储的TLS证书, 仅用于自签名证书的测试环境
+	// default: false
+	ObjectInsecureSkipVerify bool `json:"object_insecure_skip_verify"`
+
 	// description: Capacity size in MB
 	CapacityMb int `json:"capacity_mb"`
 }
@@ -76,6 +96,10 @@ type BackupStorageDetails struct {
 
 	NfsHost      string
 	NfsSharedDir string
+
+	ObjectBucketUrl          string
+	ObjectAccessKey          string
+	ObjectInsecureSkipVerify bool
 }
 
 type BackupStorageListInput struct {
@@ -107,6 +131,8 @@ type DiskBackupDetails struct {
 	BackupStorageName string `json:"backup_storage_name"`
 	// description: 是否是子备份
 	IsSubBackup bool `json:"is_sub_backup"`
+	// description: name of parent backup of incremental backup
+	ParentName string `json:"parent_name"`
 }
 
 type DiskBackupCreateInput struct {
@@ -117,6 +143,12 @@ type DiskBackupCreateInput struct {
 	DiskId string `json:"disk_id"`
 	// description: backup storage id
 	BackupStorageId string `json:"back_storage_id"`
+	// description: backup mode, incremental backup only saves blocks changed since the latest backup of the disk
+	// enum: full,incremental
+	// default: full
+	BackupMode string `json:"backup_mode"`
+	// swagger: ignore
+	ParentId string `json:"parent_id"`
 	// swagger: ignore
 	CloudregionId string `json:"cloudregion_id"`
 	// swagger:ignore
@@ -151,6 +183,8 @@ type InstanceBackupPackMetadata struct {
 	InstanceType   string
 	SizeMb         int
 	DiskMetadatas  []DiskBackupPackMetadata
+	// 虚拟TPM状态, 由EncryptKeyId对应的密钥加密
+	VtpmState string
 
 	// 加密密钥ID
 	EncryptKeyId string
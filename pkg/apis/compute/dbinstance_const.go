@@ -20,6 +20,9 @@ const (
 	DBINSTANCE_DEPLOYING             = "deploying"         //部署中
 	DBINSTANCE_RUNNING               = "running"           //运行中
 	DBINSTANCE_REBOOTING             = "rebooting"         //重启中
+	DBINSTANCE_STARTING              = "starting"          //启动中
+	DBINSTANCE_STOPPING              = "stopping"          //停止中
+	DBINSTANCE_STOPPED               = "stopped"           //已停止
 	DBINSTANCE_MIGRATING             = "migrating"         //迁移中
 	DBINSTANCE_BACKING_UP            = "backing_up"        //备份中
 	DBINSTANCE_BACKING_UP_FAILED     = "backing_up_failed" //备份失败
@@ -47,6 +50,8 @@ const (
 	DBINSTANCE_SYNC_CONFIG = "sync_config" //同步配置
 
 	DBINSTANCE_REBOOT_FAILED = "reboot_failed" //重启失败
+	DBINSTANCE_START_FAILED  = "start_failed"  //启动失败
+	DBINSTANCE_STOP_FAILED   = "stop_failed"   //停止失败
 	DBINSTANCE_CREATE_FAILED = "create_failed" //创建失败
 
 	DBINSTANCE_FAILE = "failed" //操作失败
@@ -314,6 +314,8 @@ type DiskAllocateFromBackupInput struct {
 	BackupId                string
 	BackupStorageId         string
 	BackupStorageAccessInfo *jsonutils.JSONDict
+	// ancestors of incremental backup, from the full backup to the direct parent
+	BackupChain []string
 }
 
 type DiskDeleteInput struct {
@@ -22,6 +22,11 @@ const (
 	ELASTIC_CACHE_STATUS_RUNNING               = "running"               //（正常）
 	ELASTIC_CACHE_STATUS_RESTARTING            = "restarting"            //（重启中）
 	ELASTIC_CACHE_STATUS_RESTART_FAILED        = "restart_failed"        //（重启失败）
+	ELASTIC_CACHE_STATUS_STARTING              = "starting"              //（启动中）
+	ELASTIC_CACHE_STATUS_START_FAILED          = "start_failed"          //（启动失败）
+	ELASTIC_CACHE_STATUS_STOPPING              = "stopping"              //（停止中）
+	ELASTIC_CACHE_STATUS_STOPPED               = "stopped"               //（已停止）
+	ELASTIC_CACHE_STATUS_STOP_FAILED           = "stop_failed"           //（停止失败）
 	ELASTIC_CACHE_STATUS_DEPLOYING             = "deploying"             //（创建中）
 	ELASTIC_CACHE_STATUS_CREATE_FAILED         = "create_failed"         //（创建失败）
 	ELASTIC_CACHE_STATUS_CHANGING              = "changing"              //（修改中）
@@ -0,0 +1,51 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"reflect"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+)
+
+// GuestNumaNode is a virtual NUMA node of guest, vcpus are assigned to
+// virtual nodes in order, e.g. the 1st node takes vcpu 0 to VcpuCount-1
+type GuestNumaNode struct {
+	// 绑定的宿主机NUMA节点
+	HostNodeId int `json:"host_node_id"`
+	VcpuCount  int `json:"vcpu_count"`
+	MemSizeMb  int `json:"mem_size_mb"`
+}
+
+// GuestNumaPlacement records virtual NUMA nodes of guest on host
+type GuestNumaPlacement struct {
+	HostId string          `json:"host_id"`
+	Nodes  []GuestNumaNode `json:"nodes"`
+}
+
+func (p GuestNumaPlacement) String() string {
+	return jsonutils.Marshal(p).String()
+}
+
+func (p GuestNumaPlacement) IsZero() bool {
+	return len(p.Nodes) == 0
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&GuestNumaPlacement{}), func() gotypes.ISerializable {
+		return &GuestNumaPlacement{}
+	})
+}
@@ -653,6 +653,12 @@ type ServerChangeConfigInput struct {
 	// 调整完配置后是否自动启动
 	AutoStart bool `json:"auto_start"`
 
+	// 是否启用虚拟TPM, 仅关机状态下可调整
+	Vtpm *bool `json:"vtpm"`
+
+	// 是否启用NUMA感知调度, 下次启动时生效
+	EnableNuma *bool `json:"enable_numa"`
+
 	Disks []DiskConfig `json:"disks"`
 }
 
@@ -691,12 +697,16 @@ type GuestJsonDesc struct {
 	Machine     string `json:"machine"`
 	Bios        string `json:"bios"`
 	BootOrder   string `json:"boot_order"`
+	Vtpm        bool   `json:"vtpm"`
 	SrcIpCheck  bool   `json:"src_ip_check"`
 	SrcMacCheck bool   `json:"src_mac_check"`
 	IsMaster    *bool  `json:"is_master"`
 	IsSlave     *bool  `json:"is_slave"`
 	HostId      string `json:"host_id"`
 
+	// virtual NUMA nodes bound to host NUMA nodes, empty if NUMA is not enabled
+	NumaNodes []GuestNumaNode `json:"numa_nodes"`
+
 	IsolatedDevices []*IsolatedDeviceJsonDesc `json:"isolated_devices"`
 
 	Domain string `json:"domain"`
@@ -813,6 +823,8 @@ type ServerSnapshotAndCloneInput struct {
 type ServerInstanceSnapshot struct {
 	ServerCreateSnapshotParams
 	WithMemory bool `json:"with_memory"`
+	// 主机快照的标签
+	Metadata map[string]string `json:"__meta__"`
 }
 
 type ServerCreateSnapshotParams struct {
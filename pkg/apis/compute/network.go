@@ -188,6 +188,32 @@ type NetworkCreateInput struct {
 	// example: cn.pool.ntp.org,0.cn.pool.ntp.org
 	GuestNtp string `json:"guest_ntp"`
 
+	// description: ipv6 range of guest, only supported by vpc networks
+	// example: fd00:1::/64
+	GuestIp6Prefix string `json:"guest_ip6_prefix"`
+
+	// description: ipv6 range of guest ip start, if set guest_ip6_prefix, this parameter will be useless
+	// example: fd00:1::2
+	GuestIp6Start string `json:"guest_ip6_start"`
+
+	// description: ipv6 range of guest ip end, if set guest_ip6_prefix, this parameter will be useless
+	// example: fd00:1::ffff:ffff:ffff:fffe
+	GuestIp6End string `json:"guest_ip6_end"`
+
+	// description: ipv6 mask length of guest, if set guest_ip6_prefix, this parameter will be useless
+	// example: 64
+	// maximum: 126
+	// minimum: 48
+	GuestIp6Mask int64 `json:"guest_ip6_mask"`
+
+	// description: guest ipv6 gateway
+	// example: fd00:1::1
+	GuestGateway6 string `json:"guest_gateway6"`
+
+	// description: guest ipv6 dns
+	// example: 2400:3200::1
+	GuestDns6 string `json:"guest_dns6"`
+
 	// swagger:ignore
 	WireId string `json:"wire_id"`
 
@@ -363,6 +389,21 @@ type NetworkUpdateInput struct {
 
 	GuestDomain string `json:"guest_domain"`
 
+	// IPv6地址段, 仅VPC子网支持
+	GuestIp6Prefix string `json:"guest_ip6_prefix"`
+	// IPv6起始地址
+	GuestIp6Start string `json:"guest_ip6_start"`
+	// IPv6结束地址
+	GuestIp6End string `json:"guest_ip6_end"`
+	// IPv6掩码
+	GuestIp6Mask *int8 `json:"guest_ip6_mask"`
+	// IPv6网关地址
+	GuestGateway6 string `json:"guest_gateway6"`
+	// IPv6 DNS
+	GuestDns6 string `json:"guest_dns6"`
+
+	GuestDomain6 string `json:"guest_domain6"`
+
 	VlanId *int `json:"vlan_id"`
 
 	// 分配策略
@@ -16,6 +16,7 @@ package compute
 
 import (
 	"fmt"
+	"net"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
@@ -67,7 +68,7 @@ type SSecgroupRuleResource struct {
 	// required: true
 	Direction string `json:"direction"`
 
-	// ip或cidr地址, 若指定peer_secgroup_id此参数不生效
+	// ip或cidr地址, IPv6地址仅在OVN VPC中生效, 若指定peer_secgroup_id此参数不生效
 	// example: 192.168.222.121
 	CIDR string `json:"cidr"`
 
@@ -129,7 +130,7 @@ func (input *SSecgroupRuleResource) Check() error {
 	}
 
 	if len(input.CIDR) > 0 {
-		if !regutils.MatchCIDR(input.CIDR) && !regutils.MatchIPAddr(input.CIDR) {
+		if _, _, err := net.ParseCIDR(input.CIDR); err != nil && !regutils.MatchIPAddr(input.CIDR) {
 			return fmt.Errorf("invalid ip address: %s", input.CIDR)
 		}
 	} else {
@@ -26,6 +26,10 @@ type SnapshotCreateInput struct {
 	DiskId string `json:"disk_id"`
 	// swagger:ignore
 	Disk string `json:"disk" yunion-deprecated-by:"disk_id"`
+	// 创建快照前是否通过qemu-guest-agent冻结虚拟机文件系统，以获得文件系统一致的快照
+	// 仅对运行中且安装了qemu-guest-agent的KVM虚拟机生效，冻结失败时退化为崩溃一致性快照
+	// default: false
+	Fsfreeze bool `json:"fsfreeze"`
 	// swagger:ignore
 	StorageId string `json:"storage_id"`
 	// swagger:ignore
@@ -50,6 +50,11 @@ const (
 	sVpcInterExtIP2  = "100.65.0.2"
 	VpcInterExtMac1  = "ee:ee:ee:ee:ee:f0"
 	VpcInterExtMac2  = "ee:ee:ee:ee:ee:f1"
+
+	// ipv6 addresses of the link between vpc router and vpc ext router
+	VpcInterExtMaskV6 = 126
+	VpcInterExtIP1V6  = "fd00:100:65::1"
+	VpcInterExtIP2V6  = "fd00:100:65::2"
 )
 
 var (
@@ -0,0 +1,174 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"reflect"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	WEBHOOK_ACTION_CREATE = "create"
+	WEBHOOK_ACTION_UPDATE = "update"
+	WEBHOOK_ACTION_DELETE = "delete"
+
+	WEBHOOK_SUBSCRIPTION_STATUS_READY = "ready"
+
+	// 等待投递
+	WEBHOOK_DELIVERY_STATUS_PENDING = "pending"
+	// 投递失败，等待重试
+	WEBHOOK_DELIVERY_STATUS_RETRYING = "retrying"
+	// 投递成功
+	WEBHOOK_DELIVERY_STATUS_SUCCEEDED = "succeeded"
+	// 重试次数耗尽，进入死信列表
+	WEBHOOK_DELIVERY_STATUS_DEAD_LETTER = "dead_letter"
+
+	// 请求体HMAC-SHA256签名, 格式为 sha256=<hex>, 签名内容为 <timestamp>.<body>
+	WEBHOOK_HEADER_SIGNATURE = "X-Cloudpods-Signature"
+	// 签名时间戳, unix秒
+	WEBHOOK_HEADER_TIMESTAMP = "X-Cloudpods-Timestamp"
+	// CloudEvents事件ID, 重试时保持不变, 接收方可据此去重
+	WEBHOOK_HEADER_EVENT_ID = "X-Cloudpods-Event-Id"
+
+	WEBHOOK_CLOUDEVENTS_SPEC_VERSION = "1.0"
+	WEBHOOK_CLOUDEVENTS_CONTENT_TYPE = "application/cloudevents+json"
+	WEBHOOK_CLOUDEVENTS_TYPE_PREFIX  = "com.yunion.cloudpods"
+)
+
+var WEBHOOK_ACTIONS = []string{
+	WEBHOOK_ACTION_CREATE,
+	WEBHOOK_ACTION_UPDATE,
+	WEBHOOK_ACTION_DELETE,
+}
+
+// WebhookEventFilter selects the resource change events delivered to a
+// webhook subscription
+type WebhookEventFilter struct {
+	// 资源类型, 例如 servers, disks, networks
+	// required: true
+	ResourceTypes []string `json:"resource_types"`
+	// 操作类型, 可能值: create, update, delete
+	Actions []string `json:"actions"`
+	// 资源所属项目, 为空时仅订阅订阅本身所在项目的资源
+	ProjectIds []string `json:"project_ids"`
+	// 订阅所有项目的资源, 需要系统管理员权限
+	AllProjects bool `json:"all_projects"`
+}
+
+func (f WebhookEventFilter) String() string {
+	return jsonutils.Marshal(f).String()
+}
+
+func (f WebhookEventFilter) IsZero() bool {
+	return len(f.ResourceTypes) == 0 && len(f.Actions) == 0 && len(f.ProjectIds) == 0 && !f.AllProjects
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&WebhookEventFilter{}), func() gotypes.ISerializable {
+		return &WebhookEventFilter{}
+	})
+}
+
+type WebhookSubscriptionCreateInput struct {
+	apis.VirtualResourceCreateInput
+	apis.EnabledBaseResourceCreateInput
+
+	// 接收事件的URL
+	// required: true
+	Url string `json:"url"`
+	// 签名密钥, 长度16到128, 加密保存且不再返回
+	Secret string `json:"secret"`
+
+	Filter *WebhookEventFilter `json:"filter"`
+}
+
+type WebhookSubscriptionUpdateInput struct {
+	apis.VirtualResourceBaseUpdateInput
+
+	Url    string              `json:"url"`
+	Filter *WebhookEventFilter `json:"filter"`
+}
+
+type WebhookSubscriptionListInput struct {
+	apis.VirtualResourceListInput
+	apis.EnabledResourceBaseListInput
+
+	// 以订阅的资源类型过滤
+	ResourceType string `json:"resource_type"`
+}
+
+type WebhookSubscriptionDetails struct {
+	apis.VirtualResourceDetails
+
+	// 死信数量
+	DeadLetterCount int `json:"dead_letter_count"`
+	// 待投递数量
+	PendingCount int `json:"pending_count"`
+}
+
+type WebhookSubscriptionResetSecretInput struct {
+	// 新的签名密钥, 长度16到128
+	Secret string `json:"secret"`
+}
+
+type WebhookDeliveryListInput struct {
+	apis.StatusStandaloneResourceListInput
+	apis.ProjectizedResourceListInput
+
+	// 以webhook订阅过滤
+	WebhookSubscriptionId string `json:"webhook_subscription_id"`
+	// 以资源类型过滤
+	ResourceType string `json:"resource_type"`
+	// 以资源ID过滤
+	ResourceId string `json:"resource_id"`
+	// 以操作类型过滤
+	Action string `json:"action"`
+	// 仅列出死信
+	DeadLetter *bool `json:"dead_letter"`
+}
+
+type WebhookDeliveryDetails struct {
+	apis.StatusStandaloneResourceDetails
+	apis.ProjectizedResourceInfo
+
+	WebhookSubscription string `json:"webhook_subscription"`
+}
+
+// WebhookCloudEvent is the structured mode CloudEvents v1.0 envelope
+// delivered to webhook subscribers
+type WebhookCloudEvent struct {
+	SpecVersion     string            `json:"specversion"`
+	Id              string            `json:"id"`
+	Source          string            `json:"source"`
+	Type            string            `json:"type"`
+	Subject         string            `json:"subject"`
+	Time            time.Time         `json:"time"`
+	DataContentType string            `json:"datacontenttype"`
+	Data            *WebhookEventData `json:"data"`
+}
+
+type WebhookEventData struct {
+	Action       string              `json:"action"`
+	ResourceType string              `json:"resource_type"`
+	ResourceId   string              `json:"resource_id"`
+	ProjectId    string              `json:"tenant_id,omitempty"`
+	Object       *jsonutils.JSONDict `json:"object"`
+	OldObject    *jsonutils.JSONDict `json:"old_object,omitempty"`
+}
@@ -129,8 +129,14 @@ type SBackupStorage struct {
 
 // SBackupStorageAccessInfo is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SBackupStorageAccessInfo.
 type SBackupStorageAccessInfo struct {
-	NfsHost      string `json:"nfs_host"`
-	NfsSharedDir string `json:"nfs_shared_dir"`
+	NfsHost         string `json:"nfs_host"`
+	NfsSharedDir    string `json:"nfs_shared_dir"`
+	ObjectBucketUrl string `json:"object_bucket_url"`
+	ObjectAccessKey string `json:"object_access_key"`
+	// secret encrypted with id of backup storage
+	ObjectSecret string `json:"object_secret"`
+	// skip verifying TLS certificate of object storage
+	ObjectInsecureSkipVerify bool `json:"object_insecure_skip_verify"`
 }
 
 // SBaremetalagent is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SBaremetalagent.
@@ -658,6 +664,9 @@ type SDiskBackup struct {
 	// 操作系统类型
 	OsType     string             `json:"os_type"`
 	DiskConfig *SBackupDiskConfig `json:"disk_config"`
+	// 增量备份的父备份
+	ParentId   string `json:"parent_id"`
+	BackupMode string `json:"backup_mode"`
 }
 
 // SDiskResourceBase is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SDiskResourceBase.
@@ -1113,6 +1122,12 @@ type SGuest struct {
 	Vdi          string  `json:"vdi"`
 	Machine      string  `json:"machine"`
 	Bios         string  `json:"bios"`
+	// 是否启用虚拟TPM
+	Vtpm bool `json:"vtpm"`
+	// 是否启用NUMA感知调度
+	EnableNuma bool `json:"enable_numa"`
+	// 虚拟NUMA节点在宿主机上的分布
+	NumaPlacement *GuestNumaPlacement `json:"numa_placement"`
 	// 操作系统类型
 	OsType   string `json:"os_type"`
 	FlavorId string `json:"flavor_id"`
@@ -1436,6 +1451,8 @@ type SInstanceBackup struct {
 	InstanceType string `json:"instance_type"`
 	// 主机备份容量和
 	SizeMb int `json:"size_mb"`
+	// 虚拟TPM状态, base64编码
+	VtpmState string `json:"vtpm_state"`
 }
 
 // SInstanceSnapshot is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SInstanceSnapshot.
@@ -1478,6 +1495,10 @@ type SInstanceSnapshot struct {
 	MemoryFilePath string `json:"memory_file_path"`
 	// 内存文件校验和
 	MemoryFileChecksum string `json:"memory_file_checksum"`
+	// 是否启用虚拟TPM
+	Vtpm bool `json:"vtpm"`
+	// 虚拟TPM状态, base64编码
+	VtpmState string `json:"vtpm_state"`
 }
 
 // SInterVpcNetwork is an autogenerated struct via yunion.io/x/onecloud/pkg/compute/models.SInterVpcNetwork.
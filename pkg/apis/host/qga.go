@@ -0,0 +1,52 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package host
+
+type GuestQgaPingRequest struct {
+	// timeout in seconds
+	Timeout int `json:"timeout"`
+}
+
+type GuestQgaSetPasswordRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// password is already crypted, e.g. $6$...
+	Crypted bool `json:"crypted"`
+}
+
+type GuestQgaFsfreezeResponse struct {
+	// number of frozen or thawed filesystems
+	Count int `json:"count"`
+}
+
+type GuestQgaExecRequest struct {
+	Path  string   `json:"path"`
+	Args  []string `json:"args"`
+	Env   []string `json:"env"`
+	Input string   `json:"input"`
+	// seconds to wait for process exit, default 5
+	Timeout int `json:"timeout"`
+}
+
+type GuestQgaExecResponse struct {
+	Pid          int    `json:"pid"`
+	Exited       bool   `json:"exited"`
+	ExitCode     int    `json:"exit_code"`
+	Signal       int    `json:"signal"`
+	Stdout       string `json:"stdout"`
+	Stderr       string `json:"stderr"`
+	OutTruncated bool   `json:"out_truncated"`
+	ErrTruncated bool   `json:"err_truncated"`
+}
@@ -31,3 +31,11 @@ type HostTopology struct {
 type HostCPUInfo struct {
 	*cpu.Info
 }
+
+// HostNumaNode is the capacity of a host NUMA node reported in host sys_info
+type HostNumaNode struct {
+	NodeId      int   `json:"node_id"`
+	Cpus        []int `json:"cpus"`
+	MemSizeMb   int   `json:"mem_size_mb"`
+	HugepagesMb int   `json:"hugepages_mb"`
+}
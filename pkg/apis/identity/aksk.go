@@ -26,8 +26,28 @@ const (
 	RECOVERY_SECRETS_TYPE = "recovery_secret"
 	OIDC_CREDENTIAL_TYPE  = "oidc"
 	ENCRYPT_KEY_TYPE      = "enc_key"
+	WEBAUTHN_TYPE         = "webauthn"
+
+	// 管理员签发的WebAuthn认证器注册凭证
+	WEBAUTHN_ENROLLMENT_TYPE = "webauthn_enrollment"
+	// 已使用的一次性令牌，用于多个apigateway实例间的防重放
+	USED_TOKEN_TYPE = "used_token"
+	// 待确认的OIDC设备授权，由多个apigateway实例共享
+	OIDC_DEVICE_TYPE = "oidc_device"
 )
 
+// SExpirableTokenBlob is the blob of webauthn enrollment and used token
+// credentials, only the hash of the token is kept. The blob of oidc device
+// credentials carries the expire field as well.
+type SExpirableTokenBlob struct {
+	TokenHash string `json:"token_hash"`
+	Expire    int64  `json:"expire"`
+}
+
+func (info SExpirableTokenBlob) IsExpired() bool {
+	return info.Expire > 0 && info.Expire <= time.Now().Unix()
+}
+
 type SAccessKeySecretBlob struct {
 	Secret string `json:"secret"`
 	Expire int64  `json:"expire"`
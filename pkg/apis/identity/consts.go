@@ -83,11 +83,16 @@ const (
 	IdentitySyncStatusIdle    = "idle"
 
 	MinimalSyncIntervalSeconds = 5 * 60 // 5 minutes
+
+	IMAGE_SIGNATURE_POLICY_NONE    = "none"
+	IMAGE_SIGNATURE_POLICY_ENFORCE = "enforce"
 )
 
 var (
 	AUTH_METHODS = []string{AUTH_METHOD_PASSWORD, AUTH_METHOD_TOKEN, AUTH_METHOD_AKSK, AUTH_METHOD_CAS}
 
+	IMAGE_SIGNATURE_POLICIES = []string{IMAGE_SIGNATURE_POLICY_NONE, IMAGE_SIGNATURE_POLICY_ENFORCE}
+
 	PASSWORD_PROTECTED_IDPS = []string{
 		IdentityDriverSQL,
 		IdentityDriverLDAP,
@@ -31,6 +31,9 @@ type CredentialUpdateInput struct {
 
 	// enabled
 	Enabled *bool `json:"enabled"`
+
+	// 凭证内容，仅webauthn类型的凭证允许更新，用于保存签名计数等状态
+	Blob string `json:"blob"`
 }
 
 type CredentialCreateInput struct {
@@ -57,4 +57,20 @@ type DomainCreateInput struct {
 
 	// 是否启用
 	Enabled *bool `json:"enabled"`
+
+	// 是否要求管理员使用WebAuthn进行二次认证
+	AdminRequireWebauthn *bool `json:"admin_require_webauthn"`
+
+	// 镜像签名策略, 可能值为: none, enforce
+	ImageSignaturePolicy string `json:"image_signature_policy"`
+}
+
+type DomainMfaPolicyInput struct {
+	// 是否要求具有域或系统管理权限的用户使用WebAuthn（如安全密钥）进行二次认证
+	AdminRequireWebauthn *bool `json:"admin_require_webauthn"`
+}
+
+type DomainImageSignaturePolicyInput struct {
+	// 镜像签名策略, 可能值为: none(不限制), enforce(只允许使用签名验证通过的镜像创建虚拟机)
+	ImageSignaturePolicy string `json:"image_signature_policy"`
 }
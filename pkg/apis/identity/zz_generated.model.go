@@ -71,6 +71,10 @@ type SDomain struct {
 	IsDomain *bool  `json:"is_domain,omitempty"`
 	DomainId string `json:"domain_id"`
 	ParentId string `json:"parent_id"`
+	// 是否要求具有域或系统管理权限的用户使用WebAuthn进行二次认证
+	AdminRequireWebauthn *bool `json:"admin_require_webauthn,omitempty"`
+	// 镜像签名策略, none: 不限制, enforce: 只允许使用签名验证通过的镜像创建虚拟机
+	ImageSignaturePolicy string `json:"image_signature_policy"`
 }
 
 // SEnabledIdentityBaseResource is an autogenerated struct via yunion.io/x/onecloud/pkg/keystone/models.SEnabledIdentityBaseResource.
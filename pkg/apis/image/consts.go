@@ -25,6 +25,7 @@ const (
 	// https://docs.openstack.org/glance/pike/user/statuses.html
 	//
 	IMAGE_STATUS_QUEUED     = "queued"
+	IMAGE_STATUS_UPLOADING  = "uploading"
 	IMAGE_STATUS_SAVING     = "saving"
 	IMAGE_STATUS_SAVE_FAIL  = "save_fail"
 	IMAGE_STATUS_SAVED      = "saved"
@@ -36,6 +37,11 @@ const (
 	IMAGE_ENCRYPT_STATUS_ENCRYPTED   = "encrypted"
 	IMAGE_ENCRYPT_STATUS_ENCRYPTING  = "encrypting"
 
+	IMAGE_SIGNATURE_STATUS_UNSIGNED  = "unsigned"
+	IMAGE_SIGNATURE_STATUS_VERIFIED  = "verified"
+	IMAGE_SIGNATURE_STATUS_UNTRUSTED = "untrusted"
+	IMAGE_SIGNATURE_STATUS_INVALID   = "invalid"
+
 	IMAGE_STATUS_DEACTIVATED    = "deactivated"
 	IMAGE_STATUS_KILLED         = "killed"
 	IMAGE_STATUS_DELETED        = "deleted"
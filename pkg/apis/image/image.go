@@ -98,6 +98,33 @@ type ImageCreateInput struct {
 
 	// 镜像属性
 	Properties map[string]string `json:"properties"`
+
+	// 随镜像上传的签名
+	ImageSignatureInput
+
+	// 从OCI镜像仓库导入镜像
+	ImageOciInput
+}
+
+type ImageOciInput struct {
+	// OCI镜像引用, 例如: harbor.example.com/disks/centos:7
+	// 支持KubeVirt containerDisk格式及包含application/vnd.*.disk类型层的镜像
+	OciReference string `json:"oci_reference"`
+	// 镜像仓库用户名
+	OciUsername string `json:"oci_username"`
+	// 镜像仓库密码
+	OciPassword string `json:"oci_password"`
+}
+
+type ImageSignatureInput struct {
+	// 签名格式, 可能值为: cosign, x509
+	SignatureFormat string `json:"signature_format"`
+	// base64编码的签名
+	Signature string `json:"signature"`
+	// base64编码的cosign签名载荷, 载荷中包含镜像的SHA256摘要
+	SignaturePayload string `json:"signature_payload"`
+	// PEM或base64编码的PEM签名证书, 其后可附带中间证书
+	SignatureCertificate string `json:"signature_certificate"`
 }
 
 type ImageUpdateStatusInput struct {
@@ -111,3 +138,65 @@ type ImageUpdateStatusInput struct {
 
 type PerformProbeInput struct {
 }
+
+type ImageVerifySignatureInput struct {
+}
+
+type ImageSignaturesOutput struct {
+	// 镜像文件的SHA256摘要
+	Digest string `json:"digest"`
+	// 内容与摘要一致的镜像格式, 镜像加密后为空
+	SignedFormat string `json:"signed_format"`
+	// 签名验证状态
+	SignatureStatus string `json:"signature_status"`
+	// 签名者
+	SignedBy string `json:"signed_by"`
+
+	Signatures []SImageSignature `json:"signatures"`
+}
+
+type ImageStartUploadInput struct {
+	// 镜像文件总大小, 单位Byte
+	Size int64 `json:"size"`
+	// 镜像文件的MD5校验和, 完成上传时校验, 可不填
+	Checksum string `json:"checksum"`
+}
+
+type ImageUploadChunkInput struct {
+	// 上传会话ID
+	UploadId string `json:"upload_id"`
+	// 分片在镜像文件中的偏移量, 必须等于已上传的字节数
+	Offset int64 `json:"offset"`
+	// 分片的MD5校验和, 可不填
+	Checksum string `json:"checksum"`
+}
+
+type ImageFinishUploadInput struct {
+	// 上传会话ID
+	UploadId string `json:"upload_id"`
+}
+
+type ImageAbortUploadInput struct {
+	// 上传会话ID
+	UploadId string `json:"upload_id"`
+}
+
+type ImageUploadOutput struct {
+	// 上传会话ID
+	UploadId string `json:"upload_id"`
+	// 镜像文件总大小
+	Size int64 `json:"size"`
+	// 已上传的字节数, 下一个分片从此处开始
+	Offset int64 `json:"offset"`
+	// 镜像文件的MD5校验和
+	Checksum string `json:"checksum"`
+	// 上传会话过期时间, 过期后未完成的上传会被清理
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+type ImageExportOciInput struct {
+	ImageOciInput
+
+	// 导出的镜像格式, 默认为镜像本身的格式
+	Format string `json:"format"`
+}
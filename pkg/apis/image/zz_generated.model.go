@@ -15,6 +15,8 @@
 package image
 
 import (
+	time "time"
+
 	"yunion.io/x/onecloud/pkg/apis"
 )
 
@@ -66,6 +68,12 @@ type SImage struct {
 	OssChecksum string `json:"oss_checksum"`
 	// 加密状态, "",encrypting,encrypted
 	EncryptStatus string `json:"encrypt_status"`
+	// 镜像文件的SHA256摘要, 签名针对该摘要
+	Digest string `json:"digest"`
+	// 签名验证状态, unsigned,verified,untrusted,invalid
+	SignatureStatus string `json:"signature_status"`
+	// 签名者
+	SignedBy string `json:"signed_by"`
 }
 
 // SImageMember is an autogenerated struct via yunion.io/x/onecloud/pkg/image/models.SImageMember.
@@ -89,6 +97,28 @@ type SImageProperty struct {
 	Value string `json:"value"`
 }
 
+// SImageSignature is an autogenerated struct via yunion.io/x/onecloud/pkg/image/models.SImageSignature.
+type SImageSignature struct {
+	SImagePeripheral
+	Format      string `json:"format"`
+	Signature   string `json:"signature"`
+	Payload     string `json:"payload"`
+	Certificate string `json:"certificate"`
+	Signer      string `json:"signer"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+}
+
+// SImageUpload is an autogenerated struct via yunion.io/x/onecloud/pkg/image/models.SImageUpload.
+type SImageUpload struct {
+	SImagePeripheral
+	UploadId  string    `json:"upload_id"`
+	Size      int64     `json:"size"`
+	Offset    int64     `json:"offset"`
+	Checksum  string    `json:"checksum"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
 // SImageSubformat is an autogenerated struct via yunion.io/x/onecloud/pkg/image/models.SImageSubformat.
 type SImageSubformat struct {
 	SImagePeripheral
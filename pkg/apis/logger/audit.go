@@ -0,0 +1,233 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"reflect"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	// RFC5424 syslog, 审计字段以structured data输出
+	AUDIT_SINK_TYPE_SYSLOG = "syslog"
+	// ArcSight Common Event Format, 通过syslog传输
+	AUDIT_SINK_TYPE_CEF = "cef"
+	// JSON lines, 通过HTTP POST批量发送
+	AUDIT_SINK_TYPE_HTTP_JSONL = "http_jsonl"
+	// Kafka, 每条日志一条消息, 以obj_id为key
+	AUDIT_SINK_TYPE_KAFKA = "kafka"
+
+	AUDIT_SINK_STATUS_READY  = "ready"
+	AUDIT_SINK_STATUS_FAILED = "failed"
+)
+
+var AUDIT_SINK_TYPES = []string{
+	AUDIT_SINK_TYPE_SYSLOG,
+	AUDIT_SINK_TYPE_CEF,
+	AUDIT_SINK_TYPE_HTTP_JSONL,
+	AUDIT_SINK_TYPE_KAFKA,
+}
+
+// ActionLogVerifyInput specifies the range of action logs whose hash chain
+// is verified
+type ActionLogVerifyInput struct {
+	// 起始日志ID, 为空时从最早的日志开始
+	StartId int64 `json:"start_id"`
+	// 结束日志ID, 为空时到最新的日志为止
+	EndId int64 `json:"end_id"`
+	// 最多校验的日志数量
+	Limit int `json:"limit"`
+}
+
+type ActionLogChainBreak struct {
+	// 日志ID
+	Id int64 `json:"id"`
+	// 前一条日志ID
+	PrevId int64 `json:"prev_id"`
+	// 原因: modified, chain_broken, unhashed, unkeyed, checkpoint_mismatch
+	Reason string `json:"reason"`
+}
+
+const (
+	// 日志内容与哈希值不匹配
+	ACTION_LOG_CHAIN_MODIFIED = "modified"
+	// 日志记录的前序哈希与前一条日志不匹配, 前序日志被删除或修改
+	ACTION_LOG_CHAIN_BROKEN = "chain_broken"
+	// 哈希链开始后出现了未计算哈希的日志
+	ACTION_LOG_CHAIN_UNHASHED = "unhashed"
+	// 哈希链使用密钥后出现了未使用密钥计算哈希的日志
+	ACTION_LOG_CHAIN_UNKEYED = "unkeyed"
+	// 日志与外部保存的检查点不一致, 日志被删除或哈希被重新计算
+	ACTION_LOG_CHAIN_CHECKPOINT_MISMATCH = "checkpoint_mismatch"
+)
+
+type ActionLogVerifyOutput struct {
+	// 是否校验通过
+	Valid bool `json:"valid"`
+	// 已校验日志数量
+	Checked int `json:"checked"`
+	// 哈希链开始之前的历史日志数量, 这些日志不参与校验
+	Unchained int   `json:"unchained"`
+	FirstId   int64 `json:"first_id"`
+	LastId    int64 `json:"last_id"`
+	// 最后一条日志的哈希值, 可以保存在外部作为下次校验的锚点
+	LastHash string `json:"last_hash"`
+	// 参与校验的外部检查点日志ID, 未配置检查点时为0
+	CheckpointId int64 `json:"checkpoint_id"`
+	// 校验失败的日志数量
+	BrokenCount int `json:"broken_count"`
+	// 校验失败的日志, 最多返回100条
+	Broken []ActionLogChainBreak `json:"broken"`
+}
+
+// AuditSinkFilter selects the action logs exported to an audit sink, empty
+// fields match all
+type AuditSinkFilter struct {
+	Services   []string `json:"services"`
+	Actions    []string `json:"actions"`
+	ObjTypes   []string `json:"obj_types"`
+	Severities []string `json:"severities"`
+	Kinds      []string `json:"kinds"`
+	// 仅导出成功(true)或失败(false)的日志
+	Success *bool `json:"success"`
+}
+
+func (f AuditSinkFilter) String() string {
+	return jsonutils.Marshal(f).String()
+}
+
+func (f AuditSinkFilter) IsZero() bool {
+	return len(f.Services) == 0 && len(f.Actions) == 0 && len(f.ObjTypes) == 0 &&
+		len(f.Severities) == 0 && len(f.Kinds) == 0 && f.Success == nil
+}
+
+type AuditSinkConfig struct {
+	// syslog APP-NAME, 默认cloudaudit
+	AppName string `json:"app_name"`
+	// syslog facility, 默认13(log audit)
+	Facility *int `json:"facility"`
+	// RFC5424 structured data ID, 默认cloudaudit@32473
+	SdId string `json:"sd_id"`
+	// HTTP请求头, 例如Authorization
+	Headers map[string]string `json:"headers"`
+	// Kafka topic
+	Topic string `json:"topic"`
+	// 不校验TLS证书
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+	// 每批导出的日志数量, 默认100
+	BatchSize int `json:"batch_size"`
+}
+
+func (c AuditSinkConfig) String() string {
+	return jsonutils.Marshal(c).String()
+}
+
+func (c AuditSinkConfig) IsZero() bool {
+	return len(c.AppName) == 0 && c.Facility == nil && len(c.SdId) == 0 && len(c.Headers) == 0 &&
+		len(c.Topic) == 0 && !c.InsecureSkipVerify && c.BatchSize == 0
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&AuditSinkFilter{}), func() gotypes.ISerializable {
+		return &AuditSinkFilter{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&AuditSinkConfig{}), func() gotypes.ISerializable {
+		return &AuditSinkConfig{}
+	})
+}
+
+type AuditSinkCreateInput struct {
+	apis.EnabledStatusStandaloneResourceCreateInput
+
+	// 导出类型
+	// enum: syslog, cef, http_jsonl, kafka
+	// required: true
+	Type string `json:"type"`
+	// 导出地址
+	// syslog和cef: tcp://host:514, udp://host:514, tls://host:6514
+	// http_jsonl: http(s)://host/path
+	// kafka: kafka://broker1:9092,broker2:9092
+	// required: true
+	Url string `json:"url"`
+
+	Config *AuditSinkConfig `json:"config"`
+	Filter *AuditSinkFilter `json:"filter"`
+
+	// 从最早的日志开始导出, 默认只导出创建之后的日志
+	FromBeginning bool `json:"from_beginning"`
+}
+
+type AuditSinkUpdateInput struct {
+	apis.EnabledStatusStandaloneResourceBaseUpdateInput
+
+	Url    string           `json:"url"`
+	Config *AuditSinkConfig `json:"config"`
+	Filter *AuditSinkFilter `json:"filter"`
+}
+
+type AuditSinkListInput struct {
+	apis.EnabledStatusStandaloneResourceListInput
+
+	// 以导出类型过滤
+	Type []string `json:"type"`
+}
+
+type AuditSinkDetails struct {
+	apis.EnabledStatusStandaloneResourceDetails
+}
+
+type AuditSinkResetCursorInput struct {
+	// 从该日志ID之后重新导出
+	ActionId int64 `json:"action_id"`
+	// 从该管理员日志ID之后重新导出
+	AdminActionId int64 `json:"admin_action_id"`
+}
+
+// AuditRecord is the exported form of an action log
+type AuditRecord struct {
+	Id              int64          `json:"id"`
+	OpsTime         time.Time      `json:"ops_time"`
+	StartTime       time.Time      `json:"start_time"`
+	Service         string         `json:"service"`
+	Action          string         `json:"action"`
+	ObjType         string         `json:"obj_type"`
+	ObjId           string         `json:"obj_id"`
+	ObjName         string         `json:"obj_name"`
+	Notes           string         `json:"notes"`
+	Success         bool           `json:"success"`
+	Severity        TEventSeverity `json:"severity"`
+	Kind            TEventKind     `json:"kind"`
+	UserId          string         `json:"user_id"`
+	User            string         `json:"user"`
+	DomainId        string         `json:"domain_id"`
+	Domain          string         `json:"domain"`
+	ProjectId       string         `json:"tenant_id"`
+	Project         string         `json:"tenant"`
+	ProjectDomainId string         `json:"project_domain_id"`
+	ProjectDomain   string         `json:"project_domain"`
+	OwnerProjectId  string         `json:"owner_tenant_id"`
+	OwnerDomainId   string         `json:"owner_domain_id"`
+	Roles           string         `json:"roles"`
+	Ip              string         `json:"ip"`
+	// 是否为管理员日志
+	Admin    bool   `json:"admin"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
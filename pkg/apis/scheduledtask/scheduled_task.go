@@ -15,8 +15,12 @@
 package scheduledtask
 
 import (
+	"reflect"
 	"time"
 
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/gotypes"
+
 	"yunion.io/x/onecloud/pkg/apis"
 )
 
@@ -30,6 +34,8 @@ type ScheduledTaskDetails struct {
 	Timer TimerDetails `json:"timer"`
 	// 周期方式触发
 	CycleTimer CycleTimerDetails `json:"cycle_timer"`
+	// cron表达式方式触发
+	CronTimer CronTimerDetails `json:"cron_timer"`
 	// 绑定的所有标示
 	Labels       []string      `json:"labels,allowempty"`
 	LabelDetails []LabelDetail `json:"label_details,allowempty"`
@@ -57,6 +63,19 @@ type CycleTimerDetails struct {
 	EndTime time.Time `json:"end_time"`
 }
 
+type CronTimerDetails struct {
+	// description: cron表达式
+	Expression string `json:"expression"`
+	// description: 时区
+	Timezone string `json:"timezone"`
+	// description: 下次执行时间
+	NextTime time.Time `json:"next_time"`
+	// description: 此周期任务的开始时间
+	StartTime time.Time `json:"start_time"`
+	// description: 此周期任务的截止时间
+	EndTime time.Time `json:"end_time"`
+}
+
 type LabelDetail struct {
 	Label        string    `json:"label"`
 	IsolatedTime time.Time `json:"isolated_time"`
@@ -68,7 +87,7 @@ type ScheduledTaskListInput struct {
 
 	// description: resource type
 	// example: server
-	// enum: server
+	// enum: server,cloudaccount,disk,dbinstance,elasticcache
 	ResourceType string `json:"resource_type"`
 
 	// description: label type
@@ -81,7 +100,7 @@ type ScheduledTaskListInput struct {
 
 	// description: operation
 	// example: stop
-	// enum: start,stop,restart
+	// enum: start,stop,restart,sync,snapshot,change_config,run_script
 	Operation string `json:"operation"`
 }
 
@@ -90,20 +109,23 @@ type ScheduledTaskCreateInput struct {
 	apis.EnabledBaseResourceCreateInput
 
 	// description: scheduled type
-	// enum: cycle,timing
+	// enum: cycle,timing,cron
 	// example: timing
 	ScheduledType string                `json:"scheduled_type"`
 	Timer         TimerCreateInput      `json:"timer"`
 	CycleTimer    CycleTimerCreateInput `json:"cycle_timer"`
+	CronTimer     CronTimerCreateInput  `json:"cron_timer"`
 
 	// description: resource type
-	// enum: server
+	// enum: server,cloudaccount,disk,dbinstance,elasticcache
 	// example: server
 	ResourceType string `json:"resource_type"`
 	// description: operation
-	// enum: start,stop,restart
+	// enum: start,stop,restart,sync,snapshot,change_config,run_script
 	// example: stop
 	Operation string `json:"operation"`
+	// description: operation params, required by snapshot, change_config and run_script
+	OperationParams *ScheduledTaskOperationParams `json:"operation_params"`
 	// description: label type
 	// enum: tag,id
 	// example: id
@@ -148,6 +170,81 @@ type CycleTimerCreateInput struct {
 	EndTime time.Time `json:"end_time"`
 }
 
+type CronTimerCreateInput struct {
+
+	// description: 标准cron表达式(分 时 日 月 周), 支持@daily等宏
+	// example: 0 9 * * 1-5
+	Expression string `json:"expression"`
+
+	// description: 时区, 默认为UTC
+	// example: Asia/Shanghai
+	Timezone string `json:"timezone"`
+
+	// description: 开始时间
+	StartTime time.Time `json:"start_time"`
+
+	// description: 截止时间, 为空表示不限
+	EndTime time.Time `json:"end_time"`
+}
+
+type ScheduledTaskOperationParams struct {
+	// description: snapshot: 保留由此定时任务创建的快照个数, 0表示不清理
+	// example: 7
+	SnapshotRetention int `json:"snapshot_retention,omitzero"`
+	// description: snapshot: 主机快照是否包含内存
+	WithMemory bool `json:"with_memory,omitfalse"`
+
+	// description: change_config: 实例类型, 优先级高于vcpu_count和vmem_size
+	InstanceType string `json:"instance_type,omitempty"`
+	// description: change_config: cpu大小
+	VcpuCount int `json:"vcpu_count,omitzero"`
+	// description: change_config: 内存大小, 1024M, 1G
+	VmemSize string `json:"vmem_size,omitempty"`
+	// description: change_config: 调整完配置后是否自动启动
+	AutoStart bool `json:"auto_start,omitfalse"`
+
+	// description: run_script: devtool脚本ID或名称
+	ScriptId string `json:"script_id,omitempty"`
+}
+
+func (p ScheduledTaskOperationParams) String() string {
+	return jsonutils.Marshal(p).String()
+}
+
+func (p ScheduledTaskOperationParams) IsZero() bool {
+	return p == ScheduledTaskOperationParams{}
+}
+
+type ScheduledTaskActivityResult struct {
+	// description: 资源ID
+	Id string `json:"id"`
+	// description: 资源名称
+	Name string `json:"name"`
+	// description: 是否执行成功
+	Succeed bool `json:"succeed"`
+	// description: 失败原因
+	Reason string `json:"reason,omitempty"`
+}
+
+type ScheduledTaskActivityResults []ScheduledTaskActivityResult
+
+func (rs ScheduledTaskActivityResults) String() string {
+	return jsonutils.Marshal(rs).String()
+}
+
+func (rs ScheduledTaskActivityResults) IsZero() bool {
+	return len(rs) == 0
+}
+
+func init() {
+	gotypes.RegisterSerializable(reflect.TypeOf(&ScheduledTaskOperationParams{}), func() gotypes.ISerializable {
+		return &ScheduledTaskOperationParams{}
+	})
+	gotypes.RegisterSerializable(reflect.TypeOf(&ScheduledTaskActivityResults{}), func() gotypes.ISerializable {
+		return &ScheduledTaskActivityResults{}
+	})
+}
+
 type ScheduledTaskResourceInfo struct {
 	// description: 定时任务名称
 	// example: st-nihao
@@ -17,18 +17,29 @@ package scheduledtask
 const (
 	ST_TYPE_TIMING = "timing" // 定时
 	ST_TYPE_CYCLE  = "cycle"  // 周期
+	ST_TYPE_CRON   = "cron"   // cron表达式
 
 	ST_STATUS_READY         = "ready"
 	ST_STATUS_CREATE_FAILED = "create_failed"
 
 	ST_RESOURCE_SERVER       = "server"
 	ST_RESOURCE_CLOUDACCOUNT = "cloudaccount"
+	ST_RESOURCE_DISK         = "disk"
+	ST_RESOURCE_DBINSTANCE   = "dbinstance"
+	ST_RESOURCE_ELASTICCACHE = "elasticcache"
 
 	ST_RESOURCE_OPERATION_START   = "start"
 	ST_RESOURCE_OPERATION_STOP    = "stop"
 	ST_RESOURCE_OPERATION_RESTART = "restart"
 	ST_RESOURCE_OPERATION_SYNC    = "sync"
 
+	ST_RESOURCE_OPERATION_SNAPSHOT      = "snapshot"
+	ST_RESOURCE_OPERATION_CHANGE_CONFIG = "change_config"
+	ST_RESOURCE_OPERATION_RUN_SCRIPT    = "run_script"
+
+	// 记录创建快照的定时任务ID的元数据
+	ST_METADATA_SCHEDULED_TASK_ID = "__scheduled_task_id"
+
 	ST_LABEL_ID  = "id"
 	ST_LABEL_TAG = "tag"
 
@@ -42,4 +53,5 @@ const (
 	TIMER_TYPE_DAY   = "day"
 	TIMER_TYPE_WEEK  = "week"
 	TIMER_TYPE_MONTH = "month"
+	TIMER_TYPE_CRON  = "cron"
 )
@@ -29,6 +29,8 @@ type SScheduledTask struct {
 	ResourceType string `json:"resource_type"`
 	Operation    string `json:"operation"`
 	LabelType    string `json:"label_type"`
+
+	OperationParams *ScheduledTaskOperationParams `json:"operation_params"`
 }
 
 // SScheduledTaskActivity is an autogenerated struct via yunion.io/x/onecloud/pkg/scheduledtask/models.SScheduledTaskActivity.
@@ -38,6 +40,8 @@ type SScheduledTaskActivity struct {
 	StartTime       time.Time `json:"start_time"`
 	EndTime         time.Time `json:"end_time"`
 	Reason          string    `json:"reason"`
+	// Results records the result of every target resource
+	Results *ScheduledTaskActivityResults `json:"results"`
 }
 
 // SScheduledTaskLabel is an autogenerated struct via yunion.io/x/onecloud/pkg/scheduledtask/models.SScheduledTaskLabel.
@@ -59,5 +63,9 @@ type STimer struct {
 	WeekDays byte `json:"week_days"`
 	// 0-31 0 is unlimited
 	MonthDays uint32 `json:"month_days"`
+	// standard cron expression of cron timer
+	CronExpr string `json:"cron_expr"`
+	// IANA time zone name in which CronExpr is evaluated, empty is UTC
+	Timezone  string `json:"timezone"`
 	IsExpired bool   `json:"is_expired"`
 }
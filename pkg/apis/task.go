@@ -0,0 +1,25 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apis
+
+const (
+	// 任务回调中携带的阶段执行序号, 与任务当前序号不一致的回调会被忽略
+	TASK_STAGE_ATTEMPT_KEY = "__stage_attempt__"
+)
+
+type TaskCancelInput struct {
+	// 取消原因
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,32 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webconsole
+
+import (
+	"yunion.io/x/onecloud/pkg/apis"
+)
+
+const (
+	SESSION_RECORDING_STORAGE_LOCAL  = "local"
+	SESSION_RECORDING_STORAGE_OBJECT = "object"
+)
+
+type SessionRecordingListInput struct {
+	apis.Meta
+	apis.OpsLogListInput
+
+	// description: filter recordings by webconsole session id
+	SessionId []string `json:"session_id"`
+}
@@ -43,6 +43,9 @@ const (
 	APP_CONTEXT_KEY_START_TIME      = AppContextKey("starttime")
 	APP_CONTEXT_KEY_TASKNAME        = AppContextKey("taskname")
 
+	// attempt of the task stage which sent the request
+	APP_CONTEXT_KEY_TASK_STAGE_ATTEMPT = AppContextKey("taskstageattempt")
+
 	APP_CONTEXT_KEY_HOST_ID = AppContextKey("hostid")
 
 	APP_CONTEXT_KEY_AUTH_TOKEN = AppContextKey("X_AUTH_TOKEN")
@@ -124,6 +127,15 @@ func AppContextTaskId(ctx context.Context) string {
 	}
 }
 
+func AppContextTaskStageAttempt(ctx context.Context) string {
+	val := ctx.Value(APP_CONTEXT_KEY_TASK_STAGE_ATTEMPT)
+	if val != nil {
+		return val.(string)
+	} else {
+		return ""
+	}
+}
+
 func AppContextTaskNotifyUrl(ctx context.Context) string {
 	val := ctx.Value(APP_CONTEXT_KEY_TASK_NOTIFY_URL)
 	if val != nil {
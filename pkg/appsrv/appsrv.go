@@ -225,9 +225,11 @@ func (app *Application) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	} else {
 		counter = &hi.counter5XX
 	}
-	duration := float64(time.Since(start).Nanoseconds()) / 1000000
+	elapsed := time.Since(start)
+	duration := float64(elapsed.Nanoseconds()) / 1000000
 	counter.hit += 1
 	counter.duration += duration
+	observeRequest(app, hi, r.Method, lrw.status, elapsed)
 	skipLog := false
 	if params != nil {
 		if params.SkipLog {
@@ -400,6 +402,7 @@ func (app *Application) addDefaultHandlers() {
 	app.AddDefaultHandler("POST", "/ping", PingHandler, "ping")
 	app.AddDefaultHandler("GET", "/ping", PingHandler, "ping")
 	app.AddDefaultHandler("GET", "/worker_stats", WorkerStatsHandler, "worker_stats")
+	app.AddDefaultHandler("GET", "/metrics", MetricsHandler, "metrics")
 }
 
 func timeoutHandle(h http.Handler) http.HandlerFunc {
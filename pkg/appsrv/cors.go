@@ -496,7 +496,7 @@ func (app *Application) CORSAllowHosts(hosts []string) {
 		AllowedOrigins:   hosts,
 		AllowedMethods:   []string{"HEAD", "GET", "POST", "PUT", "PATCH", "DELETE"},
 		AllowedHeaders:   []string{"*"},
-		ExposedHeaders:   []string{"Authorization"},
+		ExposedHeaders:   []string{"Authorization", "ETag"},
 		AllowCredentials: true,
 		// Debug: true,
 	}
@@ -506,3 +506,9 @@ func (app *Application) CORSAllowHosts(hosts []string) {
 func (app *Application) EnableCORS(options CorsOptions) {
 	app.cors = NewCors(options)
 }
+
+// DisableCORS turns off the application wide CORS handling, for services
+// which decide CORS policy by themselves
+func (app *Application) DisableCORS() {
+	app.cors = nil
+}
@@ -254,12 +254,24 @@ func headHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	}()
 
 	manager, params, query, _ := fetchEnv(ctx, w, r)
-	_, err := manager.Get(ctx, params["<resid>"], mergeQueryParams(params, query, "<resid>"), true)
+	result, err := manager.Get(ctx, params["<resid>"], mergeQueryParams(params, query, "<resid>"), true)
 	if err != nil {
 		jsonErr := httperrors.NewGeneralError(err)
 		httperrors.SendHTTPErrorHeader(w, jsonErr.Code)
 		return
 	}
+	setETag(w, result)
+}
+
+// setETag sets ETag header by update_version of the resource, which is
+// expected in If-Match header of later update requests
+func setETag(w http.ResponseWriter, result jsonutils.JSONObject) {
+	if result == nil {
+		return
+	}
+	if version, err := result.Int("update_version"); err == nil {
+		w.Header().Set("ETag", appsrv.VersionETag(int(version)))
+	}
 }
 
 func sendJSON(ctx context.Context, w http.ResponseWriter, result jsonutils.JSONObject, keyword string) {
@@ -282,6 +294,7 @@ func getHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if result != nil {
+		setETag(w, result)
 		sendJSON(ctx, w, result, manager.Keyword())
 	}
 }
@@ -418,6 +431,7 @@ func performActionHandler(ctx context.Context, w http.ResponseWriter, r *http.Re
 		httperrors.GeneralServerError(ctx, w, err)
 		return
 	}
+	setETag(w, result)
 	sendJSON(ctx, w, result, manager.Keyword())
 	// appsrv.SendJSON(w, wrapBody(result, manager.Keyword()))
 }
@@ -452,6 +466,7 @@ func handleUpdate(ctx context.Context, w http.ResponseWriter, manager IModelDisp
 		httperrors.GeneralServerError(ctx, w, err)
 		return
 	}
+	setETag(w, result)
 	sendJSON(ctx, w, result, manager.Keyword())
 	// appsrv.SendJSON(w, wrapBody(result, manager.Keyword()))
 }
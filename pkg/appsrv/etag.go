@@ -0,0 +1,79 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// VersionETag returns the entity tag of a resource at update_version
+// version
+func VersionETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// IfMatchVersion reports whether the If-Match header value ifMatch matches
+// version.  Empty value matches any version as no precondition is set.
+// Weak tags are compared as strong ones for leniency
+func IfMatchVersion(ifMatch string, version int) bool {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+	want := VersionETag(version)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		tag = strings.TrimPrefix(tag, "W/")
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseVersionETag parses update_version from the If-Match header value
+// ifMatch, which is expected to be a single tag returned by VersionETag.
+// ok is false if no version is given, i.e. the value is empty or *
+func ParseVersionETag(ifMatch string) (version int, ok bool, err error) {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, false, nil
+	}
+	tag := strings.TrimPrefix(ifMatch, "W/")
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid entity tag %s", ifMatch)
+	}
+	version, err = strconv.Atoi(unquoted)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "invalid entity tag %s", ifMatch)
+	}
+	return version, true, nil
+}
+
+// AppContextIfMatch returns If-Match header value of the request being
+// served
+func AppContextIfMatch(ctx context.Context) string {
+	appParams := AppContextGetParams(ctx)
+	if appParams == nil || appParams.Request == nil {
+		return ""
+	}
+	return appParams.Request.Header.Get("If-Match")
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"testing"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	if got := VersionETag(3); got != `"3"` {
+		t.Errorf("VersionETag(3) want %q, got %q", `"3"`, got)
+	}
+	cases := []struct {
+		ifMatch string
+		version int
+		want    bool
+	}{
+		{"", 3, true},
+		{"*", 3, true},
+		{`"3"`, 3, true},
+		{`W/"3"`, 3, true},
+		{`"1", "3"`, 3, true},
+		{`"2"`, 3, false},
+		{`3`, 3, false},
+		{`"30"`, 3, false},
+	}
+	for _, c := range cases {
+		if got := IfMatchVersion(c.ifMatch, c.version); got != c.want {
+			t.Errorf("IfMatchVersion(%q, %d) want %v, got %v", c.ifMatch, c.version, c.want, got)
+		}
+	}
+}
+
+func TestParseVersionETag(t *testing.T) {
+	cases := []struct {
+		ifMatch string
+		version int
+		ok      bool
+		wantErr bool
+	}{
+		{"", 0, false, false},
+		{"*", 0, false, false},
+		{`"3"`, 3, true, false},
+		{`W/"3"`, 3, true, false},
+		{`3`, 0, false, true},
+		{`"a"`, 0, false, true},
+		{`"1", "3"`, 0, false, true},
+	}
+	for _, c := range cases {
+		version, ok, err := ParseVersionETag(c.ifMatch)
+		if (err != nil) != c.wantErr || ok != c.ok || version != c.version {
+			t.Errorf("ParseVersionETag(%q) want %d %v %v, got %d %v %v", c.ifMatch, c.version, c.ok, c.wantErr, version, ok, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "onecloud"
+
+var (
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of http requests served by appsrv handlers.",
+			Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"service", "handler", "method", "code"},
+	)
+
+	workerQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "queue_length"),
+		"Number of tasks waiting in the queue of worker manager.",
+		[]string{"worker"}, nil,
+	)
+	workerActiveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "active"),
+		"Number of busy workers of worker manager.",
+		[]string{"worker"}, nil,
+	)
+	workerDetachedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "detached"),
+		"Number of workers detached from worker manager by long running tasks.",
+		[]string{"worker"}, nil,
+	)
+	workerMaxDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "worker", "max"),
+		"Max number of workers of worker manager.",
+		[]string{"worker"}, nil,
+	)
+
+	dbMaxOpenDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "max_open_connections"),
+		"Maximum number of open connections to the database.",
+		[]string{"db"}, nil,
+	)
+	dbOpenDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "open_connections"),
+		"Number of established connections both in use and idle.",
+		[]string{"db"}, nil,
+	)
+	dbInUseDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "in_use_connections"),
+		"Number of connections currently in use.",
+		[]string{"db"}, nil,
+	)
+	dbIdleDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "idle_connections"),
+		"Number of idle connections.",
+		[]string{"db"}, nil,
+	)
+	dbWaitCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "wait_count_total"),
+		"Total number of connections waited for.",
+		[]string{"db"}, nil,
+	)
+	dbWaitDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "db", "wait_duration_seconds_total"),
+		"Total time blocked waiting for a new connection.",
+		[]string{"db"}, nil,
+	)
+
+	dbStatsLock    = &sync.Mutex{}
+	dbStatsSources = map[string]*sql.DB{}
+)
+
+func init() {
+	prometheus.MustRegister(requestDuration, &sWorkerCollector{}, &sDBStatsCollector{})
+}
+
+func observeRequest(app *Application, hi *SHandlerInfo, method string, status int, duration time.Duration) {
+	name := hi.GetName(nil)
+	if len(name) == 0 {
+		name = "default"
+	}
+	requestDuration.WithLabelValues(app.name, name, method, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// sWorkerCollector collects states of all worker managers, managers of the same name are summed up
+type sWorkerCollector struct{}
+
+func (c *sWorkerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- workerQueueDesc
+	ch <- workerActiveDesc
+	ch <- workerDetachedDesc
+	ch <- workerMaxDesc
+}
+
+func (c *sWorkerCollector) Collect(ch chan<- prometheus.Metric) {
+	workerManagerLock.Lock()
+	managers := make([]*SWorkerManager, len(workerManagers))
+	copy(managers, workerManagers)
+	workerManagerLock.Unlock()
+
+	names := []string{}
+	states := map[string]*SWorkerManagerStates{}
+	for i := range managers {
+		state := managers[i].getState()
+		total, ok := states[state.Name]
+		if !ok {
+			names = append(names, state.Name)
+			states[state.Name] = &state
+			continue
+		}
+		total.QueueCnt += state.QueueCnt
+		total.ActiveWorkerCnt += state.ActiveWorkerCnt
+		total.DetachWorkerCnt += state.DetachWorkerCnt
+		total.MaxWorkerCnt += state.MaxWorkerCnt
+	}
+	for _, name := range names {
+		state := states[name]
+		ch <- prometheus.MustNewConstMetric(workerQueueDesc, prometheus.GaugeValue, float64(state.QueueCnt), name)
+		ch <- prometheus.MustNewConstMetric(workerActiveDesc, prometheus.GaugeValue, float64(state.ActiveWorkerCnt), name)
+		ch <- prometheus.MustNewConstMetric(workerDetachedDesc, prometheus.GaugeValue, float64(state.DetachWorkerCnt), name)
+		ch <- prometheus.MustNewConstMetric(workerMaxDesc, prometheus.GaugeValue, float64(state.MaxWorkerCnt), name)
+	}
+}
+
+// RegisterDBStats exports connection pool stats of db in metrics under name
+func RegisterDBStats(name string, db *sql.DB) {
+	dbStatsLock.Lock()
+	defer dbStatsLock.Unlock()
+
+	dbStatsSources[name] = db
+}
+
+type sDBStatsCollector struct{}
+
+func (c *sDBStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpenDesc
+	ch <- dbOpenDesc
+	ch <- dbInUseDesc
+	ch <- dbIdleDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+}
+
+func (c *sDBStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	dbStatsLock.Lock()
+	defer dbStatsLock.Unlock()
+
+	for name, db := range dbStatsSources {
+		stats := db.Stats()
+		ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections), name)
+		ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(stats.InUse), name)
+		ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(stats.Idle), name)
+		ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount), name)
+		ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds(), name)
+	}
+}
+
+var metricsHandler = promhttp.Handler()
+
+// MetricsHandler exports metrics in the default prometheus registry,
+// which also includes metrics registered by other packages like lockman
+func MetricsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package appsrv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	NewWorkerManager("metricstestwm", 3, 10, false)
+	NewWorkerManager("metricstestwm", 2, 10, false)
+
+	app := &Application{name: "metricstest"}
+	hi := newHandlerInfo("GET", []string{"servers", "<resid>"}, nil, nil, "", nil)
+	observeRequest(app, hi, "GET", http.StatusNotFound, 20*time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	rec := httptest.NewRecorder()
+	MetricsHandler(context.Background(), rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expect 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`onecloud_http_request_duration_seconds_count{code="404",handler="get_servers_<resid>",method="GET",service="metricstest"} 1`,
+		`onecloud_worker_max{worker="metricstestwm"} 5`,
+		`onecloud_worker_queue_length{worker="metricstestwm"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metric %q not found", want)
+		}
+	}
+}
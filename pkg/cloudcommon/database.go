@@ -27,6 +27,7 @@ import (
 	"yunion.io/x/sqlchemy"
 
 	noapi "yunion.io/x/onecloud/pkg/apis/notify"
+	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
@@ -82,6 +83,7 @@ func InitDB(options *common_options.DBOptions) {
 		panic(err)
 	}
 	sqlchemy.SetDBWithNameBackend(dbConn, sqlchemy.DefaultDB, backend)
+	appsrv.RegisterDBStats("default", dbConn)
 
 	dialect, sqlStr, err = options.GetClickhouseConnStr()
 	if err == nil {
@@ -100,6 +102,7 @@ func InitDB(options *common_options.DBOptions) {
 			panic(err)
 		}
 		sqlchemy.SetDBWithNameBackend(click, db.ClickhouseDB, sqlchemy.ClickhouseBackend)
+		appsrv.RegisterDBStats("clickhouse", click)
 
 		if options.OpsLogWithClickhouse {
 			consts.OpsLogWithClickhouse = true
@@ -1530,6 +1530,11 @@ func (dispatcher *DBModelDispatcher) PerformAction(ctx context.Context, idStr st
 	lockman.LockObject(ctx, model)
 	defer lockman.ReleaseObject(ctx, model)
 
+	model, err = checkIfMatch(ctx, manager, userCred, idStr, model)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := model.PreCheckPerformAction(ctx, userCred, action, query, data); err != nil {
 		return nil, err
 	}
@@ -1717,15 +1722,43 @@ func (dispatcher *DBModelDispatcher) Update(ctx context.Context, idStr string, q
 			return nil, httperrors.NewGeneralError(err)
 		}
 
+		model, err = checkIfMatch(ctx, manager, userCred, idStr, model)
+		if err != nil {
+			return nil, err
+		}
 		return model.UpdateInContext(ctx, userCred, ctxObjs, query, data)
 	} else {
 		lockman.LockObject(ctx, model)
 		defer lockman.ReleaseObject(ctx, model)
 
+		model, err = checkIfMatch(ctx, manager, userCred, idStr, model)
+		if err != nil {
+			return nil, err
+		}
 		return updateItem(manager, model, ctx, userCred, query, data)
 	}
 }
 
+// checkIfMatch fails with 412 when update_version of the object does not
+// match the If-Match header of the request.  The object is fetched again
+// to get the version after the lock is held
+func checkIfMatch(ctx context.Context, manager IModelManager, userCred mcclient.TokenCredential, idStr string, model IModel) (IModel, error) {
+	ifMatch := appsrv.AppContextIfMatch(ctx)
+	if ifMatch == "" {
+		return model, nil
+	}
+	model, err := fetchItem(manager, ctx, userCred, idStr, nil)
+	if err == sql.ErrNoRows {
+		return nil, httperrors.NewResourceNotFoundError2(manager.Keyword(), idStr)
+	} else if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	if version := model.GetUpdateVersion(); !appsrv.IfMatchVersion(ifMatch, version) {
+		return nil, httperrors.NewPreconditionFailedError("%s %s has been modified, current version %d", manager.Keyword(), idStr, version)
+	}
+	return model, nil
+}
+
 func (dispatcher *DBModelDispatcher) UpdateSpec(ctx context.Context, idStr string, spec string, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	userCred := fetchUserCredential(ctx)
 	manager := dispatcher.manager.GetMutableInstance(ctx, userCred, query, data)
@@ -17,6 +17,9 @@ package lockman
 import (
 	"context"
 	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type ILockedClass interface {
@@ -68,6 +71,25 @@ func getJointObjectKey(model ILockedObject, model2 ILockedObject) string {
 
 var _lockman ILockManager
 
+var lockWaitDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "onecloud",
+		Subsystem: "lockman",
+		Name:      "lock_wait_seconds",
+		Help:      "Time spent waiting to acquire locks of lockman.",
+		Buckets:   []float64{.0001, .001, .01, .05, .1, .5, 1, 5, 10, 30, 60},
+	},
+	[]string{"kind"},
+)
+
+func init() {
+	prometheus.MustRegister(lockWaitDuration)
+}
+
+func observeLockWait(kind string, start time.Time) {
+	lockWaitDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+}
+
 func Init(man ILockManager) {
 	_lockman = man
 }
@@ -84,6 +106,7 @@ func checkContext(ctx context.Context) {
 
 func LockClass(ctx context.Context, manager ILockedClass, projectId string) {
 	checkContext(ctx)
+	defer observeLockWait("class", time.Now())
 	_lockman.LockClass(ctx, manager, projectId)
 }
 
@@ -94,6 +117,7 @@ func ReleaseClass(ctx context.Context, manager ILockedClass, projectId string) {
 
 func LockObject(ctx context.Context, model ILockedObject) {
 	checkContext(ctx)
+	defer observeLockWait("object", time.Now())
 	_lockman.LockObject(ctx, model)
 }
 
@@ -104,6 +128,7 @@ func ReleaseObject(ctx context.Context, model ILockedObject) {
 
 func LockRawObject(ctx context.Context, resName string, resId string) {
 	checkContext(ctx)
+	defer observeLockWait("raw_object", time.Now())
 	_lockman.LockRawObject(ctx, resName, resId)
 }
 
@@ -114,6 +139,7 @@ func ReleaseRawObject(ctx context.Context, resName string, resId string) {
 
 func LockJointObject(ctx context.Context, model ILockedObject, model2 ILockedObject) {
 	checkContext(ctx)
+	defer observeLockWait("joint_object", time.Now())
 	_lockman.LockJointObject(ctx, model, model2)
 }
 
@@ -522,11 +522,46 @@ func (manager *SMetadataManager) SetValuesWithLog(ctx context.Context, obj IMode
 		return err
 	}
 	if len(changes) > 0 {
+		bumpUpdateVersion(obj, changes)
 		OpsLog.LogEvent(obj.GetIModel(), ACT_SET_METADATA, jsonutils.Marshal(changes), userCred)
 	}
 	return nil
 }
 
+// bumpUpdateVersion increases update_version of obj whose user visible
+// metadata changed, so that the ETag derived from update_version changes as
+// well. Changes of system keys (prefixed by __) are internal bookkeeping and
+// do not bump the version.
+func bumpUpdateVersion(obj IModel, changes []sMetadataChange) {
+	visible := false
+	for _, change := range changes {
+		if !IsMetadataKeySysTag(change.Key) {
+			visible = true
+			break
+		}
+	}
+	if !visible {
+		return
+	}
+	manager := obj.GetModelManager()
+	if manager == nil {
+		return
+	}
+	ts := manager.TableSpec().GetTableSpec()
+	if ts.ColumnSpec(COLUMN_UPDATE_VERSION) == nil || ts.ColumnSpec("id") == nil {
+		return
+	}
+	_, err := ts.Database().Exec(
+		fmt.Sprintf(
+			"update `%s` set `%s` = `%s` + 1 where `id` = ?",
+			ts.Name(), COLUMN_UPDATE_VERSION, COLUMN_UPDATE_VERSION,
+		), obj.GetId(),
+	)
+	if err != nil {
+		log.Errorf("bump update_version of %s %s fail %s", obj.Keyword(), obj.GetId(), err)
+	}
+}
+
 func (manager *SMetadataManager) rawSetValues(ctx context.Context, objType string, objId string, store map[string]string, replace bool, replaceRange string) ([]sMetadataChange, error) {
 	idStr := getObjectIdstr(objType, objId)
 
@@ -641,6 +676,7 @@ func (manager *SMetadataManager) SetAll(ctx context.Context, obj IModel, store m
 	}
 
 	if len(changes) > 0 {
+		bumpUpdateVersion(obj, changes)
 		OpsLog.LogEvent(obj.GetIModel(), ACT_SET_METADATA, jsonutils.Marshal(changes), userCred)
 	}
 	return nil
@@ -83,6 +83,8 @@ const (
 	ACT_PROBE             = "probe"
 	ACT_PROBE_FAIL        = "probe_fail"
 	ACT_IMAGE_DELETE_FAIL = "delete_fail"
+	ACT_EXPORT_OCI        = "export_oci"
+	ACT_EXPORT_OCI_FAIL   = "export_oci_fail"
 
 	ACT_SWITCHED      = "switched"
 	ACT_SWITCH_FAILED = "switch_failed"
@@ -211,6 +213,10 @@ const (
 	ACT_PENDING_DELETE = "pending_delete"
 	ACT_CANCEL_DELETE  = "cancel_delete"
 
+	ACT_TASK_CANCEL  = "task_cancel"
+	ACT_TASK_TIMEOUT = "task_timeout"
+	ACT_TASK_RETRY   = "task_retry"
+
 	// # isolated device (host)
 	ACT_HOST_ATTACH_ISOLATED_DEVICE      = "host_attach_isolated_deivce"
 	ACT_HOST_ATTACH_ISOLATED_DEVICE_FAIL = "host_attach_isolated_deivce_fail"
@@ -303,4 +309,8 @@ const (
 	ACT_ENCRYPT_START = "encrypt_start"
 	ACT_ENCRYPT_FAIL  = "encrypt_fail"
 	ACT_ENCRYPT_DONE  = "encrypted"
+
+	ACT_ADD_SIGNATURE         = "add_signature"
+	ACT_VERIFY_SIGNATURE      = "verify_signature"
+	ACT_VERIFY_SIGNATURE_FAIL = "verify_signature_fail"
 )
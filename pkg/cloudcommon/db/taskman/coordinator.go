@@ -30,6 +30,11 @@ import (
 type BatchTaskStageFunc func(ctx context.Context, objs []db.IStandaloneModel, body jsonutils.JSONObject)
 */
 
+// Besides stages, a task type may define a stage-like OnCancel method, which
+// is called with the same arguments of stages when the task is cancelled or
+// timed out to roll back the status of objects. Without OnCancel, the failed
+// handler of the current stage is called instead.
+
 type IBatchTask interface {
 	OnInit(ctx context.Context, objs []db.IStandaloneModel, body jsonutils.JSONObject)
 	ScheduleRun(data jsonutils.JSONObject) error
@@ -0,0 +1,326 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+func newTaskInstance(taskName string) interface{} {
+	taskType, ok := taskTable[taskName]
+	if !ok {
+		return nil
+	}
+	return reflect.New(taskType).Interface()
+}
+
+func getTaskDeadline(taskName string) ITaskDeadline {
+	if deadline, ok := newTaskInstance(taskName).(ITaskDeadline); ok {
+		return deadline
+	}
+	return nil
+}
+
+func getTaskRetryPolicy(taskName string, stage string) *STaskRetryPolicy {
+	if retry, ok := newTaskInstance(taskName).(ITaskRetryPolicy); ok {
+		policy := retry.GetStageRetryPolicy(stage)
+		if policy != nil && policy.MaxRetries > 0 {
+			return policy
+		}
+	}
+	return nil
+}
+
+func calcTaskDeadline(taskName string) time.Time {
+	if deadline := getTaskDeadline(taskName); deadline != nil {
+		if timeout := deadline.GetTaskTimeout(); timeout > 0 {
+			return time.Now().UTC().Add(timeout)
+		}
+	}
+	return time.Time{}
+}
+
+func calcStageDeadline(taskName string, stage string) time.Time {
+	if deadline := getTaskDeadline(taskName); deadline != nil {
+		if timeout := deadline.GetStageTimeout(stage); timeout > 0 {
+			return time.Now().UTC().Add(timeout)
+		}
+	}
+	return time.Time{}
+}
+
+func (self *STask) IsFinished() bool {
+	return self.Stage == TASK_STAGE_COMPLETE || self.Stage == TASK_STAGE_FAILED
+}
+
+// getPrevStage returns the stage which switched the task to current stage
+func (self *STask) getPrevStage() string {
+	stages, _ := self.Params.GetArray("__stages")
+	if len(stages) == 0 {
+		return ""
+	}
+	name, _ := stages[len(stages)-1].GetString("name")
+	return name
+}
+
+func (self *STask) getStageRetries(stage string) int64 {
+	retries, _ := self.Params.Int(STAGE_RETRIES_KEY, stage)
+	return retries
+}
+
+// getStageAttempt returns the attempt of current stage, it is increased by
+// each stage retry and sent with requests of the stage
+func (self *STask) getStageAttempt() int64 {
+	attempt, _ := self.Params.Int(STAGE_ATTEMPT_KEY)
+	if attempt <= 0 {
+		return 1
+	}
+	return attempt
+}
+
+// isStaleCallback checks the stage attempt carried by a callback, the
+// callback of an attempt which has been retried is stale, e.g. the late
+// response of the original request after the stage timed out and retried.
+// Callbacks without attempt are not checked.
+func (self *STask) isStaleCallback(data *jsonutils.JSONDict) bool {
+	if !data.Contains(apis.TASK_STAGE_ATTEMPT_KEY) {
+		return false
+	}
+	attempt, _ := data.Int(apis.TASK_STAGE_ATTEMPT_KEY)
+	data.Remove(apis.TASK_STAGE_ATTEMPT_KEY)
+	return attempt != self.getStageAttempt()
+}
+
+func (self *STask) saveRetryInput(data jsonutils.JSONObject) {
+	_, err := db.Update(self, func() error {
+		params := self.Params.CopyExcludes(RETRY_INPUT_KEY)
+		params.Add(data, RETRY_INPUT_KEY)
+		self.Params = params
+		return nil
+	})
+	if err != nil {
+		log.Errorf("save retry input of task %s fail %s", self.Id, err)
+	}
+}
+
+// retryStage executes the stage which requested current stage again if its
+// retry policy allows, returns false if the failure should be handled as usual
+func (self *STask) retryStage(ctx context.Context, reason jsonutils.JSONObject) bool {
+	prevStage := self.getPrevStage()
+	if len(prevStage) == 0 {
+		return false
+	}
+	policy := getTaskRetryPolicy(self.TaskName, prevStage)
+	if policy == nil {
+		return false
+	}
+	retries := self.getStageRetries(prevStage)
+	if retries >= int64(policy.MaxRetries) {
+		log.Warningf("Task %s(%s) stage %s reaches max retries %d", self.TaskName, self.Id, prevStage, policy.MaxRetries)
+		return false
+	}
+	input, _ := self.Params.Get(RETRY_INPUT_KEY)
+	if input == nil {
+		return false
+	}
+	failedStage := self.Stage
+
+	retriesDict := jsonutils.NewDict()
+	if prev, _ := self.Params.Get(STAGE_RETRIES_KEY); prev != nil {
+		retriesDict.Update(prev)
+	}
+	retriesDict.Set(prevStage, jsonutils.NewInt(retries+1))
+	attempt := self.getStageAttempt() + 1
+	data := jsonutils.NewDict()
+	data.Set(STAGE_RETRIES_KEY, retriesDict)
+	// callbacks of requests sent by previous attempts are ignored from now on
+	data.Set(STAGE_ATTEMPT_KEY, jsonutils.NewInt(attempt))
+	if err := self.SetStage(prevStage, data); err != nil {
+		return false
+	}
+
+	notes := jsonutils.NewDict()
+	notes.Set("task_id", jsonutils.NewString(self.Id))
+	notes.Set("task_name", jsonutils.NewString(self.TaskName))
+	notes.Set("stage", jsonutils.NewString(prevStage))
+	notes.Set("failed_stage", jsonutils.NewString(failedStage))
+	notes.Set("retries", jsonutils.NewInt(retries+1))
+	notes.Set("attempt", jsonutils.NewInt(attempt))
+	if reason != nil {
+		notes.Set("reason", reason)
+	}
+	self.logEvent(ctx, self.GetUserCred(), db.ACT_TASK_RETRY, notes)
+
+	// the retry is persisted and run by FailExpiredTasks, so that it
+	// survives restart of the service
+	_, err := db.Update(self, func() error {
+		self.RetryAt = time.Now().UTC().Add(policy.Interval)
+		self.StageDeadline = time.Time{}
+		return nil
+	})
+	if err != nil {
+		log.Errorf("schedule retry of task %s fail %s", self.Id, err)
+		return false
+	}
+	log.Infof("Task %s(%s) retry stage %s (%d/%d) at %s", self.TaskName, self.Id, prevStage, retries+1, policy.MaxRetries, self.RetryAt)
+	return true
+}
+
+// runRetry executes the stage scheduled by retryStage again
+func (self *STask) runRetry() error {
+	input, _ := self.Params.Get(RETRY_INPUT_KEY)
+	if input == nil {
+		input = jsonutils.NewDict()
+	}
+	_, err := db.Update(self, func() error {
+		self.RetryAt = time.Time{}
+		self.StageDeadline = calcStageDeadline(self.TaskName, self.Stage)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "clear retry time")
+	}
+	return runTask(self.Id, input)
+}
+
+func (self *STask) logEvent(ctx context.Context, userCred mcclient.TokenCredential, action string, notes jsonutils.JSONObject) {
+	manager, ok := db.GetModelManager(self.ObjName).(db.IStandaloneModelManager)
+	if !ok {
+		return
+	}
+	objIds := []string{self.ObjId}
+	if self.ObjId == MULTI_OBJECTS_ID {
+		objIds = TaskObjectManager.GetObjectIds(self)
+	}
+	for _, objId := range objIds {
+		obj, err := manager.FetchById(objId)
+		if err != nil {
+			log.Errorf("fetch %s %s of task %s fail %s", self.ObjName, objId, self.Id, err)
+			continue
+		}
+		db.OpsLog.LogEvent(obj, action, notes, userCred)
+	}
+}
+
+// cancel fails the task in background, OnCancel or the failed handler of
+// current stage is called to roll back objects
+func (self *STask) cancel(ctx context.Context, userCred mcclient.TokenCredential, action string, reason string) error {
+	// clear deadlines so that the sweeper does not cancel the task again
+	_, err := db.Update(self, func() error {
+		self.TaskDeadline = time.Time{}
+		self.StageDeadline = time.Time{}
+		self.RetryAt = time.Time{}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "clear deadlines")
+	}
+	notes := jsonutils.NewDict()
+	notes.Set("task_id", jsonutils.NewString(self.Id))
+	notes.Set("task_name", jsonutils.NewString(self.TaskName))
+	notes.Set("stage", jsonutils.NewString(self.Stage))
+	notes.Set("reason", jsonutils.NewString(reason))
+	self.logEvent(ctx, userCred, action, notes)
+	return runCancelTask(self.Id, action, jsonutils.NewString(reason))
+}
+
+func (self *STask) PerformCancel(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input apis.TaskCancelInput) (jsonutils.JSONObject, error) {
+	if self.IsFinished() {
+		return nil, httperrors.NewInvalidStatusError("task %s is %s", self.Id, self.Stage)
+	}
+	if len(input.Reason) == 0 {
+		input.Reason = fmt.Sprintf("cancelled by %s", userCred.GetUserName())
+	}
+	err := self.cancel(ctx, userCred, db.ACT_TASK_CANCEL, input.Reason)
+	if err != nil {
+		return nil, httperrors.NewGeneralError(err)
+	}
+	return nil, nil
+}
+
+func (manager *STaskManager) runRetryTasks(now time.Time) {
+	q := manager.Query()
+	q = q.NotIn("stage", []string{TASK_STAGE_COMPLETE, TASK_STAGE_FAILED})
+	q = q.IsNotNull("retry_at").LE("retry_at", now)
+	tasks := make([]STask, 0)
+	err := db.FetchModelObjects(manager, q, &tasks)
+	if err != nil {
+		log.Errorf("fetch tasks to retry fail %s", err)
+		return
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Params == nil {
+			task.Params = jsonutils.NewDict()
+		}
+		log.Infof("retry task %s(%s) at stage %s", task.TaskName, task.Id, task.Stage)
+		if err := task.runRetry(); err != nil {
+			log.Errorf("retry task %s fail %s", task.Id, err)
+		}
+	}
+}
+
+// FailExpiredTasks runs the scheduled stage retries and cancels the
+// unfinished tasks which exceed deadlines declared by task types
+func (manager *STaskManager) FailExpiredTasks(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	now := time.Now().UTC()
+	manager.runRetryTasks(now)
+
+	q := manager.Query()
+	q = q.NotIn("stage", []string{TASK_STAGE_COMPLETE, TASK_STAGE_FAILED})
+	q = q.Filter(sqlchemy.OR(
+		sqlchemy.LT(q.Field("task_deadline"), now),
+		sqlchemy.LT(q.Field("stage_deadline"), now),
+	))
+	tasks := make([]STask, 0)
+	err := db.FetchModelObjects(manager, q, &tasks)
+	if err != nil {
+		log.Errorf("fetch expired tasks fail %s", err)
+		return
+	}
+	for i := range tasks {
+		task := &tasks[i]
+		if task.Params == nil {
+			task.Params = jsonutils.NewDict()
+		}
+		var reason string
+		if !task.TaskDeadline.IsZero() && task.TaskDeadline.Before(now) {
+			reason = fmt.Sprintf("task %s timeout at stage %s, deadline %s", task.TaskName, task.Stage, task.TaskDeadline)
+		} else {
+			reason = fmt.Sprintf("stage %s of task %s timeout, deadline %s", task.Stage, task.TaskName, task.StageDeadline)
+			if task.retryStage(ctx, jsonutils.NewString(reason)) {
+				continue
+			}
+		}
+		log.Warningf("cancel expired task %s(%s): %s", task.TaskName, task.Id, reason)
+		err := task.cancel(ctx, userCred, db.ACT_TASK_TIMEOUT, reason)
+		if err != nil {
+			log.Errorf("cancel expired task %s fail %s", task.Id, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskman
+
+import (
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+)
+
+type fakeDeadlineTask struct {
+	STask
+}
+
+func (self *fakeDeadlineTask) GetTaskTimeout() time.Duration {
+	return time.Hour
+}
+
+func (self *fakeDeadlineTask) GetStageTimeout(stage string) time.Duration {
+	if stage == "OnWaitComplete" {
+		return time.Minute
+	}
+	return 0
+}
+
+func (self *fakeDeadlineTask) GetStageRetryPolicy(stage string) *STaskRetryPolicy {
+	if stage == TASK_INIT_STAGE {
+		return &STaskRetryPolicy{MaxRetries: 3, Interval: time.Second}
+	}
+	return nil
+}
+
+func init() {
+	RegisterTask(fakeDeadlineTask{})
+}
+
+func TestTaskDeadline(t *testing.T) {
+	now := time.Now().UTC()
+	if d := calcTaskDeadline("fakeDeadlineTask"); d.Sub(now) < 59*time.Minute || d.Sub(now) > 61*time.Minute {
+		t.Errorf("unexpected task deadline %s", d)
+	}
+	if d := calcStageDeadline("fakeDeadlineTask", "OnWaitComplete"); d.Sub(now) < 59*time.Second || d.Sub(now) > 61*time.Second {
+		t.Errorf("unexpected stage deadline %s", d)
+	}
+	if d := calcStageDeadline("fakeDeadlineTask", TASK_INIT_STAGE); !d.IsZero() {
+		t.Errorf("stage without timeout should have no deadline, got %s", d)
+	}
+	if d := calcTaskDeadline("notExistTask"); !d.IsZero() {
+		t.Errorf("unknown task should have no deadline, got %s", d)
+	}
+}
+
+func TestTaskRetryPolicy(t *testing.T) {
+	if p := getTaskRetryPolicy("fakeDeadlineTask", TASK_INIT_STAGE); p == nil || p.MaxRetries != 3 {
+		t.Errorf("expect retry policy of %s, got %#v", TASK_INIT_STAGE, p)
+	}
+	if p := getTaskRetryPolicy("fakeDeadlineTask", "OnWaitComplete"); p != nil {
+		t.Errorf("expect no retry policy, got %#v", p)
+	}
+
+	task := &STask{Params: jsonutils.Marshal(map[string]interface{}{
+		"__stages": []map[string]string{
+			{"name": TASK_INIT_STAGE},
+		},
+		STAGE_RETRIES_KEY: map[string]int{
+			TASK_INIT_STAGE: 2,
+		},
+	}).(*jsonutils.JSONDict)}
+	if prev := task.getPrevStage(); prev != TASK_INIT_STAGE {
+		t.Errorf("expect previous stage %s, got %s", TASK_INIT_STAGE, prev)
+	}
+	if retries := task.getStageRetries(TASK_INIT_STAGE); retries != 2 {
+		t.Errorf("expect 2 retries, got %d", retries)
+	}
+}
+
+func TestTaskStaleCallback(t *testing.T) {
+	task := &STask{Params: jsonutils.NewDict()}
+	if attempt := task.getStageAttempt(); attempt != 1 {
+		t.Errorf("expect first attempt 1, got %d", attempt)
+	}
+	if task.isStaleCallback(jsonutils.NewDict()) {
+		t.Errorf("callback without attempt should not be stale")
+	}
+
+	task.Params.Set(STAGE_ATTEMPT_KEY, jsonutils.NewInt(2))
+	late := jsonutils.Marshal(map[string]string{"__status__": "OK", "__stage_attempt__": "1"}).(*jsonutils.JSONDict)
+	if !task.isStaleCallback(late) {
+		t.Errorf("callback of attempt 1 should be stale at attempt 2")
+	}
+	current := jsonutils.Marshal(map[string]string{"__stage_attempt__": "2"}).(*jsonutils.JSONDict)
+	if task.isStaleCallback(current) {
+		t.Errorf("callback of current attempt should not be stale")
+	}
+	if current.Contains("__stage_attempt__") {
+		t.Errorf("attempt should be removed from callback data")
+	}
+}
@@ -42,3 +42,24 @@ type ITask interface {
 	GetPendingUsage(quota quotas.IQuota, index int) error
 	ClearPendingUsage(index int) error
 }
+
+// ITaskDeadline is implemented by task types which declare deadlines of the
+// whole task and of each stage, zero duration means no deadline. A task
+// exceeding its deadline is cancelled by FailExpiredTasks. The methods are
+// called on a zero value of the task type.
+type ITaskDeadline interface {
+	GetTaskTimeout() time.Duration
+	GetStageTimeout(stage string) time.Duration
+}
+
+// ITaskRetryPolicy is implemented by task types with idempotent stages. When
+// the callback requested by a stage with retry policy fails or times out, the
+// stage is executed again with the same input instead of failing the task.
+type ITaskRetryPolicy interface {
+	GetStageRetryPolicy(stage string) *STaskRetryPolicy
+}
+
+type STaskRetryPolicy struct {
+	MaxRetries int
+	Interval   time.Duration
+}
@@ -63,6 +63,10 @@ const (
 
 	CONVERT_TASK = "convert_task"
 
+	STAGE_RETRIES_KEY = "__stage_retries"
+	RETRY_INPUT_KEY   = "__retry_input"
+	STAGE_ATTEMPT_KEY = "__stage_attempt"
+
 	LANG = "lang"
 )
 
@@ -92,6 +96,13 @@ type STask struct {
 
 	Stage string `width:"64" charset:"ascii" nullable:"false" default:"on_init" list:"user"` // Column(VARCHAR(64, charset='ascii'), nullable=False, default='on_init')
 
+	// 任务超时时间
+	TaskDeadline time.Time `nullable:"true" index:"true" list:"user"`
+	// 当前阶段超时时间
+	StageDeadline time.Time `nullable:"true" index:"true" list:"user"`
+	// 阶段重试时间
+	RetryAt time.Time `nullable:"true" index:"true" list:"user"`
+
 	taskObject  db.IStandaloneModel   `ignore:"true"`
 	taskObjects []db.IStandaloneModel `ignore:"true"`
 }
@@ -283,6 +294,9 @@ func (manager *STaskManager) NewTask(
 		UserCred: userCred,
 		Params:   data,
 		Stage:    TASK_INIT_STAGE,
+
+		TaskDeadline:  calcTaskDeadline(taskName),
+		StageDeadline: calcStageDeadline(taskName, TASK_INIT_STAGE),
 	}
 	task.SetModelManager(manager, task)
 	err := manager.TableSpec().Insert(ctx, task)
@@ -333,6 +347,9 @@ func (manager *STaskManager) NewParallelTask(
 		UserCred: userCred,
 		Params:   data,
 		Stage:    TASK_INIT_STAGE,
+
+		TaskDeadline:  calcTaskDeadline(taskName),
+		StageDeadline: calcStageDeadline(taskName, TASK_INIT_STAGE),
 	}
 	task.SetModelManager(manager, task)
 	err := manager.TableSpec().Insert(ctx, task)
@@ -387,7 +404,7 @@ func (manager *STaskManager) getTaskName(taskId string) string {
 	return baseTask.TaskName
 }
 
-func (manager *STaskManager) execTask(taskId string, data jsonutils.JSONObject) {
+func (manager *STaskManager) execTask(taskId string, data jsonutils.JSONObject, cancelAction string) {
 	baseTask := manager.fetchTask(taskId)
 	if baseTask == nil {
 		return
@@ -400,24 +417,34 @@ func (manager *STaskManager) execTask(taskId string, data jsonutils.JSONObject)
 	log.Debugf("Do task %s(%s) with data %s at stage %s", taskType, taskId, data, baseTask.Stage)
 	taskValue := reflect.New(taskType)
 	if taskValue.Type().Implements(ITaskType) {
-		execITask(taskValue, baseTask, data, false)
+		execITask(taskValue, baseTask, data, false, cancelAction)
 	} else if taskValue.Type().Implements(IBatchTaskType) {
-		execITask(taskValue, baseTask, data, true)
+		execITask(taskValue, baseTask, data, true, cancelAction)
 	} else {
 		log.Errorf("Unsupported task type?? %s", taskValue.Type())
 	}
 }
 
-func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject, isMulti bool) {
+func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject, isMulti bool, cancelAction string) {
 	ctxData := task.GetRequestContext()
 	ctx := ctxData.GetContext()
 
+	isCancel := len(cancelAction) > 0
+	if isCancel && task.IsFinished() {
+		log.Warningf("Task %s(%s) is %s, skip cancel", task.TaskName, task.Id, task.Stage)
+		return
+	}
+
 	taskFailed := false
 
 	var data jsonutils.JSONObject
 	if odata != nil {
 		switch dictdata := odata.(type) {
 		case *jsonutils.JSONDict:
+			if !isCancel && task.isStaleCallback(dictdata) {
+				log.Warningf("Task %s(%s) ignore callback of a retried attempt at stage %s: %s", task.TaskName, task.Id, task.Stage, dictdata)
+				return
+			}
 			taskStatus, _ := odata.GetString("__status__")
 			if len(taskStatus) > 0 && taskStatus != "OK" {
 				taskFailed = true
@@ -442,12 +469,19 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 		data = jsonutils.NewDict()
 	}
 
+	if taskFailed && !isCancel && task.retryStage(ctx, data) {
+		return
+	}
+
 	var stageName string
 	if taskFailed {
 		stageName = fmt.Sprintf("%sFailed", task.Stage)
 	} else {
 		stageName = task.Stage
 	}
+	if isCancel && taskValue.MethodByName("OnCancel").IsValid() {
+		stageName = "OnCancel"
+	}
 
 	funcValue := taskValue.MethodByName(stageName)
 
@@ -534,6 +568,19 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 
 	params[2] = reflect.ValueOf(data)
 
+	if isCancel {
+		// the task may be finished while waiting for the object lock
+		ntask := TaskManager.fetchTask(task.Id)
+		if ntask == nil || ntask.IsFinished() {
+			log.Warningf("Task %s(%s) is finished, skip cancel", task.TaskName, task.Id)
+			return
+		}
+	}
+
+	if !taskFailed && getTaskRetryPolicy(task.TaskName, task.Stage) != nil {
+		task.saveRetryInput(data)
+	}
+
 	filled := reflectutils.FillEmbededStructValue(taskValue.Elem(), reflect.Indirect(reflect.ValueOf(task)))
 	if !filled {
 		log.Errorf("Cannot locate baseTask embedded struct, give up...")
@@ -558,6 +605,24 @@ func execITask(taskValue reflect.Value, task *STask, odata jsonutils.JSONObject,
 	log.Debugf("Call %s %s %#v", task.TaskName, stageName, params)
 	funcValue.Call(params)
 
+	if isCancel {
+		// make sure a cancelled task is failed even if the handler does not
+		ntask := TaskManager.fetchTask(task.Id)
+		if ntask != nil && !ntask.IsFinished() {
+			reason, _ := data.Get("__reason__")
+			if reason == nil {
+				reason = jsonutils.NewString(cancelAction)
+			}
+			SetStageFailedFuncValue := taskValue.MethodByName("SetStageFailed")
+			SetStageFailedFuncValue.Call(
+				[]reflect.Value{
+					reflect.ValueOf(ctx),
+					reflect.ValueOf(reason),
+				},
+			)
+		}
+	}
+
 	// call save request context
 	saveRequestContextFuncValue := taskValue.MethodByName("SaveRequestContext")
 	saveRequestContextFuncValue.Call([]reflect.Value{reflect.ValueOf(&ctxData)})
@@ -636,6 +701,13 @@ func (self *STask) SetStage(stageName string, data *jsonutils.JSONDict) error {
 			stageData.Add(jsonutils.NewTimeString(time.Now()), "complete_at")
 			stageList.Add(stageData)
 			self.Stage = stageName
+			self.RetryAt = time.Time{}
+			if self.IsFinished() {
+				self.TaskDeadline = time.Time{}
+				self.StageDeadline = time.Time{}
+			} else {
+				self.StageDeadline = calcStageDeadline(self.TaskName, stageName)
+			}
 		}
 		self.Params = params
 		return nil
@@ -837,6 +909,7 @@ func (task *STask) GetTaskRequestHeader() http.Header {
 	}
 	header := mcclient.GetTokenHeaders(userCred)
 	header.Set(mcclient.TASK_ID, task.GetTaskId())
+	header.Set(mcclient.TASK_STAGE_ATTEMPT, strconv.FormatInt(task.getStageAttempt(), 10))
 	if len(serviceUrl) > 0 {
 		notifyUrl := fmt.Sprintf("%s/tasks/%s", serviceUrl, task.GetTaskId())
 		header.Set(mcclient.TASK_NOTIFY_URL, notifyUrl)
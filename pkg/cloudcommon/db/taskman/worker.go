@@ -37,10 +37,12 @@ func init() {
 type taskTask struct {
 	taskId string
 	data   jsonutils.JSONObject
+	// opslog action of cancellation, empty for normal stage execution
+	cancelAction string
 }
 
 func (t *taskTask) Run() {
-	TaskManager.execTask(t.taskId, t.data)
+	TaskManager.execTask(t.taskId, t.data, t.cancelAction)
 }
 
 func (t *taskTask) Dump() string {
@@ -48,6 +50,25 @@ func (t *taskTask) Dump() string {
 }
 
 func runTask(taskId string, data jsonutils.JSONObject) error {
+	return scheduleTask(&taskTask{
+		taskId: taskId,
+		data:   data,
+	})
+}
+
+func runCancelTask(taskId string, action string, reason jsonutils.JSONObject) error {
+	data := jsonutils.NewDict()
+	data.Add(jsonutils.NewString("error"), "__status__")
+	data.Add(reason, "__reason__")
+	return scheduleTask(&taskTask{
+		taskId:       taskId,
+		data:         data,
+		cancelAction: action,
+	})
+}
+
+func scheduleTask(task *taskTask) error {
+	taskId := task.taskId
 	taskName := TaskManager.getTaskName(taskId)
 	if len(taskName) == 0 {
 		return fmt.Errorf("no such task??? task_id=%s", taskId)
@@ -57,11 +78,6 @@ func runTask(taskId string, data jsonutils.JSONObject) error {
 		worker = workerMan
 	}
 
-	task := &taskTask{
-		taskId: taskId,
-		data:   data,
-	}
-
 	isOk := worker.Run(task, nil, func(err error) {
 		data := jsonutils.NewDict()
 		data.Add(jsonutils.NewString(taskName), "task_name")
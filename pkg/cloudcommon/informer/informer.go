@@ -16,6 +16,7 @@ package informer
 
 import (
 	"context"
+	"sync"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -28,6 +29,9 @@ const (
 
 var (
 	defaultBackend IInformerBackend
+
+	// extra backends receive events along with the default backend
+	extraBackends = new(sync.Map)
 )
 
 type IInformerBackend interface {
@@ -37,6 +41,12 @@ type IInformerBackend interface {
 	Delete(ctx context.Context, obj *ModelObject) error
 }
 
+// IWatchedResourceFilter is optionally implemented by extra backends to
+// receive only events of the interested resources
+type IWatchedResourceFilter interface {
+	IsResourceWatched(keywordPlural string) bool
+}
+
 func Init(be IInformerBackend) {
 	if defaultBackend != nil {
 		log.Fatalf("informer backend %q already init", be.GetType())
@@ -55,8 +65,40 @@ func GetDefaultBackend() IInformerBackend {
 	return defaultBackend
 }
 
+// AddBackend registers a backend besides the default one, the backend is
+// keyed by its type
+func AddBackend(be IInformerBackend) {
+	extraBackends.Store(be.GetType(), be)
+}
+
+func RemoveBackend(beType string) {
+	extraBackends.Delete(beType)
+}
+
+func getExtraBackends(keywordPlural string) []IInformerBackend {
+	ret := make([]IInformerBackend, 0)
+	extraBackends.Range(func(key, val interface{}) bool {
+		be := val.(IInformerBackend)
+		if filter, ok := be.(IWatchedResourceFilter); ok && !filter.IsResourceWatched(keywordPlural) {
+			return true
+		}
+		ret = append(ret, be)
+		return true
+	})
+	return ret
+}
+
+func hasExtraBackends() bool {
+	has := false
+	extraBackends.Range(func(key, val interface{}) bool {
+		has = true
+		return false
+	})
+	return has
+}
+
 func IsInit() bool {
-	return defaultBackend != nil
+	return defaultBackend != nil || hasExtraBackends()
 }
 
 type ModelObject struct {
@@ -89,28 +131,29 @@ func isResourceWatched(keywordPlural string) bool {
 }
 
 func Create(ctx context.Context, obj *ModelObject) error {
-	if !isResourceWatched(obj.KeywordPlural) {
-		return nil
-	}
-	return run(ctx, func(ctx context.Context, be IInformerBackend) error {
+	return dispatch(ctx, obj.KeywordPlural, func(ctx context.Context, be IInformerBackend) error {
 		return be.Create(ctx, obj)
 	})
 }
 
 func Update(ctx context.Context, obj *ModelObject, oldObj *jsonutils.JSONDict) error {
-	if !isResourceWatched(obj.KeywordPlural) {
-		return nil
-	}
-	return run(ctx, func(ctx context.Context, be IInformerBackend) error {
+	return dispatch(ctx, obj.KeywordPlural, func(ctx context.Context, be IInformerBackend) error {
 		return be.Update(ctx, obj, oldObj)
 	})
 }
 
 func Delete(ctx context.Context, obj *ModelObject) error {
-	if !isResourceWatched(obj.KeywordPlural) {
-		return nil
-	}
-	return run(ctx, func(ctx context.Context, be IInformerBackend) error {
+	return dispatch(ctx, obj.KeywordPlural, func(ctx context.Context, be IInformerBackend) error {
 		return be.Delete(ctx, obj)
 	})
 }
+
+func dispatch(ctx context.Context, keywordPlural string, f func(ctx context.Context, be IInformerBackend) error) error {
+	for _, be := range getExtraBackends(keywordPlural) {
+		runBackend(be, f)
+	}
+	if !isResourceWatched(keywordPlural) {
+		return nil
+	}
+	return run(ctx, f)
+}
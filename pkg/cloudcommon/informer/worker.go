@@ -74,10 +74,14 @@ func run(ctx context.Context, f func(ctx context.Context, be IInformerBackend) e
 	if be == nil {
 		return ErrBackendNotInit
 	}
+	runBackend(be, f)
+	return nil
+}
+
+func runBackend(be IInformerBackend, f func(ctx context.Context, be IInformerBackend) error) {
 	task := informerTask{
 		f:  f,
 		be: be,
 	}
 	informerWorkerMan.Run(&task, nil, nil)
-	return nil
 }
@@ -142,6 +142,9 @@ type HostCommonOptions struct {
 	DeployServerSocketPath string `help:"Deploy server listen socket path" default:"/var/run/onecloud/deploy.sock"`
 
 	EnableRemoteExecutor bool `help:"Enable remote executor" default:"false"`
+
+	ImageSigningTrustedKeysDir string `help:"Directory of PEM encoded public keys trusted to sign images, each key is named after its file name"`
+	ImageSigningTrustedCaFile  string `help:"File of PEM encoded root certificates trusted to issue image signing certificates"`
 }
 
 type DBOptions struct {
@@ -169,6 +172,8 @@ type DBOptions struct {
 
 	SplitableMaxDurationHours int `help:"maximal number of hours that a splitable segement lasts, default 30 days" default:"720"`
 
+	TaskTimeoutCheckIntervalSeconds int `help:"interval to run scheduled stage retries and cancel tasks exceeding their deadlines, default 1 minute" default:"60"`
+
 	EtcdOptions
 
 	EtcdLockPrefix string `help:"prefix of etcd lock records" default:"/onecloud/lockman"`
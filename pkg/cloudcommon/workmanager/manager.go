@@ -101,6 +101,16 @@ func (t *workerTask) Dump() string {
 	return ""
 }
 
+// newTaskContext returns a context detached from the request which keeps the
+// task id and the stage attempt used to call back the task
+func newTaskContext(ctx context.Context) context.Context {
+	newCtx := context.WithValue(context.Background(), appctx.APP_CONTEXT_KEY_TASK_ID, ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID))
+	if attempt := ctx.Value(appctx.APP_CONTEXT_KEY_TASK_STAGE_ATTEMPT); attempt != nil {
+		newCtx = context.WithValue(newCtx, appctx.APP_CONTEXT_KEY_TASK_STAGE_ATTEMPT, attempt)
+	}
+	return newCtx
+}
+
 // If delay task is not panic and task func return err is nil
 // task complete will be called, otherwise called task failed
 // Params is interface for receive any type, task func should do type assertion
@@ -110,7 +120,7 @@ func (w *SWorkManager) delayTask(ctx context.Context, task DelayTaskFunc, params
 		return
 	} else {
 		// delayTask should have a new context.Context with value 'taskid'
-		ctx = context.WithValue(context.Background(), appctx.APP_CONTEXT_KEY_TASK_ID, ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID))
+		ctx = newTaskContext(ctx)
 		w.add()
 		t := workerTask{
 			ctx:    ctx,
@@ -163,7 +173,7 @@ func (w *SWorkManager) delayTaskWithoutReqctx(
 	// delayTaskWithoutReqctx should have a new context.Context
 	newCtx := context.Background()
 	if ctx != nil && ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID) != nil {
-		newCtx = context.WithValue(newCtx, appctx.APP_CONTEXT_KEY_TASK_ID, ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID))
+		newCtx = newTaskContext(ctx)
 	}
 	ctx = newCtx
 	w.add()
@@ -59,6 +59,9 @@ type SImage struct {
 
 	// EncryptKeyId
 	EncryptKeyId string
+
+	// SignatureStatus is the signature verification status of glance image
+	SignatureStatus string
 }
 
 type SSubImage struct {
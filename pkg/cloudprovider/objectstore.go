@@ -279,6 +279,14 @@ type ICloudBucket interface {
 	ListMultipartUploads() ([]SBucketMultipartUploads, error)
 }
 
+// ICloudBucketLifecycle is implemented by buckets whose backend enforces
+// S3 lifecycle configuration natively
+type ICloudBucketLifecycle interface {
+	// SetLifecycle sets lifecycle configuration in S3 xml format, the
+	// configuration is removed if conf is empty
+	SetLifecycle(conf string) error
+}
+
 type ICloudObject interface {
 	GetIBucket() ICloudBucket
 
@@ -937,6 +937,8 @@ type ICloudDBInstance interface {
 	IBillingResource
 
 	Reboot() error
+	Start() error
+	Stop() error
 
 	GetMasterInstanceId() string
 	GetSecurityGroupIds() ([]string, error)
@@ -1080,6 +1082,8 @@ type ICloudElasticcache interface {
 	GetICloudElasticcacheBackup(backupId string) (ICloudElasticcacheBackup, error)
 
 	Restart() error
+	Start() error
+	Stop() error
 	Delete() error
 	ChangeInstanceSpec(spec string) error
 	SetMaintainTime(maintainStartTime, maintainEndTime string) error
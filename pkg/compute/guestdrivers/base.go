@@ -465,3 +465,11 @@ func (self *SBaseGuestDriver) RequestCPUSet(ctx context.Context, userCred mcclie
 func (self *SBaseGuestDriver) RequestCPUSetRemove(ctx context.Context, userCred mcclient.TokenCredential, host *models.SHost, guest *models.SGuest, input *api.ServerCPUSetRemoveInput) error {
 	return httperrors.ErrNotImplemented
 }
+
+func (self *SBaseGuestDriver) RequestFetchVtpmState(ctx context.Context, userCred mcclient.TokenCredential, host *models.SHost, guest *models.SGuest) (string, error) {
+	return "", httperrors.ErrNotImplemented
+}
+
+func (self *SBaseGuestDriver) RequestRestoreVtpmState(ctx context.Context, userCred mcclient.TokenCredential, host *models.SHost, guest *models.SGuest, state string) error {
+	return httperrors.ErrNotImplemented
+}
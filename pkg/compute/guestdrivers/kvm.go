@@ -120,6 +120,9 @@ func (self *SKVMGuestDriver) RequestDiskSnapshot(ctx context.Context, guest *mod
 	body := jsonutils.NewDict()
 	body.Set("disk_id", jsonutils.NewString(diskId))
 	body.Set("snapshot_id", jsonutils.NewString(snapshotId))
+	if jsonutils.QueryBoolean(task.GetParams(), "fsfreeze", false) {
+		body.Set("fsfreeze", jsonutils.JSONTrue)
+	}
 	header := self.getTaskRequestHeader(task)
 	_, _, err := httputils.JSONRequest(httputils.GetDefaultClient(), ctx, "POST", url, header, body, false)
 	return err
@@ -286,6 +289,14 @@ func (self *SKVMGuestDriver) OnGuestDeployTaskDataReceived(ctx context.Context,
 func (self *SKVMGuestDriver) RequestStartOnHost(ctx context.Context, guest *models.SGuest, host *models.SHost, userCred mcclient.TokenCredential, task taskman.ITask) error {
 	header := self.getTaskRequestHeader(task)
 
+	// serialize placements on the host so that concurrent starts won't be
+	// placed on the same free NUMA nodes
+	lockman.LockObject(ctx, host)
+	err := guest.AllocateNumaPlacement(ctx, host)
+	lockman.ReleaseObject(ctx, host)
+	if err != nil {
+		return errors.Wrap(err, "AllocateNumaPlacement")
+	}
 	config := jsonutils.NewDict()
 	desc, err := guest.GetDriver().GetJsonDescAtHost(ctx, userCred, guest, host, nil)
 	if err != nil {
@@ -988,3 +999,33 @@ func (self *SKVMGuestDriver) RequestCPUSetRemove(ctx context.Context, userCred m
 	}
 	return nil
 }
+
+func (self *SKVMGuestDriver) RequestFetchVtpmState(ctx context.Context, userCred mcclient.TokenCredential, host *models.SHost, guest *models.SGuest) (string, error) {
+	url := fmt.Sprintf("%s/servers/%s/vtpm-state", host.ManagerUri, guest.Id)
+	httpClient := httputils.GetDefaultClient()
+	header := mcclient.GetTokenHeaders(userCred)
+	_, respBody, err := httputils.JSONRequest(httpClient, ctx, "POST", url, header, jsonutils.NewDict(), false)
+	if err != nil {
+		return "", errors.Wrap(err, "host request")
+	}
+	resp := new(host_api.GuestVtpmStateResponse)
+	if respBody == nil {
+		return "", nil
+	}
+	if err := respBody.Unmarshal(resp); err != nil {
+		return "", errors.Wrap(err, "unmarshal response")
+	}
+	return resp.VtpmState, nil
+}
+
+func (self *SKVMGuestDriver) RequestRestoreVtpmState(ctx context.Context, userCred mcclient.TokenCredential, host *models.SHost, guest *models.SGuest, state string) error {
+	url := fmt.Sprintf("%s/servers/%s/vtpm-state-restore", host.ManagerUri, guest.Id)
+	httpClient := httputils.GetDefaultClient()
+	header := mcclient.GetTokenHeaders(userCred)
+	body := jsonutils.Marshal(&host_api.GuestVtpmStateRestoreRequest{VtpmState: state})
+	_, _, err := httputils.JSONRequest(httpClient, ctx, "POST", url, header, body, false)
+	if err != nil {
+		return errors.Wrap(err, "host request")
+	}
+	return nil
+}
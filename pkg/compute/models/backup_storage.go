@@ -16,11 +16,14 @@ package models
 
 import (
 	"context"
+	"net/url"
 	"reflect"
+	"strings"
 	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/gotypes"
 	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
@@ -65,6 +68,13 @@ func init() {
 type SBackupStorageAccessInfo struct {
 	NfsHost      string `json:"nfs_host"`
 	NfsSharedDir string `json:"nfs_shared_dir"`
+
+	ObjectBucketUrl string `json:"object_bucket_url"`
+	ObjectAccessKey string `json:"object_access_key"`
+	// secret encrypted with id of backup storage
+	ObjectSecret string `json:"object_secret"`
+	// skip verifying TLS certificate of object storage
+	ObjectInsecureSkipVerify bool `json:"object_insecure_skip_verify"`
 }
 
 func (ba *SBackupStorageAccessInfo) String() string {
@@ -81,7 +91,7 @@ func (bs *SBackupStorageManager) ValidateCreateData(ctx context.Context, userCre
 	if err != nil {
 		return input, err
 	}
-	if !utils.IsInStringArray(input.StorageType, []string{api.BACKUPSTORAGE_TYPE_NFS}) {
+	if !utils.IsInStringArray(input.StorageType, []string{api.BACKUPSTORAGE_TYPE_NFS, api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE}) {
 		return input, httperrors.NewInputParameterError("Invalid storage type %s", input.StorageType)
 	}
 	switch input.StorageType {
@@ -92,22 +102,66 @@ func (bs *SBackupStorageManager) ValidateCreateData(ctx context.Context, userCre
 		if input.NfsSharedDir == "" {
 			return input, httperrors.NewInputParameterError("nfs_shared_dir is required when storage type is nfs")
 		}
+	case api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE:
+		if input.ObjectBucketUrl == "" {
+			return input, httperrors.NewInputParameterError("object_bucket_url is required when storage type is object")
+		}
+		bucketUrl, err := url.Parse(input.ObjectBucketUrl)
+		if err != nil || !utils.IsInStringArray(bucketUrl.Scheme, []string{"http", "https"}) || bucketUrl.Host == "" || strings.Trim(bucketUrl.Path, "/") == "" {
+			return input, httperrors.NewInputParameterError("invalid object_bucket_url %s, should be http(s)://<endpoint>/<bucket>", input.ObjectBucketUrl)
+		}
+		if input.ObjectAccessKey == "" {
+			return input, httperrors.NewInputParameterError("object_access_key is required when storage type is object")
+		}
+		if input.ObjectSecret == "" {
+			return input, httperrors.NewInputParameterError("object_secret is required when storage type is object")
+		}
 	}
 	return input, nil
 }
 
 func (bs *SBackupStorage) CustomizeCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
 	bs.SetEnabled(true)
-	nfsHost, _ := data.GetString("nfs_host")
-	nfsSharedDir, _ := data.GetString("nfs_shared_dir")
+	input := api.BackupStorageCreateInput{}
+	data.Unmarshal(&input)
 	bs.Status = api.BACKUPSTORAGE_STATUS_ONLINE
 	bs.AccessInfo = &SBackupStorageAccessInfo{
-		NfsHost:      nfsHost,
-		NfsSharedDir: nfsSharedDir,
+		NfsHost:      input.NfsHost,
+		NfsSharedDir: input.NfsSharedDir,
+	}
+	if bs.StorageType == api.BACKUPSTORAGE_TYPE_OBJECT_STORAGE {
+		// id is needed to encrypt secret
+		if len(bs.Id) == 0 {
+			bs.Id = db.DefaultUUIDGenerator()
+		}
+		secret, err := utils.EncryptAESBase64(bs.Id, input.ObjectSecret)
+		if err != nil {
+			return errors.Wrap(err, "EncryptAESBase64")
+		}
+		bs.AccessInfo.ObjectBucketUrl = input.ObjectBucketUrl
+		bs.AccessInfo.ObjectAccessKey = input.ObjectAccessKey
+		bs.AccessInfo.ObjectSecret = secret
+		bs.AccessInfo.ObjectInsecureSkipVerify = input.ObjectInsecureSkipVerify
 	}
 	return bs.SEnabledStatusInfrasResourceBase.CustomizeCreate(ctx, userCred, ownerId, query, data)
 }
 
+// GetAccessInfo returns access info sent to host, with secret decrypted
+func (bs *SBackupStorage) GetAccessInfo() (*jsonutils.JSONDict, error) {
+	if bs.AccessInfo == nil {
+		return jsonutils.NewDict(), nil
+	}
+	info := *bs.AccessInfo
+	if len(info.ObjectSecret) > 0 {
+		secret, err := utils.DescryptAESBase64(bs.Id, info.ObjectSecret)
+		if err != nil {
+			return nil, errors.Wrap(err, "DescryptAESBase64")
+		}
+		info.ObjectSecret = secret
+	}
+	return jsonutils.Marshal(&info).(*jsonutils.JSONDict), nil
+}
+
 func (bs *SBackupStorage) BackupCount() (int, error) {
 	return DiskBackupManager.Query().Equals("backup_storage_id", bs.GetId()).CountWithError()
 }
@@ -135,6 +189,9 @@ func (bs *SBackupStorage) PostCreate(ctx context.Context, userCred mcclient.Toke
 func (bs *SBackupStorage) getMoreDetails(ctx context.Context, out api.BackupStorageDetails) api.BackupStorageDetails {
 	out.NfsHost = bs.AccessInfo.NfsHost
 	out.NfsSharedDir = bs.AccessInfo.NfsSharedDir
+	out.ObjectBucketUrl = bs.AccessInfo.ObjectBucketUrl
+	out.ObjectAccessKey = bs.AccessInfo.ObjectAccessKey
+	out.ObjectInsecureSkipVerify = bs.AccessInfo.ObjectInsecureSkipVerify
 	return out
 }
 
@@ -0,0 +1,85 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	identityapi "yunion.io/x/onecloud/pkg/apis/identity"
+	imageapi "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/compute/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+	"yunion.io/x/onecloud/pkg/util/hashcache"
+)
+
+var domainImageSignaturePolicyCache = hashcache.NewCache(1024, time.Minute)
+
+func getDomainImageSignaturePolicy(ctx context.Context, domainId string) (string, error) {
+	if policy := domainImageSignaturePolicyCache.AtomicGet(domainId); policy != nil {
+		return policy.(string), nil
+	}
+	s := auth.GetAdminSession(ctx, options.Options.Region, "")
+	domain, err := identity.Domains.GetById(s, domainId, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "Domains.GetById %s", domainId)
+	}
+	policy, _ := domain.GetString("image_signature_policy")
+	domainImageSignaturePolicyCache.AtomicSet(domainId, policy)
+	return policy, nil
+}
+
+func isImageSignatureVerified(img *cloudprovider.SImage) bool {
+	// images of cloud providers are not signed
+	return len(img.ExternalId) > 0 || img.SignatureStatus == imageapi.IMAGE_SIGNATURE_STATUS_VERIFIED
+}
+
+// ValidateImageSignaturePolicy rejects booting the owner's servers from an
+// image without a verified signature if the owner domain enforces image
+// signatures
+func (manager *SCachedimageManager) ValidateImageSignaturePolicy(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, imageId string) error {
+	policy, err := getDomainImageSignaturePolicy(ctx, ownerId.GetProjectDomainId())
+	if err != nil {
+		return errors.Wrap(err, "getDomainImageSignaturePolicy")
+	}
+	if policy != identityapi.IMAGE_SIGNATURE_POLICY_ENFORCE {
+		return nil
+	}
+	img, err := manager.getImageInfo(ctx, userCred, imageId, false)
+	if err != nil {
+		return errors.Wrapf(err, "getImageInfo %s", imageId)
+	}
+	if !isImageSignatureVerified(img) {
+		// the image might be signed after it was cached
+		img, err = manager.getImageInfo(ctx, userCred, imageId, true)
+		if err != nil {
+			return errors.Wrapf(err, "refresh image %s", imageId)
+		}
+	}
+	if !isImageSignatureVerified(img) {
+		status := img.SignatureStatus
+		if len(status) == 0 {
+			status = imageapi.IMAGE_SIGNATURE_STATUS_UNSIGNED
+		}
+		return httperrors.NewForbiddenError("image %s signature is %s, domain requires a verified image signature", img.Name, status)
+	}
+	return nil
+}
@@ -64,6 +64,10 @@ type SDiskBackup struct {
 	// 操作系统类型
 	OsType     string `width:"32" charset:"ascii" nullable:"true" list:"user" create:"optional"`
 	DiskConfig *SBackupDiskConfig
+
+	// 增量备份的父备份
+	ParentId   string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional" index:"true"`
+	BackupMode string `width:"16" charset:"ascii" nullable:"true" default:"full" list:"user" create:"optional"`
 }
 
 var DiskBackupManager *SDiskBackupManager
@@ -143,9 +147,54 @@ func (self *SDiskBackup) ValidateDeleteCondition(ctx context.Context, info jsonu
 	if is {
 		return httperrors.NewBadRequestError("disk backup referenced by instance backup")
 	}
+	cnt, err := self.GetChildrenCount()
+	if err != nil {
+		return errors.Wrap(err, "GetChildrenCount")
+	}
+	if cnt > 0 {
+		return httperrors.NewBadRequestError("disk backup is the parent of %d incremental backups", cnt)
+	}
 	return nil
 }
 
+func (self *SDiskBackup) GetChildrenCount() (int, error) {
+	return DiskBackupManager.Query().Equals("parent_id", self.Id).CountWithError()
+}
+
+// GetBackupChain returns ids of the ancestors of an incremental backup,
+// from the full backup to the direct parent
+func (self *SDiskBackup) GetBackupChain() ([]string, error) {
+	return getBackupChain(self.Id, self.ParentId, func(id string) (string, error) {
+		parent, err := DiskBackupManager.FetchById(id)
+		if err != nil {
+			return "", err
+		}
+		return parent.(*SDiskBackup).ParentId, nil
+	})
+}
+
+func getBackupChain(id, parentId string, fetchParentId func(id string) (string, error)) ([]string, error) {
+	chain := []string{}
+	visited := map[string]bool{id: true}
+	for len(parentId) > 0 {
+		if visited[parentId] {
+			return nil, errors.Errorf("loop in backup chain of %s", id)
+		}
+		visited[parentId] = true
+		grandParentId, err := fetchParentId(parentId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "fetch parent backup %s", parentId)
+		}
+		chain = append([]string{parentId}, chain...)
+		parentId = grandParentId
+	}
+	return chain, nil
+}
+
+func (self *SDiskBackup) IsIncremental() bool {
+	return self.BackupMode == api.BACKUP_MODE_INCREMENTAL && len(self.ParentId) > 0
+}
+
 func (dm *SDiskBackupManager) FetchCustomizeColumns(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
@@ -182,6 +231,11 @@ func (db *SDiskBackup) getMoreDetails(out api.DiskBackupDetails) api.DiskBackupD
 	if t, _ := InstanceBackupJointManager.IsSubBackup(db.Id); t {
 		out.IsSubBackup = true
 	}
+	if len(db.ParentId) > 0 {
+		if parent, _ := DiskBackupManager.FetchById(db.ParentId); parent != nil {
+			out.ParentName = parent.GetName()
+		}
+	}
 	return out
 }
 
@@ -279,9 +333,48 @@ func (dm *SDiskBackupManager) ValidateCreateData(
 	}
 	input.CloudregionId = region.Id
 
+	input.ParentId = ""
+	switch input.BackupMode {
+	case "", api.BACKUP_MODE_FULL:
+		input.BackupMode = api.BACKUP_MODE_FULL
+	case api.BACKUP_MODE_INCREMENTAL:
+		if len(disk.EncryptKeyId) > 0 {
+			return input, httperrors.NewUnsupportOperationError("incremental backup of encrypted disk is not supported")
+		}
+		if storage.StorageType != api.STORAGE_LOCAL {
+			return input, httperrors.NewUnsupportOperationError("incremental backup of disk on storage %s is not supported", storage.StorageType)
+		}
+		parent, err := dm.getLatestBackup(disk.Id, bs.Id)
+		if err != nil {
+			return input, errors.Wrap(err, "getLatestBackup")
+		}
+		// the first backup of the disk is a full one
+		if parent != nil {
+			input.ParentId = parent.Id
+		}
+	default:
+		return input, httperrors.NewInputParameterError("invalid backup_mode %s", input.BackupMode)
+	}
+
 	return input, nil
 }
 
+// getLatestBackup returns the latest ready backup of disk in backup storage, which
+// is the parent of the next incremental backup
+func (dm *SDiskBackupManager) getLatestBackup(diskId, backupStorageId string) (*SDiskBackup, error) {
+	q := dm.Query().Equals("disk_id", diskId).Equals("backup_storage_id", backupStorageId).
+		Equals("status", api.BACKUP_STATUS_READY).Desc("created_at").Limit(1)
+	backups := []SDiskBackup{}
+	err := db.FetchModelObjects(dm, q, &backups)
+	if err != nil {
+		return nil, err
+	}
+	if len(backups) == 0 {
+		return nil, nil
+	}
+	return &backups[0], nil
+}
+
 func (db *SDiskBackup) CustomizeCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
 	err := db.SVirtualResourceBase.CustomizeCreate(ctx, userCred, ownerId, query, data)
 	if err != nil {
@@ -527,6 +620,8 @@ func (manager *SDiskBackupManager) CreateFromPackMetadata(ctx context.Context, o
 	backup.OsType = metadata.OsType
 	backup.CloudregionId = "default"
 	backup.BackupStorageId = backupStorageId
+	// packages only contain full backups, see SInstanceBackup.PerformPack
+	backup.BackupMode = api.BACKUP_MODE_FULL
 	backup.Name = name
 	backup.Id = id
 	backup.Status = api.BACKUP_STATUS_READY
@@ -0,0 +1,67 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+)
+
+func TestGetBackupChain(t *testing.T) {
+	parents := map[string]string{
+		"full":  "",
+		"inc1":  "full",
+		"inc2":  "inc1",
+		"loop1": "loop2",
+		"loop2": "loop1",
+	}
+	fetch := func(id string) (string, error) {
+		parentId, ok := parents[id]
+		if !ok {
+			return "", errors.ErrNotFound
+		}
+		return parentId, nil
+	}
+	cases := []struct {
+		id       string
+		parentId string
+		want     []string
+		wantErr  bool
+	}{
+		{id: "full", parentId: "", want: []string{}},
+		{id: "inc1", parentId: "full", want: []string{"full"}},
+		{id: "inc3", parentId: "inc2", want: []string{"full", "inc1", "inc2"}},
+		{id: "inc4", parentId: "missing", wantErr: true},
+		{id: "inc5", parentId: "loop1", wantErr: true},
+	}
+	for _, c := range cases {
+		chain, err := getBackupChain(c.id, c.parentId, fetch)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s: expect error, got chain %v", c.id, chain)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.id, err)
+			continue
+		}
+		if !reflect.DeepEqual(chain, c.want) {
+			t.Errorf("%s: want %v, got %v", c.id, c.want, chain)
+		}
+	}
+}
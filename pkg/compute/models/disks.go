@@ -496,6 +496,12 @@ func (manager *SDiskManager) ValidateCreateData(ctx context.Context, userCred mc
 	if err != nil {
 		return input, err
 	}
+	if len(diskConfig.ImageId) > 0 {
+		err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, ownerId, diskConfig.ImageId)
+		if err != nil {
+			return input, err
+		}
+	}
 	if input.ExistingPath != "" && input.Storage == "" {
 		return input, httperrors.NewInputParameterError("disk create from existing disk must give storage")
 	}
@@ -775,7 +781,7 @@ func (self *SDisk) GetManualSnapshotCount() (int, error) {
 		Equals("created_by", api.SNAPSHOT_MANUAL).CountWithError()
 }
 
-func (self *SDisk) getDiskAllocateFromBackupInput(ctx context.Context, backupId string) (*api.DiskAllocateFromBackupInput, error) {
+func (self *SDisk) getDiskAllocateFromBackupInput(ctx context.Context, backupId string, storage *SStorage) (*api.DiskAllocateFromBackupInput, error) {
 	ibackup, err := DiskBackupManager.FetchById(backupId)
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to get backup %s", backupId)
@@ -785,10 +791,22 @@ func (self *SDisk) getDiskAllocateFromBackupInput(ctx context.Context, backupId
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to get backupstorage of backup %s", backupId)
 	}
+	accessInfo, err := bs.GetAccessInfo()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get access info of backupstorage %s", bs.GetId())
+	}
+	chain, err := backup.GetBackupChain()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get backup chain of backup %s", backupId)
+	}
+	if len(chain) > 0 && storage != nil && storage.StorageType != api.STORAGE_LOCAL {
+		return nil, httperrors.NewUnsupportOperationError("recover incremental backup %s to storage %s is not supported", backup.Name, storage.StorageType)
+	}
 	return &api.DiskAllocateFromBackupInput{
 		BackupId:                backupId,
 		BackupStorageId:         bs.GetId(),
-		BackupStorageAccessInfo: jsonutils.Marshal(bs.AccessInfo).(*jsonutils.JSONDict),
+		BackupStorageAccessInfo: accessInfo,
+		BackupChain:             chain,
 	}, nil
 }
 
@@ -804,7 +822,7 @@ func (self *SDisk) StartAllocate(ctx context.Context, host *SHost, storage *SSto
 		SnapshotId: snapshot,
 	}
 	if self.BackupId != "" {
-		allocateInput, err := self.getDiskAllocateFromBackupInput(ctx, self.BackupId)
+		allocateInput, err := self.getDiskAllocateFromBackupInput(ctx, self.BackupId, storage)
 		if err != nil {
 			return errors.Wrap(err, "unable to getDiskAllocateFromBackupInput")
 		}
@@ -1936,6 +1954,13 @@ func fillDiskConfigByBackup(ctx context.Context, userCred mcclient.TokenCredenti
 	if diskConfig.DiskType == "" {
 		diskConfig.DiskType = backup.DiskType
 	}
+	if backup.IsIncremental() {
+		// only local storage is able to synthesize the backup chain
+		if len(diskConfig.Backend) > 0 && diskConfig.Backend != api.STORAGE_LOCAL {
+			return httperrors.NewUnsupportOperationError("recover incremental backup %s to storage %s is not supported", backup.Name, diskConfig.Backend)
+		}
+		diskConfig.Backend = api.STORAGE_LOCAL
+	}
 	diskConfig.BackupId = backup.GetId()
 	return nil
 }
@@ -94,6 +94,70 @@ func (man *SDnsRecordManager) ParseInputInfo(data *jsonutils.JSONDict) ([]string
 			records = append(records, fmt.Sprintf("%s:%s", typ, addr))
 		}
 	}
+	{
+		// - TXT.i, text
+		// - MX.i, host[:preference]
+		// - CAA.i, flag:tag:value, rfc8659
+		parseParam := map[string]func(s string) (string, error){
+			"TXT": func(s string) (string, error) {
+				if err := man.checkRecordValue("TXT", s); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("TXT:%s", s), nil
+			},
+			"MX": func(s string) (string, error) {
+				parts := strings.SplitN(s, ":", 2)
+				if err := man.checkRecordValue("MX", parts[0]); err != nil {
+					return "", err
+				}
+				preference := 10
+				if len(parts) >= 2 {
+					var err error
+					preference, err = strconv.Atoi(parts[1])
+					if err != nil || preference < 0 || preference > 65535 {
+						return "", httperrors.NewNotAcceptableError("MX: invalid preference number: %s", parts[1])
+					}
+				}
+				return fmt.Sprintf("MX:%s:%d", parts[0], preference), nil
+			},
+			"CAA": func(s string) (string, error) {
+				parts := strings.SplitN(s, ":", 3)
+				if len(parts) < 3 {
+					return "", httperrors.NewNotAcceptableError("CAA: insufficient param: %s", s)
+				}
+				flag, err := strconv.Atoi(parts[0])
+				if err != nil || flag < 0 || flag > 255 {
+					return "", httperrors.NewNotAcceptableError("CAA: invalid flag: %s", parts[0])
+				}
+				switch parts[1] {
+				case "issue", "issuewild", "iodef":
+				default:
+					return "", httperrors.NewNotAcceptableError("CAA: unknown tag %q", parts[1])
+				}
+				if err := man.checkRecordValue("CAA", parts[2]); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("CAA:%d:%s:%s", flag, parts[1], parts[2]), nil
+			},
+		}
+		for _, typ := range []string{"TXT", "MX", "CAA"} {
+			for i := 0; ; i++ {
+				key := fmt.Sprintf("%s.%d", typ, i)
+				if !data.Contains(key) {
+					break
+				}
+				val, err := data.GetString(key)
+				if err != nil {
+					return nil, err
+				}
+				rec, err := parseParam[typ](val)
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, rec)
+			}
+		}
+	}
 	{
 		// - SRV.i
 		// - (deprecated) SRV_host and SRV_port
@@ -218,7 +282,8 @@ func (man *SDnsRecordManager) ParseInputInfo(data *jsonutils.JSONDict) ([]string
 func (man *SDnsRecordManager) getRecordsType(recs []string) string {
 	for _, rec := range recs {
 		switch typ := rec[:strings.Index(rec, ":")]; typ {
-		case "A", "AAAA":
+		case "A", "AAAA", "TXT", "MX", "CAA":
+			// address and informational records can be put under the same name
 			return "A"
 		case "CNAME":
 			return "CNAME"
@@ -273,6 +338,17 @@ func (man *SDnsRecordManager) checkRecordValue(typ, val string) error {
 		if regutils.MatchIPAddr(val) {
 			return httperrors.NewNotAcceptableError("%s: %s cannot be ip address: %s", typ, fieldMsg, val)
 		}
+	case "MX":
+		if !regutils.MatchDomainName(val) || regutils.MatchIPAddr(val) {
+			return httperrors.NewNotAcceptableError("MX: mail exchange must be domain name: %s", val)
+		}
+	case "TXT", "CAA":
+		if len(val) == 0 {
+			return httperrors.NewNotAcceptableError("%s: empty record value", typ)
+		}
+		if strings.Contains(val, DNS_RECORDS_SEPARATOR) {
+			return httperrors.NewNotAcceptableError("%s: record value cannot contain %q", typ, DNS_RECORDS_SEPARATOR)
+		}
 	default:
 		// internal error
 		return httperrors.NewNotAcceptableError("%s: unknown record type", typ)
@@ -44,6 +44,17 @@ func TestDnsRecordsParseInputInfo(t *testing.T) {
 			}`),
 			out: []string{"A:1.2.3.4", "A:10.20.30.40", "AAAA:::1"},
 		},
+		{
+			name: "A/TXT/MX/CAA",
+			in: mustJ(`{
+				"A.0": "1.2.3.4",
+				"TXT.0": "v=spf1 mx -all",
+				"MX.0": "mx0.a.com",
+				"MX.1": "mx1.a.com:20",
+				"CAA.0": "0:issue:letsencrypt.org",
+			}`),
+			out: []string{"A:1.2.3.4", "TXT:v=spf1 mx -all", "MX:mx0.a.com:10", "MX:mx1.a.com:20", "CAA:0:issue:letsencrypt.org"},
+		},
 		{
 			name: "SRV",
 			in: mustJ(`{
@@ -96,6 +107,20 @@ func TestDnsRecordsParseInputInfo(t *testing.T) {
 			}`),
 			isErr: true,
 		},
+		{
+			name: "TXT (separator)",
+			in: mustJ(`{
+				"TXT.0": "a,b",
+			}`),
+			isErr: true,
+		},
+		{
+			name: "CAA (bad tag)",
+			in: mustJ(`{
+				"CAA.0": "0:issuer:letsencrypt.org",
+			}`),
+			isErr: true,
+		},
 		{
 			name: "PTR (reversed)",
 			in: mustJ(`{
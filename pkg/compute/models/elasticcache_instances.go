@@ -1213,6 +1213,40 @@ func (self *SElasticcache) StartRestartTask(ctx context.Context, userCred mcclie
 	return nil
 }
 
+func (self *SElasticcache) PerformStart(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(self.Status, []string{api.ELASTIC_CACHE_STATUS_STOPPED, api.ELASTIC_CACHE_STATUS_START_FAILED}) {
+		return nil, httperrors.NewInvalidStatusError("Cannot do start elasticcache instance in status %s", self.Status)
+	}
+	return nil, self.StartElasticcacheStartTask(ctx, userCred, "")
+}
+
+func (self *SElasticcache) StartElasticcacheStartTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	self.SetStatus(userCred, api.ELASTIC_CACHE_STATUS_STARTING, "")
+	task, err := taskman.TaskManager.NewTask(ctx, "ElasticcacheStartTask", self, userCred, jsonutils.NewDict(), parentTaskId, "", nil)
+	if err != nil {
+		return errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+func (self *SElasticcache) PerformStop(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(self.Status, []string{api.ELASTIC_CACHE_STATUS_RUNNING, api.ELASTIC_CACHE_STATUS_STOP_FAILED}) {
+		return nil, httperrors.NewInvalidStatusError("Cannot do stop elasticcache instance in status %s", self.Status)
+	}
+	return nil, self.StartElasticcacheStopTask(ctx, userCred, "")
+}
+
+func (self *SElasticcache) StartElasticcacheStopTask(ctx context.Context, userCred mcclient.TokenCredential, parentTaskId string) error {
+	self.SetStatus(userCred, api.ELASTIC_CACHE_STATUS_STOPPING, "")
+	task, err := taskman.TaskManager.NewTask(ctx, "ElasticcacheStopTask", self, userCred, jsonutils.NewDict(), parentTaskId, "", nil)
+	if err != nil {
+		return errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
 func (self *SElasticcache) ValidateDeleteCondition(ctx context.Context, info jsonutils.JSONObject) error {
 	if self.DisableDelete.IsTrue() {
 		return httperrors.NewInvalidStatusError("Elastic cache is locked, cannot delete")
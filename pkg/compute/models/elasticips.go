@@ -1572,7 +1572,7 @@ func (manager *SElasticipManager) NewEipForVMOnHost(ctx context.Context, userCre
 		panic("unsupported associate type")
 	}
 
-	if (host != nil && host.ManagerId == "") || grp != nil || lb != nil { // kvm
+	if (host != nil && host.ManagerId == "") || (nat != nil && eip.ManagerId == "") || grp != nil || lb != nil { // kvm
 		q := NetworkManager.Query()
 
 		var zoneId string
@@ -1585,6 +1585,16 @@ func (manager *SElasticipManager) NewEipForVMOnHost(ctx context.Context, userCre
 		} else if lb != nil {
 			zone, _ := lb.GetZone()
 			zoneId = zone.Id
+		} else if nat != nil {
+			_net, err := NetworkManager.FetchById(nat.NetworkId)
+			if err != nil {
+				return nil, errors.Wrapf(err, "fetch nat network %s", nat.NetworkId)
+			}
+			zone, _ := _net.(*SNetwork).GetZone()
+			if zone == nil {
+				return nil, errors.Wrapf(errors.ErrNotFound, "zone of nat network %s", nat.NetworkId)
+			}
+			zoneId = zone.Id
 		}
 
 		wireq := WireManager.Query().SubQuery()
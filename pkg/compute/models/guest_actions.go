@@ -903,12 +903,35 @@ func (self *SGuest) StartResumeTask(ctx context.Context, userCred mcclient.Token
 	return self.GetDriver().StartResumeTask(ctx, userCred, self, nil, parentTaskId)
 }
 
+// validateBootImageSignatures checks the image signature policy of the
+// owner domain against the images the server boots from, the policy may be
+// enforced or the image signature revoked after the server was created
+func (self *SGuest) validateBootImageSignatures(ctx context.Context, userCred mcclient.TokenCredential) error {
+	imageIds := []string{}
+	if templateId := self.GetTemplateId(); len(templateId) > 0 {
+		imageIds = append(imageIds, templateId)
+	}
+	if cdrom := self.GetCdrom(); cdrom != nil && len(cdrom.ImageId) > 0 {
+		imageIds = append(imageIds, cdrom.ImageId)
+	}
+	for _, imageId := range imageIds {
+		err := CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, self.GetOwnerId(), imageId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (self *SGuest) PerformStart(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject,
 	data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	if utils.IsInStringArray(self.Status, []string{api.VM_READY, api.VM_START_FAILED, api.VM_SAVE_DISK_FAILED, api.VM_SUSPEND}) {
 		if err := self.ValidateEncryption(ctx, userCred); err != nil {
 			return nil, errors.Wrap(httperrors.ErrForbidden, "encryption key not accessible")
 		}
+		if err := self.validateBootImageSignatures(ctx, userCred); err != nil {
+			return nil, err
+		}
 		if !self.guestDisksStorageTypeIsShared() {
 			host, _ := self.GetHost()
 			guestsMem, err := host.GetNotReadyGuestsMemorySize()
@@ -1117,6 +1140,10 @@ func (self *SGuest) PerformInsertiso(ctx context.Context, userCred mcclient.Toke
 		log.Errorln(err)
 		return nil, err
 	}
+	err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, self.GetOwnerId(), image.Id)
+	if err != nil {
+		return nil, err
+	}
 
 	if utils.IsInStringArray(self.Status, []string{api.VM_RUNNING, api.VM_READY}) {
 		err = self.StartInsertIsoTask(ctx, image.Id, false, self.HostId, userCred, "")
@@ -1590,6 +1617,10 @@ func (self *SGuest) PerformRebuildRoot(ctx context.Context, userCred mcclient.To
 		if err != nil {
 			return nil, err
 		}
+		err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, self.GetOwnerId(), img.Id)
+		if err != nil {
+			return nil, err
+		}
 
 		// compare os arch
 		if len(self.InstanceType) > 0 {
@@ -1766,6 +1797,13 @@ func (self *SGuest) PerformCreatedisk(ctx context.Context, userCred mcclient.Tok
 			logclient.AddActionLogWithContext(ctx, self, logclient.ACT_CREATE, err.Error(), userCred, false)
 			return nil, httperrors.NewBadRequestError("%v", err)
 		}
+		if len(diskInfo.ImageId) > 0 {
+			err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, self.GetOwnerId(), diskInfo.ImageId)
+			if err != nil {
+				logclient.AddActionLogWithContext(ctx, self, logclient.ACT_CREATE, err.Error(), userCred, false)
+				return nil, err
+			}
+		}
 		if len(diskInfo.Backend) == 0 {
 			diskInfo.Backend = self.getDefaultStorageType()
 		}
@@ -2586,6 +2624,37 @@ func (self *SGuest) PerformChangeConfig(ctx context.Context, userCred mcclient.T
 		}
 	}
 
+	if input.Vtpm != nil && *input.Vtpm != self.Vtpm {
+		if self.GetHypervisor() != api.HYPERVISOR_KVM {
+			return nil, httperrors.NewUnsupportOperationError("vtpm is only supported by %s hypervisor", api.HYPERVISOR_KVM)
+		}
+		if *input.Vtpm && self.OsArch == apis.OS_ARCH_AARCH64 {
+			return nil, httperrors.NewUnsupportOperationError("vtpm is not supported on %s", self.OsArch)
+		}
+		if *input.Vtpm && !self.IsEncrypted() {
+			return nil, httperrors.NewUnsupportOperationError("vtpm requires an encrypted server")
+		}
+		if self.Status == api.VM_RUNNING {
+			return nil, httperrors.NewInvalidStatusError("cannot change vtpm in status %s", self.Status)
+		}
+		confs.Add(jsonutils.NewBool(*input.Vtpm), "vtpm")
+	}
+
+	if input.EnableNuma != nil && *input.EnableNuma != self.EnableNuma {
+		if self.GetHypervisor() != api.HYPERVISOR_KVM {
+			return nil, httperrors.NewUnsupportOperationError("numa is only supported by %s hypervisor", api.HYPERVISOR_KVM)
+		}
+		if self.Status == api.VM_RUNNING {
+			return nil, httperrors.NewInvalidStatusError("cannot change numa in status %s", self.Status)
+		}
+		confs.Add(jsonutils.NewBool(*input.EnableNuma), "enable_numa")
+	}
+
+	if self.Status == api.VM_RUNNING && (cpuChanged || memChanged) && self.EnableNuma {
+		// vcpus and memory are bound to NUMA nodes chosen at start
+		return nil, httperrors.NewInvalidStatusError("cannot change CPU/Memory spec of NUMA enabled guest in status %s", self.Status)
+	}
+
 	if self.Status == api.VM_RUNNING && (cpuChanged || memChanged) && self.GetDriver().NeedStopForChangeSpec(ctx, self, cpuChanged, memChanged) {
 		return nil, httperrors.NewInvalidStatusError("cannot change CPU/Memory spec in status %s", self.Status)
 	}
@@ -4823,6 +4892,12 @@ func (self *SGuest) PerformInstanceSnapshot(
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to inherit from guest %s to instance snapshot %s", self.GetId(), instanceSnapshot.GetId())
 	}
+	if len(input.Metadata) > 0 {
+		_, err = instanceSnapshot.PerformMetadata(ctx, userCred, nil, input.Metadata)
+		if err != nil {
+			return nil, errors.Wrapf(err, "set metadata of instance snapshot %s", instanceSnapshot.GetId())
+		}
+	}
 	err = self.InstaceCreateSnapshot(ctx, userCred, instanceSnapshot, pendingUsage)
 	if err != nil {
 		quotas.CancelPendingUsage(
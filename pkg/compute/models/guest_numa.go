@@ -0,0 +1,352 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"sort"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	hostapi "yunion.io/x/onecloud/pkg/apis/host"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/util/cgrouputils/cpuset"
+)
+
+// SHostNumaNode is the free capacity of a host NUMA node
+type SHostNumaNode struct {
+	NodeId int `json:"node_id"`
+	// logical cpus of the node not reserved by host
+	Cpus      []int `json:"cpus"`
+	CpuCount  int   `json:"cpu_count"`
+	MemSizeMb int   `json:"mem_size_mb"`
+}
+
+// SHostNumaNodes is the free capacity of all NUMA nodes of a host, memory of
+// a virtual node is aligned to MemAlignMb, e.g. the size of hugepage
+type SHostNumaNodes struct {
+	MemAlignMb int             `json:"mem_align_mb"`
+	Nodes      []SHostNumaNode `json:"nodes"`
+}
+
+func (host *SHost) getNumaNodes() ([]hostapi.HostNumaNode, error) {
+	if host.SysInfo == nil || !host.SysInfo.Contains("numa_nodes") {
+		return nil, nil
+	}
+	nodes := []hostapi.HostNumaNode{}
+	if err := host.SysInfo.Unmarshal(&nodes, "numa_nodes"); err != nil {
+		return nil, errors.Wrap(err, "unmarshal numa_nodes of sys_info")
+	}
+	return nodes, nil
+}
+
+func (host *SHost) isNativeHugepagesEnabled() bool {
+	if host.SysInfo == nil {
+		return false
+	}
+	opt, _ := host.SysInfo.GetString("hugepages_option")
+	return opt == "native"
+}
+
+func (host *SHost) getReservedCpus(ctx context.Context) cpuset.CPUSet {
+	info := host.GetMetadata(ctx, api.HOSTMETA_RESERVED_CPUS_INFO, nil)
+	if len(info) == 0 {
+		return cpuset.NewCPUSet()
+	}
+	input := api.HostReserveCpusInput{}
+	obj, err := jsonutils.ParseString(info)
+	if err == nil {
+		err = obj.Unmarshal(&input)
+	}
+	if err != nil {
+		log.Errorf("parse host %s reserved cpus info %s: %s", host.Name, info, err)
+		return cpuset.NewCPUSet()
+	}
+	cpus, err := cpuset.Parse(input.Cpus)
+	if err != nil {
+		log.Errorf("parse host %s reserved cpus %s: %s", host.Name, input.Cpus, err)
+		return cpuset.NewCPUSet()
+	}
+	return cpus
+}
+
+// GetNumaNodesFree calculates the free capacity of host NUMA nodes used by guests.
+// Guests with NUMA placement on host take resources of their bound nodes, resources
+// of other guests are taken from all nodes proportionally as the kernel spreads them.
+func (host *SHost) GetNumaNodesFree(ctx context.Context, guests []SGuest) (*SHostNumaNodes, error) {
+	hostNodes, err := host.getNumaNodes()
+	if err != nil {
+		return nil, err
+	}
+	if len(hostNodes) == 0 {
+		return nil, errors.Wrapf(httperrors.ErrNotSupported, "host %s doesn't report NUMA topology", host.Name)
+	}
+
+	ret := &SHostNumaNodes{MemAlignMb: 1}
+	hugepages := host.isNativeHugepagesEnabled()
+	if hugepages {
+		if sizeKb, _ := host.SysInfo.Int("hugepage_size_kb"); sizeKb >= 1024 {
+			ret.MemAlignMb = int(sizeKb / 1024)
+		}
+	}
+	reservedCpus := host.getReservedCpus(ctx)
+	cpuBound := host.GetCPUOvercommitBound()
+	memBound := host.GetMemoryOvercommitBound()
+	totalMem := 0
+	for _, node := range hostNodes {
+		totalMem += node.MemSizeMb
+	}
+
+	nodeIdx := map[int]int{}
+	cpuCaps, memCaps := []int{}, []int{}
+	totalCpuCount, totalMemSize := 0, 0
+	for _, node := range hostNodes {
+		free := SHostNumaNode{NodeId: node.NodeId, Cpus: []int{}}
+		for _, cpu := range node.Cpus {
+			if !reservedCpus.Contains(cpu) {
+				free.Cpus = append(free.Cpus, cpu)
+			}
+		}
+		free.CpuCount = int(float32(len(free.Cpus)) * cpuBound)
+		if hugepages {
+			free.MemSizeMb = node.HugepagesMb
+		} else {
+			memSize := node.MemSizeMb
+			if totalMem > 0 && host.MemReserved > 0 {
+				memSize -= host.MemReserved * node.MemSizeMb / totalMem
+			}
+			free.MemSizeMb = int(float32(memSize) * memBound)
+		}
+		cpuCaps = append(cpuCaps, free.CpuCount)
+		memCaps = append(memCaps, free.MemSizeMb)
+		totalCpuCount += free.CpuCount
+		totalMemSize += free.MemSizeMb
+		nodeIdx[node.NodeId] = len(ret.Nodes)
+		ret.Nodes = append(ret.Nodes, free)
+	}
+
+	unboundCpu, unboundMem := 0, 0
+	for i := range guests {
+		guest := &guests[i]
+		if guest.EnableNuma && guest.NumaPlacement != nil && guest.NumaPlacement.HostId == host.Id {
+			for _, node := range guest.NumaPlacement.Nodes {
+				if idx, ok := nodeIdx[node.HostNodeId]; ok {
+					ret.Nodes[idx].CpuCount -= node.VcpuCount
+					ret.Nodes[idx].MemSizeMb -= node.MemSizeMb
+				}
+			}
+			continue
+		}
+		unboundCpu += guest.VcpuCount
+		unboundMem += guest.VmemSize
+	}
+	for i := range ret.Nodes {
+		if totalCpuCount > 0 {
+			ret.Nodes[i].CpuCount -= unboundCpu * cpuCaps[i] / totalCpuCount
+		}
+		if totalMemSize > 0 {
+			ret.Nodes[i].MemSizeMb -= unboundMem * memCaps[i] / totalMemSize
+		}
+	}
+	return ret, nil
+}
+
+func splitEvenly(total, n int) []int {
+	ret := make([]int, n)
+	for i := range ret {
+		ret[i] = total / n
+		if i < total%n {
+			ret[i] += 1
+		}
+	}
+	return ret
+}
+
+func (nodes *SHostNumaNodes) sortedByFree() []int {
+	idx := make([]int, len(nodes.Nodes))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		n1, n2 := nodes.Nodes[idx[i]], nodes.Nodes[idx[j]]
+		if n1.MemSizeMb != n2.MemSizeMb {
+			return n1.MemSizeMb > n2.MemSizeMb
+		}
+		return n1.CpuCount > n2.CpuCount
+	})
+	return idx
+}
+
+// Allocate places a guest on as few nodes as possible, vcpus and memory are
+// split evenly across the nodes with most free memory
+func (nodes *SHostNumaNodes) Allocate(vcpuCount, memSizeMb int) ([]api.GuestNumaNode, error) {
+	align := nodes.MemAlignMb
+	if align <= 0 {
+		align = 1
+	}
+	sorted := nodes.sortedByFree()
+	for n := 1; n <= len(sorted) && n <= vcpuCount; n++ {
+		vcpus := splitEvenly(vcpuCount, n)
+		mems := splitEvenly(memSizeMb/align, n)
+		for i := range mems {
+			mems[i] *= align
+		}
+		mems[0] += memSizeMb % align
+
+		fit := true
+		for i := 0; i < n; i++ {
+			node := nodes.Nodes[sorted[i]]
+			if node.CpuCount < vcpus[i] || node.MemSizeMb < mems[i] || mems[i] == 0 {
+				fit = false
+				break
+			}
+		}
+		if !fit {
+			continue
+		}
+		ret := make([]api.GuestNumaNode, n)
+		for i := 0; i < n; i++ {
+			ret[i] = api.GuestNumaNode{
+				HostNodeId: nodes.Nodes[sorted[i]].NodeId,
+				VcpuCount:  vcpus[i],
+				MemSizeMb:  mems[i],
+			}
+		}
+		sort.Slice(ret, func(i, j int) bool {
+			return ret[i].HostNodeId < ret[j].HostNodeId
+		})
+		return ret, nil
+	}
+	return nil, errors.Wrapf(httperrors.ErrInsufficientResource, "no NUMA nodes fit %d vcpus and %dMB memory", vcpuCount, memSizeMb)
+}
+
+// AllocateLike places virtual nodes of layout on distinct host nodes, the
+// guest visible topology is kept e.g. when the guest is live migrated
+func (nodes *SHostNumaNodes) AllocateLike(layout []api.GuestNumaNode) ([]api.GuestNumaNode, error) {
+	if len(layout) > len(nodes.Nodes) {
+		return nil, errors.Wrapf(httperrors.ErrInsufficientResource, "host has %d NUMA nodes, less than %d", len(nodes.Nodes), len(layout))
+	}
+	order := make([]int, len(layout))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return layout[order[i]].MemSizeMb > layout[order[j]].MemSizeMb
+	})
+	sorted := nodes.sortedByFree()
+	used := map[int]bool{}
+	ret := make([]api.GuestNumaNode, len(layout))
+	for _, i := range order {
+		found := false
+		for _, idx := range sorted {
+			node := nodes.Nodes[idx]
+			if used[idx] || node.CpuCount < layout[i].VcpuCount || node.MemSizeMb < layout[i].MemSizeMb {
+				continue
+			}
+			used[idx] = true
+			ret[i] = layout[i]
+			ret[i].HostNodeId = node.NodeId
+			found = true
+			break
+		}
+		if !found {
+			return nil, errors.Wrapf(httperrors.ErrInsufficientResource, "no NUMA node fits %d vcpus and %dMB memory", layout[i].VcpuCount, layout[i].MemSizeMb)
+		}
+	}
+	return ret, nil
+}
+
+// Use takes resources of placed virtual nodes from host nodes
+func (nodes *SHostNumaNodes) Use(placed []api.GuestNumaNode) {
+	for _, p := range placed {
+		for i := range nodes.Nodes {
+			if nodes.Nodes[i].NodeId == p.HostNodeId {
+				nodes.Nodes[i].CpuCount -= p.VcpuCount
+				nodes.Nodes[i].MemSizeMb -= p.MemSizeMb
+			}
+		}
+	}
+}
+
+func (nodes *SHostNumaNodes) Copy() *SHostNumaNodes {
+	ret := &SHostNumaNodes{
+		MemAlignMb: nodes.MemAlignMb,
+		Nodes:      make([]SHostNumaNode, len(nodes.Nodes)),
+	}
+	copy(ret.Nodes, nodes.Nodes)
+	return ret
+}
+
+// getNumaNodesFreeForGuest returns free capacity of host NUMA nodes excluding the guest itself,
+// stopped guests don't take any resources of nodes
+func (self *SGuest) getNumaNodesFreeForGuest(ctx context.Context, host *SHost) (*SHostNumaNodes, error) {
+	guests, err := host.GetGuests()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetGuests")
+	}
+	others := []SGuest{}
+	for i := range guests {
+		if guests[i].Id == self.Id || guests[i].Status == api.VM_READY {
+			continue
+		}
+		others = append(others, guests[i])
+	}
+	return host.GetNumaNodesFree(ctx, others)
+}
+
+func (self *SGuest) SetNumaPlacement(placement *api.GuestNumaPlacement) error {
+	_, err := db.Update(self, func() error {
+		self.NumaPlacement = placement
+		return nil
+	})
+	return err
+}
+
+// AllocateNumaPlacement chooses host NUMA nodes for guest before it is started on host
+func (self *SGuest) AllocateNumaPlacement(ctx context.Context, host *SHost) error {
+	if !self.EnableNuma {
+		return nil
+	}
+	nodes, err := self.getNumaNodesFreeForGuest(ctx, host)
+	if err != nil {
+		return errors.Wrap(err, "getNumaNodesFreeForGuest")
+	}
+	placed, err := nodes.Allocate(self.VcpuCount, self.VmemSize)
+	if err != nil {
+		return errors.Wrapf(err, "allocate NUMA nodes on host %s", host.Name)
+	}
+	return self.SetNumaPlacement(&api.GuestNumaPlacement{HostId: host.Id, Nodes: placed})
+}
+
+// GetNumaPlacementLikeAtHost maps the current virtual NUMA nodes of a running guest onto
+// another host, nil is returned if the guest is not bound to NUMA nodes
+func (self *SGuest) GetNumaPlacementLikeAtHost(ctx context.Context, host *SHost) (*api.GuestNumaPlacement, error) {
+	if !self.EnableNuma || self.NumaPlacement == nil || len(self.NumaPlacement.Nodes) == 0 {
+		return nil, nil
+	}
+	nodes, err := self.getNumaNodesFreeForGuest(ctx, host)
+	if err != nil {
+		return nil, errors.Wrap(err, "getNumaNodesFreeForGuest")
+	}
+	placed, err := nodes.AllocateLike(self.NumaPlacement.Nodes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "allocate NUMA nodes on host %s", host.Name)
+	}
+	return &api.GuestNumaPlacement{HostId: host.Id, Nodes: placed}, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"reflect"
+	"testing"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+func TestSplitEvenly(t *testing.T) {
+	cases := []struct {
+		total int
+		n     int
+		want  []int
+	}{
+		{8, 1, []int{8}},
+		{8, 2, []int{4, 4}},
+		{7, 2, []int{4, 3}},
+		{10, 3, []int{4, 3, 3}},
+	}
+	for _, c := range cases {
+		got := splitEvenly(c.total, c.n)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitEvenly(%d, %d) want %v, got %v", c.total, c.n, c.want, got)
+		}
+	}
+}
+
+func TestSHostNumaNodes_Allocate(t *testing.T) {
+	newNodes := func() *SHostNumaNodes {
+		return &SHostNumaNodes{
+			MemAlignMb: 2,
+			Nodes: []SHostNumaNode{
+				{NodeId: 0, CpuCount: 8, MemSizeMb: 8192},
+				{NodeId: 1, CpuCount: 8, MemSizeMb: 16384},
+			},
+		}
+	}
+	cases := []struct {
+		name    string
+		vcpu    int
+		mem     int
+		want    []api.GuestNumaNode
+		wantErr bool
+	}{
+		{
+			name: "fit in node with most free memory",
+			vcpu: 4,
+			mem:  10240,
+			want: []api.GuestNumaNode{{HostNodeId: 1, VcpuCount: 4, MemSizeMb: 10240}},
+		},
+		{
+			name: "split across nodes",
+			vcpu: 12,
+			mem:  16386,
+			want: []api.GuestNumaNode{
+				{HostNodeId: 0, VcpuCount: 6, MemSizeMb: 8192},
+				{HostNodeId: 1, VcpuCount: 6, MemSizeMb: 8194},
+			},
+		},
+		{
+			name:    "insufficient",
+			vcpu:    4,
+			mem:     32768,
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := newNodes().Allocate(c.vcpu, c.mem)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Allocate: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("want %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestSHostNumaNodes_AllocateLike(t *testing.T) {
+	nodes := &SHostNumaNodes{
+		Nodes: []SHostNumaNode{
+			{NodeId: 0, CpuCount: 4, MemSizeMb: 4096},
+			{NodeId: 1, CpuCount: 8, MemSizeMb: 8192},
+			{NodeId: 2, CpuCount: 8, MemSizeMb: 2048},
+		},
+	}
+	layout := []api.GuestNumaNode{
+		{HostNodeId: 3, VcpuCount: 2, MemSizeMb: 2048},
+		{HostNodeId: 5, VcpuCount: 2, MemSizeMb: 6144},
+	}
+	got, err := nodes.AllocateLike(layout)
+	if err != nil {
+		t.Fatalf("AllocateLike: %v", err)
+	}
+	want := []api.GuestNumaNode{
+		{HostNodeId: 0, VcpuCount: 2, MemSizeMb: 2048},
+		{HostNodeId: 1, VcpuCount: 2, MemSizeMb: 6144},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	nodes.Use(got)
+	if _, err := nodes.AllocateLike(layout); err == nil {
+		t.Errorf("want error after nodes are used")
+	}
+}
@@ -221,6 +221,9 @@ type IGuestDriver interface {
 
 	RequestCPUSet(ctx context.Context, userCred mcclient.TokenCredential, host *SHost, guest *SGuest, input *api.ServerCPUSetInput) (*api.ServerCPUSetResp, error)
 	RequestCPUSetRemove(ctx context.Context, userCred mcclient.TokenCredential, host *SHost, guest *SGuest, input *api.ServerCPUSetRemoveInput) error
+
+	RequestFetchVtpmState(ctx context.Context, userCred mcclient.TokenCredential, host *SHost, guest *SGuest) (string, error)
+	RequestRestoreVtpmState(ctx context.Context, userCred mcclient.TokenCredential, host *SHost, guest *SGuest, state string) error
 }
 
 var guestDrivers map[string]IGuestDriver
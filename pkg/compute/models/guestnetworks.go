@@ -34,6 +34,7 @@ import (
 	"yunion.io/x/onecloud/pkg/compute/options"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/netutils2"
 	randutil "yunion.io/x/onecloud/pkg/util/rand"
 	"yunion.io/x/onecloud/pkg/util/rbacutils"
 	"yunion.io/x/onecloud/pkg/util/stringutils2"
@@ -224,6 +225,7 @@ type newGuestNetworkArgs struct {
 	index int8
 
 	ipAddr              string
+	ip6Addr             string
 	allocDir            api.IPAllocationDirection
 	tryReserved         bool
 	requireDesignatedIP bool
@@ -252,6 +254,7 @@ func (manager *SGuestnetworkManager) newGuestNetwork(
 		network              = args.network
 		index                = args.index
 		address              = args.ipAddr
+		address6             = args.ip6Addr
 		mac                  = args.macAddr
 		driver               = args.nicDriver
 		numQueues            = args.numQueues
@@ -322,6 +325,25 @@ func (manager *SGuestnetworkManager) newGuestNetwork(
 			gn.IpAddr = ipAddr
 		}
 
+		if vpc.Id != api.DEFAULT_VPC_ID && provider == api.CLOUD_PROVIDER_ONECLOUD && network.HasIPv6() {
+			if len(address6) > 0 {
+				addr6, err := netutils2.ParseIPV6Addr(address6)
+				if err != nil {
+					return nil, httperrors.NewInputParameterError("%v", err)
+				}
+				address6 = addr6.String()
+			}
+			// network is locked above
+			ip6Addr, err := network.GetFreeIP6(address6)
+			if err != nil {
+				return nil, errors.Wrap(err, "GetFreeIP6")
+			}
+			if len(address6) > 0 && ip6Addr != address6 && requiredDesignatedIp {
+				return nil, fmt.Errorf("candidate ipv6 %s is occupied!", address6)
+			}
+			gn.Ip6Addr = ip6Addr
+		}
+
 		if vpc.Id != api.DEFAULT_VPC_ID && provider == api.CLOUD_PROVIDER_ONECLOUD {
 			var err error
 			GuestnetworkManager.lockAllocMappedAddr(ctx)
@@ -141,6 +141,12 @@ type SGuest struct {
 	Vdi     string `width:"36" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
 	Machine string `width:"36" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
 	Bios    string `width:"36" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
+	// 是否启用虚拟TPM
+	Vtpm bool `default:"false" list:"user" create:"optional"`
+	// 是否启用NUMA感知调度
+	EnableNuma bool `default:"false" list:"user" create:"optional"`
+	// 虚拟NUMA节点在宿主机上的分布
+	NumaPlacement *api.GuestNumaPlacement `nullable:"true" list:"user"`
 	// 操作系统类型
 	OsType string `width:"36" charset:"ascii" nullable:"true" list:"user" create:"optional"`
 
@@ -1348,6 +1354,12 @@ func (manager *SGuestManager) validateCreateData(
 			if imgProperties[imageapi.IMAGE_DISK_FORMAT] == "iso" {
 				return nil, httperrors.NewInputParameterError("System disk does not support iso image, please consider using cdrom parameter")
 			}
+			if len(diskConfig.ImageId) > 0 {
+				err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, ownerId, diskConfig.ImageId)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
 		if input.Cdrom != "" {
 			cdromStr := input.Cdrom
@@ -1355,6 +1367,10 @@ func (manager *SGuestManager) validateCreateData(
 			if err != nil {
 				return nil, httperrors.NewInputParameterError("parse cdrom device info error %s", err)
 			}
+			err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, ownerId, image.Id)
+			if err != nil {
+				return nil, err
+			}
 			input.Cdrom = image.Id
 			if len(imgProperties) == 0 {
 				imgProperties = image.Properties
@@ -1448,6 +1464,21 @@ func (manager *SGuestManager) validateCreateData(
 	}
 
 	hypervisor = input.Hypervisor
+	if input.Vtpm {
+		if hypervisor != api.HYPERVISOR_KVM {
+			return nil, httperrors.NewInputParameterError("vtpm is only supported by %s hypervisor", api.HYPERVISOR_KVM)
+		}
+		if input.OsArch == apis.OS_ARCH_AARCH64 {
+			return nil, httperrors.NewInputParameterError("vtpm is not supported on %s", input.OsArch)
+		}
+		// vTPM state is encrypted by the guest key whenever it leaves the host
+		if !input.NeedEncrypt() {
+			return nil, httperrors.NewInputParameterError("vtpm requires an encrypted server, please specify encrypt_key_id or encrypt_key_new")
+		}
+	}
+	if input.EnableNuma && hypervisor != api.HYPERVISOR_KVM {
+		return nil, httperrors.NewInputParameterError("numa is only supported by %s hypervisor", api.HYPERVISOR_KVM)
+	}
 	if hypervisor != api.HYPERVISOR_CONTAINER {
 		// support sku here
 		var sku *SServerSku
@@ -1538,6 +1569,12 @@ func (manager *SGuestManager) validateCreateData(
 			if err != nil {
 				return nil, httperrors.NewInputParameterError("parse disk description error %s", err)
 			}
+			if len(diskConfig.ImageId) > 0 {
+				err = CachedimageManager.ValidateImageSignaturePolicy(ctx, userCred, ownerId, diskConfig.ImageId)
+				if err != nil {
+					return nil, err
+				}
+			}
 			if diskConfig.DiskType == api.DISK_TYPE_SYS {
 				log.Warningf("Snapshot error: disk index %d > 0 but disk type is %s", i+1, api.DISK_TYPE_SYS)
 				diskConfig.DiskType = api.DISK_TYPE_DATA
@@ -2550,6 +2587,9 @@ func (self *SGuest) getSecurityGroupsRules() string {
 	}
 	rules := []string{}
 	for _, rule := range secrules {
+		if rule.IsIPv6() {
+			continue
+		}
 		rules = append(rules, rule.String())
 	}
 	return strings.Join(rules, SECURITY_GROUP_SEPARATOR)
@@ -2990,6 +3030,7 @@ type Attach2NetworkArgs struct {
 	Network *SNetwork
 
 	IpAddr              string
+	Ip6Addr             string
 	AllocDir            api.IPAllocationDirection
 	TryReserved         bool
 	RequireDesignatedIP bool
@@ -3013,6 +3054,7 @@ func (args *Attach2NetworkArgs) onceArgs(i int) attach2NetworkOnceArgs {
 		network: args.Network,
 
 		ipAddr:              args.IpAddr,
+		ip6Addr:             args.Ip6Addr,
 		allocDir:            args.AllocDir,
 		tryReserved:         args.TryReserved,
 		requireDesignatedIP: args.RequireDesignatedIP,
@@ -3029,6 +3071,7 @@ func (args *Attach2NetworkArgs) onceArgs(i int) attach2NetworkOnceArgs {
 	}
 	if i > 0 {
 		r.ipAddr = ""
+		r.ip6Addr = ""
 		r.bwLimit = 0
 		r.virtual = true
 		r.tryReserved = false
@@ -3045,6 +3088,7 @@ type attach2NetworkOnceArgs struct {
 	network *SNetwork
 
 	ipAddr              string
+	ip6Addr             string
 	allocDir            api.IPAllocationDirection
 	tryReserved         bool
 	requireDesignatedIP bool
@@ -3114,6 +3158,7 @@ func (self *SGuest) attach2NetworkOnce(
 		index: index,
 
 		ipAddr:              args.ipAddr,
+		ip6Addr:             args.ip6Addr,
 		allocDir:            args.allocDir,
 		tryReserved:         args.tryReserved,
 		requireDesignatedIP: args.requireDesignatedIP,
@@ -3772,6 +3817,7 @@ func (self *SGuest) attach2NamedNetworkDesc(ctx context.Context, userCred mcclie
 			Network:             net,
 			PendingUsage:        pendingUsage,
 			IpAddr:              netConfig.Address,
+			Ip6Addr:             netConfig.Address6,
 			NicDriver:           netConfig.Driver,
 			NumQueues:           netConfig.NumQueues,
 			BwLimit:             netConfig.BwLimit,
@@ -4187,6 +4233,25 @@ func (self *SGuest) isNeedDoResetPasswd() bool {
 	return true
 }
 
+// getCreateVtpmState returns vTPM state saved in the instance snapshot or backup the guest is created from
+func (self *SGuest) getCreateVtpmState(params *jsonutils.JSONDict) (string, error) {
+	if ispId, _ := params.GetString("instance_snapshot_id"); len(ispId) > 0 {
+		isp, err := InstanceSnapshotManager.FetchById(ispId)
+		if err != nil {
+			return "", errors.Wrapf(err, "fetch instance snapshot %s", ispId)
+		}
+		return isp.(*SInstanceSnapshot).VtpmState, nil
+	}
+	if ibId, _ := params.GetString("instance_backup_id"); len(ibId) > 0 {
+		ib, err := InstanceBackupManager.FetchById(ibId)
+		if err != nil {
+			return "", errors.Wrapf(err, "fetch instance backup %s", ibId)
+		}
+		return ib.(*SInstanceBackup).VtpmState, nil
+	}
+	return "", nil
+}
+
 func (self *SGuest) GetDeployConfigOnHost(ctx context.Context, userCred mcclient.TokenCredential, host *SHost, params *jsonutils.JSONDict) (*jsonutils.JSONDict, error) {
 	config := jsonutils.NewDict()
 
@@ -4212,6 +4277,16 @@ func (self *SGuest) GetDeployConfigOnHost(ctx context.Context, userCred mcclient
 
 	config.Add(jsonutils.NewBool(jsonutils.QueryBoolean(params, "enable_cloud_init", false)), "enable_cloud_init")
 
+	if deployAction == "create" && self.Vtpm {
+		vtpmState, err := self.getCreateVtpmState(params)
+		if err != nil {
+			return nil, errors.Wrap(err, "getCreateVtpmState")
+		}
+		if len(vtpmState) > 0 {
+			config.Set("vtpm_state", jsonutils.NewString(vtpmState))
+		}
+	}
+
 	if account, _ := params.GetString("login_account"); len(account) > 0 {
 		config.Set("login_account", jsonutils.NewString(account))
 	}
@@ -4327,6 +4402,7 @@ func (self *SGuest) GetJsonDescAtHypervisor(ctx context.Context, host *SHost) *a
 		Machine:     self.getMachine(),
 		Bios:        self.getBios(),
 		BootOrder:   self.BootOrder,
+		Vtpm:        self.Vtpm,
 		SrcIpCheck:  self.SrcIpCheck.Bool(),
 		SrcMacCheck: self.SrcMacCheck.Bool(),
 		HostId:      host.Id,
@@ -4346,6 +4422,10 @@ func (self *SGuest) GetJsonDescAtHypervisor(ctx context.Context, host *SHost) *a
 		}
 	}
 
+	if self.EnableNuma && self.NumaPlacement != nil && self.NumaPlacement.HostId == host.Id {
+		desc.NumaNodes = self.NumaPlacement.Nodes
+	}
+
 	// isolated devices
 	isolatedDevs, _ := self.GetIsolatedDevices()
 	for _, dev := range isolatedDevs {
@@ -5397,6 +5477,7 @@ func (self *SGuest) ToSchedDesc() *schedapi.ScheduleInput {
 	}*/
 
 	config.Hypervisor = self.GetHypervisor()
+	config.EnableNuma = self.EnableNuma
 	desc.ServerConfig = *config
 	desc.OsArch = self.OsArch
 	return desc
@@ -5542,6 +5623,8 @@ func (self *SGuest) ToCreateInput(ctx context.Context, userCred mcclient.TokenCr
 	userInput.Vga = genInput.Vga
 	userInput.Vdi = genInput.Vdi
 	userInput.Bios = genInput.Bios
+	userInput.Vtpm = genInput.Vtpm
+	userInput.EnableNuma = genInput.EnableNuma
 	userInput.Cdrom = genInput.Cdrom
 	userInput.Description = genInput.Description
 	userInput.BootOrder = genInput.BootOrder
@@ -5594,6 +5677,7 @@ func (self *SGuest) toCreateInput() *api.ServerCreateInput {
 	r.Vga = self.Vga
 	r.Vdi = self.Vdi
 	r.Bios = self.Bios
+	r.Vtpm = self.Vtpm
 	r.Description = self.Description
 	r.BootOrder = self.BootOrder
 	r.DisableDelete = new(bool)
@@ -5605,6 +5689,7 @@ func (self *SGuest) toCreateInput() *api.ServerCreateInput {
 
 	r.ServerConfigs = new(api.ServerConfigs)
 	r.Hypervisor = self.Hypervisor
+	r.EnableNuma = self.EnableNuma
 	r.InstanceType = self.InstanceType
 	r.ProjectId = self.ProjectId
 	r.ProjectDomainId = self.DomainId
@@ -75,6 +75,8 @@ type SInstanceBackup struct {
 	InstanceType string `width:"64" charset:"utf8" nullable:"true" list:"user" create:"optional"`
 	// 主机备份容量和
 	SizeMb int `nullable:"false" list:"user"`
+	// 虚拟TPM状态, 经主机加密密钥加密后base64编码
+	VtpmState string `length:"medium" charset:"ascii" nullable:"true"`
 }
 
 type SInstanceBackupManager struct {
@@ -403,6 +405,9 @@ func (self *SInstanceBackup) ToInstanceCreateInput(sourceInput *api.ServerCreate
 	if sourceInput.Bios == "" {
 		sourceInput.Bios = createInput.Bios
 	}
+	if !sourceInput.Vtpm {
+		sourceInput.Vtpm = createInput.Vtpm
+	}
 	if sourceInput.BootOrder == "" {
 		sourceInput.BootOrder = createInput.BootOrder
 	}
@@ -500,6 +505,17 @@ func (self *SInstanceBackup) PerformPack(ctx context.Context, userCred mcclient.
 	if input.PackageName == "" {
 		return nil, httperrors.NewMissingParameterError("miss package_name")
 	}
+	backups, err := self.GetBackups()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBackups")
+	}
+	for i := range backups {
+		// the package is unpacked to standalone backups, which can not
+		// refer to the backup chain in the source backup storage
+		if backups[i].IsIncremental() {
+			return nil, httperrors.NewUnsupportOperationError("pack incremental disk backup %s is not supported", backups[i].Name)
+		}
+	}
 	self.SetStatus(userCred, api.INSTANCE_BACKUP_STATUS_PACK, "")
 	params := jsonutils.NewDict()
 	params.Set("package_name", jsonutils.NewString(input.PackageName))
@@ -558,6 +574,7 @@ func (self *SInstanceBackup) PackMetadata(ctx context.Context, userCred mcclient
 		OsType:         self.OsType,
 		InstanceType:   self.InstanceType,
 		SizeMb:         self.SizeMb,
+		VtpmState:      self.VtpmState,
 
 		EncryptKeyId: self.EncryptKeyId,
 		Metadata:     allMetadata,
@@ -642,6 +659,7 @@ func (ib *SInstanceBackup) FillFromPackMetadata(ctx context.Context, userCred mc
 		ib.OsType = metadata.OsType
 		ib.InstanceType = metadata.InstanceType
 		ib.SizeMb = metadata.SizeMb
+		ib.VtpmState = metadata.VtpmState
 
 		ib.EncryptKeyId = metadata.EncryptKeyId
 		return nil
@@ -91,6 +91,10 @@ type SInstanceSnapshot struct {
 	MemoryFilePath string `width:"512" charset:"utf8" nullable:"true" get:"user" list:"user"`
 	// 内存文件校验和
 	MemoryFileChecksum string `width:"32" charset:"ascii" nullable:"true" get:"user" list:"user"`
+	// 是否启用虚拟TPM
+	Vtpm bool `default:"false" get:"user" list:"user"`
+	// 虚拟TPM状态, 经主机加密密钥加密后base64编码
+	VtpmState string `length:"medium" charset:"ascii" nullable:"true"`
 }
 
 type SInstanceSnapshotManager struct {
@@ -387,6 +391,7 @@ func (manager *SInstanceSnapshotManager) fillInstanceSnapshot(ctx context.Contex
 	}
 	instanceSnapshot.OsType = guest.OsType
 	instanceSnapshot.OsArch = guest.OsArch
+	instanceSnapshot.Vtpm = guest.Vtpm
 	instanceSnapshot.ServerMetadata = serverMetadata
 }
 
@@ -475,6 +480,9 @@ func (self *SInstanceSnapshot) ToInstanceCreateInput(
 	}
 	sourceInput.OsType = self.OsType
 	sourceInput.InstanceType = self.InstanceType
+	if self.Vtpm {
+		sourceInput.Vtpm = true
+	}
 	if len(sourceInput.Networks) == 0 {
 		sourceInput.Networks = serverConfig.Networks
 	}
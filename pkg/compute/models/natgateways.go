@@ -724,6 +724,12 @@ func (self *SNatGateway) GetVpc() (*SVpc, error) {
 	return vpc.(*SVpc), nil
 }
 
+// IsManaged returns false for nat gateway of onecloud vpc, which is realized
+// by vpcagent instead of cloud provider
+func (self *SNatGateway) IsManaged() bool {
+	return len(self.GetCloudproviderId()) > 0
+}
+
 func (self *SNatGateway) GetINatGateway(ctx context.Context) (cloudprovider.ICloudNatGateway, error) {
 	vpc, err := self.GetVpc()
 	if err != nil {
@@ -50,6 +50,7 @@ import (
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 	"yunion.io/x/onecloud/pkg/util/billing"
 	"yunion.io/x/onecloud/pkg/util/logclient"
+	"yunion.io/x/onecloud/pkg/util/netutils2"
 	"yunion.io/x/onecloud/pkg/util/rand"
 	"yunion.io/x/onecloud/pkg/util/rbacutils"
 	"yunion.io/x/onecloud/pkg/util/stringutils2"
@@ -107,13 +108,15 @@ type SNetwork struct {
 
 	GuestDomain string `width:"128" charset:"ascii" nullable:"true" get:"user" update:"user"`
 
-	GuestIp6Start string `width:"64" charset:"ascii" nullable:"true"`
-	GuestIp6End   string `width:"64" charset:"ascii" nullable:"true"`
-	GuestIp6Mask  int8   `nullable:"true"`
-	GuestGateway6 string `width:"64" charset:"ascii" nullable:"true"`
-	GuestDns6     string `width:"64" charset:"ascii" nullable:"true"`
+	// IPv6 address range of guest, only supported by vpc networks for now
+	GuestIp6Start string `width:"64" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
+	GuestIp6End   string `width:"64" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
+	GuestIp6Mask  int8   `nullable:"true" list:"user" update:"user" create:"optional"`
+	GuestGateway6 string `width:"64" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
+	// IPv6 DNS, allow multiple dns, seperated by ","
+	GuestDns6 string `width:"64" charset:"ascii" nullable:"true" list:"user" update:"user" create:"optional"`
 
-	GuestDomain6 string `width:"128" charset:"ascii" nullable:"true"`
+	GuestDomain6 string `width:"128" charset:"ascii" nullable:"true" get:"user" update:"user"`
 
 	VlanId int `nullable:"false" default:"1" list:"user" update:"user" create:"optional"`
 
@@ -1036,6 +1039,18 @@ func isValidNetworkInfo(ctx context.Context, userCred mcclient.TokenCredential,
 				}
 			}
 		}
+		if len(netConfig.Address6) > 0 {
+			ip6Addr, err := netutils2.ParseIPV6Addr(netConfig.Address6)
+			if err != nil {
+				return httperrors.NewInputParameterError("%v", err)
+			}
+			if !net.IsAddress6InRange(ip6Addr) {
+				return httperrors.NewInputParameterError("Address %s not in range", netConfig.Address6)
+			}
+			if net.GetUsedAddresses6()[ip6Addr.String()] {
+				return httperrors.NewInputParameterError("Address %s has been used", netConfig.Address6)
+			}
+		}
 		if netConfig.BwLimit > api.MAX_BANDWIDTH {
 			return httperrors.NewInputParameterError("Bandwidth limit cannot exceed %dMbps", api.MAX_BANDWIDTH)
 		}
@@ -1702,6 +1717,11 @@ func (manager *SNetworkManager) ValidateCreateData(ctx context.Context, userCred
 		}
 	}
 
+	input, err = manager.validateIPv6CreateData(vpc, region, input)
+	if err != nil {
+		return input, err
+	}
+
 	input.GuestIpStart = ipStart.String()
 	input.GuestIpEnd = ipEnd.String()
 	input.SharableVirtualResourceCreateInput, err = manager.SSharableVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.SharableVirtualResourceCreateInput)
@@ -1832,6 +1852,11 @@ func (self *SNetwork) validateUpdateData(ctx context.Context, userCred mcclient.
 		}
 	}
 
+	input, err = self.validateIPv6UpdateData(input)
+	if err != nil {
+		return input, err
+	}
+
 	return input, nil
 }
 
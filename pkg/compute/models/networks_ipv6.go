@@ -0,0 +1,242 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"net"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/regutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/util/netutils2"
+)
+
+const (
+	minIPv6MaskLen = 48
+	maxIPv6MaskLen = 126
+)
+
+type sNetworkIPv6 struct {
+	start   net.IP
+	end     net.IP
+	masklen int8
+	gateway net.IP
+}
+
+// parseVpcNetworkIPv6 derives the ipv6 address range of a vpc network.  Like
+// the ipv4 counterpart, the 1st address is reserved as gateway and the last
+// one is reserved for future use
+func parseVpcNetworkIPv6(prefix, start string, masklen int64) (*sNetworkIPv6, error) {
+	var (
+		netAddr net.IP
+		err     error
+	)
+	if prefix != "" {
+		var ml int8
+		netAddr, ml, err = netutils2.ParseIPV6Prefix(prefix)
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("guest_ip6_prefix: %v", err)
+		}
+		masklen = int64(ml)
+	} else {
+		ip, err := netutils2.ParseIPV6Addr(start)
+		if err != nil {
+			return nil, httperrors.NewInputParameterError("guest_ip6_start: %v", err)
+		}
+		netAddr = netutils2.IPV6NetAddr(ip, int8(masklen))
+	}
+	if masklen < minIPv6MaskLen || masklen > maxIPv6MaskLen {
+		return nil, httperrors.NewInputParameterError("ipv6 masklen should be between %d and %d, got %d", minIPv6MaskLen, maxIPv6MaskLen, masklen)
+	}
+	gateway := netutils2.IPV6StepUp(netAddr)
+	return &sNetworkIPv6{
+		start:   netutils2.IPV6StepUp(gateway),
+		end:     netutils2.IPV6StepDown(netutils2.IPV6LastAddr(netAddr, int8(masklen))),
+		masklen: int8(masklen),
+		gateway: gateway,
+	}, nil
+}
+
+func validateIPv6Dns(dns string) error {
+	for _, ipstr := range strings.Split(dns, ",") {
+		if !regutils.MatchIP6Addr(ipstr) {
+			return httperrors.NewInputParameterError("guest_dns6: Invalid IPv6 address %s", ipstr)
+		}
+	}
+	return nil
+}
+
+func isOverlapNetworks6(nets []SNetwork, excludeId string, ipRange netutils2.IPV6AddrRange) bool {
+	for i := range nets {
+		if nets[i].Id == excludeId || !nets[i].HasIPv6() {
+			continue
+		}
+		if nets[i].getIPRange6().IsOverlap(ipRange) {
+			return true
+		}
+	}
+	return false
+}
+
+func (manager *SNetworkManager) validateIPv6CreateData(vpc *SVpc, region *SCloudregion, input api.NetworkCreateInput) (api.NetworkCreateInput, error) {
+	if input.GuestIp6Prefix == "" && input.GuestIp6Start == "" {
+		if input.GuestDns6 != "" || input.GuestGateway6 != "" {
+			return input, httperrors.NewInputParameterError("guest_ip6_prefix required")
+		}
+		return input, nil
+	}
+	if region.Provider != api.CLOUD_PROVIDER_ONECLOUD || vpc.Id == api.DEFAULT_VPC_ID {
+		return input, httperrors.NewNotSupportedError("ipv6 is only supported by vpc networks")
+	}
+	ip6, err := parseVpcNetworkIPv6(input.GuestIp6Prefix, input.GuestIp6Start, input.GuestIp6Mask)
+	if err != nil {
+		return input, err
+	}
+	if input.GuestDns6 != "" {
+		if err := validateIPv6Dns(input.GuestDns6); err != nil {
+			return input, err
+		}
+	}
+	nets, err := vpc.GetNetworks()
+	if err != nil {
+		return input, httperrors.NewInternalServerError("fail to GetNetworks of vpc: %v", err)
+	}
+	if isOverlapNetworks6(nets, "", netutils2.NewIPV6AddrRange(ip6.start, ip6.end)) {
+		return input, httperrors.NewInputParameterError("Conflict ipv6 address space with existing networks in vpc %q", vpc.GetName())
+	}
+	input.GuestIp6Prefix = ""
+	input.GuestIp6Start = ip6.start.String()
+	input.GuestIp6End = ip6.end.String()
+	input.GuestIp6Mask = int64(ip6.masklen)
+	input.GuestGateway6 = ip6.gateway.String()
+	return input, nil
+}
+
+func (self *SNetwork) validateIPv6UpdateData(input api.NetworkUpdateInput) (api.NetworkUpdateInput, error) {
+	if input.GuestDns6 != "" {
+		if err := validateIPv6Dns(input.GuestDns6); err != nil {
+			return input, err
+		}
+	}
+	// derived from the prefix, not for users to set
+	input.GuestIp6End = ""
+	input.GuestGateway6 = ""
+	if input.GuestIp6Prefix == "" && input.GuestIp6Start == "" {
+		input.GuestIp6Mask = nil
+		return input, nil
+	}
+	if !self.isOneCloudVpcNetwork() {
+		return input, httperrors.NewNotSupportedError("ipv6 is only supported by vpc networks")
+	}
+	var masklen int64
+	if input.GuestIp6Mask != nil {
+		masklen = int64(*input.GuestIp6Mask)
+	} else {
+		masklen = int64(self.GuestIp6Mask)
+	}
+	ip6, err := parseVpcNetworkIPv6(input.GuestIp6Prefix, input.GuestIp6Start, masklen)
+	if err != nil {
+		return input, err
+	}
+	ipRange := netutils2.NewIPV6AddrRange(ip6.start, ip6.end)
+	vpc, err := self.GetVpc()
+	if err != nil {
+		return input, httperrors.NewInternalServerError("GetVpc: %v", err)
+	}
+	nets, err := vpc.GetNetworks()
+	if err != nil {
+		return input, httperrors.NewInternalServerError("fail to GetNetworks of vpc: %v", err)
+	}
+	if isOverlapNetworks6(nets, self.Id, ipRange) {
+		return input, httperrors.NewInputParameterError("Conflict ipv6 address space with existing networks in vpc %q", vpc.GetName())
+	}
+	for usedIpStr := range self.GetUsedAddresses6() {
+		usedIp, _ := netutils2.ParseIPV6Addr(usedIpStr)
+		if usedIp == nil || !ipRange.Contains(usedIp) {
+			return input, httperrors.NewInputParameterError("IPv6 address been assigned out of new range")
+		}
+	}
+	input.GuestIp6Prefix = ""
+	input.GuestIp6Start = ip6.start.String()
+	input.GuestIp6End = ip6.end.String()
+	input.GuestIp6Mask = &ip6.masklen
+	input.GuestGateway6 = ip6.gateway.String()
+	return input, nil
+}
+
+// HasIPv6 returns true if guests in the network can be assigned ipv6 addresses
+func (self *SNetwork) HasIPv6() bool {
+	return self.GuestIp6Start != "" && self.GuestIp6End != ""
+}
+
+func (self *SNetwork) getIPRange6() netutils2.IPV6AddrRange {
+	start, _ := netutils2.ParseIPV6Addr(self.GuestIp6Start)
+	end, _ := netutils2.ParseIPV6Addr(self.GuestIp6End)
+	return netutils2.NewIPV6AddrRange(start, end)
+}
+
+func (self *SNetwork) IsAddress6InRange(address net.IP) bool {
+	return self.HasIPv6() && self.getIPRange6().Contains(address)
+}
+
+func (self *SNetwork) GetUsedAddresses6() map[string]bool {
+	used := make(map[string]bool)
+
+	q := GuestnetworkManager.Query("ip6_addr").Equals("network_id", self.Id).IsNotEmpty("ip6_addr")
+	results, err := q.AllStringMap()
+	if err != nil {
+		log.Errorf("GetUsedAddresses6 fail %s", err)
+		return used
+	}
+	for _, result := range results {
+		used[result["ip6_addr"]] = true
+	}
+	return used
+}
+
+func (self *SNetwork) getFreeIP6(addrTable map[string]bool, candidate string) (string, error) {
+	iprange := self.getIPRange6()
+	if len(candidate) > 0 {
+		candIP, err := netutils2.ParseIPV6Addr(candidate)
+		if err != nil {
+			return "", httperrors.NewInputParameterError("%v", err)
+		}
+		if !iprange.Contains(candIP) {
+			return "", httperrors.NewInputParameterError("candidate %s out of range", candidate)
+		}
+		if !addrTable[candIP.String()] {
+			return candIP.String(), nil
+		}
+	}
+	for ip := iprange.StartIp(); iprange.Contains(ip); ip = netutils2.IPV6StepUp(ip) {
+		if !addrTable[ip.String()] {
+			return ip.String(), nil
+		}
+	}
+	return "", httperrors.NewInsufficientResourceError("Out of IPv6 address")
+}
+
+// GetFreeIP6 allocates an ipv6 address for guests.  The candidate is tried
+// first when it's not empty.  Caller must hold the network lock until the
+// allocated address is saved
+func (self *SNetwork) GetFreeIP6(candidate string) (string, error) {
+	if !self.HasIPv6() {
+		return "", httperrors.NewNotSupportedError("network %s(%s) has no ipv6 address range", self.Name, self.Id)
+	}
+	return self.getFreeIP6(self.GetUsedAddresses6(), candidate)
+}
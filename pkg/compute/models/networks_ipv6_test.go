@@ -0,0 +1,86 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+)
+
+func TestParseVpcNetworkIPv6(t *testing.T) {
+	cases := []struct {
+		prefix  string
+		start   string
+		masklen int64
+		want    [3]string
+		wantErr bool
+	}{
+		{
+			prefix: "fd00:1::5/64",
+			want:   [3]string{"fd00:1::1", "fd00:1::2", "fd00:1::ffff:ffff:ffff:fffe"},
+		},
+		{
+			start:   "fd00:2::1234",
+			masklen: 120,
+			want:    [3]string{"fd00:2::1201", "fd00:2::1202", "fd00:2::12fe"},
+		},
+		{
+			prefix:  "fd00:3::/127",
+			wantErr: true,
+		},
+		{
+			prefix:  "10.0.0.0/24",
+			wantErr: true,
+		},
+	}
+	for _, c := range cases {
+		got, err := parseVpcNetworkIPv6(c.prefix, c.start, c.masklen)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("%s%s: want error", c.prefix, c.start)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s%s: %v", c.prefix, c.start, err)
+			continue
+		}
+		if gw, s, e := got.gateway.String(), got.start.String(), got.end.String(); gw != c.want[0] || s != c.want[1] || e != c.want[2] {
+			t.Errorf("%s%s: want %v, got [%s %s %s]", c.prefix, c.start, c.want, gw, s, e)
+		}
+	}
+}
+
+func TestGetFreeIP6(t *testing.T) {
+	network := &SNetwork{
+		GuestIp6Start: "fd00:1::2",
+		GuestIp6End:   "fd00:1::4",
+		GuestIp6Mask:  120,
+	}
+	used := map[string]bool{"fd00:1::2": true}
+	if ip, err := network.getFreeIP6(used, ""); err != nil || ip != "fd00:1::3" {
+		t.Errorf("want fd00:1::3, got %s, %v", ip, err)
+	}
+	if ip, err := network.getFreeIP6(used, "fd00:1:0::4"); err != nil || ip != "fd00:1::4" {
+		t.Errorf("want candidate fd00:1::4, got %s, %v", ip, err)
+	}
+	if _, err := network.getFreeIP6(used, "fd00:2::4"); err == nil {
+		t.Errorf("candidate out of range: want error")
+	}
+	used["fd00:1::3"] = true
+	used["fd00:1::4"] = true
+	if _, err := network.getFreeIP6(used, ""); err == nil {
+		t.Errorf("exhausted: want error")
+	}
+}
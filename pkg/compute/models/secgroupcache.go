@@ -788,6 +788,9 @@ func (self *SSecurityGroupCache) GetSecuritRuleSet(ctx context.Context) (cloudpr
 		if !driver.IsSupportPeerSecgroup() && len(rules[i].PeerSecgroupId) > 0 {
 			continue
 		}
+		if rules[i].IsIPv6() {
+			continue
+		}
 		//这里没必要拆分为单个单个的端口,到公有云那边适配
 		rule, err := rules[i].toRule()
 		if err != nil {
@@ -17,6 +17,7 @@ package models
 import (
 	"context"
 	"net"
+	"strings"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -347,6 +348,11 @@ func (self *SSecurityGroupRule) ValidateUpdateData(ctx context.Context, userCred
 	return input, nil
 }
 
+// IsIPv6 ipv6规则仅在OVN VPC中生效, 下发至宿主机及公有云时需跳过
+func (self *SSecurityGroupRule) IsIPv6() bool {
+	return strings.Contains(self.CIDR, ":")
+}
+
 func (self *SSecurityGroupRule) String() string {
 	rule, err := self.toRule()
 	if err != nil {
@@ -365,11 +371,19 @@ func (self *SSecurityGroupRule) toRule() (*secrules.SecurityRule, error) {
 	}
 	if regutils.MatchCIDR(self.CIDR) {
 		_, rule.IPNet, _ = net.ParseCIDR(self.CIDR)
-	} else if regutils.MatchIPAddr(self.CIDR) {
+	} else if regutils.MatchIP4Addr(self.CIDR) {
 		rule.IPNet = &net.IPNet{
 			IP:   net.ParseIP(self.CIDR),
 			Mask: net.CIDRMask(32, 32),
 		}
+	} else if regutils.MatchIP6Addr(self.CIDR) {
+		rule.IPNet = &net.IPNet{
+			IP:   net.ParseIP(self.CIDR),
+			Mask: net.CIDRMask(128, 128),
+		}
+	} else if _, ipnet, err := net.ParseCIDR(self.CIDR); err == nil {
+		// ipv6 cidr
+		rule.IPNet = ipnet
 	} else {
 		rule.IPNet = &net.IPNet{
 			IP:   net.IPv4zero,
@@ -657,6 +657,9 @@ func (self *SSecurityGroup) GetSecuritRuleSet() (cloudprovider.SecurityRuleSet,
 		return ruleSet, errors.Wrapf(err, "getSecurityRules")
 	}
 	for i := range rules {
+		if rules[i].IsIPv6() {
+			continue
+		}
 		//这里没必要拆分为单个单个的端口,到公有云那边适配
 		rule, err := rules[i].toRule()
 		if err != nil {
@@ -674,6 +677,9 @@ func (self *SSecurityGroup) GetSecRules() ([]secrules.SecurityRule, error) {
 		return nil, errors.Wrapf(err, "getSecurityRules()")
 	}
 	for _, _rule := range _rules {
+		if _rule.IsIPv6() {
+			continue
+		}
 		//这里没必要拆分为单个单个的端口,到公有云那边适配
 		rule, err := _rule.toRule()
 		if err != nil {
@@ -691,6 +697,9 @@ func (self *SSecurityGroup) getSecurityRuleString() (string, error) {
 	}
 	var rules []string
 	for _, rule := range secgrouprules {
+		if rule.IsIPv6() {
+			continue
+		}
 		rules = append(rules, rule.String())
 	}
 	return strings.Join(rules, SECURITY_GROUP_SEPARATOR), nil
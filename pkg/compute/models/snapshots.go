@@ -444,7 +444,12 @@ func (snapshot *SSnapshot) PostCreate(ctx context.Context, userCred mcclient.Tok
 
 func (manager *SSnapshotManager) OnCreateComplete(ctx context.Context, items []db.IModel, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
 	snapshot := items[0].(*SSnapshot)
-	snapshot.StartSnapshotCreateTask(ctx, userCred, nil, "")
+	var params *jsonutils.JSONDict
+	if jsonutils.QueryBoolean(data, "fsfreeze", false) {
+		params = jsonutils.NewDict()
+		params.Set("fsfreeze", jsonutils.JSONTrue)
+	}
+	snapshot.StartSnapshotCreateTask(ctx, userCred, params, "")
 }
 
 func (self *SSnapshot) StartSnapshotCreateTask(ctx context.Context, userCred mcclient.TokenCredential, params *jsonutils.JSONDict, parentTaskId string) error {
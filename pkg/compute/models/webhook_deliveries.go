@@ -0,0 +1,395 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/rbacutils"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+const (
+	// deliveries failed this many times are moved to the dead letter list
+	webhookMaxDeliveryAttempts = 8
+	// the 1st retry is scheduled after this interval, then doubled on each
+	// further failure
+	webhookRetryBaseInterval = 30 * time.Second
+	webhookRetryMaxInterval  = time.Hour
+	// pending deliveries are leased for this long so that the retry job
+	// doesn't send them again while the first delivery is in flight
+	webhookDeliveryLease = time.Minute
+	// succeeded deliveries are kept as history for this long
+	webhookDeliveryRetention = 7 * 24 * time.Hour
+
+	webhookRetryBatchSize = 100
+)
+
+type SWebhookDeliveryManager struct {
+	db.SStatusStandaloneResourceBaseManager
+	db.SProjectizedResourceBaseManager
+}
+
+var WebhookDeliveryManager *SWebhookDeliveryManager
+
+func init() {
+	WebhookDeliveryManager = &SWebhookDeliveryManager{
+		SStatusStandaloneResourceBaseManager: db.NewStatusStandaloneResourceBaseManager(
+			SWebhookDelivery{},
+			"webhook_deliveries_tbl",
+			"webhook_delivery",
+			"webhook_deliveries",
+		),
+	}
+	WebhookDeliveryManager.SetVirtualObject(WebhookDeliveryManager)
+	WebhookDeliveryManager.TableSpec().AddIndex(false, "status", "next_retry_at", "deleted")
+}
+
+// SWebhookDelivery records a resource change event delivered to a webhook
+// subscription, the name is the CloudEvents id of the event
+type SWebhookDelivery struct {
+	db.SStatusStandaloneResourceBase
+	db.SProjectizedResourceBase
+
+	WebhookSubscriptionId string `width:"36" charset:"ascii" nullable:"false" index:"true" list:"user"`
+
+	// CloudEvents事件类型
+	EventType    string `width:"128" charset:"ascii" nullable:"false" list:"user"`
+	Action       string `width:"16" charset:"ascii" nullable:"false" list:"user"`
+	ResourceType string `width:"64" charset:"ascii" nullable:"false" list:"user"`
+	ResourceId   string `width:"128" charset:"ascii" nullable:"true" list:"user"`
+	// CloudEvents格式的请求体
+	Payload string `length:"medium" charset:"utf8" nullable:"true" get:"user"`
+
+	// 已投递次数
+	Attempts      int       `nullable:"false" default:"0" list:"user"`
+	NextRetryAt   time.Time `nullable:"true" list:"user"`
+	LastAttemptAt time.Time `nullable:"true" list:"user"`
+	// 接收方最后一次返回的HTTP状态码
+	ResponseCode int    `nullable:"false" default:"0" list:"user"`
+	LastError    string `width:"512" charset:"utf8" nullable:"true" list:"user"`
+}
+
+func (manager *SWebhookDeliveryManager) ResourceScope() rbacutils.TRbacScope {
+	return manager.SProjectizedResourceBaseManager.ResourceScope()
+}
+
+func (manager *SWebhookDeliveryManager) FilterByOwner(q *sqlchemy.SQuery, owner mcclient.IIdentityProvider, scope rbacutils.TRbacScope) *sqlchemy.SQuery {
+	return manager.SProjectizedResourceBaseManager.FilterByOwner(q, owner, scope)
+}
+
+func (manager *SWebhookDeliveryManager) FetchOwnerId(ctx context.Context, data jsonutils.JSONObject) (mcclient.IIdentityProvider, error) {
+	return manager.SProjectizedResourceBaseManager.FetchOwnerId(ctx, data)
+}
+
+func (self *SWebhookDelivery) GetOwnerId() mcclient.IIdentityProvider {
+	return self.SProjectizedResourceBase.GetOwnerId()
+}
+
+func (manager *SWebhookDeliveryManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	return nil, httperrors.NewUnsupportOperationError("webhook deliveries are created by resource change events")
+}
+
+func (manager *SWebhookDeliveryManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.WebhookDeliveryListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SStatusStandaloneResourceBaseManager.ListItemFilter(ctx, q, userCred, query.StatusStandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStatusStandaloneResourceBaseManager.ListItemFilter")
+	}
+	q, err = manager.SProjectizedResourceBaseManager.ListItemFilter(ctx, q, userCred, query.ProjectizedResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SProjectizedResourceBaseManager.ListItemFilter")
+	}
+	if len(query.WebhookSubscriptionId) > 0 {
+		sub, err := WebhookSubscriptionManager.FetchByIdOrName(userCred, query.WebhookSubscriptionId)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2(WebhookSubscriptionManager.Keyword(), query.WebhookSubscriptionId)
+		}
+		q = q.Equals("webhook_subscription_id", sub.GetId())
+	}
+	if len(query.ResourceType) > 0 {
+		q = q.Equals("resource_type", query.ResourceType)
+	}
+	if len(query.ResourceId) > 0 {
+		q = q.Equals("resource_id", query.ResourceId)
+	}
+	if len(query.Action) > 0 {
+		q = q.Equals("action", query.Action)
+	}
+	if query.DeadLetter != nil {
+		if *query.DeadLetter {
+			q = q.Equals("status", api.WEBHOOK_DELIVERY_STATUS_DEAD_LETTER)
+		} else {
+			q = q.NotEquals("status", api.WEBHOOK_DELIVERY_STATUS_DEAD_LETTER)
+		}
+	}
+	return q, nil
+}
+
+func (manager *SWebhookDeliveryManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.WebhookDeliveryListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SStatusStandaloneResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.StatusStandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStatusStandaloneResourceBaseManager.OrderByExtraFields")
+	}
+	q, err = manager.SProjectizedResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.ProjectizedResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SProjectizedResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SWebhookDeliveryManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SStatusStandaloneResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	q, err = manager.SProjectizedResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+func (manager *SWebhookDeliveryManager) ListItemExportKeys(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, keys stringutils2.SSortedStrings) (*sqlchemy.SQuery, error) {
+	q, err := manager.SStatusStandaloneResourceBaseManager.ListItemExportKeys(ctx, q, userCred, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "SStatusStandaloneResourceBaseManager.ListItemExportKeys")
+	}
+	q, err = manager.SProjectizedResourceBaseManager.ListItemExportKeys(ctx, q, userCred, keys)
+	if err != nil {
+		return nil, errors.Wrap(err, "SProjectizedResourceBaseManager.ListItemExportKeys")
+	}
+	return q, nil
+}
+
+func (manager *SWebhookDeliveryManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.WebhookDeliveryDetails {
+	rows := make([]api.WebhookDeliveryDetails, len(objs))
+	stdRows := manager.SStatusStandaloneResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	projRows := manager.SProjectizedResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	subIds := make([]string, len(objs))
+	for i := range rows {
+		rows[i] = api.WebhookDeliveryDetails{
+			StatusStandaloneResourceDetails: stdRows[i],
+			ProjectizedResourceInfo:         projRows[i],
+		}
+		subIds[i] = objs[i].(*SWebhookDelivery).WebhookSubscriptionId
+	}
+	subs := make(map[string]SWebhookSubscription)
+	err := db.FetchStandaloneObjectsByIds(WebhookSubscriptionManager, subIds, &subs)
+	if err != nil {
+		log.Errorf("FetchStandaloneObjectsByIds fail %s", err)
+		return rows
+	}
+	for i := range rows {
+		if sub, ok := subs[subIds[i]]; ok {
+			rows[i].WebhookSubscription = sub.Name
+		}
+	}
+	return rows
+}
+
+// PerformRedeliver requeues a dead letter or resends a delivered event
+func (self *SWebhookDelivery) PerformRedeliver(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	if self.Status != api.WEBHOOK_DELIVERY_STATUS_DEAD_LETTER && self.Status != api.WEBHOOK_DELIVERY_STATUS_SUCCEEDED {
+		return nil, httperrors.NewInvalidStatusError("can't redeliver in status %s", self.Status)
+	}
+	return nil, self.requeue(ctx, userCred)
+}
+
+func (self *SWebhookDelivery) requeue(ctx context.Context, userCred mcclient.TokenCredential) error {
+	_, err := db.Update(self, func() error {
+		self.Status = api.WEBHOOK_DELIVERY_STATUS_PENDING
+		self.Attempts = 0
+		self.NextRetryAt = time.Now().UTC()
+		self.LastError = ""
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "db.Update")
+	}
+	db.OpsLog.LogEvent(self, db.ACT_UPDATE, "redeliver", userCred)
+	runWebhookDelivery(self)
+	return nil
+}
+
+func (self *SWebhookDelivery) GetSubscription() (*SWebhookSubscription, error) {
+	sub, err := WebhookSubscriptionManager.FetchById(self.WebhookSubscriptionId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "FetchById %s", self.WebhookSubscriptionId)
+	}
+	return sub.(*SWebhookSubscription), nil
+}
+
+func (manager *SWebhookDeliveryManager) newDelivery(ctx context.Context, sub *SWebhookSubscription, event *api.WebhookCloudEvent) (*SWebhookDelivery, error) {
+	delivery := &SWebhookDelivery{}
+	delivery.SetModelManager(manager, delivery)
+	delivery.Name = event.Id
+	delivery.Status = api.WEBHOOK_DELIVERY_STATUS_PENDING
+	delivery.WebhookSubscriptionId = sub.Id
+	delivery.ProjectId = sub.ProjectId
+	delivery.DomainId = sub.DomainId
+	delivery.EventType = event.Type
+	delivery.Action = event.Data.Action
+	delivery.ResourceType = event.Data.ResourceType
+	delivery.ResourceId = event.Data.ResourceId
+	delivery.Payload = jsonutils.Marshal(event).String()
+	delivery.NextRetryAt = time.Now().UTC().Add(webhookDeliveryLease)
+	err := manager.TableSpec().Insert(ctx, delivery)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert")
+	}
+	return delivery, nil
+}
+
+// webhookRetryInterval returns the backoff after the attempts-th failure
+func webhookRetryInterval(attempts int) time.Duration {
+	interval := webhookRetryBaseInterval
+	for i := 1; i < attempts; i++ {
+		interval *= 2
+		if interval >= webhookRetryMaxInterval {
+			return webhookRetryMaxInterval
+		}
+	}
+	return interval
+}
+
+func (self *SWebhookDelivery) markResult(code int, deliverErr error) error {
+	_, err := db.Update(self, func() error {
+		now := time.Now().UTC()
+		self.Attempts += 1
+		self.LastAttemptAt = now
+		self.ResponseCode = code
+		if deliverErr == nil {
+			self.Status = api.WEBHOOK_DELIVERY_STATUS_SUCCEEDED
+			self.LastError = ""
+			return nil
+		}
+		self.LastError = deliverErr.Error()
+		if len(self.LastError) > 512 {
+			self.LastError = self.LastError[:512]
+		}
+		if self.Attempts >= webhookMaxDeliveryAttempts {
+			self.Status = api.WEBHOOK_DELIVERY_STATUS_DEAD_LETTER
+		} else {
+			self.Status = api.WEBHOOK_DELIVERY_STATUS_RETRYING
+			self.NextRetryAt = now.Add(webhookRetryInterval(self.Attempts))
+		}
+		return nil
+	})
+	return err
+}
+
+func (self *SWebhookDelivery) deliver(ctx context.Context) {
+	sub, err := self.GetSubscription()
+	if err != nil {
+		log.Errorf("webhook delivery %s: %v", self.Id, err)
+		return
+	}
+	if !sub.GetEnabled() || sub.PendingDeleted {
+		// kept pending, RetryDeliveries picks it up once re-enabled
+		log.Debugf("webhook %s(%s) is disabled, skip delivery %s", sub.Name, sub.Id, self.Id)
+		return
+	}
+	code, err := sub.post(ctx, self.Name, []byte(self.Payload))
+	if err != nil {
+		log.Warningf("deliver event %s to webhook %s(%s) fail: %v", self.Name, sub.Name, sub.Id, err)
+	}
+	if err := self.markResult(code, err); err != nil {
+		log.Errorf("update webhook delivery %s: %v", self.Id, err)
+	}
+}
+
+func (manager *SWebhookDeliveryManager) purgeDeliveries(q *sqlchemy.SQuery) error {
+	deliveries := make([]SWebhookDelivery, 0)
+	err := db.FetchModelObjects(manager, q, &deliveries)
+	if err != nil {
+		return errors.Wrap(err, "FetchModelObjects")
+	}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		_, err := db.Update(delivery, func() error {
+			return delivery.MarkDelete()
+		})
+		if err != nil {
+			return errors.Wrapf(err, "delete webhook delivery %s", delivery.Id)
+		}
+	}
+	return nil
+}
+
+func (manager *SWebhookDeliveryManager) purgeSubscriptionDeliveries(subId string) error {
+	return manager.purgeDeliveries(manager.Query().Equals("webhook_subscription_id", subId))
+}
+
+// RetryDeliveries resends pending deliveries whose backoff has expired and
+// purges expired delivery history
+func (manager *SWebhookDeliveryManager) RetryDeliveries(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	now := time.Now().UTC()
+	subs := WebhookSubscriptionManager.Query("id").IsTrue("enabled").IsFalse("pending_deleted").SubQuery()
+	q := manager.Query().In("status", []string{api.WEBHOOK_DELIVERY_STATUS_PENDING, api.WEBHOOK_DELIVERY_STATUS_RETRYING})
+	q = q.In("webhook_subscription_id", subs)
+	q = q.LE("next_retry_at", now).Asc("next_retry_at").Limit(webhookRetryBatchSize)
+	deliveries := make([]SWebhookDelivery, 0)
+	err := db.FetchModelObjects(manager, q, &deliveries)
+	if err != nil {
+		log.Errorf("fetch webhook deliveries to retry: %v", err)
+		return
+	}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		_, err := db.Update(delivery, func() error {
+			delivery.NextRetryAt = now.Add(webhookDeliveryLease)
+			return nil
+		})
+		if err != nil {
+			log.Errorf("lease webhook delivery %s: %v", delivery.Id, err)
+			continue
+		}
+		runWebhookDelivery(delivery)
+	}
+
+	q = manager.Query().Equals("status", api.WEBHOOK_DELIVERY_STATUS_SUCCEEDED)
+	q = q.LT("created_at", now.Add(-webhookDeliveryRetention)).Limit(webhookRetryBatchSize)
+	err = manager.purgeDeliveries(q)
+	if err != nil {
+		log.Errorf("purge webhook delivery history: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/stringutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/cloudcommon/informer"
+)
+
+const (
+	webhookInformerBackendType = "webhook"
+	webhookRequestTimeout      = 10 * time.Second
+	// subscriptions may be changed by other region instances
+	webhookRefreshInterval = time.Minute
+)
+
+var (
+	webhookDeliveryWorkerMan *appsrv.SWorkerManager
+)
+
+func init() {
+	webhookDeliveryWorkerMan = appsrv.NewWorkerManager("WebhookDeliveryWorkerManager", 4, 10240, false)
+}
+
+// sWebhookInformerBackend turns model changes into deliveries of the
+// matched webhook subscriptions
+type sWebhookInformerBackend struct{}
+
+// InitWebhookInformerBackend registers the webhook backend besides the
+// default informer backend
+func InitWebhookInformerBackend(ctx context.Context) {
+	WebhookSubscriptionManager.RefreshWatchedResources(ctx, nil, true)
+	informer.AddBackend(&sWebhookInformerBackend{})
+	go func() {
+		ticker := time.NewTicker(webhookRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				WebhookSubscriptionManager.RefreshWatchedResources(ctx, nil, false)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (be *sWebhookInformerBackend) GetType() string {
+	return webhookInformerBackendType
+}
+
+func (be *sWebhookInformerBackend) IsResourceWatched(keywordPlural string) bool {
+	return WebhookSubscriptionManager.IsResourceWatched(keywordPlural)
+}
+
+func (be *sWebhookInformerBackend) Create(ctx context.Context, obj *informer.ModelObject) error {
+	return WebhookSubscriptionManager.dispatchEvent(ctx, api.WEBHOOK_ACTION_CREATE, obj, nil)
+}
+
+func (be *sWebhookInformerBackend) Update(ctx context.Context, obj *informer.ModelObject, oldObj *jsonutils.JSONDict) error {
+	return WebhookSubscriptionManager.dispatchEvent(ctx, api.WEBHOOK_ACTION_UPDATE, obj, oldObj)
+}
+
+func (be *sWebhookInformerBackend) Delete(ctx context.Context, obj *informer.ModelObject) error {
+	return WebhookSubscriptionManager.dispatchEvent(ctx, api.WEBHOOK_ACTION_DELETE, obj, nil)
+}
+
+func webhookEventSubject(obj *informer.ModelObject) string {
+	if obj.IsJoint {
+		return fmt.Sprintf("%s/%s", obj.MasterId, obj.SlaveId)
+	}
+	return obj.Id
+}
+
+func newWebhookCloudEvent(action string, obj *informer.ModelObject, oldObj *jsonutils.JSONDict) *api.WebhookCloudEvent {
+	subject := webhookEventSubject(obj)
+	projectId, _ := obj.Object.GetString("tenant_id")
+	return &api.WebhookCloudEvent{
+		SpecVersion:     api.WEBHOOK_CLOUDEVENTS_SPEC_VERSION,
+		Id:              stringutils.UUID4(),
+		Source:          fmt.Sprintf("/%s/%s", consts.GetServiceType(), obj.KeywordPlural),
+		Type:            fmt.Sprintf("%s.%s.%s", api.WEBHOOK_CLOUDEVENTS_TYPE_PREFIX, obj.KeywordPlural, action),
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data: &api.WebhookEventData{
+			Action:       action,
+			ResourceType: obj.KeywordPlural,
+			ResourceId:   subject,
+			ProjectId:    projectId,
+			Object:       obj.Object,
+			OldObject:    oldObj,
+		},
+	}
+}
+
+func (manager *SWebhookSubscriptionManager) dispatchEvent(ctx context.Context, action string, obj *informer.ModelObject, oldObj *jsonutils.JSONDict) error {
+	projectId, _ := obj.Object.GetString("tenant_id")
+	subs, err := manager.getMatchedSubscriptions(action, obj.KeywordPlural, projectId)
+	if err != nil {
+		return errors.Wrap(err, "getMatchedSubscriptions")
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	event := newWebhookCloudEvent(action, obj, oldObj)
+	for i := range subs {
+		delivery, err := WebhookDeliveryManager.newDelivery(ctx, &subs[i], event)
+		if err != nil {
+			log.Errorf("new delivery of event %s for webhook %s: %v", event.Id, subs[i].Id, err)
+			continue
+		}
+		runWebhookDelivery(delivery)
+	}
+	return nil
+}
+
+// signWebhookPayload signs "<timestamp>.<payload>" by HMAC-SHA256, the
+// timestamp is included so that receivers are able to reject replays
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends the payload to the subscriber, non 2xx responses are treated
+// as failures
+func (self *SWebhookSubscription) post(ctx context.Context, eventId string, payload []byte) (int, error) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, self.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "NewRequest")
+	}
+	req.Header.Set("Content-Type", api.WEBHOOK_CLOUDEVENTS_CONTENT_TYPE)
+	req.Header.Set(api.WEBHOOK_HEADER_EVENT_ID, eventId)
+	req.Header.Set(api.WEBHOOK_HEADER_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+	secret, err := self.getSecret()
+	if err != nil {
+		return 0, errors.Wrap(err, "getSecret")
+	}
+	req.Header.Set(api.WEBHOOK_HEADER_SIGNATURE, signWebhookPayload(secret, timestamp, payload))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "Do")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("unexpected response status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+type webhookDeliveryTask struct {
+	delivery *SWebhookDelivery
+}
+
+func (t *webhookDeliveryTask) Run() {
+	t.delivery.deliver(context.Background())
+}
+
+func (t *webhookDeliveryTask) Dump() string {
+	return fmt.Sprintf("webhook delivery %s", t.delivery.Id)
+}
+
+func runWebhookDelivery(delivery *SWebhookDelivery) {
+	webhookDeliveryWorkerMan.Run(&webhookDeliveryTask{delivery: delivery}, nil, nil)
+}
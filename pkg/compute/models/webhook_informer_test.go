@@ -0,0 +1,168 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/informer"
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// echo -n '1600000000.{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=3831eb7dbf183fdbdf6145e3aa0b7029f210195f352de3815ebec7b67268edbc"
+	got := signWebhookPayload("secret", 1600000000, []byte(`{"id":"1"}`))
+	if got != want {
+		t.Fatalf("want %s got %s", want, got)
+	}
+	if got == signWebhookPayload("secret", 1600000001, []byte(`{"id":"1"}`)) {
+		t.Errorf("timestamp should be signed")
+	}
+	if got == signWebhookPayload("secret2", 1600000000, []byte(`{"id":"1"}`)) {
+		t.Errorf("secret should be signed")
+	}
+}
+
+func TestWebhookRetryInterval(t *testing.T) {
+	cases := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+	for _, c := range cases {
+		if got := webhookRetryInterval(c.attempts); got != c.want {
+			t.Errorf("attempts %d: want %s got %s", c.attempts, c.want, got)
+		}
+	}
+}
+
+func TestWebhookSubscriptionIsMatch(t *testing.T) {
+	sub := &SWebhookSubscription{
+		Filter: &api.WebhookEventFilter{
+			ResourceTypes: []string{"servers", "disks"},
+			Actions:       []string{api.WEBHOOK_ACTION_CREATE, api.WEBHOOK_ACTION_DELETE},
+		},
+	}
+	sub.ProjectId = "p1"
+	cases := []struct {
+		name      string
+		action    string
+		resType   string
+		projectId string
+		filter    func(f *api.WebhookEventFilter)
+		want      bool
+	}{
+		{"own project", api.WEBHOOK_ACTION_CREATE, "servers", "p1", nil, true},
+		{"other project", api.WEBHOOK_ACTION_CREATE, "servers", "p2", nil, false},
+		{"action filtered", api.WEBHOOK_ACTION_UPDATE, "servers", "p1", nil, false},
+		{"resource filtered", api.WEBHOOK_ACTION_CREATE, "networks", "p1", nil, false},
+		{"no project", api.WEBHOOK_ACTION_CREATE, "servers", "", nil, false},
+		{"listed project", api.WEBHOOK_ACTION_DELETE, "disks", "p2", func(f *api.WebhookEventFilter) { f.ProjectIds = []string{"p2"} }, true},
+		{"not listed project", api.WEBHOOK_ACTION_DELETE, "disks", "p1", func(f *api.WebhookEventFilter) { f.ProjectIds = []string{"p2"} }, false},
+		{"all projects", api.WEBHOOK_ACTION_DELETE, "disks", "", func(f *api.WebhookEventFilter) { f.AllProjects = true }, true},
+		{"all actions", api.WEBHOOK_ACTION_UPDATE, "disks", "p1", func(f *api.WebhookEventFilter) { f.Actions = nil }, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := *sub
+			filter := *sub.Filter
+			s.Filter = &filter
+			if c.filter != nil {
+				c.filter(s.Filter)
+			}
+			if got := s.isMatch(c.action, c.resType, c.projectId); got != c.want {
+				t.Errorf("want %v got %v", c.want, got)
+			}
+		})
+	}
+}
+
+func TestNewWebhookCloudEvent(t *testing.T) {
+	obj := informer.NewModel(map[string]string{"id": "s1", "name": "vm", "tenant_id": "p1"}, "servers", "s1")
+	old := jsonutils.NewDict()
+	old.Set("name", jsonutils.NewString("vm0"))
+	event := newWebhookCloudEvent(api.WEBHOOK_ACTION_UPDATE, obj, old)
+	if event.SpecVersion != "1.0" || event.Id == "" || event.Subject != "s1" {
+		t.Fatalf("invalid event %s", jsonutils.Marshal(event))
+	}
+	if event.Type != "com.yunion.cloudpods.servers.update" {
+		t.Errorf("unexpected event type %s", event.Type)
+	}
+	if event.Data.ProjectId != "p1" || event.Data.OldObject == nil {
+		t.Errorf("unexpected event data %s", jsonutils.Marshal(event.Data))
+	}
+	payload := jsonutils.Marshal(event)
+	for _, key := range []string{"specversion", "datacontenttype", "data"} {
+		if !payload.Contains(key) {
+			t.Errorf("payload missing %s: %s", key, payload)
+		}
+	}
+
+	joint := informer.NewJointModel(map[string]string{"guest_id": "s1"}, "guestdisks", "s1", "d1")
+	if subject := webhookEventSubject(joint); subject != "s1/d1" {
+		t.Errorf("unexpected joint subject %s", subject)
+	}
+}
+
+func TestValidateWebhookUrl(t *testing.T) {
+	ctx := context.Background()
+	for _, u := range []string{
+		"http://127.0.0.1/hook",
+		"http://10.1.2.3:8080/hook",
+		"https://172.16.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.100.100.200/latest/meta-data",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00:ec2::254]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"ftp://8.8.8.8/hook",
+		"http:///hook",
+	} {
+		if err := validateWebhookUrl(ctx, u); err == nil {
+			t.Errorf("%s: want error", u)
+		}
+	}
+	for _, u := range []string{
+		"http://8.8.8.8/hook",
+		"https://[2001:4860:4860::8888]:8443/hook",
+	} {
+		if err := validateWebhookUrl(ctx, u); err != nil {
+			t.Errorf("%s: %v", u, err)
+		}
+	}
+}
+
+func TestWebhookDialContext(t *testing.T) {
+	_, err := webhookDialContext(context.Background(), "tcp", "127.0.0.1:80")
+	if errors.Cause(err) != httperrors.ErrForbidden {
+		t.Errorf("want forbidden, got %v", err)
+	}
+}
@@ -0,0 +1,575 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/sets"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+const (
+	webhookSecretMinLength = 16
+	webhookSecretMaxLength = 128
+
+	webhookDialTimeout = 10 * time.Second
+)
+
+// webhookForbiddenNets are address ranges of the cloud itself, i.e. loopback,
+// private networks, metadata services and the like.  Webhooks are not allowed
+// to reach them
+var webhookForbiddenNets = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/3",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	}
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, nets[i], _ = net.ParseCIDR(cidr)
+	}
+	return nets
+}()
+
+type SWebhookSubscriptionManager struct {
+	db.SVirtualResourceBaseManager
+	db.SEnabledResourceBaseManager
+
+	// resource types subscribed by enabled subscriptions
+	watchedLock      sync.RWMutex
+	watchedResources sets.String
+}
+
+var WebhookSubscriptionManager *SWebhookSubscriptionManager
+
+func init() {
+	WebhookSubscriptionManager = &SWebhookSubscriptionManager{
+		SVirtualResourceBaseManager: db.NewVirtualResourceBaseManager(
+			SWebhookSubscription{},
+			"webhook_subscriptions_tbl",
+			"webhook_subscription",
+			"webhook_subscriptions",
+		),
+		watchedResources: sets.NewString(),
+	}
+	WebhookSubscriptionManager.SetVirtualObject(WebhookSubscriptionManager)
+}
+
+// SWebhookSubscription delivers resource change events in CloudEvents
+// format to the url
+type SWebhookSubscription struct {
+	db.SVirtualResourceBase
+	db.SEnabledResourceBase
+
+	// 接收事件的URL
+	Url string `width:"1024" charset:"utf8" nullable:"false" list:"user" create:"required" update:"user"`
+	// 加密后的签名密钥
+	Secret string `width:"256" charset:"ascii" nullable:"false"`
+	// 事件过滤条件
+	Filter *api.WebhookEventFilter `list:"user" create:"required" update:"user"`
+}
+
+func (manager *SWebhookSubscriptionManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.WebhookSubscriptionListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SVirtualResourceBaseManager.ListItemFilter(ctx, q, userCred, query.VirtualResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SVirtualResourceBaseManager.ListItemFilter")
+	}
+	q, err = manager.SEnabledResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledResourceBaseListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledResourceBaseManager.ListItemFilter")
+	}
+	if len(query.ResourceType) > 0 {
+		q = q.Contains("filter", "\""+query.ResourceType+"\"")
+	}
+	return q, nil
+}
+
+func (manager *SWebhookSubscriptionManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.WebhookSubscriptionListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SVirtualResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.VirtualResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SVirtualResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SWebhookSubscriptionManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SVirtualResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+func (manager *SWebhookSubscriptionManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.WebhookSubscriptionDetails {
+	rows := make([]api.WebhookSubscriptionDetails, len(objs))
+	virtRows := manager.SVirtualResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	for i := range rows {
+		rows[i] = api.WebhookSubscriptionDetails{
+			VirtualResourceDetails: virtRows[i],
+		}
+		sub := objs[i].(*SWebhookSubscription)
+		rows[i].DeadLetterCount, _ = sub.getDeliveryCount(api.WEBHOOK_DELIVERY_STATUS_DEAD_LETTER)
+		rows[i].PendingCount, _ = sub.getDeliveryCount(api.WEBHOOK_DELIVERY_STATUS_PENDING, api.WEBHOOK_DELIVERY_STATUS_RETRYING)
+	}
+	return rows
+}
+
+func isWebhookForbiddenIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, ipnet := range webhookForbiddenNets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupWebhookHost resolves host and fails if any of its addresses is
+// forbidden
+func lookupWebhookHost(ctx context.Context, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "lookup %s", host)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.Wrapf(errors.ErrNotFound, "no address of %s", host)
+	}
+	for _, ip := range ips {
+		if isWebhookForbiddenIP(ip) {
+			return nil, errors.Wrapf(httperrors.ErrForbidden, "address %s of %s is not allowed", ip, host)
+		}
+	}
+	return ips, nil
+}
+
+// webhookDialContext checks addresses again at connection time, the host
+// may resolve differently from the validation, e.g. DNS rebinding
+func webhookDialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "split %s", addr)
+	}
+	ips, err := lookupWebhookHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: webhookDialTimeout}
+	var conn net.Conn
+	for _, ip := range ips {
+		conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// webhookClient is for delivering events only.  It connects to checked
+// addresses directly without proxy
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:           webhookDialContext,
+		TLSHandshakeTimeout:   webhookDialTimeout,
+		ResponseHeaderTimeout: webhookRequestTimeout,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       time.Minute,
+	},
+	Timeout: webhookRequestTimeout,
+}
+
+func validateWebhookUrl(ctx context.Context, urlStr string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return httperrors.NewInputParameterError("invalid url %q: %v", urlStr, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return httperrors.NewInputParameterError("url scheme should be http or https")
+	}
+	if len(u.Hostname()) == 0 {
+		return httperrors.NewInputParameterError("url host is empty")
+	}
+	if _, err := lookupWebhookHost(ctx, u.Hostname()); err != nil {
+		return httperrors.NewInputParameterError("invalid url host: %v", err)
+	}
+	return nil
+}
+
+func validateWebhookSecret(secret string) error {
+	if len(secret) < webhookSecretMinLength || len(secret) > webhookSecretMaxLength {
+		return httperrors.NewInputParameterError("secret length should be between %d and %d", webhookSecretMinLength, webhookSecretMaxLength)
+	}
+	return nil
+}
+
+// isWebhookWatchableResource tells whether changes of the resource can be
+// subscribed, webhook resources are excluded to avoid event loops
+func isWebhookWatchableResource(keywordPlural string) bool {
+	if keywordPlural == WebhookSubscriptionManager.KeywordPlural() || keywordPlural == WebhookDeliveryManager.KeywordPlural() {
+		return false
+	}
+	for _, man := range db.GlobalModelManagerTables() {
+		if man.KeywordPlural() == keywordPlural {
+			return true
+		}
+	}
+	return false
+}
+
+func (manager *SWebhookSubscriptionManager) validateFilter(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	filter *api.WebhookEventFilter,
+) (*api.WebhookEventFilter, error) {
+	if filter == nil || len(filter.ResourceTypes) == 0 {
+		return nil, httperrors.NewMissingParameterError("filter.resource_types")
+	}
+	for _, resType := range filter.ResourceTypes {
+		if !isWebhookWatchableResource(resType) {
+			return nil, httperrors.NewInputParameterError("unsupported resource type %q", resType)
+		}
+	}
+	for _, action := range filter.Actions {
+		if !utils.IsInStringArray(action, api.WEBHOOK_ACTIONS) {
+			return nil, httperrors.NewInputParameterError("invalid action %q, should be one of %v", action, api.WEBHOOK_ACTIONS)
+		}
+	}
+	if filter.AllProjects {
+		if !userCred.HasSystemAdminPrivilege() {
+			return nil, httperrors.NewForbiddenError("not allow to subscribe events of all projects")
+		}
+		filter.ProjectIds = nil
+		return filter, nil
+	}
+	projectIds := make([]string, 0, len(filter.ProjectIds))
+	for _, projectId := range filter.ProjectIds {
+		tenant, err := db.DefaultProjectFetcher(ctx, projectId)
+		if err != nil {
+			if errors.Cause(err) == sql.ErrNoRows {
+				return nil, httperrors.NewResourceNotFoundError2("project", projectId)
+			}
+			return nil, errors.Wrap(err, "DefaultProjectFetcher")
+		}
+		if tenant.Id != ownerId.GetProjectId() && !userCred.HasSystemAdminPrivilege() {
+			if tenant.DomainId != ownerId.GetProjectDomainId() || !db.IsDomainAllowCreate(userCred, manager).Result.IsAllow() {
+				return nil, httperrors.NewForbiddenError("not allow to subscribe events of project %s", tenant.Name)
+			}
+		}
+		if !utils.IsInStringArray(tenant.Id, projectIds) {
+			projectIds = append(projectIds, tenant.Id)
+		}
+	}
+	filter.ProjectIds = projectIds
+	return filter, nil
+}
+
+func (manager *SWebhookSubscriptionManager) ValidateCreateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	ownerId mcclient.IIdentityProvider,
+	query jsonutils.JSONObject,
+	input api.WebhookSubscriptionCreateInput,
+) (api.WebhookSubscriptionCreateInput, error) {
+	var err error
+	input.VirtualResourceCreateInput, err = manager.SVirtualResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.VirtualResourceCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBaseManager.ValidateCreateData")
+	}
+	if err := validateWebhookUrl(ctx, input.Url); err != nil {
+		return input, err
+	}
+	if len(input.Secret) == 0 {
+		return input, httperrors.NewMissingParameterError("secret")
+	}
+	if err := validateWebhookSecret(input.Secret); err != nil {
+		return input, err
+	}
+	input.Filter, err = manager.validateFilter(ctx, userCred, ownerId, input.Filter)
+	if err != nil {
+		return input, err
+	}
+	input.Status = api.WEBHOOK_SUBSCRIPTION_STATUS_READY
+	if input.Enabled == nil {
+		input.SetEnabled()
+	}
+	return input, nil
+}
+
+func (self *SWebhookSubscription) ValidateUpdateData(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.WebhookSubscriptionUpdateInput,
+) (api.WebhookSubscriptionUpdateInput, error) {
+	var err error
+	input.VirtualResourceBaseUpdateInput, err = self.SVirtualResourceBase.ValidateUpdateData(ctx, userCred, query, input.VirtualResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SVirtualResourceBase.ValidateUpdateData")
+	}
+	if len(input.Url) > 0 {
+		if err := validateWebhookUrl(ctx, input.Url); err != nil {
+			return input, err
+		}
+	}
+	if input.Filter != nil {
+		input.Filter, err = WebhookSubscriptionManager.validateFilter(ctx, userCred, self.GetOwnerId(), input.Filter)
+		if err != nil {
+			return input, err
+		}
+	}
+	return input, nil
+}
+
+func (self *SWebhookSubscription) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	self.SVirtualResourceBase.PostCreate(ctx, userCred, ownerId, query, data)
+	secret, _ := data.GetString("secret")
+	if err := self.saveSecret(secret); err != nil {
+		log.Errorf("save secret of webhook subscription %s: %v", self.Id, err)
+	}
+	WebhookSubscriptionManager.RefreshWatchedResources(ctx, userCred, true)
+}
+
+func (self *SWebhookSubscription) saveSecret(secret string) error {
+	sec, err := utils.EncryptAESBase64(self.Id, secret)
+	if err != nil {
+		return errors.Wrap(err, "EncryptAESBase64")
+	}
+	_, err = db.Update(self, func() error {
+		self.Secret = sec
+		return nil
+	})
+	return err
+}
+
+func (self *SWebhookSubscription) getSecret() (string, error) {
+	if len(self.Secret) == 0 {
+		return "", errors.Wrap(errors.ErrNotFound, "empty secret")
+	}
+	return utils.DescryptAESBase64(self.Id, self.Secret)
+}
+
+func (self *SWebhookSubscription) PostUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	self.SVirtualResourceBase.PostUpdate(ctx, userCred, query, data)
+	WebhookSubscriptionManager.RefreshWatchedResources(ctx, userCred, true)
+}
+
+func (self *SWebhookSubscription) Delete(ctx context.Context, userCred mcclient.TokenCredential) error {
+	err := WebhookDeliveryManager.purgeSubscriptionDeliveries(self.Id)
+	if err != nil {
+		return errors.Wrap(err, "purgeSubscriptionDeliveries")
+	}
+	return self.SVirtualResourceBase.Delete(ctx, userCred)
+}
+
+func (self *SWebhookSubscription) PostDelete(ctx context.Context, userCred mcclient.TokenCredential) {
+	self.SVirtualResourceBase.PostDelete(ctx, userCred)
+	WebhookSubscriptionManager.RefreshWatchedResources(ctx, userCred, true)
+}
+
+func (self *SWebhookSubscription) PerformEnable(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input apis.PerformEnableInput) (jsonutils.JSONObject, error) {
+	err := db.EnabledPerformEnable(self, ctx, userCred, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "EnabledPerformEnable")
+	}
+	WebhookSubscriptionManager.RefreshWatchedResources(ctx, userCred, true)
+	return nil, nil
+}
+
+func (self *SWebhookSubscription) PerformDisable(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input apis.PerformDisableInput) (jsonutils.JSONObject, error) {
+	err := db.EnabledPerformEnable(self, ctx, userCred, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "EnabledPerformEnable")
+	}
+	WebhookSubscriptionManager.RefreshWatchedResources(ctx, userCred, true)
+	return nil, nil
+}
+
+// PerformResetSecret replaces the signing secret of the subscription
+func (self *SWebhookSubscription) PerformResetSecret(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.WebhookSubscriptionResetSecretInput) (jsonutils.JSONObject, error) {
+	if len(input.Secret) == 0 {
+		return nil, httperrors.NewMissingParameterError("secret")
+	}
+	if err := validateWebhookSecret(input.Secret); err != nil {
+		return nil, err
+	}
+	if err := self.saveSecret(input.Secret); err != nil {
+		return nil, errors.Wrap(err, "saveSecret")
+	}
+	db.OpsLog.LogEvent(self, db.ACT_UPDATE, "reset secret", userCred)
+	return nil, nil
+}
+
+// PerformRedeliver requeues all dead letters of the subscription
+func (self *SWebhookSubscription) PerformRedeliver(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	deliveries, err := self.getDeliveries(api.WEBHOOK_DELIVERY_STATUS_DEAD_LETTER)
+	if err != nil {
+		return nil, errors.Wrap(err, "getDeliveries")
+	}
+	for i := range deliveries {
+		if err := deliveries[i].requeue(ctx, userCred); err != nil {
+			return nil, errors.Wrapf(err, "requeue delivery %s", deliveries[i].Id)
+		}
+	}
+	return nil, nil
+}
+
+func (self *SWebhookSubscription) getDeliveriesQuery(status ...string) *sqlchemy.SQuery {
+	q := WebhookDeliveryManager.Query().Equals("webhook_subscription_id", self.Id)
+	if len(status) > 0 {
+		q = q.In("status", status)
+	}
+	return q
+}
+
+func (self *SWebhookSubscription) getDeliveryCount(status ...string) (int, error) {
+	return self.getDeliveriesQuery(status...).CountWithError()
+}
+
+func (self *SWebhookSubscription) getDeliveries(status ...string) ([]SWebhookDelivery, error) {
+	deliveries := make([]SWebhookDelivery, 0)
+	err := db.FetchModelObjects(WebhookDeliveryManager, self.getDeliveriesQuery(status...), &deliveries)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return deliveries, nil
+}
+
+// isMatch tells whether the change of a resource owned by projectId should
+// be delivered to the subscription
+func (self *SWebhookSubscription) isMatch(action, resType, projectId string) bool {
+	if self.Filter == nil || !utils.IsInStringArray(resType, self.Filter.ResourceTypes) {
+		return false
+	}
+	if len(self.Filter.Actions) > 0 && !utils.IsInStringArray(action, self.Filter.Actions) {
+		return false
+	}
+	if self.Filter.AllProjects {
+		return true
+	}
+	if len(projectId) == 0 {
+		return false
+	}
+	if len(self.Filter.ProjectIds) > 0 {
+		return utils.IsInStringArray(projectId, self.Filter.ProjectIds)
+	}
+	return projectId == self.ProjectId
+}
+
+func (manager *SWebhookSubscriptionManager) getEnabledSubscriptions() ([]SWebhookSubscription, error) {
+	q := manager.Query().IsTrue("enabled").IsFalse("pending_deleted")
+	subs := make([]SWebhookSubscription, 0)
+	err := db.FetchModelObjects(manager, q, &subs)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return subs, nil
+}
+
+func (manager *SWebhookSubscriptionManager) getMatchedSubscriptions(action, resType, projectId string) ([]SWebhookSubscription, error) {
+	subs, err := manager.getEnabledSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]SWebhookSubscription, 0)
+	for i := range subs {
+		if subs[i].isMatch(action, resType, projectId) {
+			ret = append(ret, subs[i])
+		}
+	}
+	return ret, nil
+}
+
+// RefreshWatchedResources reloads the resource types subscribed by enabled
+// subscriptions, it also runs periodically to pick up changes made by other
+// region instances
+func (manager *SWebhookSubscriptionManager) RefreshWatchedResources(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	subs, err := manager.getEnabledSubscriptions()
+	if err != nil {
+		log.Errorf("refresh webhook watched resources: %v", err)
+		return
+	}
+	resources := sets.NewString()
+	for i := range subs {
+		if subs[i].Filter != nil {
+			resources.Insert(subs[i].Filter.ResourceTypes...)
+		}
+	}
+	manager.watchedLock.Lock()
+	defer manager.watchedLock.Unlock()
+	manager.watchedResources = resources
+}
+
+func (manager *SWebhookSubscriptionManager) IsResourceWatched(keywordPlural string) bool {
+	manager.watchedLock.RLock()
+	defer manager.watchedLock.RUnlock()
+	return manager.watchedResources.Has(keywordPlural)
+}
@@ -400,6 +400,14 @@ func (self *SBaseRegionDriver) RequestSyncElasticcacheStatus(ctx context.Context
 	return fmt.Errorf("Not Implement RequestSyncElasticcacheStatus")
 }
 
+func (self *SBaseRegionDriver) RequestStartElasticcache(ctx context.Context, userCred mcclient.TokenCredential, elasticcache *models.SElasticcache, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestStartElasticcache")
+}
+
+func (self *SBaseRegionDriver) RequestStopElasticcache(ctx context.Context, userCred mcclient.TokenCredential, elasticcache *models.SElasticcache, task taskman.ITask) error {
+	return fmt.Errorf("Not Implement RequestStopElasticcache")
+}
+
 func (self *SBaseRegionDriver) RequestRemoteUpdateElasticcache(ctx context.Context, userCred mcclient.TokenCredential, elasticcache *models.SElasticcache, replaceTags bool, task taskman.ITask) error {
 	// nil ops
 	return nil
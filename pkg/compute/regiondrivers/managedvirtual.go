@@ -1905,6 +1905,54 @@ func (self *SManagedVirtualizationRegionDriver) RequestRestartElasticcache(ctx c
 	return ec.SetStatus(userCred, api.ELASTIC_CACHE_STATUS_RUNNING, "")
 }
 
+func (self *SManagedVirtualizationRegionDriver) RequestStartElasticcache(ctx context.Context, userCred mcclient.TokenCredential, ec *models.SElasticcache, task taskman.ITask) error {
+	iregion, err := ec.GetIRegion(ctx)
+	if err != nil {
+		return errors.Wrap(err, "GetIRegion")
+	}
+
+	iec, err := iregion.GetIElasticcacheById(ec.ExternalId)
+	if err != nil {
+		return errors.Wrap(err, "GetIElasticcacheById")
+	}
+
+	err = iec.Start()
+	if err != nil {
+		return errors.Wrap(err, "iec.Start")
+	}
+
+	err = cloudprovider.WaitStatusWithDelay(iec, api.ELASTIC_CACHE_STATUS_RUNNING, 10*time.Second, 10*time.Second, 1800*time.Second)
+	if err != nil {
+		return errors.Wrap(err, "WaitStatusWithDelay")
+	}
+
+	return ec.SetStatus(userCred, api.ELASTIC_CACHE_STATUS_RUNNING, "")
+}
+
+func (self *SManagedVirtualizationRegionDriver) RequestStopElasticcache(ctx context.Context, userCred mcclient.TokenCredential, ec *models.SElasticcache, task taskman.ITask) error {
+	iregion, err := ec.GetIRegion(ctx)
+	if err != nil {
+		return errors.Wrap(err, "GetIRegion")
+	}
+
+	iec, err := iregion.GetIElasticcacheById(ec.ExternalId)
+	if err != nil {
+		return errors.Wrap(err, "GetIElasticcacheById")
+	}
+
+	err = iec.Stop()
+	if err != nil {
+		return errors.Wrap(err, "iec.Stop")
+	}
+
+	err = cloudprovider.WaitStatusWithDelay(iec, api.ELASTIC_CACHE_STATUS_STOPPED, 10*time.Second, 10*time.Second, 1800*time.Second)
+	if err != nil {
+		return errors.Wrap(err, "WaitStatusWithDelay")
+	}
+
+	return ec.SetStatus(userCred, api.ELASTIC_CACHE_STATUS_STOPPED, "")
+}
+
 func (self *SManagedVirtualizationRegionDriver) RequestSyncElasticcache(ctx context.Context, userCred mcclient.TokenCredential, ec *models.SElasticcache, task taskman.ITask) error {
 	iregion, err := ec.GetIRegion(ctx)
 	if err != nil {
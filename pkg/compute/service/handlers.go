@@ -247,6 +247,9 @@ func InitHandlers(app *appsrv.Application) {
 
 		models.NetTapServiceManager,
 		models.NetTapFlowManager,
+
+		models.WebhookSubscriptionManager,
+		models.WebhookDeliveryManager,
 	} {
 		db.RegisterModelManager(manager)
 		handler := db.NewModelHandler(manager)
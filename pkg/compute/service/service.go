@@ -95,6 +95,8 @@ func StartService() {
 
 	options.InitNameSyncResources()
 
+	models.InitWebhookInformerBackend(app.GetContext())
+
 	setInfluxdbRetentionPolicy()
 
 	models.InitSyncWorkers(options.Options.CloudSyncWorkerCount)
@@ -132,6 +134,7 @@ func StartService() {
 		db.StartTenantCacheSync(app.GetContext(), opts.TenantCacheExpireSeconds)
 
 		cron := cronman.InitCronJobManager(true, options.Options.CronJobWorkerCount)
+		cron.AddJobAtIntervals("FailExpiredTasks", time.Duration(opts.TaskTimeoutCheckIntervalSeconds)*time.Second, taskman.TaskManager.FailExpiredTasks)
 		cron.AddJobAtIntervals("CleanPendingDeleteServers", time.Duration(opts.PendingDeleteCheckSeconds)*time.Second, models.GuestManager.CleanPendingDeleteServers)
 		cron.AddJobAtIntervals("CleanPendingDeleteDisks", time.Duration(opts.PendingDeleteCheckSeconds)*time.Second, models.DiskManager.CleanPendingDeleteDisks)
 		cron.AddJobAtIntervals("CleanPendingDeleteLoadbalancers", time.Duration(opts.LoadbalancerPendingDeleteCheckInterval)*time.Second, models.LoadbalancerAgentManager.CleanPendingDeleteLoadbalancers)
@@ -186,6 +189,8 @@ func StartService() {
 		cron.AddJobEveryFewHour("InspectAllTemplate", 1, 0, 0, models.GuestTemplateManager.InspectAllTemplate, true)
 
 		cron.AddJobEveryFewHour("CheckBillingResourceExpireAt", 1, 0, 0, models.CheckBillingResourceExpireAt, true)
+
+		cron.AddJobAtIntervals("RetryWebhookDeliveries", 30*time.Second, models.WebhookDeliveryManager.RetryDeliveries)
 		go cron.Start2(ctx, electObj)
 
 		// init auto scaling controller
@@ -103,6 +103,9 @@ func (self *SBaseStorageDriver) RequestCreateSnapshot(ctx context.Context, snaps
 	var params = jsonutils.NewDict()
 	params.Set("disk_id", jsonutils.NewString(snapshot.DiskId))
 	params.Set("snapshot_id", jsonutils.NewString(snapshot.Id))
+	if jsonutils.QueryBoolean(task.GetParams(), "fsfreeze", false) {
+		params.Set("fsfreeze", jsonutils.JSONTrue)
+	}
 	nt, err := taskman.TaskManager.NewTask(ctx, "GuestDiskSnapshotTask", guest, task.GetUserCred(), params, task.GetTaskId(), "", nil)
 	if err != nil {
 		return err
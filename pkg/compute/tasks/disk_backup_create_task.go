@@ -75,6 +75,23 @@ func (self *DiskBackupCreateTask) OnInit(ctx context.Context, obj db.IStandalone
 		self.OnSnapshot(ctx, backup, nil)
 		return
 	}
+	if backup.BackupMode == api.BACKUP_MODE_INCREMENTAL {
+		if self.isGuestRunning(backup) {
+			// changed blocks are exported from the running guest directly
+			self.OnSnapshot(ctx, backup, nil)
+			return
+		}
+		// dirty bitmap is only available in running guest, take a full backup by snapshot
+		_, err := db.Update(backup, func() error {
+			backup.BackupMode = api.BACKUP_MODE_FULL
+			backup.ParentId = ""
+			return nil
+		})
+		if err != nil {
+			self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_CREATE_FAILED)
+			return
+		}
+	}
 	backup.SetStatus(self.UserCred, api.BACKUP_STATUS_SNAPSHOT, "")
 	snapshot, err := self.CreateSnapshot(ctx, backup)
 	if err != nil {
@@ -118,21 +135,40 @@ func (self *DiskBackupCreateTask) OnSnapshotFailed(ctx context.Context, backup *
 	self.taskFailed(ctx, backup, data, api.BACKUP_STATUS_SNAPSHOT_FAILED)
 }
 
-func (self *DiskBackupCreateTask) OnSave(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
-	// cleanup snapshot
-	snapshotId, _ := self.Params.GetString("snapshot_id")
-	self.SetStage("OnCleanupSnapshot", nil)
-	snapshotModel, err := models.SnapshotManager.FetchById(snapshotId)
+func (self *DiskBackupCreateTask) isGuestRunning(backup *models.SDiskBackup) bool {
+	disk, err := backup.GetDisk()
 	if err != nil {
-		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_CLEANUP_SNAPSHOT_FAILED)
-		return
+		return false
 	}
+	guest := disk.GetGuest()
+	return guest != nil && guest.Status == api.VM_RUNNING
+}
+
+func (self *DiskBackupCreateTask) OnSave(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
 	log.Infof("data from RequestCreateBackup: %s", data)
 	sizeMb, _ := data.Int("size_mb")
+	backupMode, _ := data.GetString("backup_mode")
 	db.Update(backup, func() error {
 		backup.SizeMb = int(sizeMb)
+		// host takes a full backup if dirty bitmap of parent is missing
+		if backupMode == api.BACKUP_MODE_FULL {
+			backup.BackupMode = api.BACKUP_MODE_FULL
+			backup.ParentId = ""
+		}
 		return nil
 	})
+	snapshotId, _ := self.Params.GetString("snapshot_id")
+	if len(snapshotId) == 0 {
+		self.taksSuccess(ctx, backup, nil)
+		return
+	}
+	// cleanup snapshot
+	self.SetStage("OnCleanupSnapshot", nil)
+	snapshotModel, err := models.SnapshotManager.FetchById(snapshotId)
+	if err != nil {
+		self.taskFailed(ctx, backup, jsonutils.NewString(err.Error()), api.BACKUP_STATUS_CLEANUP_SNAPSHOT_FAILED)
+		return
+	}
 	snapshot := snapshotModel.(*models.SSnapshot)
 	err = snapshot.StartSnapshotDeleteTask(ctx, self.UserCred, false, self.GetId())
 	if err != nil {
@@ -143,6 +179,10 @@ func (self *DiskBackupCreateTask) OnSave(ctx context.Context, backup *models.SDi
 
 func (self *DiskBackupCreateTask) OnSaveFailed(ctx context.Context, backup *models.SDiskBackup, data jsonutils.JSONObject) {
 	snapshotId, _ := self.Params.GetString("snapshot_id")
+	if len(snapshotId) == 0 {
+		self.taskFailed(ctx, backup, data, api.BACKUP_STATUS_SAVE_FAILED)
+		return
+	}
 	snapshotModel, err := models.SnapshotManager.FetchById(snapshotId)
 	if err != nil {
 		log.Errorf("unable to cleanup snapshot: %s", err.Error())
@@ -166,6 +166,8 @@ func (self *EipDissociateTask) OnInit(ctx context.Context, obj db.IStandaloneMod
 					self.TaskFail(ctx, eip, jsonutils.NewString(msg), model)
 					return
 				}
+			case api.EIP_ASSOCIATE_TYPE_NAT_GATEWAY:
+				// nat rules of the eip are removed by vpcagent once dissociated
 			default:
 				errs = append(errs, errors.Wrapf(httperrors.ErrNotSupported, "not supported type %s", eip.AssociateType))
 			}
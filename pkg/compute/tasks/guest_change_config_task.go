@@ -248,6 +248,12 @@ func (self *GuestChangeConfigTask) OnGuestChangeCpuMemSpecComplete(ctx context.C
 	addMem := int(vmemSize - int64(guest.VmemSize))
 
 	_, err := db.Update(guest, func() error {
+		if self.Params.Contains("vtpm") {
+			guest.Vtpm = jsonutils.QueryBoolean(self.Params, "vtpm", false)
+		}
+		if self.Params.Contains("enable_numa") {
+			guest.EnableNuma = jsonutils.QueryBoolean(self.Params, "enable_numa", false)
+		}
 		if vcpuCount > 0 {
 			guest.VcpuCount = int(vcpuCount)
 		}
@@ -273,6 +279,12 @@ func (self *GuestChangeConfigTask) OnGuestChangeCpuMemSpecComplete(ctx context.C
 	if len(instanceType) > 0 {
 		changeConfigSpec.Set("instance_type", jsonutils.NewString(instanceType))
 	}
+	if self.Params.Contains("vtpm") {
+		changeConfigSpec.Set("vtpm", jsonutils.NewBool(guest.Vtpm))
+	}
+	if self.Params.Contains("enable_numa") {
+		changeConfigSpec.Set("enable_numa", jsonutils.NewBool(guest.EnableNuma))
+	}
 
 	db.OpsLog.LogEvent(guest, db.ACT_CHANGE_FLAVOR, changeConfigSpec.String(), self.UserCred)
 
@@ -239,9 +239,25 @@ func (self *GuestMigrateTask) OnSrcPrepareComplete(ctx context.Context, guest *m
 		self.TaskFailed(ctx, guest, jsonutils.NewString(err.Error()))
 		return
 	}
+	if data != nil && data.Contains("vtpm_state") {
+		// vTPM state lives in the guest home dir of source host even on shared storage
+		vtpmState, _ := data.Get("vtpm_state")
+		body.Set("vtpm_state", vtpmState)
+	}
 	guestStatus, _ := self.Params.GetString("guest_status")
 	if !self.isRescueMode() && (guestStatus == api.VM_RUNNING || guestStatus == api.VM_SUSPEND) {
 		body.Set("live_migrate", jsonutils.JSONTrue)
+		// guest visible NUMA topology can't be changed during live migration
+		placement, err := guest.GetNumaPlacementLikeAtHost(ctx, targetHost)
+		if err != nil {
+			self.TaskFailed(ctx, guest, jsonutils.NewString(err.Error()))
+			return
+		}
+		if placement != nil {
+			desc, _ := body.Get("desc")
+			desc.(*jsonutils.JSONDict).Set("numa_nodes", jsonutils.Marshal(placement.Nodes))
+			self.Params.Set("numa_placement", jsonutils.Marshal(placement))
+		}
 	}
 
 	headers := self.GetTaskRequestHeader()
@@ -507,6 +523,15 @@ func (self *GuestMigrateTask) setGuest(ctx context.Context, guest *models.SGuest
 	if err != nil {
 		return err
 	}
+	if self.Params.Contains("numa_placement") {
+		placement := new(api.GuestNumaPlacement)
+		if err := self.Params.Unmarshal(placement, "numa_placement"); err != nil {
+			return errors.Wrap(err, "unmarshal numa_placement")
+		}
+		if err := guest.SetNumaPlacement(placement); err != nil {
+			return errors.Wrap(err, "SetNumaPlacement")
+		}
+	}
 	return nil
 }
 
@@ -16,6 +16,7 @@ package tasks
 
 import (
 	"context"
+	"time"
 
 	"yunion.io/x/jsonutils"
 
@@ -26,6 +27,11 @@ import (
 	"yunion.io/x/onecloud/pkg/util/logclient"
 )
 
+const (
+	guestStartTaskTimeout  = 30 * time.Minute
+	guestStartStageTimeout = 10 * time.Minute
+)
+
 type GuestStartTask struct {
 	SGuestBaseTask
 }
@@ -72,6 +78,23 @@ func (self *GuestStartTask) taskComplete(ctx context.Context, guest *models.SGue
 	self.SetStageComplete(ctx, nil)
 }
 
+func (self *GuestStartTask) GetTaskTimeout() time.Duration {
+	return guestStartTaskTimeout
+}
+
+func (self *GuestStartTask) GetStageTimeout(stage string) time.Duration {
+	if stage == "OnStartComplete" {
+		return guestStartStageTimeout
+	}
+	return 0
+}
+
+// OnCancel leaves the guest in start_fail so that it can be started again
+// or synced, instead of starting forever
+func (self *GuestStartTask) OnCancel(ctx context.Context, obj db.IStandaloneModel, reason jsonutils.JSONObject) {
+	self.OnStartCompleteFailed(ctx, obj, reason)
+}
+
 type GuestSchedStartTask struct {
 	SGuestBaseTask
 }
@@ -16,6 +16,7 @@ package tasks
 
 import (
 	"context"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
@@ -28,6 +29,11 @@ import (
 	"yunion.io/x/onecloud/pkg/util/logclient"
 )
 
+const (
+	guestStopTaskTimeout  = 30 * time.Minute
+	guestStopStageTimeout = 10 * time.Minute
+)
+
 type GuestStopTask struct {
 	SGuestBaseTask
 }
@@ -82,6 +88,23 @@ func (self *GuestStopTask) OnGuestStopTaskCompleteFailed(ctx context.Context, gu
 	logclient.AddActionLogWithStartable(self, guest, logclient.ACT_VM_STOP, reason.String(), self.UserCred, false)
 }
 
+func (self *GuestStopTask) GetTaskTimeout() time.Duration {
+	return guestStopTaskTimeout
+}
+
+func (self *GuestStopTask) GetStageTimeout(stage string) time.Duration {
+	if stage == "OnGuestStopTaskComplete" {
+		return guestStopStageTimeout
+	}
+	return 0
+}
+
+// OnCancel marks the guest stop_fail, the parent task is notified of the
+// failure for a subtask
+func (self *GuestStopTask) OnCancel(ctx context.Context, guest *models.SGuest, reason jsonutils.JSONObject) {
+	self.OnGuestStopTaskCompleteFailed(ctx, guest, reason)
+}
+
 type GuestStopAndFreezeTask struct {
 	SGuestBaseTask
 }
@@ -16,6 +16,7 @@ package tasks
 
 import (
 	"context"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
@@ -28,6 +29,12 @@ import (
 	"yunion.io/x/onecloud/pkg/compute/models"
 )
 
+const (
+	guestSyncstatusStageTimeout = 5 * time.Minute
+	guestSyncstatusRetries      = 2
+	guestSyncstatusRetryWait    = 30 * time.Second
+)
+
 type GuestSyncstatusTask struct {
 	SGuestBaseTask
 }
@@ -103,3 +110,32 @@ func (self *GuestSyncstatusTask) OnGetStatusCompleteFailed(ctx context.Context,
 	self.SetStageComplete(ctx, nil)
 	// logclient.AddActionLog(guest, logclient.ACT_VM_SYNC_STATUS, err, self.UserCred, false)
 }
+
+func (self *GuestSyncstatusTask) GetTaskTimeout() time.Duration {
+	return 0
+}
+
+func (self *GuestSyncstatusTask) GetStageTimeout(stage string) time.Duration {
+	if stage == "OnGetStatusComplete" {
+		return guestSyncstatusStageTimeout
+	}
+	return 0
+}
+
+// GetStageRetryPolicy retries querying status, which is idempotent, when the
+// host fails or does not answer
+func (self *GuestSyncstatusTask) GetStageRetryPolicy(stage string) *taskman.STaskRetryPolicy {
+	if stage == taskman.TASK_INIT_STAGE {
+		return &taskman.STaskRetryPolicy{
+			MaxRetries: guestSyncstatusRetries,
+			Interval:   guestSyncstatusRetryWait,
+		}
+	}
+	return nil
+}
+
+func (self *GuestSyncstatusTask) OnCancel(ctx context.Context, obj db.IStandaloneModel, reason jsonutils.JSONObject) {
+	guest := obj.(*models.SGuest)
+	guest.SetStatus(self.UserCred, api.VM_UNKNOWN, reason.String())
+	self.SetStageFailed(ctx, reason)
+}
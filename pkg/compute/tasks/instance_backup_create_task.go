@@ -20,6 +20,7 @@ import (
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
 
 	"yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
@@ -66,6 +67,25 @@ func (self *InstanceBackupCreateTask) OnInit(ctx context.Context, obj db.IStanda
 func (self *InstanceBackupCreateTask) OnKvmDisksSnapshot(ctx context.Context, ib *models.SInstanceBackup, data jsonutils.JSONObject) {
 	subTasks := taskman.SubTaskManager.GetTotalSubtasks(self.Id, "OnKvmDisksSnapshot", "")
 	guest := models.GuestManager.FetchGuestById(ib.GuestId)
+	if guest.Vtpm {
+		host, err := guest.GetHost()
+		if err != nil {
+			self.taskFailed(ctx, ib, guest, jsonutils.NewString(err.Error()), compute.INSTANCE_BACKUP_STATUS_SNAPSHOT_FAILED)
+			return
+		}
+		state, err := guest.GetDriver().RequestFetchVtpmState(ctx, self.UserCred, host, guest)
+		if err != nil {
+			self.taskFailed(ctx, ib, guest, jsonutils.NewString(errors.Wrap(err, "RequestFetchVtpmState").Error()), compute.INSTANCE_BACKUP_STATUS_SNAPSHOT_FAILED)
+			return
+		}
+		if _, err := db.Update(ib, func() error {
+			ib.VtpmState = state
+			return nil
+		}); err != nil {
+			self.taskFailed(ctx, ib, guest, jsonutils.NewString(err.Error()), compute.INSTANCE_BACKUP_STATUS_SNAPSHOT_FAILED)
+			return
+		}
+	}
 	self.SetStage("OnInstanceBackup", nil)
 	for i := range subTasks {
 		log.Infof("subsTask %s result: %s", subTasks[i].SubtaskId, subTasks[i].Result)
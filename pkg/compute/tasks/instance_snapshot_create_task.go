@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
 
 	"yunion.io/x/onecloud/pkg/apis/compute"
 	hostapi "yunion.io/x/onecloud/pkg/apis/host"
@@ -140,6 +141,25 @@ func (self *InstanceSnapshotCreateTask) OnInstanceSnapshot(ctx context.Context,
 			return
 		}
 	}
+	if isp.Vtpm {
+		host, err := guest.GetHost()
+		if err != nil {
+			self.taskFail(ctx, isp, guest, jsonutils.NewString(err.Error()))
+			return
+		}
+		state, err := guest.GetDriver().RequestFetchVtpmState(ctx, self.UserCred, host, guest)
+		if err != nil {
+			self.taskFail(ctx, isp, guest, jsonutils.NewString(errors.Wrap(err, "RequestFetchVtpmState").Error()))
+			return
+		}
+		if _, err := db.Update(isp, func() error {
+			isp.VtpmState = state
+			return nil
+		}); err != nil {
+			self.taskFail(ctx, isp, guest, jsonutils.NewString(err.Error()))
+			return
+		}
+	}
 	self.taskComplete(ctx, isp, guest, data)
 }
 
@@ -18,6 +18,7 @@ import (
 	"context"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
 
 	"yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
@@ -108,6 +109,18 @@ func (self *InstanceSnapshotResetTask) OnKvmDiskResetFailed(
 
 func (self *InstanceSnapshotResetTask) OnInstanceSnapshotReset(ctx context.Context, isp *models.SInstanceSnapshot, data jsonutils.JSONObject) {
 	guest, _ := isp.GetGuest()
+	if guest.Vtpm && len(isp.VtpmState) > 0 {
+		host, err := guest.GetHost()
+		if err != nil {
+			self.taskFail(ctx, isp, guest, jsonutils.NewString(err.Error()))
+			return
+		}
+		err = guest.GetDriver().RequestRestoreVtpmState(ctx, self.UserCred, host, guest, isp.VtpmState)
+		if err != nil {
+			self.taskFail(ctx, isp, guest, jsonutils.NewString(errors.Wrap(err, "RequestRestoreVtpmState").Error()))
+			return
+		}
+	}
 	if jsonutils.QueryBoolean(self.Params, "auto_start", false) {
 		self.SetStage("OnGuestStartComplete", nil)
 		isp.SetStatus(self.UserCred, compute.INSTANCE_SNAPSHOT_READY, "")
@@ -61,6 +61,13 @@ func (self *NatGatewayCreateTask) OnInit(ctx context.Context, obj db.IStandalone
 		return
 	}
 
+	if !nat.IsManaged() {
+		// onecloud nat gateway is realized by vpcagent
+		self.SetStage("OnCreateNatGatewayCreateComplete", nil)
+		self.OnCreateNatGatewayCreateComplete(ctx, nat, nil)
+		return
+	}
+
 	opts.VpcId = vpc.ExternalId
 
 	if len(nat.NetworkId) > 0 {
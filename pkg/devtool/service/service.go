@@ -16,6 +16,7 @@ package service
 
 import (
 	"os"
+	"time"
 
 	"yunion.io/x/log"
 	_ "yunion.io/x/sqlchemy/backends"
@@ -24,6 +25,7 @@ import (
 	"yunion.io/x/onecloud/pkg/cloudcommon"
 	app_common "yunion.io/x/onecloud/pkg/cloudcommon/app"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 	"yunion.io/x/onecloud/pkg/devtool/models"
 	"yunion.io/x/onecloud/pkg/devtool/options"
@@ -55,6 +57,7 @@ func StartService() {
 	db.EnsureAppSyncDB(app, dbOpts, models.InitDB)
 
 	models.InitializeCronjobs()
+	models.DevToolCronManager.AddJobAtIntervals("FailExpiredTasks", time.Duration(opts.TaskTimeoutCheckIntervalSeconds)*time.Second, taskman.TaskManager.FailExpiredTasks)
 
 	app_common.ServeForeverWithCleanup(app, baseOpts, func() {
 		cloudcommon.CloseDB()
@@ -0,0 +1,898 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	ylog "yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/netutils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/compute/models"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/informer"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+)
+
+const (
+	defaultCacheRefreshSeconds = 300
+
+	// resync requests in a short period are merged into one reload
+	cacheReloadDelay = 2 * time.Second
+)
+
+type sGuestNic struct {
+	// row id of guestnetwork
+	RowId     int64
+	GuestId   string
+	GuestName string
+	ProjectId string
+	IpAddr    string
+	Ip6Addr   string
+	NetworkId string
+	VpcId     string
+}
+
+type sGuest struct {
+	Name      string
+	ProjectId string
+}
+
+type sHost struct {
+	Name     string
+	AccessIp string
+}
+
+type sHostNet struct {
+	HostId string
+	IpAddr string
+}
+
+type sNetworkRange struct {
+	Id         string
+	ProjectId  string
+	VpcId      string
+	HasGateway bool
+	IpStart    netutils.IPV4Addr
+	IpEnd      netutils.IPV4Addr
+}
+
+// sSourceInfo is where a query comes from, used for split-horizon answers
+type sSourceInfo struct {
+	ProjectId string
+	NetworkId string
+	VpcId     string
+	InCloud   bool
+}
+
+// sDNSCacheData keeps resources needed to answer queries, the resources
+// are indexed by id so that changes published by informer can be applied
+// in place, the lookup maps are derived from them
+type sDNSCacheData struct {
+	// host id to host
+	hosts map[string]*sHost
+	// row id of hostnetwork to other address of host
+	hostNets map[int64]*sHostNet
+	// lower cased host name to access ip
+	hostIps map[string][]string
+	// host ip to host name
+	hostNames map[string]string
+
+	// id to guest which is not pending deleted
+	guests map[string]*sGuest
+	// row id of guestnetwork to nic
+	guestNics map[int64]*sGuestNic
+	// lower cased guest name to nics
+	guestNicsByName map[string][]*sGuestNic
+	// ipv4 or ipv6 address to nics
+	guestNicsByIp map[string][]*sGuestNic
+
+	// wire id to vpc id
+	wireVpcs map[string]string
+	// id to network of all vpcs
+	allNetworks map[string]*sNetworkRange
+	// networks of default vpc
+	networks []*sNetworkRange
+
+	// id to enabled dns record
+	recordsById map[string]*models.SDnsRecord
+	// lower cased name to enabled dns records
+	records map[string][]*models.SDnsRecord
+}
+
+func newDNSCacheData() *sDNSCacheData {
+	return &sDNSCacheData{
+		hosts:           make(map[string]*sHost),
+		hostNets:        make(map[int64]*sHostNet),
+		hostIps:         make(map[string][]string),
+		hostNames:       make(map[string]string),
+		guests:          make(map[string]*sGuest),
+		guestNics:       make(map[int64]*sGuestNic),
+		guestNicsByName: make(map[string][]*sGuestNic),
+		guestNicsByIp:   make(map[string][]*sGuestNic),
+		wireVpcs:        make(map[string]string),
+		allNetworks:     make(map[string]*sNetworkRange),
+		networks:        make([]*sNetworkRange, 0),
+		recordsById:     make(map[string]*models.SDnsRecord),
+		records:         make(map[string][]*models.SDnsRecord),
+	}
+}
+
+func (d *sDNSCacheData) addHost(name, ip string) {
+	if len(ip) == 0 {
+		return
+	}
+	key := strings.ToLower(name)
+	d.hostIps[key] = append(d.hostIps[key], ip)
+	if _, ok := d.hostNames[ip]; !ok {
+		d.hostNames[ip] = name
+	}
+}
+
+// rebuildHostIndex derives the lookup maps of hosts, access ips take
+// precedence over other addresses in reverse lookup
+func (d *sDNSCacheData) rebuildHostIndex() {
+	d.hostIps = make(map[string][]string)
+	d.hostNames = make(map[string]string)
+	for _, host := range d.hosts {
+		d.addHost(host.Name, host.AccessIp)
+	}
+	for _, net := range d.hostNets {
+		host, ok := d.hosts[net.HostId]
+		if !ok || len(net.IpAddr) == 0 {
+			continue
+		}
+		if _, ok := d.hostNames[net.IpAddr]; !ok {
+			d.hostNames[net.IpAddr] = host.Name
+		}
+	}
+}
+
+func (d *sDNSCacheData) addGuestNic(nic *sGuestNic) {
+	key := strings.ToLower(nic.GuestName)
+	d.guestNicsByName[key] = append(d.guestNicsByName[key], nic)
+	for _, ip := range []string{nic.IpAddr, nic.Ip6Addr} {
+		if len(ip) > 0 {
+			d.guestNicsByIp[ip] = append(d.guestNicsByIp[ip], nic)
+		}
+	}
+}
+
+// removeNic returns a new slice so that the slices returned to readers
+// before are not changed
+func removeNic(nics []*sGuestNic, nic *sGuestNic) []*sGuestNic {
+	ret := make([]*sGuestNic, 0, len(nics))
+	for i := range nics {
+		if nics[i] != nic {
+			ret = append(ret, nics[i])
+		}
+	}
+	return ret
+}
+
+func (d *sDNSCacheData) removeGuestNic(nic *sGuestNic) {
+	key := strings.ToLower(nic.GuestName)
+	if nics := removeNic(d.guestNicsByName[key], nic); len(nics) > 0 {
+		d.guestNicsByName[key] = nics
+	} else {
+		delete(d.guestNicsByName, key)
+	}
+	for _, ip := range []string{nic.IpAddr, nic.Ip6Addr} {
+		if len(ip) == 0 {
+			continue
+		}
+		if nics := removeNic(d.guestNicsByIp[ip], nic); len(nics) > 0 {
+			d.guestNicsByIp[ip] = nics
+		} else {
+			delete(d.guestNicsByIp, ip)
+		}
+	}
+}
+
+// getNicsOfGuest returns nics of guest, name is the guest name the nics
+// are indexed by
+func (d *sDNSCacheData) getNicsOfGuest(guestId, name string) []*sGuestNic {
+	ret := make([]*sGuestNic, 0)
+	for _, nic := range d.guestNicsByName[strings.ToLower(name)] {
+		if nic.GuestId == guestId {
+			ret = append(ret, nic)
+		}
+	}
+	return ret
+}
+
+// setGuest adds or updates a guest and the name and project of its nics
+func (d *sDNSCacheData) setGuest(id, name, projectId string) {
+	if guest, ok := d.guests[id]; ok {
+		if guest.Name == name && guest.ProjectId == projectId {
+			return
+		}
+		for _, nic := range d.getNicsOfGuest(id, guest.Name) {
+			d.removeGuestNic(nic)
+			nic.GuestName = name
+			nic.ProjectId = projectId
+			d.addGuestNic(nic)
+		}
+	}
+	d.guests[id] = &sGuest{Name: name, ProjectId: projectId}
+}
+
+func (d *sDNSCacheData) deleteGuest(id string) {
+	guest, ok := d.guests[id]
+	if !ok {
+		return
+	}
+	for _, nic := range d.getNicsOfGuest(id, guest.Name) {
+		d.removeGuestNic(nic)
+		delete(d.guestNics, nic.RowId)
+	}
+	delete(d.guests, id)
+}
+
+// setGuestNic adds or updates a guestnetwork, false is returned if the
+// guest or network is not known yet
+func (d *sDNSCacheData) setGuestNic(rowId int64, guestId, networkId, ipAddr, ip6Addr string) bool {
+	d.deleteGuestNic(rowId)
+	guest, ok := d.guests[guestId]
+	if !ok {
+		return false
+	}
+	net, ok := d.allNetworks[networkId]
+	if !ok {
+		return false
+	}
+	if !net.HasGateway || (len(ipAddr) == 0 && len(ip6Addr) == 0) {
+		return true
+	}
+	nic := &sGuestNic{
+		RowId:     rowId,
+		GuestId:   guestId,
+		GuestName: guest.Name,
+		ProjectId: guest.ProjectId,
+		IpAddr:    ipAddr,
+		Ip6Addr:   ip6Addr,
+		NetworkId: networkId,
+		VpcId:     net.VpcId,
+	}
+	d.guestNics[rowId] = nic
+	d.addGuestNic(nic)
+	return true
+}
+
+func (d *sDNSCacheData) deleteGuestNic(rowId int64) {
+	if nic, ok := d.guestNics[rowId]; ok {
+		d.removeGuestNic(nic)
+		delete(d.guestNics, rowId)
+	}
+}
+
+// rebuildNetworkIndex derives the networks of default vpc used to find
+// the source of queries
+func (d *sDNSCacheData) rebuildNetworkIndex() {
+	d.networks = make([]*sNetworkRange, 0)
+	for _, net := range d.allNetworks {
+		if net.VpcId == api.DEFAULT_VPC_ID && net.IpEnd > 0 {
+			d.networks = append(d.networks, net)
+		}
+	}
+}
+
+// setNetwork adds or updates a network, false is returned if the wire is
+// not known yet
+func (d *sDNSCacheData) setNetwork(id, projectId, start, end, wireId, gateway string) bool {
+	vpcId, ok := d.wireVpcs[wireId]
+	if !ok {
+		return false
+	}
+	// networks without valid ipv4 range are kept for their nics but never
+	// match a source address
+	ipStart, _ := netutils.NewIPV4Addr(start)
+	ipEnd, _ := netutils.NewIPV4Addr(end)
+	d.allNetworks[id] = &sNetworkRange{
+		Id:         id,
+		ProjectId:  projectId,
+		VpcId:      vpcId,
+		HasGateway: len(gateway) > 0,
+		IpStart:    ipStart,
+		IpEnd:      ipEnd,
+	}
+	return true
+}
+
+func (d *sDNSCacheData) addRecord(rec *models.SDnsRecord) {
+	key := strings.ToLower(rec.Name)
+	d.records[key] = append(d.records[key], rec)
+}
+
+// setRecord adds, updates or removes a dns record by its enabled state
+func (d *sDNSCacheData) setRecord(rec *models.SDnsRecord) {
+	d.deleteRecord(rec.Id)
+	if !rec.Enabled.IsTrue() {
+		return
+	}
+	d.recordsById[rec.Id] = rec
+	d.addRecord(rec)
+}
+
+func (d *sDNSCacheData) deleteRecord(id string) {
+	old, ok := d.recordsById[id]
+	if !ok {
+		return
+	}
+	delete(d.recordsById, id)
+	key := strings.ToLower(old.Name)
+	recs := make([]*models.SDnsRecord, 0, len(d.records[key]))
+	for _, rec := range d.records[key] {
+		if rec != old {
+			recs = append(recs, rec)
+		}
+	}
+	if len(recs) > 0 {
+		d.records[key] = recs
+	} else {
+		delete(d.records, key)
+	}
+}
+
+// getSource finds the guest or network of a source ip, guests in default
+// vpc are preferred if the address is used in several vpcs
+func (d *sDNSCacheData) getSource(ip string) sSourceInfo {
+	var found *sGuestNic
+	for _, nic := range d.guestNicsByIp[ip] {
+		if found == nil || nic.VpcId == api.DEFAULT_VPC_ID {
+			found = nic
+		}
+	}
+	if found != nil {
+		return sSourceInfo{
+			ProjectId: found.ProjectId,
+			NetworkId: found.NetworkId,
+			VpcId:     found.VpcId,
+			InCloud:   true,
+		}
+	}
+	addr, err := netutils.NewIPV4Addr(ip)
+	if err != nil {
+		return sSourceInfo{}
+	}
+	for _, net := range d.networks {
+		if net.IpStart <= addr && addr <= net.IpEnd {
+			return sSourceInfo{
+				ProjectId: net.ProjectId,
+				NetworkId: net.Id,
+				VpcId:     net.VpcId,
+				InCloud:   true,
+			}
+		}
+	}
+	return sSourceInfo{}
+}
+
+// getRecord returns the enabled record of name visible to project, records
+// of the project itself take precedence over public ones
+func (d *sDNSCacheData) getRecord(projectId, name string) *models.SDnsRecord {
+	var public *models.SDnsRecord
+	for _, rec := range d.records[strings.ToLower(name)] {
+		if len(projectId) > 0 && rec.ProjectId == projectId {
+			return rec
+		}
+		if rec.IsPublic && public == nil {
+			public = rec
+		}
+	}
+	return public
+}
+
+func (d *sDNSCacheData) getHostIps(name string) []string {
+	return d.hostIps[strings.ToLower(name)]
+}
+
+// getGuestIps returns addresses of guest nics, nics in the same vpc as the
+// source are preferred, then nics of classic networks
+func (d *sDNSCacheData) getGuestIps(name string, src sSourceInfo) []string {
+	nics := d.guestNicsByName[strings.ToLower(name)]
+	if len(nics) == 0 {
+		return nil
+	}
+	filter := func(vpcId string) []*sGuestNic {
+		ret := make([]*sGuestNic, 0)
+		for _, nic := range nics {
+			if nic.VpcId == vpcId {
+				ret = append(ret, nic)
+			}
+		}
+		return ret
+	}
+	if len(src.VpcId) > 0 {
+		if sameVpc := filter(src.VpcId); len(sameVpc) > 0 {
+			nics = sameVpc
+		} else if classic := filter(api.DEFAULT_VPC_ID); len(classic) > 0 {
+			nics = classic
+		}
+	}
+	intIps := make([]string, 0)
+	extIps := make([]string, 0)
+	ip6s := make([]string, 0)
+	for _, nic := range nics {
+		if len(nic.IpAddr) > 0 {
+			addr, _ := netutils.NewIPV4Addr(nic.IpAddr)
+			if netutils.IsExitAddress(addr) {
+				extIps = append(extIps, nic.IpAddr)
+			} else {
+				intIps = append(intIps, nic.IpAddr)
+			}
+		}
+		if len(nic.Ip6Addr) > 0 {
+			ip6s = append(ip6s, nic.Ip6Addr)
+		}
+	}
+	if len(intIps) > 0 {
+		return append(intIps, ip6s...)
+	}
+	return append(extIps, ip6s...)
+}
+
+// getNameByIp returns name of host or guest with address ip
+func (d *sDNSCacheData) getNameByIp(ip string) string {
+	if name, ok := d.hostNames[ip]; ok {
+		return name
+	}
+	if nics := d.guestNicsByIp[ip]; len(nics) > 0 {
+		return nics[0].GuestName
+	}
+	return ""
+}
+
+// sDNSCache keeps resources in memory so that queries do not hit database,
+// changes published by informer are applied to the cache in place and the
+// whole cache is reloaded from database periodically
+type sDNSCache struct {
+	lock sync.RWMutex
+	data *sDNSCacheData
+
+	refreshInterval time.Duration
+	// request a reload when a change can not be applied in place
+	resync chan struct{}
+}
+
+func newDNSCache(refreshSeconds int) *sDNSCache {
+	if refreshSeconds <= 0 {
+		refreshSeconds = defaultCacheRefreshSeconds
+	}
+	return &sDNSCache{
+		data:            newDNSCacheData(),
+		refreshInterval: time.Duration(refreshSeconds) * time.Second,
+		resync:          make(chan struct{}, 1),
+	}
+}
+
+func (c *sDNSCache) getSource(ip string) sSourceInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.data.getSource(ip)
+}
+
+func (c *sDNSCache) getRecord(projectId, name string) *models.SDnsRecord {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.data.getRecord(projectId, name)
+}
+
+func (c *sDNSCache) getHostIps(name string) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.data.getHostIps(name)
+}
+
+func (c *sDNSCache) getGuestIps(name string, src sSourceInfo) []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.data.getGuestIps(name, src)
+}
+
+func (c *sDNSCache) getNameByIp(ip string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.data.getNameByIp(ip)
+}
+
+func (c *sDNSCache) reload() error {
+	data, err := loadDNSCacheData()
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.data = data
+	return nil
+}
+
+func (c *sDNSCache) requestResync() {
+	select {
+	case c.resync <- struct{}{}:
+	default:
+	}
+}
+
+// apply applies a change to the cache, a resync is requested if the
+// change refers to resources unknown to the cache
+func (c *sDNSCache) apply(f func(d *sDNSCacheData) bool) {
+	c.lock.Lock()
+	ok := f(c.data)
+	c.lock.Unlock()
+	if !ok {
+		c.requestResync()
+	}
+}
+
+// start loads data and reloads it periodically or on resync request
+func (c *sDNSCache) start() {
+	if err := c.reload(); err != nil {
+		ylog.Errorf("load dns cache: %v", err)
+	}
+	go func() {
+		ticker := time.NewTicker(c.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.resync:
+				time.Sleep(cacheReloadDelay)
+				// drop requests during the delay
+				select {
+				case <-c.resync:
+				default:
+				}
+			case <-ticker.C:
+			}
+			if err := c.reload(); err != nil {
+				ylog.Errorf("reload dns cache: %v", err)
+			}
+		}
+	}()
+}
+
+func (c *sDNSCache) onHostChange(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	name, _ := obj.GetString("name")
+	accessIp, _ := obj.GetString("access_ip")
+	c.apply(func(d *sDNSCacheData) bool {
+		d.hosts[id] = &sHost{Name: name, AccessIp: accessIp}
+		d.rebuildHostIndex()
+		return true
+	})
+}
+
+func (c *sDNSCache) onHostDelete(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	c.apply(func(d *sDNSCacheData) bool {
+		delete(d.hosts, id)
+		d.rebuildHostIndex()
+		return true
+	})
+}
+
+func (c *sDNSCache) onHostNetChange(obj *jsonutils.JSONDict) {
+	rowId, _ := obj.Int("row_id")
+	hostId, _ := obj.GetString("baremetal_id")
+	ipAddr, _ := obj.GetString("ip_addr")
+	c.apply(func(d *sDNSCacheData) bool {
+		d.hostNets[rowId] = &sHostNet{HostId: hostId, IpAddr: ipAddr}
+		d.rebuildHostIndex()
+		return true
+	})
+}
+
+func (c *sDNSCache) onHostNetDelete(obj *jsonutils.JSONDict) {
+	rowId, _ := obj.Int("row_id")
+	c.apply(func(d *sDNSCacheData) bool {
+		delete(d.hostNets, rowId)
+		d.rebuildHostIndex()
+		return true
+	})
+}
+
+func (c *sDNSCache) onGuestChange(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	if jsonutils.QueryBoolean(obj, "pending_deleted", false) {
+		c.onGuestDelete(obj)
+		return
+	}
+	name, _ := obj.GetString("name")
+	projectId, _ := obj.GetString("tenant_id")
+	c.apply(func(d *sDNSCacheData) bool {
+		d.setGuest(id, name, projectId)
+		return true
+	})
+}
+
+func (c *sDNSCache) onGuestDelete(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	c.apply(func(d *sDNSCacheData) bool {
+		d.deleteGuest(id)
+		return true
+	})
+}
+
+func (c *sDNSCache) onGuestNicChange(obj *jsonutils.JSONDict) {
+	rowId, _ := obj.Int("row_id")
+	guestId, _ := obj.GetString("guest_id")
+	networkId, _ := obj.GetString("network_id")
+	ipAddr, _ := obj.GetString("ip_addr")
+	ip6Addr, _ := obj.GetString("ip6_addr")
+	c.apply(func(d *sDNSCacheData) bool {
+		return d.setGuestNic(rowId, guestId, networkId, ipAddr, ip6Addr)
+	})
+}
+
+func (c *sDNSCache) onGuestNicDelete(obj *jsonutils.JSONDict) {
+	rowId, _ := obj.Int("row_id")
+	c.apply(func(d *sDNSCacheData) bool {
+		d.deleteGuestNic(rowId)
+		return true
+	})
+}
+
+func (c *sDNSCache) onNetworkChange(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	projectId, _ := obj.GetString("tenant_id")
+	start, _ := obj.GetString("guest_ip_start")
+	end, _ := obj.GetString("guest_ip_end")
+	wireId, _ := obj.GetString("wire_id")
+	gateway, _ := obj.GetString("guest_gateway")
+	c.apply(func(d *sDNSCacheData) bool {
+		if !d.setNetwork(id, projectId, start, end, wireId, gateway) {
+			return false
+		}
+		d.rebuildNetworkIndex()
+		return true
+	})
+}
+
+func (c *sDNSCache) onNetworkDelete(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	c.apply(func(d *sDNSCacheData) bool {
+		delete(d.allNetworks, id)
+		d.rebuildNetworkIndex()
+		return true
+	})
+}
+
+func (c *sDNSCache) onRecordChange(obj *jsonutils.JSONDict) {
+	rec := &models.SDnsRecord{}
+	if err := obj.Unmarshal(rec); err != nil {
+		ylog.Errorf("unmarshal dns record %s: %v", obj, err)
+		c.requestResync()
+		return
+	}
+	c.apply(func(d *sDNSCacheData) bool {
+		d.setRecord(rec)
+		return true
+	})
+}
+
+func (c *sDNSCache) onRecordDelete(obj *jsonutils.JSONDict) {
+	id, _ := obj.GetString("id")
+	c.apply(func(d *sDNSCacheData) bool {
+		d.deleteRecord(id)
+		return true
+	})
+}
+
+func newCacheEventHandler(onChange, onDelete func(obj *jsonutils.JSONDict)) informer.EventHandler {
+	return informer.EventHandlerFuncs{
+		AddFunc: onChange,
+		UpdateFunc: func(oldObj, newObj *jsonutils.JSONDict) {
+			onChange(newObj)
+		},
+		DeleteFunc: onDelete,
+	}
+}
+
+// watch applies changes of resources published by region informer
+func (c *sDNSCache) watch(session *mcclient.ClientSession) {
+	handlers := []struct {
+		resMan  informer.IResourceManager
+		handler informer.EventHandler
+	}{
+		{&modules.Servers, newCacheEventHandler(c.onGuestChange, c.onGuestDelete)},
+		{&modules.Hosts, newCacheEventHandler(c.onHostChange, c.onHostDelete)},
+		{&modules.Networks, newCacheEventHandler(c.onNetworkChange, c.onNetworkDelete)},
+		{&modules.Servernetworks, newCacheEventHandler(c.onGuestNicChange, c.onGuestNicDelete)},
+		{&modules.Baremetalnetworks, newCacheEventHandler(c.onHostNetChange, c.onHostNetDelete)},
+		{&modules.DNSRecords, newCacheEventHandler(c.onRecordChange, c.onRecordDelete)},
+	}
+	informer.NewWatchManagerBySessionBg(session, func(watchMan *informer.SWatchManager) error {
+		for _, h := range handlers {
+			if err := watchMan.For(h.resMan).AddEventHandler(context.Background(), h.handler); err != nil {
+				return errors.Wrapf(err, "watch resource %s", h.resMan.GetKeyword())
+			}
+		}
+		return nil
+	})
+}
+
+func loadDNSCacheData() (*sDNSCacheData, error) {
+	data := newDNSCacheData()
+	loaders := []struct {
+		name string
+		load func(*sDNSCacheData) error
+	}{
+		{"hosts", loadHosts},
+		{"networks", loadNetworks},
+		{"guests", loadGuests},
+		{"guest nics", loadGuestNics},
+		{"dns records", loadRecords},
+	}
+	for _, loader := range loaders {
+		if err := loader.load(data); err != nil {
+			return nil, errors.Wrapf(err, "load %s", loader.name)
+		}
+	}
+	return data, nil
+}
+
+func loadHosts(data *sDNSCacheData) error {
+	hosts := models.HostManager.Query().SubQuery()
+	q := hosts.Query(hosts.Field("id"), hosts.Field("name"), hosts.Field("access_ip"))
+	rows, err := q.Rows()
+	if err != nil {
+		return errors.Wrap(err, "query hosts")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		var ip sql.NullString
+		if err := rows.Scan(&id, &name, &ip); err != nil {
+			return errors.Wrap(err, "scan hosts")
+		}
+		data.hosts[id] = &sHost{Name: name, AccessIp: ip.String}
+	}
+
+	// other addresses of hosts are used for reverse lookup
+	hostnets := models.HostnetworkManager.Query().SubQuery()
+	q = hostnets.Query(hostnets.Field("row_id"), hostnets.Field("baremetal_id"), hostnets.Field("ip_addr"))
+	rows2, err := q.Rows()
+	if err != nil {
+		return errors.Wrap(err, "query hostnetworks")
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var rowId int64
+		var hostId string
+		var ip sql.NullString
+		if err := rows2.Scan(&rowId, &hostId, &ip); err != nil {
+			return errors.Wrap(err, "scan hostnetworks")
+		}
+		data.hostNets[rowId] = &sHostNet{HostId: hostId, IpAddr: ip.String}
+	}
+	data.rebuildHostIndex()
+	return nil
+}
+
+func loadNetworks(data *sDNSCacheData) error {
+	wires := models.WireManager.Query().SubQuery()
+	rows, err := wires.Query(wires.Field("id"), wires.Field("vpc_id")).Rows()
+	if err != nil {
+		return errors.Wrap(err, "query wires")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var vpcId sql.NullString
+		if err := rows.Scan(&id, &vpcId); err != nil {
+			return errors.Wrap(err, "scan wires")
+		}
+		data.wireVpcs[id] = vpcId.String
+	}
+
+	networks := models.NetworkManager.Query().SubQuery()
+	q := networks.Query(
+		networks.Field("id"),
+		networks.Field("tenant_id"),
+		networks.Field("guest_ip_start"),
+		networks.Field("guest_ip_end"),
+		networks.Field("wire_id"),
+		networks.Field("guest_gateway"),
+	)
+	rows2, err := q.Rows()
+	if err != nil {
+		return errors.Wrap(err, "query networks")
+	}
+	defer rows2.Close()
+	for rows2.Next() {
+		var id, start, end string
+		var projectId, wireId, gateway sql.NullString
+		if err := rows2.Scan(&id, &projectId, &start, &end, &wireId, &gateway); err != nil {
+			return errors.Wrap(err, "scan networks")
+		}
+		data.setNetwork(id, projectId.String, start, end, wireId.String, gateway.String)
+	}
+	data.rebuildNetworkIndex()
+	return nil
+}
+
+func loadGuests(data *sDNSCacheData) error {
+	guests := models.GuestManager.Query().SubQuery()
+	q := guests.Query(
+		guests.Field("id"),
+		guests.Field("name"),
+		guests.Field("tenant_id"),
+	).Filter(sqlchemy.OR(sqlchemy.IsNull(guests.Field("pending_deleted")),
+		sqlchemy.IsFalse(guests.Field("pending_deleted"))))
+	rows, err := q.Rows()
+	if err != nil {
+		return errors.Wrap(err, "query guests")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, name string
+		var projectId sql.NullString
+		if err := rows.Scan(&id, &name, &projectId); err != nil {
+			return errors.Wrap(err, "scan guests")
+		}
+		data.guests[id] = &sGuest{Name: name, ProjectId: projectId.String}
+	}
+	return nil
+}
+
+func loadGuestNics(data *sDNSCacheData) error {
+	guestnics := models.GuestnetworkManager.Query().SubQuery()
+	q := guestnics.Query(
+		guestnics.Field("row_id"),
+		guestnics.Field("guest_id"),
+		guestnics.Field("network_id"),
+		guestnics.Field("ip_addr"),
+		guestnics.Field("ip6_addr"),
+	)
+	rows, err := q.Rows()
+	if err != nil {
+		return errors.Wrap(err, "query guestnetworks")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rowId int64
+		var guestId, networkId string
+		var ipAddr, ip6Addr sql.NullString
+		err := rows.Scan(&rowId, &guestId, &networkId, &ipAddr, &ip6Addr)
+		if err != nil {
+			return errors.Wrap(err, "scan guestnetworks")
+		}
+		// nics of pending deleted guests are skipped
+		data.setGuestNic(rowId, guestId, networkId, ipAddr.String, ip6Addr.String)
+	}
+	return nil
+}
+
+func loadRecords(data *sDNSCacheData) error {
+	q := models.DnsRecordManager.Query().IsTrue("enabled")
+	records := make([]models.SDnsRecord, 0)
+	err := db.FetchModelObjects(models.DnsRecordManager, q, &records)
+	if err != nil {
+		return errors.Wrap(err, "FetchModelObjects")
+	}
+	for i := range records {
+		data.setRecord(&records[i])
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"reflect"
+	"testing"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/util/netutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/compute/models"
+)
+
+func TestDNSCacheSplitHorizon(t *testing.T) {
+	data := newDNSCacheData()
+	data.addGuestNic(&sGuestNic{GuestName: "web", ProjectId: "p1", IpAddr: "192.168.0.10", Ip6Addr: "fd00::10", VpcId: "vpc1"})
+	data.addGuestNic(&sGuestNic{GuestName: "web", ProjectId: "p1", IpAddr: "10.168.1.10", VpcId: api.DEFAULT_VPC_ID})
+	data.addGuestNic(&sGuestNic{GuestName: "client", ProjectId: "p2", IpAddr: "192.168.0.20", VpcId: "vpc1"})
+	start, _ := netutils.NewIPV4Addr("10.168.2.1")
+	end, _ := netutils.NewIPV4Addr("10.168.2.254")
+	data.networks = append(data.networks, &sNetworkRange{Id: "net", ProjectId: "p3", VpcId: api.DEFAULT_VPC_ID, IpStart: start, IpEnd: end})
+
+	cases := []struct {
+		src  string
+		in   bool
+		want []string
+	}{
+		{"192.168.0.20", true, []string{"192.168.0.10", "fd00::10"}},
+		{"10.168.2.5", true, []string{"10.168.1.10"}},
+		{"8.8.8.8", false, []string{"192.168.0.10", "10.168.1.10", "fd00::10"}},
+	}
+	for _, c := range cases {
+		src := data.getSource(c.src)
+		if src.InCloud != c.in {
+			t.Errorf("%s: in cloud %v, want %v", c.src, src.InCloud, c.in)
+		}
+		got := data.getGuestIps("WEB", src)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.src, got, c.want)
+		}
+	}
+	if name := data.getNameByIp("fd00::10"); name != "web" {
+		t.Errorf("reverse lookup of ipv6 address got %q", name)
+	}
+}
+
+func TestDNSCacheRecordPrecedence(t *testing.T) {
+	data := newDNSCacheData()
+	public := &models.SDnsRecord{}
+	public.Name = "svc.example.com"
+	public.IsPublic = true
+	public.Records = "A:1.1.1.1"
+	private := &models.SDnsRecord{}
+	private.Name = "svc.example.com"
+	private.ProjectId = "p1"
+	private.Records = "A:10.0.0.1"
+	data.addRecord(public)
+	data.addRecord(private)
+
+	if rec := data.getRecord("p1", "SVC.example.com"); rec != private {
+		t.Errorf("record of project should take precedence")
+	}
+	if rec := data.getRecord("p2", "svc.example.com"); rec != public {
+		t.Errorf("public record expected for other projects")
+	}
+	if rec := data.getRecord("", "other.example.com"); rec != nil {
+		t.Errorf("unexpected record %#v", rec)
+	}
+}
+
+func TestDNSCacheApplyChanges(t *testing.T) {
+	c := newDNSCache(0)
+	c.data.wireVpcs["wire"] = api.DEFAULT_VPC_ID
+
+	c.onNetworkChange(jsonutils.Marshal(map[string]string{
+		"id": "net", "tenant_id": "p1", "wire_id": "wire",
+		"guest_ip_start": "10.0.0.1", "guest_ip_end": "10.0.0.254", "guest_gateway": "10.0.0.1",
+	}).(*jsonutils.JSONDict))
+	c.onGuestChange(jsonutils.Marshal(map[string]string{"id": "g1", "name": "web", "tenant_id": "p1"}).(*jsonutils.JSONDict))
+	nic := jsonutils.Marshal(map[string]interface{}{
+		"row_id": 1, "guest_id": "g1", "network_id": "net", "ip_addr": "10.0.0.10",
+	}).(*jsonutils.JSONDict)
+	c.onGuestNicChange(nic)
+	if got := c.getGuestIps("web", sSourceInfo{}); !reflect.DeepEqual(got, []string{"10.0.0.10"}) {
+		t.Fatalf("guest ips after add: %v", got)
+	}
+	if src := c.getSource("10.0.0.20"); src.NetworkId != "net" {
+		t.Errorf("source of network range: %#v", src)
+	}
+
+	c.onGuestChange(jsonutils.Marshal(map[string]string{"id": "g1", "name": "web2", "tenant_id": "p1"}).(*jsonutils.JSONDict))
+	if got := c.getGuestIps("web", sSourceInfo{}); len(got) > 0 {
+		t.Errorf("old name still resolves to %v", got)
+	}
+	if name := c.getNameByIp("10.0.0.10"); name != "web2" {
+		t.Errorf("reverse lookup after rename got %q", name)
+	}
+
+	c.onGuestNicDelete(nic)
+	if got := c.getGuestIps("web2", sSourceInfo{}); len(got) > 0 {
+		t.Errorf("deleted nic still resolves to %v", got)
+	}
+
+	c.onHostChange(jsonutils.Marshal(map[string]string{"id": "h1", "name": "host1", "access_ip": "10.1.0.2"}).(*jsonutils.JSONDict))
+	if got := c.getHostIps("HOST1"); !reflect.DeepEqual(got, []string{"10.1.0.2"}) {
+		t.Errorf("host ips: %v", got)
+	}
+	c.onHostDelete(jsonutils.Marshal(map[string]string{"id": "h1"}).(*jsonutils.JSONDict))
+	if got := c.getHostIps("host1"); len(got) > 0 {
+		t.Errorf("deleted host still resolves to %v", got)
+	}
+
+	rec := jsonutils.Marshal(map[string]interface{}{
+		"id": "r1", "name": "svc.example.com", "is_public": true, "enabled": true, "records": "A:1.1.1.1",
+	}).(*jsonutils.JSONDict)
+	c.onRecordChange(rec)
+	if c.getRecord("", "svc.example.com") == nil {
+		t.Errorf("enabled record not found")
+	}
+	rec.Set("enabled", jsonutils.JSONFalse)
+	c.onRecordChange(rec)
+	if c.getRecord("", "svc.example.com") != nil {
+		t.Errorf("disabled record still found")
+	}
+
+	select {
+	case <-c.resync:
+		t.Errorf("unexpected resync request")
+	default:
+	}
+	c.onGuestNicChange(jsonutils.Marshal(map[string]interface{}{
+		"row_id": 2, "guest_id": "unknown", "network_id": "net", "ip_addr": "10.0.0.11",
+	}).(*jsonutils.JSONDict))
+	select {
+	case <-c.resync:
+	default:
+		t.Errorf("nic of unknown guest should request a resync")
+	}
+}
@@ -18,9 +18,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coredns/coredns/plugin"
@@ -44,7 +44,6 @@ import (
 	_ "yunion.io/x/sqlchemy/backends"
 
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
-	"yunion.io/x/onecloud/pkg/compute/models"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 	"yunion.io/x/onecloud/pkg/util/k8s"
@@ -70,6 +69,7 @@ var (
 		dns.TypeSRV:   "SRV",
 		dns.TypeSOA:   "SOA",
 		dns.TypeNS:    "NS",
+		dns.TypeCAA:   "CAA",
 	}
 )
 
@@ -87,8 +87,13 @@ type SRegionDNS struct {
 	Region        string
 	K8sSkip       bool
 
+	CacheRefreshSeconds int
+
 	K8sManager            *k8s.SKubeClusterManager
 	primaryZoneLabelCount int
+
+	cache    *sDNSCache
+	authOnce sync.Once
 }
 
 func New() *SRegionDNS {
@@ -117,6 +122,16 @@ func (r *SRegionDNS) initDB(c *caddy.Controller) error {
 	return nil
 }
 
+func (r *SRegionDNS) initCache() {
+	r.cache = newDNSCache(r.CacheRefreshSeconds)
+	r.cache.start()
+}
+
+func (r *SRegionDNS) watchCache() {
+	r.initAuth()
+	r.cache.watch(r.getAdminSession(context.Background()))
+}
+
 func (r *SRegionDNS) initK8s() {
 	r.initAuth()
 	r.K8sManager = k8s.NewKubeClusterManager(r.Region, 30*time.Second)
@@ -128,8 +143,10 @@ func (r *SRegionDNS) getAdminSession(ctx context.Context) *mcclient.ClientSessio
 }
 
 func (r *SRegionDNS) initAuth() {
-	authInfo := auth.NewAuthInfo(r.AuthUrl, "", r.AdminUser, r.AdminPassword, r.AdminProject, "")
-	auth.Init(authInfo, false, true, "", "")
+	r.authOnce.Do(func() {
+		authInfo := auth.NewAuthInfo(r.AuthUrl, "", r.AdminUser, r.AdminPassword, r.AdminProject, "")
+		auth.Init(authInfo, false, true, "", "")
+	})
 }
 
 func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *dns.Msg) (int, error) {
@@ -146,7 +163,6 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 	case dns.TypeA:
 		records, err = plugin.A(r, zone, state, nil, opt)
 	case dns.TypeAAAA:
-		// TODO fallthrough to next
 		records, err = plugin.AAAA(r, zone, state, nil, opt)
 	case dns.TypeTXT:
 		records, err = plugin.TXT(r, zone, state, opt)
@@ -158,6 +174,8 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 		records, extra, err = plugin.MX(r, zone, state, opt)
 	case dns.TypeSRV:
 		records, extra, err = plugin.SRV(r, zone, state, opt)
+	case dns.TypeCAA:
+		records, err = r.CAA(state)
 	case dns.TypeSOA:
 		records, err = plugin.SOA(r, zone, state, opt)
 	case dns.TypeNS:
@@ -181,10 +199,16 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 		return plugin.BackendError(r, zone, dns.RcodeRefused, state, err, opt)
 	} else if err == errNotFound {
 		return plugin.BackendError(r, zone, dns.RcodeNameError, state, err, opt)
+	} else if err != nil {
+		return plugin.BackendError(r, zone, dns.RcodeServerFailure, state, err, opt)
 	}
 
 	if len(records) == 0 {
-		return plugin.BackendError(r, zone, dns.RcodeNameError, state, err, opt)
+		if !r.nameExists(state, zone) {
+			return plugin.BackendError(r, zone, dns.RcodeNameError, state, nil, opt)
+		}
+		// NODATA, the name exists but has no records of the type
+		return plugin.BackendError(r, zone, dns.RcodeSuccess, state, nil, opt)
 	}
 
 	m := new(dns.Msg)
@@ -199,6 +223,26 @@ func (r *SRegionDNS) ServeDNS(ctx context.Context, w dns.ResponseWriter, rmsg *d
 	return dns.RcodeSuccess, nil
 }
 
+// nameExists reports whether the name has records of any type, which tells
+// NODATA from NXDOMAIN when there is no record of the query type
+func (r *SRegionDNS) nameExists(state request.Request, zone string) bool {
+	name := state.Name()
+	if name == zone || isDefaultNS(name, zone) {
+		return true
+	}
+	req, err := r.parseRequest(state)
+	if err != nil {
+		return false
+	}
+	if r.cache.getRecord(req.ProjectId(), req.Name()) != nil {
+		return true
+	}
+	if (req.IsPlainName() && req.SrcInCloud()) || r.isMyDomain(req) {
+		return len(r.findInternalRecordIps(req)) > 0
+	}
+	return false
+}
+
 var (
 	errRefused  = errors.New("refused the query")
 	errNotFound = errors.New("not found")
@@ -212,14 +256,10 @@ func (r *SRegionDNS) Services(state request.Request, exact bool, opt plugin.Opti
 		t, _ := dnsutil.TrimZone(state.Name(), state.Zone)
 
 		segs := dns.SplitDomainName(t)
-		if len(segs) != 1 {
-			return nil, fmt.Errorf("yunion region: TXT query can onlyu be for dns-version: %s", state.QName())
+		if len(segs) == 1 && segs[0] == "dns-version" {
+			svc := msg.Service{Text: "0.0.1", TTL: 28800, Key: msg.Path(state.QName(), "coredns")}
+			return []msg.Service{svc}, nil
 		}
-		if segs[0] != "dns-version" {
-			return nil, nil
-		}
-		svc := msg.Service{Text: "0.0.1", TTL: 28800, Key: msg.Path(state.QName(), "coredns")}
-		return []msg.Service{svc}, nil
 	case dns.TypeNS:
 		ns := r.nsAddr()
 		svc := msg.Service{Host: ns.A.String(), Key: msg.Path(state.QName(), "coredns")}
@@ -250,30 +290,19 @@ func (r *SRegionDNS) IsNameError(err error) bool {
 
 // Records looks up records in region mysql
 func (r *SRegionDNS) Records(state request.Request, exact bool) ([]msg.Service, error) {
-	req, e := parseRequest(state)
+	req, e := r.parseRequest(state)
 	if e != nil {
 		return nil, e
 	}
 	return r.findRecords(req)
 }
 
-func (r *SRegionDNS) getHostIpWithName(req *recordRequest) string {
-	name := req.QueryName()
-	host, _ := models.HostManager.FetchByName(nil, name)
-	if host == nil {
-		return ""
-	}
-	ip := host.(*models.SHost).AccessIp
-	return ip
+func (r *SRegionDNS) getHostIpWithName(req *recordRequest) []string {
+	return r.cache.getHostIps(req.QueryName())
 }
 
 func (r *SRegionDNS) getGuestIpWithName(req *recordRequest) []string {
-	ips := []string{}
-	name := req.QueryName()
-	projectId := req.ProjectId()
-	wantOnlyExit := false
-	ips = models.GuestManager.GetIpInProjectWithName(projectId, name, wantOnlyExit)
-	return ips
+	return r.cache.getGuestIps(req.QueryName(), req.src)
 }
 
 func getK8sServiceBackends(cli *kubernetes.Clientset, req *recordRequest) ([]string, error) {
@@ -319,21 +348,23 @@ func (r *SRegionDNS) Name() string {
 	return PluginName
 }
 
-func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Service) {
+func getTtl(ttl int) uint32 {
+	if ttl == 0 {
+		return defaultTTL
+	}
+	return uint32(ttl)
+}
+
+// queryLocalDnsRecords looks up records in dnsrecords, exists is true if a
+// record of the name is found even if it has no value of the query type
+func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Service, exists bool) {
 	var (
-		projId = req.ProjectId()
-		name   = req.Name()
-		getTtl = func(ttl int) uint32 {
-			if ttl == 0 {
-				return defaultTTL
-			}
-			return uint32(ttl)
-		}
-		rec = models.DnsRecordManager.QueryDns(projId, name)
+		name = req.Name()
+		rec  = r.cache.getRecord(req.ProjectId(), name)
 	)
 
 	if rec == nil {
-		return
+		return nil, false
 	}
 	if req.state.QType() != dns.TypeCNAME && rec.IsCNAME() {
 		name = rec.GetCNAME()
@@ -343,7 +374,7 @@ func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Servic
 		})
 		// github.com/coredns/coredns/plugin.{A,AAAA} will call
 		// Services again later for these CNAME
-		return recs
+		return recs, true
 	}
 
 	var (
@@ -356,7 +387,8 @@ func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Servic
 			continue
 		}
 		val := recStr[prefLen:]
-		if req.IsSRV() {
+		switch qtype {
+		case DNSTypeMap[dns.TypeSRV]:
 			parts := strings.SplitN(val, ":", 4)
 			if len(parts) < 2 {
 				ylog.Errorf("Invalid SRV records: %q", val)
@@ -392,14 +424,80 @@ func (r *SRegionDNS) queryLocalDnsRecords(req *recordRequest) (recs []msg.Servic
 				Priority: priority,
 				TTL:      getTtl(rec.Ttl),
 			})
-		} else {
+		case DNSTypeMap[dns.TypeMX]:
+			parts := strings.SplitN(val, ":", 2)
+			preference := 10
+			if len(parts) >= 2 {
+				var err error
+				preference, err = strconv.Atoi(parts[1])
+				if err != nil {
+					ylog.Errorf("MX: invalid preference: %s", val)
+					continue
+				}
+			}
+			recs = append(recs, msg.Service{
+				Host:     parts[0],
+				Mail:     true,
+				Priority: preference,
+				TTL:      getTtl(rec.Ttl),
+			})
+		case DNSTypeMap[dns.TypeTXT]:
+			recs = append(recs, msg.Service{
+				Text: val,
+				TTL:  getTtl(rec.Ttl),
+			})
+		default:
 			recs = append(recs, msg.Service{
 				Host: val,
 				TTL:  getTtl(rec.Ttl),
 			})
 		}
 	}
-	return
+	return recs, true
+}
+
+// CAA answers CAA queries from dnsrecords, the plugin package has no helper
+// for it
+func (r *SRegionDNS) CAA(state request.Request) ([]dns.RR, error) {
+	req, err := r.parseRequest(state)
+	if err != nil {
+		return nil, err
+	}
+	rec := r.cache.getRecord(req.ProjectId(), req.Name())
+	if rec == nil {
+		if r.isMyDomain(req) {
+			return nil, errNotFound
+		}
+		return nil, errCallNext
+	}
+	records := make([]dns.RR, 0)
+	for _, recStr := range rec.GetInfo() {
+		if !strings.HasPrefix(recStr, "CAA:") {
+			continue
+		}
+		parts := strings.SplitN(recStr[len("CAA:"):], ":", 3)
+		if len(parts) < 3 {
+			ylog.Errorf("Invalid CAA records: %q", recStr)
+			continue
+		}
+		flag, err := strconv.Atoi(parts[0])
+		if err != nil {
+			ylog.Errorf("CAA: invalid flag: %s", recStr)
+			continue
+		}
+		records = append(records, &dns.CAA{
+			Hdr: dns.RR_Header{
+				Name:   state.QName(),
+				Rrtype: dns.TypeCAA,
+				Class:  dns.ClassINET,
+				Ttl:    getTtl(rec.Ttl),
+			},
+			Flag:  uint8(flag),
+			Tag:   parts[1],
+			Value: parts[2],
+		})
+	}
+	return records, nil
 }
 
 func (r *SRegionDNS) isMyDomain(req *recordRequest) bool {
@@ -417,19 +515,27 @@ func (r *SRegionDNS) isMyDomain(req *recordRequest) bool {
 
 func (r *SRegionDNS) findRecords(req *recordRequest) ([]msg.Service, error) {
 	// 1. try local dns records table
-	rrs := r.queryLocalDnsRecords(req)
+	rrs, exists := r.queryLocalDnsRecords(req)
 	if len(rrs) > 0 {
 		return rrs, nil
 	}
+	if exists && req.Type() != DNSTypeMap[dns.TypeA] && req.Type() != DNSTypeMap[dns.TypeAAAA] {
+		// name exists but no records of the type, names of hosts and
+		// guests only have addresses
+		return nil, nil
+	}
 
 	isPlainName := req.IsPlainName()
 	isMyDomain := r.isMyDomain(req)
+	isAddrQuery := req.Type() == DNSTypeMap[dns.TypeA] || req.Type() == DNSTypeMap[dns.TypeAAAA]
 	if isPlainName {
 		isCloudIp := req.SrcInCloud()
 		if isCloudIp {
 			ips := r.findInternalRecordIps(req)
-			if len(ips) > 0 {
+			if len(ips) > 0 && isAddrQuery {
 				return ips2DnsRecords(ips), nil
+			} else if len(ips) > 0 || exists {
+				return nil, nil
 			} else {
 				return nil, errNotFound
 			}
@@ -438,11 +544,15 @@ func (r *SRegionDNS) findRecords(req *recordRequest) ([]msg.Service, error) {
 		}
 	} else if isMyDomain {
 		ips := r.findInternalRecordIps(req)
-		if len(ips) > 0 {
+		if len(ips) > 0 && isAddrQuery {
 			return ips2DnsRecords(ips), nil
+		} else if len(ips) > 0 || exists {
+			return nil, nil
 		} else {
 			return nil, errNotFound
 		}
+	} else if exists {
+		return nil, nil
 	} else {
 		return nil, errCallNext
 	}
@@ -451,9 +561,9 @@ func (r *SRegionDNS) findRecords(req *recordRequest) ([]msg.Service, error) {
 func (r *SRegionDNS) findInternalRecordIps(req *recordRequest) []string {
 	{
 		// 1. try host table
-		ip := r.getHostIpWithName(req)
-		if len(ip) > 0 {
-			return []string{ip}
+		ips := r.getHostIpWithName(req)
+		if len(ips) > 0 {
+			return ips
 		}
 	}
 	{
@@ -0,0 +1,72 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coredns/coredns/plugin/pkg/dnstest"
+	"github.com/coredns/coredns/plugin/test"
+	"github.com/miekg/dns"
+
+	"yunion.io/x/onecloud/pkg/compute/models"
+)
+
+func TestServeDNSNoDataAndNameError(t *testing.T) {
+	r := New()
+	r.Zones = []string{"cloud.local."}
+	r.PrimaryZone = "cloud.local."
+	r.primaryZoneLabelCount = dns.CountLabel(r.PrimaryZone)
+	r.K8sSkip = true
+	r.cache = newDNSCache(0)
+	r.cache.data.addGuestNic(&sGuestNic{GuestName: "web", IpAddr: "192.168.0.10"})
+	rec := &models.SDnsRecord{}
+	rec.Name = "txt.cloud.local"
+	rec.IsPublic = true
+	rec.Records = "TXT:hello"
+	r.cache.data.addRecord(rec)
+
+	cases := []struct {
+		name    string
+		qtype   uint16
+		rcode   int
+		answers int
+	}{
+		{"web.cloud.local.", dns.TypeA, dns.RcodeSuccess, 1},
+		{"web.cloud.local.", dns.TypeMX, dns.RcodeSuccess, 0},
+		{"web.cloud.local.", dns.TypeTXT, dns.RcodeSuccess, 0},
+		{"txt.cloud.local.", dns.TypeTXT, dns.RcodeSuccess, 1},
+		{"txt.cloud.local.", dns.TypeA, dns.RcodeSuccess, 0},
+		{"none.cloud.local.", dns.TypeA, dns.RcodeNameError, 0},
+		{"none.cloud.local.", dns.TypeMX, dns.RcodeNameError, 0},
+		{"none.cloud.local.", dns.TypeCAA, dns.RcodeNameError, 0},
+	}
+	for _, c := range cases {
+		m := new(dns.Msg)
+		m.SetQuestion(c.name, c.qtype)
+		w := dnstest.NewRecorder(&test.ResponseWriter{})
+		// errors are returned along with the written responses
+		r.ServeDNS(context.Background(), w, m)
+		if w.Msg == nil {
+			t.Errorf("%s %s: no response", c.name, dns.TypeToString[c.qtype])
+			continue
+		}
+		if w.Msg.Rcode != c.rcode || len(w.Msg.Answer) != c.answers {
+			t.Errorf("%s %s: got rcode %s with %d answers, want %s with %d", c.name, dns.TypeToString[c.qtype],
+				dns.RcodeToString[w.Msg.Rcode], len(w.Msg.Answer), dns.RcodeToString[c.rcode], c.answers)
+		}
+	}
+}
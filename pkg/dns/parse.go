@@ -20,42 +20,24 @@ import (
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/request"
 	"github.com/miekg/dns"
-
-	"yunion.io/x/pkg/tristate"
-
-	"yunion.io/x/onecloud/pkg/compute/models"
 )
 
 type recordRequest struct {
-	state        request.Request
-	domainSegs   []string
-	srcProjectId string
-	srcInCloud   bool
-	network      *models.SNetwork
+	state      request.Request
+	domainSegs []string
+	src        sSourceInfo
 }
 
-func parseRequest(state request.Request) (r *recordRequest, err error) {
+func (r *SRegionDNS) parseRequest(state request.Request) (*recordRequest, error) {
 	base, _ := dnsutil.TrimZone(state.Name(), state.Zone)
 	segs := dns.SplitDomainName(base)
-	r = &recordRequest{
+	req := &recordRequest{
 		state:      state,
 		domainSegs: segs,
 	}
-	srcIP := r.SrcIP4()
-	// NOTE the check on networks_tbl is a hack, we should be more specific
-	// by querying only guest networks, host networks, and others like
-	// loadbalancer network the to come.
-	//
-	// Order matters here, we want to find the srcIP project as accurately
-	// as possible
-	if guest := models.GuestnetworkManager.GetGuestByAddress(srcIP); guest != nil {
-		r.srcProjectId = guest.ProjectId
-		r.srcInCloud = true
-	} else if network, _ := models.NetworkManager.GetOnPremiseNetworkOfIP(srcIP, "", tristate.None); network != nil {
-		r.srcProjectId = network.ProjectId
-		r.srcInCloud = true
-	}
-	return
+	// find project and vpc of the guest or network the query comes from
+	req.src = r.cache.getSource(req.SrcIP())
+	return req, nil
 }
 
 func (r recordRequest) Name() string {
@@ -86,17 +68,17 @@ func (r recordRequest) IsSRV() bool {
 	return r.Type() == DNSTypeMap[dns.TypeSRV]
 }
 
-func (r recordRequest) SrcIP4() string {
+func (r recordRequest) SrcIP() string {
 	ip := r.state.IP()
 	return ip
 }
 
 func (r recordRequest) ProjectId() string {
-	return r.srcProjectId
+	return r.src.ProjectId
 }
 
 func (r recordRequest) SrcInCloud() bool {
-	return r.srcInCloud
+	return r.src.InCloud
 }
 
 type K8sQueryInfo struct {
@@ -21,8 +21,6 @@ import (
 	"github.com/coredns/coredns/plugin/etcd/msg"
 	"github.com/coredns/coredns/plugin/pkg/dnsutil"
 	"github.com/coredns/coredns/request"
-
-	"yunion.io/x/onecloud/pkg/compute/models"
 )
 
 // Reverse implements the ServiceBackend interface
@@ -37,27 +35,23 @@ func (r *SRegionDNS) Reverse(state request.Request, exact bool, opt plugin.Optio
 }
 
 func (r *SRegionDNS) getNameForIp(ip string, state request.Request) ([]msg.Service, error) {
-	req, e := parseRequest(state)
+	req, e := r.parseRequest(state)
 	if e != nil {
 		return nil, e
 	}
 
 	// 1. try local dns records table
-	records := models.DnsRecordManager.QueryDnsIps(req.ProjectId(), req.Name(), req.Type())
-	for _, rec := range records {
-		return []msg.Service{{Host: rec.Addr, TTL: uint32(rec.Ttl)}}, nil
-	}
-
-	// 2. try hosts table
-	host := models.HostnetworkManager.GetHostByAddress(ip)
-	if host != nil {
-		return []msg.Service{{Host: r.joinDomain(host.Name), TTL: defaultTTL}}, nil
+	if rec := r.cache.getRecord(req.ProjectId(), req.Name()); rec != nil {
+		for _, recStr := range rec.GetInfo() {
+			if strings.HasPrefix(recStr, "PTR:") {
+				return []msg.Service{{Host: recStr[len("PTR:"):], TTL: getTtl(rec.Ttl)}}, nil
+			}
+		}
 	}
 
-	// 3. try guests table
-	guest := models.GuestnetworkManager.GetGuestByAddress(ip)
-	if guest != nil {
-		return []msg.Service{{Host: r.joinDomain(guest.Name), TTL: defaultTTL}}, nil
+	// 2. try hosts and guests
+	if name := r.cache.getNameByIp(ip); len(name) > 0 {
+		return []msg.Service{{Host: r.joinDomain(name), TTL: defaultTTL}}, nil
 	}
 	return nil, errNotFound
 }
@@ -16,6 +16,7 @@ package dns
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/coredns/coredns/core/dnsserver"
 	"github.com/coredns/coredns/plugin"
@@ -54,6 +55,11 @@ func setup(c *caddy.Controller) error {
 	if err != nil {
 		return plugin.Error(PluginName, err)
 	}
+	rDNS.initCache()
+	if len(rDNS.AuthUrl) > 0 {
+		// apply changes published by region informer to cache
+		go rDNS.watchCache()
+	}
 
 	if !rDNS.K8sSkip {
 		go rDNS.initK8s()
@@ -132,6 +138,15 @@ func parseConfig(c *caddy.Controller) (*SRegionDNS, error) {
 					rDNS.Upstream = u
 				case "k8s_skip":
 					rDNS.K8sSkip = true
+				case "cache_refresh_interval":
+					if !c.NextArg() {
+						return nil, c.ArgErr()
+					}
+					seconds, err := strconv.Atoi(c.Val())
+					if err != nil || seconds <= 0 {
+						return nil, c.Errf("invalid cache_refresh_interval %q", c.Val())
+					}
+					rDNS.CacheRefreshSeconds = seconds
 				default:
 					if c.Val() != "}" {
 						return nil, c.Errf("unknown property %q", c.Val())
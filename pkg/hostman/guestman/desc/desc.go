@@ -40,6 +40,8 @@ type SGuestHardwareDesc struct {
 	Vga       string
 	Vdi       string
 	BootOrder string
+	Vtpm      bool
+	NumaNodes []api.GuestNumaNode
 
 	Cdrom           *api.GuestcdromJsonDesc
 	Disks           []*api.GuestdiskJsonDesc
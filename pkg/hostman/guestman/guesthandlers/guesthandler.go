@@ -90,8 +90,17 @@ func AddGuestTaskHandler(prefix string, app *appsrv.Application) {
 			"live-change-disk":      guestLiveChangeDisk,
 			"cpuset":                guestCPUSet,
 			"cpuset-remove":         guestCPUSetRemove,
+			"vtpm-state":            guestVtpmState,
+			"vtpm-state-restore":    guestVtpmStateRestore,
 			"memory-snapshot":       guestMemorySnapshot,
 			"memory-snapshot-reset": guestMemorySnapshotReset,
+			"qga-ping":              guestQgaPing,
+			"qga-set-password":      guestQgaSetPassword,
+			"qga-fsfreeze":          guestQgaFsfreeze,
+			"qga-fsthaw":            guestQgaFsthaw,
+			"qga-exec":              guestQgaExec,
+			"qga-get-network":       guestQgaGetNetwork,
+			"qga-get-os-info":       guestQgaGetOsInfo,
 		} {
 			app.AddHandler("POST",
 				fmt.Sprintf("%s/%s/<sid>/%s", prefix, keyWord, action),
@@ -300,6 +309,7 @@ func guestSrcPrepareMigrate(ctx context.Context, userCred mcclient.TokenCredenti
 			Sid:               sid,
 			LiveMigrate:       liveMigrate,
 			LiveMigrateUseTLS: liveMigrateEnableTls,
+			UserCred:          userCred,
 		})
 	return nil, nil
 }
@@ -411,6 +421,7 @@ func guestDestPrepareMigrateInternal(ctx context.Context, userCred mcclient.Toke
 	params.MemorySnapshotsUri = msUri
 	msIds, _ := jsonutils.GetStringArray(body, "src_memory_snapshots")
 	params.SrcMemorySnapshots = msIds
+	params.VtpmState, _ = body.GetString("vtpm_state")
 
 	params.UserCred = userCred
 
@@ -579,6 +590,7 @@ func guestSnapshot(ctx context.Context, userCred mcclient.TokenCredential, sid s
 		Sid:        sid,
 		SnapshotId: snapshotId,
 		Disk:       disk,
+		FsFreeze:   jsonutils.QueryBoolean(body, "fsfreeze", false),
 	})
 	return nil, nil
 }
@@ -703,6 +715,21 @@ func guestCPUSetRemove(ctx context.Context, userCred mcclient.TokenCredential, s
 	return nil, nil
 }
 
+func guestVtpmState(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	return guestman.GetGuestManager().GetVtpmState(ctx, userCred, sid)
+}
+
+func guestVtpmStateRestore(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input := new(hostapi.GuestVtpmStateRestoreRequest)
+	if err := body.Unmarshal(input); err != nil {
+		return nil, err
+	}
+	if err := guestman.GetGuestManager().RestoreVtpmState(ctx, userCred, sid, input); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
 func guestMemorySnapshot(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
 	input := new(hostapi.GuestMemorySnapshotRequest)
 	if err := body.Unmarshal(input); err != nil {
@@ -755,3 +782,56 @@ func guestMemorySnapshotDelete(ctx context.Context, w http.ResponseWriter, r *ht
 		GuestMemorySnapshotDeleteRequest: input,
 	})
 }
+
+func guestQgaPing(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input := new(hostapi.GuestQgaPingRequest)
+	if err := body.Unmarshal(input); err != nil {
+		return nil, httperrors.NewInputParameterError("unmarshal input: %s", err)
+	}
+	return nil, guestman.GetGuestManager().QgaGuestPing(ctx, sid, input)
+}
+
+func guestQgaSetPassword(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input := new(hostapi.GuestQgaSetPasswordRequest)
+	if err := body.Unmarshal(input); err != nil {
+		return nil, httperrors.NewInputParameterError("unmarshal input: %s", err)
+	}
+	if input.Username == "" {
+		return nil, httperrors.NewMissingParameterError("username")
+	}
+	if input.Password == "" {
+		return nil, httperrors.NewMissingParameterError("password")
+	}
+	return nil, guestman.GetGuestManager().QgaSetUserPassword(ctx, sid, input)
+}
+
+func guestQgaFsfreeze(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	return guestman.GetGuestManager().QgaFsfreeze(ctx, sid)
+}
+
+func guestQgaFsthaw(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	return guestman.GetGuestManager().QgaFsthaw(ctx, sid)
+}
+
+func guestQgaExec(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	input := new(hostapi.GuestQgaExecRequest)
+	if err := body.Unmarshal(input); err != nil {
+		return nil, httperrors.NewInputParameterError("unmarshal input: %s", err)
+	}
+	if input.Path == "" {
+		return nil, httperrors.NewMissingParameterError("path")
+	}
+	return guestman.GetGuestManager().QgaExec(ctx, sid, input)
+}
+
+func guestQgaGetNetwork(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	ifaces, err := guestman.GetGuestManager().QgaGetNetworkInterfaces(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"interfaces": ifaces}, nil
+}
+
+func guestQgaGetOsInfo(ctx context.Context, userCred mcclient.TokenCredential, sid string, body jsonutils.JSONObject) (interface{}, error) {
+	return guestman.GetGuestManager().QgaGetOsInfo(ctx, sid)
+}
@@ -41,6 +41,8 @@ type SSrcPrepareMigrate struct {
 	Sid               string
 	LiveMigrate       bool
 	LiveMigrateUseTLS bool
+
+	UserCred mcclient.TokenCredential
 }
 
 type SDestPrepareMigrate struct {
@@ -64,6 +66,8 @@ type SDestPrepareMigrate struct {
 	MemorySnapshotsUri string
 	SrcMemorySnapshots []string
 
+	VtpmState string
+
 	UserCred mcclient.TokenCredential
 }
 
@@ -97,6 +101,8 @@ type SDiskSnapshot struct {
 	Sid        string
 	SnapshotId string
 	Disk       storageman.IDisk
+	// freeze guest filesystems through qga while taking snapshot
+	FsFreeze bool
 }
 
 type SMemorySnapshot struct {
@@ -114,10 +120,8 @@ type SMemorySnapshotDelete struct {
 }
 
 type SDiskBackup struct {
-	Sid        string
-	SnapshotId string
-	BackupId   string
-	Disk       storageman.IDisk
+	*storageman.SDiskBakcup
+	Disk storageman.IDisk
 }
 
 type SDeleteDiskSnapshot struct {
@@ -281,6 +281,26 @@ func (m *SGuestManager) CPUSetRemove(ctx context.Context, sid string) error {
 	return guest.CPUSetRemove(ctx)
 }
 
+func (m *SGuestManager) GetVtpmState(ctx context.Context, userCred mcclient.TokenCredential, sid string) (*hostapi.GuestVtpmStateResponse, error) {
+	guest, ok := m.GetServer(sid)
+	if !ok {
+		return nil, httperrors.NewNotFoundError("Not found")
+	}
+	state, err := guest.GetVtpmState(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetVtpmState")
+	}
+	return &hostapi.GuestVtpmStateResponse{VtpmState: state}, nil
+}
+
+func (m *SGuestManager) RestoreVtpmState(ctx context.Context, userCred mcclient.TokenCredential, sid string, req *hostapi.GuestVtpmStateRestoreRequest) error {
+	guest, ok := m.GetServer(sid)
+	if !ok {
+		return httperrors.NewNotFoundError("Not found")
+	}
+	return guest.RestoreVtpmState(ctx, userCred, req.VtpmState)
+}
+
 func (m *SGuestManager) IsGuestDir(f os.FileInfo) bool {
 	if !regutils.MatchUUID(f.Name()) {
 		return false
@@ -631,6 +651,12 @@ func (m *SGuestManager) startDeploy(
 	enableCloudInit := jsonutils.QueryBoolean(deployParams.Body, "enable_cloud_init", false)
 	loginAccount, _ := deployParams.Body.GetString("login_account")
 
+	if vtpmState, _ := deployParams.Body.GetString("vtpm_state"); len(vtpmState) > 0 {
+		if err := guest.RestoreVtpmState(ctx, deployParams.UserCred, vtpmState); err != nil {
+			return nil, errors.Wrap(err, "RestoreVtpmState")
+		}
+	}
+
 	guestInfo, err := guest.DeployFs(ctx, deployParams.UserCred,
 		deployapi.NewDeployInfo(
 			publicKey, deployapi.JsonDeploysToStructs(deploys), password, deployParams.IsInit, false,
@@ -844,6 +870,15 @@ func (m *SGuestManager) SrcPrepareMigrate(ctx context.Context, params interface{
 		}
 		ret.Set("migrate_certs", jsonutils.Marshal(certs))
 	}
+	if guest.isVtpmEnabled() {
+		state, err := guest.GetVtpmState(ctx, migParams.UserCred)
+		if err != nil {
+			return nil, errors.Wrap(err, "GetVtpmState")
+		}
+		if len(state) > 0 {
+			ret.Set("vtpm_state", jsonutils.NewString(state))
+		}
+	}
 	return ret, nil
 }
 
@@ -857,6 +892,11 @@ func (m *SGuestManager) DestPrepareMigrate(ctx context.Context, params interface
 	if err := guest.CreateFromDesc(migParams.Desc); err != nil {
 		return nil, err
 	}
+	if len(migParams.VtpmState) > 0 {
+		if err := guest.RestoreVtpmState(ctx, migParams.UserCred, migParams.VtpmState); err != nil {
+			return nil, errors.Wrap(err, "RestoreVtpmState")
+		}
+	}
 
 	disks := migParams.Desc.Disks
 	if len(migParams.TargetStorageIds) > 0 {
@@ -1024,7 +1064,19 @@ func (m *SGuestManager) DoSnapshot(ctx context.Context, params interface{}) (jso
 		return nil, hostutils.ParamsError
 	}
 	guest, _ := m.GetServer(snapshotParams.Sid)
-	return guest.ExecDiskSnapshotTask(ctx, snapshotParams.UserCred, snapshotParams.Disk, snapshotParams.SnapshotId)
+	return guest.ExecDiskSnapshotTask(ctx, snapshotParams.UserCred, snapshotParams.Disk, snapshotParams.SnapshotId, snapshotParams.FsFreeze)
+}
+
+func (m *SGuestManager) DoDiskBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
+	backupParams, ok := params.(*SDiskBackup)
+	if !ok {
+		return nil, hostutils.ParamsError
+	}
+	guest, ok := m.GetServer(backupParams.ServerId)
+	if !ok {
+		return nil, httperrors.NewNotFoundError("guest %s not found", backupParams.ServerId)
+	}
+	return guest.ExecDiskBackupTask(ctx, backupParams)
 }
 
 func (m *SGuestManager) DeleteSnapshot(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
@@ -1282,14 +1282,17 @@ type SGuestDiskSnapshotTask struct {
 	*SGuestReloadDiskTask
 
 	snapshotId string
+	fsFreeze   bool
+	frozen     bool
 }
 
 func NewGuestDiskSnapshotTask(
-	ctx context.Context, s *SKVMGuestInstance, disk storageman.IDisk, snapshotId string,
+	ctx context.Context, s *SKVMGuestInstance, disk storageman.IDisk, snapshotId string, fsFreeze bool,
 ) *SGuestDiskSnapshotTask {
 	return &SGuestDiskSnapshotTask{
 		SGuestReloadDiskTask: NewGuestReloadDiskTask(ctx, s, disk),
 		snapshotId:           snapshotId,
+		fsFreeze:             fsFreeze,
 	}
 }
 
@@ -1298,9 +1301,29 @@ func (s *SGuestDiskSnapshotTask) Start() {
 }
 
 func (s *SGuestDiskSnapshotTask) startSnapshot(device string) {
+	if s.fsFreeze {
+		// best effort, fall back to crash consistent snapshot if qga unavailable
+		if count, err := s.QgaFsfreeze(); err != nil {
+			log.Warningf("guest %s fsfreeze failed, take crash consistent snapshot: %s", s.GetName(), err)
+		} else {
+			log.Infof("guest %s frozen %d filesystems before snapshot", s.GetName(), count)
+			s.frozen = true
+		}
+	}
 	s.doReloadDisk(device, s.onReloadBlkdevSucc)
 }
 
+func (s *SGuestDiskSnapshotTask) fsThaw() {
+	if !s.frozen {
+		return
+	}
+	if _, err := s.QgaFsthaw(); err != nil {
+		log.Errorf("guest %s fsthaw failed: %s", s.GetName(), err)
+		return
+	}
+	s.frozen = false
+}
+
 func (s *SGuestDiskSnapshotTask) onReloadBlkdevSucc(res string) {
 	var cb = s.onResumeSucc
 	if len(res) > 0 {
@@ -1312,6 +1335,7 @@ func (s *SGuestDiskSnapshotTask) onReloadBlkdevSucc(res string) {
 }
 
 func (s *SGuestDiskSnapshotTask) onSnapshotBlkdevFail(reason string) {
+	s.fsThaw()
 	snapshotDir := s.disk.GetSnapshotDir()
 	snapshotPath := path.Join(snapshotDir, s.snapshotId)
 	output, err := procutils.NewCommand("mv", "-f", snapshotPath, s.disk.GetPath()).Output()
@@ -1323,12 +1347,165 @@ func (s *SGuestDiskSnapshotTask) onSnapshotBlkdevFail(reason string) {
 
 func (s *SGuestDiskSnapshotTask) onResumeSucc(res string) {
 	log.Infof("guest disk snapshot task resume succ %s", res)
+	s.fsThaw()
 	snapshotLocation := path.Join(s.disk.GetSnapshotLocation(), s.snapshotId)
 	body := jsonutils.NewDict()
 	body.Set("location", jsonutils.NewString(snapshotLocation))
 	hostutils.TaskComplete(s.ctx, body)
 }
 
+/**
+ *  GuestDiskBackupTask
+**/
+
+const diskBackupBitmapPrefix = "backup-"
+
+// SGuestDiskBackupTask backups disk of running guest by drive-backup. Every
+// backup adds a persistent dirty bitmap named by its backup id, the bitmap of
+// the parent backup is used to copy only the changed clusters. A full backup
+// is made if the bitmap of the parent is missing, e.g. the guest was restarted
+// by a qemu without the bitmap or the disk was reloaded by snapshot.
+type SGuestDiskBackupTask struct {
+	*SGuestReloadDiskTask
+
+	params *SDiskBackup
+
+	device       string
+	bitmap       string
+	staleBitmaps []string
+	backupPath   string
+}
+
+func NewGuestDiskBackupTask(ctx context.Context, s *SKVMGuestInstance, params *SDiskBackup) *SGuestDiskBackupTask {
+	return &SGuestDiskBackupTask{
+		SGuestReloadDiskTask: NewGuestReloadDiskTask(ctx, s, params.Disk),
+		params:               params,
+	}
+}
+
+func (s *SGuestDiskBackupTask) Start() {
+	s.Monitor.GetBlocks(s.onGetBlocks)
+}
+
+func (s *SGuestDiskBackupTask) newBitmap() string {
+	return diskBackupBitmapPrefix + s.params.BackupId
+}
+
+func (s *SGuestDiskBackupTask) onGetBlocks(blocks []monitor.QemuBlock) {
+	var block *monitor.QemuBlock
+	for i := range blocks {
+		if len(s.getDiskOfDrive(blocks[i])) > 0 {
+			block = &blocks[i]
+			break
+		}
+	}
+	if block == nil {
+		s.taskFailed("Device not found")
+		return
+	}
+	s.device = block.Device
+	if len(s.params.ParentId) > 0 {
+		parentBitmap := diskBackupBitmapPrefix + s.params.ParentId
+		if block.GetDirtyBitmap(parentBitmap) != nil {
+			s.bitmap = parentBitmap
+		} else {
+			log.Warningf("guest %s dirty bitmap %s of %s not found, take full backup", s.GetName(), parentBitmap, s.device)
+		}
+	}
+	for _, bitmaps := range [][]monitor.QemuDirtyBitmap{block.Inserted.DirtyBitmaps, block.DirtyBitmaps} {
+		for _, bitmap := range bitmaps {
+			if strings.HasPrefix(bitmap.Name, diskBackupBitmapPrefix) && !utils.IsInStringArray(bitmap.Name, s.staleBitmaps) {
+				s.staleBitmaps = append(s.staleBitmaps, bitmap.Name)
+			}
+		}
+	}
+
+	backupDir := s.disk.GetBackupDir()
+	if !fileutils2.Exists(backupDir) {
+		output, err := procutils.NewCommand("mkdir", "-p", backupDir).Output()
+		if err != nil {
+			s.taskFailed(fmt.Sprintf("mkdir %s failed: %s %s", backupDir, err, output))
+			return
+		}
+	}
+	s.backupPath = path.Join(backupDir, s.params.BackupId)
+	img, err := qemuimg.NewQemuImage(s.backupPath)
+	if err != nil {
+		s.taskFailed(fmt.Sprintf("NewQemuImage %s: %s", s.backupPath, err))
+		return
+	}
+	sizeMb := int(block.Inserted.Image.VirtualSize / 1024 / 1024)
+	if err := img.CreateQcow2(sizeMb, false, "", "", "", ""); err != nil {
+		s.taskFailed(fmt.Sprintf("create backup image %s: %s", s.backupPath, err))
+		return
+	}
+	s.backupJobs.Store(s.device, s.onBackupJobFinished)
+	s.Monitor.DriveBackup(s.device, s.backupPath, "qcow2", s.bitmap, s.newBitmap(), s.onDriveBackup)
+}
+
+func (s *SGuestDiskBackupTask) onDriveBackup(res string) {
+	if len(res) > 0 {
+		s.backupJobs.Delete(s.device)
+		s.removeBackupImage()
+		s.taskFailed(fmt.Sprintf("drive backup: %s", res))
+	}
+}
+
+func (s *SGuestDiskBackupTask) removeBackupImage() {
+	if output, err := procutils.NewCommand("rm", "-f", s.backupPath).Output(); err != nil {
+		log.Errorf("rm %s failed: %s %s", s.backupPath, err, output)
+	}
+}
+
+func (s *SGuestDiskBackupTask) removeBitmaps(bitmaps ...string) {
+	for _, bitmap := range bitmaps {
+		name := bitmap
+		s.Monitor.BlockDirtyBitmapRemove(s.device, name, func(res string) {
+			if len(res) > 0 {
+				log.Errorf("guest %s remove dirty bitmap %s of %s: %s", s.GetName(), name, s.device, res)
+			}
+		})
+	}
+}
+
+func (s *SGuestDiskBackupTask) onBackupJobFinished(reason string) {
+	if len(reason) > 0 {
+		s.removeBitmaps(s.newBitmap())
+		s.removeBackupImage()
+		s.taskFailed(fmt.Sprintf("backup job failed: %s", reason))
+		return
+	}
+	img, err := qemuimg.NewQemuImage(s.backupPath)
+	if err != nil {
+		s.removeBitmaps(s.newBitmap())
+		s.taskFailed(fmt.Sprintf("NewQemuImage %s: %s", s.backupPath, err))
+		return
+	}
+	sizeMb := img.GetActualSizeMB()
+	_, err = s.disk.GetStorage().StorageBackup(s.ctx, &storageman.SStorageBackup{
+		BackupId:                s.params.BackupId,
+		BackupStorageId:         s.params.BackupStorageId,
+		BackupStorageAccessInfo: s.params.BackupStorageAccessInfo,
+	})
+	if err != nil {
+		s.removeBitmaps(s.newBitmap())
+		s.removeBackupImage()
+		s.taskFailed(fmt.Sprintf("StorageBackup: %s", err))
+		return
+	}
+	// changes since the parent backup are tracked by the new bitmap from now on
+	s.removeBitmaps(s.staleBitmaps...)
+
+	backupMode := api.BACKUP_MODE_FULL
+	if len(s.bitmap) > 0 {
+		backupMode = api.BACKUP_MODE_INCREMENTAL
+	}
+	data := jsonutils.NewDict()
+	data.Set("size_mb", jsonutils.NewInt(int64(sizeMb)))
+	data.Set("backup_mode", jsonutils.NewString(backupMode))
+	hostutils.TaskComplete(s.ctx, data)
+}
+
 /**
  *  GuestSnapshotDeleteTask
 **/
@@ -0,0 +1,59 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/hostman/hostutils/hardware"
+	"yunion.io/x/onecloud/pkg/util/cgrouputils"
+	"yunion.io/x/onecloud/pkg/util/cgrouputils/cpuset"
+)
+
+func (s *SKVMGuestInstance) isNumaEnabled() bool {
+	return s.Desc != nil && len(s.Desc.NumaNodes) > 0
+}
+
+// getNumaCpuset returns host cpus and memory nodes of the NUMA nodes bound
+// by guest, cpus not allowed by the parent cgroup, e.g. reserved cpus, are excluded
+func (s *SKVMGuestInstance) getNumaCpuset(task *cgrouputils.CGroupCPUSetTask) (cpuset.CPUSet, string, error) {
+	builder := cpuset.NewBuilder()
+	mems := []string{}
+	for _, node := range s.Desc.NumaNodes {
+		cpus, err := hardware.GetNumaNodeCpus(node.HostNodeId)
+		if err != nil {
+			return cpuset.NewCPUSet(), "", err
+		}
+		builder.Add(cpus.ToSlice()...)
+		mems = append(mems, strconv.Itoa(node.HostNodeId))
+	}
+	nodeCpus := builder.Result()
+
+	parentCpus := cgrouputils.GetRootParam(task.Module(), cgrouputils.CPUSET_CPUS, filepath.Dir(task.GroupName()))
+	if len(parentCpus) > 0 {
+		allowed, err := cpuset.Parse(parentCpus)
+		if err != nil {
+			return cpuset.NewCPUSet(), "", errors.Wrapf(err, "parse parent cpuset %s", parentCpus)
+		}
+		if cpus := nodeCpus.Intersection(allowed); !cpus.IsEmpty() {
+			nodeCpus = cpus
+		}
+	}
+	return nodeCpus, strings.Join(mems, ","), nil
+}
@@ -24,6 +24,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"yunion.io/x/jsonutils"
@@ -91,6 +92,9 @@ type SKVMInstanceRuntime struct {
 	NeedSyncStreamDisks bool
 	blockJobTigger      map[string]chan struct{}
 
+	// callbacks of running backup jobs, keyed by job id
+	backupJobs sync.Map
+
 	StartupTask *SGuestResumeTask
 	MigrateTask *SGuestLiveMigrateTask
 }
@@ -102,6 +106,9 @@ type SKVMGuestInstance struct {
 	Desc    *desc.SGuestDesc
 	Monitor monitor.Monitor
 	manager *SGuestManager
+
+	guestAgent     *monitor.QemuGuestAgent
+	guestAgentLock sync.Mutex
 }
 
 func NewKVMGuestInstance(id string, manager *SGuestManager) *SKVMGuestInstance {
@@ -649,9 +656,13 @@ func (s *SKVMGuestInstance) onReceiveQMPEvent(event *monitor.Event) {
 	case event.Event == `"BLOCK_JOB_READY"`:
 		s.eventBlockJobReady(event)
 	case event.Event == `"BLOCK_JOB_ERROR"`:
-		s.SyncMirrorJobFailed("BLOCK_JOB_ERROR")
+		if !s.isBackupJobEvent(event) {
+			s.SyncMirrorJobFailed("BLOCK_JOB_ERROR")
+		}
 	case event.Event == `"BLOCK_JOB_COMPLETED"`:
 		s.eventBlockJobCompleted(event)
+	case event.Event == `"BLOCK_JOB_CANCELLED"`:
+		s.eventBackupJobFinished(event, "block job cancelled")
 	case event.Event == `"GUEST_PANICKED"`:
 		s.eventGuestPaniced(event)
 	case event.Event == `"STOP"`:
@@ -669,8 +680,13 @@ func (s *SKVMGuestInstance) eventBlockJobCompleted(event *monitor.Event) {
 		log.Errorf("BLOCK_JOB_COMPLETED missing event type")
 		return
 	}
-	// only dealwith event type mirror
+	// only dealwith event type mirror and backup
 	stype, _ := itype.(string)
+	if stype == "backup" {
+		reason, _ := event.Data["error"].(string)
+		s.eventBackupJobFinished(event, reason)
+		return
+	}
 	if stype != "mirror" {
 		return
 	}
@@ -696,6 +712,19 @@ func (s *SKVMGuestInstance) eventBlockJobCompleted(event *monitor.Event) {
 	}
 }
 
+func (s *SKVMGuestInstance) isBackupJobEvent(event *monitor.Event) bool {
+	jobId, _ := event.Data["device"].(string)
+	_, ok := s.backupJobs.Load(jobId)
+	return ok
+}
+
+func (s *SKVMGuestInstance) eventBackupJobFinished(event *monitor.Event, reason string) {
+	jobId, _ := event.Data["device"].(string)
+	if cb, ok := s.backupJobs.LoadAndDelete(jobId); ok {
+		cb.(func(string))(reason)
+	}
+}
+
 func (s *SKVMGuestInstance) eventGuestPaniced(event *monitor.Event) {
 	// qemu runc state event source qemu/src/qapi/run-state.json
 	params := jsonutils.NewDict()
@@ -1229,6 +1258,7 @@ func (s *SKVMGuestInstance) ExitCleanup(clear bool) {
 		s.Monitor.Disconnect()
 		s.Monitor = nil
 	}
+	s.closeGuestAgent()
 }
 
 func (s *SKVMGuestInstance) CleanupCpuset() {
@@ -1972,8 +2002,17 @@ func (s *SKVMGuestInstance) ExecReloadDiskTask(ctx context.Context, disk storage
 	}
 }
 
+func (s *SKVMGuestInstance) ExecDiskBackupTask(ctx context.Context, params *SDiskBackup) (jsonutils.JSONObject, error) {
+	if !s.IsRunning() {
+		return nil, errors.Errorf("guest %s is not running, can't backup disk by dirty bitmap", s.GetName())
+	}
+	task := NewGuestDiskBackupTask(ctx, s, params)
+	task.Start()
+	return nil, nil
+}
+
 func (s *SKVMGuestInstance) ExecDiskSnapshotTask(
-	ctx context.Context, userCred mcclient.TokenCredential, disk storageman.IDisk, snapshotId string,
+	ctx context.Context, userCred mcclient.TokenCredential, disk storageman.IDisk, snapshotId string, fsFreeze bool,
 ) (jsonutils.JSONObject, error) {
 	var (
 		encryptKey = ""
@@ -1997,7 +2036,7 @@ func (s *SKVMGuestInstance) ExecDiskSnapshotTask(
 		if err != nil {
 			return nil, errors.Wrap(err, "disk.CreateSnapshot")
 		}
-		task := NewGuestDiskSnapshotTask(ctx, s, disk, snapshotId)
+		task := NewGuestDiskSnapshotTask(ctx, s, disk, snapshotId, fsFreeze)
 		task.Start()
 		return nil, nil
 	} else {
@@ -2215,6 +2254,27 @@ func (s *SKVMGuestInstance) CPUSet(ctx context.Context, input *api.ServerCPUSetI
 		return nil, nil
 	}
 
+	task := cgrouputils.NewCGroupCPUSetTask(
+		strconv.Itoa(s.GetPid()), s.GetCgroupName(), 0, "",
+	)
+	var numaMems string
+	if s.isNumaEnabled() {
+		// vcpus and memory of guest with NUMA topology are kept on the bound host nodes
+		numaCpus, mems, err := s.getNumaCpuset(&task)
+		if err != nil {
+			return nil, errors.Wrap(err, "get NUMA cpuset")
+		}
+		numaMems = mems
+		if input == nil {
+			input = &api.ServerCPUSetInput{CPUS: numaCpus.ToSlice()}
+		}
+		for _, id := range input.CPUS {
+			if !numaCpus.Contains(id) {
+				return nil, httperrors.NewInputParameterError("cpu %d is out of bound NUMA nodes %s of guest, available cpus: %s", id, mems, numaCpus.String())
+			}
+		}
+	}
+
 	var cpusetStr string
 	if input != nil {
 		cpus := []string{}
@@ -2224,12 +2284,15 @@ func (s *SKVMGuestInstance) CPUSet(ctx context.Context, input *api.ServerCPUSetI
 		cpusetStr = strings.Join(cpus, ",")
 	}
 
-	task := cgrouputils.NewCGroupCPUSetTask(
+	task = cgrouputils.NewCGroupCPUSetTask(
 		strconv.Itoa(s.GetPid()), s.GetCgroupName(), 0, cpusetStr,
 	)
 	if !task.SetTask() {
 		return nil, errors.Errorf("Cgroup cpuset task failed")
 	}
+	if len(numaMems) > 0 && !task.CustomConfig(cgrouputils.CPUSET_MEMS, numaMems) {
+		return nil, errors.Errorf("Cgroup cpuset set mems %s failed", numaMems)
+	}
 	return new(api.ServerCPUSetResp), nil
 }
 
@@ -2241,6 +2304,11 @@ func (s *SKVMGuestInstance) CPUSetRemove(ctx context.Context) error {
 	if !s.IsRunning() {
 		return nil
 	}
+	if s.isNumaEnabled() {
+		// fallback to cpus of bound NUMA nodes
+		_, err := s.CPUSet(ctx, nil)
+		return err
+	}
 	task := cgrouputils.NewCGroupCPUSetTask(
 		strconv.Itoa(s.GetPid()), s.GetCgroupName(), 0, "",
 	)
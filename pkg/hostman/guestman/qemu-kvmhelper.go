@@ -230,6 +230,7 @@ func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (strin
 		EnableMemfd:          s.isMemcleanEnabled(),
 		PidFilePath:          s.GetPidFilePath(),
 		BIOS:                 s.getBios(),
+		NumaNodes:            s.Desc.NumaNodes,
 	}
 
 	if data.Contains("encrypt_key") {
@@ -299,6 +300,11 @@ func (s *SKVMGuestInstance) generateStartScript(data *jsonutils.JSONDict) (strin
 	}
 	cmd += diskScripts
 
+	if s.isVtpmEnabled() {
+		cmd += s.generateVtpmStartScript()
+		input.VtpmSocketPath = s.getVtpmSocketPath()
+	}
+
 	cmd += fmt.Sprintf("STATE_FILE=`ls -d %s* | head -n 1`\n", s.getStateFilePathRootPrefix())
 	cmd += fmt.Sprintf("PID_FILE=%s\n", input.PidFilePath)
 
@@ -552,6 +558,12 @@ func (s *SKVMGuestInstance) parseCmdline(input string) (*qemutils.Cmdline, []qem
 				filterOpts = append(filterOpts, o)
 				return true
 			}
+		case "object":
+			// memory backends bound to host NUMA nodes differ between hosts
+			if strings.Contains(o.Value, "host-nodes=") {
+				filterOpts = append(filterOpts, o)
+				return true
+			}
 		case "vnc":
 			filterOpts = append(filterOpts, o)
 			return true
@@ -647,6 +659,8 @@ func (s *SKVMGuestInstance) generateStopScript(data *jsonutils.JSONDict) string
 	cmd += fmt.Sprintf("  fi\n")
 	cmd += fmt.Sprintf("done\n")
 
+	cmd += s.generateVtpmStopScript()
+
 	for _, nic := range nics {
 		downscript := s.getNicDownScriptPath(nic)
 		cmd += fmt.Sprintf("%s %s\n", downscript, nic.Ifname)
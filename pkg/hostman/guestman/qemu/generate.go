@@ -78,6 +78,8 @@ type GenerateStartOptionsInput struct {
 	IsSlave               bool
 	IsMaster              bool
 	EnablePvpanic         bool
+	VtpmSocketPath        string
+	NumaNodes             []api.GuestNumaNode
 
 	EncryptKeyPath string
 }
@@ -114,6 +116,11 @@ func GenerateStartOptions(
 		opts = append(opts, getMonitorOptions(drvOpt, input.QMPMonitor)...)
 	}
 
+	smpOpt := drvOpt.SMP(input.Cpu)
+	if len(input.NumaNodes) > 0 {
+		smpOpt = drvOpt.NumaSMP(input.Cpu, uint(len(input.NumaNodes)))
+	}
+
 	opts = append(opts,
 		drvOpt.RTC(),
 		drvOpt.Daemonize(),
@@ -123,14 +130,22 @@ func GenerateStartOptions(
 		drvOpt.Global(),
 		drvOpt.Machine(input.Machine, accel),
 		drvOpt.KeyboardLayoutLanguage("en-us"),
-		drvOpt.SMP(input.Cpu),
+		smpOpt,
 		drvOpt.Name(input.Name),
 		drvOpt.UUID(input.EnableUUID, input.UUID),
 		drvOpt.Memory(input.Mem),
 	)
 
 	var memDev string
-	if input.HugepagesEnabled {
+	if len(input.NumaNodes) > 0 {
+		if input.HugepagesEnabled {
+			memDev = drvOpt.NumaMemPath(input.NumaNodes, fmt.Sprintf("/dev/hugepages/%s", input.UUID))
+		} else if input.EnableMemfd {
+			memDev = drvOpt.NumaMemFd(input.NumaNodes)
+		} else {
+			memDev = drvOpt.NumaMemDev(input.NumaNodes)
+		}
+	} else if input.HugepagesEnabled {
 		memDev = drvOpt.MemPath(input.Mem, fmt.Sprintf("/dev/hugepages/%s", input.UUID))
 	} else if input.EnableMemfd {
 		memDev = drvOpt.MemFd(input.Mem)
@@ -158,6 +173,15 @@ func GenerateStartOptions(
 		opts = append(opts, fmOpt)
 	}
 
+	// vtpm
+	if input.VtpmSocketPath != "" {
+		tpmOpts := drvOpt.TPM(input.VtpmSocketPath)
+		if len(tpmOpts) == 0 {
+			return "", errors.Errorf("vTPM is not supported by qemu %s %s", input.QemuVersion, input.QemuArch)
+		}
+		opts = append(opts, tpmOpts...)
+	}
+
 	if input.OsName == OS_NAME_MACOS {
 		opts = append(opts, drvOpt.Device("isa-applesmc,osk=ourhardworkbythesewordsguardedpleasedontsteal(c)AppleComputerInc"))
 	}
@@ -95,12 +95,16 @@ type QemuOptions interface {
 	Machine(machineType string, accel string) string
 	KeyboardLayoutLanguage(lang string) string
 	SMP(cpus uint) string
+	NumaSMP(cpus uint, nodes uint) string
 	Name(name string) string
 	UUID(enable bool, uuid string) string
 	Memory(sizeMB uint64) string
 	MemPath(sizeMB uint64, p string) string
 	MemDev(sizeMB uint64) string
 	MemFd(sizeMB uint64) string
+	NumaMemPath(nodes []compute.GuestNumaNode, p string) string
+	NumaMemDev(nodes []compute.GuestNumaNode) string
+	NumaMemFd(nodes []compute.GuestNumaNode) string
 	Boot(order string, enableMenu bool) string
 	BIOS(ovmfPath, homedir string) (string, error)
 	Device(devStr string) string
@@ -119,6 +123,7 @@ type QemuOptions interface {
 	SerialDevice() []string
 	QGA(homeDir string) []string
 	PvpanicDevice() string
+	TPM(socketPath string) []string
 }
 
 var (
@@ -262,6 +267,46 @@ func (o baseOptions) MemFd(sizeMB uint64) string {
 	return fmt.Sprintf("-object memory-backend-memfd,id=mem,size=%dM,share=on,prealloc=on -numa node,memdev=mem", sizeMB)
 }
 
+// NumaSMP returns smp option of guest with virtual NUMA nodes, vcpu hotplug
+// is disabled as all possible vcpus must be assigned to nodes
+func (o baseOptions) NumaSMP(cpus uint, nodes uint) string {
+	sockets, cores := cpus, uint(1)
+	if nodes > 0 && cpus%nodes == 0 {
+		sockets, cores = nodes, cpus/nodes
+	}
+	return fmt.Sprintf("-smp cpus=%d,sockets=%d,cores=%d,threads=1,maxcpus=%d", cpus, sockets, cores, cpus)
+}
+
+// numaMemOptions binds memory of each virtual NUMA node to its host node
+func numaMemOptions(backend string, extra string, nodes []compute.GuestNumaNode) string {
+	opts := []string{}
+	cpuStart := 0
+	for i, node := range nodes {
+		memId := fmt.Sprintf("mem-node%d", i)
+		opts = append(opts, fmt.Sprintf("-object %s,id=%s,size=%dM%s,host-nodes=%d,policy=bind",
+			backend, memId, node.MemSizeMb, extra, node.HostNodeId))
+		numaOpt := fmt.Sprintf("-numa node,nodeid=%d", i)
+		if node.VcpuCount > 0 {
+			numaOpt += fmt.Sprintf(",cpus=%d-%d", cpuStart, cpuStart+node.VcpuCount-1)
+			cpuStart += node.VcpuCount
+		}
+		opts = append(opts, numaOpt+",memdev="+memId)
+	}
+	return strings.Join(opts, " ")
+}
+
+func (o baseOptions) NumaMemPath(nodes []compute.GuestNumaNode, p string) string {
+	return numaMemOptions("memory-backend-file", fmt.Sprintf(",mem-path=%s,share=on,prealloc=on", p), nodes)
+}
+
+func (o baseOptions) NumaMemDev(nodes []compute.GuestNumaNode) string {
+	return numaMemOptions("memory-backend-ram", "", nodes)
+}
+
+func (o baseOptions) NumaMemFd(nodes []compute.GuestNumaNode) string {
+	return numaMemOptions("memory-backend-memfd", ",share=on,prealloc=on", nodes)
+}
+
 func (o baseOptions) Boot(order string, enableMenu bool) string {
 	opt := "-boot order=" + order
 	if enableMenu {
@@ -479,6 +524,14 @@ func (o baseOptions_x86_64) PvpanicDevice() string {
 	return o.Device("pvpanic")
 }
 
+func (o baseOptions_x86_64) TPM(socketPath string) []string {
+	return []string{
+		fmt.Sprintf("-chardev socket,id=chrtpm,path=%s", socketPath),
+		"-tpmdev emulator,id=tpm0,chardev=chrtpm",
+		o.Device("tpm-tis,tpmdev=tpm0"),
+	}
+}
+
 func (o baseOptions_x86_64) VdiSpice(spicePort uint, pciBus string) []string {
 	baseOpts := o.baseOptions.VdiSpice(spicePort, pciBus)
 	vga := o.Device("qxl-vga,id=video0,ram_size=141557760,vram_size=141557760")
@@ -568,6 +621,11 @@ func (o baseOptions_aarch64) PvpanicDevice() string {
 	return ""
 }
 
+func (o baseOptions_aarch64) TPM(_ string) []string {
+	// tpm-tis-device is only available since qemu 5.0
+	return nil
+}
+
 func (o baseOptions_aarch64) VdiSpice(spicePort uint, pciBus string) []string {
 	return o.baseOptions.VdiSpice(spicePort, "pcie.0")
 }
@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"yunion.io/x/onecloud/pkg/apis/compute"
 )
 
 func Test_baseOptions(t *testing.T) {
@@ -40,6 +42,19 @@ func Test_baseOptions(t *testing.T) {
 	}))
 	// test memory
 	assert.Equal("-m 1024M,slots=4,maxmem=524288M", opt.Memory(1024))
+	// test numa
+	assert.Equal("-smp cpus=8,sockets=2,cores=4,threads=1,maxcpus=8", opt.NumaSMP(8, 2))
+	assert.Equal("-smp cpus=5,sockets=5,cores=1,threads=1,maxcpus=5", opt.NumaSMP(5, 2))
+	assert.Equal(
+		"-object memory-backend-ram,id=mem-node0,size=2048M,host-nodes=0,policy=bind -numa node,nodeid=0,cpus=0-2,memdev=mem-node0 "+
+			"-object memory-backend-ram,id=mem-node1,size=2048M,host-nodes=1,policy=bind -numa node,nodeid=1,cpus=3-4,memdev=mem-node1",
+		opt.NumaMemDev([]compute.GuestNumaNode{
+			{HostNodeId: 0, VcpuCount: 3, MemSizeMb: 2048},
+			{HostNodeId: 1, VcpuCount: 2, MemSizeMb: 2048},
+		}))
+	assert.Equal(
+		"-object memory-backend-file,id=mem-node0,size=1024M,mem-path=/dev/hugepages/sid,share=on,prealloc=on,host-nodes=1,policy=bind -numa node,nodeid=0,cpus=0-1,memdev=mem-node0",
+		opt.NumaMemPath([]compute.GuestNumaNode{{HostNodeId: 1, VcpuCount: 2, MemSizeMb: 1024}}, "/dev/hugepages/sid"))
 	// test device
 	assert.Equal("-device isa-applesmc,osk=ourhardworkbythesewordsguardedpleasedontsteal(c)AppleComputerInc", opt.Device("isa-applesmc,osk=ourhardworkbythesewordsguardedpleasedontsteal(c)AppleComputerInc"))
 	// test vdi spice
@@ -67,4 +82,10 @@ func Test_baseOptions(t *testing.T) {
 	// test vga
 	assert.Equal("-vga std", opt.VGA("std", ""))
 	assert.Equal("-vga x", opt.VGA("std", "-vga x"))
+	// test tpm
+	assert.Equal([]string{
+		"-chardev socket,id=chrtpm,path=/opt/cloud/workspace/servers/sid/swtpm.sock",
+		"-tpmdev emulator,id=tpm0,chardev=chrtpm",
+		"-device tpm-tis,tpmdev=tpm0",
+	}, opt.TPM("/opt/cloud/workspace/servers/sid/swtpm.sock"))
 }
@@ -0,0 +1,273 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	hostapi "yunion.io/x/onecloud/pkg/apis/host"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+func (s *SKVMGuestInstance) GetQgaSocketPath() string {
+	return path.Join(s.HomeDir(), "qga.sock")
+}
+
+const (
+	// time to wait for the busy agent by the requests that must not be
+	// dropped, e.g. fsthaw after a snapshot
+	QGA_LOCK_WAIT_TIMEOUT = 60 * time.Second
+	QGA_THAW_RETRY_COUNT  = 3
+)
+
+func (s *SKVMGuestInstance) closeGuestAgent() {
+	s.guestAgentLock.Lock()
+	defer s.guestAgentLock.Unlock()
+	if s.guestAgent != nil {
+		s.guestAgent.Close()
+		s.guestAgent = nil
+	}
+}
+
+func (s *SKVMGuestInstance) getGuestAgent() (*monitor.QemuGuestAgent, error) {
+	s.guestAgentLock.Lock()
+	defer s.guestAgentLock.Unlock()
+	if s.guestAgent == nil {
+		if !fileutils2.Exists(s.GetQgaSocketPath()) {
+			return nil, httperrors.NewUnsupportOperationError("guest %s has no qga channel", s.GetName())
+		}
+		qga, err := monitor.NewQemuGuestAgent(s.Id, s.GetQgaSocketPath())
+		if err != nil {
+			return nil, errors.Wrap(err, "NewQemuGuestAgent")
+		}
+		s.guestAgent = qga
+	}
+	return s.guestAgent, nil
+}
+
+// withGuestAgent serializes access to the qga channel, the agent handles
+// one client command at a time and replies are not tagged with request id.
+// It fails immediately if the agent is busy.
+func (s *SKVMGuestInstance) withGuestAgent(f func(qga *monitor.QemuGuestAgent) error) error {
+	return s.withGuestAgentWait(0, f)
+}
+
+// withGuestAgentWait waits up to timeout for the busy agent
+func (s *SKVMGuestInstance) withGuestAgentWait(timeout time.Duration, f func(qga *monitor.QemuGuestAgent) error) error {
+	if !s.IsRunning() {
+		return httperrors.NewInvalidStatusError("guest %s is not running", s.GetName())
+	}
+	qga, err := s.getGuestAgent()
+	if err != nil {
+		return err
+	}
+	if !qga.LockTimeout(timeout) {
+		return httperrors.NewConflictError("guest %s %s", s.GetName(), monitor.ErrGuestAgentBusy)
+	}
+	defer qga.Unlock()
+	return f(qga)
+}
+
+func (s *SKVMGuestInstance) QgaPing(timeout int) error {
+	return s.withGuestAgent(func(qga *monitor.QemuGuestAgent) error {
+		return qga.GuestPing(timeout)
+	})
+}
+
+func (s *SKVMGuestInstance) QgaSetUserPassword(input *hostapi.GuestQgaSetPasswordRequest) error {
+	return s.withGuestAgent(func(qga *monitor.QemuGuestAgent) error {
+		return qga.GuestSetUserPassword(input.Username, input.Password, input.Crypted)
+	})
+}
+
+func (s *SKVMGuestInstance) QgaFsfreeze() (int, error) {
+	var count int
+	err := s.withGuestAgentWait(QGA_LOCK_WAIT_TIMEOUT, func(qga *monitor.QemuGuestAgent) error {
+		var err error
+		count, err = qga.GuestFsfreezeFreeze()
+		return err
+	})
+	return count, err
+}
+
+// QgaFsthaw waits for the busy agent and retries, a guest must not be left
+// with frozen filesystems
+func (s *SKVMGuestInstance) QgaFsthaw() (int, error) {
+	var count int
+	var err error
+	for i := 0; i < QGA_THAW_RETRY_COUNT; i++ {
+		err = s.withGuestAgentWait(QGA_LOCK_WAIT_TIMEOUT, func(qga *monitor.QemuGuestAgent) error {
+			var err error
+			count, err = qga.GuestFsfreezeThaw()
+			return err
+		})
+		if err == nil {
+			return count, nil
+		}
+		log.Warningf("guest %s fsthaw failed (%d/%d): %s", s.GetName(), i+1, QGA_THAW_RETRY_COUNT, err)
+		time.Sleep(time.Duration(i+1) * time.Second)
+	}
+	return count, err
+}
+
+func (s *SKVMGuestInstance) QgaExec(input *hostapi.GuestQgaExecRequest) (*hostapi.GuestQgaExecResponse, error) {
+	timeout := input.Timeout
+	if timeout <= 0 {
+		timeout = monitor.QGA_EXEC_DEFAULT_WAIT_TIMEOUT
+	}
+	ret := new(hostapi.GuestQgaExecResponse)
+	err := s.withGuestAgent(func(qga *monitor.QemuGuestAgent) error {
+		execResp, err := qga.GuestExec(input.Path, input.Args, input.Env, input.Input, true)
+		if err != nil {
+			return errors.Wrap(err, "GuestExec")
+		}
+		ret.Pid = execResp.Pid
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the agent is released between polls so that other requests are not
+	// blocked by a long running command
+	expire := time.Now().Add(time.Duration(timeout) * time.Second)
+	for {
+		var status *monitor.GuestExecStatusResp
+		err := s.withGuestAgentWait(QGA_LOCK_WAIT_TIMEOUT, func(qga *monitor.QemuGuestAgent) error {
+			var err error
+			status, err = qga.GuestExecStatus(ret.Pid)
+			return err
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "GuestExecStatus")
+		}
+		if status.Exited {
+			ret.Exited = true
+			ret.ExitCode = status.Exitcode
+			ret.Signal = status.Signal
+			ret.Stdout = status.OutData
+			ret.Stderr = status.ErrData
+			ret.OutTruncated = status.OutTruncated
+			ret.ErrTruncated = status.ErrTruncated
+			return ret, nil
+		}
+		if time.Now().After(expire) {
+			log.Warningf("guest %s qga exec %s pid %d not exited in %ds", s.GetName(), input.Path, ret.Pid, timeout)
+			return ret, nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func (s *SKVMGuestInstance) QgaGetNetworkInterfaces() ([]monitor.GuestNetworkInterface, error) {
+	var ifaces []monitor.GuestNetworkInterface
+	err := s.withGuestAgent(func(qga *monitor.QemuGuestAgent) error {
+		var err error
+		ifaces, err = qga.GuestNetworkGetInterfaces()
+		return err
+	})
+	return ifaces, err
+}
+
+func (s *SKVMGuestInstance) QgaGetOsInfo() (*monitor.GuestOsInfo, error) {
+	var info *monitor.GuestOsInfo
+	err := s.withGuestAgent(func(qga *monitor.QemuGuestAgent) error {
+		var err error
+		info, err = qga.GuestGetOsInfo()
+		return err
+	})
+	return info, err
+}
+
+func (m *SGuestManager) getRunningGuest(sid string) (*SKVMGuestInstance, error) {
+	guest, ok := m.GetServer(sid)
+	if !ok {
+		return nil, httperrors.NewNotFoundError("Guest %s not found", sid)
+	}
+	if !guest.IsRunning() {
+		return nil, httperrors.NewInvalidStatusError("Guest %s not running", sid)
+	}
+	return guest, nil
+}
+
+func (m *SGuestManager) QgaGuestPing(ctx context.Context, sid string, input *hostapi.GuestQgaPingRequest) error {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return err
+	}
+	return guest.QgaPing(input.Timeout)
+}
+
+func (m *SGuestManager) QgaSetUserPassword(ctx context.Context, sid string, input *hostapi.GuestQgaSetPasswordRequest) error {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return err
+	}
+	return guest.QgaSetUserPassword(input)
+}
+
+func (m *SGuestManager) QgaFsfreeze(ctx context.Context, sid string) (*hostapi.GuestQgaFsfreezeResponse, error) {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return nil, err
+	}
+	count, err := guest.QgaFsfreeze()
+	if err != nil {
+		return nil, err
+	}
+	return &hostapi.GuestQgaFsfreezeResponse{Count: count}, nil
+}
+
+func (m *SGuestManager) QgaFsthaw(ctx context.Context, sid string) (*hostapi.GuestQgaFsfreezeResponse, error) {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return nil, err
+	}
+	count, err := guest.QgaFsthaw()
+	if err != nil {
+		return nil, err
+	}
+	return &hostapi.GuestQgaFsfreezeResponse{Count: count}, nil
+}
+
+func (m *SGuestManager) QgaExec(ctx context.Context, sid string, input *hostapi.GuestQgaExecRequest) (*hostapi.GuestQgaExecResponse, error) {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return nil, err
+	}
+	return guest.QgaExec(input)
+}
+
+func (m *SGuestManager) QgaGetNetworkInterfaces(ctx context.Context, sid string) ([]monitor.GuestNetworkInterface, error) {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return nil, err
+	}
+	return guest.QgaGetNetworkInterfaces()
+}
+
+func (m *SGuestManager) QgaGetOsInfo(ctx context.Context, sid string) (*monitor.GuestOsInfo, error) {
+	guest, err := m.getRunningGuest(sid)
+	if err != nil {
+		return nil, err
+	}
+	return guest.QgaGetOsInfo()
+}
@@ -0,0 +1,295 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guestman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/hostman/monitor"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	identity_modules "yunion.io/x/onecloud/pkg/mcclient/modules/identity"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+const VTPM_MONITOR_TIMEOUT = 30 * time.Second
+
+// swtpm keeps the whole TPM state in a few flat files under the state dir,
+// e.g. tpm2-00.permall, which are packed into a tar.gz and encrypted by the
+// guest encrypt key when the state is carried to another host or saved in
+// instance snapshots and backups
+
+func (s *SKVMGuestInstance) isVtpmEnabled() bool {
+	return s.Desc != nil && s.Desc.Vtpm
+}
+
+func (s *SKVMGuestInstance) getVtpmStateDir() string {
+	return path.Join(s.HomeDir(), "vtpm")
+}
+
+func (s *SKVMGuestInstance) getVtpmSocketPath() string {
+	return path.Join(s.HomeDir(), "swtpm.sock")
+}
+
+func (s *SKVMGuestInstance) getVtpmPidFilePath() string {
+	return path.Join(s.HomeDir(), "swtpm.pid")
+}
+
+func (s *SKVMGuestInstance) getVtpmLogPath() string {
+	return path.Join(s.HomeDir(), "swtpm.log")
+}
+
+func (s *SKVMGuestInstance) generateVtpmStopScript() string {
+	cmd := fmt.Sprintf("SWTPM_PID_FILE=%s\n", s.getVtpmPidFilePath())
+	cmd += "if [ -f $SWTPM_PID_FILE ]; then\n"
+	cmd += "  SWTPM_PID=`cat $SWTPM_PID_FILE`\n"
+	cmd += "  ps -p $SWTPM_PID > /dev/null\n"
+	cmd += "  if [ $? -eq 0 ]; then\n"
+	cmd += "    echo \"Kill swtpm process $SWTPM_PID\"\n"
+	cmd += "    kill -9 $SWTPM_PID > /dev/null 2>&1\n"
+	cmd += "  fi\n"
+	cmd += "  rm -f $SWTPM_PID_FILE\n"
+	cmd += "fi\n"
+	cmd += fmt.Sprintf("rm -f %s\n", s.getVtpmSocketPath())
+	return cmd
+}
+
+// generateVtpmStartScript starts a swtpm instance serving the guest, swtpm
+// terminates by itself once qemu closes the control channel
+func (s *SKVMGuestInstance) generateVtpmStartScript() string {
+	swtpm := options.HostOptions.BinarySwtpmPath
+	cmd := s.generateVtpmStopScript()
+	cmd += fmt.Sprintf("if [ ! -x %s ]; then\n", swtpm)
+	cmd += fmt.Sprintf("  echo \"swtpm binary %s not found\"\n", swtpm)
+	cmd += "  exit 1\n"
+	cmd += "fi\n"
+	cmd += fmt.Sprintf("mkdir -p %s\n", s.getVtpmStateDir())
+	cmd += fmt.Sprintf("%s socket --tpm2", swtpm)
+	cmd += fmt.Sprintf(" --tpmstate dir=%s,mode=0600", s.getVtpmStateDir())
+	cmd += fmt.Sprintf(" --ctrl type=unixio,path=%s,mode=0600", s.getVtpmSocketPath())
+	cmd += fmt.Sprintf(" --pid file=%s", s.getVtpmPidFilePath())
+	cmd += fmt.Sprintf(" --log file=%s,level=5", s.getVtpmLogPath())
+	cmd += " --terminate --daemon\n"
+	cmd += "if [ $? -ne 0 ]; then\n"
+	cmd += "  echo \"Start swtpm failed\"\n"
+	cmd += "  exit 1\n"
+	cmd += "fi\n"
+	return cmd
+}
+
+// getVtpmEncryptKey returns the encrypt key of the guest, which protects the
+// packed TPM state whenever it leaves the host
+func (s *SKVMGuestInstance) getVtpmEncryptKey(ctx context.Context, userCred mcclient.TokenCredential) (identity_modules.SEncryptKeySecret, error) {
+	if !s.isEncrypted() {
+		return identity_modules.SEncryptKeySecret{}, errors.Wrap(httperrors.ErrInvalidStatus, "vtpm state requires an encrypted guest")
+	}
+	if userCred == nil {
+		return identity_modules.SEncryptKeySecret{}, errors.Wrap(httperrors.ErrUnauthorized, "no credential to fetch encrypt key")
+	}
+	session := auth.GetSession(ctx, userCred, consts.GetRegion(), "")
+	secKey, err := identity_modules.Credentials.GetEncryptKey(session, s.getEncryptKeyId())
+	if err != nil {
+		return secKey, errors.Wrap(err, "GetEncryptKey")
+	}
+	return secKey, nil
+}
+
+func (s *SKVMGuestInstance) vtpmMonitorCommand(cmd func(cb monitor.StringCallback)) (string, error) {
+	res := make(chan string, 1)
+	cmd(func(r string) {
+		res <- r
+	})
+	select {
+	case <-time.After(VTPM_MONITOR_TIMEOUT):
+		return "", errors.Wrap(errors.ErrTimeout, "wait monitor response")
+	case r := <-res:
+		return r, nil
+	}
+}
+
+// pauseForVtpmState stops the vCPUs of a running guest, so that no TPM
+// command is in flight and swtpm has flushed its state files when they are
+// read. The returned function resumes the guest if it has been paused here.
+func (s *SKVMGuestInstance) pauseForVtpmState() (func(), error) {
+	resume := func() {}
+	if !s.IsRunning() || !s.IsMonitorAlive() {
+		return resume, nil
+	}
+	status, err := s.vtpmMonitorCommand(s.Monitor.QueryStatus)
+	if err != nil {
+		return resume, errors.Wrap(err, "query status")
+	}
+	if status != "running" {
+		return resume, nil
+	}
+	res, err := s.vtpmMonitorCommand(func(cb monitor.StringCallback) {
+		s.Monitor.SimpleCommand("stop", cb)
+	})
+	if err != nil {
+		return resume, errors.Wrap(err, "stop guest")
+	}
+	if strings.Contains(strings.ToLower(res), "error") {
+		return resume, errors.Errorf("stop guest: %s", res)
+	}
+	resume = func() {
+		res, err := s.vtpmMonitorCommand(func(cb monitor.StringCallback) {
+			s.Monitor.SimpleCommand("cont", cb)
+		})
+		if err != nil || strings.Contains(strings.ToLower(res), "error") {
+			log.Errorf("[%s] resume guest after reading vtpm state: %s %v", s.GetId(), res, err)
+		}
+	}
+	return resume, nil
+}
+
+// GetVtpmState returns the packed TPM state encrypted by the key of the guest,
+// empty string is returned if the guest has never been started with vTPM
+func (s *SKVMGuestInstance) GetVtpmState(ctx context.Context, userCred mcclient.TokenCredential) (string, error) {
+	dir := s.getVtpmStateDir()
+	if !fileutils2.Exists(dir) {
+		return "", nil
+	}
+	key, err := s.getVtpmEncryptKey(ctx, userCred)
+	if err != nil {
+		return "", errors.Wrap(err, "getVtpmEncryptKey")
+	}
+	resume, err := s.pauseForVtpmState()
+	if err != nil {
+		return "", errors.Wrap(err, "pauseForVtpmState")
+	}
+	content, err := s.packVtpmState(dir)
+	resume()
+	if err != nil {
+		return "", err
+	}
+	if len(content) == 0 {
+		return "", nil
+	}
+	state, err := key.EncryptBase64(content)
+	if err != nil {
+		return "", errors.Wrap(err, "encrypt vtpm state")
+	}
+	return state, nil
+}
+
+func (s *SKVMGuestInstance) packVtpmState(dir string) ([]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read dir %s", dir)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		hdr, err := tar.FileInfoHeader(f, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "tar header of %s", f.Name())
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, errors.Wrapf(err, "write tar header of %s", f.Name())
+		}
+		content, err := ioutil.ReadFile(path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", f.Name())
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, errors.Wrapf(err, "write tar content of %s", f.Name())
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, errors.Wrap(err, "close tar writer")
+	}
+	if err := gw.Close(); err != nil {
+		return nil, errors.Wrap(err, "close gzip writer")
+	}
+	return buf.Bytes(), nil
+}
+
+// RestoreVtpmState replaces the TPM state of a stopped guest with state
+// returned by GetVtpmState
+func (s *SKVMGuestInstance) RestoreVtpmState(ctx context.Context, userCred mcclient.TokenCredential, state string) error {
+	if s.IsRunning() {
+		return httperrors.NewInvalidStatusError("can't restore vTPM state of running guest")
+	}
+	key, err := s.getVtpmEncryptKey(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "getVtpmEncryptKey")
+	}
+	content, err := key.DecryptBase64(state)
+	if err != nil {
+		return errors.Wrap(err, "decrypt vtpm state")
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return errors.Wrap(err, "gzip reader")
+	}
+	defer gr.Close()
+
+	dir := s.getVtpmStateDir()
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.Wrapf(err, "remove %s", dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "mkdir %s", dir)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "read tar")
+		}
+		name := hdr.Name
+		if hdr.Typeflag != tar.TypeReg || strings.Contains(name, "/") || name == ".." {
+			log.Warningf("skip unexpected vtpm state entry %s", name)
+			continue
+		}
+		f, err := os.OpenFile(path.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "open %s", name)
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return errors.Wrapf(err, "write %s", name)
+		}
+	}
+	return nil
+}
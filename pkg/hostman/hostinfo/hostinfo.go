@@ -489,6 +489,13 @@ func (h *SHostInfo) detectHostInfo() error {
 	h.sysinfo.Topology = topoInfo
 	h.sysinfo.CPUInfo = cpuInfo
 
+	numaNodes, err := hardware.GetNumaNodes(h.sysinfo.HugepageSizeKb)
+	if err != nil {
+		log.Warningf("Get NUMA nodes: %s", err)
+	} else {
+		h.sysinfo.NumaNodes = numaNodes
+	}
+
 	system_service.Init()
 	if options.HostOptions.CheckSystemServices {
 		if err := h.checkSystemServices(); err != nil {
@@ -328,8 +328,9 @@ type SSysInfo struct {
 	HugepagesOption string `json:"hugepages_option"`
 	HugepageSizeKb  int    `json:"hugepage_size_kb"`
 
-	Topology *hostapi.HostTopology `json:"topology"`
-	CPUInfo  *hostapi.HostCPUInfo  `json:"cpu_info"`
+	Topology  *hostapi.HostTopology   `json:"topology"`
+	CPUInfo   *hostapi.HostCPUInfo    `json:"cpu_info"`
+	NumaNodes []*hostapi.HostNumaNode `json:"numa_nodes"`
 }
 
 func StartDetachStorages(hs []jsonutils.JSONObject) {
@@ -0,0 +1,109 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hardware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis/host"
+	"yunion.io/x/onecloud/pkg/util/cgrouputils/cpuset"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+const sysNodePath = "/sys/devices/system/node"
+
+var (
+	nodeDirRegexp  = regexp.MustCompile(`^node(\d+)$`)
+	memTotalRegexp = regexp.MustCompile(`MemTotal:\s+(\d+)\s+kB`)
+)
+
+// GetNumaNodeCpus returns logical cpus of host NUMA node
+func GetNumaNodeCpus(nodeId int) (cpuset.CPUSet, error) {
+	cpuList, err := fileutils2.FileGetContents(path.Join(sysNodePath, fmt.Sprintf("node%d", nodeId), "cpulist"))
+	if err != nil {
+		return cpuset.NewCPUSet(), errors.Wrapf(err, "read cpulist of node %d", nodeId)
+	}
+	return cpuset.Parse(strings.TrimSpace(cpuList))
+}
+
+func getNumaNodeMemSizeMb(nodeDir string) (int, error) {
+	content, err := fileutils2.FileGetContents(path.Join(nodeDir, "meminfo"))
+	if err != nil {
+		return 0, errors.Wrap(err, "read meminfo")
+	}
+	m := memTotalRegexp.FindStringSubmatch(content)
+	if len(m) != 2 {
+		return 0, errors.Errorf("MemTotal not found in %s", nodeDir)
+	}
+	sizeKb, _ := strconv.Atoi(m[1])
+	return sizeKb / 1024, nil
+}
+
+func getNumaNodeHugepagesMb(nodeDir string, hugepageSizeKb int) int {
+	content, err := fileutils2.FileGetContents(path.Join(nodeDir, "hugepages",
+		fmt.Sprintf("hugepages-%dkB", hugepageSizeKb), "nr_hugepages"))
+	if err != nil {
+		return 0
+	}
+	nr, _ := strconv.Atoi(strings.TrimSpace(content))
+	return nr * hugepageSizeKb / 1024
+}
+
+// GetNumaNodes returns capacity of host NUMA nodes, hugepages of the size
+// hugepageSizeKb are counted if it is not zero
+func GetNumaNodes(hugepageSizeKb int) ([]*host.HostNumaNode, error) {
+	dirs, err := ioutil.ReadDir(sysNodePath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read dir %s", sysNodePath)
+	}
+	nodes := []*host.HostNumaNode{}
+	for _, dir := range dirs {
+		m := nodeDirRegexp.FindStringSubmatch(dir.Name())
+		if len(m) != 2 {
+			continue
+		}
+		nodeId, _ := strconv.Atoi(m[1])
+		nodeDir := path.Join(sysNodePath, dir.Name())
+		cpus, err := GetNumaNodeCpus(nodeId)
+		if err != nil {
+			return nil, err
+		}
+		memSize, err := getNumaNodeMemSizeMb(nodeDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get memory size of node %d", nodeId)
+		}
+		node := &host.HostNumaNode{
+			NodeId:    nodeId,
+			Cpus:      cpus.ToSlice(),
+			MemSizeMb: memSize,
+		}
+		if hugepageSizeKb > 0 {
+			node.HugepagesMb = getNumaNodeHugepagesMb(nodeDir, hugepageSizeKb)
+		}
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].NodeId < nodes[j].NodeId
+	})
+	return nodes, nil
+}
@@ -22,6 +22,7 @@ import (
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 
+	"yunion.io/x/onecloud/pkg/apis"
 	"yunion.io/x/onecloud/pkg/appctx"
 	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/cloudcommon/workmanager"
@@ -73,17 +74,42 @@ func GetImageSession(ctx context.Context, zone string) *mcclient.ClientSession {
 	return auth.AdminSessionWithInternal(ctx, options.HostOptions.Region, "", "v1")
 }
 
-func TaskFailed(ctx context.Context, reason string) {
-	if taskId := ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID); taskId != nil {
-		modules.ComputeTasks.TaskFailed2(GetComputeSession(ctx), taskId.(string), reason)
-	} else {
-		log.Errorf("Reqeuest task failed missing task id, with reason(%s)", reason)
+// withTaskStageAttempt adds the stage attempt of the request to callback
+// params, so that region ignores late callbacks of a retried stage
+func withTaskStageAttempt(ctx context.Context, params jsonutils.JSONObject) jsonutils.JSONObject {
+	attempt := appctx.AppContextTaskStageAttempt(ctx)
+	if len(attempt) == 0 {
+		return params
 	}
+	var dict *jsonutils.JSONDict
+	switch p := params.(type) {
+	case nil:
+		dict = jsonutils.NewDict()
+	case *jsonutils.JSONDict:
+		if p == nil {
+			dict = jsonutils.NewDict()
+		} else {
+			dict = p.Copy()
+		}
+	default:
+		return params
+	}
+	dict.Set(apis.TASK_STAGE_ATTEMPT_KEY, jsonutils.NewString(attempt))
+	return dict
+}
+
+func TaskFailed(ctx context.Context, reason string) {
+	TaskFailed2(ctx, reason, nil)
 }
 
 func TaskFailed2(ctx context.Context, reason string, params *jsonutils.JSONDict) {
 	if taskId := ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID); taskId != nil {
-		modules.ComputeTasks.TaskFailed3(GetComputeSession(ctx), taskId.(string), reason, params)
+		var p jsonutils.JSONObject
+		if params != nil {
+			p = params
+		}
+		data, _ := withTaskStageAttempt(ctx, p).(*jsonutils.JSONDict)
+		modules.ComputeTasks.TaskFailed3(GetComputeSession(ctx), taskId.(string), reason, data)
 	} else {
 		log.Errorf("Reqeuest task failed missing task id, with reason(%s)", reason)
 	}
@@ -91,7 +117,7 @@ func TaskFailed2(ctx context.Context, reason string, params *jsonutils.JSONDict)
 
 func TaskComplete(ctx context.Context, params jsonutils.JSONObject) {
 	if taskId := ctx.Value(appctx.APP_CONTEXT_KEY_TASK_ID); taskId != nil {
-		modules.ComputeTasks.TaskComplete(GetComputeSession(ctx), taskId.(string), params)
+		modules.ComputeTasks.TaskComplete(GetComputeSession(ctx), taskId.(string), withTaskStageAttempt(ctx, params))
 	} else {
 		log.Errorln("Reqeuest task complete missing task id")
 	}
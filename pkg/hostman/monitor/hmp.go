@@ -425,6 +425,14 @@ func (m *HmpMonitor) SnapshotBlkdev(drive, newImagePath, format string, reuse bo
 	m.Query(cmd, cb)
 }
 
+func (m *HmpMonitor) DriveBackup(drive, target, format, bitmap, newBitmap string, callback StringCallback) {
+	go callback("drive backup with dirty bitmap is not supported by hmp")
+}
+
+func (m *HmpMonitor) BlockDirtyBitmapRemove(drive, name string, callback StringCallback) {
+	go callback("block dirty bitmap is not supported by hmp")
+}
+
 func (m *HmpMonitor) SetVncPassword(proto, password string, callback StringCallback) {
 	if len(password) > 8 {
 		password = password[:8]
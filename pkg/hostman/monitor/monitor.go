@@ -50,6 +50,16 @@ type BlockJob struct {
 	speedMbps float64
 }
 
+type QemuDirtyBitmap struct {
+	Name         string
+	Count        int64
+	Granularity  int64
+	Recording    bool
+	Busy         bool
+	Persistent   bool
+	Inconsistent bool
+}
+
 type QemuBlock struct {
 	IoStatus  string `json:"io-status"`
 	Device    string
@@ -58,7 +68,9 @@ type QemuBlock struct {
 	Qdev      string
 	TrayOpen  bool
 	Type      string
-	Inserted  struct {
+	// reported here by qemu before 4.2
+	DirtyBitmaps []QemuDirtyBitmap `json:"dirty-bitmaps"`
+	Inserted     struct {
 		Ro               bool
 		Drv              string
 		Encrypted        bool
@@ -102,7 +114,20 @@ type QemuBlock struct {
 				VirtualSize int64 `json:"virtual-size"`
 			} `json:"backing-image"`
 		}
+		DirtyBitmaps []QemuDirtyBitmap `json:"dirty-bitmaps"`
+	}
+}
+
+// GetDirtyBitmap returns the usable dirty bitmap of the block named name
+func (b *QemuBlock) GetDirtyBitmap(name string) *QemuDirtyBitmap {
+	for _, bitmaps := range [][]QemuDirtyBitmap{b.Inserted.DirtyBitmaps, b.DirtyBitmaps} {
+		for i := range bitmaps {
+			if bitmaps[i].Name == name && !bitmaps[i].Inconsistent && !bitmaps[i].Busy {
+				return &bitmaps[i]
+			}
+		}
 	}
+	return nil
 }
 
 type blockSizeByte int64
@@ -178,6 +203,8 @@ type Monitor interface {
 	BlockJobComplete(drive string, cb StringCallback)
 	BlockReopenImage(drive, newImagePath, format string, cb StringCallback)
 	SnapshotBlkdev(drive, newImagePath, format string, reuse bool, cb StringCallback)
+	DriveBackup(drive, target, format, bitmap, newBitmap string, cb StringCallback)
+	BlockDirtyBitmapRemove(drive, name string, cb StringCallback)
 
 	MigrateSetDowntime(dtSec float32, callback StringCallback)
 	MigrateSetCapability(capability, state string, callback StringCallback)
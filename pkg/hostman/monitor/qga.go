@@ -0,0 +1,394 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+)
+
+// https://qemu.readthedocs.io/en/latest/interop/qemu-ga-ref.html
+/*
+QGA speaks the same json protocol as QMP over a virtio-serial channel,
+but without greeting and capabilities negotiation, and the guest side
+may hold stale data from a previous client. Every command therefore is
+preceded by guest-sync-delimited, whose response is prefixed with a 0xff
+sentinel byte, so the client can discard anything before it.
+*/
+
+const (
+	QGA_DEFAULT_READ_TIMEOUT_SECOND = 5
+	QGA_EXEC_DEFAULT_WAIT_TIMEOUT   = 5
+
+	qgaSyncDelimiter = 0xff
+)
+
+var (
+	ErrGuestAgentBusy = errors.Error("guest agent is busy")
+)
+
+type QemuGuestAgent struct {
+	id            string
+	qgaSocketPath string
+
+	commandTimeout time.Duration
+	mutex          *sync.Mutex
+
+	rwc    net.Conn
+	reader *bufio.Reader
+}
+
+type GuestExecCommandResp struct {
+	Pid int `json:"pid"`
+}
+
+type GuestExecStatusResp struct {
+	Exited       bool   `json:"exited"`
+	Exitcode     int    `json:"exitcode"`
+	Signal       int    `json:"signal"`
+	OutData      string `json:"out-data"`
+	ErrData      string `json:"err-data"`
+	OutTruncated bool   `json:"out-truncated"`
+	ErrTruncated bool   `json:"err-truncated"`
+}
+
+type GuestIpAddress struct {
+	IpAddress     string `json:"ip-address"`
+	IpAddressType string `json:"ip-address-type"`
+	Prefix        int    `json:"prefix"`
+}
+
+type GuestNetworkInterfaceStat struct {
+	RxBytes   int64 `json:"rx-bytes"`
+	RxPackets int64 `json:"rx-packets"`
+	RxErrs    int64 `json:"rx-errs"`
+	RxDropped int64 `json:"rx-dropped"`
+	TxBytes   int64 `json:"tx-bytes"`
+	TxPackets int64 `json:"tx-packets"`
+	TxErrs    int64 `json:"tx-errs"`
+	TxDropped int64 `json:"tx-dropped"`
+}
+
+type GuestNetworkInterface struct {
+	Name            string                     `json:"name"`
+	HardwareAddress string                     `json:"hardware-address"`
+	IpAddresses     []GuestIpAddress           `json:"ip-addresses"`
+	Statistics      *GuestNetworkInterfaceStat `json:"statistics"`
+}
+
+type GuestOsInfo struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	PrettyName    string `json:"pretty-name"`
+	Version       string `json:"version"`
+	VersionId     string `json:"version-id"`
+	KernelVersion string `json:"kernel-version"`
+	KernelRelease string `json:"kernel-release"`
+	Machine       string `json:"machine"`
+	Variant       string `json:"variant"`
+	VariantId     string `json:"variant-id"`
+}
+
+func NewQemuGuestAgent(id, qgaSocketPath string) (*QemuGuestAgent, error) {
+	qga := &QemuGuestAgent{
+		id:             id,
+		qgaSocketPath:  qgaSocketPath,
+		commandTimeout: QGA_DEFAULT_READ_TIMEOUT_SECOND * time.Second,
+		mutex:          &sync.Mutex{},
+	}
+	if err := qga.connect(); err != nil {
+		return nil, err
+	}
+	return qga, nil
+}
+
+func (qga *QemuGuestAgent) connect() error {
+	conn, err := net.Dial("unix", qga.qgaSocketPath)
+	if err != nil {
+		return errors.Wrapf(err, "dial qga socket %s", qga.qgaSocketPath)
+	}
+	qga.rwc = conn
+	qga.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// TryLock is used by callers to keep long running requests, such as
+// fsfreeze/thaw pairs, from being interleaved with other commands.
+func (qga *QemuGuestAgent) TryLock() bool {
+	return qga.mutex.TryLock()
+}
+
+// LockTimeout waits up to timeout for the agent, it is used by requests
+// that must not be dropped when the agent is busy, such as fsthaw
+func (qga *QemuGuestAgent) LockTimeout(timeout time.Duration) bool {
+	expire := time.Now().Add(timeout)
+	for {
+		if qga.mutex.TryLock() {
+			return true
+		}
+		if time.Now().After(expire) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func (qga *QemuGuestAgent) Unlock() {
+	qga.mutex.Unlock()
+}
+
+func (qga *QemuGuestAgent) Close() error {
+	if qga.rwc == nil {
+		return nil
+	}
+	err := qga.rwc.Close()
+	qga.rwc = nil
+	qga.reader = nil
+	return err
+}
+
+func (qga *QemuGuestAgent) write(cmd []byte) error {
+	log.Debugf("QGA Write %s: %s", qga.id, string(cmd))
+	length, index := len(cmd), 0
+	for index < length {
+		i, err := qga.rwc.Write(cmd[index:])
+		if err != nil {
+			return err
+		}
+		index += i
+	}
+	return nil
+}
+
+func (qga *QemuGuestAgent) readResponse(timeout time.Duration) (*Response, error) {
+	qga.rwc.SetReadDeadline(time.Now().Add(timeout))
+	defer qga.rwc.SetReadDeadline(time.Time{})
+
+	line, err := qga.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "read qga response")
+	}
+	log.Debugf("QGA Read %s: %s", qga.id, string(line))
+
+	var objmap map[string]*json.RawMessage
+	if err := json.Unmarshal(line, &objmap); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal qga response %s", string(line))
+	}
+	res := &Response{}
+	if val, ok := objmap["error"]; ok && val != nil {
+		res.ErrorVal = &Error{}
+		json.Unmarshal(*val, res.ErrorVal)
+	} else if val, ok := objmap["return"]; ok && val != nil {
+		res.Return = []byte(*val)
+	}
+	return res, nil
+}
+
+// sync discards stale data left in the channel and makes sure the agent
+// in guest is alive before sending the real command.
+func (qga *QemuGuestAgent) sync(timeout time.Duration) error {
+	id := rand.Int63n(1 << 31)
+	cmd := &Command{
+		Execute: "guest-sync-delimited",
+		Args:    map[string]interface{}{"id": id},
+	}
+	c, _ := json.Marshal(cmd)
+	if err := qga.write(c); err != nil {
+		return errors.Wrap(err, "write guest-sync-delimited")
+	}
+
+	qga.rwc.SetReadDeadline(time.Now().Add(timeout))
+	_, err := qga.reader.ReadBytes(qgaSyncDelimiter)
+	qga.rwc.SetReadDeadline(time.Time{})
+	if err != nil {
+		return errors.Wrap(err, "wait qga sync delimiter")
+	}
+	res, err := qga.readResponse(timeout)
+	if err != nil {
+		return err
+	}
+	if res.ErrorVal != nil {
+		return res.ErrorVal
+	}
+	var retId int64
+	if err := json.Unmarshal(res.Return, &retId); err != nil {
+		return errors.Wrapf(err, "unmarshal guest-sync-delimited return %s", res.Return)
+	}
+	if retId != id {
+		return errors.Errorf("guest-sync-delimited id mismatch, expect %d got %d", id, retId)
+	}
+	return nil
+}
+
+func (qga *QemuGuestAgent) execCmd(cmd *Command, expectResp bool, timeout time.Duration) ([]byte, error) {
+	if qga.rwc == nil {
+		if err := qga.connect(); err != nil {
+			return nil, err
+		}
+	}
+	if timeout <= 0 {
+		timeout = qga.commandTimeout
+	}
+	if err := qga.sync(timeout); err != nil {
+		// the socket may be stale after guest reboot, reconnect next time
+		qga.Close()
+		return nil, errors.Wrap(err, "qga sync")
+	}
+
+	c, _ := json.Marshal(cmd)
+	if err := qga.write(c); err != nil {
+		qga.Close()
+		return nil, errors.Wrapf(err, "write %s", cmd.Execute)
+	}
+	if !expectResp {
+		return nil, nil
+	}
+	res, err := qga.readResponse(timeout)
+	if err != nil {
+		qga.Close()
+		return nil, errors.Wrapf(err, "read %s response", cmd.Execute)
+	}
+	if res.ErrorVal != nil {
+		return nil, errors.Wrap(res.ErrorVal, cmd.Execute)
+	}
+	return res.Return, nil
+}
+
+func (qga *QemuGuestAgent) exec(cmd *Command, ret interface{}) error {
+	res, err := qga.execCmd(cmd, true, -1)
+	if err != nil {
+		return err
+	}
+	if ret == nil {
+		return nil
+	}
+	if err := json.Unmarshal(res, ret); err != nil {
+		return errors.Wrapf(err, "unmarshal %s return %s", cmd.Execute, res)
+	}
+	return nil
+}
+
+func (qga *QemuGuestAgent) GuestPing(timeout int) error {
+	cmd := &Command{Execute: "guest-ping"}
+	_, err := qga.execCmd(cmd, true, time.Duration(timeout)*time.Second)
+	return err
+}
+
+func (qga *QemuGuestAgent) GuestSetUserPassword(username, password string, crypted bool) error {
+	cmd := &Command{
+		Execute: "guest-set-user-password",
+		Args: map[string]interface{}{
+			"username": username,
+			"password": base64.StdEncoding.EncodeToString([]byte(password)),
+			"crypted":  crypted,
+		},
+	}
+	return qga.exec(cmd, nil)
+}
+
+// GuestFsfreezeFreeze returns the number of frozen filesystems
+func (qga *QemuGuestAgent) GuestFsfreezeFreeze() (int, error) {
+	var count int
+	err := qga.exec(&Command{Execute: "guest-fsfreeze-freeze"}, &count)
+	return count, err
+}
+
+// GuestFsfreezeThaw returns the number of thawed filesystems
+func (qga *QemuGuestAgent) GuestFsfreezeThaw() (int, error) {
+	var count int
+	err := qga.exec(&Command{Execute: "guest-fsfreeze-thaw"}, &count)
+	return count, err
+}
+
+// GuestFsfreezeStatus returns thawed or frozen
+func (qga *QemuGuestAgent) GuestFsfreezeStatus() (string, error) {
+	var status string
+	err := qga.exec(&Command{Execute: "guest-fsfreeze-status"}, &status)
+	return status, err
+}
+
+func (qga *QemuGuestAgent) GuestExec(path string, args, env []string, input string, captureOutput bool) (*GuestExecCommandResp, error) {
+	qgaArgs := map[string]interface{}{
+		"path":           path,
+		"capture-output": captureOutput,
+	}
+	if len(args) > 0 {
+		qgaArgs["arg"] = args
+	}
+	if len(env) > 0 {
+		qgaArgs["env"] = env
+	}
+	if len(input) > 0 {
+		qgaArgs["input-data"] = base64.StdEncoding.EncodeToString([]byte(input))
+	}
+	cmd := &Command{
+		Execute: "guest-exec",
+		Args:    qgaArgs,
+	}
+	resp := new(GuestExecCommandResp)
+	if err := qga.exec(cmd, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GuestExecStatus fetches status of process started by GuestExec,
+// out-data and err-data are decoded from base64
+func (qga *QemuGuestAgent) GuestExecStatus(pid int) (*GuestExecStatusResp, error) {
+	cmd := &Command{
+		Execute: "guest-exec-status",
+		Args:    map[string]interface{}{"pid": pid},
+	}
+	resp := new(GuestExecStatusResp)
+	if err := qga.exec(cmd, resp); err != nil {
+		return nil, err
+	}
+	for _, data := range []*string{&resp.OutData, &resp.ErrData} {
+		if len(*data) == 0 {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(*data)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode exec output")
+		}
+		*data = string(decoded)
+	}
+	return resp, nil
+}
+
+func (qga *QemuGuestAgent) GuestNetworkGetInterfaces() ([]GuestNetworkInterface, error) {
+	ifaces := []GuestNetworkInterface{}
+	err := qga.exec(&Command{Execute: "guest-network-get-interfaces"}, &ifaces)
+	if err != nil {
+		return nil, err
+	}
+	return ifaces, nil
+}
+
+func (qga *QemuGuestAgent) GuestGetOsInfo() (*GuestOsInfo, error) {
+	info := new(GuestOsInfo)
+	if err := qga.exec(&Command{Execute: "guest-get-osinfo"}, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"testing"
+)
+
+func fakeQgaServer(t *testing.T, sockPath string, replies map[string]string) net.Listener {
+	l, err := net.Listen("unix", sockPath)
+	if err != nil {
+		t.Fatalf("listen %s: %s", sockPath, err)
+	}
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// stale data from previous session must be skipped by client
+		conn.Write([]byte(`{"return": "stale"}` + "\n"))
+		dec := json.NewDecoder(bufio.NewReader(conn))
+		for {
+			cmd := struct {
+				Execute string                 `json:"execute"`
+				Args    map[string]interface{} `json:"arguments"`
+			}{}
+			if err := dec.Decode(&cmd); err != nil {
+				return
+			}
+			if cmd.Execute == "guest-sync-delimited" {
+				conn.Write([]byte{qgaSyncDelimiter})
+				conn.Write([]byte(fmt.Sprintf(`{"return": %d}`+"\n", int64(cmd.Args["id"].(float64)))))
+				continue
+			}
+			reply, ok := replies[cmd.Execute]
+			if !ok {
+				reply = `{"error": {"class": "CommandNotFound", "desc": "not found"}}`
+			}
+			conn.Write([]byte(reply + "\n"))
+		}
+	}()
+	return l
+}
+
+func TestQemuGuestAgent(t *testing.T) {
+	sockPath := path.Join(t.TempDir(), "qga.sock")
+	l := fakeQgaServer(t, sockPath, map[string]string{
+		"guest-ping":              `{"return": {}}`,
+		"guest-fsfreeze-freeze":   `{"return": 2}`,
+		"guest-fsfreeze-status":   `{"return": "frozen"}`,
+		"guest-exec":              `{"return": {"pid": 1024}}`,
+		"guest-exec-status":       `{"return": {"exited": true, "exitcode": 0, "out-data": "aGVsbG8K"}}`,
+		"guest-get-osinfo":        `{"return": {"id": "centos", "version-id": "7", "kernel-release": "3.10.0"}}`,
+		"guest-set-user-password": `{"return": {}}`,
+	})
+	defer l.Close()
+
+	qga, err := NewQemuGuestAgent("test", sockPath)
+	if err != nil {
+		t.Fatalf("NewQemuGuestAgent: %s", err)
+	}
+	defer qga.Close()
+
+	if err := qga.GuestPing(1); err != nil {
+		t.Fatalf("GuestPing: %s", err)
+	}
+	if cnt, err := qga.GuestFsfreezeFreeze(); err != nil || cnt != 2 {
+		t.Fatalf("GuestFsfreezeFreeze got %d %v", cnt, err)
+	}
+	if status, err := qga.GuestFsfreezeStatus(); err != nil || status != "frozen" {
+		t.Fatalf("GuestFsfreezeStatus got %s %v", status, err)
+	}
+	execResp, err := qga.GuestExec("/bin/echo", []string{"hello"}, nil, "", true)
+	if err != nil || execResp.Pid != 1024 {
+		t.Fatalf("GuestExec got %#v %v", execResp, err)
+	}
+	status, err := qga.GuestExecStatus(execResp.Pid)
+	if err != nil || !status.Exited || status.OutData != "hello\n" {
+		t.Fatalf("GuestExecStatus got %#v %v", status, err)
+	}
+	info, err := qga.GuestGetOsInfo()
+	if err != nil || info.Id != "centos" || info.KernelRelease != "3.10.0" {
+		t.Fatalf("GuestGetOsInfo got %#v %v", info, err)
+	}
+	if err := qga.GuestSetUserPassword("root", "123@abc", false); err != nil {
+		t.Fatalf("GuestSetUserPassword: %s", err)
+	}
+	if _, err := qga.GuestNetworkGetInterfaces(); err == nil {
+		t.Fatalf("GuestNetworkGetInterfaces should return error")
+	}
+}
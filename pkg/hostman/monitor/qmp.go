@@ -879,6 +879,70 @@ func (m *QmpMonitor) DriveMirror(callback StringCallback, drive, target, syncMod
 	m.Query(cmd, cb)
 }
 
+// DriveBackup starts a backup job of drive to the existing image target.
+// A full copy is made if bitmap is empty, otherwise only the clusters
+// recorded in bitmap are copied and bitmap is left untouched. If newBitmap
+// is not empty, a persistent dirty bitmap is added in the same transaction
+// so that it tracks the writes since this backup.
+func (m *QmpMonitor) DriveBackup(drive, target, format, bitmap, newBitmap string, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		backupArgs = map[string]interface{}{
+			"device": drive,
+			"job-id": drive,
+			"target": target,
+			"format": format,
+			"mode":   "existing",
+			"sync":   "full",
+		}
+	)
+	if len(bitmap) > 0 {
+		backupArgs["sync"] = "bitmap"
+		backupArgs["bitmap"] = bitmap
+		backupArgs["bitmap-mode"] = "never"
+	}
+	actions := []map[string]interface{}{}
+	if len(newBitmap) > 0 {
+		actions = append(actions, map[string]interface{}{
+			"type": "block-dirty-bitmap-add",
+			"data": map[string]interface{}{
+				"node":       drive,
+				"name":       newBitmap,
+				"persistent": true,
+			},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"type": "drive-backup",
+		"data": backupArgs,
+	})
+	cmd := &Command{
+		Execute: "transaction",
+		Args: map[string]interface{}{
+			"actions": actions,
+		},
+	}
+	m.Query(cmd, cb)
+}
+
+func (m *QmpMonitor) BlockDirtyBitmapRemove(drive, name string, callback StringCallback) {
+	var (
+		cb = func(res *Response) {
+			callback(m.actionResult(res))
+		}
+		cmd = &Command{
+			Execute: "block-dirty-bitmap-remove",
+			Args: map[string]interface{}{
+				"node": drive,
+				"name": name,
+			},
+		}
+	)
+	m.Query(cmd, cb)
+}
+
 func (m *QmpMonitor) BlockStream(drive string, idx, blkCnt int, callback StringCallback) {
 	var (
 		speed = 5 * 100 * 1024 * 1024 // limit 500 MB/s
@@ -18,6 +18,7 @@ import (
 	"testing"
 	"time"
 
+	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 )
 
@@ -43,3 +44,30 @@ func TestQmpMonitor_Connect(t *testing.T) {
 	m.Disconnect()
 	time.Sleep(3 * time.Second)
 }
+
+func TestQemuBlockGetDirtyBitmap(t *testing.T) {
+	ret := `[{"device":"drive_0","io-status":"ok","inserted":{"file":"/opt/cloud/workspace/disks/d0","dirty-bitmaps":[{"name":"backup-a","recording":true,"persistent":true,"count":65536,"granularity":65536},{"name":"backup-b","inconsistent":true}]}},{"device":"drive_1","dirty-bitmaps":[{"name":"backup-c","count":0}]}]`
+	jr, err := jsonutils.ParseString(ret)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	blocks := []QemuBlock{}
+	if err := jr.Unmarshal(&blocks); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expect 2 blocks, got %d", len(blocks))
+	}
+	if bitmap := blocks[0].GetDirtyBitmap("backup-a"); bitmap == nil || !bitmap.Persistent || bitmap.Count != 65536 {
+		t.Errorf("backup-a: %#v", bitmap)
+	}
+	if bitmap := blocks[0].GetDirtyBitmap("backup-b"); bitmap != nil {
+		t.Errorf("inconsistent bitmap should not be returned")
+	}
+	if bitmap := blocks[1].GetDirtyBitmap("backup-c"); bitmap == nil {
+		t.Errorf("backup-c of qemu before 4.2 not found")
+	}
+	if bitmap := blocks[1].GetDirtyBitmap("backup-a"); bitmap != nil {
+		t.Errorf("unexpected backup-a of drive_1")
+	}
+}
@@ -55,6 +55,8 @@ type SHostOptions struct {
 	AgentTempPath  string `help:"Path for ESXi agent"`
 	AgentTempLimit int    `help:"Maximal storage space for ESXi agent, in GB" default:"10"`
 
+	RequireSignedImages bool `help:"Refuse to cache images without a signature verified by the trusted image signing keys" default:"false"`
+
 	RecycleDiskfile         bool `help:"Recycle instead of remove deleted disk file" default:"true"`
 	RecycleDiskfileKeepDays int  `help:"How long recycled files kept, default 28 days" default:"28"`
 	AlwaysRecycleDiskfile   bool `help:"Always recycle disk files, no matter what" default:"true"`
@@ -184,6 +186,7 @@ type SHostOptions struct {
 	LocalBackupTempPath    string `help:"the local temporary directory for backup" default:"/opt/cloud/workspace/run/backups"`
 
 	BinaryMemcleanPath string `help:"execute binary memclean path" default:"/opt/yunion/bin/memclean"`
+	BinarySwtpmPath    string `help:"execute binary swtpm path" default:"/usr/bin/swtpm"`
 
 	MaxHotplugVCpuCount int `help:"maximal possible vCPU count that the platform kvm supports"`
 }
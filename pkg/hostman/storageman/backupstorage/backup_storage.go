@@ -40,6 +40,9 @@ type IBackupStorage interface {
 var backupStoragePool *sync.Map = &sync.Map{}
 
 func NewBackupStorage(backupStroageId string, backupStorageAccessInfo *jsonutils.JSONDict) (IBackupStorage, error) {
+	if backupStorageAccessInfo.Contains("object_bucket_url") {
+		return newObjectBackupStorage(backupStroageId, backupStorageAccessInfo)
+	}
 	nfsHost, err := backupStorageAccessInfo.GetString("nfs_host")
 	if err != nil {
 		return nil, fmt.Errorf("need nfs_host in backup_storage_access_info")
@@ -51,6 +54,20 @@ func NewBackupStorage(backupStroageId string, backupStorageAccessInfo *jsonutils
 	return NewNFSBackupStorage(backupStroageId, nfsHost, nfsSharedDir), nil
 }
 
+func newObjectBackupStorage(backupStroageId string, backupStorageAccessInfo *jsonutils.JSONDict) (IBackupStorage, error) {
+	bucketUrl, _ := backupStorageAccessInfo.GetString("object_bucket_url")
+	accessKey, err := backupStorageAccessInfo.GetString("object_access_key")
+	if err != nil {
+		return nil, fmt.Errorf("need object_access_key in backup_storage_access_info")
+	}
+	secret, err := backupStorageAccessInfo.GetString("object_secret")
+	if err != nil {
+		return nil, fmt.Errorf("need object_secret in backup_storage_access_info")
+	}
+	insecure := jsonutils.QueryBoolean(backupStorageAccessInfo, "object_insecure_skip_verify", false)
+	return NewObjectBackupStorage(backupStroageId, bucketUrl, accessKey, secret, insecure)
+}
+
 func GetBackupStorage(backupStroageId string, backupStorageAccessInfo *jsonutils.JSONDict) (IBackupStorage, error) {
 	bs, err := NewBackupStorage(backupStroageId, backupStorageAccessInfo)
 	if err != nil {
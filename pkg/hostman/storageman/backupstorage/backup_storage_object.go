@@ -0,0 +1,556 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupstorage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+	"yunion.io/x/onecloud/pkg/util/procutils"
+	"yunion.io/x/onecloud/pkg/util/qemuimg"
+	"yunion.io/x/onecloud/pkg/util/qemutils"
+)
+
+const (
+	// objectPartSize is the size of the first parts of a multipart upload,
+	// parts grow every objectPartSizeStep parts so that an object of
+	// unknown length can still exceed 1TB within the 10000 parts limit
+	objectPartSize     = 64 * 1024 * 1024
+	objectPartSizeStep = 2000
+	objectMaxParts     = 10000
+
+	objectPresignExpires = 24 * time.Hour
+)
+
+type SObjectBackupStorage struct {
+	BackupStorageId string
+	BucketUrl       string
+	AccessKey       string
+	Secret          string
+
+	endpoint string
+	secure   bool
+	// skip verifying TLS certificate, only set explicitly by storage option
+	insecure bool
+	bucket   string
+	prefix   string
+	client   *s3cli.Client
+}
+
+// NewObjectBackupStorage creates backup storage backed by a bucket of s3
+// compatible object storage, bucketUrl is in the form of
+// http(s)://<endpoint>/<bucket>[/<prefix>]
+func NewObjectBackupStorage(backupStorageId, bucketUrl, accessKey, secret string, insecure bool) (*SObjectBackupStorage, error) {
+	parts, err := url.Parse(bucketUrl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse bucket url %s", bucketUrl)
+	}
+	segs := strings.SplitN(strings.Trim(parts.Path, "/"), "/", 2)
+	if len(parts.Host) == 0 || len(segs[0]) == 0 {
+		return nil, errors.Errorf("invalid bucket url %s", bucketUrl)
+	}
+	s := &SObjectBackupStorage{
+		BackupStorageId: backupStorageId,
+		BucketUrl:       bucketUrl,
+		AccessKey:       accessKey,
+		Secret:          secret,
+		endpoint:        parts.Host,
+		secure:          parts.Scheme == "https",
+		insecure:        insecure,
+		bucket:          segs[0],
+	}
+	if len(segs) > 1 {
+		s.prefix = segs[1]
+	}
+	cli, err := s3cli.New(s.endpoint, accessKey, secret, s.secure, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "s3cli.New")
+	}
+	cli.SetCustomTransport(httputils.GetTransport(insecure))
+	s.client = cli
+	return s, nil
+}
+
+func (s *SObjectBackupStorage) getBackupKey(backupId string) string {
+	return path.Join(s.prefix, "backups", backupId)
+}
+
+func (s *SObjectBackupStorage) getPackageKey(packageName string) string {
+	return path.Join(s.prefix, "backuppacks", packageName+".tar")
+}
+
+func isObjectNotFound(err error) bool {
+	code := s3cli.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *SObjectBackupStorage) statObject(key string) (*s3cli.ObjectInfo, error) {
+	info, err := s.client.StatObject(s.bucket, key, s3cli.StatObjectOptions{})
+	if err != nil {
+		if isObjectNotFound(err) {
+			return nil, errors.Wrapf(errors.ErrNotFound, "object %s", key)
+		}
+		return nil, errors.Wrapf(err, "StatObject %s", key)
+	}
+	return &info, nil
+}
+
+// putObjectStream uploads reader of unknown length with multipart upload,
+// only one part is kept in memory at a time
+func (s *SObjectBackupStorage) putObjectStream(ctx context.Context, key string, reader io.Reader) (int64, error) {
+	initResult, err := s.client.InitiateMultipartUpload(ctx, s.bucket, key, s3cli.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "InitiateMultipartUpload %s", key)
+	}
+	uploadId := initResult.UploadID
+
+	var (
+		total    int64
+		complete s3cli.CompleteMultipartUpload
+		buf      []byte
+	)
+	err = func() error {
+		for partNumber := 1; ; partNumber++ {
+			if partNumber > objectMaxParts {
+				return errors.Errorf("object %s exceeds %d parts", key, objectMaxParts)
+			}
+			partSize := objectPartSize * (1 + (partNumber-1)/objectPartSizeStep)
+			if len(buf) != partSize {
+				buf = make([]byte, partSize)
+			}
+			n, err := io.ReadFull(reader, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return errors.Wrap(err, "read part")
+			}
+			// an empty object still needs one part to be completed
+			if n == 0 && partNumber > 1 {
+				return nil
+			}
+			sum := md5.Sum(buf[:n])
+			part, perr := s.client.UploadPart(ctx, s.bucket, key, uploadId, bytes.NewReader(buf[:n]),
+				partNumber, base64.StdEncoding.EncodeToString(sum[:]), "", int64(n), nil)
+			if perr != nil {
+				return errors.Wrapf(perr, "UploadPart %d of %s", partNumber, key)
+			}
+			complete.Parts = append(complete.Parts, s3cli.CompletePart{
+				PartNumber: part.PartNumber,
+				ETag:       part.ETag,
+			})
+			total += int64(n)
+			if err != nil {
+				// short read, reader reaches EOF
+				return nil
+			}
+		}
+	}()
+	if err != nil {
+		if aerr := s.client.AbortMultipartUpload(context.Background(), s.bucket, key, uploadId); aerr != nil {
+			log.Errorf("AbortMultipartUpload %s %s fail: %s", key, uploadId, aerr)
+		}
+		return 0, err
+	}
+	_, err = s.client.CompleteMultipartUpload(ctx, s.bucket, key, uploadId, complete)
+	if err != nil {
+		return 0, errors.Wrapf(err, "CompleteMultipartUpload %s", key)
+	}
+	return total, nil
+}
+
+func (s *SObjectBackupStorage) putFile(ctx context.Context, key string, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", filename)
+	}
+	defer f.Close()
+	_, err = s.putObjectStream(ctx, key, f)
+	return err
+}
+
+func (s *SObjectBackupStorage) getFile(key string, filename string) error {
+	obj, err := s.client.GetObject(s.bucket, key, s3cli.GetObjectOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "GetObject %s", key)
+	}
+	defer obj.Close()
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "open %s", filename)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, obj); err != nil {
+		os.Remove(filename)
+		return errors.Wrapf(err, "download %s to %s", key, filename)
+	}
+	return nil
+}
+
+func (s *SObjectBackupStorage) CopyBackupFrom(srcFilename string, backupId string) error {
+	return s.putFile(context.Background(), s.getBackupKey(backupId), srcFilename)
+}
+
+func (s *SObjectBackupStorage) CopyBackupTo(targetFilename string, backupId string) error {
+	if _, err := s.statObject(s.getBackupKey(backupId)); err != nil {
+		return err
+	}
+	return s.getFile(s.getBackupKey(backupId), targetFilename)
+}
+
+// InstancePack streams the backups of an instance into a tar object, the
+// layout of the tar is the same as nfs backup storage, but metadata is put
+// first so that unpacking metadata only does not read through the disks
+func (s *SObjectBackupStorage) InstancePack(ctx context.Context, packageName string, backupIds []string, metadata *api.InstanceBackupPackMetadata) (string, error) {
+	backupSizes := make([]int64, len(backupIds))
+	for i, backupId := range backupIds {
+		info, err := s.statObject(s.getBackupKey(backupId))
+		if err != nil {
+			return "", err
+		}
+		backupSizes[i] = info.Size
+	}
+
+	lockman.LockRawObject(ctx, "package", packageName)
+	defer lockman.ReleaseRawObject(ctx, "package", packageName)
+
+	// find the object name
+	tried := 0
+	packageKey := s.getPackageKey(packageName)
+	for {
+		_, err := s.statObject(packageKey)
+		if errors.Cause(err) == errors.ErrNotFound {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		tried++
+		packageKey = s.getPackageKey(fmt.Sprintf("%s-%d", packageName, tried))
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.writePackage(pw, packageName, backupIds, backupSizes, metadata))
+	}()
+	_, err := s.putObjectStream(ctx, packageKey, pr)
+	// unblock the writer if upload fails
+	pr.CloseWithError(err)
+	if err != nil {
+		return "", errors.Wrapf(err, "upload package %s", packageKey)
+	}
+	return packageKey, nil
+}
+
+func (s *SObjectBackupStorage) writePackage(w io.Writer, packageName string, backupIds []string, backupSizes []int64, metadata *api.InstanceBackupPackMetadata) error {
+	now := time.Now()
+	tw := tar.NewWriter(w)
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     packageName + "/",
+		Mode:     0755,
+		ModTime:  now,
+	})
+	if err != nil {
+		return errors.Wrap(err, "write package dir header")
+	}
+	metadataBytes := []byte(jsonutils.Marshal(metadata).PrettyString())
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path.Join(packageName, PackageMetadataFilename),
+		Mode:     0644,
+		Size:     int64(len(metadataBytes)),
+		ModTime:  now,
+	})
+	if err != nil {
+		return errors.Wrap(err, "write metadata header")
+	}
+	if _, err := tw.Write(metadataBytes); err != nil {
+		return errors.Wrap(err, "write metadata")
+	}
+	for i, backupId := range backupIds {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(packageName, fmt.Sprintf("%s_%d", PackageDiskFilename, i)),
+			Mode:     0644,
+			Size:     backupSizes[i],
+			ModTime:  now,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "write disk %d header", i)
+		}
+		err = func() error {
+			obj, err := s.client.GetObject(s.bucket, s.getBackupKey(backupId), s3cli.GetObjectOptions{})
+			if err != nil {
+				return errors.Wrapf(err, "GetObject %s", backupId)
+			}
+			defer obj.Close()
+			if _, err := io.Copy(tw, obj); err != nil {
+				return errors.Wrapf(err, "copy backup %s", backupId)
+			}
+			return nil
+		}()
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func (s *SObjectBackupStorage) InstanceUnpack(ctx context.Context, packageName string, metadataOnly bool) ([]string, *api.InstanceBackupPackMetadata, error) {
+	if strings.HasSuffix(packageName, ".tar") {
+		// remove suffix
+		packageName = packageName[:len(packageName)-4]
+	}
+	packageKey := s.getPackageKey(packageName)
+	if _, err := s.statObject(packageKey); err != nil {
+		return nil, nil, errors.Wrapf(err, "package %s", packageName)
+	}
+	obj, err := s.client.GetObject(s.bucket, packageKey, s3cli.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "GetObject %s", packageKey)
+	}
+	defer obj.Close()
+
+	var metadata *api.InstanceBackupPackMetadata
+	diskBackupIds := make(map[int]string)
+	tr := tar.NewReader(obj)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.removeBackups(diskBackupIds)
+			return nil, nil, errors.Wrap(err, "read package")
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Base(hdr.Name)
+		if name == PackageMetadataFilename {
+			metadataBytes, err := ioutil.ReadAll(tr)
+			if err != nil {
+				s.removeBackups(diskBackupIds)
+				return nil, nil, errors.Wrap(err, "unable to read metadata file")
+			}
+			metadataJson, err := jsonutils.Parse(metadataBytes)
+			if err != nil {
+				s.removeBackups(diskBackupIds)
+				return nil, nil, errors.Wrap(err, "unable to parse string to json")
+			}
+			metadata = &api.InstanceBackupPackMetadata{}
+			if err := metadataJson.Unmarshal(metadata); err != nil {
+				s.removeBackups(diskBackupIds)
+				return nil, nil, errors.Wrap(err, "unmarshal backup metadata")
+			}
+			if metadataOnly {
+				break
+			}
+			continue
+		}
+		if metadataOnly || !strings.HasPrefix(name, PackageDiskFilename+"_") {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimPrefix(name, PackageDiskFilename+"_"))
+		if err != nil {
+			log.Warningf("skip unknown file %s in package %s", hdr.Name, packageName)
+			continue
+		}
+		backupId := db.DefaultUUIDGenerator()
+		if _, err := s.putObjectStream(ctx, s.getBackupKey(backupId), tr); err != nil {
+			s.removeBackups(diskBackupIds)
+			return nil, nil, errors.Wrapf(err, "unpack disk %d", idx)
+		}
+		diskBackupIds[idx] = backupId
+	}
+	if metadata == nil {
+		s.removeBackups(diskBackupIds)
+		return nil, nil, errors.Wrapf(errors.ErrNotFound, "metadata of package %s", packageName)
+	}
+	backupIds := make([]string, len(metadata.DiskMetadatas))
+	if !metadataOnly {
+		for i := range backupIds {
+			backupId, ok := diskBackupIds[i]
+			if !ok {
+				s.removeBackups(diskBackupIds)
+				return nil, nil, errors.Wrapf(errors.ErrNotFound, "disk %d of package %s", i, packageName)
+			}
+			backupIds[i] = backupId
+		}
+	}
+	return backupIds, metadata, nil
+}
+
+func (s *SObjectBackupStorage) removeBackups(backupIds map[int]string) {
+	for _, backupId := range backupIds {
+		if err := s.RemoveBackup(backupId); err != nil {
+			log.Errorf("remove backup %s fail: %s", backupId, err)
+		}
+	}
+}
+
+// ConvertFrom converts the source image to a qcow2 object. qemu-img can not
+// write qcow2 to a pipe, so the source is exported read only by qemu-nbd and
+// the qcow2 image is generated sequentially from the allocated clusters and
+// uploaded with multipart upload, nothing is staged on local disk
+func (s *SObjectBackupStorage) ConvertFrom(srcPath string, format qemuimg.TImageFormat, backupId string) (int, error) {
+	srcImg, err := qemuimg.NewQemuImage(srcPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "NewQemuImage %s", srcPath)
+	}
+	srcImg.Format = format
+	extents, err := srcImg.Map()
+	if err != nil {
+		return 0, errors.Wrapf(err, "map %s", srcPath)
+	}
+
+	sockDir, err := ioutil.TempDir(options.HostOptions.LocalBackupTempPath, "nbd")
+	if err != nil {
+		return 0, errors.Wrap(err, "create tempdir")
+	}
+	defer func() {
+		if output, err := procutils.NewCommand("rm", "-rf", sockDir).Output(); err != nil {
+			log.Errorf("unable to rm %s: %s", sockDir, output)
+		}
+	}()
+	sockPath := path.Join(sockDir, "nbd.sock")
+	nbd := procutils.NewRemoteCommandAsFarAsPossible(qemutils.GetQemuNbd(), "-r", "-f", format.String(), "-k", sockPath, srcPath)
+	err = nbd.Start()
+	if err != nil {
+		return 0, errors.Wrap(err, "start qemu-nbd")
+	}
+	defer func() {
+		// qemu-nbd exits when the client disconnects
+		nbd.Kill()
+		nbd.Wait()
+	}()
+	cli, err := dialNbd(sockPath, 30*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer cli.Close()
+
+	stream := newQcow2Stream(cli.size, allocatedClusterRuns(extents))
+	reader, writer := io.Pipe()
+	writeDone := make(chan struct{})
+	go func() {
+		defer close(writeDone)
+		writer.CloseWithError(stream.WriteTo(writer, cli))
+	}()
+	size, err := s.putObjectStream(context.Background(), s.getBackupKey(backupId), reader)
+	// unblock the writer if upload fails halfway
+	reader.CloseWithError(io.ErrClosedPipe)
+	<-writeDone
+	if err != nil {
+		return 0, errors.Wrap(err, "upload backup")
+	}
+	return int(size / 1024 / 1024), nil
+}
+
+// getQemuSourcePath returns the qemu json filename reading the object over
+// presigned url by curl block driver, so the backup is never downloaded
+func (s *SObjectBackupStorage) getQemuSourcePath(backupId string) (string, error) {
+	u, err := s.client.PresignedGetObject(s.bucket, s.getBackupKey(backupId), objectPresignExpires, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "PresignedGetObject")
+	}
+	file := jsonutils.NewDict()
+	file.Set("file.driver", jsonutils.NewString(u.Scheme))
+	file.Set("file.url", jsonutils.NewString(u.String()))
+	file.Set("file.sslverify", jsonutils.NewBool(!s.insecure))
+	file.Set("file.timeout", jsonutils.NewInt(60))
+	return "json:" + file.String(), nil
+}
+
+func (s *SObjectBackupStorage) ConvertTo(destPath string, format qemuimg.TImageFormat, backupId string) error {
+	if _, err := s.statObject(s.getBackupKey(backupId)); err != nil {
+		return err
+	}
+	srcPath, err := s.getQemuSourcePath(backupId)
+	if err != nil {
+		return err
+	}
+	srcInfo := qemuimg.SImageInfo{
+		Path:     srcPath,
+		Format:   qemuimg.QCOW2,
+		IoLevel:  qemuimg.IONiceNone,
+		Password: "",
+	}
+	destInfo := qemuimg.SImageInfo{
+		Path:     destPath,
+		Format:   format,
+		IoLevel:  qemuimg.IONiceNone,
+		Password: "",
+	}
+	var workerOpts []string
+	if options.HostOptions.RestrictQemuImgConvertWorker {
+		workerOpts = nil
+	} else {
+		workerOpts = []string{"-W", "-m", "16"}
+	}
+	return qemuimg.Convert(srcInfo, destInfo, false, workerOpts)
+}
+
+func (s *SObjectBackupStorage) RemoveBackup(backupId string) error {
+	err := s.client.RemoveObject(s.bucket, s.getBackupKey(backupId))
+	if err != nil && !isObjectNotFound(err) {
+		return errors.Wrapf(err, "RemoveObject %s", backupId)
+	}
+	return nil
+}
+
+func (s *SObjectBackupStorage) IsExists(backupId string) (bool, error) {
+	_, err := s.statObject(s.getBackupKey(backupId))
+	if errors.Cause(err) == errors.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *SObjectBackupStorage) IsOnline() (bool, string, error) {
+	exists, _, err := s.client.BucketExists(s.bucket)
+	if err != nil {
+		return false, errors.Wrap(ErrorBackupStorageOffline, err.Error()).Error(), nil
+	}
+	if !exists {
+		return false, fmt.Sprintf("bucket %s not found", s.bucket), nil
+	}
+	return true, "", nil
+}
@@ -0,0 +1,416 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupstorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/util/qemuimg"
+)
+
+const (
+	nbdMagic              = 0x4e42444d41474943 // NBDMAGIC
+	nbdOptMagic           = 0x49484156454f5054 // IHAVEOPT
+	nbdRequestMagic       = 0x25609513
+	nbdSimpleReplyMagic   = 0x67446698
+	nbdFlagFixedNewstyle  = 1 << 0
+	nbdFlagNoZeroes       = 1 << 1
+	nbdOptExportName      = 1
+	nbdCmdRead            = 0
+	nbdCmdDisc            = 2
+	nbdExportNameZeroPads = 124
+
+	qcow2Magic             = 0x514649fb
+	qcow2Version           = 2
+	qcow2ClusterBits       = 16
+	qcow2ClusterSize       = 1 << qcow2ClusterBits
+	qcow2L2Entries         = qcow2ClusterSize / 8
+	qcow2RefcountsPerBlock = qcow2ClusterSize / 2
+	qcow2OflagCopied       = uint64(1) << 63
+
+	// qcow2ReadClusters is the max number of clusters read from nbd at a time
+	qcow2ReadClusters = 64
+)
+
+// sNbdClient reads the default export of qemu-nbd over unix socket with the
+// fixed newstyle handshake and simple replies
+type sNbdClient struct {
+	conn   net.Conn
+	size   int64
+	handle uint64
+}
+
+func dialNbd(sockPath string, timeout time.Duration) (*sNbdClient, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	// qemu-nbd creates the socket a while after started
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(time.Second) {
+		conn, err = net.Dial("unix", sockPath)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "dial nbd %s", sockPath)
+	}
+	cli := &sNbdClient{conn: conn}
+	err = cli.handshake()
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "nbd handshake")
+	}
+	return cli, nil
+}
+
+func (cli *sNbdClient) handshake() error {
+	var server struct {
+		Magic    uint64
+		OptMagic uint64
+		Flags    uint16
+	}
+	if err := binary.Read(cli.conn, binary.BigEndian, &server); err != nil {
+		return errors.Wrap(err, "read server handshake")
+	}
+	if server.Magic != nbdMagic || server.OptMagic != nbdOptMagic {
+		return errors.Errorf("unexpected magic %x %x", server.Magic, server.OptMagic)
+	}
+	if server.Flags&nbdFlagFixedNewstyle == 0 {
+		return errors.Errorf("server does not support fixed newstyle")
+	}
+	clientFlags := uint32(nbdFlagFixedNewstyle)
+	noZeroes := server.Flags&nbdFlagNoZeroes != 0
+	if noZeroes {
+		clientFlags |= nbdFlagNoZeroes
+	}
+	if err := binary.Write(cli.conn, binary.BigEndian, clientFlags); err != nil {
+		return errors.Wrap(err, "write client flags")
+	}
+	opt := struct {
+		Magic  uint64
+		Option uint32
+		Length uint32
+	}{nbdOptMagic, nbdOptExportName, 0}
+	if err := binary.Write(cli.conn, binary.BigEndian, &opt); err != nil {
+		return errors.Wrap(err, "write export name option")
+	}
+	var export struct {
+		Size  uint64
+		Flags uint16
+	}
+	if err := binary.Read(cli.conn, binary.BigEndian, &export); err != nil {
+		return errors.Wrap(err, "read export info")
+	}
+	if !noZeroes {
+		if _, err := io.ReadFull(cli.conn, make([]byte, nbdExportNameZeroPads)); err != nil {
+			return errors.Wrap(err, "read export zero pads")
+		}
+	}
+	cli.size = int64(export.Size)
+	return nil
+}
+
+func (cli *sNbdClient) request(cmd uint16, offset int64, length int) error {
+	cli.handle++
+	req := struct {
+		Magic  uint32
+		Flags  uint16
+		Type   uint16
+		Handle uint64
+		Offset uint64
+		Length uint32
+	}{nbdRequestMagic, 0, cmd, cli.handle, uint64(offset), uint32(length)}
+	return binary.Write(cli.conn, binary.BigEndian, &req)
+}
+
+func (cli *sNbdClient) ReadAt(p []byte, off int64) (int, error) {
+	if err := cli.request(nbdCmdRead, off, len(p)); err != nil {
+		return 0, errors.Wrap(err, "write read request")
+	}
+	var reply struct {
+		Magic  uint32
+		Error  uint32
+		Handle uint64
+	}
+	if err := binary.Read(cli.conn, binary.BigEndian, &reply); err != nil {
+		return 0, errors.Wrap(err, "read reply")
+	}
+	if reply.Magic != nbdSimpleReplyMagic || reply.Handle != cli.handle {
+		return 0, errors.Errorf("unexpected reply magic %x handle %d", reply.Magic, reply.Handle)
+	}
+	if reply.Error != 0 {
+		return 0, errors.Errorf("read %d bytes at %d error %d", len(p), off, reply.Error)
+	}
+	return io.ReadFull(cli.conn, p)
+}
+
+func (cli *sNbdClient) Close() error {
+	cli.request(nbdCmdDisc, 0, 0)
+	return cli.conn.Close()
+}
+
+// sClusterRun is a run of allocated guest clusters
+type sClusterRun struct {
+	start int64
+	count int64
+}
+
+// allocatedClusterRuns converts the extents reported by qemu-img map to
+// sorted runs of allocated clusters
+func allocatedClusterRuns(extents []qemuimg.SImageExtent) []sClusterRun {
+	runs := make([]sClusterRun, 0)
+	for _, ext := range extents {
+		if !ext.Data || ext.Zero || ext.Length <= 0 {
+			continue
+		}
+		start := ext.Start / qcow2ClusterSize
+		end := (ext.Start + ext.Length + qcow2ClusterSize - 1) / qcow2ClusterSize
+		if len(runs) > 0 {
+			last := &runs[len(runs)-1]
+			if start <= last.start+last.count {
+				if end > last.start+last.count {
+					last.count = end - last.start
+				}
+				continue
+			}
+		}
+		runs = append(runs, sClusterRun{start: start, count: end - start})
+	}
+	return runs
+}
+
+func divRoundUp(n, d int64) int64 {
+	return (n + d - 1) / d
+}
+
+// sQcow2Stream writes a qcow2 image sequentially. As the allocated clusters
+// are known beforehand, all metadata is laid out ahead of the data clusters:
+// header, refcount table, refcount blocks, L1 table, L2 tables, then the data
+// clusters in guest order, so nothing written needs to be updated later.
+type sQcow2Stream struct {
+	size int64
+	runs []sClusterRun
+
+	l1Size         int64
+	l2Tables       []int64
+	dataClusters   int64
+	refcountTable  int64
+	refcountBlocks int64
+	l1Clusters     int64
+	totalClusters  int64
+}
+
+func newQcow2Stream(size int64, runs []sClusterRun) *sQcow2Stream {
+	q := &sQcow2Stream{size: size, runs: runs}
+	q.l1Size = divRoundUp(size, qcow2ClusterSize*qcow2L2Entries)
+	q.l1Clusters = divRoundUp(q.l1Size*8, qcow2ClusterSize)
+	q.l2Tables = make([]int64, 0)
+	for _, run := range runs {
+		for idx := run.start / qcow2L2Entries; idx <= (run.start+run.count-1)/qcow2L2Entries; idx++ {
+			if len(q.l2Tables) == 0 || q.l2Tables[len(q.l2Tables)-1] != idx {
+				q.l2Tables = append(q.l2Tables, idx)
+			}
+		}
+		q.dataClusters += run.count
+	}
+	others := 1 + q.l1Clusters + int64(len(q.l2Tables)) + q.dataClusters
+	// refcount blocks count themselves and the refcount table
+	for {
+		total := others + q.refcountTable + q.refcountBlocks
+		blocks := divRoundUp(total, qcow2RefcountsPerBlock)
+		table := divRoundUp(blocks*8, qcow2ClusterSize)
+		if blocks == q.refcountBlocks && table == q.refcountTable {
+			break
+		}
+		q.refcountBlocks, q.refcountTable = blocks, table
+	}
+	q.totalClusters = others + q.refcountTable + q.refcountBlocks
+	return q
+}
+
+func (q *sQcow2Stream) refcountTableOffset() int64 {
+	return 1 * qcow2ClusterSize
+}
+
+func (q *sQcow2Stream) refcountBlockOffset() int64 {
+	return q.refcountTableOffset() + q.refcountTable*qcow2ClusterSize
+}
+
+func (q *sQcow2Stream) l1Offset() int64 {
+	return q.refcountBlockOffset() + q.refcountBlocks*qcow2ClusterSize
+}
+
+func (q *sQcow2Stream) l2Offset() int64 {
+	return q.l1Offset() + q.l1Clusters*qcow2ClusterSize
+}
+
+func (q *sQcow2Stream) dataOffset() int64 {
+	return q.l2Offset() + int64(len(q.l2Tables))*qcow2ClusterSize
+}
+
+func (q *sQcow2Stream) writeHeader(w io.Writer) error {
+	header := struct {
+		Magic                 uint32
+		Version               uint32
+		BackingFileOffset     uint64
+		BackingFileSize       uint32
+		ClusterBits           uint32
+		Size                  uint64
+		CryptMethod           uint32
+		L1Size                uint32
+		L1TableOffset         uint64
+		RefcountTableOffset   uint64
+		RefcountTableClusters uint32
+		NbSnapshots           uint32
+		SnapshotsOffset       uint64
+	}{
+		Magic:                 qcow2Magic,
+		Version:               qcow2Version,
+		ClusterBits:           qcow2ClusterBits,
+		Size:                  uint64(q.size),
+		L1Size:                uint32(q.l1Size),
+		L1TableOffset:         uint64(q.l1Offset()),
+		RefcountTableOffset:   uint64(q.refcountTableOffset()),
+		RefcountTableClusters: uint32(q.refcountTable),
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, qcow2ClusterSize))
+	if err := binary.Write(buf, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	buf.Write(make([]byte, qcow2ClusterSize-buf.Len()))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeTable writes entries as consecutive clusters of big endian integers,
+// put is called with the table buffer and the index of each entry
+func writeTable(w io.Writer, entries int64, entrySize int64, put func(buf []byte, idx int64)) error {
+	buf := make([]byte, qcow2ClusterSize)
+	perCluster := qcow2ClusterSize / entrySize
+	for base := int64(0); base < entries; base += perCluster {
+		for i := range buf {
+			buf[i] = 0
+		}
+		for i := int64(0); i < perCluster && base+i < entries; i++ {
+			put(buf[i*entrySize:], base+i)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *sQcow2Stream) writeL2Tables(w io.Writer) error {
+	buf := make([]byte, qcow2ClusterSize)
+	table := int64(-1)
+	flush := func() error {
+		if table < 0 {
+			return nil
+		}
+		_, err := w.Write(buf)
+		for i := range buf {
+			buf[i] = 0
+		}
+		return err
+	}
+	offset := q.dataOffset()
+	for _, run := range q.runs {
+		for c := run.start; c < run.start+run.count; c++ {
+			if idx := c / qcow2L2Entries; idx != table {
+				if err := flush(); err != nil {
+					return err
+				}
+				table = idx
+			}
+			binary.BigEndian.PutUint64(buf[(c%qcow2L2Entries)*8:], uint64(offset)|qcow2OflagCopied)
+			offset += qcow2ClusterSize
+		}
+	}
+	return flush()
+}
+
+func (q *sQcow2Stream) writeData(w io.Writer, src io.ReaderAt) error {
+	buf := make([]byte, qcow2ReadClusters*qcow2ClusterSize)
+	for _, run := range q.runs {
+		for c := run.start; c < run.start+run.count; c += qcow2ReadClusters {
+			n := run.start + run.count - c
+			if n > qcow2ReadClusters {
+				n = qcow2ReadClusters
+			}
+			chunk := buf[:n*qcow2ClusterSize]
+			// the last cluster may exceed the end of disk
+			readLen := int64(len(chunk))
+			if c*qcow2ClusterSize+readLen > q.size {
+				readLen = q.size - c*qcow2ClusterSize
+				for i := readLen; i < int64(len(chunk)); i++ {
+					chunk[i] = 0
+				}
+			}
+			if _, err := src.ReadAt(chunk[:readLen], c*qcow2ClusterSize); err != nil {
+				return errors.Wrapf(err, "read cluster %d", c)
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the whole qcow2 image to w, reading guest data from src
+func (q *sQcow2Stream) WriteTo(w io.Writer, src io.ReaderAt) error {
+	if err := q.writeHeader(w); err != nil {
+		return errors.Wrap(err, "write header")
+	}
+	err := writeTable(w, q.refcountBlocks, 8, func(buf []byte, idx int64) {
+		binary.BigEndian.PutUint64(buf, uint64(q.refcountBlockOffset()+idx*qcow2ClusterSize))
+	})
+	if err != nil {
+		return errors.Wrap(err, "write refcount table")
+	}
+	err = writeTable(w, q.refcountBlocks*qcow2RefcountsPerBlock, 2, func(buf []byte, idx int64) {
+		if idx < q.totalClusters {
+			binary.BigEndian.PutUint16(buf, 1)
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "write refcount blocks")
+	}
+	l2Idx := 0
+	err = writeTable(w, q.l1Size, 8, func(buf []byte, idx int64) {
+		if l2Idx < len(q.l2Tables) && q.l2Tables[l2Idx] == idx {
+			binary.BigEndian.PutUint64(buf, uint64(q.l2Offset()+int64(l2Idx)*qcow2ClusterSize)|qcow2OflagCopied)
+			l2Idx++
+		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "write l1 table")
+	}
+	if err := q.writeL2Tables(w); err != nil {
+		return errors.Wrap(err, "write l2 tables")
+	}
+	if err := q.writeData(w, src); err != nil {
+		return errors.Wrap(err, "write data")
+	}
+	return nil
+}
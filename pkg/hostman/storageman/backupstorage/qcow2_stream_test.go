@@ -0,0 +1,421 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backupstorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/util/qemuimg"
+)
+
+// testQcow2Disk returns a disk image and its extents: data clusters in the
+// 1st and 3rd L2 table range, a zero extent, holes and a partial last cluster
+func testQcow2Disk() ([]byte, []qemuimg.SImageExtent) {
+	const l2Range = qcow2ClusterSize * qcow2L2Entries
+	size := int64(2*l2Range + 5*qcow2ClusterSize + 4096)
+	disk := make([]byte, size)
+	rnd := rand.New(rand.NewSource(1))
+	fill := func(start, length int64) {
+		rnd.Read(disk[start : start+length])
+	}
+	extents := []qemuimg.SImageExtent{}
+	add := func(start, length int64, data, zero bool) {
+		extents = append(extents, qemuimg.SImageExtent{Start: start, Length: length, Data: data, Zero: zero})
+	}
+	// data run crossing no table boundary
+	fill(0, 3*qcow2ClusterSize)
+	add(0, 3*qcow2ClusterSize, true, false)
+	// hole
+	add(3*qcow2ClusterSize, 2*qcow2ClusterSize, false, true)
+	// allocated but zero extent is not copied
+	add(5*qcow2ClusterSize, qcow2ClusterSize, true, true)
+	// data run of 100 clusters, exceeding qcow2ReadClusters
+	fill(6*qcow2ClusterSize, 100*qcow2ClusterSize)
+	add(6*qcow2ClusterSize, 100*qcow2ClusterSize, true, false)
+	add(106*qcow2ClusterSize, 2*l2Range-106*qcow2ClusterSize, false, true)
+	// data in the 3rd L2 table range up to the partial last cluster
+	fill(2*l2Range+qcow2ClusterSize, size-2*l2Range-qcow2ClusterSize)
+	add(2*l2Range, qcow2ClusterSize, false, true)
+	add(2*l2Range+qcow2ClusterSize, size-2*l2Range-qcow2ClusterSize, true, false)
+	return disk, extents
+}
+
+// readTestQcow2 decodes the image written by sQcow2Stream, checks that every
+// cluster of the file is referenced exactly once and returns the guest data
+func readTestQcow2(t *testing.T, img []byte) []byte {
+	be := binary.BigEndian
+	if be.Uint32(img) != qcow2Magic || be.Uint32(img[4:]) != qcow2Version || be.Uint32(img[20:]) != qcow2ClusterBits {
+		t.Fatalf("bad header % x", img[:32])
+	}
+	if len(img)%qcow2ClusterSize != 0 {
+		t.Fatalf("image size %d not cluster aligned", len(img))
+	}
+	size := int64(be.Uint64(img[24:]))
+	l1Size := int64(be.Uint32(img[36:]))
+	l1Offset := int64(be.Uint64(img[40:]))
+	rtOffset := int64(be.Uint64(img[48:]))
+	rtClusters := int64(be.Uint32(img[56:]))
+	nbClusters := int64(len(img) / qcow2ClusterSize)
+
+	refs := make([]int, nbClusters)
+	ref := func(offset int64, what string) {
+		if offset%qcow2ClusterSize != 0 || offset/qcow2ClusterSize >= nbClusters {
+			t.Fatalf("%s offset %d out of image", what, offset)
+		}
+		refs[offset/qcow2ClusterSize]++
+	}
+	ref(0, "header")
+	for i := int64(0); i < rtClusters; i++ {
+		ref(rtOffset+i*qcow2ClusterSize, "refcount table")
+	}
+	for i := int64(0); i < divRoundUp(l1Size*8, qcow2ClusterSize); i++ {
+		ref(l1Offset+i*qcow2ClusterSize, "l1")
+	}
+
+	// refcount table and blocks
+	stored := make([]int, nbClusters)
+	for i := int64(0); i < rtClusters*qcow2ClusterSize/8; i++ {
+		blk := int64(be.Uint64(img[rtOffset+i*8:]))
+		if blk == 0 {
+			continue
+		}
+		ref(blk, "refcount block")
+		for j := int64(0); j < qcow2RefcountsPerBlock; j++ {
+			cnt := int(be.Uint16(img[blk+j*2:]))
+			idx := i*qcow2RefcountsPerBlock + j
+			if idx < nbClusters {
+				stored[idx] = cnt
+			} else if cnt != 0 {
+				t.Errorf("refcount %d of cluster %d beyond image end", cnt, idx)
+			}
+		}
+	}
+
+	guest := make([]byte, size)
+	for i := int64(0); i < l1Size; i++ {
+		l1e := be.Uint64(img[l1Offset+i*8:])
+		if l1e == 0 {
+			continue
+		}
+		if l1e&qcow2OflagCopied == 0 {
+			t.Errorf("l1 entry %d without copied flag", i)
+		}
+		l2Offset := int64(l1e &^ qcow2OflagCopied)
+		ref(l2Offset, "l2")
+		for j := int64(0); j < qcow2L2Entries; j++ {
+			l2e := be.Uint64(img[l2Offset+j*8:])
+			if l2e == 0 {
+				continue
+			}
+			if l2e&qcow2OflagCopied == 0 {
+				t.Errorf("l2 entry %d/%d without copied flag", i, j)
+			}
+			dataOffset := int64(l2e &^ qcow2OflagCopied)
+			ref(dataOffset, "data")
+			guestOffset := (i*qcow2L2Entries + j) * qcow2ClusterSize
+			if guestOffset >= size {
+				t.Fatalf("cluster at %d beyond disk size %d", guestOffset, size)
+			}
+			copy(guest[guestOffset:], img[dataOffset:dataOffset+qcow2ClusterSize])
+		}
+	}
+	for i := range refs {
+		if refs[i] != 1 || stored[i] != 1 {
+			t.Errorf("cluster %d referenced %d times, refcount %d", i, refs[i], stored[i])
+		}
+	}
+	return guest
+}
+
+func TestQcow2Stream(t *testing.T) {
+	disk, extents := testQcow2Disk()
+	runs := allocatedClusterRuns(extents)
+	want := []sClusterRun{{0, 3}, {6, 100}, {2*qcow2L2Entries + 1, 5}}
+	if len(runs) != len(want) {
+		t.Fatalf("runs %v want %v", runs, want)
+	}
+	for i := range runs {
+		if runs[i] != want[i] {
+			t.Fatalf("runs %v want %v", runs, want)
+		}
+	}
+
+	q := newQcow2Stream(int64(len(disk)), runs)
+	buf := &bytes.Buffer{}
+	if err := q.WriteTo(buf, bytes.NewReader(disk)); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if int64(buf.Len()) != q.totalClusters*qcow2ClusterSize {
+		t.Errorf("image size %d want %d clusters", buf.Len(), q.totalClusters)
+	}
+	guest := readTestQcow2(t, buf.Bytes())
+	if !bytes.Equal(guest, disk) {
+		t.Errorf("guest data differs from source")
+	}
+}
+
+type zeroReaderAt struct{}
+
+func (zeroReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// metaWriter keeps the metadata clusters ahead of the data and counts the
+// bytes written
+type metaWriter struct {
+	meta  []byte
+	limit int
+	total int64
+}
+
+func (w *metaWriter) Write(p []byte) (int, error) {
+	if n := w.limit - len(w.meta); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.meta = append(w.meta, p[:n]...)
+	}
+	w.total += int64(len(p))
+	return len(p), nil
+}
+
+func TestQcow2StreamRefcountBlocks(t *testing.T) {
+	// more clusters than a refcount block covers
+	count := int64(3 * qcow2RefcountsPerBlock)
+	q := newQcow2Stream(count*qcow2ClusterSize, []sClusterRun{{0, count}})
+	if q.refcountBlocks*qcow2RefcountsPerBlock < q.totalClusters || q.refcountBlocks < 4 {
+		t.Fatalf("refcount blocks %d can't cover %d clusters", q.refcountBlocks, q.totalClusters)
+	}
+	w := &metaWriter{limit: int(q.dataOffset())}
+	if err := q.WriteTo(w, zeroReaderAt{}); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if w.total != q.totalClusters*qcow2ClusterSize {
+		t.Fatalf("image size %d want %d clusters", w.total, q.totalClusters)
+	}
+	be := binary.BigEndian
+	rtOffset := int64(be.Uint64(w.meta[48:]))
+	refs := int64(0)
+	for i := int64(0); i < q.refcountBlocks; i++ {
+		blk := int64(be.Uint64(w.meta[rtOffset+i*8:]))
+		if blk != q.refcountBlockOffset()+i*qcow2ClusterSize {
+			t.Fatalf("refcount block %d at %d", i, blk)
+		}
+		for j := int64(0); j < qcow2RefcountsPerBlock; j++ {
+			cnt := int64(be.Uint16(w.meta[blk+j*2:]))
+			if idx := i*qcow2RefcountsPerBlock + j; (idx < q.totalClusters) != (cnt == 1) {
+				t.Fatalf("refcount %d of cluster %d", cnt, idx)
+			}
+			refs += cnt
+		}
+	}
+	if refs != q.totalClusters {
+		t.Errorf("refcounts %d want %d", refs, q.totalClusters)
+	}
+	// l2 tables are referenced in order and map all clusters
+	l1Offset := int64(be.Uint64(w.meta[40:]))
+	for i := int64(0); i < q.l1Size; i++ {
+		l2Offset := int64(be.Uint64(w.meta[l1Offset+i*8:]) &^ qcow2OflagCopied)
+		if l2Offset != q.l2Offset()+i*qcow2ClusterSize {
+			t.Fatalf("l2 table %d at %d", i, l2Offset)
+		}
+		for j := int64(0); j < qcow2L2Entries && i*qcow2L2Entries+j < count; j++ {
+			want := q.dataOffset() + (i*qcow2L2Entries+j)*qcow2ClusterSize
+			if got := int64(be.Uint64(w.meta[l2Offset+j*8:]) &^ qcow2OflagCopied); got != want {
+				t.Fatalf("cluster %d at %d want %d", i*qcow2L2Entries+j, got, want)
+			}
+		}
+	}
+}
+
+// serveTestNbd serves disk by the fixed newstyle handshake of qemu-nbd
+func serveTestNbd(t *testing.T, l net.Listener, disk []byte, noZeroes bool) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	be := binary.BigEndian
+	flags := uint16(nbdFlagFixedNewstyle)
+	if noZeroes {
+		flags |= nbdFlagNoZeroes
+	}
+	binary.Write(conn, be, struct {
+		Magic    uint64
+		OptMagic uint64
+		Flags    uint16
+	}{nbdMagic, nbdOptMagic, flags})
+	var clientFlags uint32
+	var opt struct {
+		Magic  uint64
+		Option uint32
+		Length uint32
+	}
+	if binary.Read(conn, be, &clientFlags) != nil || binary.Read(conn, be, &opt) != nil {
+		return
+	}
+	if opt.Magic != nbdOptMagic || opt.Option != nbdOptExportName {
+		t.Errorf("unexpected option %#v", opt)
+		return
+	}
+	io.CopyN(ioutil.Discard, conn, int64(opt.Length))
+	binary.Write(conn, be, struct {
+		Size  uint64
+		Flags uint16
+	}{uint64(len(disk)), 0})
+	if clientFlags&nbdFlagNoZeroes == 0 {
+		conn.Write(make([]byte, nbdExportNameZeroPads))
+	}
+	for {
+		var req struct {
+			Magic  uint32
+			Flags  uint16
+			Type   uint16
+			Handle uint64
+			Offset uint64
+			Length uint32
+		}
+		if binary.Read(conn, be, &req) != nil || req.Type == nbdCmdDisc {
+			return
+		}
+		binary.Write(conn, be, struct {
+			Magic  uint32
+			Error  uint32
+			Handle uint64
+		}{nbdSimpleReplyMagic, 0, req.Handle})
+		conn.Write(disk[req.Offset : req.Offset+uint64(req.Length)])
+	}
+}
+
+func TestQcow2StreamFromNbd(t *testing.T) {
+	disk, extents := testQcow2Disk()
+	for _, noZeroes := range []bool{true, false} {
+		dir, err := ioutil.TempDir("", "nbd")
+		if err != nil {
+			t.Fatalf("TempDir: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		sock := filepath.Join(dir, "nbd.sock")
+		l, err := net.Listen("unix", sock)
+		if err != nil {
+			t.Fatalf("Listen: %v", err)
+		}
+		defer l.Close()
+		go serveTestNbd(t, l, disk, noZeroes)
+
+		cli, err := dialNbd(sock, time.Second*5)
+		if err != nil {
+			t.Fatalf("dialNbd: %v", err)
+		}
+		if cli.size != int64(len(disk)) {
+			t.Errorf("export size %d want %d", cli.size, len(disk))
+		}
+		q := newQcow2Stream(cli.size, allocatedClusterRuns(extents))
+		buf := &bytes.Buffer{}
+		err = q.WriteTo(buf, cli)
+		cli.Close()
+		if err != nil {
+			t.Fatalf("WriteTo: %v", err)
+		}
+		if !bytes.Equal(readTestQcow2(t, buf.Bytes()), disk) {
+			t.Errorf("guest data differs from source, no zeroes %v", noZeroes)
+		}
+	}
+}
+
+// TestQcow2StreamQemuImg checks the image by qemu-img if available
+func TestQcow2StreamQemuImg(t *testing.T) {
+	qemuImg, err := exec.LookPath("qemu-img")
+	if err != nil {
+		t.Skip("qemu-img not found")
+	}
+	dir, err := ioutil.TempDir("", "qcow2stream")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// raw source with holes and an explicitly zeroed cluster
+	disk, _ := testQcow2Disk()
+	src := filepath.Join(dir, "src.raw")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := f.Truncate(int64(len(disk))); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	for off := 0; off < len(disk); off += qcow2ClusterSize {
+		end := off + qcow2ClusterSize
+		if end > len(disk) {
+			end = len(disk)
+		}
+		if bytes.Count(disk[off:end], []byte{0}) != end-off {
+			f.WriteAt(disk[off:end], int64(off))
+		}
+	}
+	f.WriteAt(make([]byte, qcow2ClusterSize), 5*qcow2ClusterSize)
+	f.Close()
+
+	output, err := exec.Command(qemuImg, "map", "-f", "raw", "--output", "json", src).Output()
+	if err != nil {
+		t.Fatalf("qemu-img map: %v", err)
+	}
+	resp, err := jsonutils.Parse(output)
+	if err != nil {
+		t.Fatalf("parse map: %v", err)
+	}
+	extents := []qemuimg.SImageExtent{}
+	if err := resp.Unmarshal(&extents); err != nil {
+		t.Fatalf("unmarshal map: %v", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer in.Close()
+	dst := filepath.Join(dir, "dst.qcow2")
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	err = newQcow2Stream(int64(len(disk)), allocatedClusterRuns(extents)).WriteTo(out, in)
+	out.Close()
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if output, err := exec.Command(qemuImg, "check", "-f", "qcow2", dst).CombinedOutput(); err != nil {
+		t.Errorf("qemu-img check: %v %s", err, output)
+	}
+	if output, err := exec.Command(qemuImg, "compare", "-f", "raw", "-F", "qcow2", src, dst).CombinedOutput(); err != nil {
+		t.Errorf("qemu-img compare: %v %s", err, output)
+	}
+}
@@ -383,9 +383,6 @@ func diskBackup(ctx context.Context, userCred mcclient.TokenCredential, storage
 	if err != nil {
 		return nil, errors.Wrap(err, "JsonUnmarshal")
 	}
-	if len(backupInfo.SnapshotId) == 0 {
-		return nil, httperrors.NewMissingParameterError("snapshot_id")
-	}
 	if len(backupInfo.BackupId) == 0 {
 		return nil, httperrors.NewMissingParameterError("backup_id")
 	}
@@ -393,6 +390,19 @@ func diskBackup(ctx context.Context, userCred mcclient.TokenCredential, storage
 		return nil, httperrors.NewMissingParameterError("backup_storage_id")
 	}
 	backupInfo.UserCred = userCred
+	if backupInfo.BackupMode == compute.BACKUP_MODE_INCREMENTAL {
+		if len(backupInfo.ServerId) == 0 {
+			return nil, httperrors.NewMissingParameterError("server_id")
+		}
+		hostutils.DelayTask(ctx, guestman.GetGuestManager().DoDiskBackup, &guestman.SDiskBackup{
+			SDiskBakcup: backupInfo,
+			Disk:        disk,
+		})
+		return nil, nil
+	}
+	if len(backupInfo.SnapshotId) == 0 {
+		return nil, httperrors.NewMissingParameterError("snapshot_id")
+	}
 	hostutils.DelayTask(ctx, disk.DiskBackup, backupInfo)
 	return nil, nil
 }
@@ -169,6 +169,20 @@ func (l *SLocalImageCache) prepare(ctx context.Context, input api.CacheImageInpu
 	}
 
 	if l.remoteFile == nil && l.Desc != nil && (l.consumerCount > 0 || !l.needCheck()) {
+		if !l.Desc.SignatureVerified {
+			// images cached before verification or loaded from disk are
+			// verified once and the result is kept in the .inf file
+			verified, err := verifyImageCacheSignature(ctx, l.imageId, input.Zone, l.GetPath(), l.Desc.Format)
+			if err != nil {
+				return false, errors.Wrapf(err, "verify signature of cached image %s", l.imageId)
+			}
+			if verified {
+				l.Desc.SignatureVerified = true
+				if err := l.saveDesc(); err != nil {
+					log.Errorf("save signature verification of image %s: %s", l.imageId, err)
+				}
+			}
+		}
 		l.consumerCount++
 		return true, nil
 	}
@@ -196,6 +210,12 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 		l.cond.L.Unlock()
 	}()
 	var _fetch = func() error {
+		verified, err := l.verifySignature(ctx, input)
+		if err != nil {
+			// never leave an unverified image in cache
+			syscall.Unlink(l.GetPath())
+			return errors.Wrapf(err, "verifySignature")
+		}
 		if len(l.Manager.GetId()) > 0 {
 			_, err := hostutils.RemoteStoragecacheCacheImage(ctx,
 				l.Manager.GetId(), l.imageId, "active", l.GetPath())
@@ -206,7 +226,6 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 		l.cond.L.Lock()
 		defer l.cond.L.Unlock()
 
-		var err error
 		l.Desc, err = l.remoteFile.GetInfo()
 		if err != nil {
 			return errors.Wrapf(err, "remoteFile.GetInfo")
@@ -214,19 +233,11 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 
 		l.Size = l.GetSize() / 1024 / 1024
 		l.Desc.Id = l.imageId
+		l.Desc.SignatureVerified = verified
 		l.lastCheckTime = time.Now()
 		l.consumerCount++
 
-		bDesc, err := json.Marshal(l.Desc)
-		if err != nil {
-			return errors.Wrapf(err, "json.Marshal(%#v)", l.Desc)
-		}
-
-		err = fileutils2.FilePutContents(l.GetInfPath(), string(bDesc), false)
-		if err != nil {
-			return errors.Wrapf(err, "FilePutContents(%s)", string(bDesc))
-		}
-		return nil
+		return l.saveDesc()
 	}
 	if fileutils2.Exists(l.GetPath()) && l.remoteFile.VerifyIntegrity(callback) == nil {
 		return _fetch()
@@ -238,6 +249,27 @@ func (l *SLocalImageCache) fetch(ctx context.Context, input api.CacheImageInput,
 	return _fetch()
 }
 
+func (l *SLocalImageCache) verifySignature(ctx context.Context, input api.CacheImageInput) (bool, error) {
+	desc, err := l.remoteFile.GetInfo()
+	if err != nil {
+		return false, errors.Wrapf(err, "remoteFile.GetInfo")
+	}
+	return verifyImageCacheSignature(ctx, l.imageId, input.Zone, l.GetPath(), desc.Format)
+}
+
+// saveDesc writes the description of cached image to the .inf file
+func (l *SLocalImageCache) saveDesc() error {
+	bDesc, err := json.Marshal(l.Desc)
+	if err != nil {
+		return errors.Wrapf(err, "json.Marshal(%#v)", l.Desc)
+	}
+	err = fileutils2.FilePutContents(l.GetInfPath(), string(bDesc), false)
+	if err != nil {
+		return errors.Wrapf(err, "FilePutContents(%s)", string(bDesc))
+	}
+	return nil
+}
+
 func (l *SLocalImageCache) Remove(ctx context.Context) error {
 	if fileutils2.Exists(l.GetPath()) {
 		if err := syscall.Unlink(l.GetPath()); err != nil {
@@ -0,0 +1,105 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storageman
+
+import (
+	"context"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	imageapi "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/hostman/hostutils"
+	"yunion.io/x/onecloud/pkg/hostman/options"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/image"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/imagesign"
+)
+
+var (
+	ErrImageUnsigned        = errors.Error("image is not signed by a trusted signer")
+	ErrImageDigestMismatch  = errors.Error("cached image does not match the signed digest")
+	ErrImageSignatureStatus = errors.Error("image signature is not verified by the image service")
+)
+
+// verifyImageCacheSignature verifies the signatures of a fetched image with
+// the trusted keys and certificates of this host. The signed digest is
+// checked against the cached file when the image service serves the signed
+// content as is, otherwise the cached file is a converted subformat and the
+// verification result of the image service is required.
+// verified is true only if the image is signed by a trusted signer, images
+// accepted without verification are checked again on next use so that a
+// later enforcement of the host takes effect.
+func verifyImageCacheSignature(ctx context.Context, imageId string, zone string, imgPath string, format string) (bool, error) {
+	store, err := imagesign.LoadTrustStore(options.HostOptions.ImageSigningTrustedKeysDir, options.HostOptions.ImageSigningTrustedCaFile)
+	if err != nil {
+		return false, errors.Wrap(err, "LoadTrustStore")
+	}
+	if store.IsEmpty() && !options.HostOptions.RequireSignedImages {
+		// image signature verification is not configured on this host
+		return false, nil
+	}
+	ret, err := image.Images.GetSpecific(hostutils.GetImageSession(ctx, zone), imageId, "signatures", nil)
+	if err != nil {
+		return false, errors.Wrap(err, "get image signatures")
+	}
+	output := imageapi.ImageSignaturesOutput{}
+	err = ret.Unmarshal(&output)
+	if err != nil {
+		return false, errors.Wrap(err, "unmarshal image signatures")
+	}
+	errs := make([]error, 0)
+	untrusted := true
+	for i := range output.Signatures {
+		sig := output.Signatures[i]
+		signer, err := store.Verify(imagesign.SSignature{
+			Format:      sig.Format,
+			Signature:   sig.Signature,
+			Payload:     sig.Payload,
+			Certificate: sig.Certificate,
+		}, output.Digest)
+		if err != nil {
+			if errors.Cause(err) != imagesign.ErrUntrustedSigner {
+				untrusted = false
+			}
+			errs = append(errs, err)
+			continue
+		}
+		if len(format) > 0 && format == output.SignedFormat {
+			digest, err := fileutils2.SHA256(imgPath)
+			if err != nil {
+				return false, errors.Wrapf(err, "sha256 %s", imgPath)
+			}
+			if digest != imagesign.NormalizeDigest(output.Digest) {
+				return false, errors.Wrapf(ErrImageDigestMismatch, "digest %s signed %s", digest, output.Digest)
+			}
+		} else if output.SignatureStatus != imageapi.IMAGE_SIGNATURE_STATUS_VERIFIED {
+			return false, errors.Wrapf(ErrImageSignatureStatus, "signature status %s", output.SignatureStatus)
+		}
+		log.Infof("image %s signed by %s is verified", imageId, signer)
+		return true, nil
+	}
+	if len(output.Signatures) == 0 {
+		if options.HostOptions.RequireSignedImages {
+			return false, ErrImageUnsigned
+		}
+		return false, nil
+	}
+	if !untrusted || options.HostOptions.RequireSignedImages {
+		return false, errors.Wrap(ErrImageUnsigned, errors.NewAggregate(errs).Error())
+	}
+	log.Warningf("image %s is signed by signers not trusted by this host: %s", imageId, errors.NewAggregate(errs))
+	return false, nil
+}
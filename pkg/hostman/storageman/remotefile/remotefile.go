@@ -43,6 +43,9 @@ type SImageDesc struct {
 	Chksum string `json:"chksum"`
 	Path   string `json:"path"`
 	Size   int64  `json:"size"`
+
+	// the signature of cached image is verified by trusted signers of host
+	SignatureVerified bool `json:"signature_verified,omitempty"`
 }
 
 type SRemoteFile struct {
@@ -452,6 +452,9 @@ func (s *SBaseStorage) GetBackupDir() string {
 
 func (s *SBaseStorage) CreateDiskFromBackup(ctx context.Context, disk IDisk, input *SDiskCreateByDiskinfo) error {
 	info := input.DiskInfo
+	if len(info.Backup.BackupChain) > 0 {
+		return errors.Wrapf(errors.ErrNotSupported, "recover incremental backup to storage %s", s.GetStorageName())
+	}
 	backupPath := path.Join(s.GetBackupDir(), info.Backup.BackupId)
 	img, err := qemuimg.NewQemuImage(backupPath)
 	if err != nil {
@@ -107,7 +107,12 @@ func (s *SLocalStorage) CreateDiskFromBackup(ctx context.Context, disk IDisk, in
 		}
 	}
 	backupPath := path.Join(s.GetBackupDir(), info.Backup.BackupId)
-	if !fileutils2.Exists(backupPath) {
+	if !fileutils2.Exists(backupPath) && len(info.Backup.BackupChain) > 0 {
+		err := s.synthesizeBackup(ctx, info.Backup, backupPath)
+		if err != nil {
+			return errors.Wrap(err, "unable to synthesizeBackup")
+		}
+	} else if !fileutils2.Exists(backupPath) {
 		_, err := s.storageBackupRecovery(ctx, &SStorageBackup{
 			BackupId:                input.DiskInfo.Backup.BackupId,
 			BackupStorageId:         input.DiskInfo.Backup.BackupStorageId,
@@ -149,6 +154,51 @@ func (s *SLocalStorage) CreateDiskFromBackup(ctx context.Context, disk IDisk, in
 	return nil
 }
 
+// synthesizeBackup downloads the full backup and all incremental backups of
+// the chain, links them by backing file and converts the chain to a full image
+func (s *SLocalStorage) synthesizeBackup(ctx context.Context, backup *api.DiskAllocateFromBackupInput, backupPath string) error {
+	backupStorage, err := backupstorage.GetBackupStorage(backup.BackupStorageId, backup.BackupStorageAccessInfo.Copy())
+	if err != nil {
+		return errors.Wrap(err, "GetBackupStorage")
+	}
+	chainDir := backupPath + ".chain"
+	output, err := procutils.NewCommand("mkdir", "-p", chainDir).Output()
+	if err != nil {
+		return errors.Wrapf(err, "mkdir %s failed: %s", chainDir, output)
+	}
+	defer procutils.NewCommand("rm", "-rf", chainDir).Run()
+
+	var backingPath string
+	for _, backupId := range append(append([]string{}, backup.BackupChain...), backup.BackupId) {
+		chainPath := path.Join(chainDir, backupId)
+		err := backupStorage.CopyBackupTo(chainPath, backupId)
+		if err != nil {
+			return errors.Wrapf(err, "CopyBackupTo %s", backupId)
+		}
+		if len(backingPath) > 0 {
+			img, err := qemuimg.NewQemuImage(chainPath)
+			if err != nil {
+				return errors.Wrapf(err, "NewQemuImage %s", chainPath)
+			}
+			err = img.RebaseWithFormat(backingPath, qemuimg.QCOW2, true)
+			if err != nil {
+				return errors.Wrapf(err, "rebase %s to %s", chainPath, backingPath)
+			}
+		}
+		backingPath = chainPath
+	}
+	img, err := qemuimg.NewQemuImage(backingPath)
+	if err != nil {
+		return errors.Wrapf(err, "NewQemuImage %s", backingPath)
+	}
+	_, err = img.Clone(backupPath, qemuimg.QCOW2, true)
+	if err != nil {
+		procutils.NewCommand("rm", "-f", backupPath).Run()
+		return errors.Wrapf(err, "convert backup chain to %s", backupPath)
+	}
+	return nil
+}
+
 func (s *SLocalStorage) StorageBackup(ctx context.Context, params interface{}) (jsonutils.JSONObject, error) {
 	sbParams := params.(*SStorageBackup)
 	backupStorage, err := backupstorage.GetBackupStorage(sbParams.BackupStorageId, sbParams.BackupStorageAccessInfo)
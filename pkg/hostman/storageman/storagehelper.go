@@ -54,6 +54,12 @@ type SDiskBakcup struct {
 
 	EncryptKeyId string `json:"encrypt_key_id"`
 
+	// incremental backup is taken from the running guest by dirty bitmap
+	// without snapshot, in which case ServerId is required
+	BackupMode string `json:"backup_mode"`
+	ParentId   string `json:"parent_id"`
+	ServerId   string `json:"server_id"`
+
 	UserCred mcclient.TokenCredential
 }
 
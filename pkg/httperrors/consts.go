@@ -63,6 +63,8 @@ const (
 
 	ErrNotAcceptable = errors.Error("NotAcceptableError")
 
+	ErrPreconditionFailed = errors.Error("PreconditionFailedError")
+
 	ErrDuplicateName     = errors.Error("DuplicateNameError")
 	ErrDuplicateResource = errors.Error("DuplicateResourceError")
 	ErrConflict          = errors.Error("ConflictError")
@@ -152,6 +154,8 @@ var (
 
 		ErrNotAcceptable: 406,
 
+		ErrPreconditionFailed: 412,
+
 		ErrDuplicateName:     409,
 		ErrDuplicateResource: 409,
 		ErrConflict:          409,
@@ -154,6 +154,10 @@ func NewNotAcceptableError(msg string, params ...interface{}) *httputils.JSONCli
 	return httputils.NewJsonClientError(httpErrorCode[ErrNotAcceptable], string(ErrNotAcceptable), msg, params...)
 }
 
+func NewPreconditionFailedError(msg string, params ...interface{}) *httputils.JSONClientError {
+	return httputils.NewJsonClientError(httpErrorCode[ErrPreconditionFailed], string(ErrPreconditionFailed), msg, params...)
+}
+
 func NewDuplicateNameError(resName string, resId string) *httputils.JSONClientError {
 	msg := "Duplicate name %s %s"
 	return httputils.NewJsonClientError(httpErrorCode[ErrDuplicateName], string(ErrDuplicateName), msg, resName, resId)
@@ -0,0 +1,220 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	api "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/image/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+	"yunion.io/x/onecloud/pkg/util/ociregistry"
+)
+
+func validateOciInput(input api.ImageOciInput) (api.ImageOciInput, error) {
+	ref, err := ociregistry.ParseReference(input.OciReference)
+	if err != nil {
+		return input, httperrors.NewInputParameterError("invalid oci_reference %s: %s", input.OciReference, err)
+	}
+	input.OciReference = ref.String()
+	if len(input.OciPassword) > 0 && len(input.OciUsername) == 0 {
+		return input, httperrors.NewMissingParameterError("oci_username")
+	}
+	return input, nil
+}
+
+// getOciArch returns the OCI platform architecture of the os_arch of an image
+func getOciArch(osArch string) string {
+	if apis.IsARM(osArch) {
+		return "arm64"
+	}
+	return "amd64"
+}
+
+func getOciClient(username, password string) *ociregistry.SClient {
+	client := httputils.GetTimeoutClient(0)
+	transport := httputils.GetTransport(true)
+	transport.Proxy = options.Options.HttpTransportProxyFunc()
+	client.Transport = transport
+	return ociregistry.NewClient(client, username, password)
+}
+
+// ociTaskParams keeps the registry password encrypted in the task params
+func (self *SImage) ociTaskParams(input api.ImageOciInput) (*jsonutils.JSONDict, error) {
+	params := jsonutils.NewDict()
+	params.Set("oci_reference", jsonutils.NewString(input.OciReference))
+	if len(input.OciUsername) > 0 {
+		params.Set("oci_username", jsonutils.NewString(input.OciUsername))
+	}
+	if len(input.OciPassword) > 0 {
+		secret, err := utils.EncryptAESBase64(self.Id, input.OciPassword)
+		if err != nil {
+			return nil, errors.Wrap(err, "EncryptAESBase64")
+		}
+		params.Set("oci_password", jsonutils.NewString(secret))
+	}
+	return params, nil
+}
+
+func (self *SImage) getOciInput(params jsonutils.JSONObject) (*ociregistry.SReference, *ociregistry.SClient, error) {
+	input := api.ImageOciInput{}
+	err := params.Unmarshal(&input)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Unmarshal")
+	}
+	ref, err := ociregistry.ParseReference(input.OciReference)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "ParseReference %s", input.OciReference)
+	}
+	if len(input.OciPassword) > 0 {
+		input.OciPassword, err = utils.DescryptAESBase64(self.Id, input.OciPassword)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "DescryptAESBase64")
+		}
+	}
+	return ref, getOciClient(input.OciUsername, input.OciPassword), nil
+}
+
+func (self *SImage) startImageImportOciTask(ctx context.Context, userCred mcclient.TokenCredential, input api.ImageOciInput, parentTaskId string) error {
+	params, err := self.ociTaskParams(input)
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("import from oci %s", input.OciReference)
+	self.SetStatus(userCred, api.IMAGE_STATUS_SAVING, msg)
+	db.OpsLog.LogEvent(self, db.ACT_SAVING, msg, userCred)
+
+	task, err := taskman.TaskManager.NewTask(ctx, "ImageImportOciTask", self, userCred, params, parentTaskId, "", nil)
+	if err != nil {
+		return err
+	}
+	task.ScheduleRun(nil)
+	return nil
+}
+
+// ImportFromOci saves the disk image pulled from an OCI registry, the os_*
+// annotations become image properties unless the properties were given
+func (self *SImage) ImportFromOci(ctx context.Context, userCred mcclient.TokenCredential, params jsonutils.JSONObject) error {
+	ref, client, err := self.getOciInput(params)
+	if err != nil {
+		return err
+	}
+	disk, err := client.PullDisk(ctx, ref, getOciArch(self.OsArch))
+	if err != nil {
+		return errors.Wrapf(err, "PullDisk %s", ref)
+	}
+	defer disk.Close()
+	err = self.SaveImageFromStream(disk, disk.Size, false)
+	if err != nil {
+		return errors.Wrap(err, "SaveImageFromStream")
+	}
+
+	props, err := ImagePropertyManager.GetProperties(self.Id)
+	if err != nil {
+		return errors.Wrap(err, "GetProperties")
+	}
+	for k, v := range disk.Annotations {
+		key := strings.TrimPrefix(k, ociregistry.ANNOTATION_PREFIX)
+		if key == k || !strings.HasPrefix(key, "os_") || len(props[key]) > 0 {
+			continue
+		}
+		_, err := ImagePropertyManager.SaveProperty(ctx, userCred, self.Id, key, v)
+		if err != nil {
+			return errors.Wrapf(err, "SaveProperty %s", key)
+		}
+	}
+	return nil
+}
+
+// 将镜像以OCI制品的形式推送到镜像仓库, 镜像的os_*属性保存为注解
+func (self *SImage) PerformExportOci(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ImageExportOciInput) (jsonutils.JSONObject, error) {
+	if self.Status != api.IMAGE_STATUS_ACTIVE {
+		return nil, httperrors.NewInvalidStatusError("cannot export image in status %s", self.Status)
+	}
+	if self.IsEncrypted() {
+		return nil, httperrors.NewForbiddenError("cannot export encrypted image")
+	}
+	var err error
+	input.ImageOciInput, err = validateOciInput(input.ImageOciInput)
+	if err != nil {
+		return nil, err
+	}
+	if len(input.Format) == 0 {
+		input.Format = self.DiskFormat
+	}
+	subimg := ImageSubformatManager.FetchSubImage(self.Id, input.Format)
+	if subimg == nil || subimg.Status != api.IMAGE_STATUS_ACTIVE {
+		return nil, httperrors.NewInvalidStatusError("format %s of image is not ready", input.Format)
+	}
+	params, err := self.ociTaskParams(input.ImageOciInput)
+	if err != nil {
+		return nil, err
+	}
+	params.Set("format", jsonutils.NewString(input.Format))
+	task, err := taskman.TaskManager.NewTask(ctx, "ImageExportOciTask", self, userCred, params, "", "", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil, nil
+}
+
+// ExportToOci pushes the image in the format of the params to an OCI
+// registry and returns the digest of the manifest
+func (self *SImage) ExportToOci(ctx context.Context, params jsonutils.JSONObject) (string, error) {
+	ref, client, err := self.getOciInput(params)
+	if err != nil {
+		return "", err
+	}
+	format, _ := params.GetString("format")
+	subimg := ImageSubformatManager.FetchSubImage(self.Id, format)
+	if subimg == nil {
+		return "", errors.Wrapf(httperrors.ErrNotFound, "format %s", format)
+	}
+	filePath := self.GetPath(format)
+
+	props, err := ImagePropertyManager.GetProperties(self.Id)
+	if err != nil {
+		return "", errors.Wrap(err, "GetProperties")
+	}
+	annotations := map[string]string{
+		ociregistry.ANNOTATION_TITLE: self.Name,
+	}
+	for k, v := range props {
+		if strings.HasPrefix(k, "os_") && len(v) > 0 {
+			annotations[ociregistry.ANNOTATION_PREFIX+k] = v
+		}
+	}
+	if len(self.OsArch) > 0 {
+		annotations[ociregistry.ANNOTATION_PREFIX+api.IMAGE_OS_ARCH] = self.OsArch
+	}
+	digest, err := client.PushDisk(ctx, ref, filePath, format, annotations)
+	if err != nil {
+		return "", errors.Wrapf(err, "PushDisk %s", ref)
+	}
+	return digest, nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	api "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/image/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+	"yunion.io/x/onecloud/pkg/util/imagesign"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+// +onecloud:swagger-gen-ignore
+type SImageSignatureManager struct {
+	db.SResourceBaseManager
+}
+
+var ImageSignatureManager *SImageSignatureManager
+
+func init() {
+	ImageSignatureManager = &SImageSignatureManager{
+		SResourceBaseManager: db.NewResourceBaseManager(
+			SImageSignature{},
+			"image_signatures",
+			"image_signature",
+			"image_signatures",
+		),
+	}
+	ImageSignatureManager.SetVirtualObject(ImageSignatureManager)
+}
+
+// SImageSignature is a detached signature over the SHA256 digest of an image
+type SImageSignature struct {
+	SImagePeripheral
+
+	// 签名格式, cosign或x509
+	Format string `width:"16" charset:"ascii" nullable:"false"`
+	// base64编码的签名
+	Signature string `charset:"ascii" nullable:"false"`
+	// base64编码的cosign签名载荷
+	Payload string `charset:"ascii" nullable:"true"`
+	// PEM编码的签名证书及中间证书
+	Certificate string `charset:"ascii" nullable:"true"`
+
+	// 签名者, 受信任公钥的名称或签名证书的主体
+	Signer string `width:"255" charset:"utf8" nullable:"true"`
+	// 验证状态, verified,untrusted,invalid
+	Status string `width:"16" charset:"ascii" nullable:"true"`
+	// 验证失败原因
+	Reason string `width:"256" charset:"utf8" nullable:"true"`
+}
+
+func (manager *SImageSignatureManager) GetSignatures(imageId string) ([]SImageSignature, error) {
+	sigs := make([]SImageSignature, 0)
+	q := manager.Query().Equals("image_id", imageId).Asc("id")
+	err := db.FetchModelObjects(manager, q, &sigs)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return sigs, nil
+}
+
+func (manager *SImageSignatureManager) ValidateSignatureInput(input api.ImageSignatureInput) (api.ImageSignatureInput, error) {
+	if len(input.SignatureFormat) == 0 {
+		input.SignatureFormat = imagesign.SIGNATURE_FORMAT_COSIGN
+	}
+	if !utils.IsInStringArray(input.SignatureFormat, imagesign.SIGNATURE_FORMATS) {
+		return input, httperrors.NewInputParameterError("unsupported signature_format %s, must be one of %s", input.SignatureFormat, imagesign.SIGNATURE_FORMATS)
+	}
+	if len(input.Signature) == 0 {
+		return input, httperrors.NewMissingParameterError("signature")
+	}
+	if input.SignatureFormat == imagesign.SIGNATURE_FORMAT_COSIGN && len(input.SignaturePayload) == 0 {
+		return input, httperrors.NewMissingParameterError("signature_payload")
+	}
+	if len(input.SignatureCertificate) > 0 {
+		cert, err := imagesign.DecodePEM(input.SignatureCertificate)
+		if err != nil {
+			return input, httperrors.NewInputParameterError("invalid signature_certificate: %s", err)
+		}
+		input.SignatureCertificate = string(cert)
+	}
+	return input, nil
+}
+
+func (manager *SImageSignatureManager) newSignature(ctx context.Context, imageId string, input api.ImageSignatureInput) (*SImageSignature, error) {
+	sig := SImageSignature{}
+	sig.SetModelManager(manager, &sig)
+	sig.ImageId = imageId
+	sig.Format = input.SignatureFormat
+	sig.Signature = input.Signature
+	sig.Payload = input.SignaturePayload
+	sig.Certificate = input.SignatureCertificate
+
+	err := manager.TableSpec().Insert(ctx, &sig)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert")
+	}
+	return &sig, nil
+}
+
+func (sig *SImageSignature) toSignature() imagesign.SSignature {
+	return imagesign.SSignature{
+		Format:      sig.Format,
+		Signature:   sig.Signature,
+		Payload:     sig.Payload,
+		Certificate: sig.Certificate,
+	}
+}
+
+func (sig *SImageSignature) setResult(signer string, status string, reason string) error {
+	if len(reason) > 256 {
+		reason = reason[:256]
+	}
+	_, err := db.Update(sig, func() error {
+		sig.Signer = signer
+		sig.Status = status
+		sig.Reason = reason
+		return nil
+	})
+	return err
+}
+
+func getImageTrustStore() (*imagesign.STrustStore, error) {
+	return imagesign.LoadTrustStore(options.Options.ImageSigningTrustedKeysDir, options.Options.ImageSigningTrustedCaFile)
+}
+
+// getSignedFormat returns the subformat served with exactly the content of
+// the digest, which is empty once the image was encrypted in place or the
+// subformat was converted again
+func (img *SImage) getSignedFormat() string {
+	if len(img.Digest) == 0 || img.EncryptStatus == api.IMAGE_ENCRYPT_STATUS_ENCRYPTED {
+		return ""
+	}
+	subimg := ImageSubformatManager.FetchSubImage(img.Id, img.DiskFormat)
+	if subimg == nil || subimg.Checksum != img.Checksum {
+		return ""
+	}
+	return img.DiskFormat
+}
+
+// updateDigest records the SHA256 digest of the image as uploaded, it must
+// run before the image is encrypted in place
+func (img *SImage) updateDigest() error {
+	if len(img.Digest) > 0 {
+		return nil
+	}
+	imagePath := img.GetLocalLocation()
+	if len(imagePath) == 0 {
+		return errors.Wrapf(httperrors.ErrNotFound, "image file %s not found", img.Location)
+	}
+	digest, err := fileutils2.SHA256(imagePath)
+	if err != nil {
+		return errors.Wrapf(err, "sha256 %s", imagePath)
+	}
+	_, err = db.Update(img, func() error {
+		img.Digest = digest
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Update digest")
+	}
+	return nil
+}
+
+func (img *SImage) doVerifySignatures(ctx context.Context, userCred mcclient.TokenCredential) error {
+	if len(img.Digest) == 0 && img.EncryptStatus == api.IMAGE_ENCRYPT_STATUS_ENCRYPTED {
+		// image encrypted before signing was supported, the digest as uploaded is lost
+		log.Warningf("image %s has been encrypted, unable to compute its digest", img.Id)
+	} else {
+		err := img.updateDigest()
+		if err != nil {
+			return errors.Wrap(err, "updateDigest")
+		}
+	}
+	return img.verifySignatures(ctx, userCred)
+}
+
+// verifySignatures verifies every signature of the image against the
+// trusted keys and certificates and records the best result on the image
+func (img *SImage) verifySignatures(ctx context.Context, userCred mcclient.TokenCredential) error {
+	sigs, err := ImageSignatureManager.GetSignatures(img.Id)
+	if err != nil {
+		return errors.Wrap(err, "GetSignatures")
+	}
+	status, signedBy := api.IMAGE_SIGNATURE_STATUS_UNSIGNED, ""
+	reasons := []string{}
+	if len(sigs) > 0 {
+		store, err := getImageTrustStore()
+		if err != nil {
+			return errors.Wrap(err, "getImageTrustStore")
+		}
+		status = api.IMAGE_SIGNATURE_STATUS_INVALID
+		for i := range sigs {
+			signer, err := store.Verify(sigs[i].toSignature(), img.Digest)
+			sigStatus, reason := api.IMAGE_SIGNATURE_STATUS_VERIFIED, ""
+			if err != nil {
+				sigStatus, reason = api.IMAGE_SIGNATURE_STATUS_INVALID, err.Error()
+				if errors.Cause(err) == imagesign.ErrUntrustedSigner {
+					sigStatus = api.IMAGE_SIGNATURE_STATUS_UNTRUSTED
+				}
+				reasons = append(reasons, fmt.Sprintf("signature %d: %s", sigs[i].Id, reason))
+			}
+			err = sigs[i].setResult(signer, sigStatus, reason)
+			if err != nil {
+				log.Errorf("update result of signature %d: %s", sigs[i].Id, err)
+			}
+			switch {
+			case sigStatus == api.IMAGE_SIGNATURE_STATUS_VERIFIED && status != api.IMAGE_SIGNATURE_STATUS_VERIFIED:
+				status, signedBy = sigStatus, signer
+			case sigStatus == api.IMAGE_SIGNATURE_STATUS_UNTRUSTED && status == api.IMAGE_SIGNATURE_STATUS_INVALID:
+				status = sigStatus
+			}
+		}
+	}
+	if status == img.SignatureStatus && signedBy == img.SignedBy {
+		return nil
+	}
+	_, err = db.Update(img, func() error {
+		img.SignatureStatus = status
+		img.SignedBy = signedBy
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "Update signature status")
+	}
+	switch status {
+	case api.IMAGE_SIGNATURE_STATUS_VERIFIED:
+		reason := fmt.Sprintf("signed by %s", signedBy)
+		db.OpsLog.LogEvent(img, db.ACT_VERIFY_SIGNATURE, reason, userCred)
+		logclient.AddSimpleActionLog(img, logclient.ACT_VERIFY_SIGNATURE, reason, userCred, true)
+	case api.IMAGE_SIGNATURE_STATUS_UNTRUSTED, api.IMAGE_SIGNATURE_STATUS_INVALID:
+		db.OpsLog.LogEvent(img, db.ACT_VERIFY_SIGNATURE_FAIL, reasons, userCred)
+		logclient.AddSimpleActionLog(img, logclient.ACT_VERIFY_SIGNATURE, reasons, userCred, false)
+	}
+	return nil
+}
+
+// 为镜像添加签名
+func (img *SImage) PerformAddSignature(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ImageSignatureInput) (jsonutils.JSONObject, error) {
+	input, err := ImageSignatureManager.ValidateSignatureInput(input)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ImageSignatureManager.newSignature(ctx, img.Id, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "newSignature")
+	}
+	db.OpsLog.LogEvent(img, db.ACT_ADD_SIGNATURE, sig.Format, userCred)
+	logclient.AddActionLogWithContext(ctx, img, logclient.ACT_ADD_SIGNATURE, sig.Format, userCred, true)
+	if len(img.Digest) > 0 {
+		err = img.verifySignatures(ctx, userCred)
+		if err != nil {
+			return nil, errors.Wrap(err, "verifySignatures")
+		}
+	}
+	// otherwise the signature is verified by the image pipeline once the digest is known
+	return nil, nil
+}
+
+// 使用当前受信任的公钥和证书重新验证镜像签名
+func (img *SImage) PerformVerifySignature(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ImageVerifySignatureInput) (jsonutils.JSONObject, error) {
+	if len(img.Digest) == 0 {
+		return nil, httperrors.NewInvalidStatusError("digest of image is unknown, probe the image first")
+	}
+	err := img.verifySignatures(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "verifySignatures")
+	}
+	return nil, nil
+}
+
+func (img *SImage) GetDetailsSignatures(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	sigs, err := ImageSignatureManager.GetSignatures(img.Id)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetSignatures")
+	}
+	output := api.ImageSignaturesOutput{
+		Digest:          img.Digest,
+		SignedFormat:    img.getSignedFormat(),
+		SignatureStatus: img.SignatureStatus,
+		SignedBy:        img.SignedBy,
+		Signatures:      make([]api.SImageSignature, len(sigs)),
+	}
+	for i := range sigs {
+		jsonutils.Update(&output.Signatures[i], sigs[i])
+	}
+	return jsonutils.Marshal(output), nil
+}
@@ -0,0 +1,441 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/stringutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/image"
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/image/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/fileutils2"
+)
+
+// +onecloud:swagger-gen-ignore
+type SImageUploadManager struct {
+	db.SResourceBaseManager
+}
+
+var ImageUploadManager *SImageUploadManager
+
+func init() {
+	ImageUploadManager = &SImageUploadManager{
+		SResourceBaseManager: db.NewResourceBaseManager(
+			SImageUpload{},
+			"image_uploads",
+			"image_upload",
+			"image_uploads",
+		),
+	}
+	ImageUploadManager.SetVirtualObject(ImageUploadManager)
+}
+
+// SImageUpload is an unfinished chunked upload of an image, chunks are
+// appended in order to a partial file which becomes the image file on finish
+type SImageUpload struct {
+	SImagePeripheral
+
+	// 上传会话ID
+	UploadId string `width:"36" charset:"ascii" nullable:"false" index:"true"`
+	// 镜像文件总大小
+	Size int64 `nullable:"false"`
+	// 已上传的字节数
+	Offset int64 `nullable:"false" default:"0"`
+	// 镜像文件的MD5校验和
+	Checksum string `width:"32" charset:"ascii" nullable:"true"`
+	// 过期时间
+	ExpiredAt time.Time `nullable:"false"`
+}
+
+func (manager *SImageUploadManager) getUploads(imageId string) ([]SImageUpload, error) {
+	uploads := make([]SImageUpload, 0)
+	q := manager.Query().Equals("image_id", imageId)
+	err := db.FetchModelObjects(manager, q, &uploads)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchModelObjects")
+	}
+	return uploads, nil
+}
+
+// fetchUpload returns the upload in progress of the image, uploadId is
+// checked if not empty
+func (manager *SImageUploadManager) fetchUpload(imageId string, uploadId string) (*SImageUpload, error) {
+	uploads, err := manager.getUploads(imageId)
+	if err != nil {
+		return nil, err
+	}
+	if len(uploads) == 0 {
+		return nil, httperrors.NewNotFoundError("no upload in progress for image %s", imageId)
+	}
+	upload := &uploads[0]
+	if len(uploadId) > 0 && upload.UploadId != uploadId {
+		return nil, httperrors.NewNotFoundError("upload %s not found", uploadId)
+	}
+	if upload.isExpired() {
+		return nil, httperrors.NewNotFoundError("upload %s expired", upload.UploadId)
+	}
+	return upload, nil
+}
+
+func (manager *SImageUploadManager) newUpload(ctx context.Context, img *SImage, input api.ImageStartUploadInput) (*SImageUpload, error) {
+	upload := SImageUpload{}
+	upload.SetModelManager(manager, &upload)
+	upload.ImageId = img.Id
+	upload.UploadId = stringutils.UUID4()
+	upload.Size = input.Size
+	upload.Checksum = input.Checksum
+	upload.ExpiredAt = getUploadExpiredAt()
+
+	fp, err := os.Create(img.getUploadPath())
+	if err != nil {
+		return nil, errors.Wrap(err, "create upload file")
+	}
+	fp.Close()
+
+	err = manager.TableSpec().Insert(ctx, &upload)
+	if err != nil {
+		return nil, errors.Wrap(err, "Insert")
+	}
+	return &upload, nil
+}
+
+// removeUploads discards the unfinished uploads of the image and the partial file
+func (manager *SImageUploadManager) removeUploads(ctx context.Context, userCred mcclient.TokenCredential, img *SImage) error {
+	uploads, err := manager.getUploads(img.Id)
+	if err != nil {
+		return errors.Wrap(err, "getUploads")
+	}
+	for i := range uploads {
+		err := uploads[i].Delete(ctx, userCred)
+		if err != nil {
+			return errors.Wrapf(err, "delete upload %s", uploads[i].UploadId)
+		}
+	}
+	uploadPath := img.getUploadPath()
+	if fileutils2.IsFile(uploadPath) {
+		err := os.Remove(uploadPath)
+		if err != nil {
+			return errors.Wrapf(err, "remove %s", uploadPath)
+		}
+	}
+	return nil
+}
+
+func (manager *SImageUploadManager) CleanExpiredUploads(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	uploads := make([]SImageUpload, 0)
+	q := manager.Query().LT("expired_at", time.Now().UTC())
+	err := db.FetchModelObjects(manager, q, &uploads)
+	if err != nil {
+		log.Errorf("fetch expired image uploads fail %s", err)
+		return
+	}
+	for i := range uploads {
+		model, err := ImageManager.FetchById(uploads[i].ImageId)
+		if err != nil {
+			log.Errorf("fetch image %s of upload %s fail %s", uploads[i].ImageId, uploads[i].UploadId, err)
+			continue
+		}
+		img := model.(*SImage)
+		err = manager.removeUploads(ctx, userCred, img)
+		if err != nil {
+			log.Errorf("remove expired uploads of image %s fail %s", img.Id, err)
+			continue
+		}
+		if img.Status == api.IMAGE_STATUS_UPLOADING {
+			img.OnSaveFailed(ctx, userCred, jsonutils.NewString(fmt.Sprintf("upload %s expired", uploads[i].UploadId)))
+		}
+	}
+}
+
+func getUploadExpiredAt() time.Time {
+	return time.Now().UTC().Add(time.Duration(options.Options.ImageUploadExpireSeconds) * time.Second)
+}
+
+func (upload *SImageUpload) isExpired() bool {
+	return upload.ExpiredAt.Before(time.Now().UTC())
+}
+
+func (upload *SImageUpload) getOutput() api.ImageUploadOutput {
+	return api.ImageUploadOutput{
+		UploadId:  upload.UploadId,
+		Size:      upload.Size,
+		Offset:    upload.Offset,
+		Checksum:  upload.Checksum,
+		ExpiredAt: upload.ExpiredAt,
+	}
+}
+
+// writeChunk appends a chunk at offset to the partial file, the partial file
+// is truncated back to offset if the chunk is short or corrupted
+func (upload *SImageUpload) writeChunk(uploadPath string, offset int64, reader io.Reader, size int64, checksum string) error {
+	fp, err := os.OpenFile(uploadPath, os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "open upload file")
+	}
+	defer fp.Close()
+
+	// discard the remains of a previously interrupted chunk
+	err = fp.Truncate(offset)
+	if err != nil {
+		return errors.Wrap(err, "truncate")
+	}
+	_, err = fp.Seek(offset, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "seek")
+	}
+	hash := md5.New()
+	n, err := io.Copy(io.MultiWriter(fp, hash), io.LimitReader(reader, size))
+	if err == nil && n != size {
+		err = errors.Wrapf(io.ErrUnexpectedEOF, "received %d of %d bytes", n, size)
+	}
+	if err == nil && len(checksum) > 0 && fmt.Sprintf("%x", hash.Sum(nil)) != strings.ToLower(checksum) {
+		err = httperrors.NewBadRequestError("chunk checksum mismatch")
+	}
+	if err != nil {
+		if e := fp.Truncate(offset); e != nil {
+			log.Errorf("truncate %s to %d fail %s", uploadPath, offset, e)
+		}
+		return err
+	}
+	return nil
+}
+
+func (self *SImage) getUploadPath() string {
+	return self.GetLocalPath("upload")
+}
+
+// 开始分片上传镜像, 对已开始的同样大小的上传返回其进度
+func (self *SImage) PerformStartUpload(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ImageStartUploadInput) (jsonutils.JSONObject, error) {
+	if input.Size <= 0 {
+		return nil, httperrors.NewInputParameterError("invalid size %d", input.Size)
+	}
+	if len(input.Checksum) > 0 && len(input.Checksum) != md5.Size*2 {
+		return nil, httperrors.NewInputParameterError("invalid md5 checksum %s", input.Checksum)
+	}
+	input.Checksum = strings.ToLower(input.Checksum)
+	if self.Status == api.IMAGE_STATUS_UPLOADING {
+		upload, err := ImageUploadManager.fetchUpload(self.Id, "")
+		if err != nil {
+			return nil, err
+		}
+		if upload.Size != input.Size || upload.Checksum != input.Checksum {
+			return nil, httperrors.NewConflictError("upload %s of another file is in progress", upload.UploadId)
+		}
+		return jsonutils.Marshal(upload.getOutput()), nil
+	}
+	if self.Status != api.IMAGE_STATUS_QUEUED {
+		return nil, httperrors.NewInvalidStatusError("cannot upload in status %s", self.Status)
+	}
+	upload, err := ImageUploadManager.newUpload(ctx, self, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "newUpload")
+	}
+	self.SetStatus(userCred, api.IMAGE_STATUS_UPLOADING, "start upload")
+	db.OpsLog.LogEvent(self, db.ACT_SAVING, fmt.Sprintf("start upload %s", upload.UploadId), userCred)
+	return jsonutils.Marshal(upload.getOutput()), nil
+}
+
+// checkChunk checks that a chunk of size bytes at offset continues the
+// upload and fits in the image
+func (upload *SImageUpload) checkChunk(offset int64, size int64) error {
+	if offset != upload.Offset {
+		return httperrors.NewConflictError("offset %d mismatch, %d bytes received", offset, upload.Offset)
+	}
+	if size <= 0 {
+		return httperrors.NewInputParameterError("empty chunk or missing Content-Length")
+	}
+	if upload.Offset+size > upload.Size {
+		return httperrors.NewInputParameterError("chunk exceeds image size %d", upload.Size)
+	}
+	return nil
+}
+
+// 上传一个镜像分片, 请求体为分片内容, 参数通过查询字符串传递
+func (self *SImage) UpdateUploadChunk(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	input := api.ImageUploadChunkInput{}
+	input.UploadId, _ = query.GetString("upload_id")
+	input.Checksum, _ = query.GetString("checksum")
+	offset, err := query.Int("offset")
+	if err != nil {
+		return nil, httperrors.NewMissingParameterError("offset")
+	}
+	input.Offset = offset
+	if len(input.UploadId) == 0 {
+		return nil, httperrors.NewMissingParameterError("upload_id")
+	}
+	if self.Status != api.IMAGE_STATUS_UPLOADING {
+		return nil, httperrors.NewInvalidStatusError("cannot upload chunk in status %s", self.Status)
+	}
+	upload, err := ImageUploadManager.fetchUpload(self.Id, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	// a retried chunk may arrive while the first one is still being written,
+	// the offset must be checked and advanced under the lock
+	lockman.LockObject(ctx, upload)
+	defer lockman.ReleaseObject(ctx, upload)
+
+	upload, err = ImageUploadManager.fetchUpload(self.Id, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	appParams := appsrv.AppContextGetParams(ctx)
+	size := int64(0)
+	if appParams != nil {
+		size = appParams.Request.ContentLength
+	}
+	err = upload.checkChunk(input.Offset, size)
+	if err != nil {
+		return nil, err
+	}
+	err = upload.writeChunk(self.getUploadPath(), upload.Offset, appParams.Request.Body, size, input.Checksum)
+	if err != nil {
+		return nil, errors.Wrapf(err, "write chunk at %d", upload.Offset)
+	}
+	_, err = db.Update(upload, func() error {
+		upload.Offset += size
+		upload.ExpiredAt = getUploadExpiredAt()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Update offset")
+	}
+	self.saveSize(upload.Offset, upload.Size)
+	return jsonutils.Marshal(upload.getOutput()), nil
+}
+
+func (self *SImage) GetDetailsUpload(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	upload, err := ImageUploadManager.fetchUpload(self.Id, "")
+	if err != nil {
+		return nil, err
+	}
+	return jsonutils.Marshal(upload.getOutput()), nil
+}
+
+// 完成分片上传, 由任务校验后进入镜像探测、转换和加密流程
+func (self *SImage) PerformFinishUpload(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ImageFinishUploadInput) (jsonutils.JSONObject, error) {
+	if self.Status != api.IMAGE_STATUS_UPLOADING {
+		return nil, httperrors.NewInvalidStatusError("cannot finish upload in status %s", self.Status)
+	}
+	upload, err := ImageUploadManager.fetchUpload(self.Id, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+
+	lockman.LockObject(ctx, upload)
+	defer lockman.ReleaseObject(ctx, upload)
+
+	upload, err = ImageUploadManager.fetchUpload(self.Id, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Offset != upload.Size {
+		return nil, httperrors.NewInvalidStatusError("%d of %d bytes received", upload.Offset, upload.Size)
+	}
+	self.SetStatus(userCred, api.IMAGE_STATUS_SAVING, "finish upload")
+
+	params := jsonutils.NewDict()
+	params.Set("upload_id", jsonutils.NewString(upload.UploadId))
+	task, err := taskman.TaskManager.NewTask(ctx, "ImageFinishUploadTask", self, userCred, params, "", "", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewTask")
+	}
+	task.ScheduleRun(nil)
+	return nil, nil
+}
+
+// FinishUpload verifies the received file of the upload and makes it the
+// image file, it may take long for large images
+func (self *SImage) FinishUpload(ctx context.Context, userCred mcclient.TokenCredential, uploadId string) error {
+	uploads, err := ImageUploadManager.getUploads(self.Id)
+	if err != nil {
+		return errors.Wrap(err, "getUploads")
+	}
+	if len(uploads) == 0 || uploads[0].UploadId != uploadId {
+		return errors.Wrapf(httperrors.ErrNotFound, "upload %s", uploadId)
+	}
+	upload := &uploads[0]
+
+	localPath := self.GetLocalPath("")
+	err = func() error {
+		calChecksum := self.IsData.IsFalse() || len(upload.Checksum) > 0
+		checksum := ""
+		if calChecksum {
+			checksum, err = fileutils2.MD5(self.getUploadPath())
+			if err != nil {
+				return errors.Wrap(err, "md5")
+			}
+			if len(upload.Checksum) > 0 && checksum != upload.Checksum {
+				return errors.Errorf("checksum mismatch, expect %s got %s", upload.Checksum, checksum)
+			}
+		}
+		err = os.Rename(self.getUploadPath(), localPath)
+		if err != nil {
+			return errors.Wrap(err, "rename upload file")
+		}
+		return self.saveImageFile(localPath, upload.Size, checksum, calChecksum)
+	}()
+	if e := ImageUploadManager.removeUploads(ctx, userCred, self); e != nil {
+		log.Errorf("remove uploads of image %s fail %s", self.Id, e)
+	}
+	if err != nil {
+		if fileutils2.IsFile(localPath) {
+			if e := os.Remove(localPath); e != nil {
+				log.Errorf("remove failed file %s error: %v", localPath, e)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// 放弃分片上传, 镜像恢复为queued状态
+func (self *SImage) PerformAbortUpload(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ImageAbortUploadInput) (jsonutils.JSONObject, error) {
+	_, err := ImageUploadManager.fetchUpload(self.Id, input.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	err = ImageUploadManager.removeUploads(ctx, userCred, self)
+	if err != nil {
+		return nil, errors.Wrap(err, "removeUploads")
+	}
+	_, err = db.Update(self, func() error {
+		self.Size = 0
+		self.Progress = 0
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Update")
+	}
+	self.SetStatus(userCred, api.IMAGE_STATUS_QUEUED, "abort upload")
+	return nil, nil
+}
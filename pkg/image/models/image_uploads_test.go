@@ -0,0 +1,112 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+func TestImageUploadWriteChunk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-upload")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	uploadPath := filepath.Join(dir, "upload")
+	err = ioutil.WriteFile(uploadPath, nil, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	upload := &SImageUpload{Size: 12}
+	first := []byte("abcd")
+	second := []byte("efgh")
+	md5sum := func(data []byte) string {
+		return fmt.Sprintf("%x", md5.Sum(data))
+	}
+	expectContent := func(name string, want []byte) {
+		got, err := ioutil.ReadFile(uploadPath)
+		if err != nil {
+			t.Fatalf("%s: ReadFile: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: content %q, want %q", name, got, want)
+		}
+	}
+
+	err = upload.writeChunk(uploadPath, 0, bytes.NewReader(first), int64(len(first)), md5sum(first))
+	if err != nil {
+		t.Fatalf("first chunk: %v", err)
+	}
+	expectContent("first chunk", first)
+
+	// corrupted chunk is truncated away
+	err = upload.writeChunk(uploadPath, 4, bytes.NewReader([]byte("efgX")), int64(len(second)), md5sum(second))
+	if errors.Cause(err) != httperrors.ErrBadRequest {
+		t.Errorf("corrupted chunk: got error %v, want bad request", err)
+	}
+	expectContent("corrupted chunk", first)
+
+	// short body is truncated away
+	err = upload.writeChunk(uploadPath, 4, bytes.NewReader([]byte("ef")), int64(len(second)), "")
+	if err == nil {
+		t.Errorf("short chunk: want error")
+	}
+	expectContent("short chunk", first)
+
+	// a retry overwrites the remains of an interrupted chunk
+	err = ioutil.WriteFile(uploadPath, []byte("abcdef"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	err = upload.writeChunk(uploadPath, 4, bytes.NewReader(second), int64(len(second)), md5sum(second))
+	if err != nil {
+		t.Fatalf("retried chunk: %v", err)
+	}
+	expectContent("retried chunk", []byte("abcdefgh"))
+}
+
+func TestImageUploadCheckChunk(t *testing.T) {
+	upload := &SImageUpload{Size: 12, Offset: 4}
+	cases := []struct {
+		name   string
+		offset int64
+		size   int64
+		want   error
+	}{
+		{"next chunk", 4, 4, nil},
+		{"last chunk", 4, 8, nil},
+		{"resent chunk", 0, 4, httperrors.ErrConflict},
+		{"skipped chunk", 8, 4, httperrors.ErrConflict},
+		{"empty chunk", 4, 0, httperrors.ErrInputParameter},
+		{"oversized chunk", 4, 9, httperrors.ErrInputParameter},
+	}
+	for _, c := range cases {
+		err := upload.checkChunk(c.offset, c.size)
+		if errors.Cause(err) != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
@@ -153,13 +153,20 @@ type SImage struct {
 
 	// 加密状态, "",encrypting,encrypted
 	EncryptStatus string `width:"16" charset:"ascii" nullable:"true" get:"user" list:"user"`
+
+	// 镜像文件的SHA256摘要, 签名针对该摘要
+	Digest string `width:"64" charset:"ascii" nullable:"true" get:"user" list:"user"`
+	// 签名验证状态, unsigned,verified,untrusted,invalid
+	SignatureStatus string `width:"16" charset:"ascii" nullable:"true" default:"unsigned" get:"user" list:"user"`
+	// 签名者
+	SignedBy string `width:"255" charset:"utf8" nullable:"true" get:"user" list:"user"`
 }
 
 func (manager *SImageManager) CustomizeHandlerInfo(info *appsrv.SHandlerInfo) {
 	manager.SSharableVirtualResourceBaseManager.CustomizeHandlerInfo(info)
 
 	switch info.GetName(nil) {
-	case "get_details", "create", "update":
+	case "get_details", "create", "update", "update_spec":
 		info.SetProcessTimeout(time.Minute * 120).SetWorkerManager(imgStreamingWorkerMan)
 	}
 }
@@ -392,6 +399,18 @@ func (manager *SImageManager) ValidateCreateData(
 	if err != nil {
 		return input, errors.Wrap(err, "SEncryptedResourceManager.ValidateCreateData")
 	}
+	if len(input.Signature) > 0 {
+		input.ImageSignatureInput, err = ImageSignatureManager.ValidateSignatureInput(input.ImageSignatureInput)
+		if err != nil {
+			return input, err
+		}
+	}
+	if len(input.OciReference) > 0 {
+		input.ImageOciInput, err = validateOciInput(input.ImageOciInput)
+		if err != nil {
+			return input, err
+		}
+	}
 
 	// If this image is the part of guest image (contains "guest_image_id"),
 	// we do not need to check and set pending quota
@@ -528,54 +547,59 @@ func (self *SImage) SaveImageFromStream(reader io.Reader, totalSize int64, calCh
 		if err != nil {
 			return errors.Wrapf(err, "saveImageFromStream")
 		}
+		return self.saveImageFile(localPath, sp.Size, sp.CheckSum, calChecksum)
+	}()
+	if err != nil {
+		if fileutils2.IsFile(localPath) {
+			if e := os.Remove(localPath); e != nil {
+				log.Errorf("remove failed file %s error: %v", localPath, err)
+			}
+		}
+	}
 
-		virtualSizeBytes := int64(0)
-		format := ""
-		img, err := qemuimg.NewQemuImage(localPath)
+	return err
+}
+
+// saveImageFile probes the image file saved at localPath and records its
+// location, format and size
+func (self *SImage) saveImageFile(localPath string, size int64, checksum string, calChecksum bool) error {
+	virtualSizeBytes := int64(0)
+	format := ""
+	img, err := qemuimg.NewQemuImage(localPath)
+	if err != nil {
+		return err
+	}
+	format = string(img.Format)
+	virtualSizeBytes = img.SizeBytes
+
+	var fastChksum string
+	if calChecksum {
+		fastChksum, err = fileutils2.FastCheckSum(localPath)
 		if err != nil {
-			return err
+			return errors.Wrapf(err, "FastCheckSum %s", localPath)
 		}
-		format = string(img.Format)
-		virtualSizeBytes = img.SizeBytes
+	}
 
-		var fastChksum string
+	_, err = db.Update(self, func() error {
+		self.Size = size
 		if calChecksum {
-			fastChksum, err = fileutils2.FastCheckSum(localPath)
-			if err != nil {
-				return errors.Wrapf(err, "FastCheckSum %s", localPath)
-			}
+			self.Checksum = checksum
+			self.FastHash = fastChksum
 		}
-
-		_, err = db.Update(self, func() error {
-			self.Size = sp.Size
-			if calChecksum {
-				self.Checksum = sp.CheckSum
-				self.FastHash = fastChksum
-			}
-			self.Location = fmt.Sprintf("%s%s", LocalFilePrefix, localPath)
-			if len(format) > 0 {
-				self.DiskFormat = format
-			}
-			if virtualSizeBytes > 0 {
-				self.MinDiskMB = int32(math.Ceil(float64(virtualSizeBytes) / 1024 / 1024))
-			}
-			return nil
-		})
-		if err != nil {
-			return errors.Wrapf(err, "db.Update")
+		self.Location = fmt.Sprintf("%s%s", LocalFilePrefix, localPath)
+		if len(format) > 0 {
+			self.DiskFormat = format
+		}
+		if virtualSizeBytes > 0 {
+			self.MinDiskMB = int32(math.Ceil(float64(virtualSizeBytes) / 1024 / 1024))
 		}
-
 		return nil
-	}()
+	})
 	if err != nil {
-		if fileutils2.IsFile(localPath) {
-			if e := os.Remove(localPath); e != nil {
-				log.Errorf("remove failed file %s error: %v", localPath, err)
-			}
-		}
+		return errors.Wrapf(err, "db.Update")
 	}
 
-	return err
+	return nil
 }
 
 func (self *SImage) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
@@ -617,6 +641,16 @@ func (self *SImage) PostCreate(ctx context.Context, userCred mcclient.TokenCrede
 		}
 	}
 
+	if data.Contains("signature") {
+		input := api.ImageSignatureInput{}
+		data.Unmarshal(&input)
+		_, err := ImageSignatureManager.newSignature(ctx, self.Id, input)
+		if err != nil {
+			self.OnSaveFailed(ctx, userCred, jsonutils.NewString(fmt.Sprintf("save signature fail %s", err)))
+			return
+		}
+	}
+
 	appParams := appsrv.AppContextGetParams(ctx)
 	if appParams.Request.ContentLength > 0 {
 		db.OpsLog.LogEvent(self, db.ACT_SAVING, "create upload", userCred)
@@ -634,6 +668,13 @@ func (self *SImage) PostCreate(ctx context.Context, userCred mcclient.TokenCrede
 		copyFrom := appParams.Request.Header.Get(modules.IMAGE_META_COPY_FROM)
 		if len(copyFrom) > 0 {
 			self.startImageCopyFromUrlTask(ctx, userCred, copyFrom, "")
+		} else if data.Contains("oci_reference") {
+			input := api.ImageOciInput{}
+			data.Unmarshal(&input)
+			err := self.startImageImportOciTask(ctx, userCred, input, "")
+			if err != nil {
+				self.OnSaveFailed(ctx, userCred, jsonutils.NewString(fmt.Sprintf("import from oci fail %s", err)))
+			}
 		}
 	}
 }
@@ -1205,6 +1246,11 @@ func (self *SImage) Remove(ctx context.Context, userCred mcclient.TokenCredentia
 		}
 	}
 
+	err := ImageUploadManager.removeUploads(ctx, userCred, self)
+	if err != nil {
+		return errors.Wrap(err, "removeUploads")
+	}
+
 	// 考虑镜像下载中断情况
 	if len(self.Location) == 0 || strings.HasPrefix(self.Location, LocalFilePrefix) {
 		return self.RemoveFile()
@@ -1991,6 +2037,13 @@ func (img *SImage) Pipeline(ctx context.Context, userCred mcclient.TokenCredenti
 	} else {
 		log.Debugf("skipProbe image...")
 	}
+	// do verify signatures, before the image is altered by encryption
+	{
+		err := img.doVerifySignatures(ctx, userCred)
+		if err != nil {
+			return errors.Wrap(err, "doVerifySignatures")
+		}
+	}
 	// do encrypt
 	{
 		altered, err := img.doEncrypt(ctx, userCred)
@@ -38,6 +38,9 @@ type SImageOptions struct {
 
 	TargetImageFormats []string `help:"target image formats that the system will automatically convert to" default:"qcow2,vmdk"`
 
+	ImageUploadExpireSeconds int `help:"Seconds an unfinished chunked image upload is kept after its last chunk" default:"86400"`
+	ImageUploadCheckSeconds  int `help:"Interval in seconds to clean up expired chunked image uploads" default:"3600"`
+
 	TorrentClientPath string `help:"path to torrent executable" default:"/opt/yunion/bin/torrent"`
 
 	// DeployServerSocketPath string `help:"Deploy server listen socket path" default:"/var/run/onecloud/deploy.sock"`
@@ -59,6 +59,8 @@ func InitHandlers(app *appsrv.Application) {
 		models.ImageMemberManager,
 		models.ImagePropertyManager,
 		models.ImageSubformatManager,
+		models.ImageSignatureManager,
+		models.ImageUploadManager,
 
 		models.GuestImageJointManager,
 
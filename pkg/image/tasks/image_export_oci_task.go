@@ -0,0 +1,80 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/image/models"
+	"yunion.io/x/onecloud/pkg/util/logclient"
+)
+
+type ImageExportOciTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(ImageExportOciTask{})
+}
+
+func (self *ImageExportOciTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+
+	reference, _ := self.Params.GetString("oci_reference")
+
+	log.Infof("Export image %s to oci %s", image.Id, reference)
+
+	self.SetStage("OnImageExportComplete", nil)
+	taskman.LocalTaskRun(self, func() (jsonutils.JSONObject, error) {
+		digest, err := image.ExportToOci(ctx, self.Params)
+		if err != nil {
+			return nil, err
+		}
+		ret := jsonutils.NewDict()
+		ret.Set("digest", jsonutils.NewString(digest))
+		return ret, nil
+	})
+}
+
+func (self *ImageExportOciTask) OnImageExportComplete(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	reference, _ := self.Params.GetString("oci_reference")
+	format, _ := self.Params.GetString("format")
+	notes := jsonutils.NewDict()
+	notes.Add(jsonutils.NewString(reference), "oci_reference")
+	notes.Add(jsonutils.NewString(format), "format")
+	if digest, _ := data.GetString("digest"); len(digest) > 0 {
+		notes.Add(jsonutils.NewString(digest), "digest")
+	}
+	db.OpsLog.LogEvent(image, db.ACT_EXPORT_OCI, notes, self.UserCred)
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_EXPORT_OCI, notes, self.UserCred, true)
+	self.SetStageComplete(ctx, notes)
+}
+
+func (self *ImageExportOciTask) OnImageExportCompleteFailed(ctx context.Context, obj db.IStandaloneModel, err jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	reference, _ := self.Params.GetString("oci_reference")
+	msg := jsonutils.NewDict()
+	msg.Add(err, "reason")
+	msg.Add(jsonutils.NewString(reference), "oci_reference")
+	db.OpsLog.LogEvent(image, db.ACT_EXPORT_OCI_FAIL, msg, self.UserCred)
+	logclient.AddActionLogWithStartable(self, image, logclient.ACT_IMAGE_EXPORT_OCI, msg, self.UserCred, false)
+	self.SetStageFailed(ctx, msg)
+}
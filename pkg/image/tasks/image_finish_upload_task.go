@@ -0,0 +1,61 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/image/models"
+)
+
+type ImageFinishUploadTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(ImageFinishUploadTask{})
+}
+
+func (self *ImageFinishUploadTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+
+	uploadId, _ := self.Params.GetString("upload_id")
+
+	self.SetStage("OnFinishUploadComplete", nil)
+	taskman.LocalTaskRun(self, func() (jsonutils.JSONObject, error) {
+		return nil, image.FinishUpload(ctx, self.UserCred, uploadId)
+	})
+}
+
+func (self *ImageFinishUploadTask) OnFinishUploadComplete(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	image.OnSaveTaskSuccess(self, self.UserCred, "finish upload success")
+	image.StartImagePipeline(ctx, self.UserCred, false)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *ImageFinishUploadTask) OnFinishUploadCompleteFailed(ctx context.Context, obj db.IStandaloneModel, err jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	uploadId, _ := self.Params.GetString("upload_id")
+	msg := jsonutils.NewDict()
+	msg.Add(err, "reason")
+	msg.Add(jsonutils.NewString(uploadId), "upload_id")
+	image.OnSaveTaskFailed(self, self.UserCred, msg)
+	self.SetStageFailed(ctx, msg)
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tasks
+
+import (
+	"context"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/taskman"
+	"yunion.io/x/onecloud/pkg/image/models"
+)
+
+type ImageImportOciTask struct {
+	taskman.STask
+}
+
+func init() {
+	taskman.RegisterTask(ImageImportOciTask{})
+}
+
+func (self *ImageImportOciTask) OnInit(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+
+	reference, _ := self.Params.GetString("oci_reference")
+
+	log.Infof("Import image from oci %s", reference)
+
+	self.SetStage("OnImageImportComplete", nil)
+	taskman.LocalTaskRun(self, func() (jsonutils.JSONObject, error) {
+		return nil, image.ImportFromOci(ctx, self.UserCred, self.Params)
+	})
+}
+
+func (self *ImageImportOciTask) OnImageImportComplete(ctx context.Context, obj db.IStandaloneModel, data jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	image.OnSaveTaskSuccess(self, self.UserCred, "import from oci success")
+	image.StartImagePipeline(ctx, self.UserCred, false)
+	self.SetStageComplete(ctx, nil)
+}
+
+func (self *ImageImportOciTask) OnImageImportCompleteFailed(ctx context.Context, obj db.IStandaloneModel, err jsonutils.JSONObject) {
+	image := obj.(*models.SImage)
+	reference, _ := self.Params.GetString("oci_reference")
+	msg := jsonutils.NewDict()
+	msg.Add(err, "reason")
+	msg.Add(jsonutils.NewString(reference), "oci_reference")
+	image.OnSaveTaskFailed(self, self.UserCred, msg)
+	self.SetStageFailed(ctx, msg)
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/gotypes"
 	"yunion.io/x/pkg/tristate"
@@ -119,6 +120,28 @@ func (manager *SCredentialManager) ValidateCreateData(
 	if len(input.Type) == 0 {
 		return input, httperrors.NewInputParameterError("missing input field type")
 	}
+	switch input.Type {
+	case api.USED_TOKEN_TYPE, api.OIDC_DEVICE_TYPE:
+		if db.IsAdminAllowCreate(userCred, manager).Result.IsDeny() {
+			return input, httperrors.NewForbiddenError("not allow to create %s credential", input.Type)
+		}
+		if len(input.Name) == 0 {
+			return input, httperrors.NewMissingParameterError("name")
+		}
+		// creation is serialized by the class lock of the owner, so that
+		// a name can only be recorded once among all apigateway instances
+		cnt, err := manager.Query().Equals("type", input.Type).Equals("name", input.Name).CountWithError()
+		if err != nil {
+			return input, httperrors.NewGeneralError(err)
+		}
+		if cnt > 0 {
+			return input, httperrors.NewDuplicateNameError(manager.Keyword(), input.Name)
+		}
+	case api.WEBAUTHN_ENROLLMENT_TYPE:
+		if db.IsDomainAllowCreate(userCred, manager).Result.IsDeny() {
+			return input, httperrors.NewForbiddenError("not allow to issue webauthn enrollment tokens")
+		}
+	}
 	projectId := input.ProjectId
 	userId := ownerId.GetUserId()
 	if len(userId) == 0 {
@@ -173,9 +196,40 @@ func (self *SCredential) ValidateUpdateData(ctx context.Context, userCred mcclie
 		return input, errors.Wrap(err, "SStandaloneResourceBase.ValidateUpdateData")
 	}
 
+	if len(input.Blob) > 0 {
+		if self.Type != api.WEBAUTHN_TYPE && self.Type != api.OIDC_DEVICE_TYPE {
+			return input, httperrors.NewForbiddenError("blob of %s credential is immutable", self.Type)
+		}
+		_, err := jsonutils.ParseString(input.Blob)
+		if err != nil {
+			return input, httperrors.NewInputParameterError("invalid blob: %s", err)
+		}
+	}
+
 	return input, nil
 }
 
+func (self *SCredential) PostUpdate(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, data jsonutils.JSONObject) {
+	self.SStandaloneResourceBase.PostUpdate(ctx, userCred, query, data)
+
+	blob, _ := data.GetString("blob")
+	if len(blob) > 0 && (self.Type == api.WEBAUTHN_TYPE || self.Type == api.OIDC_DEVICE_TYPE) {
+		blobEnc, err := keys.CredentialKeyManager.Encrypt([]byte(blob))
+		if err != nil {
+			log.Errorf("encrypt credential blob fail %s", err)
+			return
+		}
+		_, err = db.Update(self, func() error {
+			self.EncryptedBlob = string(blobEnc)
+			self.KeyHash = keys.CredentialKeyManager.PrimaryKeyHash()
+			return nil
+		})
+		if err != nil {
+			log.Errorf("update credential blob fail %s", err)
+		}
+	}
+}
+
 func (manager *SCredentialManager) FetchCustomizeColumns(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
@@ -350,6 +404,32 @@ func (manager *SCredentialManager) FetchCredentials(uid string, credType string)
 	return ret, nil
 }
 
+// PurgeExpiredTokens removes the used tokens, webauthn enrollment tokens and
+// oidc device authorizations that have expired
+func (manager *SCredentialManager) PurgeExpiredTokens(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	q := manager.Query().In("type", []string{api.USED_TOKEN_TYPE, api.WEBAUTHN_ENROLLMENT_TYPE, api.OIDC_DEVICE_TYPE})
+	creds := make([]SCredential, 0)
+	err := db.FetchModelObjects(manager, q, &creds)
+	if err != nil {
+		log.Errorf("PurgeExpiredTokens fetch credentials fail %s", err)
+		return
+	}
+	for i := range creds {
+		blob := api.SExpirableTokenBlob{}
+		blobJson, err := jsonutils.Parse(creds[i].getBlob())
+		if err == nil {
+			err = blobJson.Unmarshal(&blob)
+		}
+		if err == nil && !blob.IsExpired() {
+			continue
+		}
+		err = creds[i].Delete(ctx, userCred)
+		if err != nil {
+			log.Errorf("delete expired credential %s fail %s", creds[i].Id, err)
+		}
+	}
+}
+
 func (manager *SCredentialManager) DeleteAll(ctx context.Context, userCred mcclient.TokenCredential, uid string, credType string) error {
 	creds, err := manager.FetchCredentials(uid, credType)
 	if err != nil {
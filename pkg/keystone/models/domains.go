@@ -23,6 +23,7 @@ import (
 	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/tristate"
+	"yunion.io/x/pkg/utils"
 	"yunion.io/x/sqlchemy"
 
 	api "yunion.io/x/onecloud/pkg/apis/identity"
@@ -71,6 +72,12 @@ type SDomain struct {
 
 	DomainId string `width:"64" charset:"ascii" default:"default" nullable:"false" index:"true"`
 	ParentId string `width:"64" charset:"ascii"`
+
+	// 是否要求具有域或系统管理权限的用户使用WebAuthn进行二次认证
+	AdminRequireWebauthn tristate.TriState `default:"false" list:"domain" create:"admin_optional"`
+
+	// 镜像签名策略, none: 不限制, enforce: 只允许使用签名验证通过的镜像创建虚拟机
+	ImageSignaturePolicy string `width:"16" charset:"ascii" default:"none" list:"domain" create:"admin_optional"`
 }
 
 func (manager *SDomainManager) InitializeData() error {
@@ -533,9 +540,73 @@ func (manager *SDomainManager) ValidateCreateData(
 		return input, errors.Wrap(err, "SStandaloneResourceBaseManager.ValidateCreateData")
 	}
 
+	if len(input.ImageSignaturePolicy) > 0 && !utils.IsInStringArray(input.ImageSignaturePolicy, api.IMAGE_SIGNATURE_POLICIES) {
+		return input, httperrors.NewInputParameterError("invalid image_signature_policy %s, must be one of %s", input.ImageSignaturePolicy, api.IMAGE_SIGNATURE_POLICIES)
+	}
+
 	return input, nil
 }
 
+func (domain *SDomain) AllowPerformMfaPolicy(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.DomainMfaPolicyInput,
+) bool {
+	return db.IsAdminAllowPerform(ctx, userCred, domain, "mfa-policy")
+}
+
+// 设置域的多因素认证策略
+func (domain *SDomain) PerformMfaPolicy(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.DomainMfaPolicyInput,
+) (jsonutils.JSONObject, error) {
+	if input.AdminRequireWebauthn == nil {
+		return nil, nil
+	}
+	_, err := db.Update(domain, func() error {
+		domain.AdminRequireWebauthn = tristate.NewFromBool(*input.AdminRequireWebauthn)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Update")
+	}
+	logclient.AddActionLogWithContext(ctx, domain, logclient.ACT_UPDATE, input, userCred, true)
+	return nil, nil
+}
+
+func (domain *SDomain) AllowPerformImageSignaturePolicy(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.DomainImageSignaturePolicyInput,
+) bool {
+	return db.IsAdminAllowPerform(ctx, userCred, domain, "image-signature-policy")
+}
+
+// 设置域的镜像签名策略
+func (domain *SDomain) PerformImageSignaturePolicy(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	input api.DomainImageSignaturePolicyInput,
+) (jsonutils.JSONObject, error) {
+	if !utils.IsInStringArray(input.ImageSignaturePolicy, api.IMAGE_SIGNATURE_POLICIES) {
+		return nil, httperrors.NewInputParameterError("invalid image_signature_policy %s, must be one of %s", input.ImageSignaturePolicy, api.IMAGE_SIGNATURE_POLICIES)
+	}
+	_, err := db.Update(domain, func() error {
+		domain.ImageSignaturePolicy = input.ImageSignaturePolicy
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Update")
+	}
+	logclient.AddActionLogWithContext(ctx, domain, logclient.ACT_UPDATE, input, userCred, true)
+	return nil, nil
+}
+
 func (domain *SDomain) AllowPerformUnlinkIdp(
 	ctx context.Context,
 	userCred mcclient.TokenCredential,
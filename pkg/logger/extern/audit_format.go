@@ -0,0 +1,242 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extern
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+)
+
+const (
+	DefaultAuditAppName = "cloudaudit"
+	DefaultAuditSdId    = "cloudaudit@32473"
+	// log audit
+	DefaultAuditFacility = 13
+
+	cefVendor  = "Yunion"
+	cefProduct = "Cloudpods"
+)
+
+// syslogSeverity maps event severities to the RFC5424 severity codes
+func syslogSeverity(severity api.TEventSeverity, success bool) int {
+	switch severity {
+	case api.SeverityEmergency:
+		return 0
+	case api.SeverityAlert:
+		return 1
+	case api.SeverityCritical:
+		return 2
+	case api.SeverityError:
+		return 3
+	case api.SeverityWarning:
+		return 4
+	case api.SeverityNotice:
+		return 5
+	case api.SeverityInfo:
+		return 6
+	case api.SeverityDebug:
+		return 7
+	}
+	if success {
+		return 6
+	}
+	return 3
+}
+
+// cefSeverity maps event severities to the 0-10 CEF severity scale
+func cefSeverity(severity api.TEventSeverity, success bool) int {
+	switch severity {
+	case api.SeverityEmergency:
+		return 10
+	case api.SeverityAlert:
+		return 9
+	case api.SeverityCritical:
+		return 8
+	case api.SeverityError:
+		return 7
+	case api.SeverityWarning:
+		return 5
+	case api.SeverityNotice:
+		return 3
+	case api.SeverityInfo:
+		return 1
+	case api.SeverityDebug:
+		return 0
+	}
+	if success {
+		return 1
+	}
+	return 7
+}
+
+func auditDescription(rec *api.AuditRecord) string {
+	desc := fmt.Sprintf("%s %s %s(%s)", rec.Action, rec.ObjType, rec.ObjName, rec.ObjId)
+	if len(rec.Notes) > 0 {
+		desc = fmt.Sprintf("%s: %s", desc, rec.Notes)
+	}
+	return desc
+}
+
+// syslogHeaderField returns a RFC5424 header field, which must be printable
+// US-ASCII without spaces, "-" stands for nil value
+func syslogHeaderField(val string, maxLen int) string {
+	var buf strings.Builder
+	for _, c := range val {
+		if c > 32 && c < 127 {
+			buf.WriteRune(c)
+		}
+		if buf.Len() >= maxLen {
+			break
+		}
+	}
+	if buf.Len() == 0 {
+		return "-"
+	}
+	return buf.String()
+}
+
+var sdParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// FormatRFC5424 formats the record as a RFC5424 syslog message, the audit
+// fields are carried in the structured data element sdId
+func FormatRFC5424(rec *api.AuditRecord, hostname, appName, sdId string, facility int) string {
+	if len(appName) == 0 {
+		appName = DefaultAuditAppName
+	}
+	if len(sdId) == 0 {
+		sdId = DefaultAuditSdId
+	}
+	pri := facility*8 + syslogSeverity(rec.Severity, rec.Success)
+	params := []struct {
+		key string
+		val string
+	}{
+		{"id", strconv.FormatInt(rec.Id, 10)},
+		{"service", rec.Service},
+		{"action", rec.Action},
+		{"obj_type", rec.ObjType},
+		{"obj_id", rec.ObjId},
+		{"obj_name", rec.ObjName},
+		{"success", strconv.FormatBool(rec.Success)},
+		{"severity", string(rec.Severity)},
+		{"kind", string(rec.Kind)},
+		{"user_id", rec.UserId},
+		{"user", rec.User},
+		{"domain_id", rec.DomainId},
+		{"tenant_id", rec.ProjectId},
+		{"tenant", rec.Project},
+		{"owner_tenant_id", rec.OwnerProjectId},
+		{"ip", rec.Ip},
+		{"start_time", rec.StartTime.UTC().Format(time.RFC3339)},
+		{"hash", rec.Hash},
+		{"prev_hash", rec.PrevHash},
+	}
+	var sd strings.Builder
+	sd.WriteString("[")
+	sd.WriteString(syslogHeaderField(sdId, 32))
+	for _, p := range params {
+		if len(p.val) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sd, ` %s="%s"`, p.key, sdParamEscaper.Replace(p.val))
+	}
+	sd.WriteString("]")
+	return fmt.Sprintf("<%d>1 %s %s %s - %s %s %s",
+		pri,
+		rec.OpsTime.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(appName, 48),
+		syslogHeaderField(rec.Action, 32),
+		sd.String(),
+		auditDescription(rec),
+	)
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// FormatCEF formats the record as an ArcSight Common Event Format message
+func FormatCEF(rec *api.AuditRecord, version string) string {
+	outcome := "success"
+	if !rec.Success {
+		outcome = "failure"
+	}
+	exts := []struct {
+		key string
+		val string
+	}{
+		{"rt", strconv.FormatInt(rec.OpsTime.UnixNano()/int64(time.Millisecond), 10)},
+		{"start", strconv.FormatInt(rec.StartTime.UnixNano()/int64(time.Millisecond), 10)},
+		{"externalId", strconv.FormatInt(rec.Id, 10)},
+		{"act", rec.Action},
+		{"outcome", outcome},
+		{"cat", string(rec.Kind)},
+		{"suser", rec.User},
+		{"suid", rec.UserId},
+		{"src", rec.Ip},
+		{"cs1Label", "service"},
+		{"cs1", rec.Service},
+		{"cs2Label", "objType"},
+		{"cs2", rec.ObjType},
+		{"cs3Label", "objId"},
+		{"cs3", rec.ObjId},
+		{"cs4Label", "objName"},
+		{"cs4", rec.ObjName},
+		{"cs5Label", "tenantId"},
+		{"cs5", rec.ProjectId},
+		{"cs6Label", "hash"},
+		{"cs6", rec.Hash},
+		{"msg", rec.Notes},
+	}
+	parts := make([]string, 0, len(exts))
+	for _, e := range exts {
+		if len(e.val) == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", e.key, cefExtensionEscaper.Replace(e.val)))
+	}
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefVendor,
+		cefProduct,
+		cefHeaderEscaper.Replace(version),
+		cefHeaderEscaper.Replace(fmt.Sprintf("%s.%s", rec.Service, rec.Action)),
+		cefHeaderEscaper.Replace(fmt.Sprintf("%s %s", rec.Action, rec.ObjType)),
+		cefSeverity(rec.Severity, rec.Success),
+		strings.Join(parts, " "),
+	)
+}
+
+// FormatCEFSyslog wraps a CEF message in a RFC5424 syslog frame without
+// structured data
+func FormatCEFSyslog(rec *api.AuditRecord, hostname, appName, version string, facility int) string {
+	if len(appName) == 0 {
+		appName = DefaultAuditAppName
+	}
+	pri := facility*8 + syslogSeverity(rec.Severity, rec.Success)
+	return fmt.Sprintf("<%d>1 %s %s %s - %s - %s",
+		pri,
+		rec.OpsTime.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		syslogHeaderField(hostname, 255),
+		syslogHeaderField(appName, 48),
+		syslogHeaderField(rec.Action, 32),
+		FormatCEF(rec, version),
+	)
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extern
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+)
+
+func testAuditRecord() *api.AuditRecord {
+	tm := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	return &api.AuditRecord{
+		Id:        20220304050607000,
+		OpsTime:   tm,
+		StartTime: tm,
+		Service:   "compute",
+		Action:    "delete",
+		ObjType:   "server",
+		ObjId:     "s1",
+		ObjName:   `vm "a"]`,
+		Notes:     "a=b|c\nd",
+		Success:   false,
+		Severity:  api.SeverityWarning,
+		Kind:      api.KindNormal,
+		User:      "admin",
+		Ip:        "10.0.0.1",
+		Hash:      "abc",
+	}
+}
+
+func TestFormatRFC5424(t *testing.T) {
+	msg := FormatRFC5424(testAuditRecord(), "host1", "", "", DefaultAuditFacility)
+	// facility 13 * 8 + warning 4
+	prefix := "<108>1 2022-03-04T05:06:07.000Z host1 cloudaudit - delete [cloudaudit@32473 id=\"20220304050607000\""
+	if !strings.HasPrefix(msg, prefix) {
+		t.Fatalf("unexpected header: %s", msg)
+	}
+	if !strings.Contains(msg, `obj_name="vm \"a\"\]"`) {
+		t.Errorf("structured data not escaped: %s", msg)
+	}
+	if !strings.Contains(msg, ` success="false" `) || strings.Contains(msg, "tenant_id=") {
+		t.Errorf("unexpected structured data: %s", msg)
+	}
+	if !strings.HasSuffix(msg, "] delete server vm \"a\"](s1): a=b|c\nd") {
+		t.Errorf("unexpected message: %s", msg)
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	msg := FormatCEF(testAuditRecord(), "v3.9")
+	prefix := "CEF:0|Yunion|Cloudpods|v3.9|compute.delete|delete server|5|rt=1646370367000 "
+	if !strings.HasPrefix(msg, prefix) {
+		t.Fatalf("unexpected header: %s", msg)
+	}
+	for _, ext := range []string{"outcome=failure", `msg=a\=b|c\nd`, "suser=admin", "src=10.0.0.1", "cs6=abc"} {
+		if !strings.Contains(msg, ext) {
+			t.Errorf("missing extension %s: %s", ext, msg)
+		}
+	}
+	rec := testAuditRecord()
+	rec.Service = "a|b"
+	if msg := FormatCEF(rec, "v3.9"); !strings.Contains(msg, `|a\|b.delete|`) {
+		t.Errorf("header not escaped: %s", msg)
+	}
+}
+
+func TestNewAuditSink(t *testing.T) {
+	cases := []struct {
+		sinkType string
+		url      string
+		conf     api.AuditSinkConfig
+		ok       bool
+	}{
+		{api.AUDIT_SINK_TYPE_SYSLOG, "tcp://127.0.0.1:514", api.AuditSinkConfig{}, true},
+		{api.AUDIT_SINK_TYPE_CEF, "tls://127.0.0.1:6514", api.AuditSinkConfig{}, true},
+		{api.AUDIT_SINK_TYPE_SYSLOG, "http://127.0.0.1:514", api.AuditSinkConfig{}, false},
+		{api.AUDIT_SINK_TYPE_HTTP_JSONL, "https://127.0.0.1/audit", api.AuditSinkConfig{}, true},
+		{api.AUDIT_SINK_TYPE_HTTP_JSONL, "tcp://127.0.0.1", api.AuditSinkConfig{}, false},
+		{api.AUDIT_SINK_TYPE_KAFKA, "kafka://b1:9092,b2:9092", api.AuditSinkConfig{Topic: "audit"}, true},
+		{api.AUDIT_SINK_TYPE_KAFKA, "kafka://b1:9092", api.AuditSinkConfig{}, false},
+		{"unknown", "tcp://127.0.0.1:514", api.AuditSinkConfig{}, false},
+	}
+	for _, c := range cases {
+		_, err := NewAuditSink(c.sinkType, c.url, c.conf)
+		if (err == nil) != c.ok {
+			t.Errorf("%s %s: expect ok %v, got error %v", c.sinkType, c.url, c.ok, err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extern
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/util/version"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+)
+
+const (
+	auditSinkTimeout = 10 * time.Second
+)
+
+// IAuditSink exports audit records to an external system, Send returns
+// nil only if all records have been accepted by the receiver
+type IAuditSink interface {
+	Send(ctx context.Context, records []api.AuditRecord) error
+	Close() error
+}
+
+// NewAuditSink creates the sink of the given type, the connection is
+// established lazily on the first Send
+func NewAuditSink(sinkType, sinkUrl string, conf api.AuditSinkConfig) (IAuditSink, error) {
+	switch sinkType {
+	case api.AUDIT_SINK_TYPE_SYSLOG, api.AUDIT_SINK_TYPE_CEF:
+		return newSyslogAuditSink(sinkType, sinkUrl, conf)
+	case api.AUDIT_SINK_TYPE_HTTP_JSONL:
+		return newHttpJsonlAuditSink(sinkUrl, conf)
+	case api.AUDIT_SINK_TYPE_KAFKA:
+		return newKafkaAuditSink(sinkUrl, conf)
+	}
+	return nil, httperrors.NewInputParameterError("unsupported audit sink type %q", sinkType)
+}
+
+type syslogAuditSink struct {
+	sinkType string
+	proto    string
+	addr     string
+	conf     api.AuditSinkConfig
+	hostname string
+
+	conn net.Conn
+}
+
+func newSyslogAuditSink(sinkType, sinkUrl string, conf api.AuditSinkConfig) (*syslogAuditSink, error) {
+	u, err := url.Parse(sinkUrl)
+	if err != nil {
+		return nil, httperrors.NewInputParameterError("invalid syslog url %q: %v", sinkUrl, err)
+	}
+	switch u.Scheme {
+	case "tcp", "udp", "tls":
+	default:
+		return nil, httperrors.NewInputParameterError("unsupported syslog scheme %q, expect tcp, udp or tls", u.Scheme)
+	}
+	if len(u.Host) == 0 {
+		return nil, httperrors.NewInputParameterError("missing syslog host in %q", sinkUrl)
+	}
+	hostname, _ := os.Hostname()
+	return &syslogAuditSink{
+		sinkType: sinkType,
+		proto:    u.Scheme,
+		addr:     u.Host,
+		conf:     conf,
+		hostname: hostname,
+	}, nil
+}
+
+func (s *syslogAuditSink) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: auditSinkTimeout}
+	var err error
+	switch s.proto {
+	case "tls":
+		s.conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, &tls.Config{InsecureSkipVerify: s.conf.InsecureSkipVerify})
+	default:
+		s.conn, err = dialer.Dial(s.proto, s.addr)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "dial %s://%s", s.proto, s.addr)
+	}
+	return nil
+}
+
+func (s *syslogAuditSink) format(rec *api.AuditRecord) string {
+	facility := DefaultAuditFacility
+	if s.conf.Facility != nil {
+		facility = *s.conf.Facility
+	}
+	if s.sinkType == api.AUDIT_SINK_TYPE_CEF {
+		return FormatCEFSyslog(rec, s.hostname, s.conf.AppName, version.GetShortString(), facility)
+	}
+	return FormatRFC5424(rec, s.hostname, s.conf.AppName, s.conf.SdId, facility)
+}
+
+func (s *syslogAuditSink) Send(ctx context.Context, records []api.AuditRecord) error {
+	err := s.connect()
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		msg := s.format(&records[i])
+		if s.proto != "udp" {
+			// RFC6587 octet counting framing
+			msg = fmt.Sprintf("%d %s", len(msg), msg)
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(auditSinkTimeout))
+		_, err := s.conn.Write([]byte(msg))
+		if err != nil {
+			// reconnect on next send
+			s.Close()
+			return errors.Wrapf(err, "write record %d", records[i].Id)
+		}
+	}
+	return nil
+}
+
+func (s *syslogAuditSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+type httpJsonlAuditSink struct {
+	url    string
+	conf   api.AuditSinkConfig
+	client *http.Client
+}
+
+func newHttpJsonlAuditSink(sinkUrl string, conf api.AuditSinkConfig) (*httpJsonlAuditSink, error) {
+	u, err := url.Parse(sinkUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, httperrors.NewInputParameterError("invalid http url %q", sinkUrl)
+	}
+	return &httpJsonlAuditSink{
+		url:    sinkUrl,
+		conf:   conf,
+		client: httputils.GetClient(conf.InsecureSkipVerify, auditSinkTimeout),
+	}, nil
+}
+
+func (s *httpJsonlAuditSink) Send(ctx context.Context, records []api.AuditRecord) error {
+	var body bytes.Buffer
+	for i := range records {
+		body.WriteString(jsonutils.Marshal(&records[i]).String())
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, &body)
+	if err != nil {
+		return errors.Wrap(err, "NewRequest")
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range s.conf.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Do")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpJsonlAuditSink) Close() error {
+	return nil
+}
+
+type kafkaAuditSink struct {
+	brokers  []string
+	conf     api.AuditSinkConfig
+	producer sarama.SyncProducer
+}
+
+func newKafkaAuditSink(sinkUrl string, conf api.AuditSinkConfig) (*kafkaAuditSink, error) {
+	if !strings.HasPrefix(sinkUrl, "kafka://") {
+		return nil, httperrors.NewInputParameterError("invalid kafka url %q, expect kafka://broker1:9092,broker2:9092", sinkUrl)
+	}
+	brokers := []string{}
+	for _, broker := range strings.Split(strings.TrimPrefix(sinkUrl, "kafka://"), ",") {
+		broker = strings.TrimSpace(strings.TrimSuffix(broker, "/"))
+		if len(broker) > 0 {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, httperrors.NewInputParameterError("missing kafka brokers in %q", sinkUrl)
+	}
+	if len(conf.Topic) == 0 {
+		return nil, httperrors.NewMissingParameterError("config.topic")
+	}
+	return &kafkaAuditSink{
+		brokers: brokers,
+		conf:    conf,
+	}, nil
+}
+
+func (s *kafkaAuditSink) connect() error {
+	if s.producer != nil {
+		return nil
+	}
+	config := sarama.NewConfig()
+	config.Net.DialTimeout = auditSinkTimeout
+	config.Net.WriteTimeout = auditSinkTimeout
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Return.Successes = true
+	config.Producer.Retry.Max = 3
+	if s.conf.InsecureSkipVerify {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = &tls.Config{InsecureSkipVerify: true}
+	}
+	producer, err := sarama.NewSyncProducer(s.brokers, config)
+	if err != nil {
+		return errors.Wrapf(err, "NewSyncProducer %s", s.brokers)
+	}
+	s.producer = producer
+	return nil
+}
+
+func (s *kafkaAuditSink) Send(ctx context.Context, records []api.AuditRecord) error {
+	err := s.connect()
+	if err != nil {
+		return err
+	}
+	msgs := make([]*sarama.ProducerMessage, len(records))
+	for i := range records {
+		msgs[i] = &sarama.ProducerMessage{
+			Topic: s.conf.Topic,
+			Key:   sarama.StringEncoder(records[i].ObjId),
+			Value: sarama.StringEncoder(jsonutils.Marshal(&records[i]).String()),
+		}
+	}
+	err = s.producer.SendMessages(msgs)
+	if err != nil {
+		s.Close()
+		return errors.Wrap(err, "SendMessages")
+	}
+	return nil
+}
+
+func (s *kafkaAuditSink) Close() error {
+	if s.producer == nil {
+		return nil
+	}
+	err := s.producer.Close()
+	s.producer = nil
+	return err
+}
@@ -76,6 +76,11 @@ type SActionlog struct {
 	Severity api.TEventSeverity `width:"32" charset:"ascii" nullable:"false" default:"INFO" list:"user" create:"optional"`
 	// 行为类别，0 一般行为(normal) 1 异常行为(abnormal) 2 违规行为(illegal)
 	Kind api.TEventKind `width:"16" charset:"ascii" nullable:"false" default:"NORMAL" list:"user" create:"optional"`
+
+	// 前一条日志的哈希值
+	PrevHash string `width:"64" charset:"ascii" nullable:"true" list:"user"`
+	// 日志哈希值, 由日志内容和前一条日志的哈希值计算得出
+	Hash string `width:"64" charset:"ascii" nullable:"true" list:"user"`
 }
 
 var ActionLog *SActionlogManager
@@ -175,7 +180,11 @@ func (action *SActionlog) CustomizeCreate(ctx context.Context, userCred mcclient
 			action.Severity = api.SeverityError
 		}
 	}
-	return action.SOpsLog.CustomizeCreate(ctx, userCred, ownerId, query, data)
+	err := action.SOpsLog.CustomizeCreate(ctx, userCred, ownerId, query, data)
+	if err != nil {
+		return err
+	}
+	return action.chain()
 }
 
 func (self *SActionlog) PostCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) {
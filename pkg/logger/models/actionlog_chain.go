@@ -0,0 +1,407 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+const (
+	actionLogChainBatchSize  = 1000
+	actionLogVerifyLimit     = 100000
+	actionLogVerifyMaxBroken = 100
+	actionLogChainTimeFormat = "2006-01-02T15:04:05Z"
+	actionLogDefaultDomainId = "default"
+	actionLogDefaultDomain   = "Default"
+)
+
+// actionLogChainKey is the HMAC key of the hash chain. It is loaded from a
+// file outside of the database, so that whoever edits the logs in the
+// database cannot recompute the hashes
+var actionLogChainKey []byte
+
+// InitActionLogChain loads the HMAC key of the hash chain from keyFile, the
+// chain falls back to unkeyed sha256 if keyFile is empty
+func InitActionLogChain(keyFile string) error {
+	if len(keyFile) == 0 {
+		log.Warningf("action_log_chain_key_file not set, action logs are hash-chained without key")
+		actionLogChainKey = nil
+		return nil
+	}
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return errors.Wrapf(err, "read %s", keyFile)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return errors.Errorf("key file %s is empty", keyFile)
+	}
+	actionLogChainKey = key
+	return nil
+}
+
+func newChainHash(key []byte) hash.Hash {
+	if len(key) == 0 {
+		return sha256.New()
+	}
+	return hmac.New(sha256.New, key)
+}
+
+// normalize fills the fields which would otherwise be filled by the column
+// defaults on insertion, so that the hash covers exactly what is stored.
+// The time fields are truncated to seconds as the datetime columns do.
+func (action *SActionlog) normalize() {
+	action.OpsTime = action.OpsTime.UTC().Truncate(time.Second)
+	action.StartTime = action.StartTime.UTC().Truncate(time.Second)
+	if len(action.ProjectDomainId) == 0 {
+		action.ProjectDomainId = actionLogDefaultDomainId
+	}
+	if len(action.ProjectDomain) == 0 {
+		action.ProjectDomain = actionLogDefaultDomain
+	}
+	if len(action.OwnerDomainId) == 0 {
+		action.OwnerDomainId = actionLogDefaultDomainId
+	}
+	if len(action.Kind) == 0 {
+		action.Kind = api.KindNormal
+	}
+}
+
+// calculateHash returns HMAC-SHA256 of the canonical json of the log
+// content and the hash of the preceding log. The id is excluded since it is
+// only assigned on insertion.
+func (action *SActionlog) calculateHash() string {
+	return action.calculateHashWithKey(actionLogChainKey)
+}
+
+func (action *SActionlog) calculateHashWithKey(key []byte) string {
+	content := jsonutils.NewDict()
+	for k, v := range map[string]string{
+		"prev_hash":         action.PrevHash,
+		"obj_type":          action.ObjType,
+		"obj_id":            action.ObjId,
+		"obj_name":          action.ObjName,
+		"action":            action.Action,
+		"notes":             action.Notes,
+		"tenant_id":         action.ProjectId,
+		"tenant":            action.Project,
+		"project_domain_id": action.ProjectDomainId,
+		"project_domain":    action.ProjectDomain,
+		"user_id":           action.UserId,
+		"user":              action.User,
+		"domain_id":         action.DomainId,
+		"domain":            action.Domain,
+		"roles":             action.Roles,
+		"ops_time":          action.OpsTime.UTC().Format(actionLogChainTimeFormat),
+		"owner_domain_id":   action.OwnerDomainId,
+		"owner_tenant_id":   action.OwnerProjectId,
+		"start_time":        action.StartTime.UTC().Format(actionLogChainTimeFormat),
+		"success":           strconv.FormatBool(action.Success),
+		"service":           action.Service,
+		"ip":                action.Ip,
+		"severity":          string(action.Severity),
+		"kind":              string(action.Kind),
+	} {
+		content.Add(jsonutils.NewString(v), k)
+	}
+	h := newChainHash(key)
+	h.Write([]byte(content.String()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chain links the log to the latest stored log, it must be called with
+// the class lock of the manager held so that logs are chained in order
+func (action *SActionlog) chain() error {
+	manager, ok := action.GetModelManager().(*SActionlogManager)
+	if !ok {
+		manager = ActionLog
+	}
+	last, err := manager.fetchLast(0)
+	if err != nil {
+		return errors.Wrap(err, "fetchLast")
+	}
+	action.normalize()
+	// the first log of the chain has an empty prev_hash
+	action.PrevHash = ""
+	if last != nil {
+		action.PrevHash = last.Hash
+	}
+	action.Hash = action.calculateHash()
+	return nil
+}
+
+// getTables returns the tables of the logs in ascending id order, the
+// tables of a splitable manager are queried one by one instead of through
+// the union view
+func (manager *SActionlogManager) getTables() ([]*sqlchemy.STable, error) {
+	spec := manager.GetSplitTable()
+	if spec == nil {
+		return []*sqlchemy.STable{manager.TableSpec().Instance()}, nil
+	}
+	metas, err := spec.GetTableMetas()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetTableMetas")
+	}
+	tables := make([]*sqlchemy.STable, len(metas))
+	for i := range metas {
+		tables[i] = spec.GetTableSpec(metas[i]).Instance()
+	}
+	return tables, nil
+}
+
+// fetchLast returns the latest log whose id is less than beforeId, or the
+// latest log if beforeId is 0
+func (manager *SActionlogManager) fetchLast(beforeId int64) (*SActionlog, error) {
+	tables, err := manager.getTables()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		q := tables[i].Query().Desc("id")
+		if beforeId > 0 {
+			q = q.LT("id", beforeId)
+		}
+		action := &SActionlog{}
+		action.SetModelManager(manager, action)
+		err := q.First(action)
+		if err == nil {
+			return action, nil
+		}
+		if errors.Cause(err) != sql.ErrNoRows {
+			return nil, errors.Wrapf(err, "query %s", tables[i].Expression())
+		}
+	}
+	return nil, nil
+}
+
+// fetchAfter returns at most limit logs whose id is greater than afterId and
+// not greater than endId, in ascending id order
+func (manager *SActionlogManager) fetchAfter(afterId, endId int64, limit int) ([]SActionlog, error) {
+	tables, err := manager.getTables()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]SActionlog, 0, limit)
+	for i := range tables {
+		q := tables[i].Query().GT("id", afterId).Asc("id").Limit(limit - len(ret))
+		if endId > 0 {
+			q = q.LE("id", endId)
+		}
+		logs := make([]SActionlog, 0)
+		err := db.FetchModelObjects(manager, q, &logs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "query %s", tables[i].Expression())
+		}
+		ret = append(ret, logs...)
+		if len(ret) >= limit {
+			break
+		}
+	}
+	return ret, nil
+}
+
+// 校验操作日志哈希链, 检测被删除或修改的日志
+func (manager *SActionlogManager) GetPropertyVerify(ctx context.Context, userCred mcclient.TokenCredential, input api.ActionLogVerifyInput) (*api.ActionLogVerifyOutput, error) {
+	if db.IsAdminAllowList(userCred, manager).Result.IsDeny() {
+		return nil, httperrors.NewForbiddenError("not allow to verify action logs")
+	}
+	man := manager.GetImmutableInstance(ctx, userCred, jsonutils.Marshal(input)).(*SActionlogManager)
+	return man.verifyChain(input)
+}
+
+// hasPurgedLogs returns true if the oldest logs were dropped by retention,
+// so that the oldest remaining log has a predecessor no longer stored
+func (manager *SActionlogManager) hasPurgedLogs() (bool, error) {
+	spec := manager.GetSplitTable()
+	if spec == nil {
+		return false, nil
+	}
+	metas, err := spec.GetPurgedTableMetas()
+	if err != nil {
+		return false, errors.Wrap(err, "GetPurgedTableMetas")
+	}
+	return len(metas) > 0, nil
+}
+
+func (manager *SActionlogManager) verifyChain(input api.ActionLogVerifyInput) (*api.ActionLogVerifyOutput, error) {
+	limit := input.Limit
+	if limit <= 0 || limit > actionLogVerifyLimit {
+		limit = actionLogVerifyLimit
+	}
+	out := &api.ActionLogVerifyOutput{
+		Broken: []api.ActionLogChainBreak{},
+	}
+	v := &sActionLogVerifier{out: out}
+	var err error
+	v.checkpoint, err = loadActionLogCheckpoint()
+	if err != nil {
+		return nil, errors.Wrap(err, "loadActionLogCheckpoint")
+	}
+	if v.checkpoint != nil {
+		out.CheckpointId = v.checkpoint.Id
+	}
+	var prev *SActionlog
+	afterId := int64(0)
+	if input.StartId > 0 {
+		prev, err = manager.fetchLast(input.StartId)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetch log before start")
+		}
+		afterId = input.StartId - 1
+	}
+	if prev == nil {
+		v.headPurged, err = manager.hasPurgedLogs()
+		if err != nil {
+			return nil, errors.Wrap(err, "hasPurgedLogs")
+		}
+	}
+	exhausted := false
+	for out.Checked < limit {
+		batch := limit - out.Checked
+		if batch > actionLogChainBatchSize {
+			batch = actionLogChainBatchSize
+		}
+		logs, err := manager.fetchAfter(afterId, input.EndId, batch)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetchAfter")
+		}
+		for i := range logs {
+			v.next(prev, &logs[i])
+			prev = &logs[i]
+		}
+		if len(logs) < batch {
+			exhausted = true
+			break
+		}
+		afterId = logs[len(logs)-1].Id
+	}
+	if exhausted {
+		v.finish(input)
+	}
+	out.Valid = out.BrokenCount == 0
+	return out, nil
+}
+
+// sActionLogVerifier checks the logs of a range one by one in ascending id
+// order
+type sActionLogVerifier struct {
+	out *api.ActionLogVerifyOutput
+	// the first log of the range follows logs dropped by retention
+	headPurged bool
+	// a log hashed with key has been seen
+	keyed bool
+
+	checkpoint     *SActionLogCheckpoint
+	checkpointSeen bool
+}
+
+func (v *sActionLogVerifier) addBroken(prev, action *SActionlog, reason string) {
+	v.out.BrokenCount++
+	if len(v.out.Broken) >= actionLogVerifyMaxBroken {
+		return
+	}
+	brk := api.ActionLogChainBreak{Id: action.Id, Reason: reason}
+	if prev != nil {
+		brk.PrevId = prev.Id
+	}
+	v.out.Broken = append(v.out.Broken, brk)
+}
+
+// next checks the log against its content, the preceding log and the
+// checkpoint. A log without predecessor must start the chain unless its
+// predecessor was dropped by retention
+func (v *sActionLogVerifier) next(prev, action *SActionlog) {
+	out := v.out
+	if out.Checked == 0 {
+		out.FirstId = action.Id
+	}
+	out.Checked++
+	out.LastId = action.Id
+	if v.checkpoint != nil && action.Id == v.checkpoint.Id {
+		v.checkpointSeen = true
+		if action.Hash != v.checkpoint.Hash {
+			v.addBroken(prev, action, api.ACTION_LOG_CHAIN_CHECKPOINT_MISMATCH)
+		}
+	}
+	if len(action.Hash) == 0 {
+		if prev != nil && len(prev.Hash) > 0 {
+			v.addBroken(prev, action, api.ACTION_LOG_CHAIN_UNHASHED)
+		} else {
+			// logs written before the chain was introduced
+			out.Unchained++
+		}
+		return
+	}
+	if action.calculateHash() == action.Hash {
+		if len(actionLogChainKey) > 0 {
+			v.keyed = true
+		}
+	} else if len(actionLogChainKey) > 0 && action.calculateHashWithKey(nil) == action.Hash {
+		// logs written before the key was configured are accepted until
+		// the first keyed one
+		if v.keyed {
+			v.addBroken(prev, action, api.ACTION_LOG_CHAIN_UNKEYED)
+		}
+	} else {
+		v.addBroken(prev, action, api.ACTION_LOG_CHAIN_MODIFIED)
+	}
+	if prev != nil {
+		if action.PrevHash != prev.Hash {
+			v.addBroken(prev, action, api.ACTION_LOG_CHAIN_BROKEN)
+		}
+	} else if len(action.PrevHash) > 0 && !v.headPurged {
+		v.addBroken(prev, action, api.ACTION_LOG_CHAIN_BROKEN)
+	}
+	out.LastHash = action.Hash
+}
+
+// finish checks that the log of the checkpoint is still there after all
+// logs of the range are checked, which detects logs deleted from the end
+func (v *sActionLogVerifier) finish(input api.ActionLogVerifyInput) {
+	cp := v.checkpoint
+	if cp == nil || v.checkpointSeen {
+		return
+	}
+	if cp.Id < input.StartId || (input.EndId > 0 && cp.Id > input.EndId) {
+		return
+	}
+	v.out.BrokenCount++
+	if len(v.out.Broken) < actionLogVerifyMaxBroken {
+		v.out.Broken = append(v.out.Broken, api.ActionLogChainBreak{
+			Id:     cp.Id,
+			PrevId: v.out.LastId,
+			Reason: api.ACTION_LOG_CHAIN_CHECKPOINT_MISMATCH,
+		})
+	}
+}
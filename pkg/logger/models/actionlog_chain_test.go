@@ -0,0 +1,244 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+)
+
+func newTestChain(n int) []SActionlog {
+	logs := make([]SActionlog, n)
+	prevHash := ""
+	for i := range logs {
+		l := &logs[i]
+		l.Id = int64(i + 1)
+		l.ObjType = "server"
+		l.ObjId = "s1"
+		l.Action = "start"
+		l.OpsTime = time.Date(2022, 3, 4, 5, 6, i, 123, time.UTC)
+		l.StartTime = l.OpsTime
+		l.Success = true
+		l.Severity = api.SeverityInfo
+		l.normalize()
+		l.PrevHash = prevHash
+		l.Hash = l.calculateHash()
+		prevHash = l.Hash
+	}
+	return logs
+}
+
+func verifyTestChain(logs []SActionlog) *api.ActionLogVerifyOutput {
+	return verifyTestChainWith(&sActionLogVerifier{}, logs)
+}
+
+func verifyTestChainWith(v *sActionLogVerifier, logs []SActionlog) *api.ActionLogVerifyOutput {
+	v.out = &api.ActionLogVerifyOutput{}
+	var prev *SActionlog
+	for i := range logs {
+		v.next(prev, &logs[i])
+		prev = &logs[i]
+	}
+	v.finish(api.ActionLogVerifyInput{})
+	v.out.Valid = v.out.BrokenCount == 0
+	return v.out
+}
+
+func withChainKey(t *testing.T, key string) {
+	old := actionLogChainKey
+	actionLogChainKey = []byte(key)
+	t.Cleanup(func() { actionLogChainKey = old })
+}
+
+func TestActionLogHash(t *testing.T) {
+	logs := newTestChain(1)
+	l := logs[0]
+	if l.OpsTime.Nanosecond() != 0 || l.ProjectDomainId != "default" || l.Kind != api.KindNormal {
+		t.Fatalf("log not normalized: %#v", l)
+	}
+	hash := l.calculateHash()
+	l.Id = 100
+	if l.calculateHash() != hash {
+		t.Errorf("id should not be hashed")
+	}
+	l.Notes = "changed"
+	if l.calculateHash() == hash {
+		t.Errorf("notes should be hashed")
+	}
+}
+
+func TestVerifyActionLogChain(t *testing.T) {
+	cases := []struct {
+		name   string
+		tamper func(logs []SActionlog) []SActionlog
+		broken []api.ActionLogChainBreak
+	}{
+		{
+			name:   "intact",
+			tamper: func(logs []SActionlog) []SActionlog { return logs },
+		},
+		{
+			name: "modified",
+			tamper: func(logs []SActionlog) []SActionlog {
+				logs[2].Success = false
+				return logs
+			},
+			broken: []api.ActionLogChainBreak{{Id: 3, PrevId: 2, Reason: api.ACTION_LOG_CHAIN_MODIFIED}},
+		},
+		{
+			name: "modified with rehash",
+			tamper: func(logs []SActionlog) []SActionlog {
+				logs[2].Success = false
+				logs[2].Hash = logs[2].calculateHash()
+				return logs
+			},
+			broken: []api.ActionLogChainBreak{{Id: 4, PrevId: 3, Reason: api.ACTION_LOG_CHAIN_BROKEN}},
+		},
+		{
+			name: "deleted",
+			tamper: func(logs []SActionlog) []SActionlog {
+				return append(logs[:2], logs[3:]...)
+			},
+			broken: []api.ActionLogChainBreak{{Id: 4, PrevId: 2, Reason: api.ACTION_LOG_CHAIN_BROKEN}},
+		},
+		{
+			name: "head deleted",
+			tamper: func(logs []SActionlog) []SActionlog {
+				return logs[2:]
+			},
+			broken: []api.ActionLogChainBreak{{Id: 3, Reason: api.ACTION_LOG_CHAIN_BROKEN}},
+		},
+		{
+			name: "unhashed",
+			tamper: func(logs []SActionlog) []SActionlog {
+				logs[4].Hash = ""
+				return logs
+			},
+			broken: []api.ActionLogChainBreak{{Id: 5, PrevId: 4, Reason: api.ACTION_LOG_CHAIN_UNHASHED}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			logs := c.tamper(newTestChain(5))
+			out := verifyTestChain(logs)
+			if out.Valid != (len(c.broken) == 0) || len(out.Broken) != len(c.broken) {
+				t.Fatalf("unexpected result %#v", out)
+			}
+			for i := range c.broken {
+				if out.Broken[i] != c.broken[i] {
+					t.Errorf("want %#v got %#v", c.broken[i], out.Broken[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyActionLogChainLegacy(t *testing.T) {
+	legacy := []SActionlog{{}, {}}
+	legacy[0].Id = 1
+	legacy[1].Id = 2
+	logs := newTestChain(3)
+	for i := range logs {
+		logs[i].Id += 2
+	}
+	out := verifyTestChain(append(legacy, logs...))
+	if !out.Valid || out.Unchained != 2 || out.Checked != 5 || out.LastHash != logs[2].Hash {
+		t.Errorf("unexpected result %#v", out)
+	}
+}
+
+func TestVerifyActionLogChainPurged(t *testing.T) {
+	logs := newTestChain(5)[2:]
+	out := verifyTestChainWith(&sActionLogVerifier{headPurged: true}, logs)
+	if !out.Valid || out.Checked != 3 {
+		t.Errorf("unexpected result %#v", out)
+	}
+}
+
+func TestVerifyActionLogChainKeyed(t *testing.T) {
+	unkeyed := newTestChain(3)
+	withChainKey(t, "secret")
+	if unkeyed[0].calculateHash() == unkeyed[0].Hash {
+		t.Fatalf("hash should depend on key")
+	}
+
+	// logs hashed before the key was configured
+	keyed := newTestChain(5)
+	keyed[0] = unkeyed[0]
+	keyed[1] = unkeyed[1]
+	keyed[2].PrevHash = keyed[1].Hash
+	keyed[2].Hash = keyed[2].calculateHash()
+	keyed[3].PrevHash = keyed[2].Hash
+	keyed[3].Hash = keyed[3].calculateHash()
+	keyed[4].PrevHash = keyed[3].Hash
+	keyed[4].Hash = keyed[4].calculateHash()
+	out := verifyTestChain(keyed)
+	if !out.Valid {
+		t.Fatalf("unexpected result %#v", out)
+	}
+
+	// rehashed without key after the keyed logs
+	keyed[3].Success = false
+	keyed[3].Hash = keyed[3].calculateHashWithKey(nil)
+	keyed[4].PrevHash = keyed[3].Hash
+	keyed[4].Hash = keyed[4].calculateHashWithKey(nil)
+	out = verifyTestChain(keyed)
+	if out.Valid || len(out.Broken) != 2 || out.Broken[0].Reason != api.ACTION_LOG_CHAIN_UNKEYED {
+		t.Errorf("unexpected result %#v", out)
+	}
+}
+
+func TestVerifyActionLogChainCheckpoint(t *testing.T) {
+	withChainKey(t, "secret")
+	logs := newTestChain(5)
+	cp := &SActionLogCheckpoint{Id: logs[3].Id, Hash: logs[3].Hash}
+
+	out := verifyTestChainWith(&sActionLogVerifier{checkpoint: cp}, logs)
+	if !out.Valid {
+		t.Errorf("unexpected result %#v", out)
+	}
+
+	// logs deleted from the end
+	out = verifyTestChainWith(&sActionLogVerifier{checkpoint: cp}, logs[:3])
+	want := api.ActionLogChainBreak{Id: 4, PrevId: 3, Reason: api.ACTION_LOG_CHAIN_CHECKPOINT_MISMATCH}
+	if out.Valid || len(out.Broken) != 1 || out.Broken[0] != want {
+		t.Errorf("unexpected result %#v", out)
+	}
+
+	// chain rehashed as a whole
+	logs[0].Notes = "changed"
+	for i := range logs {
+		if i > 0 {
+			logs[i].PrevHash = logs[i-1].Hash
+		}
+		logs[i].Hash = logs[i].calculateHash()
+	}
+	out = verifyTestChainWith(&sActionLogVerifier{checkpoint: cp}, logs)
+	if out.Valid || len(out.Broken) != 1 || out.Broken[0].Reason != api.ACTION_LOG_CHAIN_CHECKPOINT_MISMATCH {
+		t.Errorf("unexpected result %#v", out)
+	}
+
+	cp.Time = time.Now()
+	cp.Mac = cp.calculateMac()
+	if cp.calculateMac() != cp.Mac {
+		t.Errorf("mac should be stable")
+	}
+	cp.Hash = logs[4].Hash
+	if cp.calculateMac() == cp.Mac {
+		t.Errorf("mac should cover hash")
+	}
+}
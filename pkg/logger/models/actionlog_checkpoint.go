@@ -0,0 +1,139 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/logger/options"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+// SActionLogCheckpoint is the head of the hash chain kept outside of the
+// database. Logs deleted from the end of the chain, or the chain rehashed
+// as a whole, no longer match the checkpoint
+type SActionLogCheckpoint struct {
+	Id   int64     `json:"id"`
+	Hash string    `json:"hash"`
+	Time time.Time `json:"time"`
+	// Mac signs the fields above with the key of the hash chain
+	Mac string `json:"mac"`
+}
+
+func (cp *SActionLogCheckpoint) calculateMac() string {
+	h := newChainHash(actionLogChainKey)
+	h.Write([]byte(fmt.Sprintf("%d:%s:%s", cp.Id, cp.Hash, cp.Time.UTC().Format(actionLogChainTimeFormat))))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// loadActionLogCheckpoint returns nil if checkpoint is not configured or
+// not written yet
+func loadActionLogCheckpoint() (*SActionLogCheckpoint, error) {
+	path := options.Options.ActionLogCheckpointFile
+	if len(path) == 0 {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+	obj, err := jsonutils.Parse(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+	cp := &SActionLogCheckpoint{}
+	err = obj.Unmarshal(cp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s", path)
+	}
+	if !hmac.Equal([]byte(cp.calculateMac()), []byte(cp.Mac)) {
+		return nil, errors.Errorf("checkpoint %s has invalid mac", path)
+	}
+	return cp, nil
+}
+
+func saveActionLogCheckpoint(cp *SActionLogCheckpoint) error {
+	path := options.Options.ActionLogCheckpointFile
+	cp.Mac = cp.calculateMac()
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return errors.Wrap(err, "TempFile")
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(jsonutils.Marshal(cp).PrettyString())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "write %s", tmp.Name())
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CheckpointActionLogs saves the head of the hash chain to the checkpoint
+// file. The checkpoint is not moved backward, a head older than the
+// checkpoint means logs were deleted from the end and is left to verify
+func (manager *SActionlogManager) CheckpointActionLogs(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	if len(options.Options.ActionLogCheckpointFile) == 0 {
+		return
+	}
+	last, err := manager.fetchLast(0)
+	if err != nil {
+		log.Errorf("fetch last action log fail %s", err)
+		return
+	}
+	if last == nil || len(last.Hash) == 0 {
+		return
+	}
+	cp, err := loadActionLogCheckpoint()
+	if err != nil {
+		log.Errorf("load action log checkpoint fail %s", err)
+		return
+	}
+	if cp != nil {
+		if cp.Id > last.Id {
+			log.Errorf("action log %d of checkpoint is newer than the last log %d, logs may be deleted", cp.Id, last.Id)
+			return
+		}
+		if cp.Id == last.Id {
+			return
+		}
+	}
+	err = saveActionLogCheckpoint(&SActionLogCheckpoint{
+		Id:   last.Id,
+		Hash: last.Hash,
+		Time: time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		log.Errorf("save action log checkpoint fail %s", err)
+	}
+}
@@ -0,0 +1,484 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/logger"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/logger/extern"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/stringutils2"
+)
+
+const (
+	auditSinkDefaultBatchSize = 100
+	auditSinkMaxBatchSize     = 1000
+	// batches exported by a sink in one run, the remaining logs are
+	// exported in the next run
+	auditSinkMaxBatchesPerRun = 10
+)
+
+type SAuditSinkManager struct {
+	db.SEnabledStatusStandaloneResourceBaseManager
+
+	// serialize export runs, a slow sink may take longer than the interval
+	exportLock sync.Mutex
+	// sink instances keyed by id, recreated once type, url or config changes
+	sinks sync.Map
+}
+
+var AuditSinkManager *SAuditSinkManager
+
+func InitAuditSink() {
+	AuditSinkManager = &SAuditSinkManager{
+		SEnabledStatusStandaloneResourceBaseManager: db.NewEnabledStatusStandaloneResourceBaseManager(
+			SAuditSink{},
+			"audit_sinks_tbl",
+			"audit_sink",
+			"audit_sinks",
+		),
+	}
+	AuditSinkManager.SetVirtualObject(AuditSinkManager)
+}
+
+// SAuditSink exports action logs to an external system. Logs are exported
+// in id order and the cursors are advanced only after the sink accepted
+// them, so that each log is delivered at least once.
+type SAuditSink struct {
+	db.SEnabledStatusStandaloneResourceBase
+
+	// 导出类型
+	Type string `width:"16" charset:"ascii" nullable:"false" list:"admin" create:"admin_required"`
+	// 导出地址
+	Url string `width:"512" charset:"utf8" nullable:"false" list:"admin" create:"admin_required" update:"admin"`
+	// 导出配置
+	Config *api.AuditSinkConfig `charset:"utf8" nullable:"true" get:"admin" create:"admin_optional" update:"admin"`
+	// 过滤条件
+	Filter *api.AuditSinkFilter `charset:"utf8" nullable:"true" list:"admin" create:"admin_optional" update:"admin"`
+
+	// 已导出的最后一条操作日志ID
+	LastActionId int64 `nullable:"false" default:"0" list:"admin"`
+	// 已导出的最后一条管理员操作日志ID
+	LastAdminActionId int64 `nullable:"false" default:"0" list:"admin"`
+	// 最近一次导出时间
+	LastExportAt time.Time `nullable:"true" list:"admin"`
+	// 最近一次导出错误
+	LastError string `charset:"utf8" nullable:"true" list:"admin"`
+}
+
+func (manager *SAuditSinkManager) ValidateCreateData(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, input api.AuditSinkCreateInput) (api.AuditSinkCreateInput, error) {
+	if !utils.IsInStringArray(input.Type, api.AUDIT_SINK_TYPES) {
+		return input, httperrors.NewInputParameterError("invalid type %q, must be one of %s", input.Type, api.AUDIT_SINK_TYPES)
+	}
+	if len(input.Url) == 0 {
+		return input, httperrors.NewMissingParameterError("url")
+	}
+	if input.Config == nil {
+		input.Config = &api.AuditSinkConfig{}
+	}
+	err := validateAuditSinkConfig(input.Type, input.Url, input.Config)
+	if err != nil {
+		return input, err
+	}
+	if input.Filter != nil {
+		err = validateAuditSinkFilter(input.Filter)
+		if err != nil {
+			return input, err
+		}
+	}
+	input.Status = api.AUDIT_SINK_STATUS_READY
+	input.EnabledStatusStandaloneResourceCreateInput, err = manager.SEnabledStatusStandaloneResourceBaseManager.ValidateCreateData(ctx, userCred, ownerId, query, input.EnabledStatusStandaloneResourceCreateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusStandaloneResourceBaseManager.ValidateCreateData")
+	}
+	return input, nil
+}
+
+func validateAuditSinkConfig(sinkType, sinkUrl string, conf *api.AuditSinkConfig) error {
+	if conf.BatchSize < 0 || conf.BatchSize > auditSinkMaxBatchSize {
+		return httperrors.NewOutOfRangeError("batch_size should be in range of 0-%d", auditSinkMaxBatchSize)
+	}
+	if conf.Facility != nil && (*conf.Facility < 0 || *conf.Facility > 23) {
+		return httperrors.NewOutOfRangeError("facility should be in range of 0-23")
+	}
+	// the sink does not connect until the first export
+	_, err := extern.NewAuditSink(sinkType, sinkUrl, *conf)
+	return err
+}
+
+func validateAuditSinkFilter(filter *api.AuditSinkFilter) error {
+	for _, severity := range filter.Severities {
+		switch api.TEventSeverity(severity) {
+		case api.SeverityEmergency, api.SeverityAlert, api.SeverityCritical, api.SeverityError,
+			api.SeverityWarning, api.SeverityNotice, api.SeverityInfo, api.SeverityDebug:
+		default:
+			return httperrors.NewInputParameterError("invalid severity %q", severity)
+		}
+	}
+	for _, kind := range filter.Kinds {
+		switch api.TEventKind(kind) {
+		case api.KindNormal, api.KindAbnormal, api.KindIllegal:
+		default:
+			return httperrors.NewInputParameterError("invalid kind %q", kind)
+		}
+	}
+	return nil
+}
+
+func (self *SAuditSink) CustomizeCreate(ctx context.Context, userCred mcclient.TokenCredential, ownerId mcclient.IIdentityProvider, query jsonutils.JSONObject, data jsonutils.JSONObject) error {
+	input := api.AuditSinkCreateInput{}
+	data.Unmarshal(&input)
+	if !input.FromBeginning {
+		// export the logs created afterwards only
+		for _, cursor := range self.getCursors() {
+			last, err := cursor.manager.fetchLast(0)
+			if err != nil {
+				return errors.Wrapf(err, "fetch last %s", cursor.manager.KeywordPlural())
+			}
+			if last != nil {
+				*cursor.lastId = last.Id
+			}
+		}
+	}
+	return self.SEnabledStatusStandaloneResourceBase.CustomizeCreate(ctx, userCred, ownerId, query, data)
+}
+
+func (self *SAuditSink) ValidateUpdateData(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.AuditSinkUpdateInput) (api.AuditSinkUpdateInput, error) {
+	sinkUrl := self.Url
+	if len(input.Url) > 0 {
+		sinkUrl = input.Url
+	}
+	conf := self.Config
+	if input.Config != nil {
+		conf = input.Config
+	}
+	if conf == nil {
+		conf = &api.AuditSinkConfig{}
+	}
+	err := validateAuditSinkConfig(self.Type, sinkUrl, conf)
+	if err != nil {
+		return input, err
+	}
+	if input.Filter != nil {
+		err = validateAuditSinkFilter(input.Filter)
+		if err != nil {
+			return input, err
+		}
+	}
+	input.EnabledStatusStandaloneResourceBaseUpdateInput, err = self.SEnabledStatusStandaloneResourceBase.ValidateUpdateData(ctx, userCred, query, input.EnabledStatusStandaloneResourceBaseUpdateInput)
+	if err != nil {
+		return input, errors.Wrap(err, "SEnabledStatusStandaloneResourceBase.ValidateUpdateData")
+	}
+	return input, nil
+}
+
+func (self *SAuditSink) PostDelete(ctx context.Context, userCred mcclient.TokenCredential) {
+	self.SEnabledStatusStandaloneResourceBase.PostDelete(ctx, userCred)
+	AuditSinkManager.closeSink(self.Id)
+}
+
+// 审计日志导出列表
+func (manager *SAuditSinkManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.AuditSinkListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusStandaloneResourceBaseManager.ListItemFilter(ctx, q, userCred, query.EnabledStatusStandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusStandaloneResourceBaseManager.ListItemFilter")
+	}
+	if len(query.Type) > 0 {
+		q = q.In("type", query.Type)
+	}
+	return q, nil
+}
+
+func (manager *SAuditSinkManager) OrderByExtraFields(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	query api.AuditSinkListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusStandaloneResourceBaseManager.OrderByExtraFields(ctx, q, userCred, query.EnabledStatusStandaloneResourceListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SEnabledStatusStandaloneResourceBaseManager.OrderByExtraFields")
+	}
+	return q, nil
+}
+
+func (manager *SAuditSinkManager) QueryDistinctExtraField(q *sqlchemy.SQuery, field string) (*sqlchemy.SQuery, error) {
+	q, err := manager.SEnabledStatusStandaloneResourceBaseManager.QueryDistinctExtraField(q, field)
+	if err == nil {
+		return q, nil
+	}
+	return q, httperrors.ErrNotFound
+}
+
+func (manager *SAuditSinkManager) FetchCustomizeColumns(
+	ctx context.Context,
+	userCred mcclient.TokenCredential,
+	query jsonutils.JSONObject,
+	objs []interface{},
+	fields stringutils2.SSortedStrings,
+	isList bool,
+) []api.AuditSinkDetails {
+	rows := make([]api.AuditSinkDetails, len(objs))
+	stdRows := manager.SEnabledStatusStandaloneResourceBaseManager.FetchCustomizeColumns(ctx, userCred, query, objs, fields, isList)
+	for i := range rows {
+		rows[i] = api.AuditSinkDetails{
+			EnabledStatusStandaloneResourceDetails: stdRows[i],
+		}
+	}
+	return rows
+}
+
+// 重置导出位置, 从指定的日志之后重新导出
+func (self *SAuditSink) PerformResetCursor(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.AuditSinkResetCursorInput) (jsonutils.JSONObject, error) {
+	if input.ActionId < 0 || input.AdminActionId < 0 {
+		return nil, httperrors.NewInputParameterError("negative log id")
+	}
+	AuditSinkManager.exportLock.Lock()
+	defer AuditSinkManager.exportLock.Unlock()
+
+	_, err := db.Update(self, func() error {
+		self.LastActionId = input.ActionId
+		self.LastAdminActionId = input.AdminActionId
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "db.Update")
+	}
+	return nil, nil
+}
+
+type sAuditSinkCursor struct {
+	manager *SActionlogManager
+	admin   bool
+	lastId  *int64
+}
+
+func (self *SAuditSink) getCursors() []sAuditSinkCursor {
+	cursors := []sAuditSinkCursor{
+		{manager: ActionLog, lastId: &self.LastActionId},
+	}
+	if AdminActionLog != nil {
+		cursors = append(cursors, sAuditSinkCursor{manager: AdminActionLog, admin: true, lastId: &self.LastAdminActionId})
+	}
+	return cursors
+}
+
+func (self *SAuditSink) isMatch(action *SActionlog) bool {
+	filter := self.Filter
+	if filter == nil {
+		return true
+	}
+	if len(filter.Services) > 0 && !utils.IsInStringArray(action.Service, filter.Services) {
+		return false
+	}
+	if len(filter.Actions) > 0 && !utils.IsInStringArray(action.Action, filter.Actions) {
+		return false
+	}
+	if len(filter.ObjTypes) > 0 && !utils.IsInStringArray(action.ObjType, filter.ObjTypes) {
+		return false
+	}
+	if len(filter.Severities) > 0 && !utils.IsInStringArray(string(action.Severity), filter.Severities) {
+		return false
+	}
+	if len(filter.Kinds) > 0 && !utils.IsInStringArray(string(action.Kind), filter.Kinds) {
+		return false
+	}
+	if filter.Success != nil && *filter.Success != action.Success {
+		return false
+	}
+	return true
+}
+
+func (action *SActionlog) toAuditRecord(admin bool) api.AuditRecord {
+	return api.AuditRecord{
+		Id:              action.Id,
+		OpsTime:         action.OpsTime,
+		StartTime:       action.StartTime,
+		Service:         action.Service,
+		Action:          action.Action,
+		ObjType:         action.ObjType,
+		ObjId:           action.ObjId,
+		ObjName:         action.ObjName,
+		Notes:           action.Notes,
+		Success:         action.Success,
+		Severity:        action.Severity,
+		Kind:            action.Kind,
+		UserId:          action.UserId,
+		User:            action.User,
+		DomainId:        action.DomainId,
+		Domain:          action.Domain,
+		ProjectId:       action.ProjectId,
+		Project:         action.Project,
+		ProjectDomainId: action.ProjectDomainId,
+		ProjectDomain:   action.ProjectDomain,
+		OwnerProjectId:  action.OwnerProjectId,
+		OwnerDomainId:   action.OwnerDomainId,
+		Roles:           action.Roles,
+		Ip:              action.Ip,
+		Admin:           admin,
+		PrevHash:        action.PrevHash,
+		Hash:            action.Hash,
+	}
+}
+
+type sAuditSinkInstance struct {
+	signature string
+	sink      extern.IAuditSink
+}
+
+func (self *SAuditSink) signature() string {
+	conf := ""
+	if self.Config != nil {
+		conf = self.Config.String()
+	}
+	return fmt.Sprintf("%s|%s|%s", self.Type, self.Url, conf)
+}
+
+func (manager *SAuditSinkManager) getSink(sink *SAuditSink) (extern.IAuditSink, error) {
+	signature := sink.signature()
+	if val, ok := manager.sinks.Load(sink.Id); ok {
+		inst := val.(*sAuditSinkInstance)
+		if inst.signature == signature {
+			return inst.sink, nil
+		}
+		inst.sink.Close()
+		manager.sinks.Delete(sink.Id)
+	}
+	conf := api.AuditSinkConfig{}
+	if sink.Config != nil {
+		conf = *sink.Config
+	}
+	s, err := extern.NewAuditSink(sink.Type, sink.Url, conf)
+	if err != nil {
+		return nil, err
+	}
+	manager.sinks.Store(sink.Id, &sAuditSinkInstance{signature: signature, sink: s})
+	return s, nil
+}
+
+func (manager *SAuditSinkManager) closeSink(id string) {
+	if val, ok := manager.sinks.LoadAndDelete(id); ok {
+		val.(*sAuditSinkInstance).sink.Close()
+	}
+}
+
+// ExportActionLogs exports the new action logs to all enabled sinks
+func (manager *SAuditSinkManager) ExportActionLogs(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	manager.exportLock.Lock()
+	defer manager.exportLock.Unlock()
+
+	sinks := make([]SAuditSink, 0)
+	q := manager.Query().IsTrue("enabled")
+	err := db.FetchModelObjects(manager, q, &sinks)
+	if err != nil {
+		log.Errorf("fetch audit sinks: %v", err)
+		return
+	}
+	for i := range sinks {
+		err := sinks[i].export(ctx)
+		if err != nil {
+			log.Errorf("export action logs to audit sink %s: %v", sinks[i].Name, err)
+		}
+	}
+}
+
+func (self *SAuditSink) export(ctx context.Context) error {
+	sink, err := AuditSinkManager.getSink(self)
+	if err != nil {
+		return self.markExportResult(err)
+	}
+	batchSize := auditSinkDefaultBatchSize
+	if self.Config != nil && self.Config.BatchSize > 0 {
+		batchSize = self.Config.BatchSize
+	}
+	exported := false
+	for _, cursor := range self.getCursors() {
+		for i := 0; i < auditSinkMaxBatchesPerRun; i++ {
+			logs, err := cursor.manager.fetchAfter(*cursor.lastId, 0, batchSize)
+			if err != nil {
+				return errors.Wrapf(err, "fetch %s", cursor.manager.KeywordPlural())
+			}
+			if len(logs) == 0 {
+				break
+			}
+			records := make([]api.AuditRecord, 0, len(logs))
+			for j := range logs {
+				if self.isMatch(&logs[j]) {
+					records = append(records, logs[j].toAuditRecord(cursor.admin))
+				}
+			}
+			if len(records) > 0 {
+				err = sink.Send(ctx, records)
+				if err != nil {
+					return self.markExportResult(err)
+				}
+			}
+			lastId := logs[len(logs)-1].Id
+			_, err = db.Update(self, func() error {
+				*cursor.lastId = lastId
+				self.LastExportAt = time.Now().UTC()
+				return nil
+			})
+			if err != nil {
+				return errors.Wrap(err, "update cursor")
+			}
+			exported = true
+			if len(logs) < batchSize {
+				break
+			}
+		}
+	}
+	if exported || self.Status != api.AUDIT_SINK_STATUS_READY {
+		return self.markExportResult(nil)
+	}
+	return nil
+}
+
+func (self *SAuditSink) markExportResult(exportErr error) error {
+	status := api.AUDIT_SINK_STATUS_READY
+	lastError := ""
+	if exportErr != nil {
+		status = api.AUDIT_SINK_STATUS_FAILED
+		lastError = exportErr.Error()
+	}
+	if self.Status != status || self.LastError != lastError {
+		_, err := db.Update(self, func() error {
+			self.Status = status
+			self.LastError = lastError
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, "update status")
+		}
+	}
+	return exportErr
+}
@@ -37,6 +37,12 @@ type SLoggerOptions struct {
 	SyslogVendorCode string `help:"vendor code of syslog" default:"0003"`
 	SyslogSeparator  string `help:"syslog message field separator" default:","`
 	SyslogSepEscape  string `help:"syslog message separate escape string" default:"+"`
+
+	AuditSinkExportIntervalSeconds int `help:"interval in seconds to export action logs to audit sinks" default:"10"`
+
+	ActionLogChainKeyFile              string `help:"path of the secret key file to HMAC the action log hash chain, the key must be kept outside of the database"`
+	ActionLogCheckpointFile            string `help:"path of the file outside of the database to keep the signed head of the action log hash chain"`
+	ActionLogCheckpointIntervalSeconds int    `help:"interval in seconds to checkpoint the head of the action log hash chain" default:"300"`
 }
 
 var (
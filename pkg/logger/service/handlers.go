@@ -27,6 +27,7 @@ func initHandlers(app *appsrv.Application) {
 
 	models.InitActionLog()
 	models.InitBaremetalEvent()
+	models.InitAuditSink()
 
 	for _, manager := range []db.IModelManager{
 		db.UserCacheManager,
@@ -45,6 +46,7 @@ func initHandlers(app *appsrv.Application) {
 
 		models.ActionLog,
 		models.BaremetalEventManager,
+		models.AuditSinkManager,
 	} {
 		db.RegisterModelManager(manager)
 		handler := db.NewModelHandler(manager)
@@ -16,6 +16,7 @@ package service
 
 import (
 	"os"
+	"time"
 
 	"yunion.io/x/log"
 	_ "yunion.io/x/sqlchemy/backends"
@@ -24,6 +25,7 @@ import (
 	"yunion.io/x/onecloud/pkg/cloudcommon"
 	app_common "yunion.io/x/onecloud/pkg/cloudcommon/app"
 	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/cloudcommon/cronman"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 	"yunion.io/x/onecloud/pkg/logger/extern"
@@ -47,6 +49,11 @@ func StartService() {
 	})
 	common_options.StartOptionManager(opts, opts.ConfigSyncPeriodSeconds, api.SERVICE_TYPE, "", options.OnOptionsChange)
 
+	err := models.InitActionLogChain(opts.ActionLogChainKeyFile)
+	if err != nil {
+		log.Fatalf("InitActionLogChain: %v", err)
+	}
+
 	app := app_common.InitApp(baseOpts, true)
 
 	cloudcommon.InitDB(dbOpts)
@@ -62,5 +69,15 @@ func StartService() {
 		extern.InitSyslog(opts.SyslogUrl)
 	}
 
+	if !opts.IsSlaveNode {
+		cron := cronman.InitCronJobManager(true, 2)
+		cron.AddJobAtIntervals("ExportActionLogs", time.Duration(opts.AuditSinkExportIntervalSeconds)*time.Second, models.AuditSinkManager.ExportActionLogs)
+		if len(opts.ActionLogCheckpointFile) > 0 {
+			cron.AddJobAtIntervals("CheckpointActionLogs", time.Duration(opts.ActionLogCheckpointIntervalSeconds)*time.Second, models.ActionLog.CheckpointActionLogs)
+		}
+		cron.Start()
+		defer cron.Stop()
+	}
+
 	app_common.ServeForever(app, baseOpts)
 }
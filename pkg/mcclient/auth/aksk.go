@@ -59,7 +59,7 @@ func (c *sAccessKeyCache) deleteToken(token string) bool {
 	return c.Delete(token)
 }
 
-func (c *sAccessKeyCache) Verify(cli *mcclient.Client, req http.Request, virtualHost bool) (mcclient.TokenCredential, error) {
+func (c *sAccessKeyCache) Verify(cli *mcclient.Client, req http.Request, virtualHost bool) (*mcclient.SAkskTokenCredential, error) {
 	aksk, err := s3auth.DecodeAccessKeyRequest(req, virtualHost)
 	if err != nil {
 		return nil, errors.Wrap(err, "s3auth.DecodeAccessKeyRequestV2")
@@ -72,7 +72,7 @@ func (c *sAccessKeyCache) Verify(cli *mcclient.Client, req http.Request, virtual
 			if err != nil {
 				return nil, errors.Wrap(err, "aksk.Verify")
 			}
-			return token.Token, nil
+			return token, nil
 		} else {
 			c.deleteToken(aksk.GetAccessKey())
 		}
@@ -85,5 +85,5 @@ func (c *sAccessKeyCache) Verify(cli *mcclient.Client, req http.Request, virtual
 
 	c.addToken(token)
 
-	return token.Token, nil
+	return token, nil
 }
@@ -159,7 +159,7 @@ func newAuthManager(cli *mcclient.Client, info *AuthInfo) *authManager {
 	return authm
 }
 
-func (a *authManager) verifyRequest(req http.Request, virtualHost bool) (mcclient.TokenCredential, error) {
+func (a *authManager) verifyRequest(req http.Request, virtualHost bool) (*mcclient.SAkskTokenCredential, error) {
 	if a.adminCredential == nil {
 		return nil, fmt.Errorf("No valid admin token credential")
 	}
@@ -286,6 +286,16 @@ func Verify(ctx context.Context, tokenId string) (mcclient.TokenCredential, erro
 }
 
 func VerifyRequest(req http.Request, virtualHost bool) (mcclient.TokenCredential, error) {
+	cred, err := manager.verifyRequest(req, virtualHost)
+	if err != nil {
+		return nil, err
+	}
+	return cred.Token, nil
+}
+
+// VerifyAccessKeyRequest verifies the request signed by access key, the
+// returned credential carries the access key secret as well
+func VerifyAccessKeyRequest(req http.Request, virtualHost bool) (*mcclient.SAkskTokenCredential, error) {
 	return manager.verifyRequest(req, virtualHost)
 }
 
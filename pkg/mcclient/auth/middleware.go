@@ -77,6 +77,9 @@ func AuthenticateWithDelayDecision(f appsrv.FilterHandler, delayDecision bool) a
 		if taskId := r.Header.Get(mcclient.TASK_ID); taskId != "" {
 			ctx = context.WithValue(ctx, appctx.APP_CONTEXT_KEY_TASK_ID, taskId)
 		}
+		if attempt := r.Header.Get(mcclient.TASK_STAGE_ATTEMPT); attempt != "" {
+			ctx = context.WithValue(ctx, appctx.APP_CONTEXT_KEY_TASK_STAGE_ATTEMPT, attempt)
+		}
 		if taskNotifyUrl := r.Header.Get(mcclient.TASK_NOTIFY_URL); taskNotifyUrl != "" {
 			ctx = context.WithValue(ctx, appctx.APP_CONTEXT_KEY_TASK_NOTIFY_URL, taskNotifyUrl)
 		}
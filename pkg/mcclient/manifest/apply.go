@@ -0,0 +1,255 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+)
+
+const (
+	DefaultApplyTimeout = 30 * time.Minute
+	defaultPollInterval = 5 * time.Second
+)
+
+type SApplyOptions struct {
+	// wait for the resources to become ready after each change, the
+	// resources referenced by later changes are always waited for
+	Wait    bool
+	Timeout time.Duration
+	// interval of polling the resource status
+	PollInterval time.Duration
+	// progress output
+	Output io.Writer
+}
+
+type sApplier struct {
+	cli   IResourceClient
+	opts  SApplyOptions
+	stack string
+	state map[string]jsonutils.JSONObject
+	// keys of the resources referenced by other resources
+	referenced map[string]bool
+}
+
+// Apply executes the changes of the plan in order and stops at the first
+// failure, the changes applied before are kept and will be reported as
+// up to date by the next plan
+func Apply(cli IResourceClient, plan *SPlan, opts SApplyOptions) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultApplyTimeout
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.Output == nil {
+		opts.Output = ioutil.Discard
+	}
+	applier := &sApplier{
+		cli:        cli,
+		opts:       opts,
+		stack:      plan.Stack,
+		state:      map[string]jsonutils.JSONObject{},
+		referenced: map[string]bool{},
+	}
+	for k, v := range plan.state {
+		applier.state[k] = v
+	}
+	for _, c := range plan.Changes {
+		if c.Resource == nil {
+			continue
+		}
+		for _, ref := range c.Resource.references() {
+			applier.referenced[ref] = true
+		}
+	}
+	for _, c := range plan.Changes {
+		var err error
+		switch c.Action {
+		case ChangeCreate:
+			err = applier.create(c)
+		case ChangeUpdate:
+			err = applier.update(c)
+		case ChangeDelete:
+			err = applier.delete(c)
+		default:
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s %s", c.Action, c.Key())
+		}
+	}
+	return nil
+}
+
+func (a *sApplier) printf(format string, args ...interface{}) {
+	fmt.Fprintf(a.opts.Output, format, args...)
+}
+
+func (a *sApplier) resolve(res *SResource) (*jsonutils.JSONDict, error) {
+	resolved, unknown, err := resolveReferences(res.Spec, a.state)
+	if err != nil {
+		return nil, err
+	}
+	if unknown {
+		// dependencies are created before, so this happens only if one
+		// of them was not created by this apply
+		return nil, errors.Errorf("unresolved references in %s", res.Key())
+	}
+	return resolved.(*jsonutils.JSONDict), nil
+}
+
+func (a *sApplier) create(c *SChange) error {
+	kind := kinds[c.Kind]
+	params, err := a.resolve(c.Resource)
+	if err != nil {
+		return err
+	}
+	params.Set("name", jsonutils.NewString(c.Name))
+	meta := jsonutils.NewDict()
+	if params.Contains("__meta__") {
+		userMeta, _ := params.Get("__meta__")
+		meta.Update(userMeta)
+	}
+	meta.Set(StackLabelKey, jsonutils.NewString(a.stack))
+	params.Set("__meta__", meta)
+	a.printf("%s: creating...\n", c.Key())
+	obj, err := a.cli.Create(kind.Module, params)
+	if err != nil {
+		return err
+	}
+	c.Id, _ = obj.GetString("id")
+	a.state[c.Key()] = obj
+	if a.opts.Wait || a.referenced[c.Key()] {
+		obj, err = a.waitReady(kind, c.Id)
+		if err != nil {
+			return err
+		}
+		a.state[c.Key()] = obj
+	}
+	a.printf("%s: created (%s)\n", c.Key(), c.Id)
+	return nil
+}
+
+func (a *sApplier) update(c *SChange) error {
+	kind := kinds[c.Kind]
+	params, err := a.resolve(c.Resource)
+	if err != nil {
+		return err
+	}
+	input := jsonutils.NewDict()
+	for _, d := range c.Diffs {
+		val, _ := params.Get(d.Field)
+		input.Set(d.Field, val)
+	}
+	a.printf("%s: updating...\n", c.Key())
+	obj, err := a.cli.Update(kind.Module, c.Id, input)
+	if err != nil {
+		return err
+	}
+	a.state[c.Key()] = obj
+	if a.opts.Wait || a.referenced[c.Key()] {
+		obj, err = a.waitReady(kind, c.Id)
+		if err != nil {
+			return err
+		}
+		a.state[c.Key()] = obj
+	}
+	a.printf("%s: updated\n", c.Key())
+	return nil
+}
+
+func (a *sApplier) delete(c *SChange) error {
+	kind := kinds[c.Kind]
+	a.printf("%s: deleting...\n", c.Key())
+	err := a.cli.Delete(kind.Module, c.Id)
+	if err != nil {
+		return err
+	}
+	delete(a.state, c.Key())
+	// resources must be gone before the ones they depend on are deleted
+	pending, err := a.waitDeleted(kind, c.Id)
+	if err != nil {
+		return err
+	}
+	if pending {
+		a.printf("%s: moved to recycle bin\n", c.Key())
+	} else {
+		a.printf("%s: deleted\n", c.Key())
+	}
+	return nil
+}
+
+func isFailedStatus(status string) bool {
+	return strings.Contains(status, "fail")
+}
+
+func (a *sApplier) waitReady(kind *sKind, id string) (jsonutils.JSONObject, error) {
+	deadline := time.Now().Add(a.opts.Timeout)
+	for {
+		obj, err := a.cli.Get(kind.Module, id)
+		if err != nil {
+			return nil, err
+		}
+		status, _ := obj.GetString("status")
+		if utils.IsInStringArray(status, kind.ReadyStatus) {
+			return obj, nil
+		}
+		if isFailedStatus(status) {
+			reason, _ := obj.GetString("progress")
+			return nil, errors.Errorf("%s %s is in status %s %s", kind.Kind, id, status, reason)
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Wrapf(errors.ErrTimeout, "wait %s %s ready, current status %s", kind.Kind, id, status)
+		}
+		time.Sleep(a.opts.PollInterval)
+	}
+}
+
+// waitDeleted waits until the resource is deleted or moved to the recycle
+// bin, in which case pending is true
+func (a *sApplier) waitDeleted(kind *sKind, id string) (pending bool, err error) {
+	deadline := time.Now().Add(a.opts.Timeout)
+	for {
+		obj, err := a.cli.Get(kind.Module, id)
+		if err != nil {
+			if isNotFound(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		status, _ := obj.GetString("status")
+		if status == "deleted" {
+			return false, nil
+		}
+		if pending, _ := obj.Bool("pending_deleted"); pending {
+			return true, nil
+		}
+		if isFailedStatus(status) {
+			return false, errors.Errorf("%s %s is in status %s", kind.Kind, id, status)
+		}
+		if time.Now().After(deadline) {
+			return false, errors.Wrapf(errors.ErrTimeout, "wait %s %s deleted, current status %s", kind.Kind, id, status)
+		}
+		time.Sleep(a.opts.PollInterval)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+)
+
+// IResourceClient accesses the resources of the mcclient modules, Get
+// returns errors.ErrNotFound if the resource does not exist
+type IResourceClient interface {
+	List(module string, params jsonutils.JSONObject) ([]jsonutils.JSONObject, error)
+	Get(module string, id string) (jsonutils.JSONObject, error)
+	Create(module string, params jsonutils.JSONObject) (jsonutils.JSONObject, error)
+	Update(module string, id string, params jsonutils.JSONObject) (jsonutils.JSONObject, error)
+	// Delete deletes the resource, which may be kept in the recycle bin
+	Delete(module string, id string) error
+	// ProjectId returns the id of the project resources are created in by default
+	ProjectId() string
+}
+
+type sSessionClient struct {
+	session *mcclient.ClientSession
+}
+
+func NewSessionClient(s *mcclient.ClientSession) IResourceClient {
+	return &sSessionClient{session: s}
+}
+
+func (cli *sSessionClient) module(name string) (modulebase.Manager, error) {
+	return modulebase.GetModule(cli.session, name)
+}
+
+const listPageSize = 1000
+
+func (cli *sSessionClient) List(module string, params jsonutils.JSONObject) ([]jsonutils.JSONObject, error) {
+	man, err := cli.module(module)
+	if err != nil {
+		return nil, err
+	}
+	query := jsonutils.NewDict()
+	if params != nil {
+		query.Update(params)
+	}
+	query.Set("limit", jsonutils.NewInt(listPageSize))
+	ret := []jsonutils.JSONObject{}
+	for {
+		query.Set("offset", jsonutils.NewInt(int64(len(ret))))
+		result, err := man.List(cli.session, query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list %s", module)
+		}
+		ret = append(ret, result.Data...)
+		if len(result.Data) == 0 || len(ret) >= result.Total {
+			break
+		}
+	}
+	return ret, nil
+}
+
+func (cli *sSessionClient) Get(module string, id string) (jsonutils.JSONObject, error) {
+	man, err := cli.module(module)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := man.Get(cli.session, id, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, errors.Wrapf(errors.ErrNotFound, "%s %s", module, id)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (cli *sSessionClient) Create(module string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	man, err := cli.module(module)
+	if err != nil {
+		return nil, err
+	}
+	return man.Create(cli.session, params)
+}
+
+func (cli *sSessionClient) Update(module string, id string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	man, err := cli.module(module)
+	if err != nil {
+		return nil, err
+	}
+	return man.Update(cli.session, id, params)
+}
+
+func (cli *sSessionClient) Delete(module string, id string) error {
+	man, err := cli.module(module)
+	if err != nil {
+		return err
+	}
+	_, err = man.Delete(cli.session, id, nil)
+	if err != nil && isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (cli *sSessionClient) ProjectId() string {
+	return cli.session.GetProjectId()
+}
+
+func isNotFound(err error) bool {
+	if errors.Cause(err) == errors.ErrNotFound {
+		return true
+	}
+	jsonErr, ok := errors.Cause(err).(*httputils.JSONClientError)
+	return ok && jsonErr.Code == 404
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"sort"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+)
+
+const (
+	KIND_SECGROUP     = "secgroup"
+	KIND_NETWORK      = "network"
+	KIND_DISK         = "disk"
+	KIND_SERVER       = "server"
+	KIND_LOADBALANCER = "loadbalancer"
+	KIND_DNS_RECORD   = "dns_record"
+)
+
+// sKind describes how resources of a kind are managed
+type sKind struct {
+	Kind string
+	// keyword plural of the mcclient module
+	Module string
+	// resources are created in ascending order and deleted in descending
+	// order unless they depend on each other explicitly
+	Order int
+	// spec fields which are changed by the update API, changes of other
+	// fields are reported but not applied as they require recreation
+	Updatable []string
+	// statuses in which the resource is ready after creation or update
+	ReadyStatus []string
+	// resources belong to a project, names are unique in the project
+	Projectized bool
+}
+
+var kinds = map[string]*sKind{}
+
+func registerKind(kind *sKind) {
+	kinds[kind.Kind] = kind
+}
+
+func init() {
+	registerKind(&sKind{
+		Kind:        KIND_SECGROUP,
+		Module:      "secgroups",
+		Order:       10,
+		Updatable:   []string{"description"},
+		ReadyStatus: []string{api.SECGROUP_STATUS_READY},
+		Projectized: true,
+	})
+	registerKind(&sKind{
+		Kind:        KIND_NETWORK,
+		Module:      "networks",
+		Order:       20,
+		Updatable:   []string{"description", "guest_dns", "guest_domain", "guest_ntp"},
+		ReadyStatus: []string{api.NETWORK_STATUS_AVAILABLE},
+		Projectized: true,
+	})
+	registerKind(&sKind{
+		Kind:        KIND_DISK,
+		Module:      "disks",
+		Order:       30,
+		Updatable:   []string{"description"},
+		ReadyStatus: []string{api.DISK_READY},
+		Projectized: true,
+	})
+	registerKind(&sKind{
+		Kind:        KIND_SERVER,
+		Module:      "servers",
+		Order:       40,
+		Updatable:   []string{"description"},
+		ReadyStatus: []string{api.VM_RUNNING, api.VM_READY},
+		Projectized: true,
+	})
+	registerKind(&sKind{
+		Kind:        KIND_LOADBALANCER,
+		Module:      "loadbalancers",
+		Order:       50,
+		Updatable:   []string{"description"},
+		ReadyStatus: []string{api.LB_STATUS_ENABLED, api.LB_STATUS_DISABLED},
+		Projectized: true,
+	})
+	registerKind(&sKind{
+		Kind:        KIND_DNS_RECORD,
+		Module:      "dns_recordsets",
+		Order:       60,
+		Updatable:   []string{"description", "dns_value", "ttl", "mx_priority"},
+		ReadyStatus: []string{api.DNS_RECORDSET_STATUS_AVAILABLE},
+	})
+}
+
+// KindNames returns the supported kinds in creation order
+func KindNames() []string {
+	ret := make([]string, 0, len(kinds))
+	for k := range kinds {
+		ret = append(ret, k)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return kinds[ret[i]].Order < kinds[ret[j]].Order
+	})
+	return ret
+}
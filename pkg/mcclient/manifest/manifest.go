@@ -0,0 +1,311 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+)
+
+// SResource describes the desired state of a resource, Spec is the input
+// of the create API, of which the string values may reference other
+// resources of the manifest by ${kind:name} (the id) or
+// ${kind:name:field} (a field of the resource details)
+type SResource struct {
+	Kind      string              `json:"kind"`
+	Name      string              `json:"name"`
+	DependsOn []string            `json:"depends_on"`
+	Spec      *jsonutils.JSONDict `json:"spec"`
+}
+
+func (res *SResource) Key() string {
+	return resourceKey(res.Kind, res.Name)
+}
+
+func resourceKey(kind, name string) string {
+	return fmt.Sprintf("%s/%s", kind, name)
+}
+
+// SManifest is the set of resources owned by a stack, resources created
+// by apply are labeled with the stack so that they can be found again by
+// the later plan and destroy
+type SManifest struct {
+	Stack     string      `json:"stack"`
+	Resources []SResource `json:"resources"`
+}
+
+var refPattern = regexp.MustCompile(`\$\{([a-z_]+):([^:}]+)(?::([a-zA-Z0-9_]+))?\}`)
+
+type sReference struct {
+	expr  string
+	kind  string
+	name  string
+	field string
+}
+
+func (ref sReference) key() string {
+	return resourceKey(ref.kind, ref.name)
+}
+
+func findReferences(str string) []sReference {
+	refs := []sReference{}
+	for _, m := range refPattern.FindAllStringSubmatch(str, -1) {
+		refs = append(refs, sReference{expr: m[0], kind: m[1], name: m[2], field: m[3]})
+	}
+	return refs
+}
+
+// walkStrings returns a copy of obj with all strings replaced by f
+func walkStrings(obj jsonutils.JSONObject, f func(str string) (string, error)) (jsonutils.JSONObject, error) {
+	switch val := obj.(type) {
+	case *jsonutils.JSONDict:
+		ret := jsonutils.NewDict()
+		m, _ := val.GetMap()
+		for k, v := range m {
+			nv, err := walkStrings(v, f)
+			if err != nil {
+				return nil, err
+			}
+			ret.Set(k, nv)
+		}
+		return ret, nil
+	case *jsonutils.JSONArray:
+		items, _ := val.GetArray()
+		ret := jsonutils.NewArray()
+		for i := range items {
+			nv, err := walkStrings(items[i], f)
+			if err != nil {
+				return nil, err
+			}
+			ret.Add(nv)
+		}
+		return ret, nil
+	case *jsonutils.JSONString:
+		str, _ := val.GetString()
+		nstr, err := f(str)
+		if err != nil {
+			return nil, err
+		}
+		return jsonutils.NewString(nstr), nil
+	}
+	return obj, nil
+}
+
+// references returns the keys of the resources referenced by the spec or
+// listed in depends_on
+func (res *SResource) references() []string {
+	keys := map[string]bool{}
+	for _, dep := range res.DependsOn {
+		keys[dep] = true
+	}
+	if res.Spec != nil {
+		walkStrings(res.Spec, func(str string) (string, error) {
+			for _, ref := range findReferences(str) {
+				keys[ref.key()] = true
+			}
+			return str, nil
+		})
+	}
+	ret := make([]string, 0, len(keys))
+	for k := range keys {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// ParseManifest parses a YAML or JSON manifest. A document either lists
+// resources under "resources", describes a single resource or only names
+// the stack, multiple documents are separated by "---".
+func ParseManifest(content string) (*SManifest, error) {
+	manifest := &SManifest{}
+	for i, doc := range splitDocuments(content) {
+		obj, err := jsonutils.ParseYAML(doc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse document %d", i)
+		}
+		if obj.Contains("resources") {
+			part := SManifest{}
+			err = obj.Unmarshal(&part)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unmarshal document %d", i)
+			}
+			err = manifest.merge(&part)
+			if err != nil {
+				return nil, err
+			}
+		} else if obj.Contains("kind") {
+			res := SResource{}
+			err = obj.Unmarshal(&res)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unmarshal document %d", i)
+			}
+			stack, _ := obj.GetString("stack")
+			err = manifest.merge(&SManifest{Stack: stack, Resources: []SResource{res}})
+			if err != nil {
+				return nil, err
+			}
+		} else if obj.Contains("stack") {
+			stack, _ := obj.GetString("stack")
+			err = manifest.merge(&SManifest{Stack: stack})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, errors.Errorf("document %d: neither resources nor kind is found", i)
+		}
+	}
+	return manifest, nil
+}
+
+// LoadManifests reads and merges the manifest files
+func LoadManifests(files []string) (*SManifest, error) {
+	manifest := &SManifest{}
+	for _, fn := range files {
+		content, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read %s", fn)
+		}
+		part, err := ParseManifest(string(content))
+		if err != nil {
+			return nil, errors.Wrap(err, fn)
+		}
+		err = manifest.merge(part)
+		if err != nil {
+			return nil, errors.Wrap(err, fn)
+		}
+	}
+	return manifest, nil
+}
+
+func splitDocuments(content string) []string {
+	docs := []string{}
+	cur := []string{}
+	flush := func() {
+		doc := strings.TrimSpace(strings.Join(cur, "\n"))
+		if len(doc) > 0 {
+			docs = append(docs, doc)
+		}
+		cur = cur[:0]
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimRight(line, " \r") == "---" {
+			flush()
+			continue
+		}
+		cur = append(cur, line)
+	}
+	flush()
+	return docs
+}
+
+func (m *SManifest) merge(o *SManifest) error {
+	if len(o.Stack) > 0 {
+		if len(m.Stack) > 0 && m.Stack != o.Stack {
+			return errors.Errorf("conflict stack %q and %q", m.Stack, o.Stack)
+		}
+		m.Stack = o.Stack
+	}
+	m.Resources = append(m.Resources, o.Resources...)
+	return nil
+}
+
+// Validate checks the kinds, names and references of the resources and
+// returns the resources sorted in dependency order
+func (m *SManifest) Validate() ([]*SResource, error) {
+	if len(m.Stack) == 0 {
+		return nil, errors.Errorf("missing stack name")
+	}
+	resources := map[string]*SResource{}
+	for i := range m.Resources {
+		res := &m.Resources[i]
+		if _, ok := kinds[res.Kind]; !ok {
+			return nil, errors.Errorf("unsupported kind %q of %q, supported kinds: %s", res.Kind, res.Name, strings.Join(KindNames(), ", "))
+		}
+		if len(res.Name) == 0 {
+			return nil, errors.Errorf("missing name of %s resource", res.Kind)
+		}
+		if res.Spec == nil {
+			res.Spec = jsonutils.NewDict()
+		}
+		if _, ok := resources[res.Key()]; ok {
+			return nil, errors.Errorf("duplicate resource %s", res.Key())
+		}
+		resources[res.Key()] = res
+	}
+	for _, res := range resources {
+		for _, ref := range res.references() {
+			if _, ok := resources[ref]; !ok {
+				return nil, errors.Errorf("%s references %s, which is not defined in the manifest", res.Key(), ref)
+			}
+		}
+	}
+	return sortResources(resources)
+}
+
+// sortResources sorts the resources topologically, resources without
+// dependencies between them are ordered by kind and then by name
+func sortResources(resources map[string]*SResource) ([]*SResource, error) {
+	keys := make([]string, 0, len(resources))
+	for k := range resources {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ki, kj := kinds[resources[keys[i]].Kind], kinds[resources[keys[j]].Kind]
+		if ki.Order != kj.Order {
+			return ki.Order < kj.Order
+		}
+		return keys[i] < keys[j]
+	})
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	sorted := make([]*SResource, 0, len(keys))
+	var visit func(key string, path []string) error
+	visit = func(key string, path []string) error {
+		switch state[key] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.Errorf("dependency cycle: %s", strings.Join(append(path, key), " -> "))
+		}
+		state[key] = visiting
+		for _, dep := range resources[key].references() {
+			err := visit(dep, append(path, key))
+			if err != nil {
+				return err
+			}
+		}
+		state[key] = visited
+		sorted = append(sorted, resources[key])
+		return nil
+	}
+	for _, key := range keys {
+		err := visit(key, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
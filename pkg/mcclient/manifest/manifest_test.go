@@ -0,0 +1,362 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/util/tagutils"
+)
+
+type fakeClient struct {
+	objs  map[string][]*jsonutils.JSONDict
+	seq   int
+	calls []string
+	// modules of which deleted resources are kept in the recycle bin
+	recycle map[string]bool
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{objs: map[string][]*jsonutils.JSONDict{}, recycle: map[string]bool{}}
+}
+
+const fakeProjectId = "project1"
+
+func (cli *fakeClient) ProjectId() string {
+	return fakeProjectId
+}
+
+func (cli *fakeClient) add(module string, obj *jsonutils.JSONDict) {
+	cli.objs[module] = append(cli.objs[module], obj)
+}
+
+func (cli *fakeClient) find(module, id string) (int, *jsonutils.JSONDict) {
+	for i, obj := range cli.objs[module] {
+		if objId, _ := obj.GetString("id"); objId == id {
+			return i, obj
+		}
+	}
+	return -1, nil
+}
+
+func (cli *fakeClient) List(module string, params jsonutils.JSONObject) ([]jsonutils.JSONObject, error) {
+	tags := tagutils.TTagSet{}
+	params.Unmarshal(&tags, "tags")
+	names := []string{}
+	params.Unmarshal(&names, "name")
+	projectId, _ := params.GetString("project_id")
+	ret := []jsonutils.JSONObject{}
+	for _, obj := range cli.objs[module] {
+		match := true
+		for _, tag := range tags {
+			val, _ := obj.GetString("metadata", tag.Key)
+			match = match && val == tag.Value
+		}
+		if len(names) > 0 {
+			name, _ := obj.GetString("name")
+			match = match && name == names[0]
+		}
+		if len(projectId) > 0 {
+			tenantId, _ := obj.GetString("tenant_id")
+			match = match && tenantId == projectId
+		}
+		if match {
+			ret = append(ret, obj)
+		}
+	}
+	return ret, nil
+}
+
+func (cli *fakeClient) Get(module string, id string) (jsonutils.JSONObject, error) {
+	_, obj := cli.find(module, id)
+	if obj == nil {
+		return nil, errors.ErrNotFound
+	}
+	return obj, nil
+}
+
+func (cli *fakeClient) Create(module string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	cli.seq++
+	obj := params.(*jsonutils.JSONDict).CopyExcludes("__meta__")
+	obj.Set("id", jsonutils.NewString(fmt.Sprintf("%s-%d", module, cli.seq)))
+	obj.Set("tenant_id", jsonutils.NewString(fakeProjectId))
+	obj.Set("status", jsonutils.NewString(kinds[cli.kindOf(module)].ReadyStatus[0]))
+	if module == "servers" {
+		obj.Set("ips", jsonutils.NewString("10.0.0.2"))
+	}
+	meta, _ := params.Get("__meta__")
+	obj.Set("metadata", meta)
+	cli.add(module, obj)
+	name, _ := obj.GetString("name")
+	cli.calls = append(cli.calls, "create "+module+" "+name)
+	return obj, nil
+}
+
+func (cli *fakeClient) Update(module string, id string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	_, obj := cli.find(module, id)
+	if obj == nil {
+		return nil, errors.ErrNotFound
+	}
+	obj.Update(params)
+	cli.calls = append(cli.calls, "update "+module+" "+id)
+	return obj, nil
+}
+
+func (cli *fakeClient) Delete(module string, id string) error {
+	i, obj := cli.find(module, id)
+	if obj == nil {
+		return nil
+	}
+	if protected, _ := obj.Bool("disable_delete"); protected {
+		return errors.Errorf("%s %s is protected", module, id)
+	}
+	if cli.recycle[module] {
+		obj.Set("pending_deleted", jsonutils.JSONTrue)
+	} else {
+		cli.objs[module] = append(cli.objs[module][:i], cli.objs[module][i+1:]...)
+	}
+	cli.calls = append(cli.calls, "delete "+module+" "+id)
+	return nil
+}
+
+func (cli *fakeClient) kindOf(module string) string {
+	for _, kind := range kinds {
+		if kind.Module == module {
+			return kind.Kind
+		}
+	}
+	return ""
+}
+
+const testManifest = `
+stack: web
+resources:
+- kind: server
+  name: web1
+  spec:
+    description: web server
+    vcpu_count: 2
+    nets:
+    - network: ${network:web-net}
+    secgroups: ["${secgroup:web-sg}"]
+- kind: network
+  name: web-net
+  spec:
+    wire: wire0
+    guest_ip_prefix: 10.0.0.0/24
+- kind: secgroup
+  name: web-sg
+---
+kind: dns_record
+name: www
+stack: web
+spec:
+  dns_type: A
+  dns_value: ${server:web1:ips}
+`
+
+func TestParseManifest(t *testing.T) {
+	m, err := ParseManifest(testManifest)
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	if m.Stack != "web" || len(m.Resources) != 4 {
+		t.Fatalf("unexpected manifest %s", jsonutils.Marshal(m))
+	}
+	sorted, err := m.Validate()
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	keys := []string{}
+	for _, res := range sorted {
+		keys = append(keys, res.Key())
+	}
+	want := "secgroup/web-sg,network/web-net,server/web1,dns_record/www"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("sorted resources %s, want %s", got, want)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	cases := []struct {
+		content string
+		err     string
+	}{
+		{"resources:\n- kind: secgroup\n  name: a\n", "missing stack"},
+		{"stack: s\nresources:\n- kind: vpc\n  name: a\n", "unsupported kind"},
+		{"stack: s\nresources:\n- kind: secgroup\n  name: a\n- kind: secgroup\n  name: a\n", "duplicate"},
+		{"stack: s\nresources:\n- kind: server\n  name: a\n  spec:\n    network: ${network:n}\n", "not defined"},
+		{"stack: s\nresources:\n- kind: server\n  name: a\n  depends_on: [server/b]\n- kind: server\n  name: b\n  depends_on: [server/a]\n", "dependency cycle"},
+		{"stack: a\n---\nstack: b\nkind: secgroup\nname: c\n", "conflict stack"},
+	}
+	for _, c := range cases {
+		m, err := ParseManifest(c.content)
+		if err == nil {
+			_, err = m.Validate()
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got error %v, want %q", c.content, err, c.err)
+		}
+	}
+}
+
+func testApply(t *testing.T, cli IResourceClient, m *SManifest, prune bool) *SPlan {
+	plan, err := Plan(cli, m, prune)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	err = Apply(cli, plan, SApplyOptions{Wait: true, Timeout: time.Second, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	return plan
+}
+
+func TestPlanAndApply(t *testing.T) {
+	cli := newFakeClient()
+	m, err := ParseManifest(testManifest)
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	plan := testApply(t, cli, m, true)
+	if create, update, del := plan.Summary(); create != 4 || update != 0 || del != 0 {
+		t.Errorf("first plan %d/%d/%d, want 4/0/0", create, update, del)
+	}
+	srv := cli.objs["servers"][0]
+	if nets, _ := srv.GetArray("nets"); len(nets) != 1 || jsonutils.GetAnyString(nets[0], []string{"network"}) != "networks-2" {
+		t.Errorf("server nets %s, want networks-2", srv)
+	}
+	if label, _ := srv.GetString("metadata", StackLabelKey); label != "web" {
+		t.Errorf("server label %q, want web", label)
+	}
+
+	// unchanged manifest results in no changes
+	plan, err = Plan(cli, m, true)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if plan.HasChanges() {
+		t.Errorf("unexpected changes %s", jsonutils.Marshal(plan.Changes))
+	}
+
+	// updatable fields are updated, others are warned
+	m.Resources[0].Spec.Set("description", jsonutils.NewString("new"))
+	m.Resources[0].Spec.Set("vcpu_count", jsonutils.NewInt(4))
+	m.Resources = m.Resources[:3]
+	plan = testApply(t, cli, m, true)
+	if create, update, del := plan.Summary(); create != 0 || update != 1 || del != 1 {
+		t.Errorf("second plan %d/%d/%d, want 0/1/1", create, update, del)
+	}
+	for _, c := range plan.Changes {
+		if c.Action == ChangeUpdate && (len(c.Diffs) != 1 || len(c.Warnings) != 1) {
+			t.Errorf("unexpected update %s", jsonutils.Marshal(c))
+		}
+	}
+	if desc, _ := srv.GetString("description"); desc != "new" {
+		t.Errorf("server description %q, want new", desc)
+	}
+	if len(cli.objs["dns_recordsets"]) != 0 {
+		t.Errorf("pruned dns record still exists")
+	}
+
+	// destroy deletes in reverse order
+	cli.calls = nil
+	plan, err = PlanDestroy(cli, "web")
+	if err != nil {
+		t.Fatalf("PlanDestroy: %v", err)
+	}
+	err = Apply(cli, plan, SApplyOptions{Timeout: time.Second, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	want := "delete servers servers-3,delete networks networks-2,delete secgroups secgroups-1"
+	got := []string{}
+	for _, call := range cli.calls {
+		if strings.HasPrefix(call, "delete") {
+			got = append(got, call)
+		}
+	}
+	if strings.Join(got, ",") != want {
+		t.Errorf("destroy calls %v, want %s", got, want)
+	}
+}
+
+func TestPlanConflict(t *testing.T) {
+	cli := newFakeClient()
+	cli.add("secgroups", jsonutils.Marshal(map[string]string{"id": "sg1", "name": "web-sg", "tenant_id": fakeProjectId}).(*jsonutils.JSONDict))
+	m, _ := ParseManifest("stack: web\nkind: secgroup\nname: web-sg\n")
+	_, err := Plan(cli, m, true)
+	if err == nil || !strings.Contains(err.Error(), "not owned by the stack") {
+		t.Errorf("got error %v, want conflict", err)
+	}
+
+	// resources of the same name in other projects don't conflict
+	m, _ = ParseManifest("stack: web\nkind: secgroup\nname: web-sg\nspec:\n  project_id: project2\n")
+	plan, err := Plan(cli, m, true)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if create, _, _ := plan.Summary(); create != 1 {
+		t.Errorf("plan creates %d, want 1", create)
+	}
+}
+
+func TestPruneAndDeleteProtection(t *testing.T) {
+	cli := newFakeClient()
+	cli.recycle["servers"] = true
+	m, err := ParseManifest(testManifest)
+	if err != nil {
+		t.Fatalf("ParseManifest: %v", err)
+	}
+	testApply(t, cli, m, false)
+
+	// resources removed from the manifest are kept unless pruned
+	m.Resources = m.Resources[:3]
+	plan := testApply(t, cli, m, false)
+	if _, _, del := plan.Summary(); del != 0 {
+		t.Errorf("plan deletes %d without prune, want 0", del)
+	}
+	if len(cli.objs["dns_recordsets"]) != 1 {
+		t.Errorf("dns record deleted without prune")
+	}
+
+	// protected resources are never deleted
+	srv := cli.objs["servers"][0]
+	srv.Set("disable_delete", jsonutils.JSONTrue)
+	_, err = PlanDestroy(cli, "web")
+	if err == nil || !strings.Contains(err.Error(), "protected") {
+		t.Errorf("got error %v, want protected", err)
+	}
+
+	// deleted servers are kept in the recycle bin
+	srv.Set("disable_delete", jsonutils.JSONFalse)
+	plan, err = PlanDestroy(cli, "web")
+	if err != nil {
+		t.Fatalf("PlanDestroy: %v", err)
+	}
+	err = Apply(cli, plan, SApplyOptions{Timeout: time.Second, PollInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if pending, _ := srv.Bool("pending_deleted"); !pending || len(cli.objs["servers"]) != 1 {
+		t.Errorf("server %s is not in the recycle bin", srv)
+	}
+}
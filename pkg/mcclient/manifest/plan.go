@@ -0,0 +1,367 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/apis"
+	"yunion.io/x/onecloud/pkg/util/tagutils"
+)
+
+const (
+	// user tag labeling the resources owned by a stack
+	StackLabelKey = "user:climc-stack"
+
+	unknownValue = "(known after apply)"
+)
+
+type TChangeAction string
+
+const (
+	ChangeCreate = TChangeAction("create")
+	ChangeUpdate = TChangeAction("update")
+	ChangeDelete = TChangeAction("delete")
+	ChangeNoop   = TChangeAction("noop")
+)
+
+type SFieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+type SChange struct {
+	Action TChangeAction
+	Kind   string
+	Name   string
+	// id of the existing resource
+	Id       string
+	Resource *SResource
+	Diffs    []SFieldDiff
+	Warnings []string
+}
+
+func (c *SChange) Key() string {
+	return resourceKey(c.Kind, c.Name)
+}
+
+// SPlan is the ordered list of changes bringing the stack to the state of
+// the manifest
+type SPlan struct {
+	Stack   string
+	Changes []*SChange
+
+	// existing resources owned by the stack keyed by kind/name
+	state map[string]jsonutils.JSONObject
+}
+
+// fetchState lists the resources labeled with the stack
+func fetchState(cli IResourceClient, stack string, kindNames []string) (map[string]jsonutils.JSONObject, error) {
+	state := map[string]jsonutils.JSONObject{}
+	for _, kindName := range kindNames {
+		kind := kinds[kindName]
+		input := apis.MetadataResourceListInput{
+			Tags: tagutils.TTagSet{{Key: StackLabelKey, Value: stack}},
+		}
+		objs, err := cli.List(kind.Module, jsonutils.Marshal(input))
+		if err != nil {
+			return nil, errors.Wrapf(err, "list %s of stack %s", kind.Module, stack)
+		}
+		for _, obj := range objs {
+			name, _ := obj.GetString("name")
+			key := resourceKey(kindName, name)
+			if _, ok := state[key]; ok {
+				return nil, errors.Errorf("more than one %s named %s are labeled with stack %s", kindName, name, stack)
+			}
+			state[key] = obj
+		}
+	}
+	return state, nil
+}
+
+// resolveReferences substitutes the references in obj by the resources
+// in state, unknown is true if any referenced resource is not created yet
+func resolveReferences(obj jsonutils.JSONObject, state map[string]jsonutils.JSONObject) (ret jsonutils.JSONObject, unknown bool, err error) {
+	ret, err = walkStrings(obj, func(str string) (string, error) {
+		for _, ref := range findReferences(str) {
+			target, ok := state[ref.key()]
+			if !ok {
+				unknown = true
+				return unknownValue, nil
+			}
+			field := ref.field
+			if len(field) == 0 {
+				field = "id"
+			}
+			val, err := target.Get(field)
+			if err != nil {
+				return "", errors.Errorf("%s has no field %s", ref.key(), field)
+			}
+			str = strings.Replace(str, ref.expr, valueString(val), 1)
+		}
+		return str, nil
+	})
+	return
+}
+
+func valueString(obj jsonutils.JSONObject) string {
+	if obj == nil {
+		return ""
+	}
+	if str, ok := obj.(*jsonutils.JSONString); ok {
+		val, _ := str.GetString()
+		return val
+	}
+	return obj.String()
+}
+
+func isScalar(obj jsonutils.JSONObject) bool {
+	switch obj.(type) {
+	case *jsonutils.JSONString, *jsonutils.JSONInt, *jsonutils.JSONFloat, *jsonutils.JSONBool:
+		return true
+	}
+	return false
+}
+
+// Plan compares the manifest with the resources owned by the stack, the
+// owned resources which are no longer in the manifest are deleted if prune
+// is true
+func Plan(cli IResourceClient, manifest *SManifest, prune bool) (*SPlan, error) {
+	resources, err := manifest.Validate()
+	if err != nil {
+		return nil, err
+	}
+	state, err := fetchState(cli, manifest.Stack, KindNames())
+	if err != nil {
+		return nil, err
+	}
+	plan := &SPlan{Stack: manifest.Stack, state: state}
+	desired := map[string]bool{}
+	for _, res := range resources {
+		desired[res.Key()] = true
+		var change *SChange
+		if obj, ok := state[res.Key()]; ok {
+			change, err = diffResource(res, obj, state)
+		} else {
+			change, err = planCreate(cli, res)
+		}
+		if err != nil {
+			return nil, err
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+	if prune {
+		deletes, err := planDeletes(state)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range deletes {
+			if !desired[change.Key()] {
+				plan.Changes = append(plan.Changes, change)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// PlanDestroy plans the deletion of all resources owned by the stack
+func PlanDestroy(cli IResourceClient, stack string) (*SPlan, error) {
+	if len(stack) == 0 {
+		return nil, errors.Errorf("missing stack name")
+	}
+	state, err := fetchState(cli, stack, KindNames())
+	if err != nil {
+		return nil, err
+	}
+	deletes, err := planDeletes(state)
+	if err != nil {
+		return nil, err
+	}
+	return &SPlan{Stack: stack, Changes: deletes, state: state}, nil
+}
+
+// targetProject returns the project the resource is created in
+func targetProject(cli IResourceClient, res *SResource) string {
+	if res.Spec != nil {
+		if project := jsonutils.GetAnyString(res.Spec, []string{"project_id", "project", "tenant_id", "tenant"}); len(project) > 0 {
+			return project
+		}
+	}
+	return cli.ProjectId()
+}
+
+func planCreate(cli IResourceClient, res *SResource) (*SChange, error) {
+	kind := kinds[res.Kind]
+	// refuse to take over resources not created by the stack
+	query := jsonutils.Marshal(apis.StandaloneResourceListInput{Names: []string{res.Name}}).(*jsonutils.JSONDict)
+	if kind.Projectized {
+		query.Set("project_id", jsonutils.NewString(targetProject(cli, res)))
+	}
+	objs, err := cli.List(kind.Module, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list %s named %s", kind.Module, res.Name)
+	}
+	if len(objs) > 0 {
+		id, _ := objs[0].GetString("id")
+		return nil, errors.Errorf("%s %s(%s) exists but is not owned by the stack, label it with %s or rename it", res.Kind, res.Name, id, StackLabelKey)
+	}
+	return &SChange{
+		Action:   ChangeCreate,
+		Kind:     res.Kind,
+		Name:     res.Name,
+		Resource: res,
+	}, nil
+}
+
+func diffResource(res *SResource, obj jsonutils.JSONObject, state map[string]jsonutils.JSONObject) (*SChange, error) {
+	kind := kinds[res.Kind]
+	change := &SChange{
+		Action:   ChangeNoop,
+		Kind:     res.Kind,
+		Name:     res.Name,
+		Resource: res,
+	}
+	change.Id, _ = obj.GetString("id")
+	resolved, _, err := resolveReferences(res.Spec, state)
+	if err != nil {
+		return nil, errors.Wrap(err, res.Key())
+	}
+	spec, _ := resolved.GetMap()
+	fields := make([]string, 0, len(spec))
+	for k := range spec {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if field == "name" || field == "__meta__" {
+			continue
+		}
+		want := spec[field]
+		cur, _ := obj.Get(field)
+		if utils.IsInStringArray(field, kind.Updatable) {
+			if valueString(want) != valueString(cur) {
+				change.Diffs = append(change.Diffs, SFieldDiff{Field: field, Old: valueString(cur), New: valueString(want)})
+			}
+			continue
+		}
+		// only values of the same type are comparable, the create input
+		// may differ from the details, e.g. vmem_size of servers
+		if cur == nil || !isScalar(want) || fmt.Sprintf("%T", want) != fmt.Sprintf("%T", cur) {
+			continue
+		}
+		if valueString(want) != valueString(cur) {
+			change.Warnings = append(change.Warnings, fmt.Sprintf("%s changed from %q to %q, which requires recreation and is ignored", field, valueString(cur), valueString(want)))
+		}
+	}
+	if len(change.Diffs) > 0 {
+		change.Action = ChangeUpdate
+	}
+	return change, nil
+}
+
+// planDeletes deletes the resources in the reverse order of creation
+// planDeletes returns the deletion of all resources in state, resources
+// protected by disable_delete are never deleted by the stack
+func planDeletes(state map[string]jsonutils.JSONObject) ([]*SChange, error) {
+	changes := make([]*SChange, 0, len(state))
+	for key, obj := range state {
+		parts := strings.SplitN(key, "/", 2)
+		change := &SChange{
+			Action: ChangeDelete,
+			Kind:   parts[0],
+			Name:   parts[1],
+		}
+		change.Id, _ = obj.GetString("id")
+		if protected, _ := obj.Bool("disable_delete"); protected {
+			return nil, errors.Errorf("%s(%s) is protected from deletion, disable the protection before deleting it", key, change.Id)
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		ki, kj := kinds[changes[i].Kind], kinds[changes[j].Kind]
+		if ki.Order != kj.Order {
+			return ki.Order > kj.Order
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes, nil
+}
+
+// Summary returns the numbers of resources to create, update and delete
+func (p *SPlan) Summary() (create, update, delete int) {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ChangeCreate:
+			create++
+		case ChangeUpdate:
+			update++
+		case ChangeDelete:
+			delete++
+		}
+	}
+	return
+}
+
+func (p *SPlan) HasChanges() bool {
+	create, update, delete := p.Summary()
+	return create+update+delete > 0
+}
+
+// Print writes the plan in a human readable form
+func (p *SPlan) Print(w io.Writer) {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ChangeCreate:
+			fmt.Fprintf(w, "+ %s\n", c.Key())
+			resolved, _, err := resolveReferences(c.Resource.Spec, p.state)
+			if err != nil {
+				resolved = c.Resource.Spec
+			}
+			spec, _ := resolved.GetMap()
+			fields := make([]string, 0, len(spec))
+			for k := range spec {
+				fields = append(fields, k)
+			}
+			sort.Strings(fields)
+			for _, field := range fields {
+				fmt.Fprintf(w, "    %s: %s\n", field, valueString(spec[field]))
+			}
+		case ChangeUpdate:
+			fmt.Fprintf(w, "~ %s (%s)\n", c.Key(), c.Id)
+			for _, d := range c.Diffs {
+				fmt.Fprintf(w, "    %s: %q => %q\n", d.Field, d.Old, d.New)
+			}
+		case ChangeDelete:
+			fmt.Fprintf(w, "- %s (%s)\n", c.Key(), c.Id)
+		}
+		for _, warn := range c.Warnings {
+			fmt.Fprintf(w, "! %s: %s\n", c.Key(), warn)
+		}
+	}
+	create, update, delete := p.Summary()
+	if create+update+delete == 0 {
+		fmt.Fprintf(w, "No changes, stack %s is up to date.\n", p.Stack)
+		return
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete.\n", create, update, delete)
+}
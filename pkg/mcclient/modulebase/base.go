@@ -220,7 +220,11 @@ func (this *BaseManager) _list(session *mcclient.ClientSession, path, responseKe
 }
 
 func (this *BaseManager) _submit(session *mcclient.ClientSession, method httputils.THttpMethod, path string, body jsonutils.JSONObject, respKey string) (jsonutils.JSONObject, error) {
-	hdr, resp, e := this.jsonRequest(session, method, path, nil, body)
+	return this._submitWithHeader(session, method, path, nil, body, respKey)
+}
+
+func (this *BaseManager) _submitWithHeader(session *mcclient.ClientSession, method httputils.THttpMethod, path string, header http.Header, body jsonutils.JSONObject, respKey string) (jsonutils.JSONObject, error) {
+	hdr, resp, e := this.jsonRequest(session, method, path, header, body)
 	if e != nil {
 		return nil, e
 	}
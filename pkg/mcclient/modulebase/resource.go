@@ -16,7 +16,9 @@ package modulebase
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"yunion.io/x/jsonutils"
@@ -409,6 +411,25 @@ func (this *ResourceManager) PutInContexts(session *mcclient.ClientSession, id s
 	return this.filterSingleResult(session, result, nil)
 }
 
+// versionHeader returns If-Match header asking the server to apply the
+// change only when the resource is still at update_version version
+func versionHeader(version int) http.Header {
+	header := http.Header{}
+	header.Set("If-Match", fmt.Sprintf("%q", strconv.Itoa(version)))
+	return header
+}
+
+// UpdateWithVersion updates the resource like Update, but fails with 412
+// when the resource has been modified since update_version version
+func (this *ResourceManager) UpdateWithVersion(session *mcclient.ClientSession, id string, version int, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	path := fmt.Sprintf("/%s/%s", this.ContextPath(nil), url.PathEscape(id))
+	result, err := this._submitWithHeader(session, "PUT", path, versionHeader(version), this.params2Body(session, params, this.Keyword), this.Keyword)
+	if err != nil {
+		return nil, err
+	}
+	return this.filterSingleResult(session, result, nil)
+}
+
 func (this *ResourceManager) PutSpecific(session *mcclient.ClientSession, id string, spec string, query, body jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	return this.PutSpecificInContexts(session, id, spec, query, body, nil)
 }
@@ -511,6 +532,17 @@ func (this *ResourceManager) PerformActionInContexts(session *mcclient.ClientSes
 	return this.filterSingleResult(session, result, nil)
 }
 
+// PerformActionWithVersion performs the action like PerformAction, but fails
+// with 412 when the resource has been modified since update_version version
+func (this *ResourceManager) PerformActionWithVersion(session *mcclient.ClientSession, id string, action string, version int, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	path := fmt.Sprintf("/%s/%s/%s", this.ContextPath(nil), url.PathEscape(id), url.PathEscape(action))
+	result, err := this._submitWithHeader(session, "POST", path, versionHeader(version), this.params2Body(session, params, this.Keyword), this.Keyword)
+	if err != nil {
+		return nil, err
+	}
+	return this.filterSingleResult(session, result, nil)
+}
+
 func (this *ResourceManager) PerformClassAction(session *mcclient.ClientSession, action string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
 	return this.PerformClassActionInContexts(session, action, params, nil)
 }
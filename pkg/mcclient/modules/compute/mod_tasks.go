@@ -105,3 +105,11 @@ func (this *TasksManager) List(session *mcclient.ClientSession, params jsonutils
 	}
 	return man.List(session, params)
 }
+
+func (this *TasksManager) Cancel(session *mcclient.ClientSession, id string, params jsonutils.JSONObject) (jsonutils.JSONObject, error) {
+	man, err := this.getManager(session, params)
+	if err != nil {
+		return nil, err
+	}
+	return man.PerformAction(session, id, "cancel", params)
+}
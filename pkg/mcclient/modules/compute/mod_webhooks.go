@@ -0,0 +1,44 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+)
+
+var (
+	WebhookSubscriptions modulebase.ResourceManager
+	WebhookDeliveries    modulebase.ResourceManager
+)
+
+func init() {
+	WebhookSubscriptions = modules.NewComputeManager("webhook_subscription", "webhook_subscriptions",
+		[]string{
+			"id", "name", "enabled", "status", "url", "filter", "pending_count", "dead_letter_count", "tenant",
+		},
+		[]string{},
+	)
+	WebhookDeliveries = modules.NewComputeManager("webhook_delivery", "webhook_deliveries",
+		[]string{
+			"id", "name", "status", "webhook_subscription", "event_type", "resource_id",
+			"attempts", "response_code", "next_retry_at", "last_error", "created_at",
+		},
+		[]string{},
+	)
+
+	modules.RegisterCompute(&WebhookSubscriptions)
+	modules.RegisterCompute(&WebhookDeliveries)
+}
@@ -15,8 +15,12 @@
 package identity
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -24,12 +28,15 @@ import (
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/util/seclib"
+	"yunion.io/x/pkg/utils"
 
 	api "yunion.io/x/onecloud/pkg/apis/identity"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
 	"yunion.io/x/onecloud/pkg/mcclient/modules"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+	"yunion.io/x/onecloud/pkg/util/oidcutils"
 	"yunion.io/x/onecloud/pkg/util/seclib2"
 )
 
@@ -45,6 +52,11 @@ const (
 	RECOVERY_SECRETS_TYPE = api.RECOVERY_SECRETS_TYPE
 	OIDC_CREDENTIAL_TYPE  = api.OIDC_CREDENTIAL_TYPE
 	ENCRYPT_KEY_TYPE      = api.ENCRYPT_KEY_TYPE
+	WEBAUTHN_TYPE         = api.WEBAUTHN_TYPE
+
+	WEBAUTHN_ENROLLMENT_TYPE = api.WEBAUTHN_ENROLLMENT_TYPE
+	USED_TOKEN_TYPE          = api.USED_TOKEN_TYPE
+	OIDC_DEVICE_TYPE         = api.OIDC_DEVICE_TYPE
 )
 
 type STotpSecret struct {
@@ -73,9 +85,63 @@ type SOpenIDConnectCredential struct {
 	ClientId string `json:"client_id"`
 	// Secret      string `json:"secret"`
 	RedirectUri string `json:"redirect_uri"`
+	// public clients, e.g. SPA, mobile apps and CLI tools, have no secret
+	// and must use PKCE for the authorization code grant
+	PublicClient bool `json:"public_client"`
+	// allowed grant types, only authorization_code if empty, other grant
+	// types including refresh_token must be enabled explicitly
+	GrantTypes []string `json:"grant_types"`
 	api.SAccessKeySecretBlob
 }
 
+var defaultOIDCGrantTypes = []string{
+	oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE,
+}
+
+func (cred SOpenIDConnectCredential) GetGrantTypes() []string {
+	if len(cred.GrantTypes) == 0 {
+		return defaultOIDCGrantTypes
+	}
+	return cred.GrantTypes
+}
+
+func (cred SOpenIDConnectCredential) IsGrantTypeAllowed(grantType string) bool {
+	return utils.IsInStringArray(grantType, cred.GetGrantTypes())
+}
+
+// SWebauthnCredential is a WebAuthn public key credential (security key or
+// platform authenticator) registered by a user
+type SWebauthnCredential struct {
+	Id        string    `json:"-"`
+	UserId    string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+
+	// user given name of the authenticator
+	Name string `json:"name"`
+	// base64url encoded credential id
+	CredentialId string `json:"credential_id"`
+	// base64url encoded COSE public key
+	PublicKey  string   `json:"public_key"`
+	SignCount  uint32   `json:"sign_count"`
+	Aaguid     string   `json:"aaguid"`
+	Transports []string `json:"transports"`
+	LastUsedAt int64    `json:"last_used_at"`
+}
+
+func (cred SWebauthnCredential) Marshal() jsonutils.JSONObject {
+	json := jsonutils.NewDict()
+	json.Add(jsonutils.NewString(cred.Id), "id")
+	json.Add(jsonutils.NewString(cred.Name), "name")
+	json.Add(jsonutils.NewString(cred.CredentialId), "credential_id")
+	json.Add(jsonutils.NewString(cred.Aaguid), "aaguid")
+	json.Add(jsonutils.NewStringArray(cred.Transports), "transports")
+	json.Add(jsonutils.NewTimeString(cred.CreatedAt), "created_at")
+	if cred.LastUsedAt > 0 {
+		json.Add(jsonutils.NewTimeString(time.Unix(cred.LastUsedAt, 0)), "last_used_at")
+	}
+	return json
+}
+
 type SEncryptKeySecret struct {
 	KeyId     string             `json:"-"`
 	KeyName   string             `json:"-"`
@@ -170,6 +236,10 @@ func (manager *SCredentialManager) FetchEncryptionKeys(s *mcclient.ClientSession
 	return manager.fetchCredentials(s, ENCRYPT_KEY_TYPE, uid, "")
 }
 
+func (manager *SCredentialManager) FetchWebauthnSecrets(s *mcclient.ClientSession, uid string) ([]jsonutils.JSONObject, error) {
+	return manager.fetchCredentials(s, WEBAUTHN_TYPE, uid, "")
+}
+
 func (manager *SCredentialManager) GetTotpSecret(s *mcclient.ClientSession, uid string) (string, error) {
 	secrets, err := manager.FetchTotpSecrets(s, uid)
 	if err != nil {
@@ -302,6 +372,48 @@ func (manager *SCredentialManager) GetOIDCSecret(s *mcclient.ClientSession, uid
 	return oidcCreds, nil
 }
 
+func DecodeWebauthnCredential(secret jsonutils.JSONObject) (SWebauthnCredential, error) {
+	curr := SWebauthnCredential{}
+	blobStr, err := secret.GetString("blob")
+	if err != nil {
+		return curr, errors.Wrap(err, "secret.GetString")
+	}
+	blobJson, err := jsonutils.ParseString(blobStr)
+	if err != nil {
+		return curr, errors.Wrap(err, "jsonutils.ParseString")
+	}
+	err = blobJson.Unmarshal(&curr)
+	if err != nil {
+		return curr, errors.Wrap(err, "blobJson.Unmarshal")
+	}
+	curr.Id, err = secret.GetString("id")
+	if err != nil {
+		return curr, errors.Wrap(err, "secret.GetString('id')")
+	}
+	curr.UserId, _ = secret.GetString("user_id")
+	curr.CreatedAt, _ = secret.GetTime("created_at")
+	return curr, nil
+}
+
+func (manager *SCredentialManager) GetWebauthnCredentials(s *mcclient.ClientSession, uid string) ([]SWebauthnCredential, error) {
+	secrets, err := manager.FetchWebauthnSecrets(s, uid)
+	if err != nil {
+		return nil, err
+	}
+	creds := make([]SWebauthnCredential, 0)
+	for i := range secrets {
+		if enabled, err := secrets[i].Bool("enabled"); err == nil && !enabled {
+			continue
+		}
+		curr, err := DecodeWebauthnCredential(secrets[i])
+		if err != nil {
+			return nil, errors.Wrap(err, "DecodeWebauthnCredential")
+		}
+		creds = append(creds, curr)
+	}
+	return creds, nil
+}
+
 func DecodeEncryptKey(secret jsonutils.JSONObject) (SEncryptKeySecret, error) {
 	curr := SEncryptKeySecret{}
 	blobStr, err := secret.GetString("blob")
@@ -441,13 +553,54 @@ func isValidRedirectURL(redirectUri string) error {
 }
 
 func (manager *SCredentialManager) CreateOIDCSecret(s *mcclient.ClientSession, uid string, pid string, redirectUri string) (SOpenIDConnectCredential, error) {
-	oidcCred := SOpenIDConnectCredential{}
-	err := isValidRedirectURL(redirectUri)
-	if err != nil {
-		return oidcCred, errors.Wrap(err, "isValidRedirectURL")
+	return manager.CreateOIDCClient(s, uid, pid, SOpenIDConnectCredential{RedirectUri: redirectUri})
+}
+
+// isValidNativeRedirectURL accepts the private-use URI schemes of native
+// apps besides http and https (RFC 8252)
+func isValidNativeRedirectURL(redirectUri string) error {
+	if len(redirectUri) == 0 {
+		return errors.Wrap(httperrors.ErrInputParameter, "empty redirect uri")
+	}
+	u, err := url.Parse(redirectUri)
+	if err != nil || len(u.Scheme) == 0 {
+		return errors.Wrapf(httperrors.ErrInputParameter, "invalid redirect_uri %s", redirectUri)
+	}
+	return nil
+}
+
+// CreateOIDCClient registers an OpenID Connect client, a secret is
+// generated for confidential clients
+func (manager *SCredentialManager) CreateOIDCClient(s *mcclient.ClientSession, uid string, pid string, oidcCred SOpenIDConnectCredential) (SOpenIDConnectCredential, error) {
+	for _, grantType := range oidcCred.GrantTypes {
+		switch grantType {
+		case oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE, oidcutils.OIDC_GRANT_TYPE_REFRESH_TOKEN, oidcutils.OIDC_GRANT_TYPE_DEVICE_CODE:
+		case oidcutils.OIDC_GRANT_TYPE_CLIENT_CREDENTIALS:
+			if oidcCred.PublicClient {
+				return oidcCred, errors.Wrap(httperrors.ErrInputParameter, "public client cannot use client_credentials grant")
+			}
+			if len(uid) == 0 {
+				return oidcCred, errors.Wrap(httperrors.ErrInputParameter, "client_credentials grant requires a user")
+			}
+		default:
+			return oidcCred, errors.Wrapf(httperrors.ErrInputParameter, "unsupported grant type %s", grantType)
+		}
+	}
+	if oidcCred.IsGrantTypeAllowed(oidcutils.OIDC_GRANT_TYPE_AUTHORIZATION_CODE) || len(oidcCred.RedirectUri) > 0 {
+		var err error
+		if oidcCred.PublicClient {
+			err = isValidNativeRedirectURL(oidcCred.RedirectUri)
+		} else {
+			err = isValidRedirectURL(oidcCred.RedirectUri)
+		}
+		if err != nil {
+			return oidcCred, errors.Wrap(err, "isValidRedirectURL")
+		}
+	}
+	oidcCred.Secret = ""
+	if !oidcCred.PublicClient {
+		oidcCred.Secret = base64.URLEncoding.EncodeToString([]byte(seclib.RandomPassword(32)))
 	}
-	oidcCred.Secret = base64.URLEncoding.EncodeToString([]byte(seclib.RandomPassword(32)))
-	oidcCred.RedirectUri = redirectUri
 	blobJson := jsonutils.Marshal(&oidcCred)
 	params := jsonutils.NewDict()
 	name := fmt.Sprintf("oidc-%s-%s-%d", uid, pid, time.Now().Unix())
@@ -490,6 +643,46 @@ func (manager *SCredentialManager) CreateTotpSecret(s *mcclient.ClientSession, u
 	return totp.Totp, nil
 }
 
+func (manager *SCredentialManager) CreateWebauthnCredential(s *mcclient.ClientSession, uid string, cred SWebauthnCredential) (SWebauthnCredential, error) {
+	creds, err := manager.GetWebauthnCredentials(s, uid)
+	if err != nil {
+		return cred, errors.Wrap(err, "GetWebauthnCredentials")
+	}
+	for i := range creds {
+		if creds[i].CredentialId == cred.CredentialId {
+			return cred, httperrors.NewConflictError("authenticator has been registered")
+		}
+	}
+	blobJson := jsonutils.Marshal(&cred)
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(DEFAULT_PROJECT), "project_id")
+	params.Add(jsonutils.NewString(WEBAUTHN_TYPE), "type")
+	params.Add(jsonutils.NewString(uid), "user_id")
+	params.Add(jsonutils.NewString(blobJson.String()), "blob")
+	params.Add(jsonutils.NewString(WEBAUTHN_TYPE), "generate_name")
+	result, err := manager.Create(s, params)
+	if err != nil {
+		return cred, errors.Wrap(err, "Create")
+	}
+	cred.Id, _ = result.GetString("id")
+	cred.UserId = uid
+	cred.CreatedAt, _ = result.GetTime("created_at")
+	return cred, nil
+}
+
+// UpdateWebauthnCredential saves the name, signature counter and last used
+// time of the credential
+func (manager *SCredentialManager) UpdateWebauthnCredential(s *mcclient.ClientSession, cred SWebauthnCredential) error {
+	blobJson := jsonutils.Marshal(&cred)
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(blobJson.String()), "blob")
+	_, err := manager.Update(s, cred.Id, params)
+	if err != nil {
+		return errors.Wrap(err, "Update")
+	}
+	return nil
+}
+
 func (manager *SCredentialManager) SaveRecoverySecrets(s *mcclient.ClientSession, uid string, questions []SRecoverySecret) error {
 	_, err := manager.GetRecoverySecrets(s, uid)
 	if err == nil {
@@ -550,6 +743,119 @@ func (manager *SCredentialManager) CreateEncryptKey(s *mcclient.ClientSession, u
 	return aesKey, nil
 }
 
+func hashCredentialToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MarkTokenUsed records a single-use token in keystone so that every
+// apigateway instance sees it, it returns false if the token has been used
+func (manager *SCredentialManager) MarkTokenUsed(s *mcclient.ClientSession, token string, expire time.Time) (bool, error) {
+	hash := hashCredentialToken(token)
+	blob := api.SExpirableTokenBlob{
+		TokenHash: hash,
+		Expire:    expire.Unix(),
+	}
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(DEFAULT_PROJECT), "project_id")
+	params.Add(jsonutils.NewString(USED_TOKEN_TYPE), "type")
+	params.Add(jsonutils.NewString(fmt.Sprintf("%s-%s", USED_TOKEN_TYPE, hash)), "name")
+	params.Add(jsonutils.NewString(jsonutils.Marshal(&blob).String()), "blob")
+	_, err := manager.Create(s, params)
+	if err != nil {
+		if httputils.ErrorCode(err) == http.StatusConflict {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "Create")
+	}
+	return true, nil
+}
+
+// IsTokenUsed reports whether the token has been recorded by MarkTokenUsed
+func (manager *SCredentialManager) IsTokenUsed(s *mcclient.ClientSession, token string) (bool, error) {
+	query := jsonutils.NewDict()
+	query.Add(jsonutils.NewString(USED_TOKEN_TYPE), "type")
+	query.Add(jsonutils.NewString(fmt.Sprintf("%s-%s", USED_TOKEN_TYPE, hashCredentialToken(token))), "name")
+	query.Add(jsonutils.NewString("system"), "scope")
+	query.Add(jsonutils.NewInt(1), "limit")
+	results, err := manager.List(s, query)
+	if err != nil {
+		return false, errors.Wrap(err, "List")
+	}
+	return len(results.Data) > 0, nil
+}
+
+// CreateWebauthnEnrollmentToken issues a token that allows the user to
+// register the first webauthn authenticator while the domain policy
+// requires webauthn, only the hash of the token is saved
+func (manager *SCredentialManager) CreateWebauthnEnrollmentToken(s *mcclient.ClientSession, uid string, expire time.Time) (string, error) {
+	token := seclib.RandomPassword(32)
+	blob := api.SExpirableTokenBlob{
+		TokenHash: hashCredentialToken(token),
+		Expire:    expire.Unix(),
+	}
+	params := jsonutils.NewDict()
+	params.Add(jsonutils.NewString(DEFAULT_PROJECT), "project_id")
+	params.Add(jsonutils.NewString(WEBAUTHN_ENROLLMENT_TYPE), "type")
+	params.Add(jsonutils.NewString(uid), "user_id")
+	params.Add(jsonutils.NewString(jsonutils.Marshal(&blob).String()), "blob")
+	params.Add(jsonutils.NewString(WEBAUTHN_ENROLLMENT_TYPE), "generate_name")
+	_, err := manager.Create(s, params)
+	if err != nil {
+		return "", errors.Wrap(err, "Create")
+	}
+	return token, nil
+}
+
+// VerifyWebauthnEnrollmentToken returns the id of the enrollment credential
+// matching the token
+func (manager *SCredentialManager) VerifyWebauthnEnrollmentToken(s *mcclient.ClientSession, uid string, token string) (string, error) {
+	if len(token) == 0 {
+		return "", errors.Wrap(httperrors.ErrForbidden, "empty enrollment token")
+	}
+	secrets, err := manager.fetchCredentials(s, WEBAUTHN_ENROLLMENT_TYPE, uid, "")
+	if err != nil {
+		return "", errors.Wrap(err, "fetchCredentials")
+	}
+	hash := hashCredentialToken(token)
+	for i := range secrets {
+		blobStr, _ := secrets[i].GetString("blob")
+		blobJson, err := jsonutils.ParseString(blobStr)
+		if err != nil {
+			continue
+		}
+		blob := api.SExpirableTokenBlob{}
+		if blobJson.Unmarshal(&blob) != nil || blob.IsExpired() {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(blob.TokenHash), []byte(hash)) == 1 {
+			return secrets[i].GetString("id")
+		}
+	}
+	return "", errors.Wrap(httperrors.ErrForbidden, "invalid or expired enrollment token")
+}
+
+// ConsumeWebauthnEnrollmentToken verifies and revokes the enrollment token,
+// the token can be consumed only once
+func (manager *SCredentialManager) ConsumeWebauthnEnrollmentToken(s *mcclient.ClientSession, uid string, token string) error {
+	id, err := manager.VerifyWebauthnEnrollmentToken(s, uid, token)
+	if err != nil {
+		return err
+	}
+	used, err := manager.MarkTokenUsed(s, WEBAUTHN_ENROLLMENT_TYPE+":"+id, time.Now().Add(24*time.Hour))
+	if err != nil {
+		return errors.Wrap(err, "MarkTokenUsed")
+	}
+	if !used {
+		return errors.Wrap(httperrors.ErrForbidden, "enrollment token has been used")
+	}
+	_, err = manager.Delete(s, id, nil)
+	if err != nil {
+		return errors.Wrap(err, "Delete")
+	}
+	return nil
+}
+
 func (manager *SCredentialManager) removeCredentials(s *mcclient.ClientSession, secType string, uid string, pid string) error {
 	secrets, err := manager.fetchCredentials(s, secType, uid, pid)
 	if err != nil {
@@ -583,6 +889,10 @@ func (manager *SCredentialManager) RemoveOIDCSecrets(s *mcclient.ClientSession,
 	return manager.removeCredentials(s, OIDC_CREDENTIAL_TYPE, uid, pid)
 }
 
+func (manager *SCredentialManager) RemoveWebauthnCredentials(s *mcclient.ClientSession, uid string) error {
+	return manager.removeCredentials(s, WEBAUTHN_TYPE, uid, "")
+}
+
 func (manager *SCredentialManager) RemoveEncryptKeys(s *mcclient.ClientSession, uid string) error {
 	return manager.removeCredentials(s, ENCRYPT_KEY_TYPE, uid, "")
 }
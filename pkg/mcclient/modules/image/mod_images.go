@@ -528,6 +528,24 @@ func (this *ImageManager) _update(s *mcclient.ClientSession, id string, params j
 	return json.Get("image")
 }
 
+// UploadChunk sends a chunk of a resumable upload started by the
+// start-upload action, params carries upload_id, offset and checksum
+func (this *ImageManager) UploadChunk(s *mcclient.ClientSession, id string, params jsonutils.JSONObject, body io.Reader, size int64) (jsonutils.JSONObject, error) {
+	path := fmt.Sprintf("/%s/%s/upload-chunk", this.URLPath(), url.PathEscape(id))
+	if params != nil {
+		path = fmt.Sprintf("%s?%s", path, params.QueryString())
+	}
+	headers := http.Header{}
+	headers.Add("Content-Type", "application/octet-stream")
+	headers.Add("Content-Length", fmt.Sprintf("%d", size))
+	resp, err := modulebase.RawRequest(this.ResourceManager, s, "PUT", path, headers, body)
+	_, json, err := s.ParseJSONResponse("", resp, err)
+	if err != nil {
+		return nil, err
+	}
+	return json.Get("image")
+}
+
 func (this *ImageManager) BatchUpdate(
 	session *mcclient.ClientSession, idlist []string, params jsonutils.JSONObject,
 ) []modulebase.SubmitResult {
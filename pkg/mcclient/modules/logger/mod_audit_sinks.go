@@ -0,0 +1,35 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
+	"yunion.io/x/onecloud/pkg/mcclient/modules"
+)
+
+var (
+	AuditSinks modulebase.ResourceManager
+)
+
+func init() {
+	AuditSinks = modules.NewActionManager("audit_sink", "audit_sinks",
+		[]string{"id", "name", "type", "url",
+			"enabled", "status", "filter",
+			"last_action_id", "last_admin_action_id",
+			"last_export_at", "last_error",
+		},
+		[]string{})
+	modules.Register(&AuditSinks)
+}
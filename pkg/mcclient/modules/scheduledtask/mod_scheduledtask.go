@@ -26,10 +26,10 @@ var (
 
 func init() {
 	ScheduledTask = modules.NewScheduledtaskManager("scheduledtask", "scheduledtasks",
-		[]string{"ID", "Name", "Scheduled_Type", "Timer", "Cycle_Timer", "Resource_Type", "Operation", "Label_Type", "Labels", "Timer_Desc"}, []string{},
+		[]string{"ID", "Name", "Scheduled_Type", "Timer", "Cycle_Timer", "Cron_Timer", "Resource_Type", "Operation", "Label_Type", "Labels", "Timer_Desc"}, []string{},
 	)
 	ScheduledTaskActivity = modules.NewScheduledtaskManager("scheudledtaskactivity", "scheduledtaskactivities",
-		[]string{"ID", "Status", "Scheduled_Task_Id", "Start_Time", "End_Time", "Reason"}, []string{},
+		[]string{"ID", "Status", "Scheduled_Task_Id", "Start_Time", "End_Time", "Reason", "Results"}, []string{},
 	)
 	modules.Register(&ScheduledTask)
 	modules.Register(&ScheduledTaskActivity)
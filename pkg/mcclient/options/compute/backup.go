@@ -56,6 +56,7 @@ type DiskBackupCreateOptions struct {
 	options.BaseCreateOptions
 	DISKID          string `help:"disk id" json:"disk_id"`
 	BACKUPSTORAGEID string `help:"back storage id" json:"backup_storage_id"`
+	BackupMode      string `help:"backup mode, incremental backup only saves blocks changed since the latest backup" choices:"full|incremental" json:"backup_mode"`
 }
 
 func (opts *DiskBackupCreateOptions) Params() (jsonutils.JSONObject, error) {
@@ -111,10 +112,15 @@ func (opts *BackupStorageIdOptions) Params() (jsonutils.JSONObject, error) {
 
 type BackupStorageCreateOptions struct {
 	options.BaseCreateOptions
-	StorageType  string `help:"storage type" choices:"nfs"`
-	NfsHost      string `help:"nfs host, required when storage_type is nfs"`
-	NfsSharedDir string `help:"nfs shared dir, required when storage_type is nfs" `
-	CapacityMb   int    `help:"capacity, unit mb"`
+	StorageType     string `help:"storage type" choices:"nfs|object"`
+	NfsHost         string `help:"nfs host, required when storage_type is nfs"`
+	NfsSharedDir    string `help:"nfs shared dir, required when storage_type is nfs" `
+	ObjectBucketUrl string `help:"bucket url, e.g. https://minio.example.com:9000/backups, required when storage_type is object"`
+	ObjectAccessKey string `help:"access key of object storage, required when storage_type is object"`
+	ObjectSecret    string `help:"secret of object storage, required when storage_type is object"`
+	CapacityMb      int    `help:"capacity, unit mb"`
+
+	ObjectInsecureSkipVerify bool `help:"skip verifying TLS certificate of object storage, e.g. self-signed certificate for test"`
 }
 
 func (opts *BackupStorageCreateOptions) Params() (jsonutils.JSONObject, error) {
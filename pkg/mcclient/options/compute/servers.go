@@ -405,6 +405,8 @@ type ServerCreateOptionalOptions struct {
 	Vdi              string   `help:"VDI protocool" choices:"vnc|spice"`
 	Bios             string   `help:"BIOS" choices:"BIOS|UEFI"`
 	Machine          string   `help:"Machine type" choices:"pc|q35"`
+	Vtpm             bool     `help:"Enable virtual TPM device, KVM x86_64 only"`
+	EnableNuma       bool     `help:"Split vcpus and memory into virtual NUMA nodes bound to host NUMA nodes, KVM only"`
 	Desc             string   `help:"Description" metavar:"<DESCRIPTION>" json:"description"`
 	Boot             string   `help:"Boot device" metavar:"<BOOT_DEVICE>" choices:"disk|cdrom" json:"-"`
 	EnableCloudInit  bool     `help:"Enable cloud-init service"`
@@ -511,6 +513,7 @@ func (opts *ServerCreateOptionalOptions) OptionalParams() (*computeapi.ServerCre
 		Vdi:                opts.Vdi,
 		Bios:               opts.Bios,
 		Machine:            opts.Machine,
+		Vtpm:               opts.Vtpm,
 		ShutdownBehavior:   opts.ShutdownBehavior,
 		AutoStart:          opts.AutoStart,
 		Duration:           opts.Duration,
@@ -528,6 +531,7 @@ func (opts *ServerCreateOptionalOptions) OptionalParams() (*computeapi.ServerCre
 		Secgroups:          opts.Secgroups,
 		EnableMemclean:     opts.EnableMemclean,
 	}
+	params.EnableNuma = opts.EnableNuma
 
 	if len(opts.EncryptKey) > 0 {
 		params.EncryptKeyId = &opts.EncryptKey
@@ -873,6 +877,9 @@ type ServerChangeConfigOptions struct {
 	Disk      []string `help:"Data disk description, from the 1st data disk to the last one, empty string if no change for this data disk"`
 
 	InstanceType string `help:"Instance Type, e.g. S2.SMALL2 for qcloud"`
+
+	Vtpm       *bool `help:"Enable or disable virtual TPM device" negative:"no-vtpm"`
+	EnableNuma *bool `help:"Enable or disable guest NUMA topology" negative:"no-enable-numa"`
 }
 
 func (o *ServerChangeConfigOptions) Params() (jsonutils.JSONObject, error) {
@@ -0,0 +1,113 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compute
+
+import (
+	"yunion.io/x/jsonutils"
+
+	api "yunion.io/x/onecloud/pkg/apis/compute"
+	"yunion.io/x/onecloud/pkg/mcclient/options"
+)
+
+type WebhookSubscriptionListOptions struct {
+	options.BaseListOptions
+
+	ResourceType string `help:"Filter by subscribed resource type, e.g. servers"`
+}
+
+func (o *WebhookSubscriptionListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(o)
+}
+
+type WebhookEventFilterOptions struct {
+	ResourceType []string `help:"Resource types to subscribe, e.g. servers, disks, networks"`
+	Action       []string `help:"Actions to subscribe, all actions if not specified" choices:"create|update|delete"`
+	Project      []string `help:"Projects of resources to subscribe, the project of the subscription if not specified"`
+	AllProjects  bool     `help:"Subscribe resources of all projects"`
+}
+
+func (o *WebhookEventFilterOptions) filter() *api.WebhookEventFilter {
+	if len(o.ResourceType) == 0 && len(o.Action) == 0 && len(o.Project) == 0 && !o.AllProjects {
+		return nil
+	}
+	return &api.WebhookEventFilter{
+		ResourceTypes: o.ResourceType,
+		Actions:       o.Action,
+		ProjectIds:    o.Project,
+		AllProjects:   o.AllProjects,
+	}
+}
+
+type WebhookSubscriptionCreateOptions struct {
+	options.BaseCreateOptions
+	WebhookEventFilterOptions
+
+	URL    string `help:"URL receiving the events"`
+	Secret string `help:"Secret to sign the events, 16 to 128 characters" required:"true"`
+}
+
+func (o *WebhookSubscriptionCreateOptions) Params() (jsonutils.JSONObject, error) {
+	input := api.WebhookSubscriptionCreateInput{
+		Url:    o.URL,
+		Secret: o.Secret,
+		Filter: o.filter(),
+	}
+	input.Name = o.NAME
+	input.Description = o.Desc
+	return jsonutils.Marshal(input), nil
+}
+
+type WebhookSubscriptionUpdateOptions struct {
+	options.BaseIdOptions
+	WebhookEventFilterOptions
+
+	Name string `help:"New name"`
+	Desc string `help:"Description"`
+	Url  string `help:"URL receiving the events"`
+}
+
+func (o *WebhookSubscriptionUpdateOptions) Params() (jsonutils.JSONObject, error) {
+	input := api.WebhookSubscriptionUpdateInput{
+		Url:    o.Url,
+		Filter: o.filter(),
+	}
+	input.Name = o.Name
+	input.Description = o.Desc
+	return jsonutils.Marshal(input), nil
+}
+
+type WebhookSubscriptionResetSecretOptions struct {
+	options.BaseIdOptions
+
+	Secret string `help:"New secret, 16 to 128 characters" required:"true"`
+}
+
+func (o *WebhookSubscriptionResetSecretOptions) Params() (jsonutils.JSONObject, error) {
+	return options.StructToParams(o)
+}
+
+type WebhookDeliveryListOptions struct {
+	options.BaseListOptions
+
+	WebhookSubscription string `help:"Filter by webhook subscription id or name" json:"webhook_subscription_id"`
+	ResourceType        string `help:"Filter by resource type"`
+	ResourceId          string `help:"Filter by resource id"`
+	Action              string `help:"Filter by action" choices:"create|update|delete"`
+	DeadLetter          *bool  `help:"List dead letters only" negative:"no-dead-letter"`
+}
+
+func (o *WebhookDeliveryListOptions) Params() (jsonutils.JSONObject, error) {
+	return options.ListStructToParams(o)
+}
@@ -29,16 +29,29 @@ type DNSRecordOptions struct {
 	SRVHost string   `help:"(deprecated) DNS SRV record, server of service" metavar:"SRV_RECORD_HOST" positional:"false"`
 	SRVPort int64    `help:"(deprecated) DNS SRV record, port of service" metavar:"SRV_RECORD_PORT" positional:"false"`
 	SRV     []string `help:"DNS SRV record, in the format of host:port:weight:priority" metavar:"SRV_RECORD" positional:"false"`
+
+	TXT []string `help:"DNS TXT record" metavar:"TXT_RECORD" positional:"false"`
+	MX  []string `help:"DNS MX record, in the format of host:preference" metavar:"MX_RECORD" positional:"false"`
+	CAA []string `help:"DNS CAA record, in the format of flag:tag:value" metavar:"CAA_RECORD" positional:"false"`
 }
 
 func parseDNSRecords(opts *DNSRecordOptions, params *jsonutils.JSONDict) {
-	if len(opts.A) > 0 || len(opts.AAAA) > 0 {
+	if len(opts.A) > 0 || len(opts.AAAA) > 0 || len(opts.TXT) > 0 || len(opts.MX) > 0 || len(opts.CAA) > 0 {
 		for i, a := range opts.A {
 			params.Add(jsonutils.NewString(a), fmt.Sprintf("A.%d", i))
 		}
 		for i, a := range opts.AAAA {
 			params.Add(jsonutils.NewString(a), fmt.Sprintf("AAAA.%d", i))
 		}
+		for i, t := range opts.TXT {
+			params.Add(jsonutils.NewString(t), fmt.Sprintf("TXT.%d", i))
+		}
+		for i, m := range opts.MX {
+			params.Add(jsonutils.NewString(m), fmt.Sprintf("MX.%d", i))
+		}
+		for i, c := range opts.CAA {
+			params.Add(jsonutils.NewString(c), fmt.Sprintf("CAA.%d", i))
+		}
 	} else if len(opts.CNAME) > 0 {
 		params.Add(jsonutils.NewString(opts.CNAME), "CNAME")
 	} else if len(opts.SRV) > 0 || (len(opts.SRVHost) > 0 && opts.SRVPort > 0) {
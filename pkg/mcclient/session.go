@@ -42,6 +42,8 @@ const (
 	AUTH_TOKEN      = api.AUTH_TOKEN_HEADER //  "X-Auth-Token"
 	REGION_VERSION  = "X-Region-Version"
 
+	TASK_STAGE_ATTEMPT = "X-Task-Stage-Attempt"
+
 	DEFAULT_API_VERSION = "v1"
 	V2_API_VERSION      = "v2"
 )
@@ -106,13 +106,18 @@ func (man *SDataSourceManager) initDefaultDataSource(ctx context.Context) error
 			log.Errorf("get empty public session for region %s", region)
 			return
 		}
-		url, err := s.GetServiceURL("influxdb", epType)
+		dsType := options.Options.DataSourceType
+		if dsType == "" {
+			dsType = monitor.DataSourceTypeInfluxdb
+		}
+		url, err := s.GetServiceURL(dsType, epType)
 		if err != nil {
-			log.Errorf("get influxdb public url: %v", err)
+			log.Errorf("get %s public url: %v", dsType, err)
 			return
 		}
 		if ds != nil {
 			if _, err := db.Update(ds, func() error {
+				ds.Type = dsType
 				ds.Url = url
 				return nil
 			}); err != nil {
@@ -121,12 +126,12 @@ func (man *SDataSourceManager) initDefaultDataSource(ctx context.Context) error
 			return
 		}
 		ds = &SDataSource{
-			Type: monitor.DataSourceTypeInfluxdb,
+			Type: dsType,
 			Url:  url,
 		}
 		ds.Name = DefaultDataSource
 		if err := man.TableSpec().Insert(ctx, ds); err != nil {
-			log.Errorf("insert default influxdb: %v", err)
+			log.Errorf("insert default %s: %v", dsType, err)
 		}
 	}
 	wait.Forever(initF, 30*time.Second)
@@ -37,6 +37,8 @@ type AlerterOptions struct {
 	WorkerCheckInterval int `default:"180"`
 
 	AutoMigrationMustPair bool `default:"false" help:"result of auto migration source guests and target hosts must be paired"`
+
+	DataSourceType string `default:"influxdb" choices:"influxdb|prometheus" help:"type of default data source, its url is looked up from service catalog by the same name"`
 }
 
 var (
@@ -0,0 +1,64 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"time"
+
+	api "yunion.io/x/onecloud/pkg/apis/monitor"
+)
+
+type Query struct {
+	Measurement string
+	Alias       string
+	Tags        []api.MetricQueryTag
+	Selects     []*Select
+	// GroupByTags contains tag keys of group by tag() parts
+	GroupByTags []string
+	// GroupByTime is the param of group by time() part, empty when not grouped by time
+	GroupByTime string
+	Interval    time.Duration
+}
+
+type Select struct {
+	Field string
+	Alias string
+	Parts []api.MetricQueryPart
+}
+
+// QueryExpr is the promql range query built from one select of Query
+type QueryExpr struct {
+	Expr  string
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+type Response struct {
+	Status    string       `json:"status"`
+	Data      ResponseData `json:"data"`
+	ErrorType string       `json:"errorType"`
+	Error     string       `json:"error"`
+}
+
+type ResponseData struct {
+	ResultType string   `json:"resultType"`
+	Result     []Series `json:"result"`
+}
+
+type Series struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]interface{}   `json:"values"`
+}
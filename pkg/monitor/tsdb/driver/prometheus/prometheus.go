@@ -0,0 +1,146 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context/ctxhttp"
+	"moul.io/http2curl/v2"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+)
+
+const (
+	ErrPrometheusInvalidResponse = errors.Error("Prometheus invalid status")
+)
+
+func init() {
+	tsdb.RegisterTsdbQueryEndpoint(monitor.DataSourceTypePrometheus, NewPrometheusExecutor)
+}
+
+type PrometheusExecutor struct {
+	QueryParser    *PrometheusQueryParser
+	ResponseParser *ResponseParser
+}
+
+func NewPrometheusExecutor(datasource *tsdb.DataSource) (tsdb.TsdbQueryEndpoint, error) {
+	return &PrometheusExecutor{
+		QueryParser:    &PrometheusQueryParser{},
+		ResponseParser: &ResponseParser{},
+	}, nil
+}
+
+func (e *PrometheusExecutor) Query(ctx context.Context, dsInfo *tsdb.DataSource, tsdbQuery *tsdb.TsdbQuery) (*tsdb.Response, error) {
+	if len(tsdbQuery.Queries) == 0 {
+		return nil, errors.Error("query request contains no queries")
+	}
+	httpClient, err := dsInfo.GetHttpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &tsdb.Response{
+		Results: make(map[string]*tsdb.QueryResult),
+	}
+	for _, q := range tsdbQuery.Queries {
+		query, err := e.QueryParser.Parse(q, dsInfo)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse query %s", q.RefId)
+		}
+		exprs, err := query.Build(tsdbQuery)
+		if err != nil {
+			return nil, errors.Wrapf(err, "build query %s", q.RefId)
+		}
+		responses := make([]*Response, 0, len(exprs))
+		rawQuery := make([]string, 0, len(exprs))
+		for _, expr := range exprs {
+			resp, err := e.queryRange(ctx, httpClient, dsInfo, expr)
+			if err != nil {
+				return nil, err
+			}
+			responses = append(responses, resp)
+			rawQuery = append(rawQuery, expr.Expr)
+		}
+		ret := e.ResponseParser.Parse(responses, query)
+		ret.RefId = q.RefId
+		ret.Meta = tsdb.QueryResultMeta{
+			RawQuery: strings.Join(rawQuery, "; "),
+		}
+		result.Results[q.RefId] = ret
+	}
+	return result, nil
+}
+
+func (e *PrometheusExecutor) queryRange(ctx context.Context, httpClient *http.Client, dsInfo *tsdb.DataSource, expr *QueryExpr) (*Response, error) {
+	req, err := e.createRequest(dsInfo, expr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ctxhttp.Do(ctx, httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response := new(Response)
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, errors.Wrapf(ErrPrometheusInvalidResponse, "status code: %v, decode body: %v", resp.Status, err)
+	}
+	if resp.StatusCode/100 != 2 || response.Status != "success" {
+		return nil, errors.Wrapf(ErrPrometheusInvalidResponse, "status code: %v, %s: %s", resp.Status, response.ErrorType, response.Error)
+	}
+	if response.Data.ResultType != "matrix" {
+		return nil, errors.Wrapf(ErrPrometheusInvalidResponse, "unexpected result type %s", response.Data.ResultType)
+	}
+	return response, nil
+}
+
+func (e *PrometheusExecutor) createRequest(dsInfo *tsdb.DataSource, expr *QueryExpr) (*http.Request, error) {
+	u, err := url.Parse(dsInfo.Url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse datasource url %s", dsInfo.Url)
+	}
+	u.Path = path.Join(u.Path, "api/v1/query_range")
+
+	bodyValues := url.Values{}
+	bodyValues.Add("query", expr.Expr)
+	bodyValues.Add("start", strconv.FormatInt(expr.Start.Unix(), 10))
+	bodyValues.Add("end", strconv.FormatInt(expr.End.Unix(), 10))
+	bodyValues.Add("step", formatPromDuration(expr.Step))
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(bodyValues.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "OneCloud Monitor")
+	req.Header.Set("Content-type", "application/x-www-form-urlencoded")
+	if dsInfo.User != "" {
+		req.SetBasicAuth(dsInfo.User, dsInfo.Password)
+	}
+
+	curlCmd, _ := http2curl.GetCurlCommand(req)
+	log.Debugf("Prometheus range query: %q, curl: %s", expr.Expr, curlCmd)
+	return req, nil
+}
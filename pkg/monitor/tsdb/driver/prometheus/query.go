@@ -0,0 +1,340 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+)
+
+const (
+	ErrUnsupportedQuery = errors.Error("Unsupported prometheus query")
+)
+
+var (
+	regexpOperatorPattern = regexp.MustCompile(`^\/.*\/$`)
+	invalidMetricChars    = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+	intervalVariables     = []string{"$interval", "$__interval", "auto"}
+)
+
+// overTimeFuncs maps influxdb selectors and aggregations to promql range
+// vector functions, which reduce points of every series inside one step
+var overTimeFuncs = map[string]string{
+	"mean":   "avg_over_time",
+	"max":    "max_over_time",
+	"min":    "min_over_time",
+	"sum":    "sum_over_time",
+	"count":  "count_over_time",
+	"last":   "last_over_time",
+	"stddev": "stddev_over_time",
+}
+
+// crossSeriesAggs maps influxdb aggregations to promql aggregation operators,
+// which merge series sharing the same group by tags
+var crossSeriesAggs = map[string]string{
+	"mean":  "avg",
+	"max":   "max",
+	"min":   "min",
+	"sum":   "sum",
+	"count": "sum",
+}
+
+// MetricName converts influxdb measurement and field to prometheus metric
+// name the same way telegraf prometheus output does
+func MetricName(measurement, field string) string {
+	return invalidMetricChars.ReplaceAllString(fmt.Sprintf("%s_%s", measurement, field), "_")
+}
+
+func (query *Query) Build(queryCtx *tsdb.TsdbQuery) ([]*QueryExpr, error) {
+	from := queryCtx.TimeRange.MustGetFrom()
+	to := queryCtx.TimeRange.MustGetTo()
+
+	matchers, err := query.renderLabelMatchers()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*QueryExpr, 0, len(query.Selects))
+	for _, sel := range query.Selects {
+		raw := isRawSelect(sel)
+		step, err := query.getStep(queryCtx, raw)
+		if err != nil {
+			return nil, err
+		}
+		start := from
+		if query.GroupByTime == "" && !raw {
+			// reduce the whole time range into one point at the end
+			start = to
+		}
+		expr, err := query.renderSelect(sel, matchers, step)
+		if err != nil {
+			return nil, errors.Wrapf(err, "render select %s", sel.Field)
+		}
+		ret = append(ret, &QueryExpr{
+			Expr:  expr,
+			Start: start,
+			End:   to,
+			Step:  step,
+		})
+	}
+	return ret, nil
+}
+
+// isRawSelect reports whether the select returns raw points, i.e. it has
+// no aggregation or selector reducing the points of a time bucket
+func isRawSelect(sel *Select) bool {
+	for _, part := range sel.Parts {
+		if _, ok := overTimeFuncs[part.Type]; ok {
+			return false
+		}
+		if utils.IsInStringArray(part.Type, []string{"median", "percentile", "spread"}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (query *Query) getStep(queryCtx *tsdb.TsdbQuery, raw bool) (time.Duration, error) {
+	var step time.Duration
+	if query.GroupByTime == "" && !raw {
+		step = queryCtx.TimeRange.MustGetTo().Sub(queryCtx.TimeRange.MustGetFrom())
+	} else if query.GroupByTime == "" || utils.IsInStringArray(query.GroupByTime, intervalVariables) {
+		// raw points are sampled at the auto interval
+		calculator := tsdb.NewIntervalCalculator(&tsdb.IntervalOptions{})
+		step = calculator.Calculate(queryCtx.TimeRange, query.Interval).Value
+	} else {
+		var err error
+		step, err = parseInfluxDuration(query.GroupByTime)
+		if err != nil {
+			return 0, errors.Wrapf(err, "parse group by time %s", query.GroupByTime)
+		}
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+	return step, nil
+}
+
+// parseInfluxDuration parses influxdb duration literal which supports d and w units
+func parseInfluxDuration(dur string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(dur, suffix) {
+			val, err := strconv.Atoi(strings.TrimSuffix(dur, suffix))
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(val) * unit, nil
+		}
+	}
+	return time.ParseDuration(dur)
+}
+
+func formatPromDuration(dur time.Duration) string {
+	return fmt.Sprintf("%ds", int64(dur/time.Second))
+}
+
+func (query *Query) renderMatcher(key, op, val string) (string, error) {
+	isRegexp := regexpOperatorPattern.MatchString(val)
+	if op == "" {
+		if isRegexp {
+			op = "=~"
+		} else {
+			op = "="
+		}
+	}
+	switch op {
+	case "=", "!=":
+	case "<>":
+		op = "!="
+	case "=~", "!~":
+		if isRegexp {
+			val = val[1 : len(val)-1]
+		}
+	default:
+		return "", errors.Wrapf(ErrUnsupportedQuery, "tag operator %s", op)
+	}
+	return fmt.Sprintf("%s%s%s", key, op, strconv.Quote(val)), nil
+}
+
+// renderLabelMatchers converts tag conditions to label matchers, promql
+// matchers are always ANDed so OR conditions are only supported when they
+// compare the same tag, which are merged into one regexp matcher.
+func (query *Query) renderLabelMatchers() ([]string, error) {
+	type orGroup struct {
+		key    string
+		values []string
+		ops    []string
+	}
+	groups := make([]*orGroup, 0)
+	for i, tag := range query.Tags {
+		if i > 0 && strings.ToUpper(tag.Condition) == "OR" {
+			grp := groups[len(groups)-1]
+			if grp.key != tag.Key {
+				return nil, errors.Wrapf(ErrUnsupportedQuery, "OR condition between tag %s and %s", grp.key, tag.Key)
+			}
+			grp.values = append(grp.values, tag.Value)
+			grp.ops = append(grp.ops, tag.Operator)
+			continue
+		}
+		groups = append(groups, &orGroup{
+			key:    tag.Key,
+			values: []string{tag.Value},
+			ops:    []string{tag.Operator},
+		})
+	}
+
+	matchers := make([]string, 0, len(groups))
+	for _, grp := range groups {
+		if len(grp.values) == 1 {
+			m, err := query.renderMatcher(grp.key, grp.ops[0], grp.values[0])
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, m)
+			continue
+		}
+		alts := make([]string, 0, len(grp.values))
+		for i, val := range grp.values {
+			isRegexp := regexpOperatorPattern.MatchString(val)
+			switch {
+			case (grp.ops[i] == "=~" || grp.ops[i] == "") && isRegexp:
+				alts = append(alts, val[1:len(val)-1])
+			case grp.ops[i] == "=" || grp.ops[i] == "":
+				alts = append(alts, regexp.QuoteMeta(val))
+			default:
+				return nil, errors.Wrapf(ErrUnsupportedQuery, "OR condition with operator %s", grp.ops[i])
+			}
+		}
+		matchers = append(matchers, fmt.Sprintf("%s=~%s", grp.key, strconv.Quote(strings.Join(alts, "|"))))
+	}
+	return matchers, nil
+}
+
+func (query *Query) renderSelect(sel *Select, matchers []string, step time.Duration) (string, error) {
+	expr := fmt.Sprintf("%s{%s}", MetricName(query.Measurement, sel.Field), strings.Join(matchers, ","))
+	window := fmt.Sprintf("[%s]", formatPromDuration(step))
+
+	var (
+		aggregator string
+		topk       string
+		// whether expr is still a plain vector selector, range functions
+		// applied to any other expression need a subquery
+		isSelector = true
+	)
+	rangeOf := func(expr string) string {
+		if isSelector {
+			return expr + window
+		}
+		return fmt.Sprintf("%s[%s:%s]", expr, formatPromDuration(step), formatPromDuration(step))
+	}
+	for _, part := range sel.Parts {
+		switch part.Type {
+		case "mean", "max", "min", "sum", "count", "last", "stddev":
+			if aggregator != "" {
+				return "", errors.Wrapf(ErrUnsupportedQuery, "nested aggregation %s(%s)", part.Type, aggregator)
+			}
+			aggregator = part.Type
+			expr = fmt.Sprintf("%s(%s)", overTimeFuncs[part.Type], rangeOf(expr))
+		case "median", "percentile":
+			if aggregator != "" {
+				return "", errors.Wrapf(ErrUnsupportedQuery, "nested aggregation %s(%s)", part.Type, aggregator)
+			}
+			aggregator = part.Type
+			quantile := 0.5
+			if part.Type == "percentile" {
+				if len(part.Params) == 0 {
+					return "", errors.Wrap(ErrUnsupportedQuery, "percentile without nth")
+				}
+				nth, err := strconv.ParseFloat(part.Params[0], 64)
+				if err != nil {
+					return "", errors.Wrapf(err, "parse percentile %s", part.Params[0])
+				}
+				quantile = nth / 100
+			}
+			expr = fmt.Sprintf("quantile_over_time(%s, %s)", strconv.FormatFloat(quantile, 'f', -1, 64), rangeOf(expr))
+		case "spread":
+			aggregator = part.Type
+			expr = fmt.Sprintf("(max_over_time(%s) - min_over_time(%s))", rangeOf(expr), rangeOf(expr))
+		case "derivative", "non_negative_derivative":
+			unit := time.Second
+			if len(part.Params) > 0 {
+				var err error
+				unit, err = parseInfluxDuration(part.Params[0])
+				if err != nil {
+					return "", errors.Wrapf(err, "parse %s unit %s", part.Type, part.Params[0])
+				}
+			}
+			fn := "deriv"
+			if part.Type == "non_negative_derivative" {
+				fn = "rate"
+			}
+			expr = fmt.Sprintf("%s(%s)", fn, rangeOf(expr))
+			if unit != time.Second {
+				expr = fmt.Sprintf("%s * %d", expr, int64(unit/time.Second))
+			}
+		case "difference":
+			expr = fmt.Sprintf("delta(%s)", rangeOf(expr))
+		case "non_negative_difference":
+			expr = fmt.Sprintf("increase(%s)", rangeOf(expr))
+		case "abs":
+			expr = fmt.Sprintf("abs(%s)", expr)
+		case "math":
+			if len(part.Params) == 0 {
+				continue
+			}
+			op := part.Params[0]
+			op = strings.Replace(op, "$__interval_ms", strconv.FormatInt(int64(step/time.Millisecond), 10), -1)
+			expr = fmt.Sprintf("(%s) %s", expr, op)
+		case "top", "bottom":
+			if len(part.Params) == 0 {
+				return "", errors.Wrapf(ErrUnsupportedQuery, "%s without count", part.Type)
+			}
+			fn := "topk"
+			if part.Type == "bottom" {
+				fn = "bottomk"
+			}
+			topk = fmt.Sprintf("%s(%s, %%s)", fn, part.Params[0])
+		default:
+			return "", errors.Wrapf(ErrUnsupportedQuery, "function %s", part.Type)
+		}
+		if part.Type != "top" && part.Type != "bottom" {
+			isSelector = false
+		}
+	}
+
+	if !utils.IsInStringArray("*", query.GroupByTags) {
+		agg, ok := crossSeriesAggs[aggregator]
+		if !ok {
+			agg = "avg"
+		}
+		by := ""
+		if len(query.GroupByTags) > 0 {
+			by = fmt.Sprintf(" by (%s)", strings.Join(query.GroupByTags, ", "))
+		}
+		expr = fmt.Sprintf("%s%s (%s)", agg, by, expr)
+	}
+	if topk != "" {
+		expr = fmt.Sprintf(topk, expr)
+	}
+	return expr, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"time"
+
+	"yunion.io/x/pkg/errors"
+
+	api "yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+)
+
+type PrometheusQueryParser struct{}
+
+func (qp *PrometheusQueryParser) Parse(model *tsdb.Query, dsInfo *tsdb.DataSource) (*Query, error) {
+	if model.Measurement == "" {
+		return nil, errors.Wrap(ErrUnsupportedQuery, "empty measurement")
+	}
+	selects, err := qp.parseSelects(model.Selects)
+	if err != nil {
+		return nil, err
+	}
+	query := &Query{
+		Measurement: model.Measurement,
+		Alias:       model.Alias,
+		Tags:        model.Tags,
+		Selects:     selects,
+	}
+	for _, gb := range model.GroupBy {
+		switch gb.Type {
+		case "time":
+			if len(gb.Params) > 0 {
+				query.GroupByTime = gb.Params[0]
+			}
+		case "tag":
+			if len(gb.Params) > 0 {
+				query.GroupByTags = append(query.GroupByTags, gb.Params[0])
+			}
+		case "fill":
+			// promql never fills missing points, omit
+		default:
+			return nil, errors.Wrapf(ErrUnsupportedQuery, "group by %s", gb.Type)
+		}
+	}
+	parsedInterval, err := tsdb.GetIntervalFrom(dsInfo, model, time.Millisecond*1)
+	if err != nil {
+		return nil, err
+	}
+	query.Interval = parsedInterval
+	return query, nil
+}
+
+func (qp *PrometheusQueryParser) parseSelects(selects []api.MetricQuerySelect) ([]*Select, error) {
+	result := make([]*Select, 0, len(selects))
+	for _, selectObj := range selects {
+		sel := &Select{}
+		for _, part := range selectObj {
+			switch part.Type {
+			case "field":
+				if len(part.Params) == 0 {
+					return nil, errors.Wrap(ErrUnsupportedQuery, "field without name")
+				}
+				sel.Field = part.Params[0]
+			case "alias":
+				if len(part.Params) > 0 {
+					sel.Alias = part.Params[0]
+				}
+			default:
+				sel.Parts = append(sel.Parts, part)
+			}
+		}
+		if sel.Field == "" || sel.Field == "*" {
+			return nil, errors.Wrapf(ErrUnsupportedQuery, "select field %q", sel.Field)
+		}
+		result = append(result, sel)
+	}
+	if len(result) == 0 {
+		return nil, errors.Wrap(ErrUnsupportedQuery, "no select field")
+	}
+	return result, nil
+}
@@ -0,0 +1,196 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	api "yunion.io/x/onecloud/pkg/apis/monitor"
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+)
+
+func TestPrometheusQueryBuilder(t *testing.T) {
+	Convey("Prometheus query builder", t, func() {
+		parser := &PrometheusQueryParser{}
+		queryContext := &tsdb.TsdbQuery{
+			TimeRange: tsdb.NewTimeRange("1h", "now"),
+		}
+
+		Convey("can build query grouped by time and tag", func() {
+			model := &tsdb.Query{
+				MetricQuery: api.MetricQuery{
+					Measurement: "cpu",
+					Selects: []api.MetricQuerySelect{
+						{
+							{Type: "field", Params: []string{"usage_active"}},
+							{Type: "mean"},
+							{Type: "math", Params: []string{"/ 100"}},
+						},
+					},
+					Tags: []api.MetricQueryTag{
+						{Key: "host", Value: "server1", Operator: "="},
+						{Key: "host", Value: "server2", Operator: "=", Condition: "OR"},
+						{Key: "res_type", Value: "/guest|host/", Operator: "=~"},
+					},
+					GroupBy: []api.MetricQueryPart{
+						{Type: "time", Params: []string{"5m"}},
+						{Type: "tag", Params: []string{"host"}},
+						{Type: "fill", Params: []string{"null"}},
+					},
+				},
+			}
+			query, err := parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			exprs, err := query.Build(queryContext)
+			So(err, ShouldBeNil)
+			So(len(exprs), ShouldEqual, 1)
+			So(exprs[0].Expr, ShouldEqual, `avg by (host) ((avg_over_time(cpu_usage_active{host=~"server1|server2",res_type=~"guest|host"}[300s])) / 100)`)
+			So(exprs[0].Step, ShouldEqual, 5*time.Minute)
+			So(exprs[0].End.Sub(exprs[0].Start), ShouldEqual, time.Hour)
+		})
+
+		Convey("can build query reduced over whole range", func() {
+			model := &tsdb.Query{
+				MetricQuery: api.MetricQuery{
+					Measurement: "disk",
+					Selects: []api.MetricQuerySelect{
+						{{Type: "field", Params: []string{"used_percent"}}, {Type: "max"}},
+						{{Type: "field", Params: []string{"free"}}, {Type: "last"}},
+					},
+					Tags: []api.MetricQueryTag{
+						{Key: "path", Value: "/", Operator: "!="},
+					},
+					GroupBy: []api.MetricQueryPart{
+						{Type: "tag", Params: []string{"*"}},
+					},
+				},
+			}
+			query, err := parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			exprs, err := query.Build(queryContext)
+			So(err, ShouldBeNil)
+			So(len(exprs), ShouldEqual, 2)
+			So(exprs[0].Expr, ShouldEqual, `max_over_time(disk_used_percent{path!="/"}[3600s])`)
+			So(exprs[1].Expr, ShouldEqual, `last_over_time(disk_free{path!="/"}[3600s])`)
+			So(exprs[0].Start, ShouldEqual, exprs[0].End)
+		})
+
+		Convey("can build derivative and top query", func() {
+			model := &tsdb.Query{
+				MetricQuery: api.MetricQuery{
+					Measurement: "net",
+					Selects: []api.MetricQuerySelect{
+						{
+							{Type: "field", Params: []string{"bytes_recv"}},
+							{Type: "non_negative_derivative", Params: []string{"1s"}},
+							{Type: "top", Params: []string{"5"}},
+						},
+					},
+					GroupBy: []api.MetricQueryPart{
+						{Type: "time", Params: []string{"1m"}},
+						{Type: "tag", Params: []string{"host"}},
+					},
+				},
+			}
+			query, err := parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			exprs, err := query.Build(queryContext)
+			So(err, ShouldBeNil)
+			So(exprs[0].Expr, ShouldEqual, `topk(5, avg by (host) (rate(net_bytes_recv{}[60s])))`)
+		})
+
+		Convey("can build derivative after aggregation with subquery", func() {
+			model := &tsdb.Query{
+				MetricQuery: api.MetricQuery{
+					Measurement: "net",
+					Selects: []api.MetricQuerySelect{
+						{
+							{Type: "field", Params: []string{"bytes_recv"}},
+							{Type: "max"},
+							{Type: "non_negative_derivative", Params: []string{"1m"}},
+						},
+						{
+							{Type: "field", Params: []string{"bytes_sent"}},
+							{Type: "mean"},
+							{Type: "difference"},
+						},
+					},
+					GroupBy: []api.MetricQueryPart{
+						{Type: "time", Params: []string{"1m"}},
+						{Type: "tag", Params: []string{"*"}},
+					},
+				},
+			}
+			query, err := parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			exprs, err := query.Build(queryContext)
+			So(err, ShouldBeNil)
+			So(exprs[0].Expr, ShouldEqual, `rate(max_over_time(net_bytes_recv{}[60s])[60s:60s]) * 60`)
+			So(exprs[1].Expr, ShouldEqual, `delta(avg_over_time(net_bytes_sent{}[60s])[60s:60s])`)
+		})
+
+		Convey("can build raw query without group by time as range", func() {
+			model := &tsdb.Query{
+				MetricQuery: api.MetricQuery{
+					Measurement: "cpu",
+					Selects: []api.MetricQuerySelect{
+						{{Type: "field", Params: []string{"usage_active"}}},
+						{{Type: "field", Params: []string{"usage_system"}}, {Type: "mean"}},
+					},
+					GroupBy: []api.MetricQueryPart{
+						{Type: "tag", Params: []string{"*"}},
+					},
+				},
+			}
+			query, err := parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			exprs, err := query.Build(queryContext)
+			So(err, ShouldBeNil)
+			So(exprs[0].Expr, ShouldEqual, `cpu_usage_active{}`)
+			So(exprs[0].End.Sub(exprs[0].Start), ShouldEqual, time.Hour)
+			So(exprs[0].Step, ShouldBeLessThan, time.Hour)
+			So(exprs[1].Start, ShouldEqual, exprs[1].End)
+			So(exprs[1].Step, ShouldEqual, time.Hour)
+		})
+
+		Convey("reject unsupported conditions", func() {
+			model := &tsdb.Query{
+				MetricQuery: api.MetricQuery{
+					Measurement: "cpu",
+					Selects: []api.MetricQuerySelect{
+						{{Type: "field", Params: []string{"usage_active"}}, {Type: "mean"}},
+					},
+					Tags: []api.MetricQueryTag{
+						{Key: "host", Value: "server1", Operator: "="},
+						{Key: "cpu", Value: "cpu0", Operator: "=", Condition: "OR"},
+					},
+				},
+			}
+			query, err := parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			_, err = query.Build(queryContext)
+			So(err, ShouldNotBeNil)
+
+			model.Tags = []api.MetricQueryTag{{Key: "usage", Value: "10", Operator: ">"}}
+			query, err = parser.Parse(model, nil)
+			So(err, ShouldBeNil)
+			_, err = query.Build(queryContext)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,187 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/monitor/tsdb"
+)
+
+type ResponseParser struct{}
+
+var (
+	legendFormat = regexp.MustCompile(`\[\[(\w+)(\.\w+)*\]\]*|\$\s*(\w+?)*`)
+)
+
+type mergedSeries struct {
+	tags   map[string]string
+	points map[float64][]*float64
+}
+
+// Parse merges responses of every select of the query into series with one
+// column per select, the same layout influxdb driver returns.
+func (rp *ResponseParser) Parse(responses []*Response, query *Query) *tsdb.QueryResult {
+	queryRes := tsdb.NewQueryResult()
+
+	columns := make([]string, 0, len(query.Selects)+1)
+	for _, sel := range query.Selects {
+		col := sel.Field
+		if sel.Alias != "" {
+			col = sel.Alias
+		}
+		columns = append(columns, col)
+	}
+	columns = append(columns, "time")
+
+	keys := make([]string, 0)
+	merged := make(map[string]*mergedSeries)
+	for idx, resp := range responses {
+		for _, series := range resp.Data.Result {
+			tags := make(map[string]string)
+			for k, v := range series.Metric {
+				if k == "__name__" {
+					continue
+				}
+				tags[k] = v
+			}
+			key := seriesKey(tags)
+			ms, ok := merged[key]
+			if !ok {
+				ms = &mergedSeries{
+					tags:   tags,
+					points: make(map[float64][]*float64),
+				}
+				merged[key] = ms
+				keys = append(keys, key)
+			}
+			for _, pair := range series.Values {
+				ts, val, err := rp.parseSamplePair(pair)
+				if err != nil {
+					log.Errorf("parse prometheus sample %v: %v", pair, err)
+					continue
+				}
+				vals, ok := ms.points[ts]
+				if !ok {
+					vals = make([]*float64, len(responses))
+					ms.points[ts] = vals
+				}
+				vals[idx] = val
+			}
+		}
+	}
+
+	colName := strings.Join(columns[:len(columns)-1], "-")
+	for _, key := range keys {
+		ms := merged[key]
+		timestamps := make([]float64, 0, len(ms.points))
+		for ts := range ms.points {
+			timestamps = append(timestamps, ts)
+		}
+		sort.Float64s(timestamps)
+		points := make(tsdb.TimeSeriesPoints, 0, len(timestamps))
+		for _, ts := range timestamps {
+			point := make(tsdb.TimePoint, 0, len(columns))
+			for _, val := range ms.points[ts] {
+				// keep the typed nil, TimePoint accessors assert *float64
+				point = append(point, val)
+			}
+			point = append(point, ts)
+			points = append(points, point)
+		}
+		queryRes.Series = append(queryRes.Series, &tsdb.TimeSeries{
+			Name:    rp.formatSerieName(ms.tags, colName, query),
+			Columns: columns,
+			Points:  points,
+			Tags:    ms.tags,
+		})
+	}
+	return queryRes
+}
+
+func seriesKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, tags[k]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// parseSamplePair parses [<unix_time>, "<sample_value>"] to millisecond timestamp and value
+func (rp *ResponseParser) parseSamplePair(pair []interface{}) (float64, *float64, error) {
+	if len(pair) != 2 {
+		return 0, nil, errors.Errorf("invalid sample pair length %d", len(pair))
+	}
+	ts, ok := pair[0].(float64)
+	if !ok {
+		return 0, nil, errors.Errorf("invalid timestamp %v", pair[0])
+	}
+	str, ok := pair[1].(string)
+	if !ok {
+		return 0, nil, errors.Errorf("invalid sample value %v", pair[1])
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "parse sample value %s", str)
+	}
+	ms := math.Round(ts * 1000)
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return ms, nil, nil
+	}
+	return ms, &val, nil
+}
+
+func (rp *ResponseParser) formatSerieName(tags map[string]string, column string, query *Query) string {
+	if query.Alias == "" {
+		return fmt.Sprintf("%s.%s", query.Measurement, column)
+	}
+
+	result := legendFormat.ReplaceAllFunc([]byte(query.Alias), func(in []byte) []byte {
+		aliasFormat := string(in)
+		aliasFormat = strings.Replace(aliasFormat, "[[", "", 1)
+		aliasFormat = strings.Replace(aliasFormat, "]]", "", 1)
+		aliasFormat = strings.Replace(aliasFormat, "$", "", 1)
+
+		if aliasFormat == "m" || aliasFormat == "measurement" {
+			return []byte(query.Measurement)
+		}
+		if aliasFormat == "col" {
+			return []byte(column)
+		}
+		if !strings.HasPrefix(aliasFormat, "tag_") {
+			return in
+		}
+		tagKey := strings.Replace(aliasFormat, "tag_", "", 1)
+		if tagValue, exist := tags[tagKey]; exist {
+			return []byte(tagValue)
+		}
+		return in
+	})
+
+	return string(result)
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prometheus
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrometheusResponseParser(t *testing.T) {
+	Convey("Prometheus response parser", t, func() {
+		parser := &ResponseParser{}
+		query := &Query{
+			Measurement: "cpu",
+			Selects:     []*Select{{Field: "usage_active"}, {Field: "usage_system", Alias: "sys"}},
+		}
+
+		parseResp := func(body string) *Response {
+			resp := new(Response)
+			So(json.Unmarshal([]byte(body), resp), ShouldBeNil)
+			return resp
+		}
+		resp1 := parseResp(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"__name__":"cpu_usage_active","host":"h1"},"values":[[1600000000,"1.5"],[1600000060,"2"]]},
+			{"metric":{"host":"h2"},"values":[[1600000000,"NaN"]]}]}}`)
+		resp2 := parseResp(`{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"host":"h1"},"values":[[1600000060,"0.5"]]}]}}`)
+
+		result := parser.Parse([]*Response{resp1, resp2}, query)
+		So(len(result.Series), ShouldEqual, 2)
+
+		h1 := result.Series[0]
+		So(h1.Name, ShouldEqual, "cpu.usage_active-sys")
+		So(h1.Columns, ShouldResemble, []string{"usage_active", "sys", "time"})
+		So(h1.Tags, ShouldResemble, map[string]string{"host": "h1"})
+		So(len(h1.Points), ShouldEqual, 2)
+		So(h1.Points[0].Value(), ShouldEqual, 1.5)
+		So(h1.Points[0][1], ShouldBeNil)
+		So(h1.Points[0][1], ShouldHaveSameTypeAs, (*float64)(nil))
+		So(h1.Points[0].Timestamp(), ShouldEqual, float64(1600000000000))
+		So(h1.Points[1].IsValids(), ShouldBeTrue)
+		So(h1.Points[1].Values(), ShouldResemble, []float64{2, 0.5})
+
+		h2 := result.Series[1]
+		So(h2.Points[0].IsValid(), ShouldBeFalse)
+
+		Convey("alias of query", func() {
+			query.Alias = "$tag_host $col"
+			result := parser.Parse([]*Response{resp1, resp2}, query)
+			So(result.Series[0].Name, ShouldEqual, "h1 usage_active-sys")
+		})
+	})
+}
@@ -14,6 +14,12 @@
 
 package multicloud
 
+import (
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
 type SElasticcacheBase struct {
 	SVirtualResourceBase
 	SBillingBase
@@ -27,6 +33,14 @@ func (self *SElasticcacheBase) GetConnections() int {
 	return 0
 }
 
+func (self *SElasticcacheBase) Start() error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "Start")
+}
+
+func (self *SElasticcacheBase) Stop() error {
+	return errors.Wrapf(cloudprovider.ErrNotImplemented, "Stop")
+}
+
 type SElasticcacheBackupBase struct {
 	SResourceBase
 }
@@ -84,6 +84,14 @@ func (bucket *SBucket) SetAcl(aclStr cloudprovider.TBucketACLType) error {
 	return bucket.client.SetIBucketAcl(bucket.Name, aclStr)
 }
 
+func (bucket *SBucket) SetLifecycle(conf string) error {
+	err := bucket.client.S3Client().SetBucketLifecycle(bucket.Name, conf)
+	if err != nil {
+		return errors.Wrap(err, "SetBucketLifecycle")
+	}
+	return nil
+}
+
 func (bucket *SBucket) GetLocation() string {
 	return bucket.Location
 }
@@ -0,0 +1,179 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
+)
+
+func getBucketCors(ctx context.Context, userCred mcclient.TokenCredential, bucketName string) (*models.SCORSConfiguration, error) {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return nil, errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	rules, err := bucket.GetCORSRules(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetCORSRules")
+	}
+	if len(rules) == 0 {
+		return nil, NoSuchCORSConfiguration(ctx, "The CORS configuration does not exist")
+	}
+	return models.NewCORSConfiguration(rules), nil
+}
+
+func putBucketCors(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, r *http.Request) error {
+	conf := models.SCORSConfiguration{}
+	err := appsrv.FetchXml(r, &conf)
+	if err != nil {
+		return MalformedXML(ctx, err.Error())
+	}
+	err = conf.Validate()
+	if err != nil {
+		return errors.Wrap(err, "Validate")
+	}
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	return bucket.SetCORS(ctx, userCred, &conf)
+}
+
+func deleteBucketCors(ctx context.Context, userCred mcclient.TokenCredential, bucketName string) error {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	return bucket.DeleteCORS(ctx, userCred)
+}
+
+// loadBucketCORSRules returns the CORS rules of bucket, which are cached by
+// bucket id in models. Error is taken as no rule
+func loadBucketCORSRules(ctx context.Context, userCred mcclient.TokenCredential, bucket *models.SBucketDelegate) []cloudprovider.SBucketCORSRule {
+	rules, err := bucket.GetCORSRules(ctx, userCred)
+	if err != nil {
+		log.Debugf("get cors rules of bucket %s fail %s", bucket.Name, err)
+		return []cloudprovider.SBucketCORSRule{}
+	}
+	return rules
+}
+
+func setCORSAllowOrigin(hdr http.Header, rule *cloudprovider.SBucketCORSRule, origin string) {
+	if len(rule.AllowedOrigins) == 1 && rule.AllowedOrigins[0] == "*" {
+		hdr.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		hdr.Set("Access-Control-Allow-Origin", origin)
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+	hdr.Add("Vary", "Origin")
+}
+
+func parseCORSRequestHeaders(val string) []string {
+	ret := make([]string, 0)
+	for _, h := range strings.Split(val, ",") {
+		h = strings.TrimSpace(h)
+		if len(h) > 0 {
+			ret = append(ret, h)
+		}
+	}
+	return ret
+}
+
+// optionsHandler answers CORS preflight requests, which carry no credential,
+// so the bucket and its rules are resolved with the service credential
+func optionsHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	o, err := getObjectRequest(r)
+	if err != nil {
+		SendError(ctx, w, BadRequest(ctx, err.Error()))
+		return
+	}
+	ctx = context.WithValue(ctx, S3_OBJECT_REQUEST, o)
+	if len(o.Bucket) == 0 {
+		SendError(ctx, w, NotSupported(ctx, "method not supported"))
+		return
+	}
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	if len(origin) == 0 || len(method) == 0 {
+		SendError(ctx, w, BadRequest(ctx, "Insufficient information. Origin request header needed."))
+		return
+	}
+	reqHeaders := parseCORSRequestHeaders(r.Header.Get("Access-Control-Request-Headers"))
+	var rule *cloudprovider.SBucketCORSRule
+	bucket, err := models.BucketManager.GetByNameAsService(ctx, o.Bucket)
+	if err != nil {
+		log.Debugf("preflight get bucket %s fail %s", o.Bucket, err)
+	} else {
+		rules := loadBucketCORSRules(ctx, auth.AdminCredential(), bucket)
+		rule = models.MatchCORSRule(rules, origin, method, reqHeaders)
+	}
+	if rule == nil {
+		SendError(ctx, w, Forbidden(ctx, "CORSResponse: This CORS request is not allowed."))
+		return
+	}
+	hdr := http.Header{}
+	setCORSAllowOrigin(hdr, rule, origin)
+	hdr.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if len(reqHeaders) > 0 {
+		hdr.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if len(rule.ExposeHeaders) > 0 {
+		hdr.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+	}
+	if rule.MaxAgeSeconds > 0 {
+		hdr.Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAgeSeconds))
+	}
+	appsrv.SendHeader(w, hdr)
+}
+
+// setCORSHeaders adds CORS headers to the response of a cross-origin request
+// allowed by the rules of bucket
+func setCORSHeaders(ctx context.Context, w http.ResponseWriter, r *http.Request, bucketName string) {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 || len(bucketName) == 0 {
+		return
+	}
+	userCred := auth.FetchUserCredential(ctx, nil)
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		log.Debugf("get bucket %s fail %s", bucketName, err)
+		return
+	}
+	rules := loadBucketCORSRules(ctx, userCred, bucket)
+	rule := models.MatchCORSRule(rules, origin, r.Method, nil)
+	if rule == nil {
+		return
+	}
+	hdr := w.Header()
+	setCORSAllowOrigin(hdr, rule, origin)
+	hdr.Set("Access-Control-Allow-Methods", strings.Join(rule.AllowedMethods, ", "))
+	if len(rule.ExposeHeaders) > 0 {
+		hdr.Set("Access-Control-Expose-Headers", strings.Join(rule.ExposeHeaders, ", "))
+	}
+	if rule.MaxAgeSeconds > 0 {
+		hdr.Set("Access-Control-Max-Age", strconv.Itoa(rule.MaxAgeSeconds))
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"yunion.io/x/onecloud/pkg/appctx"
 	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/util/s3auth"
 )
 
 func generalError(ctx context.Context, statusCode int, errCode string, msg string) s3cli.ErrorResponse {
@@ -89,6 +90,30 @@ func OutOfRangeError(ctx context.Context, msg string) s3cli.ErrorResponse {
 	return generalError(ctx, 416, "Range Not Satisfiable", msg)
 }
 
+func SignatureDoesNotMatch(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 403, "SignatureDoesNotMatch", msg)
+}
+
+func IncompleteBody(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 400, "IncompleteBody", msg)
+}
+
+func MalformedXML(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 400, "MalformedXML", msg)
+}
+
+func NoSuchTagSet(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 404, "NoSuchTagSet", msg)
+}
+
+func NoSuchCORSConfiguration(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 404, "NoSuchCORSConfiguration", msg)
+}
+
+func NoSuchLifecycleConfiguration(ctx context.Context, msg string) s3cli.ErrorResponse {
+	return generalError(ctx, 404, "NoSuchLifecycleConfiguration", msg)
+}
+
 func SendGeneralError(ctx context.Context, w http.ResponseWriter, err error) {
 	switch e := err.(type) {
 	case s3cli.ErrorResponse:
@@ -119,8 +144,12 @@ func SendGeneralError(ctx context.Context, w http.ResponseWriter, err error) {
 			eresp = BadRequest(ctx, err.Error())
 		case httperrors.ErrOutOfRange:
 			eresp = OutOfRangeError(ctx, err.Error())
-		case httperrors.ErrForbidden:
+		case httperrors.ErrForbidden, s3auth.ErrRequestExpired:
 			eresp = Forbidden(ctx, err.Error())
+		case s3auth.ErrSignatureMismatch, s3auth.ErrChunkSignatureMismatch:
+			eresp = SignatureDoesNotMatch(ctx, err.Error())
+		case s3auth.ErrMalformedChunk:
+			eresp = IncompleteBody(ctx, err.Error())
 		default:
 			eresp = ServerError(ctx, err.Error())
 		}
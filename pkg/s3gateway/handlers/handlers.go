@@ -39,6 +39,9 @@ import (
 )
 
 func InitHandlers(app *appsrv.Application) {
+	// cross-origin requests are allowed by CORS rules of each bucket
+	app.DisableCORS()
+
 	h := app.AddHandler2("HEAD", "", s3authenticate(headHandler), nil, "head", nil)
 	h.SetProcessTimeoutCallback(s3HandlerTimeoutInfo)
 	h = app.AddHandler2("GET", "", s3authenticate(readHandler), nil, "get", nil)
@@ -49,6 +52,7 @@ func InitHandlers(app *appsrv.Application) {
 	h.SetProcessTimeoutCallback(s3HandlerTimeoutInfo)
 	h = app.AddHandler2("DELETE", "", s3authenticate(deleteHandler), nil, "delete", nil)
 	h.SetProcessTimeoutCallback(s3HandlerTimeoutInfo)
+	app.AddHandler2("OPTIONS", "", optionsHandler, nil, "options", nil)
 }
 
 func s3HandlerTimeoutInfo(info *appsrv.SHandlerInfo, r *http.Request) time.Duration {
@@ -58,6 +62,8 @@ func s3HandlerTimeoutInfo(info *appsrv.SHandlerInfo, r *http.Request) time.Durat
 			return 2 * time.Hour
 		} else if r.Method == http.MethodPut && (len(r.URL.RawQuery) == 0 || strings.Contains(r.URL.RawQuery, "partNumber=")) {
 			return 2 * time.Hour
+		} else if r.Method == http.MethodPost && strings.Contains(r.URL.RawQuery, "select") {
+			return 2 * time.Hour
 		}
 	}
 	return time.Duration(0)
@@ -160,13 +166,15 @@ func readBucket(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	} else if query.Contains("analytics") {
 
 	} else if query.Contains("cors") {
-
+		resp, err := getBucketCors(ctx, userCred, bucketName)
+		return resp, nil, err
 	} else if query.Contains("encryption") {
 
 	} else if query.Contains("inventory") {
 
 	} else if query.Contains("lifecycle") {
-
+		resp, err := getBucketLifecycle(ctx, userCred, bucketName)
+		return resp, nil, err
 	} else if query.Contains("location") {
 		result := s3cli.LocationConstraint(bucket.Location)
 		return &result, nil, nil
@@ -191,7 +199,8 @@ func readBucket(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	} else if query.Contains("requestPayment") {
 
 	} else if query.Contains("tagging") {
-
+		resp, err := getBucketTagging(ctx, userCred, bucketName)
+		return resp, nil, err
 	} else if query.Contains("versioning") {
 		return &s3cli.VersioningConfiguration{}, nil, nil
 	} else if query.Contains("website") {
@@ -232,7 +241,8 @@ func readObject(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	} else if query.Contains("retention") {
 
 	} else if query.Contains("tagging") {
-
+		resp, err := getObjectTagging(ctx, userCred, bucketName, objKey)
+		return resp, nil, err
 	} else if query.Contains("torrent") {
 
 	} else {
@@ -270,7 +280,7 @@ func downloadObject(ctx context.Context, userCred mcclient.TokenCredential, buck
 	if err != nil {
 		return errors.Wrap(err, "cloudprovider.GetIObject")
 	}
-	hdr := cloudprovider.MetaToHttpHeader(cloudprovider.META_HEADER_PREFIX, obj.GetMeta())
+	hdr := objectMetaHeader(obj.GetMeta())
 	eTag := obj.GetETag()
 	if len(eTag) > 0 {
 		hdr.Set("ETag", eTag)
@@ -372,9 +382,6 @@ func postObject(ctx context.Context, userCred mcclient.TokenCredential, bucket s
 			return nil, nil, errors.Wrap(httperrors.ErrBadRequest, "FetchXml")
 		}
 		return completeMultipartUpload(ctx, userCred, r.Header, bucket, key, uploadId, &request)
-	} else if query.Contains("select") {
-		// select object
-		return selectObject(ctx, userCred, r.Header, bucket, key)
 	} else {
 		// upload object by form POST
 	}
@@ -397,6 +404,14 @@ func postHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 			SendError(ctx, w, BadRequest(ctx, err.Error()))
 			return
 		}
+		if query.Contains("select") {
+			// select object content, results are streamed
+			err := selectObject(ctx, userCred, o.Bucket, o.Key, r, w)
+			if err != nil {
+				SendGeneralError(ctx, w, err)
+			}
+			return
+		}
 		resp, respHdr, err := postObject(ctx, userCred, o.Bucket, o.Key, query, r)
 		if err != nil {
 			SendGeneralError(ctx, w, err)
@@ -416,13 +431,15 @@ func putBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket st
 	} else if query.Contains("analytics") {
 
 	} else if query.Contains("cors") {
-
+		err := putBucketCors(ctx, userCred, bucket, r)
+		return nil, nil, err
 	} else if query.Contains("encryption") {
 
 	} else if query.Contains("inventory") {
 
 	} else if query.Contains("lifecycle") {
-
+		err := putBucketLifecycle(ctx, userCred, bucket, r)
+		return nil, nil, err
 	} else if query.Contains("publicAccessBlock") {
 
 	} else if query.Contains("logging") {
@@ -440,7 +457,8 @@ func putBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket st
 	} else if query.Contains("requestPayment") {
 
 	} else if query.Contains("tagging") {
-
+		err := putBucketTagging(ctx, userCred, bucket, r)
+		return nil, nil, err
 	} else if query.Contains("versioning") {
 
 	} else if query.Contains("website") {
@@ -460,7 +478,8 @@ func putObject(ctx context.Context, userCred mcclient.TokenCredential, bucketNam
 	} else if query.Contains("acl") {
 
 	} else if query.Contains("tagging") {
-
+		err := putObjectTagging(ctx, userCred, bucketName, key, r)
+		return nil, nil, err
 	} else {
 		// upload object
 		uploadId, _ := query.GetString("uploadId")
@@ -521,13 +540,13 @@ func deleteBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket
 	if query.Contains("analytics") {
 
 	} else if query.Contains("cors") {
-
+		return nil, deleteBucketCors(ctx, userCred, bucket)
 	} else if query.Contains("encryption") {
 
 	} else if query.Contains("inventory") {
 
 	} else if query.Contains("lifecycle") {
-
+		return nil, deleteBucketLifecycle(ctx, userCred, bucket)
 	} else if query.Contains("publicAccessBlock") {
 
 	} else if query.Contains("metrics") {
@@ -537,7 +556,7 @@ func deleteBucket(ctx context.Context, userCred mcclient.TokenCredential, bucket
 	} else if query.Contains("replication") {
 
 	} else if query.Contains("tagging") {
-
+		return nil, deleteBucketTagging(ctx, userCred, bucket)
 	} else if query.Contains("website") {
 
 	} else {
@@ -0,0 +1,66 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
+)
+
+func getBucketLifecycle(ctx context.Context, userCred mcclient.TokenCredential, bucketName string) (*models.SLifecycleConfiguration, error) {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return nil, errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	conf, err := bucket.GetLifecycle(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetLifecycle")
+	}
+	if conf == nil {
+		return nil, NoSuchLifecycleConfiguration(ctx, "The lifecycle configuration does not exist")
+	}
+	return conf, nil
+}
+
+func putBucketLifecycle(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, r *http.Request) error {
+	conf := models.SLifecycleConfiguration{}
+	err := appsrv.FetchXml(r, &conf)
+	if err != nil {
+		return MalformedXML(ctx, err.Error())
+	}
+	err = conf.Validate()
+	if err != nil {
+		return errors.Wrap(err, "Validate")
+	}
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	return bucket.SetLifecycle(ctx, userCred, &conf)
+}
+
+func deleteBucketLifecycle(ctx context.Context, userCred mcclient.TokenCredential, bucketName string) error {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	return bucket.DeleteLifecycle(ctx, userCred)
+}
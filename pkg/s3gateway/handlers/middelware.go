@@ -17,13 +17,17 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
 	"yunion.io/x/pkg/gotypes"
 
 	"yunion.io/x/onecloud/pkg/appctx"
 	"yunion.io/x/onecloud/pkg/appsrv"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/util/s3auth"
 )
 
 const (
@@ -40,17 +44,62 @@ func s3authenticate(f appsrv.FilterHandler) appsrv.FilterHandler {
 			return
 		}
 		ctx = context.WithValue(ctx, S3_OBJECT_REQUEST, o)
-		userCred, err := auth.VerifyRequest(*r, o.VirtualHost)
+		cred, err := auth.VerifyAccessKeyRequest(*r, o.VirtualHost)
 		if err != nil {
-			SendError(ctx, w, Unauthenticated(ctx, err.Error()))
+			switch errors.Cause(err) {
+			case s3auth.ErrRequestExpired, s3auth.ErrSignatureMismatch:
+				SendGeneralError(ctx, w, err)
+			default:
+				SendError(ctx, w, Unauthenticated(ctx, err.Error()))
+			}
 			return
 		}
-		ctx = context.WithValue(ctx, appctx.APP_CONTEXT_KEY_AUTH_TOKEN, userCred)
+		if s3auth.IsStreamingSignedPayload(*r) {
+			err := decodeStreamingSignedBody(r, cred.AccessKeySecret.Secret)
+			if err != nil {
+				SendError(ctx, w, BadRequest(ctx, err.Error()))
+				return
+			}
+		}
+		ctx = context.WithValue(ctx, appctx.APP_CONTEXT_KEY_AUTH_TOKEN, cred.Token)
+
+		setCORSHeaders(ctx, w, r, o.Bucket)
 
 		f(ctx, w, r)
 	}
 }
 
+// decodeStreamingSignedBody replaces the aws-chunked body with its decoded
+// payload, whose chunk signatures are verified while being read by putObject
+// or UploadPart
+func decodeStreamingSignedBody(r *http.Request, secret string) error {
+	size, err := s3auth.GetDecodedContentLength(*r)
+	if err != nil {
+		return errors.Wrap(err, "GetDecodedContentLength")
+	}
+	body, err := s3auth.NewChunkedSignedReader(*r, secret)
+	if err != nil {
+		return errors.Wrap(err, "NewChunkedSignedReader")
+	}
+	r.Body = body
+	r.ContentLength = size
+	r.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	// aws-chunked is only the encoding between client and gateway
+	encodings := make([]string, 0)
+	for _, enc := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if len(enc) > 0 && enc != "aws-chunked" {
+			encodings = append(encodings, enc)
+		}
+	}
+	if len(encodings) > 0 {
+		r.Header.Set("Content-Encoding", strings.Join(encodings, ","))
+	} else {
+		r.Header.Del("Content-Encoding")
+	}
+	return nil
+}
+
 func fetchObjectRequest(ctx context.Context) SObjectRequest {
 	val := ctx.Value(S3_OBJECT_REQUEST)
 	if gotypes.IsNil(val) {
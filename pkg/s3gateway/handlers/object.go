@@ -47,7 +47,7 @@ func headObject(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	if err != nil {
 		return nil, errors.Wrap(err, "cloudprovider.GetIObject")
 	}
-	hdr := cloudprovider.MetaToHttpHeader(cloudprovider.META_HEADER_PREFIX, obj.GetMeta())
+	hdr := objectMetaHeader(obj.GetMeta())
 	hdr.Set(http.CanonicalHeaderKey("x-amz-acl"), string(obj.GetAcl()))
 	hdr.Set(http.CanonicalHeaderKey("x-amz-storage-class"), obj.GetStorageClass())
 	hdr.Set(http.CanonicalHeaderKey("content-length"), strconv.FormatInt(obj.GetSizeBytes(), 10))
@@ -86,6 +86,14 @@ func uploadObject(ctx context.Context, userCred mcclient.TokenCredential, bucket
 		respHdr.Set("ETag", etag)
 	} else {
 		meta := cloudprovider.FetchMetaFromHttpHeader(cloudprovider.META_HEADER_PREFIX, header)
+		tagStr := header.Get(http.CanonicalHeaderKey("x-amz-tagging"))
+		if len(tagStr) > 0 {
+			tags, err := models.DecodeObjectTags(tagStr)
+			if err != nil {
+				return nil, errors.Wrap(err, "DecodeObjectTags")
+			}
+			meta = models.SetObjectTags(meta, tags)
+		}
 		aclStr := header.Get(http.CanonicalHeaderKey("x-amz-acl"))
 		storageClassStr := header.Get(http.CanonicalHeaderKey("x-amz-storage-class"))
 		err = iBucket.PutObject(ctx, key, body, contLen, cloudprovider.TBucketACLType(aclStr), storageClassStr, meta)
@@ -205,10 +213,6 @@ func copyObject(ctx context.Context, userCred mcclient.TokenCredential, bucketNa
 	}
 }
 
-func deleteObjectTags(ctx context.Context, userCred mcclient.TokenCredential, bucket string, key string) (*s3cli.Tagging, error) {
-	return nil, nil
-}
-
 func removeObject(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string) error {
 	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
 	if err != nil {
@@ -0,0 +1,152 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/appsrv"
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
+)
+
+func fetchTagging(ctx context.Context, r *http.Request, maxCount int) (*models.STagging, error) {
+	tagging := models.STagging{}
+	err := appsrv.FetchXml(r, &tagging)
+	if err != nil {
+		return nil, MalformedXML(ctx, err.Error())
+	}
+	err = tagging.Validate(maxCount)
+	if err != nil {
+		return nil, errors.Wrap(err, "Validate")
+	}
+	return &tagging, nil
+}
+
+func getBucketTagging(ctx context.Context, userCred mcclient.TokenCredential, bucketName string) (*models.STagging, error) {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return nil, errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	tags, err := iBucket.GetTags()
+	if err != nil {
+		return nil, errors.Wrap(err, "iBucket.GetTags")
+	}
+	if len(tags) == 0 {
+		return nil, NoSuchTagSet(ctx, "The TagSet does not exist")
+	}
+	return models.NewTagging(tags), nil
+}
+
+func setBucketTags(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, tags map[string]string) error {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+	err = iBucket.SetTags(tags, true)
+	if err != nil {
+		return errors.Wrap(err, "iBucket.SetTags")
+	}
+	return nil
+}
+
+func putBucketTagging(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, r *http.Request) error {
+	tagging, err := fetchTagging(ctx, r, models.MAX_BUCKET_TAG_COUNT)
+	if err != nil {
+		return err
+	}
+	return setBucketTags(ctx, userCred, bucketName, tagging.ToMap())
+}
+
+func deleteBucketTagging(ctx context.Context, userCred mcclient.TokenCredential, bucketName string) error {
+	return setBucketTags(ctx, userCred, bucketName, map[string]string{})
+}
+
+func getObjectTagging(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string) (*models.STagging, error) {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return nil, errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	obj, err := cloudprovider.GetIObject(iBucket, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "cloudprovider.GetIObject")
+	}
+	return models.NewTagging(models.GetObjectTags(obj.GetMeta())), nil
+}
+
+func setObjectTags(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, tags map[string]string) error {
+	bucket, err := models.BucketManager.GetByName(ctx, userCred, bucketName)
+	if err != nil {
+		return errors.Wrap(err, "models.BucketManager.GetByName")
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+	obj, err := cloudprovider.GetIObject(iBucket, key)
+	if err != nil {
+		return errors.Wrap(err, "cloudprovider.GetIObject")
+	}
+	err = obj.SetMeta(ctx, models.SetObjectTags(obj.GetMeta(), tags))
+	if err != nil {
+		return errors.Wrap(err, "obj.SetMeta")
+	}
+	return nil
+}
+
+func putObjectTagging(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string, r *http.Request) error {
+	tagging, err := fetchTagging(ctx, r, models.MAX_OBJECT_TAG_COUNT)
+	if err != nil {
+		return err
+	}
+	return setObjectTags(ctx, userCred, bucketName, key, tagging.ToMap())
+}
+
+func deleteObjectTags(ctx context.Context, userCred mcclient.TokenCredential, bucketName string, key string) (*models.STagging, error) {
+	err := setObjectTags(ctx, userCred, bucketName, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// objectMetaHeader converts object metadata to response headers, tags are
+// reported by count like S3 does instead of as metadata
+func objectMetaHeader(meta http.Header) http.Header {
+	tags := models.GetObjectTags(meta)
+	meta = models.SetObjectTags(meta, nil)
+	hdr := cloudprovider.MetaToHttpHeader(cloudprovider.META_HEADER_PREFIX, meta)
+	if len(tags) > 0 {
+		hdr.Set("X-Amz-Tagging-Count", strconv.Itoa(len(tags)))
+	}
+	return hdr
+}
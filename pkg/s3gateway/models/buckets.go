@@ -103,6 +103,10 @@ type SBucketDelegate struct {
 }
 
 func (manager *SBucketManagerDelegate) List(ctx context.Context, userCred mcclient.TokenCredential) ([]*SBucketDelegate, error) {
+	return manager.list(ctx, userCred, "")
+}
+
+func (manager *SBucketManagerDelegate) list(ctx context.Context, userCred mcclient.TokenCredential, scope string) ([]*SBucketDelegate, error) {
 	s := session.GetSession(ctx, userCred)
 	offset := 0
 	total := -1
@@ -111,9 +115,11 @@ func (manager *SBucketManagerDelegate) List(ctx context.Context, userCred mcclie
 		params := struct {
 			Limit  int
 			Offset int
+			Scope  string `json:"scope,omitempty"`
 		}{}
 		params.Limit = 1000
 		params.Offset = offset
+		params.Scope = scope
 		result, err := modules.Buckets.List(s, jsonutils.Marshal(params))
 		if err != nil {
 			return nil, errors.Wrap(err, "List")
@@ -152,6 +158,39 @@ func (manager *SBucketManagerDelegate) GetByName(ctx context.Context, userCred m
 	return bucket, nil
 }
 
+// GetByNameAsService resolves a bucket by name with the service credential.
+// It serves requests without credential, e.g. CORS preflight, and fails when
+// the name is ambiguous among projects
+func (manager *SBucketManagerDelegate) GetByNameAsService(ctx context.Context, name string) (*SBucketDelegate, error) {
+	s := session.GetAdminSession(ctx)
+	params := struct {
+		Name  []string `json:"name"`
+		Scope string   `json:"scope"`
+		Limit int      `json:"limit"`
+	}{
+		Name:  []string{name},
+		Scope: "system",
+		Limit: 2,
+	}
+	result, err := modules.Buckets.List(s, jsonutils.Marshal(params))
+	if err != nil {
+		return nil, errors.Wrap(err, "modules.Buckets.List")
+	}
+	switch len(result.Data) {
+	case 0:
+		return nil, errors.Wrapf(httperrors.ErrNotFound, "bucket %s", name)
+	case 1:
+	default:
+		return nil, errors.Wrapf(httperrors.ErrDuplicateName, "bucket %s", name)
+	}
+	bucket := &SBucketDelegate{}
+	err = result.Data[0].Unmarshal(bucket)
+	if err != nil {
+		return nil, errors.Wrap(err, "result.Unmarshal")
+	}
+	return bucket, nil
+}
+
 func (manager *SBucketManagerDelegate) DeleteByName(ctx context.Context, userCred mcclient.TokenCredential, name string) error {
 	s := session.GetSession(ctx, userCred)
 	_, err := modules.Buckets.Delete(s, name, nil)
@@ -0,0 +1,232 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/pkg/gotypes"
+	"yunion.io/x/pkg/utils"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/util/hashcache"
+)
+
+const (
+	MAX_CORS_RULE_COUNT = 100
+)
+
+var (
+	corsAllowedMethods = []string{
+		http.MethodGet,
+		http.MethodPut,
+		http.MethodPost,
+		http.MethodDelete,
+		http.MethodHead,
+	}
+
+	// cors rules are consulted by every cross-origin request, cache them
+	// shortly to avoid querying the backend each time
+	corsRules = hashcache.NewCache(2048, time.Minute)
+)
+
+type SCORSRule struct {
+	ID            string   `xml:"ID,omitempty"`
+	AllowedMethod []string `xml:"AllowedMethod"`
+	AllowedOrigin []string `xml:"AllowedOrigin"`
+	AllowedHeader []string `xml:"AllowedHeader,omitempty"`
+	ExposeHeader  []string `xml:"ExposeHeader,omitempty"`
+	MaxAgeSeconds int      `xml:"MaxAgeSeconds,omitempty"`
+}
+
+type SCORSConfiguration struct {
+	XMLName  xml.Name    `xml:"CORSConfiguration"`
+	CORSRule []SCORSRule `xml:"CORSRule"`
+}
+
+func (conf *SCORSConfiguration) Validate() error {
+	if len(conf.CORSRule) == 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "empty cors rules")
+	}
+	if len(conf.CORSRule) > MAX_CORS_RULE_COUNT {
+		return errors.Wrapf(httperrors.ErrBadRequest, "cors rule count %d exceeds %d", len(conf.CORSRule), MAX_CORS_RULE_COUNT)
+	}
+	for i, rule := range conf.CORSRule {
+		if len(rule.AllowedMethod) == 0 || len(rule.AllowedOrigin) == 0 {
+			return errors.Wrapf(httperrors.ErrBadRequest, "rule %d: AllowedMethod and AllowedOrigin are required", i)
+		}
+		for _, method := range rule.AllowedMethod {
+			if !utils.IsInStringArray(method, corsAllowedMethods) {
+				return errors.Wrapf(httperrors.ErrBadRequest, "rule %d: unsupported method %s", i, method)
+			}
+		}
+		for _, origin := range rule.AllowedOrigin {
+			if strings.Count(origin, "*") > 1 {
+				return errors.Wrapf(httperrors.ErrBadRequest, "rule %d: origin %s contains more than one wildcard", i, origin)
+			}
+		}
+		for _, header := range rule.AllowedHeader {
+			if strings.Count(header, "*") > 1 {
+				return errors.Wrapf(httperrors.ErrBadRequest, "rule %d: header %s contains more than one wildcard", i, header)
+			}
+		}
+		if rule.MaxAgeSeconds < 0 {
+			return errors.Wrapf(httperrors.ErrBadRequest, "rule %d: negative MaxAgeSeconds", i)
+		}
+	}
+	return nil
+}
+
+func (conf *SCORSConfiguration) ToCloudRules() []cloudprovider.SBucketCORSRule {
+	ret := make([]cloudprovider.SBucketCORSRule, len(conf.CORSRule))
+	for i, rule := range conf.CORSRule {
+		ret[i] = cloudprovider.SBucketCORSRule{
+			Id:             rule.ID,
+			AllowedMethods: rule.AllowedMethod,
+			AllowedOrigins: rule.AllowedOrigin,
+			AllowedHeaders: rule.AllowedHeader,
+			ExposeHeaders:  rule.ExposeHeader,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		}
+	}
+	return ret
+}
+
+func NewCORSConfiguration(rules []cloudprovider.SBucketCORSRule) *SCORSConfiguration {
+	ret := &SCORSConfiguration{
+		CORSRule: make([]SCORSRule, len(rules)),
+	}
+	for i, rule := range rules {
+		ret.CORSRule[i] = SCORSRule{
+			ID:            rule.Id,
+			AllowedMethod: rule.AllowedMethods,
+			AllowedOrigin: rule.AllowedOrigins,
+			AllowedHeader: rule.AllowedHeaders,
+			ExposeHeader:  rule.ExposeHeaders,
+			MaxAgeSeconds: rule.MaxAgeSeconds,
+		}
+	}
+	return ret
+}
+
+// matchWildcard matches s against pattern containing at most one *
+func matchWildcard(pattern, s string) bool {
+	pos := strings.IndexByte(pattern, '*')
+	if pos < 0 {
+		return pattern == s
+	}
+	prefix, suffix := pattern[:pos], pattern[pos+1:]
+	return len(s) >= len(prefix)+len(suffix) && strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix)
+}
+
+// MatchCORSRule returns the first rule allowing the cross-origin request,
+// headers are the ones requested by Access-Control-Request-Headers
+func MatchCORSRule(rules []cloudprovider.SBucketCORSRule, origin string, method string, headers []string) *cloudprovider.SBucketCORSRule {
+	for i := range rules {
+		rule := &rules[i]
+		if !utils.IsInStringArray(method, rule.AllowedMethods) {
+			continue
+		}
+		originMatched := false
+		for _, pattern := range rule.AllowedOrigins {
+			if matchWildcard(pattern, origin) {
+				originMatched = true
+				break
+			}
+		}
+		if !originMatched {
+			continue
+		}
+		headersMatched := true
+		for _, header := range headers {
+			header = strings.ToLower(header)
+			matched := false
+			for _, pattern := range rule.AllowedHeaders {
+				if matchWildcard(strings.ToLower(pattern), header) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				headersMatched = false
+				break
+			}
+		}
+		if headersMatched {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (bucket *SBucketDelegate) GetCORSRules(ctx context.Context, userCred mcclient.TokenCredential) ([]cloudprovider.SBucketCORSRule, error) {
+	val := corsRules.AtomicGet(bucket.Id)
+	if !gotypes.IsNil(val) {
+		return val.([]cloudprovider.SBucketCORSRule), nil
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "bucket.GetIBucket")
+	}
+	rules, err := iBucket.GetCORSRules()
+	if err != nil {
+		switch errors.Cause(err) {
+		case cloudprovider.ErrNotSupported, cloudprovider.ErrNotImplemented:
+			// cached as no rule, so that a backend without CORS support
+			// is not queried on every request
+			rules = nil
+		default:
+			return nil, errors.Wrap(err, "iBucket.GetCORSRules")
+		}
+	}
+	if rules == nil {
+		rules = []cloudprovider.SBucketCORSRule{}
+	}
+	corsRules.AtomicSet(bucket.Id, rules)
+	return rules, nil
+}
+
+func (bucket *SBucketDelegate) SetCORS(ctx context.Context, userCred mcclient.TokenCredential, conf *SCORSConfiguration) error {
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+	defer corsRules.AtomicRemove(bucket.Id)
+	err = iBucket.SetCORS(conf.ToCloudRules())
+	if err != nil {
+		return errors.Wrap(err, "iBucket.SetCORS")
+	}
+	return nil
+}
+
+func (bucket *SBucketDelegate) DeleteCORS(ctx context.Context, userCred mcclient.TokenCredential) error {
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "bucket.GetIBucket")
+	}
+	defer corsRules.AtomicRemove(bucket.Id)
+	err = iBucket.DeleteCORS()
+	if err != nil {
+		return errors.Wrap(err, "iBucket.DeleteCORS")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"testing"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+func TestMatchCORSRule(t *testing.T) {
+	rules := []cloudprovider.SBucketCORSRule{
+		{
+			Id:             "0",
+			AllowedOrigins: []string{"https://*.example.com"},
+			AllowedMethods: []string{"GET", "PUT"},
+			AllowedHeaders: []string{"x-amz-*", "Content-Type"},
+		},
+		{
+			Id:             "1",
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET"},
+		},
+	}
+	cases := []struct {
+		origin  string
+		method  string
+		headers []string
+		want    string
+	}{
+		{"https://www.example.com", "PUT", []string{"X-Amz-Date", "content-type"}, "0"},
+		{"https://www.example.com", "PUT", []string{"Authorization"}, ""},
+		{"https://example.com", "PUT", nil, ""},
+		{"http://other.org", "GET", nil, "1"},
+		{"http://other.org", "GET", []string{"X-Amz-Date"}, ""},
+		{"http://other.org", "DELETE", nil, ""},
+	}
+	for _, c := range cases {
+		rule := MatchCORSRule(rules, c.origin, c.method, c.headers)
+		got := ""
+		if rule != nil {
+			got = rule.Id
+		}
+		if got != c.want {
+			t.Errorf("%s %s %v: got rule %q, want %q", c.method, c.origin, c.headers, got, c.want)
+		}
+	}
+}
+
+func TestObjectTags(t *testing.T) {
+	tags, err := DecodeObjectTags("project=blue&env=%E6%B5%8B%E8%AF%95")
+	if err != nil {
+		t.Fatalf("DecodeObjectTags: %v", err)
+	}
+	if tags["project"] != "blue" || tags["env"] != "测试" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+	meta := SetObjectTags(nil, tags)
+	if got := GetObjectTags(meta); len(got) != 2 || got["env"] != "测试" {
+		t.Errorf("tags not kept in meta: %v", got)
+	}
+	if _, err := DecodeObjectTags("a=1&a=2"); err == nil {
+		t.Errorf("duplicate key accepted")
+	}
+}
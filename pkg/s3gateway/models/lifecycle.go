@@ -0,0 +1,471 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+	"yunion.io/x/onecloud/pkg/httperrors"
+	"yunion.io/x/onecloud/pkg/mcclient"
+	modules "yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+	"yunion.io/x/onecloud/pkg/s3gateway/session"
+)
+
+// the configuration is kept in the metadata of bucket, it is pushed to the
+// backends implementing cloudprovider.ICloudBucketLifecycle and enforced by
+// s3gateway itself for the others
+const (
+	BUCKET_LIFECYCLE_METADATA_KEY = "s3gateway_lifecycle"
+	// set if the configuration is pushed to a backend supporting lifecycle
+	BUCKET_LIFECYCLE_NATIVE_METADATA_KEY = "s3gateway_lifecycle_native"
+
+	LIFECYCLE_STATUS_ENABLED  = "Enabled"
+	LIFECYCLE_STATUS_DISABLED = "Disabled"
+
+	MAX_LIFECYCLE_RULE_COUNT = 1000
+
+	lifecycleListPageSize = 1000
+)
+
+type SLifecycleExpiration struct {
+	Days int `xml:"Days,omitempty"`
+	// ISO 8601 format, must be midnight UTC, e.g. 2020-01-01T00:00:00.000Z
+	Date string `xml:"Date,omitempty"`
+}
+
+type SAbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+type SLifecycleAnd struct {
+	Prefix string `xml:"Prefix,omitempty"`
+	Tags   []STag `xml:"Tag"`
+}
+
+type SLifecycleFilter struct {
+	Prefix string         `xml:"Prefix,omitempty"`
+	Tag    *STag          `xml:"Tag,omitempty"`
+	And    *SLifecycleAnd `xml:"And,omitempty"`
+}
+
+type SLifecycleRule struct {
+	ID     string `xml:"ID,omitempty"`
+	Status string `xml:"Status"`
+	// deprecated by Filter, still sent by older clients
+	Prefix string            `xml:"Prefix,omitempty"`
+	Filter *SLifecycleFilter `xml:"Filter,omitempty"`
+
+	Expiration                     *SLifecycleExpiration            `xml:"Expiration,omitempty"`
+	AbortIncompleteMultipartUpload *SAbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+}
+
+type SLifecycleConfiguration struct {
+	XMLName xml.Name         `xml:"LifecycleConfiguration"`
+	Rules   []SLifecycleRule `xml:"Rule"`
+
+	// whether the configuration is enforced by the backend
+	native bool
+}
+
+func (rule *SLifecycleRule) IsEnabled() bool {
+	return rule.Status == LIFECYCLE_STATUS_ENABLED
+}
+
+func (rule *SLifecycleRule) getPrefix() string {
+	if rule.Filter != nil {
+		if rule.Filter.And != nil {
+			return rule.Filter.And.Prefix
+		}
+		return rule.Filter.Prefix
+	}
+	return rule.Prefix
+}
+
+func (rule *SLifecycleRule) getTags() []STag {
+	if rule.Filter != nil {
+		if rule.Filter.And != nil {
+			return rule.Filter.And.Tags
+		}
+		if rule.Filter.Tag != nil {
+			return []STag{*rule.Filter.Tag}
+		}
+	}
+	return nil
+}
+
+func (rule *SLifecycleRule) getExpirationDate() (time.Time, error) {
+	return time.Parse(time.RFC3339, rule.Expiration.Date)
+}
+
+func (rule *SLifecycleRule) Validate() error {
+	if rule.Status != LIFECYCLE_STATUS_ENABLED && rule.Status != LIFECYCLE_STATUS_DISABLED {
+		return errors.Wrapf(httperrors.ErrBadRequest, "invalid status %q", rule.Status)
+	}
+	if rule.Expiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+		return errors.Wrap(httperrors.ErrBadRequest, "at least one action is required")
+	}
+	if rule.Filter != nil {
+		if len(rule.Prefix) > 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "Prefix and Filter cannot be used together")
+		}
+		cnt := 0
+		if len(rule.Filter.Prefix) > 0 {
+			cnt++
+		}
+		if rule.Filter.Tag != nil {
+			cnt++
+		}
+		if rule.Filter.And != nil {
+			cnt++
+		}
+		if cnt > 1 {
+			return errors.Wrap(httperrors.ErrBadRequest, "only one of Prefix, Tag and And is allowed in Filter")
+		}
+	}
+	tags := rule.getTags()
+	if len(tags) > 0 {
+		err := validateTags(tags, MAX_OBJECT_TAG_COUNT)
+		if err != nil {
+			return err
+		}
+	}
+	if rule.Expiration != nil {
+		if (rule.Expiration.Days > 0) == (len(rule.Expiration.Date) > 0) {
+			return errors.Wrap(httperrors.ErrBadRequest, "exactly one of Days and Date is required in Expiration")
+		}
+		if rule.Expiration.Days < 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "Days must be positive")
+		}
+		if len(rule.Expiration.Date) > 0 {
+			date, err := rule.getExpirationDate()
+			if err != nil {
+				return errors.Wrapf(httperrors.ErrBadRequest, "invalid Date %q", rule.Expiration.Date)
+			}
+			if !date.Equal(date.UTC().Truncate(24 * time.Hour)) {
+				return errors.Wrapf(httperrors.ErrBadRequest, "Date %q is not midnight UTC", rule.Expiration.Date)
+			}
+		}
+	}
+	if rule.AbortIncompleteMultipartUpload != nil {
+		if rule.AbortIncompleteMultipartUpload.DaysAfterInitiation <= 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "DaysAfterInitiation must be positive")
+		}
+		if len(tags) > 0 {
+			return errors.Wrap(httperrors.ErrBadRequest, "AbortIncompleteMultipartUpload cannot be used with tag filter")
+		}
+	}
+	return nil
+}
+
+// daysLater returns the midnight UTC after t plus days, which is how S3
+// calculates the time of lifecycle actions
+func daysLater(t time.Time, days int) time.Time {
+	t = t.UTC().Add(time.Duration(days) * 24 * time.Hour)
+	midnight := t.Truncate(24 * time.Hour)
+	if midnight.Equal(t) {
+		return midnight
+	}
+	return midnight.Add(24 * time.Hour)
+}
+
+func (rule *SLifecycleRule) matchTags(tags map[string]string) bool {
+	for _, tag := range rule.getTags() {
+		if val, ok := tags[tag.Key]; !ok || val != tag.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// isObjectDue returns whether an object is expired by the rule regardless of tags
+func (rule *SLifecycleRule) isObjectDue(key string, lastModified time.Time, now time.Time) bool {
+	if !rule.IsEnabled() || rule.Expiration == nil || !strings.HasPrefix(key, rule.getPrefix()) {
+		return false
+	}
+	if rule.Expiration.Days > 0 {
+		return !now.Before(daysLater(lastModified, rule.Expiration.Days))
+	}
+	date, err := rule.getExpirationDate()
+	if err != nil {
+		return false
+	}
+	return !now.Before(date)
+}
+
+// IsObjectExpired returns whether an object should be deleted by the expiration of rule
+func (rule *SLifecycleRule) IsObjectExpired(key string, lastModified time.Time, tags map[string]string, now time.Time) bool {
+	return rule.isObjectDue(key, lastModified, now) && rule.matchTags(tags)
+}
+
+// IsUploadExpired returns whether an incomplete multipart upload should be aborted
+func (rule *SLifecycleRule) IsUploadExpired(key string, initiated time.Time, now time.Time) bool {
+	if !rule.IsEnabled() || rule.AbortIncompleteMultipartUpload == nil {
+		return false
+	}
+	if !strings.HasPrefix(key, rule.getPrefix()) {
+		return false
+	}
+	return !now.Before(daysLater(initiated, rule.AbortIncompleteMultipartUpload.DaysAfterInitiation))
+}
+
+func (conf *SLifecycleConfiguration) Validate() error {
+	if len(conf.Rules) == 0 {
+		return errors.Wrap(httperrors.ErrBadRequest, "empty lifecycle rules")
+	}
+	if len(conf.Rules) > MAX_LIFECYCLE_RULE_COUNT {
+		return errors.Wrapf(httperrors.ErrBadRequest, "lifecycle rule count %d exceeds %d", len(conf.Rules), MAX_LIFECYCLE_RULE_COUNT)
+	}
+	ids := make(map[string]bool)
+	for i := range conf.Rules {
+		rule := &conf.Rules[i]
+		if len(rule.ID) > 0 {
+			if ids[rule.ID] {
+				return errors.Wrapf(httperrors.ErrBadRequest, "duplicate rule id %q", rule.ID)
+			}
+			ids[rule.ID] = true
+		}
+		err := rule.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+	}
+	return nil
+}
+
+// GetLifecycle returns nil if the bucket has no lifecycle configuration
+func (bucket *SBucketDelegate) GetLifecycle(ctx context.Context, userCred mcclient.TokenCredential) (*SLifecycleConfiguration, error) {
+	s := session.GetSession(ctx, userCred)
+	meta, err := modules.Buckets.GetMetadata(s, bucket.Id, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "modules.Buckets.GetMetadata")
+	}
+	confStr, _ := meta.GetString(BUCKET_LIFECYCLE_METADATA_KEY)
+	if len(confStr) == 0 {
+		return nil, nil
+	}
+	conf := &SLifecycleConfiguration{}
+	err = xml.Unmarshal([]byte(confStr), conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "xml.Unmarshal")
+	}
+	native, _ := meta.GetString(BUCKET_LIFECYCLE_NATIVE_METADATA_KEY)
+	conf.native = native == "true"
+	return conf, nil
+}
+
+func (bucket *SBucketDelegate) SetLifecycle(ctx context.Context, userCred mcclient.TokenCredential, conf *SLifecycleConfiguration) error {
+	confBytes, err := xml.Marshal(conf)
+	if err != nil {
+		return errors.Wrap(err, "xml.Marshal")
+	}
+	native, err := bucket.setNativeLifecycle(ctx, userCred, string(confBytes))
+	if err != nil {
+		return errors.Wrap(err, "setNativeLifecycle")
+	}
+	return bucket.setLifecycleMetadata(ctx, userCred, string(confBytes), native)
+}
+
+func (bucket *SBucketDelegate) DeleteLifecycle(ctx context.Context, userCred mcclient.TokenCredential) error {
+	_, err := bucket.setNativeLifecycle(ctx, userCred, "")
+	if err != nil {
+		return errors.Wrap(err, "setNativeLifecycle")
+	}
+	// metadata with value none is removed
+	return bucket.setLifecycleMetadata(ctx, userCred, "none", false)
+}
+
+// setNativeLifecycle pushes the configuration to the backend if it supports
+// lifecycle, otherwise the rules are enforced by s3gateway
+func (bucket *SBucketDelegate) setNativeLifecycle(ctx context.Context, userCred mcclient.TokenCredential, conf string) (bool, error) {
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return false, errors.Wrap(err, "GetIBucket")
+	}
+	lc, ok := iBucket.(cloudprovider.ICloudBucketLifecycle)
+	if !ok {
+		return false, nil
+	}
+	err = lc.SetLifecycle(conf)
+	if err != nil {
+		switch errors.Cause(err) {
+		case cloudprovider.ErrNotSupported, cloudprovider.ErrNotImplemented:
+			return false, nil
+		}
+		return false, errors.Wrap(err, "SetLifecycle")
+	}
+	return len(conf) > 0, nil
+}
+
+func (bucket *SBucketDelegate) setLifecycleMetadata(ctx context.Context, userCred mcclient.TokenCredential, val string, native bool) error {
+	s := session.GetSession(ctx, userCred)
+	params := jsonutils.NewDict()
+	params.Set(BUCKET_LIFECYCLE_METADATA_KEY, jsonutils.NewString(val))
+	if native {
+		params.Set(BUCKET_LIFECYCLE_NATIVE_METADATA_KEY, jsonutils.NewString("true"))
+	} else {
+		params.Set(BUCKET_LIFECYCLE_NATIVE_METADATA_KEY, jsonutils.NewString("none"))
+	}
+	_, err := modules.Buckets.SetMetadata(s, bucket.Id, params)
+	if err != nil {
+		return errors.Wrap(err, "modules.Buckets.SetMetadata")
+	}
+	return nil
+}
+
+func (bucket *SBucketDelegate) applyLifecycle(ctx context.Context, userCred mcclient.TokenCredential, now time.Time) error {
+	conf, err := bucket.GetLifecycle(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "GetLifecycle")
+	}
+	if conf == nil || conf.native {
+		return nil
+	}
+	iBucket, err := bucket.GetIBucket(ctx, userCred)
+	if err != nil {
+		return errors.Wrap(err, "GetIBucket")
+	}
+	expiredCnt, err := expireObjects(ctx, iBucket, conf, now)
+	if expiredCnt > 0 {
+		log.Infof("lifecycle: %d objects of bucket %s expired", expiredCnt, bucket.Name)
+		bucket.Invalidate()
+	}
+	if err != nil {
+		return errors.Wrap(err, "expireObjects")
+	}
+	err = abortIncompleteUploads(ctx, iBucket, conf, now)
+	if err != nil {
+		return errors.Wrap(err, "abortIncompleteUploads")
+	}
+	return nil
+}
+
+func expireObjects(ctx context.Context, iBucket cloudprovider.ICloudBucket, conf *SLifecycleConfiguration, now time.Time) (int, error) {
+	hasExpiration := false
+	for i := range conf.Rules {
+		if conf.Rules[i].IsEnabled() && conf.Rules[i].Expiration != nil {
+			hasExpiration = true
+			break
+		}
+	}
+	if !hasExpiration {
+		return 0, nil
+	}
+	expiredCnt := 0
+	marker := ""
+	for {
+		result, err := iBucket.ListObjects("", marker, "", lifecycleListPageSize)
+		if err != nil {
+			return expiredCnt, errors.Wrap(err, "iBucket.ListObjects")
+		}
+		for _, obj := range result.Objects {
+			var tags map[string]string
+			for i := range conf.Rules {
+				rule := &conf.Rules[i]
+				if !rule.isObjectDue(obj.GetKey(), obj.GetLastModified(), now) {
+					continue
+				}
+				if len(rule.getTags()) > 0 {
+					if tags == nil {
+						tags = fetchObjectTags(iBucket, obj.GetKey())
+					}
+					if !rule.matchTags(tags) {
+						continue
+					}
+				}
+				err := iBucket.DeleteObject(ctx, obj.GetKey())
+				if err != nil {
+					log.Errorf("lifecycle: delete expired object %s of bucket %s fail %s", obj.GetKey(), iBucket.GetName(), err)
+				} else {
+					expiredCnt++
+				}
+				break
+			}
+		}
+		if !result.IsTruncated || len(result.Objects) == 0 {
+			break
+		}
+		if len(result.NextMarker) > 0 {
+			marker = result.NextMarker
+		} else {
+			marker = result.Objects[len(result.Objects)-1].GetKey()
+		}
+	}
+	return expiredCnt, nil
+}
+
+// fetchObjectTags reads tags from the metadata of object, which is not
+// returned by ListObjects of most backends and has to be fetched per object
+func fetchObjectTags(iBucket cloudprovider.ICloudBucket, key string) map[string]string {
+	obj, err := cloudprovider.GetIObject(iBucket, key)
+	if err != nil {
+		log.Errorf("lifecycle: get object %s of bucket %s fail %s", key, iBucket.GetName(), err)
+		return map[string]string{}
+	}
+	return GetObjectTags(obj.GetMeta())
+}
+
+func abortIncompleteUploads(ctx context.Context, iBucket cloudprovider.ICloudBucket, conf *SLifecycleConfiguration, now time.Time) error {
+	hasAbort := false
+	for i := range conf.Rules {
+		if conf.Rules[i].IsEnabled() && conf.Rules[i].AbortIncompleteMultipartUpload != nil {
+			hasAbort = true
+			break
+		}
+	}
+	if !hasAbort {
+		return nil
+	}
+	uploads, err := iBucket.ListMultipartUploads()
+	if err != nil {
+		return errors.Wrap(err, "iBucket.ListMultipartUploads")
+	}
+	for _, upload := range uploads {
+		for i := range conf.Rules {
+			if !conf.Rules[i].IsUploadExpired(upload.ObjectName, upload.Initiated, now) {
+				continue
+			}
+			err := iBucket.AbortMultipartUpload(ctx, upload.ObjectName, upload.UploadID)
+			if err != nil {
+				log.Errorf("lifecycle: abort upload %s of %s in bucket %s fail %s", upload.UploadID, upload.ObjectName, iBucket.GetName(), err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// EnforceLifecycle applies lifecycle rules of all buckets
+func (manager *SBucketManagerDelegate) EnforceLifecycle(ctx context.Context, userCred mcclient.TokenCredential, isStart bool) {
+	buckets, err := manager.list(ctx, userCred, "system")
+	if err != nil {
+		log.Errorf("lifecycle: list buckets fail %s", err)
+		return
+	}
+	now := time.Now().UTC()
+	for _, bucket := range buckets {
+		err := bucket.applyLifecycle(ctx, userCred, now)
+		if err != nil {
+			log.Errorf("lifecycle: apply to bucket %s fail %s", bucket.Name, err)
+		}
+	}
+}
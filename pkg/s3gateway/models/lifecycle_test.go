@@ -0,0 +1,214 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"yunion.io/x/onecloud/pkg/cloudprovider"
+)
+
+func TestDaysLater(t *testing.T) {
+	cases := []struct {
+		t    string
+		days int
+		want string
+	}{
+		{"2020-01-01T10:00:00Z", 1, "2020-01-03T00:00:00Z"},
+		{"2020-01-01T00:00:00Z", 1, "2020-01-02T00:00:00Z"},
+		{"2020-01-01T23:00:00-02:00", 30, "2020-02-02T00:00:00Z"},
+	}
+	for _, c := range cases {
+		tm, _ := time.Parse(time.RFC3339, c.t)
+		got := daysLater(tm, c.days).Format(time.RFC3339)
+		if got != c.want {
+			t.Errorf("daysLater(%s, %d) = %s, want %s", c.t, c.days, got, c.want)
+		}
+	}
+}
+
+func TestLifecycleRule(t *testing.T) {
+	confXml := `<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Rule>
+    <ID>logs</ID>
+    <Filter><And><Prefix>logs/</Prefix><Tag><Key>temp</Key><Value>yes</Value></Tag></And></Filter>
+    <Status>Enabled</Status>
+    <Expiration><Days>7</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>uploads</ID>
+    <Filter><Prefix></Prefix></Filter>
+    <Status>Enabled</Status>
+    <AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload>
+  </Rule>
+  <Rule>
+    <Prefix>old/</Prefix>
+    <Status>Disabled</Status>
+    <Expiration><Date>2020-01-01T00:00:00.000Z</Date></Expiration>
+  </Rule>
+</LifecycleConfiguration>`
+	conf := SLifecycleConfiguration{}
+	if err := xml.Unmarshal([]byte(confXml), &conf); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if len(conf.Rules[0].getTags()) != 1 {
+		t.Errorf("tag filter not detected")
+	}
+
+	modified, _ := time.Parse(time.RFC3339, "2020-01-01T10:00:00Z")
+	now := modified.Add(8 * 24 * time.Hour)
+	tags := map[string]string{"temp": "yes"}
+	logs := &conf.Rules[0]
+	if !logs.IsObjectExpired("logs/a.log", modified, tags, now) {
+		t.Errorf("tagged log should expire")
+	}
+	if logs.IsObjectExpired("logs/a.log", modified, nil, now) {
+		t.Errorf("untagged log should not expire")
+	}
+	if logs.IsObjectExpired("data/a.log", modified, tags, now) {
+		t.Errorf("object out of prefix should not expire")
+	}
+	if logs.IsObjectExpired("logs/a.log", modified, tags, modified.Add(6*24*time.Hour)) {
+		t.Errorf("log should not expire before 7 days")
+	}
+
+	uploads := &conf.Rules[1]
+	if !uploads.IsUploadExpired("any", modified, modified.Add(2*24*time.Hour)) {
+		t.Errorf("stale upload should be aborted")
+	}
+	if uploads.IsUploadExpired("any", modified, modified.Add(time.Hour)) {
+		t.Errorf("recent upload should not be aborted")
+	}
+
+	old := &conf.Rules[2]
+	if old.IsObjectExpired("old/a", modified, nil, now) {
+		t.Errorf("disabled rule should not expire objects")
+	}
+	old.Status = LIFECYCLE_STATUS_ENABLED
+	if !old.IsObjectExpired("old/a", modified, nil, now) {
+		t.Errorf("object should expire after date")
+	}
+}
+
+func TestLifecycleValidate(t *testing.T) {
+	cases := []SLifecycleRule{
+		{Status: "enabled", Expiration: &SLifecycleExpiration{Days: 1}},
+		{Status: LIFECYCLE_STATUS_ENABLED},
+		{Status: LIFECYCLE_STATUS_ENABLED, Expiration: &SLifecycleExpiration{Days: 1, Date: "2020-01-01T00:00:00Z"}},
+		{Status: LIFECYCLE_STATUS_ENABLED, Expiration: &SLifecycleExpiration{Date: "2020-01-01T08:00:00Z"}},
+		{Status: LIFECYCLE_STATUS_ENABLED, Prefix: "a", Filter: &SLifecycleFilter{Prefix: "b"}, Expiration: &SLifecycleExpiration{Days: 1}},
+		{
+			Status:                         LIFECYCLE_STATUS_ENABLED,
+			Filter:                         &SLifecycleFilter{Tag: &STag{Key: "k", Value: "v"}},
+			AbortIncompleteMultipartUpload: &SAbortIncompleteMultipartUpload{DaysAfterInitiation: 1},
+		},
+	}
+	for i := range cases {
+		if err := cases[i].Validate(); err == nil {
+			t.Errorf("case %d: invalid rule accepted", i)
+		}
+	}
+}
+
+type fakeLifecycleObject struct {
+	cloudprovider.ICloudObject
+
+	key          string
+	lastModified time.Time
+	meta         http.Header
+}
+
+func (o *fakeLifecycleObject) GetKey() string {
+	return o.key
+}
+
+func (o *fakeLifecycleObject) GetLastModified() time.Time {
+	return o.lastModified
+}
+
+func (o *fakeLifecycleObject) GetMeta() http.Header {
+	return o.meta
+}
+
+// fakeLifecycleBucket returns metadata of objects only when looking up an
+// object by its key, like most backends do
+type fakeLifecycleBucket struct {
+	cloudprovider.ICloudBucket
+
+	objects []fakeLifecycleObject
+	deleted []string
+}
+
+func (b *fakeLifecycleBucket) GetName() string {
+	return "test"
+}
+
+func (b *fakeLifecycleBucket) ListObjects(prefix string, marker string, delimiter string, maxCount int) (cloudprovider.SListObjectResult, error) {
+	ret := cloudprovider.SListObjectResult{}
+	for i := range b.objects {
+		obj := b.objects[i]
+		if !strings.HasPrefix(obj.key, prefix) || obj.key <= marker {
+			continue
+		}
+		if len(prefix) == 0 {
+			obj.meta = nil
+		}
+		ret.Objects = append(ret.Objects, &obj)
+	}
+	return ret, nil
+}
+
+func (b *fakeLifecycleBucket) DeleteObject(ctx context.Context, key string) error {
+	b.deleted = append(b.deleted, key)
+	return nil
+}
+
+func TestExpireObjectsByTags(t *testing.T) {
+	modified, _ := time.Parse(time.RFC3339, "2020-01-01T10:00:00Z")
+	now := modified.Add(3 * 24 * time.Hour)
+	tagged := SetObjectTags(http.Header{}, map[string]string{"temp": "yes"})
+	bucket := &fakeLifecycleBucket{
+		objects: []fakeLifecycleObject{
+			{key: "a", lastModified: modified, meta: tagged},
+			{key: "b", lastModified: modified, meta: http.Header{}},
+			{key: "c", lastModified: now, meta: tagged},
+		},
+	}
+	conf := &SLifecycleConfiguration{
+		Rules: []SLifecycleRule{
+			{
+				Status:     LIFECYCLE_STATUS_ENABLED,
+				Filter:     &SLifecycleFilter{Tag: &STag{Key: "temp", Value: "yes"}},
+				Expiration: &SLifecycleExpiration{Days: 1},
+			},
+		},
+	}
+	cnt, err := expireObjects(context.Background(), bucket, conf, now)
+	if err != nil {
+		t.Fatalf("expireObjects: %v", err)
+	}
+	if cnt != 1 || !reflect.DeepEqual(bucket.deleted, []string{"a"}) {
+		t.Errorf("expect only a expired, got %d %v", cnt, bucket.deleted)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"unicode/utf8"
+
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/httperrors"
+)
+
+const (
+	// object tags are kept in user metadata of object in the format of
+	// x-amz-tagging header, since cloudprovider.ICloudObject has no tag API
+	OBJECT_TAGGING_META_KEY = "S3gateway-Tagging"
+
+	MAX_BUCKET_TAG_COUNT = 50
+	MAX_OBJECT_TAG_COUNT = 10
+	MAX_TAG_KEY_LENGTH   = 128
+	MAX_TAG_VALUE_LENGTH = 256
+)
+
+type STag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type STagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	TagSet  []STag   `xml:"TagSet>Tag"`
+}
+
+func NewTagging(tags map[string]string) *STagging {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := &STagging{
+		TagSet: make([]STag, len(keys)),
+	}
+	for i, k := range keys {
+		ret.TagSet[i] = STag{Key: k, Value: tags[k]}
+	}
+	return ret
+}
+
+func validateTags(tags []STag, maxCount int) error {
+	if len(tags) > maxCount {
+		return errors.Wrapf(httperrors.ErrBadRequest, "tag count %d exceeds %d", len(tags), maxCount)
+	}
+	keys := make(map[string]bool)
+	for _, tag := range tags {
+		if len(tag.Key) == 0 || utf8.RuneCountInString(tag.Key) > MAX_TAG_KEY_LENGTH {
+			return errors.Wrapf(httperrors.ErrBadRequest, "invalid tag key %q", tag.Key)
+		}
+		if utf8.RuneCountInString(tag.Value) > MAX_TAG_VALUE_LENGTH {
+			return errors.Wrapf(httperrors.ErrBadRequest, "tag value of %q too long", tag.Key)
+		}
+		if keys[tag.Key] {
+			return errors.Wrapf(httperrors.ErrBadRequest, "duplicate tag key %q", tag.Key)
+		}
+		keys[tag.Key] = true
+	}
+	return nil
+}
+
+func (tagging *STagging) Validate(maxCount int) error {
+	return validateTags(tagging.TagSet, maxCount)
+}
+
+func (tagging *STagging) ToMap() map[string]string {
+	ret := make(map[string]string)
+	for _, tag := range tagging.TagSet {
+		ret[tag.Key] = tag.Value
+	}
+	return ret
+}
+
+// DecodeObjectTags parses tags in the format of x-amz-tagging header, e.g. k1=v1&k2=v2
+func DecodeObjectTags(tagStr string) (map[string]string, error) {
+	ret := make(map[string]string)
+	if len(tagStr) == 0 {
+		return ret, nil
+	}
+	vals, err := url.ParseQuery(tagStr)
+	if err != nil {
+		return nil, errors.Wrapf(httperrors.ErrBadRequest, "invalid tagging %q", tagStr)
+	}
+	tags := make([]STag, 0, len(vals))
+	for k, v := range vals {
+		if len(v) != 1 {
+			return nil, errors.Wrapf(httperrors.ErrBadRequest, "duplicate tag key %q", k)
+		}
+		tags = append(tags, STag{Key: k, Value: v[0]})
+		ret[k] = v[0]
+	}
+	err = validateTags(tags, MAX_OBJECT_TAG_COUNT)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func EncodeObjectTags(tags map[string]string) string {
+	vals := url.Values{}
+	for k, v := range tags {
+		vals.Set(k, v)
+	}
+	return vals.Encode()
+}
+
+func GetObjectTags(meta http.Header) map[string]string {
+	tags, err := DecodeObjectTags(meta.Get(OBJECT_TAGGING_META_KEY))
+	if err != nil {
+		return map[string]string{}
+	}
+	return tags
+}
+
+// SetObjectTags returns a copy of meta with tags replaced
+func SetObjectTags(meta http.Header, tags map[string]string) http.Header {
+	ret := http.Header{}
+	for k, v := range meta {
+		ret[k] = v
+	}
+	if len(tags) > 0 {
+		ret.Set(OBJECT_TAGGING_META_KEY, EncodeObjectTags(tags))
+	} else {
+		ret.Del(OBJECT_TAGGING_META_KEY)
+	}
+	return ret
+}
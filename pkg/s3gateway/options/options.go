@@ -22,6 +22,8 @@ type SS3GatewayOptions struct {
 	common_options.CommonOptions
 
 	DomainName string `help:"s3 domain name"`
+
+	LifecycleCheckIntervalSeconds int `help:"interval to enforce bucket lifecycle rules, default 1 hour" default:"3600"`
 }
 
 var (
@@ -16,6 +16,7 @@ package service
 
 import (
 	"os"
+	"time"
 
 	"yunion.io/x/log"
 	_ "yunion.io/x/sqlchemy/backends"
@@ -23,9 +24,11 @@ import (
 	api "yunion.io/x/onecloud/pkg/apis/s3gateway"
 	"yunion.io/x/onecloud/pkg/cloudcommon"
 	app_common "yunion.io/x/onecloud/pkg/cloudcommon/app"
+	"yunion.io/x/onecloud/pkg/cloudcommon/cronman"
 	common_options "yunion.io/x/onecloud/pkg/cloudcommon/options"
 	_ "yunion.io/x/onecloud/pkg/multicloud/loader"
 	"yunion.io/x/onecloud/pkg/s3gateway/handlers"
+	"yunion.io/x/onecloud/pkg/s3gateway/models"
 	"yunion.io/x/onecloud/pkg/s3gateway/options"
 )
 
@@ -42,6 +45,14 @@ func StartService() {
 	app := app_common.InitApp(&opts.BaseOptions, false)
 	handlers.InitHandlers(app)
 
+	if !opts.IsSlaveNode {
+		cron := cronman.InitCronJobManager(false, opts.CronJobWorkerCount)
+		cron.AddJobAtIntervals("EnforceBucketLifecycle", time.Duration(opts.LifecycleCheckIntervalSeconds)*time.Second, models.BucketManager.EnforceLifecycle)
+
+		cron.Start()
+		defer cron.Stop()
+	}
+
 	/*if !opts.IsSlaveNode {
 		cron := cronman.GetCronJobManager(true)
 		cron.AddJobAtIntervals("CleanPendingDeleteImages", time.Duration(options.Options.PendingDeleteCheckSeconds)*time.Second, models.ImageManager.CleanPendingDeleteImages)
@@ -32,17 +32,20 @@ import (
 	comapi "yunion.io/x/onecloud/pkg/apis/compute"
 	api "yunion.io/x/onecloud/pkg/apis/scheduledtask"
 	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db/lockman"
 	"yunion.io/x/onecloud/pkg/cloudcommon/notifyclient"
 	"yunion.io/x/onecloud/pkg/httperrors"
 	"yunion.io/x/onecloud/pkg/mcclient"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
 	"yunion.io/x/onecloud/pkg/mcclient/modulebase"
 	"yunion.io/x/onecloud/pkg/mcclient/modules/compute"
+	"yunion.io/x/onecloud/pkg/mcclient/modules/devtool"
 	"yunion.io/x/onecloud/pkg/mcclient/options"
 	sop "yunion.io/x/onecloud/pkg/scheduledtask/options"
 	"yunion.io/x/onecloud/pkg/util/httputils"
 	"yunion.io/x/onecloud/pkg/util/logclient"
 	"yunion.io/x/onecloud/pkg/util/stringutils2"
+	"yunion.io/x/onecloud/pkg/util/tagutils"
 )
 
 var ScheduledTaskManager *SScheduledTaskManager
@@ -77,6 +80,8 @@ type SScheduledTask struct {
 	ResourceType string `width:"32" charset:"ascii" create:"required" list:"user" get:"user"`
 	Operation    string `width:"32" charset:"ascii" create:"required" list:"user" get:"user"`
 	LabelType    string `width:"4" charset:"ascii" create:"required" list:"user" get:"user"`
+
+	OperationParams *api.ScheduledTaskOperationParams `nullable:"true" create:"optional" list:"user" get:"user"`
 }
 
 func (stm *SScheduledTaskManager) ListItemFilter(ctx context.Context, q *sqlchemy.SQuery, userCred mcclient.TokenCredential, input api.ScheduledTaskListInput) (*sqlchemy.SQuery, error) {
@@ -140,6 +145,8 @@ func (st *SScheduledTask) getMoreDetails(ctx context.Context, userCred mcclient.
 		out.Timer = st.STimer.TimerDetails()
 	case api.ST_TYPE_CYCLE:
 		out.CycleTimer = st.STimer.CycleTimerDetails()
+	case api.ST_TYPE_CRON:
+		out.CronTimer = st.STimer.CronTimerDetails()
 	}
 	out.TimerDesc = st.Description(ctx, zone)
 	// fill label
@@ -163,30 +170,75 @@ func (stm *SScheduledTaskManager) ValidateCreateData(ctx context.Context, userCr
 	if err != nil {
 		return input, err
 	}
-	if !utils.IsInStringArray(input.ScheduledType, []string{api.ST_TYPE_TIMING, api.ST_TYPE_CYCLE}) {
+	if !utils.IsInStringArray(input.ScheduledType, []string{api.ST_TYPE_TIMING, api.ST_TYPE_CYCLE, api.ST_TYPE_CRON}) {
 		return input, httperrors.NewInputParameterError("unkown scheduled type '%s'", input.ScheduledType)
 	}
-	if !utils.IsInStringArray(input.ResourceType, []string{api.ST_RESOURCE_SERVER, api.ST_RESOURCE_CLOUDACCOUNT}) {
+	if _, ok := Modules[Resource(input.ResourceType)]; !ok {
 		return input, httperrors.NewInputParameterError("unkown resource type '%s'", input.ResourceType)
 	}
-	if !utils.IsInStringArray(input.Operation, []string{api.ST_RESOURCE_OPERATION_RESTART, api.ST_RESOURCE_OPERATION_STOP, api.ST_RESOURCE_OPERATION_START, api.ST_RESOURCE_OPERATION_SYNC}) {
-		return input, httperrors.NewInputParameterError("unkown resource operation '%s'", input.Operation)
+	if _, ok := ResourceOperationMap[fmt.Sprintf("%s.%s", input.ResourceType, input.Operation)]; !ok {
+		return input, httperrors.NewInputParameterError("unsupported operation '%s' for resource type '%s'", input.Operation, input.ResourceType)
 	}
 	if !utils.IsInStringArray(input.LabelType, []string{api.ST_LABEL_ID, api.ST_LABEL_TAG}) {
 		return input, httperrors.NewInputParameterError("unkown label type '%s'", input.LabelType)
 	}
-	// check timer or cycletimer
-	if input.ScheduledType == api.ST_TYPE_TIMING {
+	// check timer, cycletimer or crontimer
+	switch input.ScheduledType {
+	case api.ST_TYPE_TIMING:
 		input.Timer, err = checkTimerCreateInput(input.Timer)
-	} else {
+	case api.ST_TYPE_CYCLE:
 		input.CycleTimer, err = checkCycleTimerCreateInput(input.CycleTimer)
+	case api.ST_TYPE_CRON:
+		input.CronTimer, err = checkCronTimerCreateInput(input.CronTimer)
 	}
 	if err != nil {
 		return input, httperrors.NewInputParameterError("%v", err)
 	}
+	input.OperationParams, err = stm.validateOperationParams(ctx, userCred, input.Operation, input.OperationParams)
+	if err != nil {
+		return input, err
+	}
 	return input, nil
 }
 
+func (stm *SScheduledTaskManager) validateOperationParams(ctx context.Context, userCred mcclient.TokenCredential, operation string, params *api.ScheduledTaskOperationParams) (*api.ScheduledTaskOperationParams, error) {
+	if params == nil {
+		params = &api.ScheduledTaskOperationParams{}
+	}
+	switch operation {
+	case api.ST_RESOURCE_OPERATION_SNAPSHOT:
+		if params.SnapshotRetention < 0 {
+			return nil, httperrors.NewInputParameterError("snapshot_retention should not be negative")
+		}
+		return &api.ScheduledTaskOperationParams{
+			SnapshotRetention: params.SnapshotRetention,
+			WithMemory:        params.WithMemory,
+		}, nil
+	case api.ST_RESOURCE_OPERATION_CHANGE_CONFIG:
+		if len(params.InstanceType) == 0 && params.VcpuCount <= 0 && len(params.VmemSize) == 0 {
+			return nil, httperrors.NewMissingParameterError("instance_type or vcpu_count or vmem_size")
+		}
+		return &api.ScheduledTaskOperationParams{
+			InstanceType: params.InstanceType,
+			VcpuCount:    params.VcpuCount,
+			VmemSize:     params.VmemSize,
+			AutoStart:    params.AutoStart,
+		}, nil
+	case api.ST_RESOURCE_OPERATION_RUN_SCRIPT:
+		if len(params.ScriptId) == 0 {
+			return nil, httperrors.NewMissingParameterError("script_id")
+		}
+		session := auth.GetSession(ctx, userCred, "", "")
+		script, err := devtool.DevToolScripts.Get(session, params.ScriptId, nil)
+		if err != nil {
+			return nil, httperrors.NewResourceNotFoundError2("script", params.ScriptId)
+		}
+		scriptId, _ := script.GetString("id")
+		return &api.ScheduledTaskOperationParams{ScriptId: scriptId}, nil
+	}
+	return nil, nil
+}
+
 func (st *SScheduledTask) PerformEnable(ctx context.Context, userCred mcclient.TokenCredential,
 	query jsonutils.JSONObject, input apis.PerformEnableInput) (jsonutils.JSONObject, error) {
 	err := db.EnabledPerformEnable(st, ctx, userCred, true)
@@ -247,6 +299,15 @@ func (st *SScheduledTask) PostCreate(ctx context.Context, userCred mcclient.Toke
 		}
 		st.SetWeekDays(input.CycleTimer.WeekDays)
 		st.SetMonthDays(input.CycleTimer.MonthDays)
+	case api.ST_TYPE_CRON:
+		st.STimer = STimer{
+			Type:      api.TIMER_TYPE_CRON,
+			CronExpr:  input.CronTimer.Expression,
+			Timezone:  input.CronTimer.Timezone,
+			StartTime: input.CronTimer.StartTime,
+			EndTime:   input.CronTimer.EndTime,
+			NextTime:  time.Time{},
+		}
 	}
 	st.Update(time.Time{})
 	st.Status = api.ST_STATUS_READY
@@ -343,6 +404,13 @@ func (st *SScheduledTask) PerformSetLabels(ctx context.Context, userCred mcclien
 }
 
 func (st *SScheduledTask) PerformTrigger(ctx context.Context, userCred mcclient.TokenCredential, query jsonutils.JSONObject, input api.ScheduledTaskTriggerInput) (jsonutils.JSONObject, error) {
+	ok, err := st.IsExecuted()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, httperrors.NewForbiddenError("This scheduled task is being executed now, please try later")
+	}
 	go func() {
 		log.Infof("start to execute scheduled task '%s'", st.Id)
 		err := st.Execute(ctx, userCred)
@@ -375,7 +443,7 @@ func (st *SScheduledTask) CustomizeDelete(ctx context.Context, userCred mcclient
 
 func (st *SScheduledTask) Action(ctx context.Context, userCred mcclient.TokenCredential) SAction {
 	session := auth.GetSession(ctx, userCred, "", "")
-	return Action.ResourceOperation(st.ResourceOperation()).Session(session)
+	return Action.ResourceOperation(st.ResourceOperation()).Session(session).Params(st.OperationParams).NamePrefix(st.Name).TaskId(st.Id)
 }
 
 func (st *SScheduledTask) ExecuteNotify(ctx context.Context, userCred mcclient.TokenCredential, name string) {
@@ -389,19 +457,32 @@ func (st *SScheduledTask) ExecuteNotify(ctx context.Context, userCred mcclient.T
 	})
 }
 
-func (st *SScheduledTask) Execute(ctx context.Context, userCred mcclient.TokenCredential) (err error) {
+// startActivity creates the activity of this execution, the execution
+// is rejected if the previous one has not finished yet.
+func (st *SScheduledTask) startActivity(ctx context.Context) (*SScheduledTaskActivity, error) {
+	lockman.LockObject(ctx, st)
+	defer lockman.ReleaseObject(ctx, st)
+
 	exec, err := st.IsExecuted()
 	if err != nil {
-		return errors.Wrap(err, "unable to check if scheduled task is executed")
+		return nil, errors.Wrap(err, "unable to check if scheduled task is executed")
 	}
 	if exec {
 		_, err := st.NewActivity(ctx, true)
-		return err
+		return nil, err
 	}
-	sa, err := st.NewActivity(ctx, false)
+	return st.NewActivity(ctx, false)
+}
+
+func (st *SScheduledTask) Execute(ctx context.Context, userCred mcclient.TokenCredential) (err error) {
+	sa, err := st.startActivity(ctx)
 	if err != nil {
 		return err
 	}
+	if sa == nil {
+		log.Infof("scheduled task '%s' is rejected because the previous execution has not finished", st.Id)
+		return nil
+	}
 	over := false
 	defer func() {
 		if !over && err != nil {
@@ -446,14 +527,9 @@ func (st *SScheduledTask) Execute(ctx context.Context, userCred mcclient.TokenCr
 	}
 
 	maxLimit := 20
-	type result struct {
-		id      string
-		succeed bool
-		reason  string
-	}
 	workerQueue := make(chan struct{}, maxLimit)
-	results := make([]result, len(ids))
-	log.Infof("servers to scheduledtask: %v", ids)
+	results := make(api.ScheduledTaskActivityResults, len(ids))
+	log.Infof("%ss to scheduledtask: %v", st.ResourceType, ids)
 	for i, id := range ids {
 		workerQueue <- struct{}{}
 		go func(n int, id string) {
@@ -462,7 +538,7 @@ func (st *SScheduledTask) Execute(ctx context.Context, userCred mcclient.TokenCr
 			if ok {
 				st.ExecuteNotify(ctx, userCred, res[id])
 			}
-			results[n] = result{id, ok, reason}
+			results[n] = api.ScheduledTaskActivityResult{Id: id, Name: res[id], Succeed: ok, Reason: reason}
 			<-workerQueue
 		}(i, id)
 	}
@@ -470,28 +546,25 @@ func (st *SScheduledTask) Execute(ctx context.Context, userCred mcclient.TokenCr
 	for i := 0; i < maxLimit; i++ {
 		workerQueue <- struct{}{}
 	}
+	over = true
 	failedReasons := make([]string, 0, 1)
 	succeedIds := make([]string, 0, 1)
-	displayStrs := res
 	for _, ret := range results {
-		if ret.succeed {
-			succeedIds = append(succeedIds, displayStrs[ret.id])
+		if ret.Succeed {
+			succeedIds = append(succeedIds, ret.Name)
 			continue
 		}
-		failedReasons = append(failedReasons, fmt.Sprintf("\t%s: %s", displayStrs[ret.id], ret.reason))
+		failedReasons = append(failedReasons, fmt.Sprintf("\t%s: %s", ret.Name, ret.Reason))
 	}
 	if len(failedReasons) == 0 {
-		sa.Succeed()
-		return nil
+		return sa.SetResults(api.ST_ACTIVITY_STATUS_SUCCEED, "", results)
 	}
 	if len(failedReasons) == len(ids) {
 		reason := fmt.Sprintf("All %ss %s failed:\n%s", st.ResourceType, st.Operation, strings.Join(failedReasons, ";\n"))
-		sa.Fail(reason)
-		return nil
+		return sa.SetResults(api.ST_ACTIVITY_STATUS_FAILED, reason, results)
 	}
 	reason := fmt.Sprintf("Some %ss %s successfully:\n\t%s\n\n. Some %ss %s failed:\n%s", st.ResourceType, st.Operation, strings.Join(succeedIds, ";"), st.ResourceType, st.Operation, strings.Join(failedReasons, ";\n"))
-	sa.PartFail(reason)
-	return nil
+	return sa.SetResults(api.ST_ACTIVITY_STATUS_PART_SUCCEED, reason, results)
 }
 
 func (st *SScheduledTask) NewActivity(ctx context.Context, reject bool) (*SScheduledTaskActivity, error) {
@@ -574,14 +647,17 @@ func (stm *SScheduledTaskManager) Timer(ctx context.Context, userCred mcclient.T
 					return
 				}
 			}
-			err := st.Execute(ctx, userCred)
-			if err != nil {
-				log.Errorf("unable to execute scheduled task '%s'", st.Id)
-			}
+			// move to the next time before executing so that the following
+			// rounds of timer won't pick up this scheduled task again
 			st.Update(timeScope.End)
-			err = stm.TableSpec().InsertOrUpdate(ctx, &st)
+			err := stm.TableSpec().InsertOrUpdate(ctx, &st)
 			if err != nil {
 				log.Errorf("update Scheduled task whose id is %s error: %s", st.Id, err.Error())
+				return
+			}
+			err = st.Execute(ctx, userCred)
+			if err != nil {
+				log.Errorf("unable to execute scheduled task '%s': %v", st.Id, err)
 			}
 		}(ctx)
 	}
@@ -594,6 +670,9 @@ func (stm *SScheduledTaskManager) Timer(ctx context.Context, userCred mcclient.T
 func init() {
 	Register(ResourceServer, compute.Servers.ResourceManager)
 	Register(ResourceCloudAccount, compute.Cloudaccounts)
+	Register(ResourceDisk, compute.Disks)
+	Register(ResourceDBInstance, compute.DBInstance)
+	Register(ResourceElasticcache, compute.ElasticCache.ResourceManager)
 }
 
 // Modules describe the correspondence between Resource and modulebase.ResourceManager,
@@ -611,19 +690,32 @@ type Resource string
 const (
 	ResourceServer       Resource = api.ST_RESOURCE_SERVER
 	ResourceCloudAccount Resource = api.ST_RESOURCE_CLOUDACCOUNT
+	ResourceDisk         Resource = api.ST_RESOURCE_DISK
+	ResourceDBInstance   Resource = api.ST_RESOURCE_DBINSTANCE
+	ResourceElasticcache Resource = api.ST_RESOURCE_ELASTICCACHE
 )
 
 // ResourceOperation describe the operation for onecloud resource like create, update, delete and so on.
 type ResourceOperation struct {
-	Resource      Resource
-	Operation     string
+	Resource  Resource
+	Operation string
+	// Action is the perform action of resource, it is derived from Operation if empty
+	Action        string
 	StatusSuccess []string
 	Fail          []ResourceOperationFail
 	Params        *jsonutils.JSONDict
+	// ParamsFunc generates params from the operation params of scheduled task
+	ParamsFunc func(r SAction) *jsonutils.JSONDict
+	// Request replaces performing Action on the resource, it returns the manager
+	// and id of the resource whose status should be waited for
+	Request func(r SAction, id string, params *jsonutils.JSONDict) (*modulebase.ResourceManager, string, error)
+	// Cleanup is called after the operation succeeded
+	Cleanup func(r SAction, id string) error
 }
 
 type ResourceOperationFail struct {
-	Status   string
+	Status string
+	// LogEvent is the action of opslog recording fail reason, the status is used as reason if empty
 	LogEvent string
 }
 
@@ -654,6 +746,134 @@ func init() {
 			{comapi.VM_STOP_FAILED, db.ACT_STOP_FAIL},
 		},
 	}
+	ServerSnapshot = ResourceOperation{
+		Resource:      ResourceServer,
+		Operation:     api.ST_RESOURCE_OPERATION_SNAPSHOT,
+		Action:        "instance-snapshot",
+		StatusSuccess: []string{comapi.VM_RUNNING, comapi.VM_READY},
+		Fail: []ResourceOperationFail{
+			{comapi.VM_INSTANCE_SNAPSHOT_FAILED, ""},
+			{comapi.VM_SNAPSHOT_FAILED, ""},
+		},
+		ParamsFunc: func(r SAction) *jsonutils.JSONDict {
+			params := jsonutils.NewDict()
+			params.Set("generate_name", jsonutils.NewString(r.snapshotName()))
+			params.Set("__meta__", r.snapshotMetadata())
+			if r.params != nil && r.params.WithMemory {
+				params.Set("with_memory", jsonutils.JSONTrue)
+			}
+			return params
+		},
+		Cleanup: cleanupSnapshots(compute.InstanceSnapshots, "server_id", nil),
+	}
+	ServerChangeConfig = ResourceOperation{
+		Resource:      ResourceServer,
+		Operation:     api.ST_RESOURCE_OPERATION_CHANGE_CONFIG,
+		Action:        "change-config",
+		StatusSuccess: []string{comapi.VM_READY, comapi.VM_RUNNING},
+		Fail: []ResourceOperationFail{
+			{comapi.VM_CHANGE_FLAVOR_FAIL, db.ACT_CHANGE_FLAVOR_FAIL},
+		},
+		ParamsFunc: func(r SAction) *jsonutils.JSONDict {
+			input := comapi.ServerChangeConfigInput{}
+			if r.params != nil {
+				input.InstanceType = r.params.InstanceType
+				input.VcpuCount = r.params.VcpuCount
+				input.VmemSize = r.params.VmemSize
+				input.AutoStart = r.params.AutoStart
+			}
+			return jsonutils.Marshal(input).(*jsonutils.JSONDict)
+		},
+	}
+	ServerRunScript = ResourceOperation{
+		Resource:  ResourceServer,
+		Operation: api.ST_RESOURCE_OPERATION_RUN_SCRIPT,
+		// the script is applied asynchronously by devtool, so succeed means the script
+		// has been applied to server and its result can be found in script apply records.
+		Request: func(r SAction, id string, params *jsonutils.JSONDict) (*modulebase.ResourceManager, string, error) {
+			if r.params == nil || len(r.params.ScriptId) == 0 {
+				return nil, "", errors.Error("no script specified")
+			}
+			params.Set("server_id", jsonutils.NewString(id))
+			_, err := devtool.DevToolScripts.PerformAction(r.session, r.params.ScriptId, "apply", params)
+			return nil, "", err
+		},
+	}
+	DiskSnapshot = ResourceOperation{
+		Resource:      ResourceDisk,
+		Operation:     api.ST_RESOURCE_OPERATION_SNAPSHOT,
+		StatusSuccess: []string{comapi.SNAPSHOT_READY},
+		Fail: []ResourceOperationFail{
+			{comapi.SNAPSHOT_FAILED, ""},
+		},
+		ParamsFunc: func(r SAction) *jsonutils.JSONDict {
+			params := jsonutils.NewDict()
+			params.Set("generate_name", jsonutils.NewString(r.snapshotName()))
+			params.Set("__meta__", r.snapshotMetadata())
+			return params
+		},
+		Request: func(r SAction, id string, params *jsonutils.JSONDict) (*modulebase.ResourceManager, string, error) {
+			params.Set("disk_id", jsonutils.NewString(id))
+			snapshot, err := compute.Snapshots.Create(r.session, params)
+			if err != nil {
+				return nil, "", err
+			}
+			snapshotId, _ := snapshot.GetString("id")
+			return &compute.Snapshots, snapshotId, nil
+		},
+		Cleanup: cleanupSnapshots(compute.Snapshots, "disk_id", map[string]jsonutils.JSONObject{
+			"is_instance_snapshot": jsonutils.JSONFalse,
+		}),
+	}
+	DBInstanceStart = ResourceOperation{
+		Resource:      ResourceDBInstance,
+		Operation:     api.ST_RESOURCE_OPERATION_START,
+		StatusSuccess: []string{comapi.DBINSTANCE_RUNNING},
+		Fail: []ResourceOperationFail{
+			{comapi.DBINSTANCE_START_FAILED, db.ACT_START_FAIL},
+		},
+	}
+	DBInstanceStop = ResourceOperation{
+		Resource:      ResourceDBInstance,
+		Operation:     api.ST_RESOURCE_OPERATION_STOP,
+		StatusSuccess: []string{comapi.DBINSTANCE_STOPPED},
+		Fail: []ResourceOperationFail{
+			{comapi.DBINSTANCE_STOP_FAILED, db.ACT_STOP_FAIL},
+		},
+	}
+	DBInstanceRestart = ResourceOperation{
+		Resource:      ResourceDBInstance,
+		Operation:     api.ST_RESOURCE_OPERATION_RESTART,
+		Action:        "reboot",
+		StatusSuccess: []string{comapi.DBINSTANCE_RUNNING},
+		Fail: []ResourceOperationFail{
+			{comapi.DBINSTANCE_REBOOT_FAILED, ""},
+		},
+	}
+	ElasticcacheRestart = ResourceOperation{
+		Resource:      ResourceElasticcache,
+		Operation:     api.ST_RESOURCE_OPERATION_RESTART,
+		StatusSuccess: []string{comapi.ELASTIC_CACHE_STATUS_RUNNING},
+		Fail: []ResourceOperationFail{
+			{comapi.ELASTIC_CACHE_STATUS_RESTART_FAILED, ""},
+		},
+	}
+	ElasticcacheStart = ResourceOperation{
+		Resource:      ResourceElasticcache,
+		Operation:     api.ST_RESOURCE_OPERATION_START,
+		StatusSuccess: []string{comapi.ELASTIC_CACHE_STATUS_RUNNING},
+		Fail: []ResourceOperationFail{
+			{comapi.ELASTIC_CACHE_STATUS_START_FAILED, db.ACT_START_FAIL},
+		},
+	}
+	ElasticcacheStop = ResourceOperation{
+		Resource:      ResourceElasticcache,
+		Operation:     api.ST_RESOURCE_OPERATION_STOP,
+		StatusSuccess: []string{comapi.ELASTIC_CACHE_STATUS_STOPPED},
+		Fail: []ResourceOperationFail{
+			{comapi.ELASTIC_CACHE_STATUS_STOP_FAILED, db.ACT_STOP_FAIL},
+		},
+	}
 	paramsAccoutSync := jsonutils.NewDict()
 	paramsAccoutSync.Add(jsonutils.JSONTrue, "full_sync")
 	paramsAccoutSync.Add(jsonutils.JSONFalse, "force")
@@ -662,11 +882,24 @@ func init() {
 		Operation: api.ST_RESOURCE_OPERATION_SYNC,
 		Params:    paramsAccoutSync,
 	}
-	ResourceOperationMap = map[string]ResourceOperation{
-		fmt.Sprintf("%s.%s", ResourceServer, api.ST_RESOURCE_OPERATION_START):      ServerStart,
-		fmt.Sprintf("%s.%s", ResourceServer, api.ST_RESOURCE_OPERATION_STOP):       ServerStop,
-		fmt.Sprintf("%s.%s", ResourceServer, api.ST_RESOURCE_OPERATION_RESTART):    ServerRestart,
-		fmt.Sprintf("%s.%s", ResourceCloudAccount, api.ST_RESOURCE_OPERATION_SYNC): CloudAccountSync,
+	ResourceOperationMap = make(map[string]ResourceOperation)
+	for _, oper := range []ResourceOperation{
+		ServerStart,
+		ServerStop,
+		ServerRestart,
+		ServerSnapshot,
+		ServerChangeConfig,
+		ServerRunScript,
+		DiskSnapshot,
+		DBInstanceStart,
+		DBInstanceStop,
+		DBInstanceRestart,
+		ElasticcacheStart,
+		ElasticcacheStop,
+		ElasticcacheRestart,
+		CloudAccountSync,
+	} {
+		ResourceOperationMap[fmt.Sprintf("%s.%s", oper.Resource, oper.Operation)] = oper
 	}
 }
 
@@ -674,10 +907,56 @@ var (
 	ServerStart          ResourceOperation
 	ServerStop           ResourceOperation
 	ServerRestart        ResourceOperation
+	ServerSnapshot       ResourceOperation
+	ServerChangeConfig   ResourceOperation
+	ServerRunScript      ResourceOperation
+	DiskSnapshot         ResourceOperation
+	DBInstanceStart      ResourceOperation
+	DBInstanceStop       ResourceOperation
+	DBInstanceRestart    ResourceOperation
+	ElasticcacheStart    ResourceOperation
+	ElasticcacheStop     ResourceOperation
+	ElasticcacheRestart  ResourceOperation
 	CloudAccountSync     ResourceOperation
 	ResourceOperationMap map[string]ResourceOperation
 )
 
+// cleanupSnapshots deletes the oldest snapshots created by the scheduled task,
+// which are recognized by the task id in their metadata, so that at most
+// SnapshotRetention snapshots are kept for each resource.
+func cleanupSnapshots(manager modulebase.ResourceManager, resourceKey string, filters map[string]jsonutils.JSONObject) func(r SAction, id string) error {
+	return func(r SAction, id string) error {
+		if r.params == nil || r.params.SnapshotRetention <= 0 {
+			return nil
+		}
+		params := jsonutils.NewDict()
+		for k, v := range filters {
+			params.Set(k, v)
+		}
+		params.Set(resourceKey, jsonutils.NewString(id))
+		params.Set("tags", jsonutils.Marshal(tagutils.TTagSet{
+			{Key: api.ST_METADATA_SCHEDULED_TASK_ID, Value: r.taskId},
+		}))
+		params.Set("order_by", jsonutils.NewString("created_at"))
+		params.Set("order", jsonutils.NewString("desc"))
+		params.Set("scope", jsonutils.NewString("system"))
+		params.Set("limit", jsonutils.NewInt(0))
+		params.Set("details", jsonutils.JSONFalse)
+		ret, err := manager.List(r.session, params)
+		if err != nil {
+			return errors.Wrap(err, "list snapshots")
+		}
+		for i := r.params.SnapshotRetention; i < len(ret.Data); i++ {
+			snapshotId, _ := ret.Data[i].GetString("id")
+			_, err := manager.Delete(r.session, snapshotId, nil)
+			if err != nil {
+				return errors.Wrapf(err, "delete snapshot %s", snapshotId)
+			}
+		}
+		return nil
+	}
+}
+
 // Action itself is meaningless, a meaningful Action is generated by
 // calling Resource, Operation, Session and DefaultParams.
 // A example:
@@ -686,9 +965,12 @@ var Action = SAction{timeout: 5 * time.Minute}
 
 // SAction encapsulates action to for onecloud resources
 type SAction struct {
-	operation ResourceOperation
-	session   *mcclient.ClientSession
-	timeout   time.Duration
+	operation  ResourceOperation
+	session    *mcclient.ClientSession
+	timeout    time.Duration
+	params     *api.ScheduledTaskOperationParams
+	namePrefix string
+	taskId     string
 }
 
 func (r SAction) ResourceOperation(oper ResourceOperation) SAction {
@@ -706,6 +988,33 @@ func (r SAction) Timeout(time time.Duration) SAction {
 	return r
 }
 
+func (r SAction) Params(params *api.ScheduledTaskOperationParams) SAction {
+	r.params = params
+	return r
+}
+
+// NamePrefix sets the prefix of name of resources created by action, such as snapshots
+func (r SAction) NamePrefix(prefix string) SAction {
+	r.namePrefix = prefix
+	return r
+}
+
+// TaskId sets the id of scheduled task which is recorded in metadata of resources created by action
+func (r SAction) TaskId(taskId string) SAction {
+	r.taskId = taskId
+	return r
+}
+
+func (r SAction) snapshotMetadata() *jsonutils.JSONDict {
+	meta := jsonutils.NewDict()
+	meta.Set(api.ST_METADATA_SCHEDULED_TASK_ID, jsonutils.NewString(r.taskId))
+	return meta
+}
+
+func (r SAction) snapshotName() string {
+	return fmt.Sprintf("%s-%s", r.namePrefix, time.Now().Format("20060102150405"))
+}
+
 type WrapperListOptions struct {
 	options.BaseListOptions
 }
@@ -732,31 +1041,57 @@ func (r SAction) List(opts *WrapperListOptions) (map[string]string, error) {
 	return out, nil
 }
 
+func (r SAction) requestParams() *jsonutils.JSONDict {
+	params := jsonutils.NewDict()
+	if r.operation.Params != nil {
+		params.Update(r.operation.Params)
+	}
+	if r.operation.ParamsFunc != nil {
+		params.Update(r.operation.ParamsFunc(r))
+	}
+	return params
+}
+
 func (r SAction) Apply(id string) (success bool, failReason string) {
-	success = true
 	resourceManager, ok := Modules[r.operation.Resource]
 	if !ok {
 		return false, fmt.Sprintf("no such resource '%s' in Modules", r.operation.Resource)
 	}
-	var requestFunc func(session *mcclient.ClientSession, id string, params *jsonutils.JSONDict) error
-
-	action := utils.CamelSplit(r.operation.Operation, "-")
-	requestFunc = func(session *mcclient.ClientSession, id string, params *jsonutils.JSONDict) error {
-		if params == nil {
-			params = jsonutils.NewDict()
+	requestFunc := r.operation.Request
+	if requestFunc == nil {
+		action := r.operation.Action
+		if len(action) == 0 {
+			action = utils.CamelSplit(r.operation.Operation, "-")
+		}
+		requestFunc = func(r SAction, id string, params *jsonutils.JSONDict) (*modulebase.ResourceManager, string, error) {
+			_, err := resourceManager.PerformAction(r.session, id, action, params)
+			return &resourceManager, id, err
 		}
-		_, err := resourceManager.PerformAction(session, id, action, params)
-		return err
 	}
-	err := requestFunc(r.session, id, r.operation.Params)
+	statusManager, statusId, err := requestFunc(r, id, r.requestParams())
 	if err != nil {
-		clientErr, _ := err.(*httputils.JSONClientError)
-		return false, clientErr.Details
+		if clientErr, ok := err.(*httputils.JSONClientError); ok {
+			return false, clientErr.Details
+		}
+		return false, err.Error()
+	}
+	if len(r.operation.StatusSuccess) > 0 && statusManager != nil {
+		success, failReason = r.waitStatus(*statusManager, statusId)
+		if !success {
+			return
+		}
 	}
-	if len(r.operation.StatusSuccess) == 0 {
-		return true, ""
+	if r.operation.Cleanup != nil {
+		err := r.operation.Cleanup(r, id)
+		if err != nil {
+			return false, fmt.Sprintf("%s succeed but cleanup failed: %s", r.operation.Operation, err.Error())
+		}
 	}
-	// wait for status
+	return true, ""
+}
+
+func (r SAction) waitStatus(resourceManager modulebase.ResourceManager, id string) (success bool, failReason string) {
+	success = true
 	timer := time.NewTimer(r.timeout)
 	ticker := time.NewTicker(10 * time.Second)
 	defer func() {
@@ -768,7 +1103,7 @@ func (r SAction) Apply(id string) (success bool, failReason string) {
 		default:
 			ret, e := resourceManager.GetSpecific(r.session, id, "status", nil)
 			if e != nil {
-				log.Errorf("fail to exec resouce(%s.%s).GetStatus: %s", r.operation.Resource, id, e.Error())
+				log.Errorf("fail to exec resouce(%s.%s).GetStatus: %s", resourceManager.GetKeyword(), id, e.Error())
 				<-ticker.C
 				continue
 			}
@@ -780,6 +1115,9 @@ func (r SAction) Apply(id string) (success bool, failReason string) {
 				if status != fail.Status {
 					continue
 				}
+				if len(fail.LogEvent) == 0 {
+					return false, fmt.Sprintf("%s %s", resourceManager.GetKeyword(), status)
+				}
 				params := jsonutils.NewDict()
 				params.Add(jsonutils.NewString(id), "obj_id")
 				params.Add(jsonutils.NewStringArray([]string{fail.LogEvent}), "action")
@@ -791,9 +1129,8 @@ func (r SAction) Apply(id string) (success bool, failReason string) {
 					continue
 				}
 				if len(events.Data) == 0 {
-					log.Errorf("These is no opslog about action '%s' for %s.%s: %s", fail.LogEvent, r.operation.Resource, id, err.Error())
-					<-ticker.C
-					continue
+					log.Errorf("These is no opslog about action '%s' for %s.%s", fail.LogEvent, resourceManager.GetKeyword(), id)
+					return false, fmt.Sprintf("%s %s", resourceManager.GetKeyword(), status)
 				}
 				reason, _ := events.Data[0].GetString("notes")
 				return false, reason
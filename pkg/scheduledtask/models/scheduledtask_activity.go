@@ -55,6 +55,8 @@ type SScheduledTaskActivity struct {
 	StartTime       time.Time `list:"user"`
 	EndTime         time.Time `list:"user"`
 	Reason          string    `charset:"utf8" list:"user"`
+	// Results records the result of every target resource
+	Results *api.ScheduledTaskActivityResults `nullable:"true" list:"user"`
 }
 
 func (sam *SScheduledTaskActivityManager) InitializeData() error {
@@ -156,6 +158,18 @@ func (sa *SScheduledTaskActivity) SetResult(status, reason string) error {
 	return err
 }
 
+// SetResults sets the final status of activity with the results of all target resources
+func (sa *SScheduledTaskActivity) SetResults(status, reason string, results api.ScheduledTaskActivityResults) error {
+	_, err := db.Update(sa, func() error {
+		sa.Status = status
+		sa.Reason = reason
+		sa.Results = &results
+		sa.EndTime = time.Now()
+		return nil
+	})
+	return err
+}
+
 func (sa *SScheduledTaskActivity) Fail(reason string) error {
 	return sa.SetResult(api.ST_ACTIVITY_STATUS_FAILED, reason)
 }
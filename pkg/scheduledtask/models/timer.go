@@ -21,12 +21,15 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	// timezone of cron timer should be resolved even if zoneinfo is absent in the host
+	_ "time/tzdata"
 
 	"yunion.io/x/log"
 
 	api "yunion.io/x/onecloud/pkg/apis/scheduledtask"
 	"yunion.io/x/onecloud/pkg/i18n"
 	"yunion.io/x/onecloud/pkg/util/bitmap"
+	"yunion.io/x/onecloud/pkg/util/cronexpr"
 )
 
 type STimer struct {
@@ -40,6 +43,10 @@ type STimer struct {
 	WeekDays uint8 `nullable:"false"`
 	// 0-31 0 is unlimited
 	MonthDays uint32 `nullable:"false"`
+	// standard cron expression of cron timer
+	CronExpr string `width:"128" charset:"ascii"`
+	// IANA time zone name in which CronExpr is evaluated, empty is UTC
+	Timezone string `width:"64" charset:"ascii"`
 
 	// StartTime represent the start time of this timer
 	StartTime time.Time
@@ -55,6 +62,10 @@ func (st *STimer) Update(now time.Time) {
 	if now.IsZero() {
 		now = time.Now()
 	}
+	if st.Type == api.TIMER_TYPE_CRON {
+		st.updateCron(now)
+		return
+	}
 	if !now.Before(st.EndTime) {
 		st.IsExpired = true
 		return
@@ -109,6 +120,39 @@ func (st *STimer) Update(now time.Time) {
 	}
 }
 
+// updateCron is Update of cron timer whose EndTime is optional
+func (st *STimer) updateCron(now time.Time) {
+	if !st.EndTime.IsZero() && !now.Before(st.EndTime) {
+		st.IsExpired = true
+		return
+	}
+	if now.Before(st.StartTime) {
+		now = st.StartTime
+	}
+	if !st.NextTime.IsZero() && !st.NextTime.Before(now) {
+		return
+	}
+	expr, err := cronexpr.Parse(st.CronExpr)
+	if err != nil {
+		log.Errorf("invalid cron expression %q: %v", st.CronExpr, err)
+		st.IsExpired = true
+		return
+	}
+	loc, err := time.LoadLocation(st.Timezone)
+	if err != nil {
+		log.Errorf("invalid timezone %q: %v", st.Timezone, err)
+		st.IsExpired = true
+		return
+	}
+	next := expr.Next(now.In(loc))
+	log.Debugf("The final NextTime: %s", next)
+	if next.IsZero() || (!st.EndTime.IsZero() && next.After(st.EndTime)) {
+		st.IsExpired = true
+		return
+	}
+	st.NextTime = next
+}
+
 // MonthDaySum calculate the number of month's days
 func (st *STimer) MonthDaySum(t time.Time) int {
 	year, month := t.Year(), t.Month()
@@ -155,6 +199,16 @@ func (st *STimer) CycleTimerDetails() api.CycleTimerDetails {
 	return out
 }
 
+func (st *STimer) CronTimerDetails() api.CronTimerDetails {
+	return api.CronTimerDetails{
+		Expression: st.CronExpr,
+		Timezone:   st.Timezone,
+		NextTime:   st.NextTime,
+		StartTime:  st.StartTime,
+		EndTime:    st.EndTime,
+	}
+}
+
 func checkTimerCreateInput(in api.TimerCreateInput) (api.TimerCreateInput, error) {
 	now := time.Now()
 	if now.After(in.ExecTime) {
@@ -194,6 +248,12 @@ func (st *STimer) descChinese(zone *time.Location) string {
 	switch st.Type {
 	case api.TIMER_TYPE_ONCE:
 		return fmt.Sprintf("单次 %s触发", st.StartTime.In(zone).Format(format))
+	case api.TIMER_TYPE_CRON:
+		desc := fmt.Sprintf("cron表达式【%s】(%s)触发", st.CronExpr, st.timezoneDesc())
+		if st.EndTime.IsZero() {
+			return desc
+		}
+		return fmt.Sprintf("%s 有效时间为%s至%s", desc, st.StartTime.In(zone).Format(format), st.EndTime.In(zone).Format(format))
 	case api.TIMER_TYPE_DAY:
 		prefix = "每天"
 	case api.TIMER_TYPE_WEEK:
@@ -214,6 +274,13 @@ func (st *STimer) descChinese(zone *time.Location) string {
 	return fmt.Sprintf("%s %s触发 有效时间为%s至%s", prefix, st.hourMinutesDesc(zone), st.StartTime.In(zone).Format(format), st.EndTime.In(zone).Format(format))
 }
 
+func (st *STimer) timezoneDesc() string {
+	if len(st.Timezone) == 0 {
+		return "UTC"
+	}
+	return st.Timezone
+}
+
 func (st *STimer) hourMinutesDesc(zone *time.Location) string {
 	now := time.Now()
 	t := time.Date(now.Year(), now.Month(), now.Day(), st.Hour, st.Minute, 0, 0, time.UTC).In(zone)
@@ -232,6 +299,8 @@ func (st *STimer) descEnglish(zone *time.Location) string {
 		detail = st.weekDaysDesc(zone)
 	case api.TIMER_TYPE_MONTH:
 		detail = st.monthDaysDesc(zone)
+	case api.TIMER_TYPE_CRON:
+		detail = fmt.Sprintf("cron '%s' in %s", st.CronExpr, st.timezoneDesc())
 	}
 	if st.EndTime.IsZero() {
 		return detail
@@ -325,3 +394,27 @@ func checkCycleTimerCreateInput(in api.CycleTimerCreateInput) (api.CycleTimerCre
 	}
 	return in, nil
 }
+
+func checkCronTimerCreateInput(in api.CronTimerCreateInput) (api.CronTimerCreateInput, error) {
+	now := time.Now()
+	expr, err := cronexpr.Parse(in.Expression)
+	if err != nil {
+		return in, err
+	}
+	loc, err := time.LoadLocation(in.Timezone)
+	if err != nil {
+		return in, fmt.Errorf("unknown timezone %s", in.Timezone)
+	}
+	if !in.EndTime.IsZero() && now.After(in.EndTime) {
+		return in, fmt.Errorf("end_time is earlier than now")
+	}
+	from := now
+	if in.StartTime.After(from) {
+		from = in.StartTime
+	}
+	next := expr.Next(from.In(loc))
+	if next.IsZero() || (!in.EndTime.IsZero() && next.After(in.EndTime)) {
+		return in, fmt.Errorf("cron expression %q never triggers before end_time", in.Expression)
+	}
+	return in, nil
+}
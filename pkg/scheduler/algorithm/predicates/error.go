@@ -43,6 +43,8 @@ const (
 	ErrBaremetalHasAlreadyBeenOccupied        = `baremetal has already been occupied`
 	ErrPrepaidHostOccupied                    = `prepaid host occupied`
 	ErrHostCpuArchitectureNotMatch            = `host cpu architecture not match`
+	ErrHostNumaTopologyNotReported            = `host NUMA topology not reported`
+	ErrNoEnoughNumaNodeResource               = `no enough resource on NUMA nodes`
 
 	ErrUnknown = `unknown error`
 )
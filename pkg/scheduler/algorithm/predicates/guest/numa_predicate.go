@@ -0,0 +1,81 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package guest
+
+import (
+	"context"
+
+	"yunion.io/x/onecloud/pkg/scheduler/algorithm/predicates"
+	"yunion.io/x/onecloud/pkg/scheduler/core"
+)
+
+// NumaPredicate checks whether vcpus and memory of guest with NUMA enabled
+// fit into free NUMA nodes of host, it returns how many guests fit.
+type NumaPredicate struct {
+	predicates.BasePredicate
+}
+
+func (f *NumaPredicate) Name() string {
+	return "host_numa"
+}
+
+func (f *NumaPredicate) Clone() core.FitPredicate {
+	return &NumaPredicate{}
+}
+
+func (f *NumaPredicate) PreExecute(ctx context.Context, u *core.Unit, cs []core.Candidater) (bool, error) {
+	if !u.GetHypervisorDriver().DoScheduleCPUFilter() {
+		return false, nil
+	}
+
+	data := u.SchedData()
+	if data.ServerConfigs == nil || !data.EnableNuma {
+		return false, nil
+	}
+	if data.Ncpu <= 0 || data.Memory <= 0 {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (f *NumaPredicate) Execute(ctx context.Context, u *core.Unit, c core.Candidater) (bool, []core.PredicateFailureReason, error) {
+	h := predicates.NewPredicateHelper(f, u, c)
+	d := u.SchedData()
+
+	nodes := c.Getter().NumaNodes()
+	if nodes == nil || len(nodes.Nodes) == 0 {
+		h.Exclude(predicates.ErrHostNumaTopologyNotReported)
+		return h.GetResult()
+	}
+
+	free := nodes.Copy()
+	capacity := int64(0)
+	for {
+		placed, err := free.Allocate(d.Ncpu, d.Memory)
+		if err != nil {
+			break
+		}
+		free.Use(placed)
+		capacity++
+	}
+	if capacity == 0 {
+		h.Exclude(predicates.ErrNoEnoughNumaNodeResource)
+		return h.GetResult()
+	}
+
+	h.SetCapacity(capacity)
+	return h.GetResult()
+}
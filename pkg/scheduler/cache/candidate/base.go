@@ -179,6 +179,10 @@ func (b baseHostGetter) OvnCapable() bool {
 	return false
 }
 
+func (b baseHostGetter) NumaNodes() *computemodels.SHostNumaNodes {
+	return nil
+}
+
 func (b baseHostGetter) ResourceType() string {
 	return reviseResourceType(b.h.ResourceType)
 }
@@ -15,6 +15,7 @@
 package candidate
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -97,6 +98,10 @@ func (h *hostGetter) OvnCapable() bool {
 	return len(h.h.OvnVersion) > 0
 }
 
+func (h *hostGetter) NumaNodes() *computemodels.SHostNumaNodes {
+	return h.h.NumaNodes
+}
+
 type HostDesc struct {
 	*BaseHostDesc
 
@@ -137,6 +142,9 @@ type HostDesc struct {
 	IsMaintenance             bool              `json:"is_maintenance"`
 	GuestReservedResource     *ReservedResource `json:"guest_reserved_resource"`
 	GuestReservedResourceUsed *ReservedResource `json:"guest_reserved_used"`
+
+	// free capacity of NUMA nodes, nil if host doesn't report NUMA topology
+	NumaNodes *computemodels.SHostNumaNodes `json:"numa_nodes"`
 }
 
 type ReservedResource struct {
@@ -816,6 +824,7 @@ func (b *HostBuilder) buildOne(host *computemodels.SHost) (interface{}, error) {
 		//b.fillResidentGroups,
 		b.fillMetadata,
 		b.fillCPUIOLoads,
+		b.fillNumaNodes,
 	}
 
 	for _, f := range fillFuncs {
@@ -1051,6 +1060,27 @@ func (b *HostBuilder) fillCPUIOLoads(desc *HostDesc, host *computemodels.SHost)
 	return nil
 }
 
+func (b *HostBuilder) fillNumaNodes(desc *HostDesc, host *computemodels.SHost) error {
+	if host.SysInfo == nil || !host.SysInfo.Contains("numa_nodes") {
+		return nil
+	}
+	guests := []computemodels.SGuest{}
+	for _, gst := range b.hostGuests[host.Id] {
+		guest := gst.(computemodels.SGuest)
+		if IsGuestRunning(guest) || IsGuestCreating(guest) ||
+			(IsGuestPendingDelete(guest) && !o.Options.IgnoreFakeDeletedGuests) {
+			guests = append(guests, guest)
+		}
+	}
+	nodes, err := host.GetNumaNodesFree(context.Background(), guests)
+	if err != nil {
+		log.Errorf("Get host %s free NUMA nodes: %v", host.GetName(), err)
+		return nil
+	}
+	desc.NumaNodes = nodes
+	return nil
+}
+
 func (b *HostBuilder) loadByName(hostID, name string) *float64 {
 	if b.cpuIOLoads == nil {
 		return nil
@@ -80,6 +80,7 @@ type CandidatePropertyGetter interface {
 	Storages() []*api.CandidateStorage
 	Networks() []*api.CandidateNetwork
 	OvnCapable() bool
+	NumaNodes() *computemodels.SHostNumaNodes
 	Status() string
 	HostStatus() string
 	Enabled() bool
@@ -468,6 +468,20 @@ func (mr *MockCandidatePropertyGetterMockRecorder) Networks() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Networks", reflect.TypeOf((*MockCandidatePropertyGetter)(nil).Networks))
 }
 
+// NumaNodes mocks base method
+func (m *MockCandidatePropertyGetter) NumaNodes() *models.SHostNumaNodes {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NumaNodes")
+	ret0, _ := ret[0].(*models.SHostNumaNodes)
+	return ret0
+}
+
+// NumaNodes indicates an expected call of NumaNodes
+func (mr *MockCandidatePropertyGetterMockRecorder) NumaNodes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NumaNodes", reflect.TypeOf((*MockCandidatePropertyGetter)(nil).NumaNodes))
+}
+
 // OvnCapable mocks base method
 func (m *MockCandidatePropertyGetter) OvnCapable() bool {
 	m.ctrl.T.Helper()
@@ -0,0 +1,237 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cronexpr
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	ErrInvalidExpr = errors.Error("invalid cron expression")
+
+	// search at most 5 years ahead, e.g. 0 0 29 2 1 only matches once in years
+	maxSearchYears = 5
+)
+
+// SCronExpr is a parsed standard 5 fields cron expression:
+//
+//	minute hour day-of-month month day-of-week
+//
+// Every field accepts '*', single values, ranges 'a-b', lists 'a,b' and
+// steps '*/n' or 'a-b/n'. Month and day-of-week also accept three letters
+// names like JAN or MON, '?' is an alias of '*' for day-of-month and
+// day-of-week. Both 0 and 7 stands for Sunday. Like vixie cron, when both
+// day-of-month and day-of-week are restricted, a day matching either of
+// them matches.
+type SCronExpr struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	domStar bool
+	dowStar bool
+}
+
+type sField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = sField{name: "minute", min: 0, max: 59}
+	hourField   = sField{name: "hour", min: 0, max: 23}
+	domField    = sField{name: "day of month", min: 1, max: 31}
+	monthField  = sField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = sField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	macros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse parses a standard cron expression or one of the macros
+// @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly.
+func Parse(spec string) (*SCronExpr, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@") {
+		expanded, ok := macros[strings.ToLower(spec)]
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidExpr, "unknown macro %q", spec)
+		}
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Wrapf(ErrInvalidExpr, "expect 5 fields, got %d", len(fields))
+	}
+	var (
+		expr SCronExpr
+		err  error
+	)
+	if expr.minute, _, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if expr.hour, _, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if expr.dom, expr.domStar, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if expr.month, _, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if expr.dow, expr.dowStar, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// 7 is an alias of Sunday
+	if expr.dow&(1<<7) != 0 {
+		expr.dow = expr.dow&^(1<<7) | 1
+	}
+	return &expr, nil
+}
+
+func (f sField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Wrapf(ErrInvalidExpr, "invalid %s %q", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, errors.Wrapf(ErrInvalidExpr, "%s %d out of range [%d, %d]", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// parse returns the bitmap of the values matched by field and whether the field is unrestricted
+func (f sField) parse(field string) (uint64, bool, error) {
+	var (
+		bits uint64
+		star bool
+	)
+	for _, item := range strings.Split(field, ",") {
+		rangeStr, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			rangeStr = item[:i]
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, false, errors.Wrapf(ErrInvalidExpr, "invalid step in %s %q", f.name, item)
+			}
+			step = n
+		}
+		var start, end int
+		switch {
+		case rangeStr == "*" || (rangeStr == "?" && (f.name == domField.name || f.name == dowField.name)):
+			start, end = f.min, f.max
+			if f.name == dowField.name {
+				// avoid matching Sunday twice by 0 and 7
+				end = 6
+			}
+			if step == 1 {
+				star = true
+			}
+		case strings.Contains(rangeStr, "-"):
+			parts := strings.SplitN(rangeStr, "-", 2)
+			var err error
+			if start, err = f.value(parts[0]); err != nil {
+				return 0, false, err
+			}
+			if end, err = f.value(parts[1]); err != nil {
+				return 0, false, err
+			}
+			if start > end {
+				return 0, false, errors.Wrapf(ErrInvalidExpr, "invalid range in %s %q", f.name, item)
+			}
+		default:
+			var err error
+			if start, err = f.value(rangeStr); err != nil {
+				return 0, false, err
+			}
+			end = start
+			if step > 1 {
+				// a/n means from a to max
+				end = f.max
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, star, nil
+}
+
+func (e *SCronExpr) dayMatches(t time.Time) bool {
+	domMatch := e.dom&(1<<uint(t.Day())) != 0
+	dowMatch := e.dow&(1<<uint(t.Weekday())) != 0
+	if e.domStar || e.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the earliest time after t matching the expression, it
+// is evaluated in the location of t. Zero time is returned if no time
+// matches in the next few years.
+func (e *SCronExpr) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	yearLimit := t.Year() + maxSearchYears
+
+	for t.Year() <= yearLimit {
+		if e.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !e.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if e.hour&(1<<uint(t.Hour())) == 0 {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if !next.After(t) {
+				// the clock was turned back because of daylight saving time
+				next = t.Truncate(time.Hour).Add(time.Hour)
+			}
+			t = next
+			continue
+		}
+		if e.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
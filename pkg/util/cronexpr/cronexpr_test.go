@@ -0,0 +1,99 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cronexpr
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	layout := "2006-01-02 15:04"
+	cases := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2023-03-01 10:00", "2023-03-01 10:01"},
+		{"30 9 * * MON-FRI", "2023-03-03 09:30", "2023-03-06 09:30"},
+		{"0 18 * * 1-5", "2023-03-03 17:59", "2023-03-03 18:00"},
+		{"*/15 * * * *", "2023-03-01 10:16", "2023-03-01 10:30"},
+		{"5/20 * * * *", "2023-03-01 10:46", "2023-03-01 11:05"},
+		{"0 0 31 * *", "2023-04-01 00:00", "2023-05-31 00:00"},
+		{"0 0 29 feb ?", "2023-01-01 00:00", "2024-02-29 00:00"},
+		{"0 12 1 * 0", "2023-03-02 00:00", "2023-03-05 12:00"},
+		{"0 0 * * 7", "2023-03-01 00:00", "2023-03-05 00:00"},
+		{"0 8,20 * * *", "2023-03-01 09:00", "2023-03-01 20:00"},
+		{"@monthly", "2023-12-15 00:00", "2024-01-01 00:00"},
+		{"@hourly", "2023-12-31 23:30", "2024-01-01 00:00"},
+	}
+	for _, c := range cases {
+		expr, err := Parse(c.expr)
+		if err != nil {
+			t.Errorf("parse %q: %v", c.expr, err)
+			continue
+		}
+		from, _ := time.Parse(layout, c.from)
+		got := expr.Next(from).Format(layout)
+		if got != c.want {
+			t.Errorf("%q next of %s: want %s got %s", c.expr, c.from, c.want, got)
+		}
+	}
+}
+
+func TestNextLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*3600)
+	expr, err := Parse("0 9 * * *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	from := time.Date(2023, 3, 1, 2, 0, 0, 0, time.UTC)
+	got := expr.Next(from.In(loc))
+	want := time.Date(2023, 3, 2, 1, 0, 0, 0, time.UTC)
+	if !got.Equal(want) {
+		t.Errorf("want %s got %s", want, got.UTC())
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	expr, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if next := expr.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expect zero time, got %s", next)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"? * * * *",
+		"@every",
+		"* * * foo *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expect error for %q", expr)
+		}
+	}
+}
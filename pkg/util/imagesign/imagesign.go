@@ -0,0 +1,373 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagesign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	SIGNATURE_FORMAT_COSIGN = "cosign"
+	SIGNATURE_FORMAT_X509   = "x509"
+
+	COSIGN_SIGNATURE_TYPE = "cosign container image signature"
+
+	DIGEST_PREFIX_SHA256 = "sha256:"
+)
+
+var SIGNATURE_FORMATS = []string{
+	SIGNATURE_FORMAT_COSIGN,
+	SIGNATURE_FORMAT_X509,
+}
+
+var (
+	ErrInvalidSignature  = errors.Error("invalid signature")
+	ErrUntrustedSigner   = errors.Error("signer is not trusted")
+	ErrDigestMismatch    = errors.Error("signed digest mismatch")
+	ErrUnsupportedFormat = errors.Error("unsupported signature format")
+	ErrInvalidEncoding   = errors.Error("invalid encoding")
+)
+
+// SSignature is a detached signature of an image
+type SSignature struct {
+	Format string
+	// base64 encoded signature
+	Signature string
+	// base64 encoded cosign simple signing payload, which carries the
+	// digest of the image, only for the cosign format
+	Payload string
+	// PEM encoded signing certificate followed by the intermediates,
+	// optional for the cosign format
+	Certificate string
+}
+
+type SCosignPayload struct {
+	Critical SCosignCritical        `json:"critical"`
+	Optional map[string]interface{} `json:"optional,omitempty"`
+}
+
+type SCosignCritical struct {
+	Identity struct {
+		DockerReference string `json:"docker-reference"`
+	} `json:"identity"`
+	Image struct {
+		DockerManifestDigest string `json:"docker-manifest-digest"`
+	} `json:"image"`
+	Type string `json:"type"`
+}
+
+// NewCosignPayload returns the simple signing payload for an image of the
+// given hex encoded SHA-256 digest
+func NewCosignPayload(reference string, digest string) ([]byte, error) {
+	payload := SCosignPayload{}
+	payload.Critical.Identity.DockerReference = reference
+	payload.Critical.Image.DockerManifestDigest = DIGEST_PREFIX_SHA256 + NormalizeDigest(digest)
+	payload.Critical.Type = COSIGN_SIGNATURE_TYPE
+	return json.Marshal(payload)
+}
+
+// NormalizeDigest strips the algorithm prefix and lowers the case of a hex
+// encoded SHA-256 digest
+func NormalizeDigest(digest string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(digest), DIGEST_PREFIX_SHA256))
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// DecodePEM accepts PEM data as is or encoded in base64, which is how a
+// certificate travels in HTTP headers
+func DecodePEM(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "-----BEGIN") {
+		return []byte(s), nil
+	}
+	b, err := decodeBase64(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode base64")
+	}
+	if !strings.HasPrefix(strings.TrimSpace(string(b)), "-----BEGIN") {
+		return nil, errors.Wrap(ErrInvalidEncoding, "not PEM encoded")
+	}
+	return b, nil
+}
+
+// STrustStore holds the public keys and the root certificates trusted to
+// sign images
+type STrustStore struct {
+	keys  map[string]crypto.PublicKey
+	roots *x509.CertPool
+
+	rootCount int
+}
+
+func NewTrustStore() *STrustStore {
+	return &STrustStore{
+		keys:  make(map[string]crypto.PublicKey),
+		roots: x509.NewCertPool(),
+	}
+}
+
+// LoadTrustStore loads the PEM encoded public keys in keysDir, each named
+// after its file name, and the root certificates in caFile
+func LoadTrustStore(keysDir string, caFile string) (*STrustStore, error) {
+	store := NewTrustStore()
+	if len(keysDir) > 0 {
+		files, err := ioutil.ReadDir(keysDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ReadDir %s", keysDir)
+		}
+		for _, fi := range files {
+			if fi.IsDir() {
+				continue
+			}
+			ext := filepath.Ext(fi.Name())
+			if ext != ".pem" && ext != ".pub" {
+				continue
+			}
+			fn := filepath.Join(keysDir, fi.Name())
+			data, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return nil, errors.Wrapf(err, "ReadFile %s", fn)
+			}
+			err = store.AddPublicKey(strings.TrimSuffix(fi.Name(), ext), data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "AddPublicKey %s", fn)
+			}
+		}
+	}
+	if len(caFile) > 0 {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "ReadFile %s", caFile)
+		}
+		err = store.AddRootCertificates(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "AddRootCertificates %s", caFile)
+		}
+	}
+	return store, nil
+}
+
+func (s *STrustStore) AddPublicKey(name string, pemData []byte) error {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return errors.Wrap(ErrInvalidEncoding, "no PEM block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "ParsePKIXPublicKey")
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return errors.Wrapf(errors.ErrNotSupported, "public key type %T", key)
+	}
+	s.keys[name] = key
+	return nil
+}
+
+func (s *STrustStore) AddRootCertificates(pemData []byte) error {
+	certs, err := parseCertificates(pemData)
+	if err != nil {
+		return err
+	}
+	for i := range certs {
+		s.roots.AddCert(certs[i])
+	}
+	s.rootCount += len(certs)
+	return nil
+}
+
+func (s *STrustStore) IsEmpty() bool {
+	return len(s.keys) == 0 && s.rootCount == 0
+}
+
+func parseCertificates(pemData []byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0)
+	for {
+		var block *pem.Block
+		block, pemData = pem.Decode(pemData)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "ParseCertificate")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.Wrap(ErrInvalidEncoding, "no certificate found")
+	}
+	return certs, nil
+}
+
+// Verify checks that sig is a valid signature of a trusted signer over the
+// image of the hex encoded SHA-256 digest and returns the signer, which is
+// the name of the trusted key or the subject of the signing certificate
+func (s *STrustStore) Verify(sig SSignature, digest string) (string, error) {
+	digest = NormalizeDigest(digest)
+	digestBytes, err := hex.DecodeString(digest)
+	if err != nil || len(digestBytes) != sha256.Size {
+		return "", errors.Wrapf(ErrInvalidEncoding, "invalid sha256 digest %q", digest)
+	}
+	sigBytes, err := decodeBase64(sig.Signature)
+	if err != nil || len(sigBytes) == 0 {
+		return "", errors.Wrap(ErrInvalidSignature, "decode signature")
+	}
+	switch sig.Format {
+	case SIGNATURE_FORMAT_COSIGN:
+		payload, err := decodeBase64(sig.Payload)
+		if err != nil || len(payload) == 0 {
+			return "", errors.Wrap(ErrInvalidSignature, "decode payload")
+		}
+		err = checkCosignPayload(payload, digest)
+		if err != nil {
+			return "", err
+		}
+		if len(sig.Certificate) > 0 {
+			return s.verifyByCertificate(sig.Certificate, payload, sigBytes, false)
+		}
+		return s.verifyByKeys(payload, sigBytes, false)
+	case SIGNATURE_FORMAT_X509:
+		if len(sig.Certificate) == 0 {
+			return s.verifyByKeys(digestBytes, sigBytes, true)
+		}
+		return s.verifyByCertificate(sig.Certificate, digestBytes, sigBytes, true)
+	default:
+		return "", errors.Wrapf(ErrUnsupportedFormat, "%q", sig.Format)
+	}
+}
+
+func checkCosignPayload(payload []byte, digest string) error {
+	p := SCosignPayload{}
+	err := json.Unmarshal(payload, &p)
+	if err != nil {
+		return errors.Wrap(ErrInvalidSignature, "unmarshal payload")
+	}
+	if p.Critical.Type != COSIGN_SIGNATURE_TYPE {
+		return errors.Wrapf(ErrInvalidSignature, "unexpected payload type %q", p.Critical.Type)
+	}
+	signed := p.Critical.Image.DockerManifestDigest
+	if !strings.HasPrefix(signed, DIGEST_PREFIX_SHA256) || NormalizeDigest(signed) != digest {
+		return errors.Wrapf(ErrDigestMismatch, "payload digest %s", signed)
+	}
+	return nil
+}
+
+func (s *STrustStore) verifyByKeys(msg []byte, sigBytes []byte, prehashed bool) (string, error) {
+	names := make([]string, 0, len(s.keys))
+	for name := range s.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if verifySignature(s.keys[name], msg, sigBytes, prehashed) {
+			return name, nil
+		}
+	}
+	return "", errors.Wrap(ErrUntrustedSigner, "no trusted key matches the signature")
+}
+
+func (s *STrustStore) verifyByCertificate(certPEM string, msg []byte, sigBytes []byte, prehashed bool) (string, error) {
+	pemData, err := DecodePEM(certPEM)
+	if err != nil {
+		return "", errors.Wrap(err, "decode certificate")
+	}
+	certs, err := parseCertificates(pemData)
+	if err != nil {
+		return "", errors.Wrap(err, "parse certificate")
+	}
+	leaf := certs[0]
+	if !verifySignature(leaf.PublicKey, msg, sigBytes, prehashed) {
+		return "", errors.Wrap(ErrInvalidSignature, "signature does not match the certificate")
+	}
+	if s.rootCount == 0 {
+		return "", errors.Wrap(ErrUntrustedSigner, "no trusted root certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         s.roots,
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err = leaf.Verify(opts)
+	if err != nil {
+		return "", errors.Wrapf(ErrUntrustedSigner, "verify certificate: %s", err)
+	}
+	return certificateSigner(leaf), nil
+}
+
+func certificateSigner(cert *x509.Certificate) string {
+	if len(cert.Subject.CommonName) > 0 {
+		return cert.Subject.CommonName
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	return fmt.Sprintf("serial:%s", cert.SerialNumber.String())
+}
+
+// verifySignature verifies the signature over msg, which is the SHA-256
+// digest itself if prehashed
+func verifySignature(key crypto.PublicKey, msg []byte, sigBytes []byte, prehashed bool) bool {
+	hashed := msg
+	if !prehashed {
+		sum := sha256.Sum256(msg)
+		hashed = sum[:]
+	}
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(pub, hashed, sigBytes)
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed, sigBytes) == nil {
+			return true
+		}
+		return rsa.VerifyPSS(pub, crypto.SHA256, hashed, sigBytes, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, msg, sigBytes)
+	}
+	return false
+}
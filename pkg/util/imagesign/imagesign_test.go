@@ -0,0 +1,178 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagesign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+var testImage = []byte("golden image content")
+
+func testDigest() (string, []byte) {
+	sum := sha256.Sum256(testImage)
+	return hex.EncodeToString(sum[:]), sum[:]
+}
+
+func publicKeyPEM(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %s", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func newCertificate(t *testing.T, cn string, pub crypto.PublicKey, parent *x509.Certificate, signer crypto.Signer, isCA bool) (*x509.Certificate, []byte) {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if isCA {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %s", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestVerifyCosign(t *testing.T) {
+	digest, _ := testDigest()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	payload, err := NewCosignPayload("golden/centos", digest)
+	if err != nil {
+		t.Fatalf("NewCosignPayload: %s", err)
+	}
+	sum := sha256.Sum256(payload)
+	sigBytes, _ := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	sig := SSignature{
+		Format:    SIGNATURE_FORMAT_COSIGN,
+		Signature: base64.StdEncoding.EncodeToString(sigBytes),
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+	}
+
+	store := NewTrustStore()
+	if err := store.AddPublicKey("other", publicKeyPEM(t, &other.PublicKey)); err != nil {
+		t.Fatalf("AddPublicKey: %s", err)
+	}
+	if _, err := store.Verify(sig, digest); errors.Cause(err) != ErrUntrustedSigner {
+		t.Errorf("want ErrUntrustedSigner, got %v", err)
+	}
+	if err := store.AddPublicKey("release", publicKeyPEM(t, &key.PublicKey)); err != nil {
+		t.Fatalf("AddPublicKey: %s", err)
+	}
+	signer, err := store.Verify(sig, DIGEST_PREFIX_SHA256+digest)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if signer != "release" {
+		t.Errorf("want signer release, got %s", signer)
+	}
+
+	otherSum := sha256.Sum256([]byte("tampered image"))
+	if _, err := store.Verify(sig, hex.EncodeToString(otherSum[:])); errors.Cause(err) != ErrDigestMismatch {
+		t.Errorf("want ErrDigestMismatch, got %v", err)
+	}
+}
+
+func TestVerifyX509(t *testing.T) {
+	digest, digestBytes := testDigest()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caCert, caPEM := newCertificate(t, "Image Signing CA", &caKey.PublicKey, nil, caKey, true)
+	leafKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, leafPEM := newCertificate(t, "release-team", &leafKey.PublicKey, caCert, caKey, false)
+
+	sigBytes, err := rsa.SignPKCS1v15(rand.Reader, leafKey, crypto.SHA256, digestBytes)
+	if err != nil {
+		t.Fatalf("SignPKCS1v15: %s", err)
+	}
+	sig := SSignature{
+		Format:      SIGNATURE_FORMAT_X509,
+		Signature:   base64.StdEncoding.EncodeToString(sigBytes),
+		Certificate: base64.StdEncoding.EncodeToString(leafPEM),
+	}
+
+	store := NewTrustStore()
+	if _, err := store.Verify(sig, digest); errors.Cause(err) != ErrUntrustedSigner {
+		t.Errorf("want ErrUntrustedSigner without roots, got %v", err)
+	}
+	if err := store.AddRootCertificates(caPEM); err != nil {
+		t.Fatalf("AddRootCertificates: %s", err)
+	}
+	signer, err := store.Verify(sig, digest)
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if signer != "release-team" {
+		t.Errorf("want signer release-team, got %s", signer)
+	}
+
+	otherSum := sha256.Sum256([]byte("tampered image"))
+	if _, err := store.Verify(sig, hex.EncodeToString(otherSum[:])); errors.Cause(err) != ErrInvalidSignature {
+		t.Errorf("want ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerifyX509PublicKey(t *testing.T) {
+	digest, digestBytes := testDigest()
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	sig := SSignature{
+		Format:    SIGNATURE_FORMAT_X509,
+		Signature: base64.RawStdEncoding.EncodeToString(ed25519.Sign(priv, digestBytes)),
+	}
+	store := NewTrustStore()
+	if err := store.AddPublicKey("ed25519", publicKeyPEM(t, pub)); err != nil {
+		t.Fatalf("AddPublicKey: %s", err)
+	}
+	if signer, err := store.Verify(sig, digest); err != nil || signer != "ed25519" {
+		t.Errorf("Verify: signer %q error %v", signer, err)
+	}
+	sig.Format = "pgp"
+	if _, err := store.Verify(sig, digest); errors.Cause(err) != ErrUnsupportedFormat {
+		t.Errorf("want ErrUnsupportedFormat, got %v", err)
+	}
+}
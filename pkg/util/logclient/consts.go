@@ -118,8 +118,9 @@ const (
 	ACT_OPEN_PUBLIC_CONNECTION  = "open_public_connection"
 	ACT_CLOSE_PUBLIC_CONNECTION = "close_public_connection"
 
-	ACT_IMAGE_SAVE  = "image_save"
-	ACT_IMAGE_PROBE = "image_probe"
+	ACT_IMAGE_SAVE       = "image_save"
+	ACT_IMAGE_PROBE      = "image_probe"
+	ACT_IMAGE_EXPORT_OCI = "image_export_oci"
 
 	ACT_AUTHENTICATE = "authenticate"
 	ACT_LOGOUT       = "logout"
@@ -231,6 +232,9 @@ const (
 
 	ACT_ENCRYPTION = "encrypt"
 
+	ACT_ADD_SIGNATURE    = "add_signature"
+	ACT_VERIFY_SIGNATURE = "verify_signature"
+
 	ACT_CONSOLE = "console"
 	ACT_WEBSSH  = "webssh"
 )
@@ -0,0 +1,127 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netutils2
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	ErrInvalidIPV6Addr   = errors.Error("invalid ipv6 address")
+	ErrInvalidIPV6Prefix = errors.Error("invalid ipv6 prefix")
+)
+
+// ParseIPV6Addr parses s as an IPv6 address, IPv4 and IPv4-mapped addresses
+// are rejected
+func ParseIPV6Addr(s string) (net.IP, error) {
+	s = strings.TrimSpace(s)
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil || !strings.Contains(s, ":") {
+		return nil, errors.Wrap(ErrInvalidIPV6Addr, s)
+	}
+	return ip.To16(), nil
+}
+
+// ParseIPV6Prefix parses s like fd00:1::/64 and returns the network address
+// and mask length
+func ParseIPV6Prefix(s string) (net.IP, int8, error) {
+	ip, ipnet, err := net.ParseCIDR(strings.TrimSpace(s))
+	if err != nil || ip.To4() != nil {
+		return nil, 0, errors.Wrap(ErrInvalidIPV6Prefix, s)
+	}
+	masklen, _ := ipnet.Mask.Size()
+	return ipnet.IP.To16(), int8(masklen), nil
+}
+
+// IPV6NetAddr returns the network address of ip with mask length masklen
+func IPV6NetAddr(ip net.IP, masklen int8) net.IP {
+	return ip.To16().Mask(net.CIDRMask(int(masklen), 128))
+}
+
+// IPV6LastAddr returns the last address of the subnet ip/masklen
+func IPV6LastAddr(ip net.IP, masklen int8) net.IP {
+	mask := net.CIDRMask(int(masklen), 128)
+	last := make(net.IP, net.IPv6len)
+	for i, b := range ip.To16() {
+		last[i] = b | ^mask[i]
+	}
+	return last
+}
+
+// IPV6StepUp returns the address next to ip, it wraps around at the end of
+// address space
+func IPV6StepUp(ip net.IP) net.IP {
+	next := make(net.IP, net.IPv6len)
+	copy(next, ip.To16())
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// IPV6StepDown returns the address previous to ip, it wraps around at the
+// start of address space
+func IPV6StepDown(ip net.IP) net.IP {
+	prev := make(net.IP, net.IPv6len)
+	copy(prev, ip.To16())
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
+
+// IPV6AddrRange is a range of IPv6 addresses with both ends inclusive
+type IPV6AddrRange struct {
+	start net.IP
+	end   net.IP
+}
+
+func NewIPV6AddrRange(start, end net.IP) IPV6AddrRange {
+	start, end = start.To16(), end.To16()
+	if bytes.Compare(start, end) > 0 {
+		start, end = end, start
+	}
+	return IPV6AddrRange{
+		start: start,
+		end:   end,
+	}
+}
+
+func (r IPV6AddrRange) StartIp() net.IP {
+	return r.start
+}
+
+func (r IPV6AddrRange) EndIp() net.IP {
+	return r.end
+}
+
+func (r IPV6AddrRange) Contains(ip net.IP) bool {
+	ip = ip.To16()
+	return bytes.Compare(r.start, ip) <= 0 && bytes.Compare(ip, r.end) <= 0
+}
+
+func (r IPV6AddrRange) IsOverlap(r2 IPV6AddrRange) bool {
+	return bytes.Compare(r.start, r2.end) <= 0 && bytes.Compare(r2.start, r.end) <= 0
+}
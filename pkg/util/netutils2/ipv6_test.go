@@ -0,0 +1,88 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netutils2
+
+import (
+	"testing"
+)
+
+func TestParseIPV6(t *testing.T) {
+	for _, s := range []string{"fd00::1", "2001:db8::ffff"} {
+		if _, err := ParseIPV6Addr(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "10.0.0.1", "::ffff:10.0.0.1", "fd00::/64"} {
+		if _, err := ParseIPV6Addr(s); err == nil {
+			t.Errorf("%s: want error", s)
+		}
+	}
+
+	netAddr, masklen, err := ParseIPV6Prefix("fd00:1::5/64")
+	if err != nil {
+		t.Fatalf("ParseIPV6Prefix: %v", err)
+	}
+	if netAddr.String() != "fd00:1::" || masklen != 64 {
+		t.Errorf("want fd00:1::/64, got %s/%d", netAddr, masklen)
+	}
+	if _, _, err := ParseIPV6Prefix("10.0.0.0/8"); err == nil {
+		t.Errorf("ipv4 prefix: want error")
+	}
+}
+
+func TestIPV6Addr(t *testing.T) {
+	ip, _ := ParseIPV6Addr("fd00:1::ff")
+	cases := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"NetAddr", IPV6NetAddr(ip, 120).String(), "fd00:1::"},
+		{"LastAddr", IPV6LastAddr(ip, 64).String(), "fd00:1::ffff:ffff:ffff:ffff"},
+		{"StepUp", IPV6StepUp(ip).String(), "fd00:1::100"},
+		{"StepDown", IPV6StepDown(IPV6StepUp(ip)).String(), "fd00:1::ff"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%s: want %s, got %s", c.name, c.want, c.got)
+		}
+	}
+	if ip.String() != "fd00:1::ff" {
+		t.Errorf("ip modified: %s", ip)
+	}
+}
+
+func TestIPV6AddrRange(t *testing.T) {
+	parse := func(s string) IPV6AddrRange {
+		netAddr, masklen, _ := ParseIPV6Prefix(s)
+		return NewIPV6AddrRange(IPV6LastAddr(netAddr, masklen), netAddr)
+	}
+	r0 := parse("fd00:1::/64")
+	r1 := parse("fd00:1::/96")
+	r2 := parse("fd00:2::/64")
+	if r0.StartIp().String() != "fd00:1::" {
+		t.Errorf("want start fd00:1::, got %s", r0.StartIp())
+	}
+	if !r0.IsOverlap(r1) || !r1.IsOverlap(r0) {
+		t.Errorf("want %v overlapping %v", r0, r1)
+	}
+	if r0.IsOverlap(r2) {
+		t.Errorf("want %v not overlapping %v", r0, r2)
+	}
+	ip, _ := ParseIPV6Addr("fd00:1::1:0:0")
+	if !r0.Contains(ip) || r1.Contains(ip) {
+		t.Errorf("contains %s: want true, false", ip)
+	}
+}
@@ -0,0 +1,380 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ociregistry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	ErrInvalidReference = errors.Error("invalid reference")
+	ErrDigestMismatch   = errors.Error("digest mismatch")
+	ErrDiskNotFound     = errors.Error("disk image not found")
+	ErrUnauthorized     = errors.Error("unauthorized")
+
+	maxManifestSize = 4 * 1024 * 1024
+)
+
+// SClient talks to the registry of a single repository, it obtains a token
+// from the authorization service of the registry on demand
+type SClient struct {
+	client   *http.Client
+	username string
+	password string
+
+	authorization string
+}
+
+func NewClient(client *http.Client, username, password string) *SClient {
+	return &SClient{
+		client:   client,
+		username: username,
+		password: password,
+	}
+}
+
+func (cli *SClient) url(ref *SReference, format string, args ...interface{}) string {
+	return fmt.Sprintf("https://%s/v2/%s/%s", ref.endpoint(), ref.Repository, fmt.Sprintf(format, args...))
+}
+
+// request sends the request once more after authorization if the registry
+// asks for it, body is rewound before sending it again
+func (cli *SClient) request(ctx context.Context, method string, reqUrl string, header http.Header, body io.ReadSeeker, size int64, scope string) (*http.Response, error) {
+	for authorized := false; ; authorized = true {
+		var reader io.Reader
+		if body != nil {
+			_, err := body.Seek(0, io.SeekStart)
+			if err != nil {
+				return nil, errors.Wrap(err, "rewind body")
+			}
+			reader = body
+		}
+		req, err := http.NewRequestWithContext(ctx, method, reqUrl, reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewRequest")
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if body != nil {
+			req.ContentLength = size
+		}
+		if len(cli.authorization) > 0 {
+			req.Header.Set("Authorization", cli.authorization)
+		}
+		resp, err := cli.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s %s", method, reqUrl)
+		}
+		if resp.StatusCode != http.StatusUnauthorized || authorized {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		err = cli.authorize(ctx, challenge, scope)
+		if err != nil {
+			return nil, errors.Wrap(err, "authorize")
+		}
+	}
+}
+
+func (cli *SClient) authorize(ctx context.Context, challenge string, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if len(cli.username) == 0 {
+			return errors.Wrap(ErrUnauthorized, "registry requires username and password")
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(cli.username, cli.password)
+		cli.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+	default:
+		return errors.Wrapf(ErrUnauthorized, "unsupported challenge %q", challenge)
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(params["realm"]) == 0 {
+		return errors.Wrapf(ErrUnauthorized, "invalid realm of challenge %q", challenge)
+	}
+	query := realm.Query()
+	if service := params["service"]; len(service) > 0 {
+		query.Set("service", service)
+	}
+	if len(params["scope"]) > 0 {
+		scope = params["scope"]
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "NewRequest")
+	}
+	if len(cli.username) > 0 {
+		req.SetBasicAuth(cli.username, cli.password)
+	}
+	resp, err := cli.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request token from %s", realm.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrapf(ErrUnauthorized, "request token from %s: %s", realm.Host, resp.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token)
+	if err != nil {
+		return errors.Wrap(err, "decode token")
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	if len(token.Token) == 0 {
+		return errors.Wrapf(ErrUnauthorized, "empty token from %s", realm.Host)
+	}
+	cli.authorization = "Bearer " + token.Token
+	return nil
+}
+
+// parseChallenge parses a WWW-Authenticate header like
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	pos := strings.IndexByte(challenge, ' ')
+	if pos < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:pos], challenge[pos+1:]
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+func pullScope(ref *SReference) string {
+	return fmt.Sprintf("repository:%s:pull", ref.Repository)
+}
+
+func pushScope(ref *SReference) string {
+	return fmt.Sprintf("repository:%s:pull,push", ref.Repository)
+}
+
+func responseError(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	err := errors.Errorf("%s %s: %s %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return errors.Wrap(errors.ErrNotFound, err.Error())
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Wrap(ErrUnauthorized, err.Error())
+	}
+	return err
+}
+
+func Digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// GetManifest fetches the manifest of the reference, an image index is
+// resolved to the manifest of linux on arch
+func (cli *SClient) GetManifest(ctx context.Context, ref *SReference, arch string) (*SManifest, error) {
+	manifest, err := cli.fetchManifest(ctx, ref, ref.Manifest(), ref.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if !manifest.IsIndex() {
+		return manifest, nil
+	}
+	desc := manifest.selectPlatform(arch)
+	if desc == nil {
+		return nil, errors.Wrapf(errors.ErrNotFound, "no manifest for linux/%s in %s", arch, ref)
+	}
+	manifest, err = cli.fetchManifest(ctx, ref, desc.Digest, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.IsIndex() {
+		return nil, errors.Errorf("nested image index %s in %s", desc.Digest, ref)
+	}
+	return manifest, nil
+}
+
+func (cli *SClient) fetchManifest(ctx context.Context, ref *SReference, reference string, digest string) (*SManifest, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	resp, err := cli.request(ctx, http.MethodGet, cli.url(ref, "manifests/%s", reference), header, nil, 0, pullScope(ref))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifest")
+	}
+	if len(digest) > 0 && Digest(data) != digest {
+		return nil, errors.Wrapf(ErrDigestMismatch, "manifest %s", digest)
+	}
+	manifest := &SManifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode manifest")
+	}
+	if len(manifest.MediaType) == 0 {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	return manifest, nil
+}
+
+// GetBlob opens the blob of the descriptor, reading it fails at the end if
+// the content does not match the digest
+func (cli *SClient) GetBlob(ctx context.Context, ref *SReference, desc SDescriptor) (io.ReadCloser, error) {
+	if !strings.HasPrefix(desc.Digest, "sha256:") {
+		return nil, errors.Errorf("unsupported digest %s", desc.Digest)
+	}
+	resp, err := cli.request(ctx, http.MethodGet, cli.url(ref, "blobs/%s", desc.Digest), nil, nil, 0, pullScope(ref))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return &sVerifyReader{
+		ReadCloser: resp.Body,
+		hash:       sha256.New(),
+		digest:     desc.Digest,
+	}, nil
+}
+
+type sVerifyReader struct {
+	io.ReadCloser
+
+	hash   hash.Hash
+	digest string
+}
+
+func (r *sVerifyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if digest := fmt.Sprintf("sha256:%x", r.hash.Sum(nil)); digest != r.digest {
+			return n, errors.Wrapf(ErrDigestMismatch, "blob %s got %s", r.digest, digest)
+		}
+	}
+	return n, err
+}
+
+// PushBlob uploads the blob in a single request unless the repository
+// already has it
+func (cli *SClient) PushBlob(ctx context.Context, ref *SReference, body io.ReadSeeker, size int64, digest string) error {
+	resp, err := cli.request(ctx, http.MethodHead, cli.url(ref, "blobs/%s", digest), nil, nil, 0, pushScope(ref))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = cli.request(ctx, http.MethodPost, cli.url(ref, "blobs/uploads/"), nil, nil, 0, pushScope(ref))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return errors.Wrapf(err, "invalid upload location %s", resp.Header.Get("Location"))
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err = cli.request(ctx, http.MethodPut, location.String(), header, body, size, pushScope(ref))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// PutManifest pushes the manifest under the tag of the reference and
+// returns its digest
+func (cli *SClient) PutManifest(ctx context.Context, ref *SReference, manifest *SManifest) (string, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", errors.Wrap(err, "encode manifest")
+	}
+	header := http.Header{}
+	header.Set("Content-Type", manifest.MediaType)
+	resp, err := cli.request(ctx, http.MethodPut, cli.url(ref, "manifests/%s", ref.Manifest()), header, strings.NewReader(string(data)), int64(len(data)), pushScope(ref))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp)
+	}
+	return Digest(data), nil
+}
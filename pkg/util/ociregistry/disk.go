@@ -0,0 +1,189 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ociregistry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// SDisk is a disk image read from an OCI artifact
+type SDisk struct {
+	io.ReadCloser
+
+	Size int64
+	// Annotations of the manifest and the disk layer
+	Annotations map[string]string
+}
+
+// PullDisk opens the disk image of the artifact, either the first layer
+// with a disk media type, or the disk/ directory of a KubeVirt containerDisk
+func (cli *SClient) PullDisk(ctx context.Context, ref *SReference, arch string) (*SDisk, error) {
+	manifest, err := cli.GetManifest(ctx, ref, arch)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetManifest")
+	}
+	annotations := map[string]string{}
+	for k, v := range manifest.Annotations {
+		annotations[k] = v
+	}
+	for _, layer := range manifest.Layers {
+		if !IsDiskMediaType(layer.MediaType) {
+			continue
+		}
+		blob, err := cli.GetBlob(ctx, ref, layer)
+		if err != nil {
+			return nil, errors.Wrapf(err, "GetBlob %s", layer.Digest)
+		}
+		for k, v := range layer.Annotations {
+			annotations[k] = v
+		}
+		return &SDisk{ReadCloser: blob, Size: layer.Size, Annotations: annotations}, nil
+	}
+	// the disk of a containerDisk is added by the last layers in general
+	for i := len(manifest.Layers) - 1; i >= 0; i-- {
+		disk, err := cli.openContainerDisk(ctx, ref, manifest.Layers[i])
+		if err == nil {
+			disk.Annotations = annotations
+			return disk, nil
+		}
+		if errors.Cause(err) != ErrDiskNotFound {
+			return nil, errors.Wrapf(err, "layer %s", manifest.Layers[i].Digest)
+		}
+	}
+	return nil, errors.Wrapf(ErrDiskNotFound, "%s", ref)
+}
+
+func (cli *SClient) openContainerDisk(ctx context.Context, ref *SReference, layer SDescriptor) (*SDisk, error) {
+	if strings.Contains(layer.MediaType, "zstd") {
+		return nil, errors.Errorf("unsupported layer media type %s", layer.MediaType)
+	}
+	blob, err := cli.GetBlob(ctx, ref, layer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetBlob %s", layer.Digest)
+	}
+	disk, err := func() (*SDisk, error) {
+		raw := bufio.NewReader(blob)
+		var reader io.Reader = raw
+		if magic, _ := raw.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			reader, err = gzip.NewReader(raw)
+			if err != nil {
+				return nil, errors.Wrap(err, "gzip")
+			}
+		}
+		tr := tar.NewReader(reader)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil, ErrDiskNotFound
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "read tar")
+			}
+			name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+			if hdr.Typeflag == tar.TypeReg && strings.HasPrefix(name, CONTAINER_DISK_DIR) && !strings.Contains(name[len(CONTAINER_DISK_DIR):], "/") {
+				return &SDisk{
+					ReadCloser: &sTarEntryReader{tr: tr, rest: raw, Closer: blob},
+					Size:       hdr.Size,
+				}, nil
+			}
+		}
+	}()
+	if err != nil {
+		blob.Close()
+		return nil, err
+	}
+	return disk, nil
+}
+
+// sTarEntryReader reads an entry of a layer, the rest of the layer is
+// drained at the end of the entry so that the layer digest gets verified
+type sTarEntryReader struct {
+	io.Closer
+
+	tr   *tar.Reader
+	rest io.Reader
+}
+
+func (r *sTarEntryReader) Read(p []byte) (int, error) {
+	n, err := r.tr.Read(p)
+	if err == io.EOF {
+		if _, e := io.Copy(ioutil.Discard, r.rest); e != nil {
+			return n, e
+		}
+	}
+	return n, err
+}
+
+// PushDisk pushes the disk image file as an artifact of a single disk
+// layer under the tag of the reference and returns the manifest digest
+func (cli *SClient) PushDisk(ctx context.Context, ref *SReference, filePath string, format string, annotations map[string]string) (string, error) {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return "", errors.Wrap(err, "open disk")
+	}
+	defer fp.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, fp)
+	if err != nil {
+		return "", errors.Wrap(err, "digest disk")
+	}
+	digest := fmt.Sprintf("sha256:%x", hash.Sum(nil))
+
+	config := []byte("{}")
+	err = cli.PushBlob(ctx, ref, bytes.NewReader(config), int64(len(config)), Digest(config))
+	if err != nil {
+		return "", errors.Wrap(err, "push config")
+	}
+	err = cli.PushBlob(ctx, ref, fp, size, digest)
+	if err != nil {
+		return "", errors.Wrap(err, "push disk")
+	}
+	manifest := &SManifest{
+		SchemaVersion: 2,
+		MediaType:     MEDIA_TYPE_OCI_MANIFEST,
+		ArtifactType:  MEDIA_TYPE_DISK,
+		Config: &SDescriptor{
+			MediaType: MEDIA_TYPE_OCI_EMPTY,
+			Digest:    Digest(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []SDescriptor{
+			{
+				MediaType: MEDIA_TYPE_DISK,
+				Digest:    digest,
+				Size:      size,
+				Annotations: map[string]string{
+					ANNOTATION_TITLE:       fmt.Sprintf("%s.%s", path.Base(ref.Repository), format),
+					ANNOTATION_DISK_FORMAT: format,
+				},
+			},
+		},
+		Annotations: annotations,
+	}
+	return cli.PutManifest(ctx, ref, manifest)
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ociregistry
+
+import (
+	"strings"
+)
+
+const (
+	MEDIA_TYPE_OCI_MANIFEST = "application/vnd.oci.image.manifest.v1+json"
+	MEDIA_TYPE_OCI_INDEX    = "application/vnd.oci.image.index.v1+json"
+	MEDIA_TYPE_OCI_EMPTY    = "application/vnd.oci.empty.v1+json"
+
+	MEDIA_TYPE_DOCKER_MANIFEST      = "application/vnd.docker.distribution.manifest.v2+json"
+	MEDIA_TYPE_DOCKER_MANIFEST_LIST = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// MEDIA_TYPE_DISK is the media type of the disk layer and the artifact
+	// type of disk images pushed by this package
+	MEDIA_TYPE_DISK = "application/vnd.cloudpods.image.disk.v1"
+
+	ANNOTATION_TITLE = "org.opencontainers.image.title"
+	// ANNOTATION_PREFIX prefixes the annotations carrying image properties
+	ANNOTATION_PREFIX = "io.cloudpods.image."
+	// ANNOTATION_DISK_FORMAT is the qemu format of the disk layer
+	ANNOTATION_DISK_FORMAT = ANNOTATION_PREFIX + "disk_format"
+
+	// CONTAINER_DISK_DIR is where a KubeVirt containerDisk keeps its disk image
+	CONTAINER_DISK_DIR = "disk/"
+)
+
+var (
+	manifestMediaTypes = []string{
+		MEDIA_TYPE_OCI_MANIFEST,
+		MEDIA_TYPE_OCI_INDEX,
+		MEDIA_TYPE_DOCKER_MANIFEST,
+		MEDIA_TYPE_DOCKER_MANIFEST_LIST,
+	}
+)
+
+type SPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type SDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *SPlatform        `json:"platform,omitempty"`
+}
+
+// SManifest is an image manifest, or an image index when Manifests is set
+type SManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *SDescriptor      `json:"config,omitempty"`
+	Layers        []SDescriptor     `json:"layers,omitempty"`
+	Manifests     []SDescriptor     `json:"manifests,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+func (m *SManifest) IsIndex() bool {
+	return m.MediaType == MEDIA_TYPE_OCI_INDEX || m.MediaType == MEDIA_TYPE_DOCKER_MANIFEST_LIST || len(m.Manifests) > 0
+}
+
+// selectPlatform returns the manifest of the index for linux on arch
+func (m *SManifest) selectPlatform(arch string) *SDescriptor {
+	for i := range m.Manifests {
+		platform := m.Manifests[i].Platform
+		if platform != nil && platform.OS == "linux" && platform.Architecture == arch {
+			return &m.Manifests[i]
+		}
+	}
+	return nil
+}
+
+// IsDiskMediaType tells whether a layer holds a bare disk image, such as
+// application/vnd.cloudpods.image.disk.v1 or application/vnd.acme.disk.qcow2
+func IsDiskMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "application/vnd.") && strings.Contains(mediaType, "disk") &&
+		!strings.HasPrefix(mediaType, "application/vnd.oci.") && !strings.HasPrefix(mediaType, "application/vnd.docker.")
+}
@@ -0,0 +1,278 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ociregistry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+)
+
+func TestParseReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := []struct {
+		ref  string
+		want SReference
+	}{
+		{"centos", SReference{Registry: DOCKER_HUB, Repository: "library/centos", Tag: "latest"}},
+		{"kubevirt/fedora:34", SReference{Registry: DOCKER_HUB, Repository: "kubevirt/fedora", Tag: "34"}},
+		{"harbor.example.com/disks/ubuntu:22.04", SReference{Registry: "harbor.example.com", Repository: "disks/ubuntu", Tag: "22.04"}},
+		{"localhost:5000/ubuntu@" + digest, SReference{Registry: "localhost:5000", Repository: "ubuntu", Digest: digest}},
+		{"localhost/a/b:c@" + digest, SReference{Registry: "localhost", Repository: "a/b", Tag: "c", Digest: digest}},
+	}
+	for _, c := range cases {
+		ref, err := ParseReference(c.ref)
+		if err != nil {
+			t.Errorf("ParseReference(%s): %s", c.ref, err)
+			continue
+		}
+		if *ref != c.want {
+			t.Errorf("ParseReference(%s) = %#v, want %#v", c.ref, *ref, c.want)
+		}
+	}
+	for _, ref := range []string{"Upper/case", "a/b@sha256:1234", "a/b:-bad"} {
+		if _, err := ParseReference(ref); errors.Cause(err) != ErrInvalidReference {
+			t.Errorf("ParseReference(%s) should fail, got %v", ref, err)
+		}
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:a/b:pull,push"`)
+	if scheme != "Bearer" || params["realm"] != "https://auth.example.com/token" || params["service"] != "registry" || params["scope"] != "repository:a/b:pull,push" {
+		t.Errorf("unexpected challenge %s %v", scheme, params)
+	}
+}
+
+// fakeRegistry is an in-memory registry requiring bearer tokens
+type fakeRegistry struct {
+	lock      sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+}
+
+func newFakeRegistry() (*httptest.Server, *fakeRegistry) {
+	reg := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}}
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.lock.Lock()
+		defer reg.lock.Unlock()
+		if r.URL.Path == "/token" {
+			user, passwd, _ := r.BasicAuth()
+			if user != "admin" || passwd != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "t0ken-" + r.URL.Query().Get("scope")})
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer t0ken-") {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var repo, kind, key string
+		for _, k := range []string{"manifests", "blobs"} {
+			if pos := strings.Index(r.URL.Path, "/"+k+"/"); pos > 0 {
+				repo, kind, key = strings.TrimPrefix(r.URL.Path[:pos], "/v2/"), k, r.URL.Path[pos+len(k)+2:]
+				break
+			}
+		}
+		switch {
+		case kind == "manifests" && r.Method == http.MethodGet:
+			data, ok := reg.manifests[repo+":"+key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			m := SManifest{}
+			json.Unmarshal(data, &m)
+			w.Header().Set("Content-Type", m.MediaType)
+			w.Write(data)
+		case kind == "manifests" && r.Method == http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			reg.manifests[repo+":"+key] = data
+			reg.manifests[repo+":"+Digest(data)] = data
+			w.WriteHeader(http.StatusCreated)
+		case kind == "blobs" && key == "uploads/" && r.Method == http.MethodPost:
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%d?state=x", repo, reg.uploads))
+			reg.uploads++
+			w.WriteHeader(http.StatusAccepted)
+		case kind == "blobs" && strings.HasPrefix(key, "uploads/") && r.Method == http.MethodPut:
+			data, _ := ioutil.ReadAll(r.Body)
+			digest := r.URL.Query().Get("digest")
+			if Digest(data) != digest || r.URL.Query().Get("state") != "x" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reg.blobs[digest] = data
+			w.WriteHeader(http.StatusCreated)
+		case kind == "blobs":
+			data, ok := reg.blobs[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, reg
+}
+
+func (reg *fakeRegistry) addBlob(data []byte) SDescriptor {
+	digest := Digest(data)
+	reg.blobs[digest] = data
+	return SDescriptor{Digest: digest, Size: int64(len(data))}
+}
+
+func (reg *fakeRegistry) addManifest(repo string, tag string, m *SManifest) SDescriptor {
+	data, _ := json.Marshal(m)
+	reg.manifests[repo+":"+tag] = data
+	reg.manifests[repo+":"+Digest(data)] = data
+	return SDescriptor{MediaType: m.MediaType, Digest: Digest(data), Size: int64(len(data))}
+}
+
+func newTestClient(server *httptest.Server) *SClient {
+	return NewClient(server.Client(), "admin", "secret")
+}
+
+func testRef(t *testing.T, server *httptest.Server, repo string) *SReference {
+	ref, err := ParseReference(fmt.Sprintf("%s/%s", strings.TrimPrefix(server.URL, "https://"), repo))
+	if err != nil {
+		t.Fatalf("ParseReference: %s", err)
+	}
+	return ref
+}
+
+func readDisk(t *testing.T, disk *SDisk) []byte {
+	defer disk.Close()
+	data, err := ioutil.ReadAll(disk)
+	if err != nil {
+		t.Fatalf("read disk: %s", err)
+	}
+	if int64(len(data)) != disk.Size {
+		t.Fatalf("disk size %d, got %d bytes", disk.Size, len(data))
+	}
+	return data
+}
+
+func TestPushPullDisk(t *testing.T) {
+	server, _ := newFakeRegistry()
+	defer server.Close()
+
+	content := bytes.Repeat([]byte("qcow2 disk "), 10000)
+	diskFile := filepath.Join(t.TempDir(), "disk.qcow2")
+	err := ioutil.WriteFile(diskFile, content, 0644)
+	if err != nil {
+		t.Fatalf("write disk: %s", err)
+	}
+
+	ref := testRef(t, server, "disks/centos:7")
+	_, err = newTestClient(server).PushDisk(context.Background(), ref, diskFile, "qcow2", map[string]string{ANNOTATION_PREFIX + "os_type": "Linux"})
+	if err != nil {
+		t.Fatalf("PushDisk: %s", err)
+	}
+
+	disk, err := newTestClient(server).PullDisk(context.Background(), ref, "amd64")
+	if err != nil {
+		t.Fatalf("PullDisk: %s", err)
+	}
+	if !bytes.Equal(readDisk(t, disk), content) {
+		t.Errorf("pulled disk differs")
+	}
+	if disk.Annotations[ANNOTATION_PREFIX+"os_type"] != "Linux" || disk.Annotations[ANNOTATION_DISK_FORMAT] != "qcow2" {
+		t.Errorf("unexpected annotations %v", disk.Annotations)
+	}
+
+	_, err = NewClient(server.Client(), "admin", "wrong").PullDisk(context.Background(), ref, "amd64")
+	if errors.Cause(err) != ErrUnauthorized {
+		t.Errorf("pull with wrong password should be unauthorized, got %v", err)
+	}
+}
+
+func TestPullContainerDisk(t *testing.T) {
+	server, reg := newFakeRegistry()
+	defer server.Close()
+
+	content := bytes.Repeat([]byte("raw disk "), 10000)
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "disk/", Typeflag: tar.TypeDir, Mode: 0755})
+	tw.WriteHeader(&tar.Header{Name: "disk/fedora.img", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+	tw.Write(content)
+	tw.Close()
+	gz.Close()
+
+	layer := reg.addBlob(buf.Bytes())
+	layer.MediaType = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	config := reg.addBlob([]byte("{}"))
+	config.MediaType = "application/vnd.docker.container.image.v1+json"
+	amd64 := reg.addManifest("fedora", "amd64", &SManifest{
+		SchemaVersion: 2,
+		MediaType:     MEDIA_TYPE_DOCKER_MANIFEST,
+		Config:        &config,
+		Layers:        []SDescriptor{layer},
+	})
+	amd64.Platform = &SPlatform{OS: "linux", Architecture: "amd64"}
+	reg.addManifest("fedora", "34", &SManifest{
+		SchemaVersion: 2,
+		MediaType:     MEDIA_TYPE_OCI_INDEX,
+		Manifests:     []SDescriptor{amd64},
+	})
+
+	ref := testRef(t, server, "fedora:34")
+	disk, err := newTestClient(server).PullDisk(context.Background(), ref, "amd64")
+	if err != nil {
+		t.Fatalf("PullDisk: %s", err)
+	}
+	if !bytes.Equal(readDisk(t, disk), content) {
+		t.Errorf("pulled disk differs")
+	}
+
+	_, err = newTestClient(server).PullDisk(context.Background(), ref, "arm64")
+	if errors.Cause(err) != errors.ErrNotFound {
+		t.Errorf("pull for arm64 should not be found, got %v", err)
+	}
+
+	// corrupt the layer, the digest mismatch is found at the end of the disk
+	reg.blobs[layer.Digest] = append(buf.Bytes(), 0)
+	disk, err = newTestClient(server).PullDisk(context.Background(), ref, "amd64")
+	if err != nil {
+		t.Fatalf("PullDisk: %s", err)
+	}
+	defer disk.Close()
+	_, err = ioutil.ReadAll(disk)
+	if errors.Cause(err) != ErrDigestMismatch {
+		t.Errorf("corrupted layer should fail with digest mismatch, got %v", err)
+	}
+}
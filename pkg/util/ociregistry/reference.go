@@ -0,0 +1,112 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ociregistry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	DOCKER_HUB          = "docker.io"
+	DOCKER_HUB_REGISTRY = "registry-1.docker.io"
+
+	DEFAULT_TAG = "latest"
+)
+
+var (
+	repositoryRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+	tagRegexp        = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// SReference is a reference to a manifest in a repository of a registry,
+// by tag or by digest
+type SReference struct {
+	// Registry is the host[:port] of the registry
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses references like harbor.example.com/library/centos:7
+// or registry:5000/disks/ubuntu@sha256:..., references without a registry
+// host refer to Docker Hub like docker pull does
+func ParseReference(ref string) (*SReference, error) {
+	ret := &SReference{}
+	name := ref
+	if pos := strings.Index(name, "@"); pos >= 0 {
+		ret.Digest = name[pos+1:]
+		name = name[:pos]
+		if !digestRegexp.MatchString(ret.Digest) {
+			return nil, errors.Wrapf(ErrInvalidReference, "invalid digest %s", ret.Digest)
+		}
+	}
+	if pos := strings.LastIndex(name, ":"); pos >= 0 && !strings.Contains(name[pos+1:], "/") {
+		ret.Tag = name[pos+1:]
+		name = name[:pos]
+		if !tagRegexp.MatchString(ret.Tag) {
+			return nil, errors.Wrapf(ErrInvalidReference, "invalid tag %s", ret.Tag)
+		}
+	}
+	if pos := strings.Index(name, "/"); pos >= 0 && (strings.ContainsAny(name[:pos], ".:") || name[:pos] == "localhost") {
+		ret.Registry = name[:pos]
+		ret.Repository = name[pos+1:]
+	} else {
+		ret.Registry = DOCKER_HUB
+		ret.Repository = name
+		if !strings.Contains(name, "/") {
+			ret.Repository = "library/" + name
+		}
+	}
+	if !repositoryRegexp.MatchString(ret.Repository) {
+		return nil, errors.Wrapf(ErrInvalidReference, "invalid repository %s", ret.Repository)
+	}
+	if len(ret.Tag) == 0 && len(ret.Digest) == 0 {
+		ret.Tag = DEFAULT_TAG
+	}
+	return ret, nil
+}
+
+// Manifest returns the tag or digest to fetch the manifest with, the digest
+// wins if both are given
+func (ref *SReference) Manifest() string {
+	if len(ref.Digest) > 0 {
+		return ref.Digest
+	}
+	return ref.Tag
+}
+
+func (ref *SReference) String() string {
+	ret := fmt.Sprintf("%s/%s", ref.Registry, ref.Repository)
+	if len(ref.Tag) > 0 {
+		ret = fmt.Sprintf("%s:%s", ret, ref.Tag)
+	}
+	if len(ref.Digest) > 0 {
+		ret = fmt.Sprintf("%s@%s", ret, ref.Digest)
+	}
+	return ret
+}
+
+func (ref *SReference) endpoint() string {
+	if ref.Registry == DOCKER_HUB {
+		return DOCKER_HUB_REGISTRY
+	}
+	return ref.Registry
+}
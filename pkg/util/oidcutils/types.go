@@ -68,6 +68,12 @@ type SOIDCConfiguration struct {
 	ServiceDocumentation string `json:"service_documentation"`
 
 	UiLocalesSupported []string `json:"ui_locales_supported"`
+
+	GrantTypesSupported []string `json:"grant_types_supported"`
+
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
 }
 
 type SOIDCAccessTokenRequest struct {
@@ -90,6 +96,27 @@ type SOIDCAccessTokenRequest struct {
 	// REQUIRED, if the client is not authenticating with the
 	// authorization server as described in Section 3.2.1.
 	ClientId string `json:"client_id"`
+
+	// client_secret
+	// OPTIONAL, for client_secret_post authentication
+	ClientSecret string `json:"client_secret"`
+
+	// code_verifier
+	// REQUIRED, if the code_challenge parameter was included in the
+	// authorization request (RFC 7636)
+	CodeVerifier string `json:"code_verifier"`
+
+	// refresh_token
+	// REQUIRED, for the refresh_token grant type
+	RefreshToken string `json:"refresh_token"`
+
+	// device_code
+	// REQUIRED, for the device_code grant type (RFC 8628)
+	DeviceCode string `json:"device_code"`
+
+	// scope
+	// OPTIONAL, for the refresh_token and client_credentials grant types
+	Scope string `json:"scope"`
 }
 
 type SOIDCAccessTokenResponse struct {
@@ -98,12 +125,61 @@ type SOIDCAccessTokenResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
 	IdToken      string `json:"id_token"`
+	Scope        string `json:"scope"`
+}
+
+// SOIDCDeviceAuthorizationResponse is the response of the device
+// authorization endpoint (RFC 8628 section 3.2)
+type SOIDCDeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// SOIDCError is the error response of the token endpoint (RFC 6749
+// section 5.2)
+type SOIDCError struct {
+	ErrorCode        string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (e *SOIDCError) Error() string {
+	if len(e.ErrorDescription) == 0 {
+		return e.ErrorCode
+	}
+	return e.ErrorCode + ": " + e.ErrorDescription
+}
+
+func NewOIDCError(code string, desc string) *SOIDCError {
+	return &SOIDCError{ErrorCode: code, ErrorDescription: desc}
 }
 
 const (
 	OIDC_RESPONSE_TYPE_CODE = "code"
 	OIDC_REQUEST_GRANT_TYPE = "authorization_code"
 	OIDC_BEARER_TOKEN_TYPE  = "Bearer"
+
+	OIDC_GRANT_TYPE_AUTHORIZATION_CODE = OIDC_REQUEST_GRANT_TYPE
+	OIDC_GRANT_TYPE_REFRESH_TOKEN      = "refresh_token"
+	OIDC_GRANT_TYPE_CLIENT_CREDENTIALS = "client_credentials"
+	OIDC_GRANT_TYPE_DEVICE_CODE        = "urn:ietf:params:oauth:grant-type:device_code"
+
+	OIDC_CODE_CHALLENGE_METHOD_PLAIN = "plain"
+	OIDC_CODE_CHALLENGE_METHOD_S256  = "S256"
+
+	OIDC_ERROR_INVALID_REQUEST        = "invalid_request"
+	OIDC_ERROR_INVALID_CLIENT         = "invalid_client"
+	OIDC_ERROR_INVALID_GRANT          = "invalid_grant"
+	OIDC_ERROR_UNAUTHORIZED_CLIENT    = "unauthorized_client"
+	OIDC_ERROR_UNSUPPORTED_GRANT_TYPE = "unsupported_grant_type"
+	OIDC_ERROR_INVALID_SCOPE          = "invalid_scope"
+	OIDC_ERROR_AUTHORIZATION_PENDING  = "authorization_pending"
+	OIDC_ERROR_SLOW_DOWN              = "slow_down"
+	OIDC_ERROR_ACCESS_DENIED          = "access_denied"
+	OIDC_ERROR_EXPIRED_TOKEN          = "expired_token"
 )
 
 type SOIDCAuthRequest struct {
@@ -113,4 +189,8 @@ type SOIDCAuthRequest struct {
 	State        string `json:"state"`
 	Scope        string `json:"scope"`
 	// Nonce        string `json:"nonce"`
+
+	// PKCE code challenge (RFC 7636)
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
 }
@@ -731,6 +731,12 @@ func (img *SQemuImage) Resize(sizeMB int) error {
 }
 
 func (img *SQemuImage) Rebase(backPath string, force bool) error {
+	return img.RebaseWithFormat(backPath, "", force)
+}
+
+// RebaseWithFormat rebases the image to backPath of backFormat, the format is
+// required by newer qemu-img to rebase without probing the backing file
+func (img *SQemuImage) RebaseWithFormat(backPath string, backFormat TImageFormat, force bool) error {
 	if !img.IsValid() {
 		return fmt.Errorf("self is not valid")
 	}
@@ -753,6 +759,9 @@ func (img *SQemuImage) Rebase(backPath string, force bool) error {
 		args = append(args, "-u")
 	}
 	args = append(args, "-b", backPath)
+	if len(backFormat) > 0 {
+		args = append(args, "-F", string(backFormat))
+	}
 	cmd := procutils.NewRemoteCommandAsFarAsPossible("ionice", args...)
 	output, err := cmd.Output()
 	if err != nil {
@@ -829,6 +838,34 @@ func (img *SQemuImage) Check() error {
 	return nil
 }
 
+// SImageExtent is an extent of image reported by qemu-img map
+type SImageExtent struct {
+	Start  int64 `json:"start"`
+	Length int64 `json:"length"`
+	Depth  int   `json:"depth"`
+	Zero   bool  `json:"zero"`
+	Data   bool  `json:"data"`
+}
+
+// Map returns the extents of the whole backing chain of the image, an extent
+// whose Data is true and Zero is false holds allocated data
+func (img *SQemuImage) Map() ([]SImageExtent, error) {
+	output, err := procutils.NewRemoteCommandAsFarAsPossible(qemutils.GetQemuImg(), "map", "-U", "-f", img.Format.String(), "--output", "json", img.Path).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "qemu-img map: %s", output)
+	}
+	resp, err := jsonutils.Parse(output)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse qemu-img map output")
+	}
+	extents := []SImageExtent{}
+	err = resp.Unmarshal(&extents)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshal qemu-img map output")
+	}
+	return extents, nil
+}
+
 // "json:{\"driver\":\"qcow2\",\"file\":{\"driver\":\"file\",\"filename\":\"/opt/cloud/workspace/disks/snapshots/72a2383d-e980-486f-816c-6c562e1757f3_snap/f39f225a-921f-492e-8fb6-0a4167d6ed91\"}}"
 func ParseQemuFilepath(pathInfo string) (string, error) {
 	if strings.HasPrefix(pathInfo, "json:{") {
@@ -0,0 +1,203 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-streaming.html
+const (
+	streamingSignedPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	signV4ChunkAlgorithm   = "AWS4-HMAC-SHA256-PAYLOAD"
+
+	// sha256 of empty string
+	emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxChunkSize       = 16 * 1024 * 1024
+	maxChunkHeaderSize = 4096
+
+	ErrMalformedChunk         = errors.Error("malformed chunked encoding")
+	ErrChunkSignatureMismatch = errors.Error("chunk signature mismatch")
+)
+
+// IsStreamingSignedPayload returns whether the payload of request is signed
+// chunk by chunk in aws-chunked encoding
+func IsStreamingSignedPayload(req http.Request) bool {
+	return req.Header.Get("X-Amz-Content-Sha256") == streamingSignedPayload
+}
+
+// GetDecodedContentLength returns the length of payload before aws-chunked encoding
+func GetDecodedContentLength(req http.Request) (int64, error) {
+	lenStr := req.Header.Get("X-Amz-Decoded-Content-Length")
+	if len(lenStr) == 0 {
+		return 0, errors.Error("missing x-amz-decoded-content-length")
+	}
+	size, err := strconv.ParseInt(lenStr, 10, 64)
+	if err != nil || size < 0 {
+		return 0, errors.Errorf("invalid x-amz-decoded-content-length %s", lenStr)
+	}
+	return size, nil
+}
+
+type sChunkedSignedReader struct {
+	reader *bufio.Reader
+	closer io.Closer
+
+	signingKey    []byte
+	signDate      time.Time
+	scope         string
+	prevSignature string
+
+	chunk  []byte
+	offset int
+	done   bool
+	err    error
+}
+
+// NewChunkedSignedReader decodes the aws-chunked body of a request signed with
+// STREAMING-AWS4-HMAC-SHA256-PAYLOAD, the signature of each chunk is verified
+// before its data is returned. The request signature itself must be verified
+// beforehand, it is used as the seed signature of the first chunk.
+func NewChunkedSignedReader(req http.Request, secret string) (io.ReadCloser, error) {
+	authHeader := req.Header.Get("Authorization")
+	pos := strings.IndexByte(authHeader, ' ')
+	if pos <= 0 || authHeader[:pos] != signV4Algorithm {
+		return nil, errors.Error("streaming payload requires v4 authorization header")
+	}
+	aksk, err := decodeAuthHeaderV4(authHeader[pos+1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeAuthHeaderV4")
+	}
+	dateStr := req.Header.Get("X-Amz-Date")
+	if len(dateStr) == 0 {
+		return nil, errors.Error("missing x-amz-date")
+	}
+	signDate, err := time.Parse(iso8601DateFormat, dateStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "time.Parse")
+	}
+	return &sChunkedSignedReader{
+		reader:        bufio.NewReaderSize(req.Body, maxChunkHeaderSize),
+		closer:        req.Body,
+		signingKey:    getSigningKey(secret, aksk.Location, signDate),
+		signDate:      signDate,
+		scope:         getScope(aksk.Location, signDate),
+		prevSignature: aksk.Signature,
+	}, nil
+}
+
+func (r *sChunkedSignedReader) Read(p []byte) (int, error) {
+	for r.offset >= len(r.chunk) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.readChunk()
+	}
+	n := copy(p, r.chunk[r.offset:])
+	r.offset += n
+	return n, nil
+}
+
+func (r *sChunkedSignedReader) Close() error {
+	return r.closer.Close()
+}
+
+// readChunk reads and verifies one chunk of
+// hex(chunk-size);chunk-signature=signature\r\nchunk-data\r\n
+func (r *sChunkedSignedReader) readChunk() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	pos := bytes.IndexByte(line, ';')
+	if pos <= 0 || !bytes.HasPrefix(line[pos+1:], []byte("chunk-signature=")) {
+		return errors.Wrapf(ErrMalformedChunk, "invalid chunk header %q", line)
+	}
+	size, err := strconv.ParseInt(string(line[:pos]), 16, 64)
+	if err != nil || size < 0 {
+		return errors.Wrapf(ErrMalformedChunk, "invalid chunk size %q", line[:pos])
+	}
+	if size > maxChunkSize {
+		return errors.Wrapf(ErrMalformedChunk, "chunk size %d exceeds %d", size, maxChunkSize)
+	}
+	signature := string(line[pos+1+len("chunk-signature="):])
+
+	if int64(cap(r.chunk)) < size {
+		r.chunk = make([]byte, size)
+	}
+	r.chunk = r.chunk[:size]
+	r.offset = 0
+	if _, err := io.ReadFull(r.reader, r.chunk); err != nil {
+		return errors.Wrapf(ErrMalformedChunk, "read chunk data: %s", err)
+	}
+	crlf, err := r.readLine()
+	if err != nil {
+		return err
+	}
+	if len(crlf) != 0 {
+		return errors.Wrap(ErrMalformedChunk, "chunk data not terminated by CRLF")
+	}
+
+	stringToSign := strings.Join([]string{
+		signV4ChunkAlgorithm,
+		r.signDate.Format(iso8601DateFormat),
+		r.scope,
+		r.prevSignature,
+		emptySHA256,
+		hex.EncodeToString(sum256(r.chunk)),
+	}, "\n")
+	expect := getSignature(r.signingKey, stringToSign)
+	if !hmac.Equal([]byte(expect), []byte(signature)) {
+		return ErrChunkSignatureMismatch
+	}
+	r.prevSignature = signature
+	if size == 0 {
+		r.done = true
+	}
+	return nil
+}
+
+// readLine reads a line terminated by CRLF, the CRLF is stripped. A line
+// longer than the buffer of reader is rejected
+func (r *sChunkedSignedReader) readLine() ([]byte, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return nil, errors.Wrap(ErrMalformedChunk, "chunk header too long")
+		}
+		if err == io.EOF {
+			return nil, errors.Wrap(ErrMalformedChunk, "unexpected EOF")
+		}
+		return nil, errors.Wrap(err, "read chunk header")
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.Wrap(ErrMalformedChunk, "line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
@@ -16,12 +16,19 @@ package s3auth
 
 import (
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
 )
 
+const (
+	ErrSignatureMismatch = errors.Error("signature mismatch")
+	ErrRequestExpired    = errors.Error("request has expired")
+)
+
 type IAccessKeySecretRequest interface {
 	GetAccessKey() string
 	Validate() error
@@ -35,6 +42,9 @@ type SAccessKeyRequest struct {
 	AccessKey string `json:"access_key,omitempty"`
 	Signature string `json:"signature,omitempty"`
 	Request   string `json:"request,omitempty"`
+
+	// expire time of presigned request
+	ExpireAt time.Time `json:"expire_at,omitempty"`
 }
 
 func (aksk SAccessKeyRequest) GetAccessKey() string {
@@ -48,6 +58,13 @@ func (aksk SAccessKeyRequest) Validate() error {
 	if len(aksk.Signature) == 0 {
 		return errors.Error("Missing Signature")
 	}
+	return aksk.checkExpire()
+}
+
+func (aksk SAccessKeyRequest) checkExpire() error {
+	if !aksk.ExpireAt.IsZero() && time.Now().After(aksk.ExpireAt) {
+		return errors.Wrapf(ErrRequestExpired, "expired at %s", aksk.ExpireAt)
+	}
 	return nil
 }
 
@@ -75,14 +92,42 @@ func decodeAuthHeader(authHeader string) (IAccessKeySecretRequest, error) {
 	}
 }
 
+// decodeAuthQuery decodes presigned request, which carries the signature in
+// query string instead of authorization header
+func decodeAuthQuery(query url.Values) (IAccessKeySecretRequest, error) {
+	if algo := query.Get("X-Amz-Algorithm"); len(algo) > 0 {
+		if algo != signV4Algorithm {
+			return nil, errors.Error("unsupported signing algorithm")
+		}
+		req, err := decodeAuthQueryV4(query)
+		if err != nil {
+			return nil, errors.Wrap(err, "decodeAuthQueryV4")
+		}
+		return req, nil
+	} else if len(query.Get("AWSAccessKeyId")) > 0 {
+		req, err := decodeAuthQueryV2(query)
+		if err != nil {
+			return nil, errors.Wrap(err, "decodeAuthQueryV2")
+		}
+		return req, nil
+	}
+	return nil, errors.Error("missing authorization header")
+}
+
 func DecodeAccessKeyRequest(req http.Request, virtualHost bool) (IAccessKeySecretRequest, error) {
+	var akskReq IAccessKeySecretRequest
+	var err error
 	authHeader := req.Header.Get("Authorization")
-	if len(authHeader) == 0 {
-		return nil, errors.Error("missing authorization header")
-	}
-	akskReq, err := decodeAuthHeader(authHeader)
-	if err != nil {
-		return nil, errors.Wrap(err, "decodeAuthHeader")
+	if len(authHeader) > 0 {
+		akskReq, err = decodeAuthHeader(authHeader)
+		if err != nil {
+			return nil, errors.Wrap(err, "decodeAuthHeader")
+		}
+	} else {
+		akskReq, err = decodeAuthQuery(req.URL.Query())
+		if err != nil {
+			return nil, errors.Wrap(err, "decodeAuthQuery")
+		}
 	}
 	err = akskReq.ParseRequest(req, virtualHost)
 	if err != nil {
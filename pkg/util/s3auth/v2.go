@@ -22,7 +22,9 @@ import (
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"yunion.io/x/jsonutils"
 	"yunion.io/x/pkg/errors"
@@ -41,10 +43,10 @@ const (
 //	 Date + "\n" +
 //	 CanonicalizedProtocolHeaders +
 //	 CanonicalizedResource;
-func stringToSignV2(req http.Request, virtualHost bool) string {
+func stringToSignV2(req http.Request, virtualHost bool, date string) string {
 	buf := new(bytes.Buffer)
 	// Write standard headers.
-	writeSignV2Headers(buf, req)
+	writeSignV2Headers(buf, req, date)
 	// Write canonicalized protocol headers if any.
 	writeCanonicalizedHeaders(buf, req)
 	// Write canonicalized Query resources if any.
@@ -53,11 +55,12 @@ func stringToSignV2(req http.Request, virtualHost bool) string {
 }
 
 // writeSignV2Headers - write signV2 required headers.
-func writeSignV2Headers(buf *bytes.Buffer, req http.Request) {
+// date is the Date header, or the Expires query of presigned request
+func writeSignV2Headers(buf *bytes.Buffer, req http.Request, date string) {
 	buf.WriteString(req.Method + "\n")
 	buf.WriteString(req.Header.Get("Content-Md5") + "\n")
 	buf.WriteString(req.Header.Get("Content-Type") + "\n")
-	buf.WriteString(req.Header.Get("Date") + "\n")
+	buf.WriteString(date + "\n")
 }
 
 // writeCanonicalizedHeaders - write canonicalized headers.
@@ -208,10 +211,17 @@ func writeCanonicalizedResource(buf *bytes.Buffer, req http.Request, virtualHost
 
 type SAccessKeyRequestV2 struct {
 	SAccessKeyRequest
+
+	// Expires query of presigned request
+	expires string
 }
 
 func (aksk *SAccessKeyRequestV2) ParseRequest(req http.Request, virtualHost bool) error {
-	aksk.Request = stringToSignV2(req, virtualHost)
+	date := req.Header.Get("Date")
+	if len(aksk.expires) > 0 {
+		date = aksk.expires
+	}
+	aksk.Request = stringToSignV2(req, virtualHost, date)
 	return nil
 }
 
@@ -221,10 +231,10 @@ func (aksk SAccessKeyRequestV2) Verify(secret string) error {
 
 	signature := base64.StdEncoding.EncodeToString(hm.Sum(nil))
 	if signature != aksk.Signature {
-		return errors.Error("signature mismatch")
+		return ErrSignatureMismatch
 	}
 
-	return nil
+	return aksk.checkExpire()
 }
 
 func (aksk SAccessKeyRequestV2) Encode() string {
@@ -247,3 +257,20 @@ func decodeAuthHeaderV2(authStr string) (*SAccessKeyRequestV2, error) {
 	akskReq.Signature = authStr[pos+1:]
 	return &akskReq, nil
 }
+
+// https://${S3_BUCKET}.s3.amazonaws.com/${S3_OBJECT}?AWSAccessKeyId=${S3_ACCESS_KEY}&Expires=${TIMESTAMP}&Signature=${SIGNATURE}
+func decodeAuthQueryV2(query url.Values) (*SAccessKeyRequestV2, error) {
+	akskReq := NewV2Request()
+	akskReq.AccessKey = query.Get("AWSAccessKeyId")
+	akskReq.Signature = query.Get("Signature")
+	akskReq.expires = query.Get("Expires")
+	if len(akskReq.expires) == 0 {
+		return nil, errors.Error("missing Expires")
+	}
+	expires, err := strconv.ParseInt(akskReq.expires, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid Expires %s", akskReq.expires)
+	}
+	akskReq.ExpireAt = time.Unix(expires, 0)
+	return &akskReq, nil
+}
@@ -21,7 +21,9 @@ import (
 	"encoding/hex"
 	"io"
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,6 +41,9 @@ const (
 	yyyymmdd          = "20060102"
 
 	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	// maximal expires of presigned request, 7 days
+	maxPresignExpires = 7 * 24 * 3600
 )
 
 // getScope generate a string of a specific date, an AWS region, and a
@@ -140,19 +145,25 @@ func getSignature(signingKey []byte, stringToSign string) string {
 //  <CanonicalHeaders>\n
 //  <SignedHeaders>\n
 //  <HashedPayload>
-func getCanonicalRequest(req http.Request, signedHeaders []string) string {
-	req.URL.RawQuery = strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+func getCanonicalRequest(req http.Request, signedHeaders []string, hashedPayload string) string {
 	canonicalRequest := strings.Join([]string{
 		req.Method,
 		encodePath(req.URL.Path),
-		req.URL.RawQuery,
+		getCanonicalQueryString(req.URL.Query()),
 		getCanonicalHeaders(req, signedHeaders),
 		strings.Join(signedHeaders, ";"),
-		getHashedPayload(req),
+		hashedPayload,
 	}, "\n")
 	return canonicalRequest
 }
 
+// getCanonicalQueryString sorts and encodes query, the signature of presigned
+// request is excluded
+func getCanonicalQueryString(query url.Values) string {
+	query.Del("X-Amz-Signature")
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
 // Trim leading and trailing spaces and replace sequential spaces with one space, following Trimall()
 // in http://docs.aws.amazon.com/general/latest/gr/sigv4-create-canonical-request.html
 func signV4TrimAll(input string) string {
@@ -226,11 +237,24 @@ func getHashedPayload(req http.Request) string {
 	return hashedPayload
 }
 
+// getPresignedHashedPayload get the payload hash of presigned request, which
+// is only signed if X-Amz-Content-Sha256 is in query
+func getPresignedHashedPayload(req http.Request) string {
+	hashedPayload := req.URL.Query().Get("X-Amz-Content-Sha256")
+	if hashedPayload == "" {
+		hashedPayload = unsignedPayload
+	}
+	return hashedPayload
+}
+
 type SAccessKeyRequestV4 struct {
 	SAccessKeyRequest
 	Location      string
 	SignedHeaders []string
 	SignDate      time.Time
+
+	// signature is carried in query string
+	presigned bool
 }
 
 func NewV4Request() SAccessKeyRequestV4 {
@@ -262,7 +286,56 @@ func decodeAuthHeaderV4(authStr string) (*SAccessKeyRequestV4, error) {
 	return &req, nil
 }
 
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html
+// X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Credential=xxxx/20130524/us-east-1/s3/aws4_request&X-Amz-Date=20130524T000000Z&X-Amz-Expires=86400&X-Amz-SignedHeaders=host&X-Amz-Signature=aeeed9bbccd4d02ee5c0
+func decodeAuthQueryV4(query url.Values) (*SAccessKeyRequestV4, error) {
+	req := NewV4Request()
+	req.presigned = true
+	credParts := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credParts) != 5 {
+		return nil, errors.Error("illegal X-Amz-Credential")
+	}
+	req.AccessKey = credParts[0]
+	req.Location = credParts[2]
+	signedHeaders := query.Get("X-Amz-SignedHeaders")
+	if len(signedHeaders) == 0 {
+		return nil, errors.Error("missing X-Amz-SignedHeaders")
+	}
+	req.SignedHeaders = strings.Split(signedHeaders, ";")
+	sort.Strings(req.SignedHeaders)
+	req.Signature = query.Get("X-Amz-Signature")
+
+	dateStr := query.Get("X-Amz-Date")
+	if len(dateStr) == 0 {
+		return nil, errors.Error("missing X-Amz-Date")
+	}
+	dateSign, err := time.Parse(iso8601DateFormat, dateStr)
+	if err != nil {
+		return nil, errors.Wrap(err, "time.Parse")
+	}
+	req.SignDate = dateSign
+
+	expiresStr := query.Get("X-Amz-Expires")
+	if len(expiresStr) == 0 {
+		return nil, errors.Error("missing X-Amz-Expires")
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid X-Amz-Expires %s", expiresStr)
+	}
+	if expires <= 0 || expires > maxPresignExpires {
+		return nil, errors.Errorf("X-Amz-Expires must be between 1 and %d seconds", maxPresignExpires)
+	}
+	req.ExpireAt = dateSign.Add(time.Duration(expires) * time.Second)
+	return &req, nil
+}
+
 func (aksk *SAccessKeyRequestV4) ParseRequest(req http.Request, virtualHost bool) error {
+	if aksk.presigned {
+		canonicalReq := getCanonicalRequest(req, aksk.SignedHeaders, getPresignedHashedPayload(req))
+		aksk.Request = getStringToSignV4(aksk.SignDate, aksk.Location, canonicalReq)
+		return nil
+	}
 	dateStr := req.Header.Get(http.CanonicalHeaderKey("x-amz-date"))
 	if len(dateStr) == 0 {
 		return errors.Error("missing x-amz-date")
@@ -271,7 +344,7 @@ func (aksk *SAccessKeyRequestV4) ParseRequest(req http.Request, virtualHost bool
 	if err != nil {
 		return errors.Wrap(err, "time.Parse")
 	}
-	canonicalReq := getCanonicalRequest(req, aksk.SignedHeaders)
+	canonicalReq := getCanonicalRequest(req, aksk.SignedHeaders, getHashedPayload(req))
 	aksk.SignDate = dateSign
 	aksk.Request = getStringToSignV4(dateSign, aksk.Location, canonicalReq)
 	return nil
@@ -281,9 +354,9 @@ func (aksk SAccessKeyRequestV4) Verify(secret string) error {
 	signingKey := getSigningKey(secret, aksk.Location, aksk.SignDate)
 	signature := getSignature(signingKey, aksk.Request)
 	if signature != aksk.Signature {
-		return errors.Error("signature mismatch")
+		return ErrSignatureMismatch
 	}
-	return nil
+	return aksk.checkExpire()
 }
 
 func (aksk SAccessKeyRequestV4) Encode() string {
@@ -318,8 +391,10 @@ func SignV4(req http.Request, accessKey, secretAccessKey, location string, body
 	req.Header.Set("Date", timeutils.RFC2882Time(t))
 
 	signedHeaders := getSignedHeaders(req, v4IgnoredHeaders)
+	// Normalize query so that it is sent as signed.
+	req.URL.RawQuery = getCanonicalQueryString(req.URL.Query())
 	// Get canonical request.
-	canonicalRequest := getCanonicalRequest(req, signedHeaders)
+	canonicalRequest := getCanonicalRequest(req, signedHeaders, getHashedPayload(req))
 
 	// Get string to sign from canonical request.
 	stringToSign := getStringToSignV4(t, location, canonicalRequest)
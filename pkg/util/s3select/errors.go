@@ -0,0 +1,58 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"fmt"
+)
+
+// error codes of SelectObjectContent, see
+// https://docs.aws.amazon.com/AmazonS3/latest/API/API_SelectObjectContent.html
+const (
+	ErrCodeInvalidExpressionType        = "InvalidExpressionType"
+	ErrCodeInvalidRequestParameter      = "InvalidRequestParameter"
+	ErrCodeInvalidDataSource            = "InvalidDataSource"
+	ErrCodeInvalidCompressionFormat     = "InvalidCompressionFormat"
+	ErrCodeParseUnexpectedToken         = "ParseUnexpectedToken"
+	ErrCodeParseSelectMissingFrom       = "ParseSelectMissingFrom"
+	ErrCodeParseInvalidTypeParam        = "ParseInvalidTypeParam"
+	ErrCodeUnsupportedSyntax            = "UnsupportedSyntax"
+	ErrCodeUnsupportedFunction          = "UnsupportedFunction"
+	ErrCodeEvaluatorInvalidArguments    = "EvaluatorInvalidArguments"
+	ErrCodeIncorrectSqlFunctionArgument = "IncorrectSqlFunctionArgumentType"
+	ErrCodeCastFailed                   = "CastFailed"
+	ErrCodeDivisionByZero               = "DivisionByZero"
+	ErrCodeCSVParsingError              = "CSVParsingError"
+	ErrCodeJSONParsingError             = "JSONParsingError"
+	ErrCodeInternalError                = "InternalError"
+)
+
+// SSelectError is a client error of select request, Code is reported to
+// client as S3 error code
+type SSelectError struct {
+	Code    string
+	Message string
+}
+
+func (e *SSelectError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func newError(code string, msgFmt string, args ...interface{}) *SSelectError {
+	return &SSelectError{
+		Code:    code,
+		Message: fmt.Sprintf(msgFmt, args...),
+	}
+}
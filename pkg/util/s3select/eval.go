@@ -0,0 +1,693 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+type sPathElem struct {
+	name string
+	// quoted names are matched case sensitively
+	quoted  bool
+	index   int
+	isIndex bool
+}
+
+// iRecord is a row of CSV or a JSON document
+type iRecord interface {
+	get(path []sPathElem) sValue
+	// columns lists all columns for SELECT *
+	columns() ([]string, []sValue)
+}
+
+type sExpr interface {
+	eval(rec iRecord) (sValue, error)
+	children() []sExpr
+}
+
+func walkExpr(expr sExpr, fn func(sExpr)) {
+	fn(expr)
+	for _, c := range expr.children() {
+		walkExpr(c, fn)
+	}
+}
+
+// isTrue is used by WHERE clause, NULL and MISSING are not true
+func isTrue(expr sExpr, rec iRecord) (bool, error) {
+	v, err := expr.eval(rec)
+	if err != nil {
+		return false, err
+	}
+	return v.kind == kindBool && v.b, nil
+}
+
+func toBool(v sValue) (sValue, error) {
+	switch v.kind {
+	case kindMissing, kindNull, kindBool:
+		return v, nil
+	case kindString:
+		return castValue(v, castBool)
+	}
+	return nullValue, newError(ErrCodeEvaluatorInvalidArguments, "%s is not a boolean", v.String())
+}
+
+type literalExpr struct {
+	val sValue
+}
+
+func (e *literalExpr) eval(rec iRecord) (sValue, error) { return e.val, nil }
+func (e *literalExpr) children() []sExpr                { return nil }
+
+type columnExpr struct {
+	path []sPathElem
+}
+
+func (e *columnExpr) eval(rec iRecord) (sValue, error) { return rec.get(e.path), nil }
+func (e *columnExpr) children() []sExpr                { return nil }
+
+// name is the key of the column in JSON output
+func (e *columnExpr) name() string {
+	for i := len(e.path) - 1; i >= 0; i-- {
+		if !e.path[i].isIndex {
+			return e.path[i].name
+		}
+	}
+	return ""
+}
+
+type logicExpr struct {
+	op          string
+	left, right sExpr
+}
+
+func (e *logicExpr) children() []sExpr { return []sExpr{e.left, e.right} }
+
+func (e *logicExpr) eval(rec iRecord) (sValue, error) {
+	lv, err := e.left.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	l, err := toBool(lv)
+	if err != nil {
+		return nullValue, err
+	}
+	// short circuit
+	if l.kind == kindBool && l.b == (e.op == "OR") {
+		return l, nil
+	}
+	rv, err := e.right.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	r, err := toBool(rv)
+	if err != nil {
+		return nullValue, err
+	}
+	if r.kind == kindBool && r.b == (e.op == "OR") {
+		return r, nil
+	}
+	if l.isNull() || r.isNull() {
+		return nullValue, nil
+	}
+	return boolValue(e.op == "AND"), nil
+}
+
+type notExpr struct {
+	expr sExpr
+}
+
+func (e *notExpr) children() []sExpr { return []sExpr{e.expr} }
+
+func (e *notExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.expr.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	b, err := toBool(v)
+	if err != nil || b.isNull() {
+		return nullValue, err
+	}
+	return boolValue(!b.b), nil
+}
+
+type compareExpr struct {
+	op          string
+	left, right sExpr
+}
+
+func (e *compareExpr) children() []sExpr { return []sExpr{e.left, e.right} }
+
+func (e *compareExpr) eval(rec iRecord) (sValue, error) {
+	l, err := e.left.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	r, err := e.right.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if l.isNull() || r.isNull() {
+		return nullValue, nil
+	}
+	cmp, ok := compareValues(l, r)
+	if !ok {
+		switch e.op {
+		case "=":
+			return boolValue(false), nil
+		case "!=":
+			return boolValue(true), nil
+		}
+		return nullValue, nil
+	}
+	switch e.op {
+	case "=":
+		return boolValue(cmp == 0), nil
+	case "!=":
+		return boolValue(cmp != 0), nil
+	case "<":
+		return boolValue(cmp < 0), nil
+	case "<=":
+		return boolValue(cmp <= 0), nil
+	case ">":
+		return boolValue(cmp > 0), nil
+	default:
+		return boolValue(cmp >= 0), nil
+	}
+}
+
+type isExpr struct {
+	expr    sExpr
+	not     bool
+	missing bool
+}
+
+func (e *isExpr) children() []sExpr { return []sExpr{e.expr} }
+
+func (e *isExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.expr.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	var ret bool
+	if e.missing {
+		ret = v.kind == kindMissing
+	} else {
+		ret = v.isNull()
+	}
+	return boolValue(ret != e.not), nil
+}
+
+type likeExpr struct {
+	expr    sExpr
+	pattern sExpr
+	escape  sExpr
+	not     bool
+
+	// compiled patterns, pattern is usually a literal
+	cache map[string]*regexp.Regexp
+}
+
+func (e *likeExpr) children() []sExpr {
+	if e.escape != nil {
+		return []sExpr{e.expr, e.pattern, e.escape}
+	}
+	return []sExpr{e.expr, e.pattern}
+}
+
+func compileLike(pattern string, escape rune) (*regexp.Regexp, error) {
+	buf := strings.Builder{}
+	buf.WriteString("(?s)^")
+	escaped := false
+	for _, c := range pattern {
+		if escaped {
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+			continue
+		}
+		switch {
+		case escape != 0 && c == escape:
+			escaped = true
+		case c == '%':
+			buf.WriteString(".*")
+		case c == '_':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if escaped {
+		return nil, newError(ErrCodeEvaluatorInvalidArguments, "LIKE pattern %q ends with escape character", pattern)
+	}
+	buf.WriteString("$")
+	return regexp.Compile(buf.String())
+}
+
+func (e *likeExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.expr.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	p, err := e.pattern.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if v.isNull() || p.isNull() {
+		return nullValue, nil
+	}
+	var escape rune
+	escStr := ""
+	if e.escape != nil {
+		esc, err := e.escape.eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		escStr = esc.String()
+		if utf8.RuneCountInString(escStr) != 1 {
+			return nullValue, newError(ErrCodeEvaluatorInvalidArguments, "ESCAPE must be a single character")
+		}
+		escape, _ = utf8.DecodeRuneInString(escStr)
+	}
+	key := escStr + "\x00" + p.String()
+	re, ok := e.cache[key]
+	if !ok {
+		re, err = compileLike(p.String(), escape)
+		if err != nil {
+			return nullValue, err
+		}
+		if e.cache == nil {
+			e.cache = make(map[string]*regexp.Regexp)
+		}
+		e.cache[key] = re
+	}
+	return boolValue(re.MatchString(v.String()) != e.not), nil
+}
+
+type inExpr struct {
+	expr sExpr
+	list []sExpr
+	not  bool
+}
+
+func (e *inExpr) children() []sExpr { return append([]sExpr{e.expr}, e.list...) }
+
+func (e *inExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.expr.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if v.isNull() {
+		return nullValue, nil
+	}
+	hasNull := false
+	for _, item := range e.list {
+		iv, err := item.eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		if iv.isNull() {
+			hasNull = true
+			continue
+		}
+		if cmp, ok := compareValues(v, iv); ok && cmp == 0 {
+			return boolValue(!e.not), nil
+		}
+	}
+	if hasNull {
+		return nullValue, nil
+	}
+	return boolValue(e.not), nil
+}
+
+type betweenExpr struct {
+	expr      sExpr
+	low, high sExpr
+	not       bool
+}
+
+func (e *betweenExpr) children() []sExpr { return []sExpr{e.expr, e.low, e.high} }
+
+func (e *betweenExpr) eval(rec iRecord) (sValue, error) {
+	vals := make([]sValue, 3)
+	for i, expr := range []sExpr{e.expr, e.low, e.high} {
+		v, err := expr.eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		if v.isNull() {
+			return nullValue, nil
+		}
+		vals[i] = v
+	}
+	low, ok1 := compareValues(vals[0], vals[1])
+	high, ok2 := compareValues(vals[0], vals[2])
+	if !ok1 || !ok2 {
+		return nullValue, nil
+	}
+	return boolValue((low >= 0 && high <= 0) != e.not), nil
+}
+
+type arithExpr struct {
+	op          string
+	left, right sExpr
+}
+
+func (e *arithExpr) children() []sExpr { return []sExpr{e.left, e.right} }
+
+func (e *arithExpr) eval(rec iRecord) (sValue, error) {
+	l, err := e.left.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	r, err := e.right.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	if l.isNull() || r.isNull() {
+		return nullValue, nil
+	}
+	if e.op == "||" {
+		return stringValue(l.String() + r.String()), nil
+	}
+	ln, ok := l.toNumber()
+	if !ok {
+		return nullValue, newError(ErrCodeEvaluatorInvalidArguments, "%q is not a number", l.String())
+	}
+	rn, ok := r.toNumber()
+	if !ok {
+		return nullValue, newError(ErrCodeEvaluatorInvalidArguments, "%q is not a number", r.String())
+	}
+	if ln.kind == kindInt && rn.kind == kindInt {
+		a, b := ln.i, rn.i
+		switch e.op {
+		case "+":
+			return intValue(a + b), nil
+		case "-":
+			return intValue(a - b), nil
+		case "*":
+			return intValue(a * b), nil
+		}
+		if b == 0 {
+			return nullValue, newError(ErrCodeDivisionByZero, "division by zero")
+		}
+		if e.op == "/" {
+			return intValue(a / b), nil
+		}
+		return intValue(a % b), nil
+	}
+	a, b := ln.float(), rn.float()
+	switch e.op {
+	case "+":
+		return floatValue(a + b), nil
+	case "-":
+		return floatValue(a - b), nil
+	case "*":
+		return floatValue(a * b), nil
+	}
+	if b == 0 {
+		return nullValue, newError(ErrCodeDivisionByZero, "division by zero")
+	}
+	if e.op == "/" {
+		return floatValue(a / b), nil
+	}
+	return floatValue(math.Mod(a, b)), nil
+}
+
+type negExpr struct {
+	expr sExpr
+}
+
+func (e *negExpr) children() []sExpr { return []sExpr{e.expr} }
+
+func (e *negExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.expr.eval(rec)
+	if err != nil || v.isNull() {
+		return v, err
+	}
+	n, ok := v.toNumber()
+	if !ok {
+		return nullValue, newError(ErrCodeEvaluatorInvalidArguments, "%q is not a number", v.String())
+	}
+	if n.kind == kindInt {
+		return intValue(-n.i), nil
+	}
+	return floatValue(-n.f), nil
+}
+
+type castExpr struct {
+	expr sExpr
+	typ  string
+}
+
+func (e *castExpr) children() []sExpr { return []sExpr{e.expr} }
+
+func (e *castExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.expr.eval(rec)
+	if err != nil {
+		return nullValue, err
+	}
+	return castValue(v, e.typ)
+}
+
+type sFuncDef struct {
+	minArgs int
+	// -1 for variadic
+	maxArgs int
+	fn      func(args []sValue) (sValue, error)
+}
+
+var functions map[string]sFuncDef
+
+func init() {
+	functions = map[string]sFuncDef{
+		"LOWER": {1, 1, func(args []sValue) (sValue, error) {
+			return stringValue(strings.ToLower(args[0].String())), nil
+		}},
+		"UPPER": {1, 1, func(args []sValue) (sValue, error) {
+			return stringValue(strings.ToUpper(args[0].String())), nil
+		}},
+		"CHAR_LENGTH":      {1, 1, funcCharLength},
+		"CHARACTER_LENGTH": {1, 1, funcCharLength},
+		"SUBSTRING":        {2, 3, funcSubstring},
+		"COALESCE":         {1, -1, nil},
+		"NULLIF": {2, 2, func(args []sValue) (sValue, error) {
+			if cmp, ok := compareValues(args[0], args[1]); ok && cmp == 0 {
+				return nullValue, nil
+			}
+			return args[0], nil
+		}},
+	}
+}
+
+func funcCharLength(args []sValue) (sValue, error) {
+	return intValue(int64(utf8.RuneCountInString(args[0].String()))), nil
+}
+
+// funcSubstring follows SQL semantics, start is 1-based and may be
+// smaller than 1
+func funcSubstring(args []sValue) (sValue, error) {
+	runes := []rune(args[0].String())
+	start, err := castValue(args[1], castInt)
+	if err != nil {
+		return nullValue, newError(ErrCodeIncorrectSqlFunctionArgument, "SUBSTRING start must be an integer")
+	}
+	begin := start.i
+	end := int64(len(runes)) + 1
+	if len(args) > 2 {
+		length, err := castValue(args[2], castInt)
+		if err != nil || length.i < 0 {
+			return nullValue, newError(ErrCodeIncorrectSqlFunctionArgument, "SUBSTRING length must be a non-negative integer")
+		}
+		if begin+length.i < end {
+			end = begin + length.i
+		}
+	}
+	if begin < 1 {
+		begin = 1
+	}
+	if begin >= end {
+		return stringValue(""), nil
+	}
+	return stringValue(string(runes[begin-1 : end-1])), nil
+}
+
+type funcExpr struct {
+	name string
+	args []sExpr
+	def  sFuncDef
+}
+
+func newFuncExpr(name string, args []sExpr) (sExpr, error) {
+	def, ok := functions[name]
+	if !ok {
+		return nil, newError(ErrCodeUnsupportedFunction, "unsupported function %s", name)
+	}
+	if len(args) < def.minArgs || (def.maxArgs >= 0 && len(args) > def.maxArgs) {
+		return nil, newError(ErrCodeEvaluatorInvalidArguments, "invalid number of arguments for %s", name)
+	}
+	return &funcExpr{name: name, args: args, def: def}, nil
+}
+
+func (e *funcExpr) children() []sExpr { return e.args }
+
+func (e *funcExpr) eval(rec iRecord) (sValue, error) {
+	if e.name == "COALESCE" {
+		for _, arg := range e.args {
+			v, err := arg.eval(rec)
+			if err != nil {
+				return nullValue, err
+			}
+			if !v.isNull() {
+				return v, nil
+			}
+		}
+		return nullValue, nil
+	}
+	args := make([]sValue, len(e.args))
+	for i := range e.args {
+		v, err := e.args[i].eval(rec)
+		if err != nil {
+			return nullValue, err
+		}
+		if v.isNull() && e.name != "NULLIF" {
+			return nullValue, nil
+		}
+		args[i] = v
+	}
+	return e.def.fn(args)
+}
+
+type trimExpr struct {
+	// LEADING, TRAILING or BOTH
+	mode  string
+	chars sExpr
+	str   sExpr
+}
+
+func (e *trimExpr) children() []sExpr {
+	if e.chars != nil {
+		return []sExpr{e.chars, e.str}
+	}
+	return []sExpr{e.str}
+}
+
+func (e *trimExpr) eval(rec iRecord) (sValue, error) {
+	v, err := e.str.eval(rec)
+	if err != nil || v.isNull() {
+		return v, err
+	}
+	cutset := " "
+	if e.chars != nil {
+		c, err := e.chars.eval(rec)
+		if err != nil || c.isNull() {
+			return c, err
+		}
+		cutset = c.String()
+	}
+	s := v.String()
+	switch e.mode {
+	case "LEADING":
+		s = strings.TrimLeft(s, cutset)
+	case "TRAILING":
+		s = strings.TrimRight(s, cutset)
+	default:
+		s = strings.Trim(s, cutset)
+	}
+	return stringValue(s), nil
+}
+
+// aggExpr keeps state of aggregation, accumulate is called for each
+// matched record and eval returns the result after all records are read
+type aggExpr struct {
+	fn string
+	// nil for COUNT(*)
+	arg sExpr
+
+	count int64
+	sum   sValue
+	ext   sValue
+}
+
+func (e *aggExpr) children() []sExpr {
+	if e.arg != nil {
+		return []sExpr{e.arg}
+	}
+	return nil
+}
+
+func (e *aggExpr) accumulate(rec iRecord) error {
+	if e.arg == nil {
+		e.count++
+		return nil
+	}
+	v, err := e.arg.eval(rec)
+	if err != nil {
+		return err
+	}
+	if v.isNull() {
+		return nil
+	}
+	switch e.fn {
+	case "SUM", "AVG":
+		n, ok := v.toNumber()
+		if !ok {
+			return newError(ErrCodeIncorrectSqlFunctionArgument, "%s of non-numeric value %q", e.fn, v.String())
+		}
+		if e.count == 0 {
+			e.sum = n
+		} else if e.sum.kind == kindInt && n.kind == kindInt {
+			e.sum = intValue(e.sum.i + n.i)
+		} else {
+			e.sum = floatValue(e.sum.float() + n.float())
+		}
+	case "MIN", "MAX":
+		if n, ok := v.toNumber(); ok {
+			v = n
+		}
+		if e.count == 0 {
+			e.ext = v
+		} else {
+			cmp, ok := compareValues(v, e.ext)
+			if !ok {
+				return newError(ErrCodeIncorrectSqlFunctionArgument, "%s of incomparable values", e.fn)
+			}
+			if (e.fn == "MIN" && cmp < 0) || (e.fn == "MAX" && cmp > 0) {
+				e.ext = v
+			}
+		}
+	}
+	e.count++
+	return nil
+}
+
+func (e *aggExpr) eval(rec iRecord) (sValue, error) {
+	switch e.fn {
+	case "COUNT":
+		return intValue(e.count), nil
+	}
+	if e.count == 0 {
+		return nullValue, nil
+	}
+	switch e.fn {
+	case "SUM":
+		return e.sum, nil
+	case "AVG":
+		return floatValue(e.sum.float() / float64(e.count)), nil
+	}
+	return e.ext, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"hash/crc32"
+	"io"
+
+	"yunion.io/x/s3cli"
+)
+
+const (
+	eventRecords  = "Records"
+	eventStats    = "Stats"
+	eventProgress = "Progress"
+	eventEnd      = "End"
+
+	// header value type of string
+	headerTypeString = 7
+)
+
+type sHeader struct {
+	name  string
+	value string
+}
+
+func writeHeaders(buf *bytes.Buffer, headers []sHeader) {
+	for _, h := range headers {
+		buf.WriteByte(byte(len(h.name)))
+		buf.WriteString(h.name)
+		buf.WriteByte(headerTypeString)
+		binary.Write(buf, binary.BigEndian, uint16(len(h.value)))
+		buf.WriteString(h.value)
+	}
+}
+
+// encodeMessage encodes a message of AWS event stream:
+// prelude (total length, headers length, prelude crc), headers, payload
+// and message crc
+func encodeMessage(headers []sHeader, payload []byte) []byte {
+	hdrBuf := bytes.Buffer{}
+	writeHeaders(&hdrBuf, headers)
+
+	totalLen := 4 + 4 + 4 + hdrBuf.Len() + len(payload) + 4
+	msg := bytes.NewBuffer(make([]byte, 0, totalLen))
+	binary.Write(msg, binary.BigEndian, uint32(totalLen))
+	binary.Write(msg, binary.BigEndian, uint32(hdrBuf.Len()))
+	binary.Write(msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	msg.Write(hdrBuf.Bytes())
+	msg.Write(payload)
+	binary.Write(msg, binary.BigEndian, crc32.ChecksumIEEE(msg.Bytes()))
+	return msg.Bytes()
+}
+
+func eventHeaders(event string, contentType string) []sHeader {
+	headers := []sHeader{{":event-type", event}}
+	if len(contentType) > 0 {
+		headers = append(headers, sHeader{":content-type", contentType})
+	}
+	return append(headers, sHeader{":message-type", "event"})
+}
+
+func writeRecordsEvent(w io.Writer, payload []byte) error {
+	_, err := w.Write(encodeMessage(eventHeaders(eventRecords, "application/octet-stream"), payload))
+	return err
+}
+
+func writeStatsEvent(w io.Writer, event string, stats s3cli.StatsMessage) error {
+	var payload []byte
+	var err error
+	if event == eventProgress {
+		payload, err = xml.Marshal(s3cli.ProgressMessage{StatsMessage: stats})
+	} else {
+		payload, err = xml.Marshal(stats)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encodeMessage(eventHeaders(event, "text/xml"), payload))
+	return err
+}
+
+func writeEndEvent(w io.Writer) error {
+	_, err := w.Write(encodeMessage(eventHeaders(eventEnd, ""), nil))
+	return err
+}
+
+func writeErrorEvent(w io.Writer, code string, msg string) error {
+	headers := []sHeader{
+		{":error-code", code},
+		{":error-message", msg},
+		{":message-type", "error"},
+	}
+	_, err := w.Write(encodeMessage(headers, nil))
+	return err
+}
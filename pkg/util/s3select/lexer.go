@@ -0,0 +1,150 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	// unquoted identifier or keyword
+	tokenIdent
+	// double quoted identifier, case sensitive
+	tokenQuotedIdent
+	// single quoted string literal
+	tokenString
+	tokenNumber
+	tokenOp
+)
+
+type sToken struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t sToken) isKeyword(kw string) bool {
+	return t.typ == tokenIdent && strings.EqualFold(t.val, kw)
+}
+
+func (t sToken) isOp(op string) bool {
+	return t.typ == tokenOp && t.val == op
+}
+
+func (t sToken) String() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return "'" + t.val + "'"
+	case tokenQuotedIdent:
+		return `"` + t.val + `"`
+	}
+	return t.val
+}
+
+var twoCharOps = []string{"<=", ">=", "<>", "!=", "||"}
+
+func tokenize(sql string) ([]sToken, error) {
+	tokens := make([]sToken, 0)
+	runes := []rune(sql)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'' || c == '"':
+			// quote is escaped by doubling it
+			buf := strings.Builder{}
+			j := i + 1
+			closed := false
+			for j < len(runes) {
+				if runes[j] == c {
+					if j+1 < len(runes) && runes[j+1] == c {
+						buf.WriteRune(c)
+						j += 2
+						continue
+					}
+					closed = true
+					break
+				}
+				buf.WriteRune(runes[j])
+				j++
+			}
+			if !closed {
+				return nil, newError(ErrCodeParseUnexpectedToken, "unterminated quote at position %d", i)
+			}
+			typ := tokenString
+			if c == '"' {
+				typ = tokenQuotedIdent
+			}
+			tokens = append(tokens, sToken{typ: typ, val: buf.String(), pos: i})
+			i = j + 1
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			if j < len(runes) && (runes[j] == 'e' || runes[j] == 'E') {
+				k := j + 1
+				if k < len(runes) && (runes[k] == '+' || runes[k] == '-') {
+					k++
+				}
+				if k < len(runes) && unicode.IsDigit(runes[k]) {
+					j = k
+					for j < len(runes) && unicode.IsDigit(runes[j]) {
+						j++
+					}
+				}
+			}
+			tokens = append(tokens, sToken{typ: tokenNumber, val: string(runes[i:j]), pos: i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, sToken{typ: tokenIdent, val: string(runes[i:j]), pos: i})
+			i = j
+		default:
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				found := false
+				for _, op := range twoCharOps {
+					if two == op {
+						found = true
+						break
+					}
+				}
+				if found {
+					tokens = append(tokens, sToken{typ: tokenOp, val: two, pos: i})
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("=<>+-*/%(),.[]", c) {
+				return nil, newError(ErrCodeParseUnexpectedToken, "unexpected character %q at position %d", c, i)
+			}
+			tokens = append(tokens, sToken{typ: tokenOp, val: string(c), pos: i})
+			i++
+		}
+	}
+	tokens = append(tokens, sToken{typ: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
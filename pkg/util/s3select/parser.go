@@ -0,0 +1,680 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"strconv"
+	"strings"
+)
+
+const s3ObjectName = "S3Object"
+
+var reservedWords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "LIMIT": true, "AS": true,
+	"AND": true, "OR": true, "NOT": true, "LIKE": true, "ESCAPE": true,
+	"IN": true, "BETWEEN": true, "IS": true, "NULL": true, "MISSING": true,
+	"TRUE": true, "FALSE": true, "CAST": true,
+}
+
+type sProjection struct {
+	expr  sExpr
+	alias string
+}
+
+type sSelectStatement struct {
+	star        bool
+	projections []sProjection
+
+	fromAlias string
+	// FROM S3Object[*] iterates elements of top-level json arrays
+	fromStar bool
+
+	where sExpr
+	// -1 if no limit
+	limit int64
+
+	aggregates []*aggExpr
+}
+
+func (stmt *sSelectStatement) isAggregate() bool {
+	return len(stmt.aggregates) > 0
+}
+
+type sParser struct {
+	tokens []sToken
+	pos    int
+}
+
+// parseSelect parses the SQL subset supported by S3 Select:
+// SELECT projections FROM S3Object [alias] [WHERE condition] [LIMIT number]
+func parseSelect(sql string) (*sSelectStatement, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &sParser{tokens: tokens}
+	stmt, err := p.parseStatement()
+	if err != nil {
+		return nil, err
+	}
+	err = stmt.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *sParser) peek() sToken {
+	return p.tokens[p.pos]
+}
+
+func (p *sParser) next() sToken {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *sParser) unexpected(t sToken) error {
+	return newError(ErrCodeParseUnexpectedToken, "unexpected token %s at position %d", t, t.pos)
+}
+
+func (p *sParser) expectKeyword(kw string) error {
+	t := p.next()
+	if !t.isKeyword(kw) {
+		return p.unexpected(t)
+	}
+	return nil
+}
+
+func (p *sParser) expectOp(op string) error {
+	t := p.next()
+	if !t.isOp(op) {
+		return p.unexpected(t)
+	}
+	return nil
+}
+
+func (p *sParser) acceptKeyword(kw string) bool {
+	if p.peek().isKeyword(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sParser) acceptOp(op string) bool {
+	if p.peek().isOp(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sParser) parseStatement() (*sSelectStatement, error) {
+	stmt := &sSelectStatement{limit: -1}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	if p.acceptOp("*") {
+		stmt.star = true
+	} else {
+		for {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			proj := sProjection{expr: expr}
+			if p.acceptKeyword("AS") {
+				alias, err := p.parseAlias()
+				if err != nil {
+					return nil, err
+				}
+				proj.alias = alias
+			} else if t := p.peek(); (t.typ == tokenIdent && !reservedWords[strings.ToUpper(t.val)]) || t.typ == tokenQuotedIdent {
+				proj.alias = p.next().val
+			}
+			stmt.projections = append(stmt.projections, proj)
+			if !p.acceptOp(",") {
+				break
+			}
+		}
+	}
+
+	if !p.acceptKeyword("FROM") {
+		return nil, newError(ErrCodeParseSelectMissingFrom, "missing FROM clause")
+	}
+	if !p.acceptKeyword(s3ObjectName) {
+		t := p.peek()
+		return nil, newError(ErrCodeUnsupportedSyntax, "only %s is supported in FROM clause, got %s", s3ObjectName, t)
+	}
+	if p.acceptOp("[") {
+		if err := p.expectOp("*"); err != nil {
+			return nil, err
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		stmt.fromStar = true
+	}
+	if p.peek().isOp(".") {
+		return nil, newError(ErrCodeUnsupportedSyntax, "path in FROM clause is not supported")
+	}
+	if p.acceptKeyword("AS") {
+		alias, err := p.parseAlias()
+		if err != nil {
+			return nil, err
+		}
+		stmt.fromAlias = alias
+	} else if t := p.peek(); t.typ == tokenIdent && !reservedWords[strings.ToUpper(t.val)] {
+		stmt.fromAlias = p.next().val
+	}
+
+	if p.acceptKeyword("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.where = where
+	}
+	if p.acceptKeyword("LIMIT") {
+		t := p.next()
+		if t.typ != tokenNumber {
+			return nil, p.unexpected(t)
+		}
+		limit, err := strconv.ParseInt(t.val, 10, 64)
+		if err != nil || limit < 0 {
+			return nil, newError(ErrCodeParseUnexpectedToken, "invalid LIMIT %s", t.val)
+		}
+		stmt.limit = limit
+	}
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+	return stmt, nil
+}
+
+func (p *sParser) parseAlias() (string, error) {
+	t := p.next()
+	if t.typ == tokenQuotedIdent || (t.typ == tokenIdent && !reservedWords[strings.ToUpper(t.val)]) {
+		return t.val, nil
+	}
+	return "", p.unexpected(t)
+}
+
+func (p *sParser) parseExpr() (sExpr, error) {
+	return p.parseOr()
+}
+
+func (p *sParser) parseOr() (sExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicExpr{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sParser) parseAnd() (sExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicExpr{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sParser) parseNot() (sExpr, error) {
+	if p.acceptKeyword("NOT") {
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{expr: expr}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *sParser) parseComparison() (sExpr, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	if t.typ == tokenOp {
+		switch t.val {
+		case "=", "!=", "<>", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			op := t.val
+			if op == "<>" {
+				op = "!="
+			}
+			return &compareExpr{op: op, left: left, right: right}, nil
+		}
+		return left, nil
+	}
+	if t.isKeyword("IS") {
+		p.next()
+		not := p.acceptKeyword("NOT")
+		if p.acceptKeyword("NULL") {
+			return &isExpr{expr: left, not: not}, nil
+		}
+		if p.acceptKeyword("MISSING") {
+			return &isExpr{expr: left, not: not, missing: true}, nil
+		}
+		return nil, p.unexpected(p.peek())
+	}
+	not := false
+	if t.isKeyword("NOT") {
+		// only NOT LIKE, NOT IN and NOT BETWEEN are allowed here
+		nt := p.tokens[p.pos+1]
+		if !nt.isKeyword("LIKE") && !nt.isKeyword("IN") && !nt.isKeyword("BETWEEN") {
+			return left, nil
+		}
+		p.next()
+		not = true
+		t = p.peek()
+	}
+	switch {
+	case t.isKeyword("LIKE"):
+		p.next()
+		pattern, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		like := &likeExpr{expr: left, pattern: pattern, not: not}
+		if p.acceptKeyword("ESCAPE") {
+			escape, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			like.escape = escape
+		}
+		return like, nil
+	case t.isKeyword("IN"):
+		p.next()
+		if err := p.expectOp("("); err != nil {
+			return nil, err
+		}
+		list, err := p.parseExprList(")")
+		if err != nil {
+			return nil, err
+		}
+		return &inExpr{expr: left, list: list, not: not}, nil
+	case t.isKeyword("BETWEEN"):
+		p.next()
+		low, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenExpr{expr: left, low: low, high: high, not: not}, nil
+	}
+	return left, nil
+}
+
+func (p *sParser) parseAdditive() (sExpr, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.isOp("+") && !t.isOp("-") && !t.isOp("||") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: t.val, left: left, right: right}
+	}
+}
+
+func (p *sParser) parseMultiplicative() (sExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if !t.isOp("*") && !t.isOp("/") && !t.isOp("%") {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithExpr{op: t.val, left: left, right: right}
+	}
+}
+
+func (p *sParser) parseUnary() (sExpr, error) {
+	if p.acceptOp("-") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &negExpr{expr: expr}, nil
+	}
+	if p.acceptOp("+") {
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *sParser) parseExprList(end string) ([]sExpr, error) {
+	list := make([]sExpr, 0)
+	if p.acceptOp(end) {
+		return list, nil
+	}
+	for {
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, expr)
+		if p.acceptOp(end) {
+			return list, nil
+		}
+		if err := p.expectOp(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *sParser) parsePrimary() (sExpr, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.val, 10, 64); err == nil {
+			return &literalExpr{val: intValue(i)}, nil
+		}
+		f, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, newError(ErrCodeParseUnexpectedToken, "invalid number %s", t.val)
+		}
+		return &literalExpr{val: floatValue(f)}, nil
+	case tokenString:
+		return &literalExpr{val: stringValue(t.val)}, nil
+	case tokenQuotedIdent:
+		return p.parseColumn(sPathElem{name: t.val, quoted: true})
+	case tokenOp:
+		if t.val == "(" {
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return expr, nil
+		}
+		return nil, p.unexpected(t)
+	case tokenIdent:
+		switch strings.ToUpper(t.val) {
+		case "TRUE":
+			return &literalExpr{val: boolValue(true)}, nil
+		case "FALSE":
+			return &literalExpr{val: boolValue(false)}, nil
+		case "NULL":
+			return &literalExpr{val: nullValue}, nil
+		case "MISSING":
+			return &literalExpr{val: missingValue}, nil
+		case "CAST":
+			return p.parseCast()
+		}
+		if reservedWords[strings.ToUpper(t.val)] {
+			return nil, p.unexpected(t)
+		}
+		if p.acceptOp("(") {
+			return p.parseFunction(strings.ToUpper(t.val))
+		}
+		return p.parseColumn(sPathElem{name: t.val})
+	}
+	return nil, p.unexpected(t)
+}
+
+func (p *sParser) parseColumn(first sPathElem) (sExpr, error) {
+	col := &columnExpr{path: []sPathElem{first}}
+	for {
+		if p.acceptOp(".") {
+			t := p.next()
+			switch t.typ {
+			case tokenIdent:
+				col.path = append(col.path, sPathElem{name: t.val})
+			case tokenQuotedIdent:
+				col.path = append(col.path, sPathElem{name: t.val, quoted: true})
+			default:
+				return nil, p.unexpected(t)
+			}
+		} else if p.acceptOp("[") {
+			t := p.next()
+			if t.typ != tokenNumber {
+				return nil, p.unexpected(t)
+			}
+			idx, err := strconv.Atoi(t.val)
+			if err != nil || idx < 0 {
+				return nil, newError(ErrCodeParseUnexpectedToken, "invalid index %s", t.val)
+			}
+			if err := p.expectOp("]"); err != nil {
+				return nil, err
+			}
+			col.path = append(col.path, sPathElem{index: idx, isIndex: true})
+		} else {
+			return col, nil
+		}
+	}
+}
+
+func (p *sParser) parseCast() (sExpr, error) {
+	if err := p.expectOp("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	t := p.next()
+	typ, ok := castTypes[strings.ToUpper(t.val)]
+	if t.typ != tokenIdent || !ok {
+		return nil, newError(ErrCodeParseInvalidTypeParam, "unsupported type %s in CAST", t)
+	}
+	if err := p.expectOp(")"); err != nil {
+		return nil, err
+	}
+	return &castExpr{expr: expr, typ: typ}, nil
+}
+
+func (p *sParser) parseFunction(name string) (sExpr, error) {
+	switch name {
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		agg := &aggExpr{fn: name}
+		if name == "COUNT" && p.acceptOp("*") {
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return agg, nil
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		agg.arg = arg
+		return agg, nil
+	case "SUBSTRING":
+		// SUBSTRING(str FROM start [FOR length]) or SUBSTRING(str, start[, length])
+		str, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args := []sExpr{str}
+		if p.acceptKeyword("FROM") {
+			start, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, start)
+			if p.acceptKeyword("FOR") {
+				length, err := p.parseExpr()
+				if err != nil {
+					return nil, err
+				}
+				args = append(args, length)
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := p.expectOp(","); err != nil {
+				return nil, err
+			}
+			rest, err := p.parseExprList(")")
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, rest...)
+		}
+		return newFuncExpr(name, args)
+	case "TRIM":
+		// TRIM([[LEADING|TRAILING|BOTH] [chars] FROM] str)
+		mode := "BOTH"
+		for _, m := range []string{"LEADING", "TRAILING", "BOTH"} {
+			if p.acceptKeyword(m) {
+				mode = m
+				break
+			}
+		}
+		var chars sExpr
+		if !p.acceptKeyword("FROM") {
+			first, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if p.acceptKeyword("FROM") {
+				chars = first
+			} else {
+				if err := p.expectOp(")"); err != nil {
+					return nil, err
+				}
+				return &trimExpr{mode: mode, str: first}, nil
+			}
+		}
+		str, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return &trimExpr{mode: mode, chars: chars, str: str}, nil
+	}
+	args, err := p.parseExprList(")")
+	if err != nil {
+		return nil, err
+	}
+	return newFuncExpr(name, args)
+}
+
+// resolve strips FROM alias from column paths and checks aggregates
+func (stmt *sSelectStatement) resolve() error {
+	aliases := []string{s3ObjectName}
+	if len(stmt.fromAlias) > 0 {
+		aliases = append(aliases, stmt.fromAlias)
+	}
+	var err error
+	resolveColumn := func(expr sExpr) {
+		col, ok := expr.(*columnExpr)
+		if !ok || len(col.path) < 2 || col.path[0].isIndex {
+			return
+		}
+		for _, alias := range aliases {
+			if strings.EqualFold(col.path[0].name, alias) {
+				col.path = col.path[1:]
+				return
+			}
+		}
+	}
+	if stmt.where != nil {
+		walkExpr(stmt.where, func(expr sExpr) {
+			resolveColumn(expr)
+			if _, ok := expr.(*aggExpr); ok {
+				err = newError(ErrCodeUnsupportedSyntax, "aggregate function is not allowed in WHERE clause")
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	nonAggregate := false
+	for i := range stmt.projections {
+		hasAgg := false
+		walkExpr(stmt.projections[i].expr, func(expr sExpr) {
+			resolveColumn(expr)
+			if agg, ok := expr.(*aggExpr); ok {
+				if agg.arg != nil {
+					walkExpr(agg.arg, func(inner sExpr) {
+						if _, ok := inner.(*aggExpr); ok {
+							err = newError(ErrCodeUnsupportedSyntax, "nested aggregate function is not allowed")
+						}
+					})
+				}
+				hasAgg = true
+				stmt.aggregates = append(stmt.aggregates, agg)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if !hasAgg {
+			nonAggregate = true
+		}
+	}
+	if len(stmt.aggregates) > 0 && (nonAggregate || stmt.star) {
+		return newError(ErrCodeUnsupportedSyntax, "aggregate and non-aggregate projections cannot be mixed")
+	}
+	return nil
+}
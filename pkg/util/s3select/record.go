@@ -0,0 +1,372 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"yunion.io/x/s3cli"
+)
+
+type iRecordReader interface {
+	// read returns io.EOF if no more records
+	read() (iRecord, error)
+}
+
+type sCSVReader struct {
+	reader *csv.Reader
+
+	header     []string
+	headerIdx  map[string]int
+	headerFold map[string]int
+}
+
+type sCSVRecord struct {
+	reader *sCSVReader
+	fields []string
+}
+
+func singleRune(s string, name string) (rune, error) {
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, newError(ErrCodeInvalidRequestParameter, "%s must be a single character", name)
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// sByteReplaceReader translates single byte record delimiter to '\n'
+// which is the only delimiter understood by encoding/csv
+type sByteReplaceReader struct {
+	reader   io.Reader
+	from, to byte
+}
+
+func (r *sByteReplaceReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] == r.from {
+			p[i] = r.to
+		}
+	}
+	return n, err
+}
+
+func newCSVReader(input io.Reader, opts *s3cli.CSVInputOptions) (*sCSVReader, error) {
+	switch opts.RecordDelimiter {
+	case "", "\n", "\r\n":
+	default:
+		if len(opts.RecordDelimiter) != 1 {
+			return nil, newError(ErrCodeInvalidRequestParameter, "unsupported RecordDelimiter %q", opts.RecordDelimiter)
+		}
+		input = &sByteReplaceReader{reader: input, from: opts.RecordDelimiter[0], to: '\n'}
+	}
+	for _, quote := range []string{opts.QuoteCharacter, opts.QuoteEscapeCharacter} {
+		if len(quote) > 0 && quote != `"` {
+			return nil, newError(ErrCodeInvalidRequestParameter, "unsupported quote character %q", quote)
+		}
+	}
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if len(opts.FieldDelimiter) > 0 {
+		comma, err := singleRune(opts.FieldDelimiter, "FieldDelimiter")
+		if err != nil {
+			return nil, err
+		}
+		reader.Comma = comma
+	}
+	if len(opts.Comments) > 0 {
+		comment, err := singleRune(opts.Comments, "Comments")
+		if err != nil {
+			return nil, err
+		}
+		reader.Comment = comment
+	}
+	r := &sCSVReader{reader: reader}
+	switch strings.ToUpper(string(opts.FileHeaderInfo)) {
+	case "", string(s3cli.CSVFileHeaderInfoNone):
+	case s3cli.CSVFileHeaderInfoIgnore, s3cli.CSVFileHeaderInfoUse:
+		header, err := r.readFields()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if strings.EqualFold(string(opts.FileHeaderInfo), s3cli.CSVFileHeaderInfoUse) {
+			r.header = header
+			r.headerIdx = make(map[string]int, len(header))
+			r.headerFold = make(map[string]int, len(header))
+			for i := len(header) - 1; i >= 0; i-- {
+				r.headerIdx[header[i]] = i
+				r.headerFold[strings.ToLower(header[i])] = i
+			}
+		}
+	default:
+		return nil, newError(ErrCodeInvalidRequestParameter, "invalid FileHeaderInfo %q", opts.FileHeaderInfo)
+	}
+	return r, nil
+}
+
+func (r *sCSVReader) readFields() ([]string, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		if _, ok := err.(*csv.ParseError); ok {
+			return nil, newError(ErrCodeCSVParsingError, "%s", err.Error())
+		}
+		return nil, err
+	}
+	return fields, nil
+}
+
+func (r *sCSVReader) read() (iRecord, error) {
+	fields, err := r.readFields()
+	if err != nil {
+		return nil, err
+	}
+	return &sCSVRecord{reader: r, fields: fields}, nil
+}
+
+func (rec *sCSVRecord) get(path []sPathElem) sValue {
+	if len(path) != 1 || path[0].isIndex {
+		return missingValue
+	}
+	name := path[0].name
+	idx := -1
+	if i, ok := rec.reader.headerIdx[name]; ok {
+		idx = i
+	} else if i, ok := rec.reader.headerFold[strings.ToLower(name)]; ok && !path[0].quoted {
+		idx = i
+	} else if strings.HasPrefix(name, "_") {
+		// positional column _1, _2, ...
+		if n, err := strconv.Atoi(name[1:]); err == nil && n > 0 {
+			idx = n - 1
+		}
+	}
+	if idx < 0 || idx >= len(rec.fields) {
+		return missingValue
+	}
+	return stringValue(rec.fields[idx])
+}
+
+func (rec *sCSVRecord) columns() ([]string, []sValue) {
+	names := make([]string, len(rec.fields))
+	vals := make([]sValue, len(rec.fields))
+	for i := range rec.fields {
+		if i < len(rec.reader.header) {
+			names[i] = rec.reader.header[i]
+		} else {
+			names[i] = fmt.Sprintf("_%d", i+1)
+		}
+		vals[i] = stringValue(rec.fields[i])
+	}
+	return names, vals
+}
+
+// jsonObject keeps order of keys of decoded json object so that
+// SELECT * outputs the document as is
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *jsonObject) get(key string, quoted bool) (interface{}, bool) {
+	if v, ok := o.values[key]; ok {
+		return v, true
+	}
+	if quoted {
+		return nil, false
+	}
+	for _, k := range o.keys {
+		if strings.EqualFold(k, key) {
+			return o.values[k], true
+		}
+	}
+	return nil, false
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func decodeJSON(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		obj := &jsonObject{values: make(map[string]interface{})}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid object key %v", keyTok)
+			}
+			val, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := obj.values[key]; !ok {
+				obj.keys = append(obj.keys, key)
+			}
+			obj.values[key] = val
+		}
+		// closing '}'
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return obj, nil
+	case '[':
+		arr := make([]interface{}, 0)
+		for dec.More() {
+			val, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("unexpected delimiter %s", delim)
+}
+
+type sJSONReader struct {
+	decoder *json.Decoder
+	// iterate elements of top-level arrays
+	unnest bool
+
+	pending []interface{}
+}
+
+type sJSONRecord struct {
+	doc interface{}
+}
+
+func newJSONReader(input io.Reader, opts *s3cli.JSONInputOptions, unnest bool) (*sJSONReader, error) {
+	switch strings.ToUpper(string(opts.Type)) {
+	case "", string(s3cli.JSONDocumentType), s3cli.JSONLinesType:
+	default:
+		return nil, newError(ErrCodeInvalidRequestParameter, "invalid JSON Type %q", opts.Type)
+	}
+	dec := json.NewDecoder(input)
+	dec.UseNumber()
+	return &sJSONReader{decoder: dec, unnest: unnest}, nil
+}
+
+func (r *sJSONReader) read() (iRecord, error) {
+	for len(r.pending) == 0 {
+		doc, err := decodeJSON(r.decoder)
+		if err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			if err == io.ErrUnexpectedEOF {
+				return nil, newError(ErrCodeJSONParsingError, "unexpected end of JSON input")
+			}
+			return nil, newError(ErrCodeJSONParsingError, "%s", err.Error())
+		}
+		if arr, ok := doc.([]interface{}); ok && r.unnest {
+			r.pending = arr
+			continue
+		}
+		return &sJSONRecord{doc: doc}, nil
+	}
+	doc := r.pending[0]
+	r.pending = r.pending[1:]
+	return &sJSONRecord{doc: doc}, nil
+}
+
+func (rec *sJSONRecord) get(path []sPathElem) sValue {
+	cur := rec.doc
+	for _, elem := range path {
+		if elem.isIndex {
+			arr, ok := cur.([]interface{})
+			if !ok || elem.index >= len(arr) {
+				return missingValue
+			}
+			cur = arr[elem.index]
+			continue
+		}
+		obj, ok := cur.(*jsonObject)
+		if !ok {
+			return missingValue
+		}
+		cur, ok = obj.get(elem.name, elem.quoted)
+		if !ok {
+			return missingValue
+		}
+	}
+	return jsonValue(cur)
+}
+
+func (rec *sJSONRecord) columns() ([]string, []sValue) {
+	obj, ok := rec.doc.(*jsonObject)
+	if !ok {
+		return []string{"_1"}, []sValue{jsonValue(rec.doc)}
+	}
+	vals := make([]sValue, len(obj.keys))
+	for i, k := range obj.keys {
+		vals[i] = jsonValue(obj.values[k])
+	}
+	return obj.keys, vals
+}
+
+// emptyRecord is used to evaluate projections of aggregation
+type emptyRecord struct{}
+
+func (rec emptyRecord) get(path []sPathElem) sValue {
+	return missingValue
+}
+
+func (rec emptyRecord) columns() ([]string, []sValue) {
+	return nil, nil
+}
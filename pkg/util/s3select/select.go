@@ -0,0 +1,289 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+)
+
+const (
+	// records are sent in messages of about this size
+	recordsMessageSize = 64 * 1024
+
+	progressInterval = 10 * time.Second
+)
+
+// SSelector runs a SelectObjectContent request against object content
+type SSelector struct {
+	opts *s3cli.SelectObjectOptions
+	stmt *sSelectStatement
+
+	writer iRecordWriter
+}
+
+type sCountingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *sCountingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// NewSelector validates request and parses the SQL expression
+func NewSelector(opts *s3cli.SelectObjectOptions) (*SSelector, error) {
+	if !strings.EqualFold(string(opts.ExpressionType), string(s3cli.QueryExpressionTypeSQL)) {
+		return nil, newError(ErrCodeInvalidExpressionType, "unsupported ExpressionType %q", opts.ExpressionType)
+	}
+	input := opts.InputSerialization
+	if input.Parquet != nil {
+		return nil, newError(ErrCodeInvalidDataSource, "Parquet input is not supported")
+	}
+	if (input.CSV == nil) == (input.JSON == nil) {
+		return nil, newError(ErrCodeInvalidDataSource, "exactly one of CSV and JSON input must be specified")
+	}
+	switch strings.ToUpper(string(input.CompressionType)) {
+	case "", string(s3cli.SelectCompressionNONE), s3cli.SelectCompressionGZIP, s3cli.SelectCompressionBZIP:
+	default:
+		return nil, newError(ErrCodeInvalidCompressionFormat, "unsupported CompressionType %q", input.CompressionType)
+	}
+	sel := &SSelector{opts: opts}
+	output := opts.OutputSerialization
+	switch {
+	case output.CSV != nil && output.JSON == nil:
+		writer, err := newCSVWriter(output.CSV)
+		if err != nil {
+			return nil, err
+		}
+		sel.writer = writer
+	case output.JSON != nil && output.CSV == nil:
+		sel.writer = newJSONWriter(output.JSON)
+	default:
+		return nil, newError(ErrCodeInvalidRequestParameter, "exactly one of CSV and JSON output must be specified")
+	}
+	stmt, err := parseSelect(opts.Expression)
+	if err != nil {
+		return nil, err
+	}
+	sel.stmt = stmt
+	return sel, nil
+}
+
+func (sel *SSelector) openReader(input io.Reader) (iRecordReader, *sCountingReader, error) {
+	switch strings.ToUpper(string(sel.opts.InputSerialization.CompressionType)) {
+	case s3cli.SelectCompressionGZIP:
+		gz, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, nil, newError(ErrCodeInvalidCompressionFormat, "invalid gzip data: %s", err)
+		}
+		input = gz
+	case s3cli.SelectCompressionBZIP:
+		input = bzip2.NewReader(input)
+	}
+	processed := &sCountingReader{reader: input}
+	var reader iRecordReader
+	var err error
+	if sel.opts.InputSerialization.CSV != nil {
+		reader, err = newCSVReader(processed, sel.opts.InputSerialization.CSV)
+	} else {
+		reader, err = newJSONReader(processed, sel.opts.InputSerialization.JSON, sel.stmt.fromStar)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, processed, nil
+}
+
+func (sel *SSelector) project(rec iRecord) ([]string, []sValue, error) {
+	if sel.stmt.star {
+		names, vals := rec.columns()
+		return names, vals, nil
+	}
+	names := make([]string, len(sel.stmt.projections))
+	vals := make([]sValue, len(sel.stmt.projections))
+	for i, proj := range sel.stmt.projections {
+		v, err := proj.expr.eval(rec)
+		if err != nil {
+			return nil, nil, err
+		}
+		vals[i] = v
+		if len(proj.alias) > 0 {
+			names[i] = proj.alias
+		} else if col, ok := proj.expr.(*columnExpr); ok && len(col.name()) > 0 {
+			names[i] = col.name()
+		} else {
+			names[i] = fmt.Sprintf("_%d", i+1)
+		}
+	}
+	return names, vals, nil
+}
+
+type sSelectRun struct {
+	sel *SSelector
+	w   io.Writer
+
+	scanned   *sCountingReader
+	processed *sCountingReader
+	returned  int64
+
+	records      bytes.Buffer
+	lastProgress time.Time
+}
+
+func (run *sSelectRun) flush() {
+	if flusher, ok := run.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (run *sSelectRun) stats() s3cli.StatsMessage {
+	stats := s3cli.StatsMessage{BytesScanned: run.scanned.count, BytesReturned: run.returned}
+	if run.processed != nil {
+		stats.BytesProcessed = run.processed.count
+	}
+	return stats
+}
+
+func (run *sSelectRun) sendRecords() error {
+	if run.records.Len() == 0 {
+		return nil
+	}
+	run.returned += int64(run.records.Len())
+	err := writeRecordsEvent(run.w, run.records.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "writeRecordsEvent")
+	}
+	run.records.Reset()
+	run.flush()
+	return nil
+}
+
+func (run *sSelectRun) sendProgress() error {
+	if !run.sel.opts.RequestProgress.Enabled || time.Since(run.lastProgress) < progressInterval {
+		return nil
+	}
+	run.lastProgress = time.Now()
+	err := writeStatsEvent(run.w, eventProgress, run.stats())
+	if err != nil {
+		return errors.Wrap(err, "writeStatsEvent")
+	}
+	run.flush()
+	return nil
+}
+
+func (run *sSelectRun) writeRecord(rec iRecord) error {
+	names, vals, err := run.sel.project(rec)
+	if err != nil {
+		return err
+	}
+	return run.sel.writer.write(&run.records, names, vals)
+}
+
+func (run *sSelectRun) run(input io.Reader) error {
+	stmt := run.sel.stmt
+	run.scanned = &sCountingReader{reader: input}
+	reader, processed, err := run.sel.openReader(run.scanned)
+	if err != nil {
+		return err
+	}
+	run.processed = processed
+	run.lastProgress = time.Now()
+
+	var count int64
+	for stmt.limit < 0 || count < stmt.limit || stmt.isAggregate() {
+		rec, err := reader.read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if stmt.where != nil {
+			match, err := isTrue(stmt.where, rec)
+			if err != nil {
+				return err
+			}
+			if !match {
+				continue
+			}
+		}
+		if stmt.isAggregate() {
+			for _, agg := range stmt.aggregates {
+				if err := agg.accumulate(rec); err != nil {
+					return err
+				}
+			}
+		} else {
+			if err := run.writeRecord(rec); err != nil {
+				return err
+			}
+			count++
+			if run.records.Len() >= recordsMessageSize {
+				if err := run.sendRecords(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := run.sendProgress(); err != nil {
+			return err
+		}
+	}
+	if stmt.isAggregate() && stmt.limit != 0 {
+		if err := run.writeRecord(emptyRecord{}); err != nil {
+			return err
+		}
+	}
+	if err := run.sendRecords(); err != nil {
+		return err
+	}
+	if err := writeStatsEvent(run.w, eventStats, run.stats()); err != nil {
+		return errors.Wrap(err, "writeStatsEvent")
+	}
+	if err := writeEndEvent(run.w); err != nil {
+		return errors.Wrap(err, "writeEndEvent")
+	}
+	run.flush()
+	return nil
+}
+
+// Run reads records from input and writes results to w as AWS event
+// stream. Errors after response started are also sent to client as error
+// message. A selector keeps aggregation state so it runs only once.
+func (sel *SSelector) Run(input io.Reader, w io.Writer) error {
+	run := &sSelectRun{sel: sel, w: w}
+	err := run.run(input)
+	if err != nil {
+		code, msg := ErrCodeInternalError, err.Error()
+		if e, ok := errors.Cause(err).(*SSelectError); ok {
+			code, msg = e.Code, e.Message
+		}
+		writeErrorEvent(w, code, msg)
+		run.flush()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/xml"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"yunion.io/x/s3cli"
+)
+
+type sEvent struct {
+	headers map[string]string
+	payload []byte
+}
+
+func decodeEvents(t *testing.T, data []byte) []sEvent {
+	events := make([]sEvent, 0)
+	for len(data) > 0 {
+		totalLen := binary.BigEndian.Uint32(data[0:4])
+		hdrLen := binary.BigEndian.Uint32(data[4:8])
+		if crc32.ChecksumIEEE(data[0:8]) != binary.BigEndian.Uint32(data[8:12]) {
+			t.Fatalf("prelude crc mismatch")
+		}
+		msg := data[:totalLen]
+		if crc32.ChecksumIEEE(msg[:totalLen-4]) != binary.BigEndian.Uint32(msg[totalLen-4:]) {
+			t.Fatalf("message crc mismatch")
+		}
+		headers := make(map[string]string)
+		hdr := msg[12 : 12+hdrLen]
+		for len(hdr) > 0 {
+			nameLen := int(hdr[0])
+			name := string(hdr[1 : 1+nameLen])
+			valLen := int(binary.BigEndian.Uint16(hdr[2+nameLen : 4+nameLen]))
+			headers[name] = string(hdr[4+nameLen : 4+nameLen+valLen])
+			hdr = hdr[4+nameLen+valLen:]
+		}
+		events = append(events, sEvent{headers: headers, payload: msg[12+hdrLen : totalLen-4]})
+		data = data[totalLen:]
+	}
+	return events
+}
+
+func runSelect(t *testing.T, opts *s3cli.SelectObjectOptions, input []byte) (string, []sEvent, error) {
+	opts.ExpressionType = s3cli.QueryExpressionTypeSQL
+	sel, err := NewSelector(opts)
+	if err != nil {
+		return "", nil, err
+	}
+	out := bytes.Buffer{}
+	err = sel.Run(bytes.NewReader(input), &out)
+	events := decodeEvents(t, out.Bytes())
+	records := strings.Builder{}
+	for _, ev := range events {
+		if ev.headers[":event-type"] == eventRecords {
+			records.Write(ev.payload)
+		}
+	}
+	return records.String(), events, err
+}
+
+const csvData = `name,age,city
+alice,30,"Beijing, China"
+bob,25,Shanghai
+carol,41,Shenzhen
+dave,,Beijing
+`
+
+func TestSelectCSV(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM S3Object LIMIT 1", "alice,30,\"Beijing, China\"\n"},
+		{"SELECT s.name FROM S3Object s WHERE s.age <> '' AND CAST(s.age AS INT) > 28", "alice\ncarol\n"},
+		{"SELECT name, age FROM S3Object WHERE age BETWEEN 25 AND 35 AND city LIKE 'B%'", "alice,30\n"},
+		{"SELECT _1 FROM S3Object WHERE city IN ('Shanghai', 'Shenzhen')", "bob\ncarol\n"},
+		{"SELECT UPPER(name) || '!' FROM S3Object WHERE age = ''", "DAVE!\n"},
+		{"SELECT COUNT(*), SUM(CAST(age AS INT)), MAX(age) FROM S3Object WHERE age <> ''", "3,96,41\n"},
+		{"SELECT AVG(age) FROM S3Object WHERE NOT name = 'dave'", "32\n"},
+		{"SELECT SUBSTRING(name FROM 2 FOR 3), CHAR_LENGTH(city) FROM S3Object LIMIT 2", "lic,14\nob,8\n"},
+	}
+	for _, c := range cases {
+		opts := &s3cli.SelectObjectOptions{Expression: c.sql}
+		opts.InputSerialization.CSV = &s3cli.CSVInputOptions{FileHeaderInfo: s3cli.CSVFileHeaderInfoUse}
+		opts.OutputSerialization.CSV = &s3cli.CSVOutputOptions{}
+		got, events, err := runSelect(t, opts, []byte(csvData))
+		if err != nil {
+			t.Errorf("%s: %v", c.sql, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.sql, got, c.want)
+		}
+		if len(events) < 2 || events[len(events)-1].headers[":event-type"] != eventEnd {
+			t.Errorf("%s: missing End event", c.sql)
+		}
+	}
+}
+
+func TestSelectJSON(t *testing.T) {
+	data := `{"id": 1, "user": {"name": "alice", "tags": ["a", "b"]}, "score": 9.5}
+{"id": 2, "user": {"name": "bob", "tags": []}, "score": null}
+{"id": 3, "user": {"name": "carol"}}
+`
+	cases := []struct {
+		sql  string
+		want string
+	}{
+		{"SELECT * FROM S3Object[*] s WHERE s.id = 1", `{"id":1,"user":{"name":"alice","tags":["a","b"]},"score":9.5}` + "\n"},
+		{"SELECT s.user.name, s.user.tags[1] AS tag FROM S3Object s", `{"name":"alice","tag":"b"}` + "\n" + `{"name":"bob"}` + "\n" + `{"name":"carol"}` + "\n"},
+		{"SELECT s.id FROM S3Object s WHERE s.score IS NULL", `{"id":2}` + "\n" + `{"id":3}` + "\n"},
+		{"SELECT s.id FROM S3Object s WHERE s.score IS MISSING", `{"id":3}` + "\n"},
+		{"SELECT COUNT(s.score) AS cnt FROM S3Object s", `{"cnt":1}` + "\n"},
+	}
+	for _, c := range cases {
+		opts := &s3cli.SelectObjectOptions{Expression: c.sql}
+		opts.InputSerialization.CompressionType = s3cli.SelectCompressionGZIP
+		opts.InputSerialization.JSON = &s3cli.JSONInputOptions{Type: s3cli.JSONLinesType}
+		opts.OutputSerialization.JSON = &s3cli.JSONOutputOptions{}
+		gzData := bytes.Buffer{}
+		gz := gzip.NewWriter(&gzData)
+		gz.Write([]byte(data))
+		gz.Close()
+		got, events, err := runSelect(t, opts, gzData.Bytes())
+		if err != nil {
+			t.Errorf("%s: %v", c.sql, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.sql, got, c.want)
+		}
+		for _, ev := range events {
+			if ev.headers[":event-type"] != eventStats {
+				continue
+			}
+			stats := s3cli.StatsMessage{}
+			if err := xml.Unmarshal(ev.payload, &stats); err != nil {
+				t.Fatalf("unmarshal stats: %v", err)
+			}
+			if stats.BytesScanned != int64(gzData.Len()) || stats.BytesProcessed != int64(len(data)) || stats.BytesReturned != int64(len(got)) {
+				t.Errorf("%s: unexpected stats %+v", c.sql, stats)
+			}
+		}
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	cases := []struct {
+		sql  string
+		code string
+	}{
+		{"SELECT name", ErrCodeParseSelectMissingFrom},
+		{"SELECT name FROM S3Object WHERE", ErrCodeParseUnexpectedToken},
+		{"SELECT name, COUNT(*) FROM S3Object", ErrCodeUnsupportedSyntax},
+		{"SELECT name FROM S3Object WHERE SUM(age) > 1", ErrCodeUnsupportedSyntax},
+		{"SELECT FOO(name) FROM S3Object", ErrCodeUnsupportedFunction},
+		{"SELECT CAST(name AS BLOB) FROM S3Object", ErrCodeParseInvalidTypeParam},
+		{"SELECT CAST(name AS INT) FROM S3Object", ErrCodeCastFailed},
+		{"SELECT age / 0 FROM S3Object WHERE age <> ''", ErrCodeDivisionByZero},
+	}
+	for _, c := range cases {
+		opts := &s3cli.SelectObjectOptions{Expression: c.sql}
+		opts.InputSerialization.CSV = &s3cli.CSVInputOptions{FileHeaderInfo: s3cli.CSVFileHeaderInfoUse}
+		opts.OutputSerialization.CSV = &s3cli.CSVOutputOptions{}
+		_, events, err := runSelect(t, opts, []byte(csvData))
+		e, ok := err.(*SSelectError)
+		if !ok || e.Code != c.code {
+			t.Errorf("%s: got error %v, want %s", c.sql, err, c.code)
+			continue
+		}
+		// errors during evaluation are reported in event stream
+		if len(events) > 0 && events[len(events)-1].headers[":error-code"] != c.code {
+			t.Errorf("%s: error event not sent", c.sql)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type valueKind int
+
+const (
+	kindMissing valueKind = iota
+	kindNull
+	kindBool
+	kindInt
+	kindFloat
+	kindString
+	kindTimestamp
+	// nested json object or array
+	kindObject
+)
+
+type sValue struct {
+	kind valueKind
+	b    bool
+	i    int64
+	f    float64
+	s    string
+	t    time.Time
+	obj  interface{}
+}
+
+var (
+	missingValue = sValue{kind: kindMissing}
+	nullValue    = sValue{kind: kindNull}
+)
+
+func boolValue(b bool) sValue          { return sValue{kind: kindBool, b: b} }
+func intValue(i int64) sValue          { return sValue{kind: kindInt, i: i} }
+func floatValue(f float64) sValue      { return sValue{kind: kindFloat, f: f} }
+func stringValue(s string) sValue      { return sValue{kind: kindString, s: s} }
+func timeValue(t time.Time) sValue     { return sValue{kind: kindTimestamp, t: t} }
+func objectValue(o interface{}) sValue { return sValue{kind: kindObject, obj: o} }
+
+// jsonValue converts value decoded by decodeJSON
+func jsonValue(v interface{}) sValue {
+	switch val := v.(type) {
+	case nil:
+		return nullValue
+	case bool:
+		return boolValue(val)
+	case string:
+		return stringValue(val)
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return intValue(i)
+		}
+		f, _ := val.Float64()
+		return floatValue(f)
+	default:
+		return objectValue(val)
+	}
+}
+
+func (v sValue) isNull() bool {
+	return v.kind == kindNull || v.kind == kindMissing
+}
+
+func (v sValue) isNumber() bool {
+	return v.kind == kindInt || v.kind == kindFloat
+}
+
+func (v sValue) float() float64 {
+	if v.kind == kindInt {
+		return float64(v.i)
+	}
+	return v.f
+}
+
+// toNumber converts string to number, CSV fields are always strings and
+// are compared with numbers without explicit CAST
+func (v sValue) toNumber() (sValue, bool) {
+	switch v.kind {
+	case kindInt, kindFloat:
+		return v, true
+	case kindString:
+		s := strings.TrimSpace(v.s)
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return intValue(i), true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return floatValue(f), true
+		}
+	}
+	return v, false
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// String formats value in CSV output
+func (v sValue) String() string {
+	switch v.kind {
+	case kindBool:
+		return strconv.FormatBool(v.b)
+	case kindInt:
+		return strconv.FormatInt(v.i, 10)
+	case kindFloat:
+		return formatFloat(v.f)
+	case kindString:
+		return v.s
+	case kindTimestamp:
+		return v.t.Format(time.RFC3339Nano)
+	case kindObject:
+		data, _ := json.Marshal(v.obj)
+		return string(data)
+	}
+	return ""
+}
+
+func (v sValue) MarshalJSON() ([]byte, error) {
+	switch v.kind {
+	case kindMissing, kindNull:
+		return []byte("null"), nil
+	case kindBool, kindInt:
+		return []byte(v.String()), nil
+	case kindFloat:
+		if math.IsInf(v.f, 0) || math.IsNaN(v.f) {
+			return json.Marshal(v.String())
+		}
+		return []byte(v.String()), nil
+	case kindString, kindTimestamp:
+		return json.Marshal(v.String())
+	}
+	return json.Marshal(v.obj)
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T",
+	"2006-01-02",
+	"2006-01T",
+	"2006T",
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+const (
+	castInt       = "INT"
+	castFloat     = "FLOAT"
+	castString    = "STRING"
+	castBool      = "BOOL"
+	castTimestamp = "TIMESTAMP"
+)
+
+var castTypes = map[string]string{
+	"INT":       castInt,
+	"INTEGER":   castInt,
+	"BIGINT":    castInt,
+	"SMALLINT":  castInt,
+	"FLOAT":     castFloat,
+	"DOUBLE":    castFloat,
+	"REAL":      castFloat,
+	"DECIMAL":   castFloat,
+	"NUMERIC":   castFloat,
+	"STRING":    castString,
+	"VARCHAR":   castString,
+	"CHAR":      castString,
+	"BOOL":      castBool,
+	"BOOLEAN":   castBool,
+	"TIMESTAMP": castTimestamp,
+}
+
+func castValue(v sValue, typ string) (sValue, error) {
+	if v.isNull() {
+		return nullValue, nil
+	}
+	fail := func() (sValue, error) {
+		return nullValue, newError(ErrCodeCastFailed, "cannot cast %q to %s", v.String(), typ)
+	}
+	switch typ {
+	case castInt:
+		switch v.kind {
+		case kindInt:
+			return v, nil
+		case kindFloat:
+			return intValue(int64(v.f)), nil
+		case kindBool:
+			if v.b {
+				return intValue(1), nil
+			}
+			return intValue(0), nil
+		case kindString:
+			n, ok := v.toNumber()
+			if !ok {
+				return fail()
+			}
+			if n.kind == kindFloat {
+				return intValue(int64(n.f)), nil
+			}
+			return n, nil
+		}
+	case castFloat:
+		switch v.kind {
+		case kindInt, kindFloat:
+			return floatValue(v.float()), nil
+		case kindString:
+			n, ok := v.toNumber()
+			if !ok {
+				return fail()
+			}
+			return floatValue(n.float()), nil
+		}
+	case castString:
+		return stringValue(v.String()), nil
+	case castBool:
+		switch v.kind {
+		case kindBool:
+			return v, nil
+		case kindInt, kindFloat:
+			return boolValue(v.float() != 0), nil
+		case kindString:
+			b, err := strconv.ParseBool(strings.TrimSpace(v.s))
+			if err != nil {
+				return fail()
+			}
+			return boolValue(b), nil
+		}
+	case castTimestamp:
+		switch v.kind {
+		case kindTimestamp:
+			return v, nil
+		case kindString:
+			t, ok := parseTimestamp(strings.TrimSpace(v.s))
+			if !ok {
+				return fail()
+			}
+			return timeValue(t), nil
+		}
+	}
+	return fail()
+}
+
+// compareValues returns -1, 0, 1, ok is false if values are not comparable
+func compareValues(a, b sValue) (int, bool) {
+	if a.kind == kindString && b.isNumber() {
+		if n, ok := a.toNumber(); ok {
+			a = n
+		}
+	} else if b.kind == kindString && a.isNumber() {
+		if n, ok := b.toNumber(); ok {
+			b = n
+		}
+	} else if a.kind == kindString && b.kind == kindTimestamp {
+		if t, ok := parseTimestamp(a.s); ok {
+			a = timeValue(t)
+		}
+	} else if b.kind == kindString && a.kind == kindTimestamp {
+		if t, ok := parseTimestamp(b.s); ok {
+			b = timeValue(t)
+		}
+	}
+	switch {
+	case a.kind == kindInt && b.kind == kindInt:
+		return compareInt(a.i, b.i), true
+	case a.isNumber() && b.isNumber():
+		return compareFloat(a.float(), b.float()), true
+	case a.kind == kindString && b.kind == kindString:
+		return strings.Compare(a.s, b.s), true
+	case a.kind == kindBool && b.kind == kindBool:
+		if a.b == b.b {
+			return 0, true
+		}
+		if !a.b {
+			return -1, true
+		}
+		return 1, true
+	case a.kind == kindTimestamp && b.kind == kindTimestamp:
+		if a.t.Equal(b.t) {
+			return 0, true
+		}
+		if a.t.Before(b.t) {
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func compareInt(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3select
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"yunion.io/x/s3cli"
+)
+
+type iRecordWriter interface {
+	write(buf *bytes.Buffer, names []string, vals []sValue) error
+}
+
+type sCSVWriter struct {
+	quoteAlways     bool
+	fieldDelimiter  string
+	recordDelimiter string
+	quote           string
+	quoteEscape     string
+}
+
+func newCSVWriter(opts *s3cli.CSVOutputOptions) (*sCSVWriter, error) {
+	w := &sCSVWriter{
+		fieldDelimiter:  ",",
+		recordDelimiter: "\n",
+		quote:           `"`,
+		quoteEscape:     `"`,
+	}
+	switch strings.ToUpper(string(opts.QuoteFields)) {
+	case "", strings.ToUpper(string(s3cli.CSVQuoteFieldsAsNeeded)):
+	case strings.ToUpper(string(s3cli.CSVQuoteFieldsAlways)):
+		w.quoteAlways = true
+	default:
+		return nil, newError(ErrCodeInvalidRequestParameter, "invalid QuoteFields %q", opts.QuoteFields)
+	}
+	if len(opts.FieldDelimiter) > 0 {
+		w.fieldDelimiter = opts.FieldDelimiter
+	}
+	if len(opts.RecordDelimiter) > 0 {
+		w.recordDelimiter = opts.RecordDelimiter
+	}
+	if len(opts.QuoteCharacter) > 0 {
+		w.quote = opts.QuoteCharacter
+	}
+	if len(opts.QuoteEscapeCharacter) > 0 {
+		w.quoteEscape = opts.QuoteEscapeCharacter
+	}
+	return w, nil
+}
+
+func (w *sCSVWriter) needQuote(field string) bool {
+	if w.quoteAlways {
+		return true
+	}
+	return strings.Contains(field, w.fieldDelimiter) ||
+		strings.Contains(field, w.quote) ||
+		strings.Contains(field, w.recordDelimiter) ||
+		strings.ContainsAny(field, "\r\n")
+}
+
+func (w *sCSVWriter) write(buf *bytes.Buffer, names []string, vals []sValue) error {
+	for i, v := range vals {
+		if i > 0 {
+			buf.WriteString(w.fieldDelimiter)
+		}
+		field := v.String()
+		if w.needQuote(field) {
+			buf.WriteString(w.quote)
+			buf.WriteString(strings.Replace(field, w.quote, w.quoteEscape+w.quote, -1))
+			buf.WriteString(w.quote)
+		} else {
+			buf.WriteString(field)
+		}
+	}
+	buf.WriteString(w.recordDelimiter)
+	return nil
+}
+
+type sJSONWriter struct {
+	recordDelimiter string
+}
+
+func newJSONWriter(opts *s3cli.JSONOutputOptions) *sJSONWriter {
+	w := &sJSONWriter{recordDelimiter: "\n"}
+	if len(opts.RecordDelimiter) > 0 {
+		w.recordDelimiter = opts.RecordDelimiter
+	}
+	return w
+}
+
+func (w *sJSONWriter) write(buf *bytes.Buffer, names []string, vals []sValue) error {
+	buf.WriteByte('{')
+	first := true
+	for i, v := range vals {
+		// MISSING values are omitted from output
+		if v.kind == kindMissing {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, err := json.Marshal(names[i])
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	buf.WriteString(w.recordDelimiter)
+	return nil
+}
@@ -86,6 +86,17 @@ func (spec *SSplitTableSpec) GetTableMetas() ([]STableMetadata, error) {
 	return metas, nil
 }
 
+// GetPurgedTableMetas returns the metadata of the tables dropped by Purge
+func (spec *SSplitTableSpec) GetPurgedTableMetas() ([]STableMetadata, error) {
+	q := spec.metaSpec.Query().Asc("id").IsTrue("deleted")
+	metas := make([]STableMetadata, 0)
+	err := q.All(&metas)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "query metadata")
+	}
+	return metas, nil
+}
+
 func (spec *SSplitTableSpec) GetTableSpec(meta STableMetadata) *sqlchemy.STableSpec {
 	tbSpec := *spec.tableSpec
 	return tbSpec.Clone(meta.Table, meta.Start)
@@ -0,0 +1,202 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"encoding/binary"
+	"math"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// decodeCBOR decodes the first CBOR data item of data and returns the rest,
+// only the definite length items used by CTAP2 are supported. Integers are
+// decoded as int64, byte strings as []byte, text strings as string, arrays
+// as []interface{} and maps as map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+const maxCBORDepth = 16
+
+func decodeCBORItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth {
+		return nil, nil, errors.Error("cbor: nesting too deep")
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.Error("cbor: unexpected end of data")
+	}
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+	if major == 7 {
+		return decodeCBORSimple(info, data)
+	}
+	var val uint64
+	switch {
+	case info < 24:
+		val = uint64(info)
+	case info == 24:
+		if len(data) < 1 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		val, data = uint64(data[0]), data[1:]
+	case info == 25:
+		if len(data) < 2 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		val, data = uint64(binary.BigEndian.Uint16(data)), data[2:]
+	case info == 26:
+		if len(data) < 4 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		val, data = uint64(binary.BigEndian.Uint32(data)), data[4:]
+	case info == 27:
+		if len(data) < 8 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		val, data = binary.BigEndian.Uint64(data), data[8:]
+	default:
+		return nil, nil, errors.Errorf("cbor: unsupported additional info %d", info)
+	}
+	switch major {
+	case 0:
+		if val > math.MaxInt64 {
+			return nil, nil, errors.Error("cbor: integer overflow")
+		}
+		return int64(val), data, nil
+	case 1:
+		if val > math.MaxInt64 {
+			return nil, nil, errors.Error("cbor: integer overflow")
+		}
+		return -1 - int64(val), data, nil
+	case 2, 3:
+		if uint64(len(data)) < val {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		if major == 2 {
+			return append([]byte{}, data[:val]...), data[val:], nil
+		}
+		return string(data[:val]), data[val:], nil
+	case 4:
+		if val > uint64(len(data)) {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		arr := make([]interface{}, 0, val)
+		for i := uint64(0); i < val; i++ {
+			var item interface{}
+			var err error
+			item, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, data, nil
+	case 5:
+		if val > uint64(len(data)) {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		m := make(map[interface{}]interface{}, val)
+		for i := uint64(0); i < val; i++ {
+			var k, v interface{}
+			var err error
+			k, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.Errorf("cbor: unsupported map key type %T", k)
+			}
+			v, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, data, nil
+	case 6:
+		// tags are ignored
+		return decodeCBORItem(data, depth+1)
+	}
+	return nil, nil, errors.Errorf("cbor: unsupported major type %d", major)
+}
+
+func decodeCBORSimple(info byte, data []byte) (interface{}, []byte, error) {
+	switch info {
+	case 20:
+		return false, data, nil
+	case 21:
+		return true, data, nil
+	case 22, 23:
+		return nil, data, nil
+	case 25:
+		if len(data) < 2 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		return float64(float16ToFloat32(binary.BigEndian.Uint16(data))), data[2:], nil
+	case 26:
+		if len(data) < 4 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+	case 27:
+		if len(data) < 8 {
+			return nil, nil, errors.Error("cbor: unexpected end of data")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+	}
+	return nil, nil, errors.Errorf("cbor: unsupported simple value %d", info)
+}
+
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+	switch exp {
+	case 0:
+		// subnormal
+		f := float32(frac) / 1024 / 16384
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | frac<<13)
+	}
+	return math.Float32frombits(sign | (exp+112)<<23 | frac<<13)
+}
+
+func cborMap(v interface{}) (map[interface{}]interface{}, bool) {
+	m, ok := v.(map[interface{}]interface{})
+	return m, ok
+}
+
+func cborBytes(m map[interface{}]interface{}, key interface{}) ([]byte, bool) {
+	b, ok := m[key].([]byte)
+	return b, ok
+}
+
+func cborInt(m map[interface{}]interface{}, key interface{}) (int64, bool) {
+	i, ok := m[key].(int64)
+	return i, ok
+}
+
+func cborString(m map[interface{}]interface{}, key interface{}) (string, bool) {
+	s, ok := m[key].(string)
+	return s, ok
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"math/big"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// COSE algorithm identifiers
+const (
+	COSE_ALG_ES256 = -7
+	COSE_ALG_EDDSA = -8
+	COSE_ALG_ES384 = -35
+	COSE_ALG_ES512 = -36
+	COSE_ALG_RS256 = -257
+)
+
+// SupportedAlgorithms are advertised in pubKeyCredParams in the order of
+// preference
+var SupportedAlgorithms = []int{COSE_ALG_ES256, COSE_ALG_EDDSA, COSE_ALG_RS256, COSE_ALG_ES384, COSE_ALG_ES512}
+
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+
+	coseCurveP256    = 1
+	coseCurveP384    = 2
+	coseCurveP521    = 3
+	coseCurveEd25519 = 6
+)
+
+type sPublicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key (RFC 8152 section 7)
+func parsePublicKey(coseKey []byte) (*sPublicKey, error) {
+	v, _, err := decodeCBOR(coseKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode COSE key")
+	}
+	m, ok := cborMap(v)
+	if !ok {
+		return nil, errors.Error("COSE key is not a map")
+	}
+	kty, _ := cborInt(m, int64(1))
+	alg, ok := cborInt(m, int64(3))
+	if !ok {
+		return nil, errors.Error("missing COSE key alg")
+	}
+	switch kty {
+	case coseKeyTypeEC2:
+		crv, _ := cborInt(m, int64(-1))
+		x, _ := cborBytes(m, int64(-2))
+		y, _ := cborBytes(m, int64(-3))
+		var curve elliptic.Curve
+		switch crv {
+		case coseCurveP256:
+			curve = elliptic.P256()
+		case coseCurveP384:
+			curve = elliptic.P384()
+		case coseCurveP521:
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported EC2 curve %d", crv)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.Error("EC2 point is not on curve")
+		}
+		return &sPublicKey{alg: alg, key: pub}, nil
+	case coseKeyTypeRSA:
+		n, _ := cborBytes(m, int64(-1))
+		e, _ := cborBytes(m, int64(-2))
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.Error("invalid RSA key")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &sPublicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	case coseKeyTypeOKP:
+		crv, _ := cborInt(m, int64(-1))
+		x, _ := cborBytes(m, int64(-2))
+		if crv != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.Errorf("unsupported OKP curve %d", crv)
+		}
+		return &sPublicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	}
+	return nil, errors.Errorf("unsupported COSE key type %d", kty)
+}
+
+// verify checks the signature of data by the algorithm alg
+func verifySignature(key crypto.PublicKey, alg int64, data, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case COSE_ALG_ES256, COSE_ALG_RS256:
+		hash = crypto.SHA256
+	case COSE_ALG_ES384:
+		hash = crypto.SHA384
+	case COSE_ALG_ES512:
+		hash = crypto.SHA512
+	case COSE_ALG_EDDSA:
+	default:
+		return errors.Errorf("unsupported algorithm %d", alg)
+	}
+	var digest []byte
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384(data)
+		digest = sum[:]
+	case crypto.SHA512:
+		sum := sha512.Sum512(data)
+		digest = sum[:]
+	}
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if alg == COSE_ALG_EDDSA || alg == COSE_ALG_RS256 {
+			return errors.Errorf("algorithm %d does not match EC2 key", alg)
+		}
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.Error("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if alg != COSE_ALG_RS256 {
+			return errors.Errorf("algorithm %d does not match RSA key", alg)
+		}
+		err := rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		if err != nil {
+			return errors.Wrap(err, "invalid signature")
+		}
+	case ed25519.PublicKey:
+		if alg != COSE_ALG_EDDSA {
+			return errors.Errorf("algorithm %d does not match OKP key", alg)
+		}
+		if !ed25519.Verify(pub, data, sig) {
+			return errors.Error("invalid signature")
+		}
+	default:
+		return errors.Errorf("unsupported public key %T", key)
+	}
+	return nil
+}
+
+func (k *sPublicKey) verify(data, sig []byte) error {
+	return verifySignature(k.key, k.alg, data, sig)
+}
+
+// verifyCertSignature verifies the signature by the public key of the
+// attestation certificate
+func verifyCertSignature(certDer []byte, alg int64, data, sig []byte) error {
+	cert, err := x509.ParseCertificate(certDer)
+	if err != nil {
+		return errors.Wrap(err, "parse attestation certificate")
+	}
+	return verifySignature(cert.PublicKey, alg, data, sig)
+}
@@ -0,0 +1,423 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	CLIENT_DATA_TYPE_CREATE = "webauthn.create"
+	CLIENT_DATA_TYPE_GET    = "webauthn.get"
+
+	USER_VERIFICATION_REQUIRED    = "required"
+	USER_VERIFICATION_PREFERRED   = "preferred"
+	USER_VERIFICATION_DISCOURAGED = "discouraged"
+
+	ATTESTATION_NONE = "none"
+
+	PUBLIC_KEY_CREDENTIAL_TYPE = "public-key"
+
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+	flagExtensionData    = 0x80
+)
+
+var (
+	ErrInvalidResponse   = errors.Error("invalid authenticator response")
+	ErrChallengeMismatch = errors.Error("challenge mismatch")
+	ErrOriginMismatch    = errors.Error("origin mismatch")
+	ErrSignCount         = errors.Error("signature counter did not increase, the authenticator may be cloned")
+)
+
+// EncodeBase64 encodes binary fields for the browser in base64url without
+// padding
+func EncodeBase64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeBase64 accepts base64url and standard base64, with or without
+// padding
+func DecodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// SRelyingParty is the relying party identified by the RP ID, which is
+// the effective domain of the allowed origins
+type SRelyingParty struct {
+	Id      string
+	Name    string
+	Origins []string
+}
+
+type SRelyingPartyEntity struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type SUserEntity struct {
+	// base64url encoded user handle
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type SCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type SCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	Id         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type SAuthenticatorSelection struct {
+	AuthenticatorAttachment string `json:"authenticatorAttachment,omitempty"`
+	ResidentKey             string `json:"residentKey,omitempty"`
+	UserVerification        string `json:"userVerification,omitempty"`
+}
+
+// SCredentialCreationOptions is the publicKey member of the options of
+// navigator.credentials.create(), binary fields are base64url encoded
+type SCredentialCreationOptions struct {
+	Rp                     SRelyingPartyEntity     `json:"rp"`
+	User                   SUserEntity             `json:"user"`
+	Challenge              string                  `json:"challenge"`
+	PubKeyCredParams       []SCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                     `json:"timeout,omitempty"`
+	ExcludeCredentials     []SCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection SAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                  `json:"attestation"`
+}
+
+// SCredentialRequestOptions is the publicKey member of the options of
+// navigator.credentials.get()
+type SCredentialRequestOptions struct {
+	Challenge        string                  `json:"challenge"`
+	Timeout          int                     `json:"timeout,omitempty"`
+	RpId             string                  `json:"rpId"`
+	AllowCredentials []SCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                  `json:"userVerification"`
+}
+
+// SAttestationResponse is the PublicKeyCredential returned by
+// navigator.credentials.create(), binary fields are base64url encoded
+type SAttestationResponse struct {
+	Id       string `json:"id"`
+	RawId    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// SAssertionResponse is the PublicKeyCredential returned by
+// navigator.credentials.get()
+type SAssertionResponse struct {
+	Id       string `json:"id"`
+	RawId    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// SCredential is the registered public key credential
+type SCredential struct {
+	Id        []byte
+	PublicKey []byte
+	SignCount uint32
+	Aaguid    []byte
+	// attestation statement format
+	Format       string
+	UserVerified bool
+}
+
+type sClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+type sAuthenticatorData struct {
+	RpIdHash  []byte
+	Flags     byte
+	SignCount uint32
+
+	CredentialId []byte
+	PublicKey    []byte
+	Aaguid       []byte
+}
+
+func parseAuthenticatorData(data []byte) (*sAuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.Wrap(ErrInvalidResponse, "authenticator data too short")
+	}
+	ad := &sAuthenticatorData{
+		RpIdHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+	if ad.Flags&flagAttestedCredData != 0 {
+		if len(rest) < 18 {
+			return nil, errors.Wrap(ErrInvalidResponse, "attested credential data too short")
+		}
+		ad.Aaguid = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.Wrap(ErrInvalidResponse, "credential id too short")
+		}
+		ad.CredentialId = rest[:idLen]
+		rest = rest[idLen:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode credential public key")
+		}
+		ad.PublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if ad.Flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode extensions")
+		}
+		rest = after
+	}
+	if len(rest) > 0 {
+		return nil, errors.Wrap(ErrInvalidResponse, "trailing bytes in authenticator data")
+	}
+	return ad, nil
+}
+
+// verifyClientData checks the collected client data and returns its hash
+func (rp SRelyingParty) verifyClientData(clientDataJSON []byte, typ string, challenge []byte) ([]byte, error) {
+	cd := sClientData{}
+	err := json.Unmarshal(clientDataJSON, &cd)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidResponse, "invalid clientDataJSON")
+	}
+	if cd.Type != typ {
+		return nil, errors.Wrapf(ErrInvalidResponse, "client data type %s, expect %s", cd.Type, typ)
+	}
+	got, err := DecodeBase64(cd.Challenge)
+	if err != nil || !bytes.Equal(got, challenge) {
+		return nil, ErrChallengeMismatch
+	}
+	if !rp.isOriginAllowed(cd.Origin) {
+		return nil, errors.Wrapf(ErrOriginMismatch, "origin %s", cd.Origin)
+	}
+	sum := sha256.Sum256(clientDataJSON)
+	return sum[:], nil
+}
+
+func (rp SRelyingParty) isOriginAllowed(origin string) bool {
+	for _, o := range rp.Origins {
+		if strings.TrimRight(o, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp SRelyingParty) verifyAuthenticatorData(ad *sAuthenticatorData, requireUV bool) error {
+	rpIdHash := sha256.Sum256([]byte(rp.Id))
+	if !bytes.Equal(ad.RpIdHash, rpIdHash[:]) {
+		return errors.Wrapf(ErrInvalidResponse, "rpIdHash mismatch, expect rp id %s", rp.Id)
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return errors.Wrap(ErrInvalidResponse, "user not present")
+	}
+	if requireUV && ad.Flags&flagUserVerified == 0 {
+		return errors.Wrap(ErrInvalidResponse, "user not verified")
+	}
+	return nil
+}
+
+// VerifyRegistration verifies the response of the registration ceremony
+// (WebAuthn section 7.1) and returns the new credential. Attestation
+// certificates are not validated against trust anchors since attestation
+// is not requested.
+func (rp SRelyingParty) VerifyRegistration(resp SAttestationResponse, challenge []byte, requireUV bool) (*SCredential, error) {
+	if resp.Type != PUBLIC_KEY_CREDENTIAL_TYPE {
+		return nil, errors.Wrapf(ErrInvalidResponse, "credential type %s", resp.Type)
+	}
+	clientDataJSON, err := DecodeBase64(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidResponse, "decode clientDataJSON")
+	}
+	clientDataHash, err := rp.verifyClientData(clientDataJSON, CLIENT_DATA_TYPE_CREATE, challenge)
+	if err != nil {
+		return nil, err
+	}
+	attObjBytes, err := DecodeBase64(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidResponse, "decode attestationObject")
+	}
+	v, _, err := decodeCBOR(attObjBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode attestationObject")
+	}
+	attObj, ok := cborMap(v)
+	if !ok {
+		return nil, errors.Wrap(ErrInvalidResponse, "attestationObject is not a map")
+	}
+	format, _ := cborString(attObj, "fmt")
+	authData, _ := cborBytes(attObj, "authData")
+	attStmt, _ := cborMap(attObj["attStmt"])
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	err = rp.verifyAuthenticatorData(ad, requireUV)
+	if err != nil {
+		return nil, err
+	}
+	if len(ad.CredentialId) == 0 || len(ad.PublicKey) == 0 {
+		return nil, errors.Wrap(ErrInvalidResponse, "no attested credential data")
+	}
+	if rawId, err := DecodeBase64(resp.RawId); err == nil && len(rawId) > 0 && !bytes.Equal(rawId, ad.CredentialId) {
+		return nil, errors.Wrap(ErrInvalidResponse, "rawId does not match the attested credential")
+	}
+	pubKey, err := parsePublicKey(ad.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyAttestation(format, attStmt, authData, clientDataHash, ad, pubKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "verify %s attestation", format)
+	}
+	return &SCredential{
+		Id:           ad.CredentialId,
+		PublicKey:    ad.PublicKey,
+		SignCount:    ad.SignCount,
+		Aaguid:       ad.Aaguid,
+		Format:       format,
+		UserVerified: ad.Flags&flagUserVerified != 0,
+	}, nil
+}
+
+func verifyAttestation(format string, attStmt map[interface{}]interface{}, authData, clientDataHash []byte, ad *sAuthenticatorData, pubKey *sPublicKey) error {
+	switch format {
+	case "none":
+		return nil
+	case "packed":
+		alg, _ := cborInt(attStmt, "alg")
+		sig, _ := cborBytes(attStmt, "sig")
+		signed := append(append([]byte{}, authData...), clientDataHash...)
+		x5c, _ := attStmt["x5c"].([]interface{})
+		if len(x5c) == 0 {
+			// self attestation
+			if alg != pubKey.alg {
+				return errors.Errorf("attestation alg %d does not match credential alg %d", alg, pubKey.alg)
+			}
+			return pubKey.verify(signed, sig)
+		}
+		cert, _ := x5c[0].([]byte)
+		return verifyCertSignature(cert, alg, signed, sig)
+	case "fido-u2f":
+		sig, _ := cborBytes(attStmt, "sig")
+		x5c, _ := attStmt["x5c"].([]interface{})
+		if len(x5c) != 1 {
+			return errors.Error("fido-u2f attestation requires exactly one certificate")
+		}
+		cert, _ := x5c[0].([]byte)
+		m, _, _ := decodeCBOR(ad.PublicKey)
+		key, _ := cborMap(m)
+		x, _ := cborBytes(key, int64(-2))
+		y, _ := cborBytes(key, int64(-3))
+		if len(x) != 32 || len(y) != 32 {
+			return errors.Error("fido-u2f requires a P-256 credential")
+		}
+		signed := []byte{0}
+		signed = append(signed, ad.RpIdHash...)
+		signed = append(signed, clientDataHash...)
+		signed = append(signed, ad.CredentialId...)
+		signed = append(signed, 0x04)
+		signed = append(signed, x...)
+		signed = append(signed, y...)
+		return verifyCertSignature(cert, COSE_ALG_ES256, signed, sig)
+	}
+	return errors.Errorf("unsupported attestation format %q", format)
+}
+
+// VerifyAssertion verifies the response of the authentication ceremony
+// (WebAuthn section 7.2) against the registered credential and returns the
+// new signature counter
+func (rp SRelyingParty) VerifyAssertion(resp SAssertionResponse, challenge []byte, cred SCredential, requireUV bool) (uint32, error) {
+	if resp.Type != PUBLIC_KEY_CREDENTIAL_TYPE {
+		return 0, errors.Wrapf(ErrInvalidResponse, "credential type %s", resp.Type)
+	}
+	rawId, err := DecodeBase64(resp.RawId)
+	if err != nil || !bytes.Equal(rawId, cred.Id) {
+		return 0, errors.Wrap(ErrInvalidResponse, "credential id mismatch")
+	}
+	clientDataJSON, err := DecodeBase64(resp.Response.ClientDataJSON)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidResponse, "decode clientDataJSON")
+	}
+	clientDataHash, err := rp.verifyClientData(clientDataJSON, CLIENT_DATA_TYPE_GET, challenge)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := DecodeBase64(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidResponse, "decode authenticatorData")
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	err = rp.verifyAuthenticatorData(ad, requireUV)
+	if err != nil {
+		return 0, err
+	}
+	sig, err := DecodeBase64(resp.Response.Signature)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidResponse, "decode signature")
+	}
+	pubKey, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	signed := append(append([]byte{}, authData...), clientDataHash...)
+	err = pubKey.verify(signed, sig)
+	if err != nil {
+		return 0, err
+	}
+	// authenticators without counter always return 0
+	if (ad.SignCount != 0 || cred.SignCount != 0) && ad.SignCount <= cred.SignCount {
+		return 0, ErrSignCount
+	}
+	return ad.SignCount, nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"yunion.io/x/pkg/errors"
+)
+
+// minimal CBOR encoder for building authenticator responses in tests
+func encodeCBORHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		b := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	default:
+		b := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return b
+	}
+}
+
+func encodeCBOR(v interface{}) []byte {
+	switch val := v.(type) {
+	case int:
+		if val >= 0 {
+			return encodeCBORHead(0, uint64(val))
+		}
+		return encodeCBORHead(1, uint64(-1-val))
+	case []byte:
+		return append(encodeCBORHead(2, uint64(len(val))), val...)
+	case string:
+		return append(encodeCBORHead(3, uint64(len(val))), val...)
+	case []interface{}:
+		ret := encodeCBORHead(4, uint64(len(val)))
+		for _, e := range val {
+			ret = append(ret, encodeCBOR(e)...)
+		}
+		return ret
+	case map[interface{}]interface{}:
+		keys := make([][]byte, 0, len(val))
+		enc := map[string][]byte{}
+		for k, e := range val {
+			kb := encodeCBOR(k)
+			keys = append(keys, kb)
+			enc[string(kb)] = encodeCBOR(e)
+		}
+		sort.Slice(keys, func(i, j int) bool { return string(keys[i]) < string(keys[j]) })
+		ret := encodeCBORHead(5, uint64(len(val)))
+		for _, k := range keys {
+			ret = append(ret, k...)
+			ret = append(ret, enc[string(k)]...)
+		}
+		return ret
+	}
+	panic("unsupported type")
+}
+
+type sTestAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	credId    []byte
+	signCount uint32
+}
+
+func newTestAuthenticator(t *testing.T) *sTestAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	return &sTestAuthenticator{key: key, credId: []byte("test-credential-id")}
+}
+
+func (a *sTestAuthenticator) coseKey() []byte {
+	x := a.key.X.FillBytes(make([]byte, 32))
+	y := a.key.Y.FillBytes(make([]byte, 32))
+	return encodeCBOR(map[interface{}]interface{}{
+		1: 2, 3: COSE_ALG_ES256, -1: 1, -2: x, -3: y,
+	})
+}
+
+func (a *sTestAuthenticator) authData(rpId string, flags byte, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpId))
+	ret := append([]byte{}, h[:]...)
+	ret = append(ret, flags)
+	cnt := make([]byte, 4)
+	binary.BigEndian.PutUint32(cnt, a.signCount)
+	ret = append(ret, cnt...)
+	if attested {
+		ret = append(ret, make([]byte, 16)...)
+		l := make([]byte, 2)
+		binary.BigEndian.PutUint16(l, uint16(len(a.credId)))
+		ret = append(ret, l...)
+		ret = append(ret, a.credId...)
+		ret = append(ret, a.coseKey()...)
+	}
+	return ret
+}
+
+func (a *sTestAuthenticator) sign(t *testing.T, authData, clientDataJSON []byte) []byte {
+	cdh := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), cdh[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %s", err)
+	}
+	return sig
+}
+
+func clientData(typ string, challenge []byte, origin string) []byte {
+	data, _ := json.Marshal(sClientData{Type: typ, Challenge: EncodeBase64(challenge), Origin: origin})
+	return data
+}
+
+func (a *sTestAuthenticator) create(t *testing.T, rpId, origin string, challenge []byte, format string) SAttestationResponse {
+	cdj := clientData(CLIENT_DATA_TYPE_CREATE, challenge, origin)
+	authData := a.authData(rpId, flagUserPresent|flagUserVerified|flagAttestedCredData, true)
+	attStmt := map[interface{}]interface{}{}
+	if format == "packed" {
+		attStmt["alg"] = COSE_ALG_ES256
+		attStmt["sig"] = a.sign(t, authData, cdj)
+	}
+	attObj := encodeCBOR(map[interface{}]interface{}{
+		"fmt": format, "authData": authData, "attStmt": attStmt,
+	})
+	resp := SAttestationResponse{Id: EncodeBase64(a.credId), RawId: EncodeBase64(a.credId), Type: PUBLIC_KEY_CREDENTIAL_TYPE}
+	resp.Response.ClientDataJSON = EncodeBase64(cdj)
+	resp.Response.AttestationObject = EncodeBase64(attObj)
+	return resp
+}
+
+func (a *sTestAuthenticator) get(t *testing.T, rpId, origin string, challenge []byte) SAssertionResponse {
+	a.signCount++
+	cdj := clientData(CLIENT_DATA_TYPE_GET, challenge, origin)
+	authData := a.authData(rpId, flagUserPresent|flagUserVerified, false)
+	resp := SAssertionResponse{Id: EncodeBase64(a.credId), RawId: EncodeBase64(a.credId), Type: PUBLIC_KEY_CREDENTIAL_TYPE}
+	resp.Response.ClientDataJSON = EncodeBase64(cdj)
+	resp.Response.AuthenticatorData = EncodeBase64(authData)
+	resp.Response.Signature = EncodeBase64(a.sign(t, authData, cdj))
+	return resp
+}
+
+func TestCeremonies(t *testing.T) {
+	rp := SRelyingParty{Id: "cloud.example.com", Name: "Cloudpods", Origins: []string{"https://cloud.example.com/"}}
+	origin := "https://cloud.example.com"
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+
+	for _, format := range []string{"none", "packed"} {
+		a := newTestAuthenticator(t)
+		cred, err := rp.VerifyRegistration(a.create(t, rp.Id, origin, challenge, format), challenge, true)
+		if err != nil {
+			t.Fatalf("%s registration: %s", format, err)
+		}
+		if string(cred.Id) != string(a.credId) || cred.Format != format || !cred.UserVerified {
+			t.Fatalf("%s registration: unexpected credential %#v", format, cred)
+		}
+
+		cnt, err := rp.VerifyAssertion(a.get(t, rp.Id, origin, challenge), challenge, *cred, true)
+		if err != nil {
+			t.Fatalf("%s assertion: %s", format, err)
+		}
+		if cnt != 1 {
+			t.Fatalf("%s assertion: sign count %d, expect 1", format, cnt)
+		}
+		cred.SignCount = cnt
+
+		// counter regression
+		a.signCount = 0
+		_, err = rp.VerifyAssertion(a.get(t, rp.Id, origin, challenge), challenge, *cred, true)
+		if errors.Cause(err) != ErrSignCount {
+			t.Fatalf("%s assertion: expect sign count error, got %v", format, err)
+		}
+	}
+}
+
+func TestCeremonyFailures(t *testing.T) {
+	rp := SRelyingParty{Id: "cloud.example.com", Origins: []string{"https://cloud.example.com"}}
+	origin := "https://cloud.example.com"
+	challenge := []byte("challenge-1")
+	a := newTestAuthenticator(t)
+
+	cases := []struct {
+		name string
+		resp SAttestationResponse
+		want error
+	}{
+		{"challenge", a.create(t, rp.Id, origin, []byte("challenge-2"), "none"), ErrChallengeMismatch},
+		{"origin", a.create(t, rp.Id, "https://evil.example.com", challenge, "none"), ErrOriginMismatch},
+		{"rpid", a.create(t, "evil.example.com", origin, challenge, "none"), ErrInvalidResponse},
+	}
+	for _, c := range cases {
+		_, err := rp.VerifyRegistration(c.resp, challenge, false)
+		if errors.Cause(err) != c.want {
+			t.Errorf("%s: expect %v, got %v", c.name, c.want, err)
+		}
+	}
+
+	_, err := rp.VerifyRegistration(a.create(t, rp.Id, origin, challenge, "tpm"), challenge, false)
+	if err == nil {
+		t.Errorf("expect unsupported attestation format error")
+	}
+
+	cred, err := rp.VerifyRegistration(a.create(t, rp.Id, origin, challenge, "none"), challenge, false)
+	if err != nil {
+		t.Fatalf("registration: %s", err)
+	}
+	resp := a.get(t, rp.Id, origin, challenge)
+	resp.Response.Signature = EncodeBase64(a.sign(t, []byte("tampered"), []byte("{}")))
+	_, err = rp.VerifyAssertion(resp, challenge, *cred, false)
+	if err == nil {
+		t.Errorf("expect signature verification failure")
+	}
+	resp = a.get(t, rp.Id, origin, challenge)
+	_, err = rp.VerifyAssertion(resp, challenge, SCredential{Id: []byte("other"), PublicKey: cred.PublicKey}, false)
+	if errors.Cause(err) != ErrInvalidResponse {
+		t.Errorf("expect credential id mismatch, got %v", err)
+	}
+}
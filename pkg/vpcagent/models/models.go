@@ -28,8 +28,9 @@ type Vpc struct {
 
 	RouteTable *RouteTable `json:"-"`
 
-	Wire     *Wire    `json:"-"`
-	Networks Networks `json:"-"`
+	Wire        *Wire       `json:"-"`
+	Networks    Networks    `json:"-"`
+	NatGateways NatGateways `json:"-"`
 }
 
 func (el *Vpc) Copy() *Vpc {
@@ -71,6 +72,7 @@ type Network struct {
 	Groupnetworks        Groupnetworks        `json:"-"`
 	LoadbalancerNetworks LoadbalancerNetworks `json:"-"`
 	Elasticips           Elasticips           `json:"-"`
+	NatSEntries          NatSEntries          `json:"-"`
 }
 
 func (el *Network) Copy() *Network {
@@ -193,6 +195,7 @@ type Elasticip struct {
 	Guestnetwork        *Guestnetwork        `json:"-"`
 	Groupnetwork        *Groupnetwork        `json:"-"`
 	LoadbalancerNetwork *LoadbalancerNetwork `json:"-"`
+	NatGateway          *NatGateway          `json:"-"`
 }
 
 func (el *Elasticip) Copy() *Elasticip {
@@ -320,3 +323,44 @@ func (el *LoadbalancerAcl) Copy() *LoadbalancerAcl {
 		SLoadbalancerAcl: el.SLoadbalancerAcl,
 	}
 }
+
+type NatGateway struct {
+	compute_models.SNatGateway
+
+	Vpc         *Vpc        `json:"-"`
+	Elasticips  Elasticips  `json:"-"`
+	NatDEntries NatDEntries `json:"-"`
+	NatSEntries NatSEntries `json:"-"`
+}
+
+func (el *NatGateway) Copy() *NatGateway {
+	return &NatGateway{
+		SNatGateway: el.SNatGateway,
+	}
+}
+
+type NatDEntry struct {
+	compute_models.SNatDEntry
+
+	NatGateway *NatGateway `json:"-"`
+}
+
+func (el *NatDEntry) Copy() *NatDEntry {
+	return &NatDEntry{
+		SNatDEntry: el.SNatDEntry,
+	}
+}
+
+type NatSEntry struct {
+	compute_models.SNatSEntry
+
+	NatGateway *NatGateway `json:"-"`
+	// Network is nil for entries with source cidr
+	Network *Network `json:"-"`
+}
+
+func (el *NatSEntry) Copy() *NatSEntry {
+	return &NatSEntry{
+		SNatSEntry: el.SNatSEntry,
+	}
+}
@@ -51,6 +51,10 @@ type (
 	LoadbalancerNetworks  map[string]*LoadbalancerNetwork // key: networkId/loadbalancerId
 	LoadbalancerListeners map[string]*LoadbalancerListener
 	LoadbalancerAcls      map[string]*LoadbalancerAcl
+
+	NatGateways map[string]*NatGateway
+	NatDEntries map[string]*NatDEntry
+	NatSEntries map[string]*NatSEntry
 )
 
 func (set Vpcs) ModelManager() mcclient_modulebase.IBaseManager {
@@ -426,6 +430,26 @@ func (ms Networks) joinElasticips(subEntries Elasticips) bool {
 	return correct
 }
 
+func (ms Networks) joinNatSEntries(subEntries NatSEntries) bool {
+	for _, m := range ms {
+		m.NatSEntries = NatSEntries{}
+	}
+	for _, subEntry := range subEntries {
+		netId := subEntry.NetworkId
+		if netId == "" {
+			continue
+		}
+		m, ok := ms[netId]
+		if !ok {
+			log.Warningf("natsentry %s(%s): network %s not found", subEntry.Name, subEntry.Id, netId)
+			continue
+		}
+		subEntry.Network = m
+		m.NatSEntries[subEntry.Id] = subEntry
+	}
+	return true
+}
+
 func (set Guestnetworks) ModelManager() mcclient_modulebase.IBaseManager {
 	return &mcclient_modules.Servernetworks
 }
@@ -981,3 +1005,139 @@ func (set LoadbalancerAcls) Copy() apihelper.IModelSet {
 	}
 	return setCopy
 }
+
+func (ms Vpcs) joinNatGateways(subEntries NatGateways) bool {
+	for _, m := range ms {
+		m.NatGateways = NatGateways{}
+	}
+	for _, subEntry := range subEntries {
+		vpcId := subEntry.VpcId
+		m, ok := ms[vpcId]
+		if !ok {
+			log.Warningf("natgateway %s(%s): vpc %s not found", subEntry.Name, subEntry.Id, vpcId)
+			continue
+		}
+		subEntry.Vpc = m
+		m.NatGateways[subEntry.Id] = subEntry
+	}
+	return true
+}
+
+func (set NatGateways) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NatGateways
+}
+
+func (set NatGateways) NewModel() db.IModel {
+	return &NatGateway{}
+}
+
+func (set NatGateways) AddModel(i db.IModel) {
+	m := i.(*NatGateway)
+	set[m.Id] = m
+}
+
+func (set NatGateways) Copy() apihelper.IModelSet {
+	setCopy := NatGateways{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NatGateways) joinElasticips(subEntries Elasticips) bool {
+	for _, m := range set {
+		m.Elasticips = Elasticips{}
+	}
+	correct := true
+	for _, subEntry := range subEntries {
+		if subEntry.AssociateType != computeapis.EIP_ASSOCIATE_TYPE_NAT_GATEWAY {
+			continue
+		}
+		m, ok := set[subEntry.AssociateId]
+		if !ok {
+			log.Errorf("elasticip %s(%s) associated with non-existent natgateway %s",
+				subEntry.Name, subEntry.Id, subEntry.AssociateId)
+			correct = false
+			continue
+		}
+		subEntry.NatGateway = m
+		m.Elasticips[subEntry.Id] = subEntry
+	}
+	return correct
+}
+
+func (set NatGateways) joinNatDEntries(subEntries NatDEntries) bool {
+	for _, m := range set {
+		m.NatDEntries = NatDEntries{}
+	}
+	for _, subEntry := range subEntries {
+		natId := subEntry.NatgatewayId
+		m, ok := set[natId]
+		if !ok {
+			log.Warningf("natdentry %s(%s): natgateway %s not found", subEntry.Name, subEntry.Id, natId)
+			continue
+		}
+		subEntry.NatGateway = m
+		m.NatDEntries[subEntry.Id] = subEntry
+	}
+	return true
+}
+
+func (set NatGateways) joinNatSEntries(subEntries NatSEntries) bool {
+	for _, m := range set {
+		m.NatSEntries = NatSEntries{}
+	}
+	for _, subEntry := range subEntries {
+		natId := subEntry.NatgatewayId
+		m, ok := set[natId]
+		if !ok {
+			log.Warningf("natsentry %s(%s): natgateway %s not found", subEntry.Name, subEntry.Id, natId)
+			continue
+		}
+		subEntry.NatGateway = m
+		m.NatSEntries[subEntry.Id] = subEntry
+	}
+	return true
+}
+
+func (set NatDEntries) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NatDTable
+}
+
+func (set NatDEntries) NewModel() db.IModel {
+	return &NatDEntry{}
+}
+
+func (set NatDEntries) AddModel(i db.IModel) {
+	m := i.(*NatDEntry)
+	set[m.Id] = m
+}
+
+func (set NatDEntries) Copy() apihelper.IModelSet {
+	setCopy := NatDEntries{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
+
+func (set NatSEntries) ModelManager() mcclient_modulebase.IBaseManager {
+	return &mcclient_modules.NatSTable
+}
+
+func (set NatSEntries) NewModel() db.IModel {
+	return &NatSEntry{}
+}
+
+func (set NatSEntries) AddModel(i db.IModel) {
+	m := i.(*NatSEntry)
+	set[m.Id] = m
+}
+
+func (set NatSEntries) Copy() apihelper.IModelSet {
+	setCopy := NatSEntries{}
+	for id, el := range set {
+		setCopy[id] = el.Copy()
+	}
+	return setCopy
+}
@@ -46,6 +46,10 @@ type ModelSetsMaxUpdatedAt struct {
 	LoadbalancerNetworks  time.Time
 	LoadbalancerListeners time.Time
 	LoadbalancerAcls      time.Time
+
+	NatGateways time.Time
+	NatDEntries time.Time
+	NatSEntries time.Time
 }
 
 func NewModelSetsMaxUpdatedAt() *ModelSetsMaxUpdatedAt {
@@ -72,6 +76,10 @@ func NewModelSetsMaxUpdatedAt() *ModelSetsMaxUpdatedAt {
 		LoadbalancerNetworks:  apihelper.PseudoZeroTime,
 		LoadbalancerListeners: apihelper.PseudoZeroTime,
 		LoadbalancerAcls:      apihelper.PseudoZeroTime,
+
+		NatGateways: apihelper.PseudoZeroTime,
+		NatDEntries: apihelper.PseudoZeroTime,
+		NatSEntries: apihelper.PseudoZeroTime,
 	}
 }
 
@@ -99,6 +107,10 @@ type ModelSets struct {
 	LoadbalancerNetworks  LoadbalancerNetworks
 	LoadbalancerListeners LoadbalancerListeners
 	LoadbalancerAcls      LoadbalancerAcls
+
+	NatGateways NatGateways
+	NatDEntries NatDEntries
+	NatSEntries NatSEntries
 }
 
 func NewModelSets() *ModelSets {
@@ -126,6 +138,10 @@ func NewModelSets() *ModelSets {
 		LoadbalancerNetworks:  LoadbalancerNetworks{},
 		LoadbalancerListeners: LoadbalancerListeners{},
 		LoadbalancerAcls:      LoadbalancerAcls{},
+
+		NatGateways: NatGateways{},
+		NatDEntries: NatDEntries{},
+		NatSEntries: NatSEntries{},
 	}
 }
 
@@ -154,6 +170,10 @@ func (mss *ModelSets) ModelSetList() []apihelper.IModelSet {
 		mss.LoadbalancerNetworks,
 		mss.LoadbalancerListeners,
 		mss.LoadbalancerAcls,
+
+		mss.NatGateways,
+		mss.NatDEntries,
+		mss.NatSEntries,
 	}
 }
 
@@ -185,6 +205,10 @@ func (mss *ModelSets) copy_() *ModelSets {
 		LoadbalancerNetworks:  mss.LoadbalancerNetworks.Copy().(LoadbalancerNetworks),
 		LoadbalancerListeners: mss.LoadbalancerListeners.Copy().(LoadbalancerListeners),
 		LoadbalancerAcls:      mss.LoadbalancerAcls.Copy().(LoadbalancerAcls),
+
+		NatGateways: mss.NatGateways.Copy().(NatGateways),
+		NatDEntries: mss.NatDEntries.Copy().(NatDEntries),
+		NatSEntries: mss.NatSEntries.Copy().(NatSEntries),
 	}
 	return mssCopy
 }
@@ -266,6 +290,16 @@ func (mss *ModelSets) join() bool {
 	msg = append(msg, "mss.LoadbalancerNetworks.joinLoadbalancerListeners(mss.LoadbalancerListeners)")
 	p = append(p, mss.LoadbalancerListeners.joinLoadbalancerAcls(mss.LoadbalancerAcls))
 	msg = append(msg, "mss.LoadbalancerListeners.joinLoadbalancerAcls(mss.LoadbalancerAcls)")
+	p = append(p, mss.Vpcs.joinNatGateways(mss.NatGateways))
+	msg = append(msg, "mss.Vpcs.joinNatGateways(mss.NatGateways)")
+	p = append(p, mss.NatGateways.joinElasticips(mss.Elasticips))
+	msg = append(msg, "mss.NatGateways.joinElasticips(mss.Elasticips)")
+	p = append(p, mss.NatGateways.joinNatDEntries(mss.NatDEntries))
+	msg = append(msg, "mss.NatGateways.joinNatDEntries(mss.NatDEntries)")
+	p = append(p, mss.NatGateways.joinNatSEntries(mss.NatSEntries))
+	msg = append(msg, "mss.NatGateways.joinNatSEntries(mss.NatSEntries)")
+	p = append(p, mss.Networks.joinNatSEntries(mss.NatSEntries))
+	msg = append(msg, "mss.Networks.joinNatSEntries(mss.NatSEntries)")
 	ret := true
 	var failMsg []string
 	for i, b := range p {
@@ -40,6 +40,7 @@ type VpcAgentOptions struct {
 	OvnWorkerCheckInterval int    `default:"180"`
 	OvnNorthDatabase       string `help:"address for accessing ovn north database.  Default to local unix socket"`
 	OvnUnderlayMtu         int    `help:"mtu of ovn underlay network" default:"1500"`
+	OvnEipgwChassis        string `help:"name of ovn chassis running eip gateway.  NAT and load balancers of vpc nat gateways are realized on this chassis"`
 }
 
 type Options struct {
@@ -15,6 +15,8 @@
 package ovn
 
 import (
+	"sort"
+
 	apis "yunion.io/x/onecloud/pkg/apis/compute"
 	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
 )
@@ -42,3 +44,22 @@ func vpcHasEipgw(vpc *agentmodels.Vpc) bool {
 		return false
 	}
 }
+
+// vpcHasNatgw returns true if the external router port to eip gateway should
+// be bound to the eip gateway chassis for realizing nat gateways of vpc
+func vpcHasNatgw(vpc *agentmodels.Vpc) bool {
+	return vpcHasEipgw(vpc) && len(vpc.NatGateways) > 0
+}
+
+// vpcNatEips returns sorted addresses of eips associated with nat gateways of
+// vpc.  Eip gateway routes them as is to the vpc
+func vpcNatEips(vpc *agentmodels.Vpc) []string {
+	var r []string
+	for _, natgateway := range vpc.NatGateways {
+		for _, eip := range natgateway.Elasticips {
+			r = append(r, eip.IpAddr)
+		}
+	}
+	sort.Strings(r)
+	return r
+}
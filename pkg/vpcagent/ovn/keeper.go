@@ -29,6 +29,7 @@ import (
 
 	apis "yunion.io/x/onecloud/pkg/apis/compute"
 	"yunion.io/x/onecloud/pkg/mcclient/auth"
+	"yunion.io/x/onecloud/pkg/util/netutils2"
 	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
 	"yunion.io/x/onecloud/pkg/vpcagent/options"
 	"yunion.io/x/onecloud/pkg/vpcagent/ovn/mac"
@@ -38,6 +39,11 @@ import (
 const (
 	externalKeyOcVersion = "oc-version"
 	externalKeyOcRef     = "oc-ref"
+
+	// externalKeyNatEips is set on Logical_Switch_Port of eip gateway with
+	// comma separated addresses of nat gateway eips.  Unlike eips of
+	// guests, eip gateway routes them to vpc without translation
+	externalKeyNatEips = "nat-eips"
 )
 
 type OVNNorthboundKeeper struct {
@@ -57,6 +63,9 @@ func DumpOVNNorthbound(ctx context.Context, cli *ovnutil.OvnNbCtl) (*OVNNorthbou
 		&db.DHCPOptions,
 		&db.QoS,
 		&db.DNS,
+		&db.NAT,
+		&db.LoadBalancer,
+		&db.GatewayChassis,
 	}
 	args := []string{"--format=json", "list", "<tbl>"}
 	for _, itbl := range itbls {
@@ -86,7 +95,21 @@ func ovnCreateArgs(irow types.IRow, idRef string) []string {
 	return args
 }
 
-func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodels.Vpc) error {
+// dhcp6OptRef returns oc-ref of the ipv6 DHCP_Options of the network.  The
+// ipv4 one is referenced by network id
+func dhcp6OptRef(netId string) string {
+	return fmt.Sprintf("dhcp6/%s", netId)
+}
+
+func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodels.Vpc, opts *options.Options) error {
+	args := keeper.claimVpcArgs(vpc, opts)
+	if len(args) == 0 {
+		return nil
+	}
+	return keeper.cli.Must(ctx, "ClaimVpc", args)
+}
+
+func (keeper *OVNNorthboundKeeper) claimVpcArgs(vpc *agentmodels.Vpc, opts *options.Options) []string {
 	var (
 		args      []string
 		ocVersion = fmt.Sprintf("%s.%d", vpc.UpdatedAt, vpc.UpdateVersion)
@@ -103,13 +126,14 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 	)
 
 	var (
-		vpcExtLr        *ovn_nb.LogicalRouter
-		vpcExtLs        *ovn_nb.LogicalSwitch
-		vpcR1extp       *ovn_nb.LogicalRouterPort
-		vpcExtr1p       *ovn_nb.LogicalSwitchPort
-		vpcR2extp       *ovn_nb.LogicalRouterPort
-		vpcExtr2p       *ovn_nb.LogicalSwitchPort
-		vpcDefaultRoute *ovn_nb.LogicalRouterStaticRoute
+		vpcExtLr         *ovn_nb.LogicalRouter
+		vpcExtLs         *ovn_nb.LogicalSwitch
+		vpcR1extp        *ovn_nb.LogicalRouterPort
+		vpcExtr1p        *ovn_nb.LogicalSwitchPort
+		vpcR2extp        *ovn_nb.LogicalRouterPort
+		vpcExtr2p        *ovn_nb.LogicalSwitchPort
+		vpcDefaultRoute  *ovn_nb.LogicalRouterStaticRoute
+		vpcDefaultRoute6 *ovn_nb.LogicalRouterStaticRoute
 	)
 	if hasDistgw || hasEipgw {
 		vpcExtLr = &ovn_nb.LogicalRouter{
@@ -119,9 +143,12 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 			Name: vpcExtLsName(vpc.Id),
 		}
 		vpcR1extp = &ovn_nb.LogicalRouterPort{
-			Name:     vpcR1extpName(vpc.Id),
-			Mac:      apis.VpcInterExtMac1,
-			Networks: []string{fmt.Sprintf("%s/%d", apis.VpcInterExtIP1(), apis.VpcInterExtMask)},
+			Name: vpcR1extpName(vpc.Id),
+			Mac:  apis.VpcInterExtMac1,
+			Networks: []string{
+				fmt.Sprintf("%s/%d", apis.VpcInterExtIP1(), apis.VpcInterExtMask),
+				fmt.Sprintf("%s/%d", apis.VpcInterExtIP1V6, apis.VpcInterExtMaskV6),
+			},
 		}
 		vpcExtr1p = &ovn_nb.LogicalSwitchPort{
 			Name:      vpcExtr1pName(vpc.Id),
@@ -132,9 +159,12 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 			},
 		}
 		vpcR2extp = &ovn_nb.LogicalRouterPort{
-			Name:     vpcR2extpName(vpc.Id),
-			Mac:      apis.VpcInterExtMac2,
-			Networks: []string{fmt.Sprintf("%s/%d", apis.VpcInterExtIP2(), apis.VpcInterExtMask)},
+			Name: vpcR2extpName(vpc.Id),
+			Mac:  apis.VpcInterExtMac2,
+			Networks: []string{
+				fmt.Sprintf("%s/%d", apis.VpcInterExtIP2(), apis.VpcInterExtMask),
+				fmt.Sprintf("%s/%d", apis.VpcInterExtIP2V6, apis.VpcInterExtMaskV6),
+			},
 		}
 		vpcExtr2p = &ovn_nb.LogicalSwitchPort{
 			Name:      vpcExtr2pName(vpc.Id),
@@ -150,6 +180,12 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 			Nexthop:    apis.VpcInterExtIP2().String(),
 			OutputPort: ptr(vpcR1extpName(vpc.Id)),
 		}
+		vpcDefaultRoute6 = &ovn_nb.LogicalRouterStaticRoute{
+			Policy:     ptr("dst-ip"),
+			IpPrefix:   "::/0",
+			Nexthop:    apis.VpcInterExtIP2V6,
+			OutputPort: ptr(vpcR1extpName(vpc.Id)),
+		}
 		irows = append(irows,
 			vpcExtLr,
 			vpcExtLs,
@@ -158,6 +194,7 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 			vpcR2extp,
 			vpcExtr2p,
 			vpcDefaultRoute,
+			vpcDefaultRoute6,
 		)
 	}
 
@@ -193,9 +230,10 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 
 	// eipgw
 	var (
-		vpcEipLs *ovn_nb.LogicalSwitch
-		vpcRep   *ovn_nb.LogicalRouterPort
-		vpcErp   *ovn_nb.LogicalSwitchPort
+		vpcEipLs  *ovn_nb.LogicalSwitch
+		vpcRep    *ovn_nb.LogicalRouterPort
+		vpcErp    *ovn_nb.LogicalSwitchPort
+		vpcRepGwc *ovn_nb.GatewayChassis
 	)
 	if hasEipgw {
 		vpcEipLs = &ovn_nb.LogicalSwitch{
@@ -219,6 +257,17 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 			vpcRep,
 			vpcErp,
 		)
+		// NAT rows and load balancers of nat gateways take effect only
+		// on routers with a gateway port.  Make vpcRep a distributed
+		// gateway port on eip gateway chassis
+		if vpcHasNatgw(vpc) && opts.OvnEipgwChassis != "" {
+			vpcRepGwc = &ovn_nb.GatewayChassis{
+				Name:        vpcRepGwcName(vpc.Id, opts.OvnEipgwChassis),
+				ChassisName: opts.OvnEipgwChassis,
+				Priority:    1,
+			}
+			irows = append(irows, vpcRepGwc)
+		}
 	}
 
 	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
@@ -235,6 +284,8 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 		args = append(args, ovnCreateArgs(vpcExtr2p, vpcExtr2p.Name)...)
 		args = append(args, ovnCreateArgs(vpcDefaultRoute, "vpcDefaultRoute")...)
 		args = append(args, "--", "add", "Logical_Router", vpcLrName(vpc.Id), "static_routes", "@vpcDefaultRoute")
+		args = append(args, ovnCreateArgs(vpcDefaultRoute6, "vpcDefaultRoute6")...)
+		args = append(args, "--", "add", "Logical_Router", vpcLrName(vpc.Id), "static_routes", "@vpcDefaultRoute6")
 		args = append(args, "--", "add", "Logical_Switch", vpcExtLs.Name, "ports", "@"+vpcExtr1p.Name)
 		args = append(args, "--", "add", "Logical_Router", vpcLr.Name, "ports", "@"+vpcR1extp.Name)
 		args = append(args, "--", "add", "Logical_Switch", vpcExtLs.Name, "ports", "@"+vpcExtr2p.Name)
@@ -253,8 +304,12 @@ func (keeper *OVNNorthboundKeeper) ClaimVpc(ctx context.Context, vpc *agentmodel
 		args = append(args, ovnCreateArgs(vpcErp, vpcErp.Name)...)
 		args = append(args, "--", "add", "Logical_Switch", vpcEipLs.Name, "ports", "@"+vpcErp.Name)
 		args = append(args, "--", "add", "Logical_Router", vpcExtLr.Name, "ports", "@"+vpcRep.Name)
+		if vpcRepGwc != nil {
+			args = append(args, ovnCreateArgs(vpcRepGwc, "vpcRepGwc")...)
+			args = append(args, "--", "add", "Logical_Router_Port", vpcRep.Name, "gateway_chassis", "@vpcRepGwc")
+		}
 	}
-	return keeper.cli.Must(ctx, "ClaimVpc", args)
+	return args
 }
 
 func (keeper *OVNNorthboundKeeper) ClaimNetwork(ctx context.Context, network *agentmodels.Network, opts *options.Options) error {
@@ -363,18 +418,61 @@ func (keeper *OVNNorthboundKeeper) ClaimNetwork(ctx context.Context, network *ag
 		}
 	}
 
+	// ipv6 addresses are handed out by stateful dhcpv6.  Router
+	// advertisements tell guests to do so and where the default
+	// gateway is
+	var (
+		dhcp6opts        *ovn_nb.DHCPOptions
+		vpcExtBackRoute6 *ovn_nb.LogicalRouterStaticRoute
+	)
+	if network.HasIPv6() {
+		gateway6, err := netutils2.ParseIPV6Addr(network.GuestGateway6)
+		if err != nil {
+			return errors.Wrapf(err, "network %s gateway6", network.Id)
+		}
+		netAddr6 := netutils2.IPV6NetAddr(gateway6, network.GuestIp6Mask)
+		netRnp.Networks = append(netRnp.Networks, fmt.Sprintf("%s/%d", gateway6, network.GuestIp6Mask))
+		netRnp.Ipv6RaConfigs = map[string]string{
+			"address_mode":  "dhcpv6_stateful",
+			"send_periodic": "true",
+			"mtu":           fmt.Sprintf("%d", mtu),
+		}
+		dhcp6opts = &ovn_nb.DHCPOptions{
+			Cidr: fmt.Sprintf("%s/%d", netAddr6, network.GuestIp6Mask),
+			Options: map[string]string{
+				"server_id": dhcpMac,
+			},
+			ExternalIds: map[string]string{
+				externalKeyOcRef: dhcp6OptRef(network.Id),
+			},
+		}
+		if network.GuestDns6 != "" {
+			dhcp6opts.Options["dns_server"] = "{" + network.GuestDns6 + "}"
+		}
+		vpcExtBackRoute6 = &ovn_nb.LogicalRouterStaticRoute{
+			Policy:     ptr("dst-ip"),
+			IpPrefix:   fmt.Sprintf("%s/%d", netAddr6, network.GuestIp6Mask),
+			Nexthop:    apis.VpcInterExtIP1V6,
+			OutputPort: ptr(vpcR2extpName(vpc.Id)),
+		}
+	}
+
 	var (
 		args      []string
 		ocVersion = fmt.Sprintf("%s.%d", network.UpdatedAt, network.UpdateVersion)
 	)
-	allFound, args := cmp(&keeper.DB, ocVersion,
+	irows := []types.IRow{
 		netLs,
 		netRnp,
 		netNrp,
 		netMdp,
 		dhcpopts,
 		vpcExtBackRoute,
-	)
+	}
+	if dhcp6opts != nil {
+		irows = append(irows, dhcp6opts, vpcExtBackRoute6)
+	}
+	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
 	if allFound {
 		return nil
 	}
@@ -383,10 +481,17 @@ func (keeper *OVNNorthboundKeeper) ClaimNetwork(ctx context.Context, network *ag
 	args = append(args, ovnCreateArgs(netNrp, netNrp.Name)...)
 	args = append(args, ovnCreateArgs(netMdp, netMdp.Name)...)
 	args = append(args, ovnCreateArgs(dhcpopts, "dhcpopts")...)
+	if dhcp6opts != nil {
+		args = append(args, ovnCreateArgs(dhcp6opts, "dhcp6opts")...)
+	}
 	args = append(args, ovnCreateArgs(vpcExtBackRoute, "vpcExtBackRoute")...)
 	args = append(args, "--", "add", "Logical_Switch", netLs.Name, "ports", "@"+netNrp.Name, "@"+netMdp.Name)
 	args = append(args, "--", "add", "Logical_Router", vpcLrName(vpc.Id), "ports", "@"+netRnp.Name)
 	args = append(args, "--", "add", "Logical_Router", vpcExtLrName(vpc.Id), "static_routes", "@vpcExtBackRoute")
+	if vpcExtBackRoute6 != nil {
+		args = append(args, ovnCreateArgs(vpcExtBackRoute6, "vpcExtBackRoute6")...)
+		args = append(args, "--", "add", "Logical_Router", vpcExtLrName(vpc.Id), "static_routes", "@vpcExtBackRoute6")
+	}
 	return keeper.cli.Must(ctx, "ClaimNetwork", args)
 }
 
@@ -422,13 +527,27 @@ func (keeper *OVNNorthboundKeeper) ClaimVpcEipgw(ctx context.Context, vpc *agent
 	var (
 		ocVersion = fmt.Sprintf("%s.%d", vpc.UpdatedAt, vpc.UpdateVersion)
 		eipgwVip  = apis.VpcEipGatewayIP3().String()
+		natEips   = strings.Join(vpcNatEips(vpc), ",")
 	)
 	vpcEipLsp := &ovn_nb.LogicalSwitchPort{
 		Name:      vpcEipLspName(vpc.Id, eipgwVip),
 		Addresses: []string{fmt.Sprintf("%s %s", apis.VpcEipGatewayMac3, eipgwVip)},
 	}
+	natEipsArgs := func(lsp string, cur string) []string {
+		if cur == natEips {
+			return nil
+		}
+		if natEips == "" {
+			return []string{"--", "--if-exists", "remove", "Logical_Switch_Port", lsp, "external_ids", externalKeyNatEips}
+		}
+		return []string{"--", "set", "Logical_Switch_Port", lsp, fmt.Sprintf("external_ids:%s=%q", externalKeyNatEips, natEips)}
+	}
 	if m := keeper.DB.LogicalSwitchPort.FindOneMatchNonZeros(vpcEipLsp); m != nil {
 		m.SetExternalId(externalKeyOcVersion, ocVersion)
+		cur, _ := m.GetExternalId(externalKeyNatEips)
+		if args := natEipsArgs(m.Name, cur); len(args) > 0 {
+			return keeper.cli.Must(ctx, "ClaimVpcEipgw nat eips", args)
+		}
 		return nil
 	} else {
 		args := []string{
@@ -438,9 +557,18 @@ func (keeper *OVNNorthboundKeeper) ClaimVpcEipgw(ctx context.Context, vpc *agent
 		res := keeper.cli.Must(ctx, "find vpcEipLsp", args)
 		vpcEipLspUuid := strings.TrimSpace(res.Output)
 		if vpcEipLspUuid != "" {
+			// created after the dump, update nat eips anyway
+			if args := natEipsArgs(vpcEipLspUuid, ""); len(args) > 0 {
+				return keeper.cli.Must(ctx, "ClaimVpcEipgw nat eips", args)
+			}
 			return nil
 		}
 	}
+	if natEips != "" {
+		vpcEipLsp.ExternalIds = map[string]string{
+			externalKeyNatEips: natEips,
+		}
+	}
 	var args []string
 	args = append(args, ovnCreateArgs(vpcEipLsp, vpcEipLsp.Name)...)
 	args = append(args, "--", "add", "Logical_Switch", vpcEipLsName(vpc.Id), "ports", "@"+vpcEipLsp.Name)
@@ -486,6 +614,29 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 		}
 	}
 
+	var dhcp6Opt string
+	if guestnetwork.Ip6Addr != "" {
+		dhcp6Ref := dhcp6OptRef(guestnetwork.NetworkId)
+		dhcp6OptQuery := &ovn_nb.DHCPOptions{
+			ExternalIds: map[string]string{
+				externalKeyOcRef: dhcp6Ref,
+			},
+		}
+		if m := keeper.DB.DHCPOptions.FindOneMatchNonZeros(dhcp6OptQuery); m != nil {
+			dhcp6Opt = m.OvsdbUuid()
+		} else {
+			args := []string{
+				"--bare", "--columns=_uuid", "find", "DHCP_Options",
+				fmt.Sprintf("external_ids:%s=%q", externalKeyOcRef, dhcp6Ref),
+			}
+			res := keeper.cli.Must(ctx, "find dhcp6opt", args)
+			dhcp6Opt = strings.TrimSpace(res.Output)
+		}
+		if dhcp6Opt == "" {
+			return fmt.Errorf("cannot find dhcp6opt for subnet %s", guestnetwork.NetworkId)
+		}
+	}
+
 	var (
 		subIPs  = []string{guestnetwork.IpAddr}
 		subIPms = []string{fmt.Sprintf("%s/%d", guestnetwork.IpAddr, guestnetwork.Network.GuestIpMask)}
@@ -497,12 +648,19 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 	subIPms = append(subIPms, guestnetwork.Guest.GetVips()...)
 	sort.Strings(subIPs[1:])
 	sort.Strings(subIPms[1:])
+	if guestnetwork.Ip6Addr != "" {
+		subIPs = append(subIPs, guestnetwork.Ip6Addr)
+		subIPms = append(subIPms, fmt.Sprintf("%s/%d", guestnetwork.Ip6Addr, network.GuestIp6Mask))
+	}
 	gnp := &ovn_nb.LogicalSwitchPort{
 		Name:          lportName,
 		Addresses:     []string{fmt.Sprintf("%s %s", guestnetwork.MacAddr, strings.Join(subIPs, " "))},
 		Dhcpv4Options: &dhcpOpt,
 		Options:       map[string]string{},
 	}
+	if dhcp6Opt != "" {
+		gnp.Dhcpv6Options = &dhcp6Opt
+	}
 	if guest.SrcMacCheck.IsFalse() {
 		gnp.Addresses = append(gnp.Addresses, "unknown")
 		// empty, not nil, as match condition
@@ -605,7 +763,7 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 				}
 			}
 
-		} else if vpcHasDistgw(vpc) {
+		} else if vpcHasDistgw(vpc) && !vpcNatEgress(vpc, guestnetwork.IpAddr) {
 			gnrDefault = &ovn_nb.LogicalRouterStaticRoute{
 				Policy:     &gnrDefaultPolicy,
 				IpPrefix:   guestnetwork.IpAddr + "/32",
@@ -635,6 +793,17 @@ func (keeper *OVNNorthboundKeeper) ClaimGuestnetwork(ctx context.Context, guestn
 				externalKeyOcRef: ocAclRef,
 			}
 			acls = append(acls, acl)
+			if guestnetwork.Ip6Addr != "" && ruleIsAnyAddr(sgr) && !ruleIsIPv6(sgr) {
+				acl6, err := ruleToAcl6(lportName, sgr)
+				if err != nil {
+					log.Errorf("converting security group rule to ipv6 acl: %v", err)
+					break
+				}
+				acl6.ExternalIds = map[string]string{
+					externalKeyOcRef: ocAclRef,
+				}
+				acls = append(acls, acl6)
+			}
 		}
 	}
 
@@ -1077,6 +1246,127 @@ func (keeper *OVNNorthboundKeeper) ClaimGroupnetwork(ctx context.Context, groupn
 	return keeper.cli.Must(ctx, "ClaimGroupnetworks", args)
 }
 
+// ClaimNatGateway programs snat rules as NAT rows and dnat port forwards as
+// Load_Balancer rows on the external router of vpc.  Source networks and
+// internal addresses of the rules are routed to eip gateway
+func (keeper *OVNNorthboundKeeper) ClaimNatGateway(ctx context.Context, natgateway *agentmodels.NatGateway) error {
+	var (
+		// Callers assure that natgateway.Vpc is not nil
+		vpc       = natgateway.Vpc
+		lrName    = vpcExtLrName(vpc.Id)
+		eipgwVip  = apis.VpcEipGatewayIP3().String()
+		ocVersion = fmt.Sprintf("%s.%d", natgateway.UpdatedAt, natgateway.UpdateVersion)
+		rules     = resolveNatRules(natgateway)
+	)
+
+	var (
+		nats   []*ovn_nb.NAT
+		routes []*ovn_nb.LogicalRouterStaticRoute
+		lbs    []*ovn_nb.LoadBalancer
+	)
+	routePrefixes := map[string]bool{}
+	addRoute := func(ipPrefix string) {
+		if routePrefixes[ipPrefix] {
+			return
+		}
+		routePrefixes[ipPrefix] = true
+		routes = append(routes, &ovn_nb.LogicalRouterStaticRoute{
+			Policy:     ptr("src-ip"),
+			IpPrefix:   ipPrefix,
+			Nexthop:    eipgwVip,
+			OutputPort: ptr(vpcRepName(vpc.Id)),
+			ExternalIds: map[string]string{
+				externalKeyOcRef: fmt.Sprintf("natRoute/%s/%s", natgateway.Id, ipPrefix),
+			},
+		})
+	}
+	for _, snat := range rules.snats {
+		cidr := snat.prefix.String()
+		nats = append(nats, &ovn_nb.NAT{
+			Type:       "snat",
+			LogicalIp:  cidr,
+			ExternalIp: snat.IP,
+			ExternalIds: map[string]string{
+				externalKeyOcRef: fmt.Sprintf("snat/%s/%s", natgateway.Id, snat.Id),
+			},
+		})
+		addRoute(cidr)
+	}
+	lbVips := map[string]map[string]string{}
+	for _, dnat := range rules.dnats {
+		proto := strings.ToLower(dnat.IpProtocol)
+		vips, ok := lbVips[proto]
+		if !ok {
+			vips = map[string]string{}
+			lbVips[proto] = vips
+		}
+		vip := fmt.Sprintf("%s:%d", dnat.ExternalIP, dnat.ExternalPort)
+		if _, ok := vips[vip]; ok {
+			log.Warningf("natdentry %s(%s): duplicate external address %s", dnat.Name, dnat.Id, vip)
+			continue
+		}
+		vips[vip] = fmt.Sprintf("%s:%d", dnat.InternalIP, dnat.InternalPort)
+		if addr, err := netutils.NewIPV4Addr(dnat.InternalIP); err == nil && !rules.snatCovers(addr) {
+			addRoute(dnat.InternalIP + "/32")
+		}
+	}
+	protos := make([]string, 0, len(lbVips))
+	for proto := range lbVips {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+	for _, proto := range protos {
+		lbs = append(lbs, &ovn_nb.LoadBalancer{
+			Name:     fmt.Sprintf("nat/%s/%s", natgateway.Id, proto),
+			Protocol: ptr(proto),
+			Vips:     lbVips[proto],
+		})
+	}
+
+	var irows []types.IRow
+	for _, nat := range nats {
+		irows = append(irows, nat)
+	}
+	for _, route := range routes {
+		irows = append(irows, route)
+	}
+	for _, lb := range lbs {
+		irows = append(irows, lb)
+	}
+	allFound, args := cmp(&keeper.DB, ocVersion, irows...)
+	if allFound {
+		return nil
+	}
+	// NAT rows and routes are not destroyed by cmp.  Remove those of the
+	// nat gateway before recreating them
+	for _, irow := range keeper.DB.NAT.Rows() {
+		if ref, _ := irow.GetExternalId(externalKeyOcRef); strings.HasPrefix(ref, "snat/"+natgateway.Id+"/") {
+			args = append(args, "--", "--if-exists", "remove", "Logical_Router", lrName, "nat", irow.OvsdbUuid())
+		}
+	}
+	for _, irow := range keeper.DB.LogicalRouterStaticRoute.Rows() {
+		if ref, _ := irow.GetExternalId(externalKeyOcRef); strings.HasPrefix(ref, "natRoute/"+natgateway.Id+"/") {
+			args = append(args, "--", "--if-exists", "remove", "Logical_Router", lrName, "static_routes", irow.OvsdbUuid())
+		}
+	}
+	for i, nat := range nats {
+		ref := fmt.Sprintf("nat%d", i)
+		args = append(args, ovnCreateArgs(nat, ref)...)
+		args = append(args, "--", "add", "Logical_Router", lrName, "nat", "@"+ref)
+	}
+	for i, route := range routes {
+		ref := fmt.Sprintf("natRoute%d", i)
+		args = append(args, ovnCreateArgs(route, ref)...)
+		args = append(args, "--", "add", "Logical_Router", lrName, "static_routes", "@"+ref)
+	}
+	for i, lb := range lbs {
+		ref := fmt.Sprintf("natLb%d", i)
+		args = append(args, ovnCreateArgs(lb, ref)...)
+		args = append(args, "--", "add", "Logical_Router", lrName, "load_balancer", "@"+ref)
+	}
+	return keeper.cli.Must(ctx, "ClaimNatGateway", args)
+}
+
 func (keeper *OVNNorthboundKeeper) Mark(ctx context.Context) {
 	db := &keeper.DB
 	itbls := []types.ITable{
@@ -1089,6 +1379,9 @@ func (keeper *OVNNorthboundKeeper) Mark(ctx context.Context) {
 		&db.DHCPOptions,
 		&db.QoS,
 		&db.DNS,
+		&db.NAT,
+		&db.LoadBalancer,
+		&db.GatewayChassis,
 	}
 	for _, itbl := range itbls {
 		for _, irow := range itbl.Rows() {
@@ -1107,6 +1400,7 @@ func (keeper *OVNNorthboundKeeper) Sweep(ctx context.Context) error {
 		&db.LogicalRouter,
 		&db.DHCPOptions,
 		&db.DNS,
+		&db.LoadBalancer,
 	}
 	var irows []types.IRow
 	for _, itbl := range itbls {
@@ -1164,5 +1458,33 @@ func (keeper *OVNNorthboundKeeper) Sweep(ctx context.Context) error {
 			keeper.cli.Must(ctx, "Sweep qos", args)
 		}
 	}
+	{
+		var args []string
+		for _, irow := range db.NAT.Rows() {
+			_, ok := irow.GetExternalId(externalKeyOcVersion)
+			if !ok {
+				for _, lr := range db.LogicalRouter.FindNATReferrer_nat(irow.OvsdbUuid()) {
+					args = append(args, "--", "--if-exists", "remove", "Logical_Router", lr.Name, "nat", irow.OvsdbUuid())
+				}
+			}
+		}
+		if len(args) > 0 {
+			keeper.cli.Must(ctx, "Sweep nat", args)
+		}
+	}
+	{
+		var args []string
+		for _, irow := range db.GatewayChassis.Rows() {
+			_, ok := irow.GetExternalId(externalKeyOcVersion)
+			if !ok {
+				for _, lrp := range db.LogicalRouterPort.FindGatewayChassisReferrer_gateway_chassis(irow.OvsdbUuid()) {
+					args = append(args, "--", "--if-exists", "remove", "Logical_Router_Port", lrp.Name, "gateway_chassis", irow.OvsdbUuid())
+				}
+			}
+		}
+		if len(args) > 0 {
+			keeper.cli.Must(ctx, "Sweep gateway chassis", args)
+		}
+	}
 	return nil
 }
@@ -81,6 +81,10 @@ func vpcEipLspName(vpcId string, eipgwId string) string {
 	return fmt.Sprintf("vpc-ep/%s/%s", vpcId, eipgwId)
 }
 
+func vpcRepGwcName(vpcId string, chassis string) string {
+	return fmt.Sprintf("vpc-re/%s/%s", vpcId, chassis)
+}
+
 func netLsName(netId string) string {
 	return fmt.Sprintf("subnet/%s", netId)
 }
@@ -0,0 +1,126 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/util/netutils"
+
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+)
+
+type natSRule struct {
+	*agentmodels.NatSEntry
+
+	prefix netutils.IPV4Prefix
+}
+
+// natRules contains effective rules of nat gateway, i.e. entries bound to
+// eips associated with the nat gateway
+type natRules struct {
+	snats []natSRule
+	dnats []*agentmodels.NatDEntry
+}
+
+func resolveNatRules(natgateway *agentmodels.NatGateway) *natRules {
+	eipAddrs := map[string]bool{}
+	for _, eip := range natgateway.Elasticips {
+		eipAddrs[eip.IpAddr] = true
+	}
+
+	rules := &natRules{}
+	for _, snat := range natgateway.NatSEntries {
+		if !eipAddrs[snat.IP] {
+			log.Debugf("natsentry %s(%s): eip %s not associated with natgateway %s",
+				snat.Name, snat.Id, snat.IP, natgateway.Id)
+			continue
+		}
+		var cidr string
+		if snat.NetworkId != "" {
+			if snat.Network == nil {
+				log.Debugf("natsentry %s(%s): network %s not found", snat.Name, snat.Id, snat.NetworkId)
+				continue
+			}
+			cidr = fmt.Sprintf("%s/%d", snat.Network.GuestGateway, snat.Network.GuestIpMask)
+		} else {
+			cidr = snat.SourceCIDR
+		}
+		prefix, err := netutils.NewIPV4Prefix(cidr)
+		if err != nil {
+			log.Debugf("natsentry %s(%s): invalid source cidr %s: %v", snat.Name, snat.Id, cidr, err)
+			continue
+		}
+		rules.snats = append(rules.snats, natSRule{
+			NatSEntry: snat,
+			prefix:    prefix,
+		})
+	}
+	for _, dnat := range natgateway.NatDEntries {
+		if !eipAddrs[dnat.ExternalIP] {
+			log.Debugf("natdentry %s(%s): eip %s not associated with natgateway %s",
+				dnat.Name, dnat.Id, dnat.ExternalIP, natgateway.Id)
+			continue
+		}
+		switch strings.ToLower(dnat.IpProtocol) {
+		case "tcp", "udp":
+		default:
+			log.Debugf("natdentry %s(%s): unsupported protocol %s", dnat.Name, dnat.Id, dnat.IpProtocol)
+			continue
+		}
+		rules.dnats = append(rules.dnats, dnat)
+	}
+	sort.Slice(rules.snats, func(i, j int) bool {
+		return rules.snats[i].Id < rules.snats[j].Id
+	})
+	sort.Slice(rules.dnats, func(i, j int) bool {
+		return rules.dnats[i].Id < rules.dnats[j].Id
+	})
+	return rules
+}
+
+func (rules *natRules) snatCovers(addr netutils.IPV4Addr) bool {
+	for _, snat := range rules.snats {
+		if snat.prefix.ToIPRange().Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// vpcNatEgress returns true if egress traffic from ipAddr should go through
+// nat gateway of vpc, i.e. it is within source cidr of snat rules or is the
+// internal address of dnat rules
+func vpcNatEgress(vpc *agentmodels.Vpc, ipAddr string) bool {
+	addr, err := netutils.NewIPV4Addr(ipAddr)
+	if err != nil {
+		return false
+	}
+	for _, natgateway := range vpc.NatGateways {
+		rules := resolveNatRules(natgateway)
+		if rules.snatCovers(addr) {
+			return true
+		}
+		for _, dnat := range rules.dnats {
+			if dnat.InternalIP == ipAddr {
+				return true
+			}
+		}
+	}
+	return false
+}
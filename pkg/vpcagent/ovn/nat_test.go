@@ -0,0 +1,142 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ovn
+
+import (
+	"reflect"
+	"testing"
+
+	apis "yunion.io/x/onecloud/pkg/apis/compute"
+	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
+	"yunion.io/x/onecloud/pkg/vpcagent/options"
+)
+
+func TestResolveNatRules(t *testing.T) {
+	network := &agentmodels.Network{}
+	network.Id = "net0"
+	network.GuestGateway = "192.168.1.1"
+	network.GuestIpMask = 24
+
+	eip := &agentmodels.Elasticip{}
+	eip.Id = "eip0"
+	eip.IpAddr = "10.0.0.10"
+
+	natgateway := &agentmodels.NatGateway{
+		Elasticips:  agentmodels.Elasticips{eip.Id: eip},
+		NatSEntries: agentmodels.NatSEntries{},
+		NatDEntries: agentmodels.NatDEntries{},
+	}
+	natgateway.Id = "nat0"
+
+	newSEntry := func(id, ip string, network *agentmodels.Network, cidr string) {
+		snat := &agentmodels.NatSEntry{Network: network}
+		snat.Id = id
+		snat.IP = ip
+		snat.SourceCIDR = cidr
+		if network != nil {
+			snat.NetworkId = network.Id
+		}
+		natgateway.NatSEntries[id] = snat
+	}
+	newDEntry := func(id, eip string, port int, ip string, proto string) {
+		dnat := &agentmodels.NatDEntry{}
+		dnat.Id = id
+		dnat.ExternalIP = eip
+		dnat.ExternalPort = port
+		dnat.InternalIP = ip
+		dnat.InternalPort = port
+		dnat.IpProtocol = proto
+		natgateway.NatDEntries[id] = dnat
+	}
+	newSEntry("s0", "10.0.0.10", network, "")
+	newSEntry("s1", "10.0.0.10", nil, "192.168.2.0/25")
+	newSEntry("s2", "10.0.0.11", nil, "192.168.3.0/24") // eip not associated
+	newDEntry("d0", "10.0.0.10", 80, "192.168.4.5", "TCP")
+	newDEntry("d1", "10.0.0.10", 53, "192.168.4.6", "udp")
+	newDEntry("d2", "10.0.0.10", 0, "192.168.4.7", "icmp") // unsupported protocol
+	newDEntry("d3", "10.0.0.11", 22, "192.168.4.8", "tcp") // eip not associated
+
+	rules := resolveNatRules(natgateway)
+	if len(rules.snats) != 2 {
+		t.Fatalf("want 2 snat rules, got %d", len(rules.snats))
+	}
+	for i, want := range []string{"192.168.1.0/24", "192.168.2.0/25"} {
+		if got := rules.snats[i].prefix.String(); got != want {
+			t.Errorf("snat %d: want prefix %s, got %s", i, want, got)
+		}
+	}
+	if len(rules.dnats) != 2 || rules.dnats[0].Id != "d0" || rules.dnats[1].Id != "d1" {
+		t.Fatalf("want dnat rules d0, d1, got %d rules", len(rules.dnats))
+	}
+
+	vpc := &agentmodels.Vpc{
+		NatGateways: agentmodels.NatGateways{natgateway.Id: natgateway},
+	}
+	for ip, want := range map[string]bool{
+		"192.168.1.100": true,
+		"192.168.2.100": true,
+		"192.168.2.200": false,
+		"192.168.3.1":   false,
+		"192.168.4.5":   true,
+		"192.168.4.7":   false,
+		"192.168.4.8":   false,
+	} {
+		if got := vpcNatEgress(vpc, ip); got != want {
+			t.Errorf("vpcNatEgress %s: want %v, got %v", ip, want, got)
+		}
+	}
+}
+
+func TestClaimVpcNatGatewayChassis(t *testing.T) {
+	vpc := &agentmodels.Vpc{}
+	vpc.Id = "vpc0"
+	vpc.ExternalAccessMode = apis.VPC_EXTERNAL_ACCESS_MODE_EIP
+	opts := &options.Options{}
+	opts.OvnEipgwChassis = "eipgw0"
+
+	hasArgs := func(args []string, want ...string) bool {
+		for i := 0; i+len(want) <= len(args); i++ {
+			if reflect.DeepEqual(args[i:i+len(want)], want) {
+				return true
+			}
+		}
+		return false
+	}
+	gwcAdd := []string{"--", "add", "Logical_Router_Port", vpcRepName(vpc.Id), "gateway_chassis", "@vpcRepGwc"}
+
+	keeper := &OVNNorthboundKeeper{}
+	args := keeper.claimVpcArgs(vpc, opts)
+	if hasArgs(args, gwcAdd...) {
+		t.Errorf("vpc without nat gateway: unexpected gateway chassis binding: %v", args)
+	}
+
+	vpc.NatGateways = agentmodels.NatGateways{"nat0": &agentmodels.NatGateway{}}
+	args = keeper.claimVpcArgs(vpc, opts)
+	if !hasArgs(args, "--", "--id=@vpcRepGwc", "create", "Gateway_Chassis") {
+		t.Errorf("vpc with nat gateway: want Gateway_Chassis created: %v", args)
+	}
+	if !hasArgs(args, `chassis_name="eipgw0"`) {
+		t.Errorf("vpc with nat gateway: want chassis_name eipgw0: %v", args)
+	}
+	if !hasArgs(args, gwcAdd...) {
+		t.Errorf("vpc with nat gateway: want gateway chassis bound to %s: %v", vpcRepName(vpc.Id), args)
+	}
+
+	opts.OvnEipgwChassis = ""
+	args = keeper.claimVpcArgs(vpc, opts)
+	if hasArgs(args, gwcAdd...) {
+		t.Errorf("no eipgw chassis: unexpected gateway chassis binding: %v", args)
+	}
+}
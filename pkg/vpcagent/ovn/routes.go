@@ -15,6 +15,8 @@
 package ovn
 
 import (
+	"strings"
+
 	computeapis "yunion.io/x/onecloud/pkg/apis/compute"
 	agentmodels "yunion.io/x/onecloud/pkg/vpcagent/models"
 )
@@ -54,9 +56,16 @@ func resolveRoutes(vpc *agentmodels.Vpc, mss *agentmodels.ModelSets) resolvedRou
 				if gnVpc.Id != vpc.Id {
 					continue
 				}
+				nextHop := gn.IpAddr
+				if strings.Contains(routeModel.Cidr, ":") {
+					if gn.Ip6Addr == "" {
+						continue
+					}
+					nextHop = gn.Ip6Addr
+				}
 				r = append(r, resolvedRoute{
 					Cidr:         routeModel.Cidr,
-					NextHop:      gn.IpAddr,
+					NextHop:      nextHop,
 					Network:      network,
 					Guestnetwork: gn,
 				})
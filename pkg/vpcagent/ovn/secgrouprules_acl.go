@@ -35,7 +35,45 @@ const (
 	aclDirFromLport = "from-lport"
 )
 
+// ruleIsIPv6 returns true if the rule only matches ipv6 traffic
+func ruleIsIPv6(rule *agentmodels.SecurityGroupRule) bool {
+	return strings.Contains(rule.CIDR, ":")
+}
+
+// ruleIsAnyAddr returns true if the rule matches traffic of any address
+func ruleIsAnyAddr(rule *agentmodels.SecurityGroupRule) bool {
+	switch cidr := strings.TrimSpace(rule.CIDR); cidr {
+	case "", "0.0.0.0/0", "::/0":
+		return true
+	}
+	return false
+}
+
+// ruleToAcl converts the rule to an ACL matching ipv4 traffic, or ipv6
+// traffic when the rule cidr is an ipv6 one
 func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule) (*ovn_nb.ACL, error) {
+	return ruleToAclFamily(lport, rule, ruleIsIPv6(rule))
+}
+
+// ruleToAcl6 converts the rule with any address to an ACL matching ipv6
+// traffic
+func ruleToAcl6(lport string, rule *agentmodels.SecurityGroupRule) (*ovn_nb.ACL, error) {
+	if !ruleIsAnyAddr(rule) {
+		return nil, errors.Wrapf(errBadSecgroupRule, "cidr %q is not for any address", rule.CIDR)
+	}
+	return ruleToAclFamily(lport, rule, true)
+}
+
+func ruleToAclFamily(lport string, rule *agentmodels.SecurityGroupRule, ipv6 bool) (*ovn_nb.ACL, error) {
+	var (
+		l3proto = "ip4"
+		icmp    = "icmp4"
+	)
+	if ipv6 {
+		l3proto = "ip6"
+		icmp = "icmp6"
+	}
+
 	var (
 		dir    string
 		action string
@@ -72,9 +110,9 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule) (*ovn_nb.ACL,
 	}
 
 	addL3Match := func() {
-		matches = append(matches, "ip4")
-		if cidr := strings.TrimSpace(rule.CIDR); cidr != "" && cidr != "0.0.0.0/0" {
-			matches = append(matches, fmt.Sprintf("ip4.%s == %s", l3subfn, cidr))
+		matches = append(matches, l3proto)
+		if !ruleIsAnyAddr(rule) {
+			matches = append(matches, fmt.Sprintf("%s.%s == %s", l3proto, l3subfn, strings.TrimSpace(rule.CIDR)))
 		}
 	}
 	addL4Match := func(l4proto string) {
@@ -153,7 +191,7 @@ func ruleToAcl(lport string, rule *agentmodels.SecurityGroupRule) (*ovn_nb.ACL,
 		addL4Match("udp")
 	case secrules.PROTO_ICMP:
 		addL3Match()
-		matches = append(matches, "icmp4")
+		matches = append(matches, icmp)
 	default:
 		return nil, errors.Wrapf(errBadSecgroupRule, "unknown protocol %q", rule.Protocol)
 	}
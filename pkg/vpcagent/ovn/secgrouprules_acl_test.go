@@ -106,6 +106,24 @@ func TestRuleToACL(t *testing.T) {
 				Priority:  100,
 			},
 		},
+		{
+			// ingress allow icmp from fd00:1::/64
+			rule: &agentmodels.SecurityGroupRule{
+				SSecurityGroupRule: models.SSecurityGroupRule{
+					Direction: string(secrules.SecurityRuleIngress),
+					CIDR:      "fd00:1::/64",
+					Action:    string(secrules.SecurityRuleAllow),
+					Protocol:  secrules.PROTO_ICMP,
+					Priority:  50,
+				},
+			},
+			acl: &ovn_nb.ACL{
+				Direction: aclDirToLport,
+				Action:    "allow-related",
+				Match:     fmt.Sprintf("outport == %q && ip6 && ip6.src == fd00:1::/64 && icmp6", lport),
+				Priority:  50,
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -119,3 +137,35 @@ func TestRuleToACL(t *testing.T) {
 		}
 	}
 }
+
+func TestRuleToACL6(t *testing.T) {
+	lport := "local-port120"
+	rule := &agentmodels.SecurityGroupRule{
+		SSecurityGroupRule: models.SSecurityGroupRule{
+			Direction: string(secrules.SecurityRuleIngress),
+			CIDR:      "0.0.0.0/0",
+			Action:    string(secrules.SecurityRuleAllow),
+			Protocol:  secrules.PROTO_UDP,
+			Ports:     "53,5353",
+			Priority:  100,
+		},
+	}
+	want := &ovn_nb.ACL{
+		Direction: aclDirToLport,
+		Action:    "allow-related",
+		Match:     fmt.Sprintf("outport == %q && ip6 && udp && ( udp.dst == 53 || udp.dst == 5353 )", lport),
+		Priority:  100,
+	}
+	got, err := ruleToAcl6(lport, rule)
+	if err != nil {
+		t.Fatalf("ruleToAcl6 fail %s", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %s got: %s", jsonutils.Marshal(want), jsonutils.Marshal(got))
+	}
+
+	rule.CIDR = "10.0.0.0/8"
+	if _, err := ruleToAcl6(lport, rule); err == nil {
+		t.Errorf("ruleToAcl6 with ipv4 cidr: want error")
+	}
+}
@@ -122,7 +122,7 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 		if vpc.Id == apis.DEFAULT_VPC_ID {
 			continue
 		}
-		ovndb.ClaimVpc(ctx, vpc)
+		ovndb.ClaimVpc(ctx, vpc, w.opts)
 		if vpcHasEipgw(vpc) {
 			ovndb.ClaimVpcEipgw(ctx, vpc)
 		}
@@ -173,6 +173,15 @@ func (w *Worker) run(ctx context.Context, mss *agentmodels.ModelSets) (err error
 				ovndb.ClaimLoadbalancerNetwork(ctx, loadbalancerNetwork)
 			}
 		}
+		if vpcHasNatgw(vpc) {
+			if w.opts.OvnEipgwChassis != "" {
+				for _, natgateway := range vpc.NatGateways {
+					ovndb.ClaimNatGateway(ctx, natgateway)
+				}
+			} else {
+				log.Warningf("vpc %s(%s) has nat gateways but ovn_eipgw_chassis is not set", vpc.Name, vpc.Id)
+			}
+		}
 		routes := resolveRoutes(vpc, mss)
 		ovndb.ClaimRoutes(ctx, vpc, routes)
 	}
@@ -159,9 +159,14 @@ func OvnNbctlArgsDestroy(irows []types.IRow) []string {
 			newArgs = []string{"--", "--if-exists", "lsp-del", irow.OvsdbUuid()}
 		case *ovn_nb.LogicalRouterPort:
 			newArgs = []string{"--", "--if-exists", "lrp-del", irow.OvsdbUuid()}
+		case *ovn_nb.LoadBalancer:
+			// lb-del also removes references from routers and switches
+			newArgs = []string{"--", "--if-exists", "lb-del", irow.OvsdbUuid()}
 		case *ovn_nb.LogicalRouterStaticRoute:
 		case *ovn_nb.ACL:
 		case *ovn_nb.QoS:
+		case *ovn_nb.NAT:
+		case *ovn_nb.GatewayChassis:
 		default:
 			if !irow.OvsdbIsRoot() {
 				panic(irow.OvsdbTableName())
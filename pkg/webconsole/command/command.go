@@ -44,6 +44,10 @@ type BaseCommand struct {
 	s    *mcclient.ClientSession
 	name string
 	args []string
+
+	recordObject *recorder.Object
+	// session of the requesting user, which recordings are attributed to
+	recordSession *mcclient.ClientSession
 }
 
 func NewBaseCommand(s *mcclient.ClientSession, name string, args ...string) *BaseCommand {
@@ -54,7 +58,11 @@ func NewBaseCommand(s *mcclient.ClientSession, name string, args ...string) *Bas
 	}
 }
 
+// GetClientSession returns the session recordings are attributed to
 func (c *BaseCommand) GetClientSession() *mcclient.ClientSession {
+	if c.recordSession != nil {
+		return c.recordSession
+	}
 	return c.s
 }
 
@@ -88,6 +96,14 @@ func (c BaseCommand) Cleanup() error {
 	return nil
 }
 
+func (c *BaseCommand) SetRecordObject(obj *recorder.Object) {
+	c.recordObject = obj
+}
+
+func (c *BaseCommand) SetRecordSession(s *mcclient.ClientSession) {
+	c.recordSession = s
+}
+
 func (c BaseCommand) GetRecordObject() *recorder.Object {
-	return nil
+	return c.recordObject
 }
@@ -18,10 +18,13 @@ import (
 	"fmt"
 	"os/exec"
 
+	"yunion.io/x/jsonutils"
 	"yunion.io/x/log"
 
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/webconsole/models"
 	o "yunion.io/x/onecloud/pkg/webconsole/options"
+	"yunion.io/x/onecloud/pkg/webconsole/recorder"
 )
 
 type IpmiInfo struct {
@@ -37,7 +40,7 @@ type IpmitoolSol struct {
 	s    *mcclient.ClientSession
 }
 
-func NewIpmitoolSolCommand(info *IpmiInfo, s *mcclient.ClientSession) (*IpmitoolSol, error) {
+func NewIpmitoolSolCommand(info *IpmiInfo, s *mcclient.ClientSession, hostId string) (*IpmitoolSol, error) {
 	if info.IpAddr == "" {
 		return nil, fmt.Errorf("Empty host ip address")
 	}
@@ -57,6 +60,10 @@ func NewIpmitoolSolCommand(info *IpmiInfo, s *mcclient.ClientSession) (*Ipmitool
 	}
 	cmd := NewBaseCommand(s, name, solArgs...)
 	cmd.AppendArgs("activate")
+	notes := map[string]interface{}{
+		"ip": info.IpAddr,
+	}
+	cmd.SetRecordObject(recorder.NewObject(hostId, hostId, "host", info.Username, jsonutils.Marshal(notes)).WithCommandType(models.CommandTypeIpmi))
 	tool := &IpmitoolSol{
 		BaseCommand: cmd,
 		Info:        info,
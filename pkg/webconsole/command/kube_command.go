@@ -25,17 +25,21 @@ import (
 
 	webconsole_api "yunion.io/x/onecloud/pkg/apis/webconsole"
 	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/webconsole/models"
 	o "yunion.io/x/onecloud/pkg/webconsole/options"
+	"yunion.io/x/onecloud/pkg/webconsole/recorder"
 )
 
 type K8sEnv struct {
-	Session    *mcclient.ClientSession
-	Cluster    string
-	Namespace  string
-	Pod        string
-	Container  string
-	Kubeconfig string
-	Data       jsonutils.JSONObject
+	Session *mcclient.ClientSession
+	// UserSession is the session of the requesting user, used by recorder
+	UserSession *mcclient.ClientSession
+	Cluster     string
+	Namespace   string
+	Pod         string
+	Container   string
+	Kubeconfig  string
+	Data        jsonutils.JSONObject
 }
 
 type Kubectl struct {
@@ -134,12 +138,23 @@ func NewPodBashCommand(env *K8sEnv) ICommand {
 		shellRequest.Command = "env"
 	}
 
-	return NewKubectlCommand(env.Session, env.Kubeconfig, env.Namespace).Exec().
+	cmd := NewKubectlCommand(env.Session, env.Kubeconfig, env.Namespace).Exec().
 		Stdin().
 		TTY().
 		Pod(env.Pod).
 		Container(env.Container).
 		Command(shellRequest.Command, args...)
+	notes := map[string]interface{}{
+		"cluster":   env.Cluster,
+		"namespace": env.Namespace,
+		"container": env.Container,
+	}
+	obj := recorder.NewObject(fmt.Sprintf("%s/%s/%s", env.Cluster, env.Namespace, env.Pod), env.Pod, "pod", env.Container, jsonutils.Marshal(notes))
+	cmd.SetRecordObject(obj.WithCommandType(models.CommandTypeKube))
+	if env.UserSession != nil {
+		cmd.SetRecordSession(env.UserSession)
+	}
+	return cmd
 }
 
 type KubectlLog struct {
@@ -16,13 +16,17 @@ package webconsole
 
 import (
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
 	"yunion.io/x/pkg/errors"
 
 	webconsole_api "yunion.io/x/onecloud/pkg/apis/webconsole"
@@ -38,6 +42,7 @@ import (
 	"yunion.io/x/onecloud/pkg/webconsole/command"
 	"yunion.io/x/onecloud/pkg/webconsole/models"
 	o "yunion.io/x/onecloud/pkg/webconsole/options"
+	"yunion.io/x/onecloud/pkg/webconsole/recorder"
 	"yunion.io/x/onecloud/pkg/webconsole/session"
 )
 
@@ -54,9 +59,12 @@ func InitHandlers(app *appsrv.Application) {
 	app.AddHandler("POST", ApiPathPrefix+"baremetal/<id>", auth.Authenticate(handleBaremetalShell))
 	app.AddHandler("POST", ApiPathPrefix+"ssh/<ip>", auth.Authenticate(handleSshShell))
 	app.AddHandler("POST", ApiPathPrefix+"server/<id>", auth.Authenticate(handleServerRemoteConsole))
+	app.AddHandler("GET", ApiPathPrefix+"sessionrecordings/<resid>/download", auth.Authenticate(handleDownloadSessionRecording))
+	app.AddHandler("GET", ApiPathPrefix+"sessionrecordings/<resid>/playback", auth.Authenticate(handlePlaybackSessionRecording))
 
 	for _, man := range []db.IModelManager{
 		models.GetCommandLogManager(),
+		models.GetSessionRecordingManager(),
 	} {
 		db.RegisterModelManager(man)
 		handler := db.NewModelHandler(man)
@@ -109,14 +117,20 @@ func fetchK8sEnv(ctx context.Context, w http.ResponseWriter, r *http.Request) (*
 	defer f.Close()
 	f.WriteString(conf)
 
+	var userSession *mcclient.ClientSession
+	if userCred := auth.FetchUserCredential(ctx, policy.FilterPolicyCredential); userCred != nil {
+		userSession = auth.Client().NewSession(ctx, o.Options.Region, "", "internal", userCred, "v2")
+	}
+
 	return &command.K8sEnv{
-		Session:    adminSession,
-		Cluster:    k8sReq.Cluster,
-		Namespace:  k8sReq.Namespace,
-		Pod:        podName,
-		Container:  k8sReq.Container,
-		Kubeconfig: f.Name(),
-		Data:       body,
+		Session:     adminSession,
+		UserSession: userSession,
+		Cluster:     k8sReq.Cluster,
+		Namespace:   k8sReq.Namespace,
+		Pod:         podName,
+		Container:   k8sReq.Container,
+		Kubeconfig:  f.Name(),
+		Data:        body,
 	}, nil
 }
 
@@ -200,7 +214,7 @@ func handleBaremetalShell(ctx context.Context, w http.ResponseWriter, r *http.Re
 		httperrors.GeneralServerError(ctx, w, err)
 		return
 	}
-	cmd, err := command.NewIpmitoolSolCommand(&info, env.ClientSessin)
+	cmd, err := command.NewIpmitoolSolCommand(&info, env.ClientSessin, hostId)
 	if err != nil {
 		httperrors.GeneralServerError(ctx, w, err)
 		return
@@ -263,6 +277,68 @@ func handleDataSession(ctx context.Context, sData session.ISessionData, w http.R
 	sendJSON(w, resp.JSON(resp))
 }
 
+// handleDownloadSessionRecording responses the asciicast file of a session
+// recording as an attachment
+func handleDownloadSessionRecording(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	sendSessionRecording(ctx, w, r, true)
+}
+
+// handlePlaybackSessionRecording responses the asciicast file of a session
+// recording inline, which is the source of asciinema player
+func handlePlaybackSessionRecording(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	sendSessionRecording(ctx, w, r, false)
+}
+
+func sendSessionRecording(ctx context.Context, w http.ResponseWriter, r *http.Request, attachment bool) {
+	params, _, _ := appsrv.FetchEnv(ctx, w, r)
+	userCred := auth.FetchUserCredential(ctx, policy.FilterPolicyCredential)
+	if userCred == nil {
+		httperrors.UnauthorizedError(ctx, w, "No token founded")
+		return
+	}
+	man := models.GetSessionRecordingManager()
+	id := params["<resid>"]
+	obj, err := db.FetchById(man, id)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			httperrors.GeneralServerError(ctx, w, httperrors.NewResourceNotFoundError2(man.Keyword(), id))
+		} else {
+			httperrors.GeneralServerError(ctx, w, err)
+		}
+		return
+	}
+	if err := db.IsObjectRbacAllowed(ctx, obj, userCred, policy.PolicyActionGet); err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	rec := obj.(*models.SSessionRecording)
+	storage, err := recorder.GetRecordingStorage(rec.StorageType)
+	if err != nil {
+		httperrors.GeneralServerError(ctx, w, err)
+		return
+	}
+	reader, err := storage.Open(rec.Location)
+	if err != nil {
+		if errors.Cause(err) == errors.ErrNotFound {
+			httperrors.GeneralServerError(ctx, w, httperrors.NewNotFoundError("recording file of %s not found", id))
+		} else {
+			httperrors.GeneralServerError(ctx, w, err)
+		}
+		return
+	}
+	defer reader.Close()
+	w.Header().Set("Content-Type", "application/x-asciicast")
+	if attachment {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.cast", rec.SessionId, id)))
+	}
+	if rec.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(rec.Size, 10))
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Errorf("send session recording %s: %v", id, err)
+	}
+}
+
 func handleCommandSession(ctx context.Context, cmd command.ICommand, w http.ResponseWriter) {
 	handleDataSession(ctx, session.WrapCommandSession(cmd), w, nil, false)
 }
@@ -33,7 +33,9 @@ var commandLogManager *SCommandLogManager
 type CommandType string
 
 const (
-	CommandTypeSSH = "ssh"
+	CommandTypeSSH  = "ssh"
+	CommandTypeIpmi = "ipmi"
+	CommandTypeKube = "kube"
 )
 
 func InitCommandLog() {
@@ -0,0 +1,134 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package models
+
+import (
+	"context"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/sqlchemy"
+
+	api "yunion.io/x/onecloud/pkg/apis/webconsole"
+	"yunion.io/x/onecloud/pkg/cloudcommon/consts"
+	"yunion.io/x/onecloud/pkg/cloudcommon/db"
+	"yunion.io/x/onecloud/pkg/mcclient"
+)
+
+var sessionRecordingManager *SSessionRecordingManager
+
+func GetSessionRecordingManager() *SSessionRecordingManager {
+	if sessionRecordingManager != nil {
+		return sessionRecordingManager
+	}
+	sessionRecordingManager = &SSessionRecordingManager{
+		SOpsLogManager: db.SOpsLogManager{
+			SModelBaseManager: db.NewModelBaseManagerWithSplitable(
+				SSessionRecording{},
+				"session_recording_tbl",
+				"sessionrecording",
+				"sessionrecordings",
+				"id",
+				"start_time",
+				consts.SplitableMaxDuration(),
+				consts.SplitableMaxKeepMonths(),
+			),
+		},
+	}
+	sessionRecordingManager.SetVirtualObject(sessionRecordingManager)
+	return sessionRecordingManager
+}
+
+type SSessionRecordingManager struct {
+	db.SOpsLogManager
+}
+
+// SSessionRecording is the asciicast recording of a whole terminal session
+type SSessionRecording struct {
+	db.SOpsLog
+
+	SessionId  string      `width:"128" charset:"ascii" list:"user" create:"required" index:"true"`
+	AccessedAt time.Time   `nullable:"false" list:"user" create:"required"`
+	Type       CommandType `width:"32" charset:"utf8" nullable:"true" list:"user" create:"required"`
+	LoginUser  string      `charset:"utf8" list:"user" create:"required"`
+	StartTime  time.Time   `list:"user" create:"required"`
+	EndTime    time.Time   `list:"user" create:"required"`
+	// duration of the session in seconds
+	Duration float64 `list:"user" create:"required"`
+	Width    int     `list:"user" create:"optional"`
+	Height   int     `list:"user" create:"optional"`
+	// size of the recording file in bytes
+	Size        int64  `list:"user" create:"required"`
+	StorageType string `width:"16" charset:"ascii" list:"user" create:"required"`
+	Location    string `width:"512" charset:"utf8" create:"required"`
+	// the recording stops before the session ends as writing fell behind the terminal
+	Truncated bool `nullable:"false" default:"false" list:"user" create:"optional"`
+}
+
+type SessionRecordingCreateInput struct {
+	ObjId           string
+	ObjName         string
+	ObjType         string
+	Action          string
+	UserId          string
+	User            string
+	TenantId        string
+	Tenant          string
+	DomainId        string
+	Domain          string
+	ProjectDomainId string
+	ProjectDomain   string
+	Roles           string
+	SessionId       string
+	AccessedAt      time.Time
+	Type            CommandType
+	LoginUser       string
+	StartTime       time.Time
+	EndTime         time.Time
+	Duration        float64
+	Width           int
+	Height          int
+	Size            int64
+	StorageType     string
+	Location        string
+	Truncated       bool
+	Notes           jsonutils.JSONObject
+}
+
+func (m *SSessionRecordingManager) Create(ctx context.Context, userCred mcclient.TokenCredential, input *SessionRecordingCreateInput) (*SSessionRecording, error) {
+	data := jsonutils.Marshal(input)
+	obj, err := db.DoCreate(GetSessionRecordingManager(), ctx, userCred, jsonutils.NewDict(), data, userCred)
+	if err != nil {
+		return nil, errors.Wrap(err, "Create SessionRecording")
+	}
+	return obj.(*SSessionRecording), nil
+}
+
+func (m *SSessionRecordingManager) ListItemFilter(
+	ctx context.Context,
+	q *sqlchemy.SQuery,
+	userCred mcclient.TokenCredential,
+	input api.SessionRecordingListInput,
+) (*sqlchemy.SQuery, error) {
+	q, err := m.SOpsLogManager.ListItemFilter(ctx, q, userCred, input.OpsLogListInput)
+	if err != nil {
+		return nil, errors.Wrap(err, "SOpsLogManager.ListItemFilter")
+	}
+	if len(input.SessionId) > 0 {
+		q = q.In("session_id", input.SessionId)
+	}
+	return q, nil
+}
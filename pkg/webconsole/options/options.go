@@ -34,6 +34,14 @@ type WebConsoleOptions struct {
 	EnableAutoLogin   bool   `help:"allow webconsole to log in directly with the cloudroot public key" default:"false"`
 	ApsaraConsoleAddr string `help:"Apsara console addr" default:"https://xxxx.com.cn/module/ecs/vnc/index.html"`
 	AliyunVncVersion  string `help:"Aliyun vnc version" default:"0.0.8"`
+
+	EnableSessionRecording          bool   `help:"record the whole terminal session of ssh, ipmi and kube shell in asciicast format" default:"false"`
+	SessionRecordingWithInput       bool   `help:"also record user input in session recording, input such as passwords may be recorded" default:"false"`
+	SessionRecordingStorage         string `help:"where session recordings are stored" default:"local" choices:"local|object"`
+	SessionRecordingDir             string `help:"local directory of session recordings, also used as staging directory of object storage" default:"/opt/cloud/workspace/webconsole/recordings"`
+	SessionRecordingObjectBucketUrl string `help:"bucket url of object storage to store session recordings, e.g. https://minio.example.com:9000/recordings"`
+	SessionRecordingObjectAccessKey string `help:"access key of object storage to store session recordings"`
+	SessionRecordingObjectSecret    string `help:"secret of object storage to store session recordings"`
 }
 
 func OnOptionsChange(oldO, newO interface{}) bool {
@@ -0,0 +1,192 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+
+	"yunion.io/x/pkg/errors"
+)
+
+const (
+	AsciicastVersion = 2
+
+	AsciicastEventOutput = "o"
+	AsciicastEventInput  = "i"
+	AsciicastEventResize = "r"
+
+	AsciicastDefaultWidth  = 80
+	AsciicastDefaultHeight = 24
+)
+
+// AsciicastHeader is the first line of asciicast v2 file,
+// see https://github.com/asciinema/asciinema/blob/develop/doc/asciicast-v2.md
+type AsciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// AsciicastWriter writes header and events of asciicast v2 stream, the
+// header is written lazily before the first event so that terminal size
+// reported after the session starts is still used
+type AsciicastWriter struct {
+	enc     *json.Encoder
+	header  AsciicastHeader
+	start   time.Time
+	started bool
+
+	// incomplete utf-8 sequence at the end of last event of each stream
+	pending map[string][]byte
+}
+
+func NewAsciicastWriter(w io.Writer, header AsciicastHeader, start time.Time) *AsciicastWriter {
+	header.Version = AsciicastVersion
+	header.Timestamp = start.Unix()
+	if header.Width <= 0 {
+		header.Width = AsciicastDefaultWidth
+	}
+	if header.Height <= 0 {
+		header.Height = AsciicastDefaultHeight
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &AsciicastWriter{
+		enc:     enc,
+		header:  header,
+		start:   start,
+		pending: make(map[string][]byte),
+	}
+}
+
+func (w *AsciicastWriter) Header() AsciicastHeader {
+	return w.header
+}
+
+// SetSize changes the terminal size, before any event it updates the header,
+// otherwise a resize event is written
+func (w *AsciicastWriter) SetSize(t time.Time, width, height int) error {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	if !w.started {
+		w.header.Width = width
+		w.header.Height = height
+		return nil
+	}
+	if w.header.Width == width && w.header.Height == height {
+		return nil
+	}
+	w.header.Width = width
+	w.header.Height = height
+	return w.writeEvent(t, AsciicastEventResize, []byte(formatSize(width, height)))
+}
+
+func (w *AsciicastWriter) WriteOutput(t time.Time, data []byte) error {
+	return w.writeStream(t, AsciicastEventOutput, data)
+}
+
+func (w *AsciicastWriter) WriteInput(t time.Time, data []byte) error {
+	return w.writeStream(t, AsciicastEventInput, data)
+}
+
+// writeStream keeps utf-8 sequence split between two reads of the pty in
+// one event, json encoding would replace them with U+FFFD otherwise
+func (w *AsciicastWriter) writeStream(t time.Time, evType string, data []byte) error {
+	buf := append(w.pending[evType], data...)
+	end := completeUTF8Len(buf)
+	if end < len(buf) {
+		w.pending[evType] = append([]byte{}, buf[end:]...)
+	} else {
+		delete(w.pending, evType)
+	}
+	if end == 0 {
+		return nil
+	}
+	return w.writeEvent(t, evType, buf[:end])
+}
+
+// Flush writes out incomplete utf-8 sequences left
+func (w *AsciicastWriter) Flush(t time.Time) error {
+	for _, evType := range []string{AsciicastEventOutput, AsciicastEventInput} {
+		if data, ok := w.pending[evType]; ok {
+			delete(w.pending, evType)
+			if err := w.writeEvent(t, evType, data); err != nil {
+				return err
+			}
+		}
+	}
+	if !w.started {
+		return w.writeHeader()
+	}
+	return nil
+}
+
+func (w *AsciicastWriter) writeHeader() error {
+	w.started = true
+	if err := w.enc.Encode(w.header); err != nil {
+		return errors.Wrap(err, "write asciicast header")
+	}
+	return nil
+}
+
+func (w *AsciicastWriter) writeEvent(t time.Time, evType string, data []byte) error {
+	if !w.started {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+	elapsed := t.Sub(w.start).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	elapsed = math.Round(elapsed*1e6) / 1e6
+	if err := w.enc.Encode([]interface{}{elapsed, evType, string(data)}); err != nil {
+		return errors.Wrapf(err, "write asciicast %s event", evType)
+	}
+	return nil
+}
+
+func formatSize(width, height int) string {
+	return fmt.Sprintf("%dx%d", width, height)
+}
+
+// completeUTF8Len returns the length of data without the trailing
+// incomplete utf-8 sequence
+func completeUTF8Len(data []byte) int {
+	// a utf-8 sequence is at most utf8.UTFMax bytes, only the tail is checked
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		c := data[len(data)-i]
+		if c < utf8.RuneSelf {
+			// ascii byte, nothing pending
+			return len(data)
+		}
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(data[len(data)-i:]) {
+				return len(data)
+			}
+			return len(data) - i
+		}
+	}
+	return len(data)
+}
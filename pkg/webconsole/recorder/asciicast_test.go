@@ -0,0 +1,82 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAsciicastWriter(t *testing.T) {
+	start := time.Unix(1600000000, 0)
+	buf := &bytes.Buffer{}
+	w := NewAsciicastWriter(buf, AsciicastHeader{Title: "test"}, start)
+
+	steps := []func() error{
+		func() error { return w.SetSize(start, 120, 40) },
+		func() error { return w.WriteOutput(start.Add(time.Second), []byte("ls\r\n")) },
+		// "中" split between two reads
+		func() error { return w.WriteOutput(start.Add(2*time.Second), []byte{'a', 0xe4, 0xb8}) },
+		func() error { return w.WriteOutput(start.Add(3*time.Second), []byte{0xad, '<'}) },
+		func() error { return w.SetSize(start.Add(4*time.Second), 100, 30) },
+		func() error { return w.WriteInput(start.Add(5*time.Second), []byte{0xe4}) },
+		func() error { return w.Flush(start.Add(6 * time.Second)) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+	}
+
+	want := []string{
+		`{"version":2,"width":120,"height":40,"timestamp":1600000000,"title":"test"}`,
+		`[1,"o","ls\r\n"]`,
+		`[2,"o","a"]`,
+		`[3,"o","中<"]`,
+		`[4,"r","100x30"]`,
+		`[6,"i","�"]`,
+	}
+	got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(got) != len(want) {
+		t.Fatalf("want %d lines, got %d: %s", len(want), len(got), buf.String())
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: want %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestCompleteUTF8Len(t *testing.T) {
+	cases := []struct {
+		data []byte
+		want int
+	}{
+		{[]byte("abc"), 3},
+		{[]byte("中"), 3},
+		{[]byte{'a', 0xe4}, 1},
+		{[]byte{'a', 0xe4, 0xb8}, 1},
+		{[]byte{0xf0, 0x9f, 0x98}, 0},
+		{[]byte{0xf0, 0x9f, 0x98, 0x80}, 4},
+		{[]byte{}, 0},
+	}
+	for _, c := range cases {
+		if got := completeUTF8Len(c.data); got != c.want {
+			t.Errorf("completeUTF8Len(%v) want %d, got %d", c.data, c.want, got)
+		}
+	}
+}
@@ -40,6 +40,8 @@ type Object struct {
 	Type      string
 	LoginUser string
 	Notes     jsonutils.JSONObject
+	// CommandType is the kind of terminal, ssh if empty
+	CommandType models.CommandType
 }
 
 func NewObject(id, name, oType, loginUser string, notes jsonutils.JSONObject) *Object {
@@ -52,6 +54,18 @@ func NewObject(id, name, oType, loginUser string, notes jsonutils.JSONObject) *O
 	}
 }
 
+func (o *Object) WithCommandType(cmdType models.CommandType) *Object {
+	o.CommandType = cmdType
+	return o
+}
+
+func (o *Object) GetCommandType() models.CommandType {
+	if o.CommandType == "" {
+		return models.CommandTypeSSH
+	}
+	return o.CommandType
+}
+
 type cmdRecoder struct {
 	cs               *mcclient.ClientSession
 	sessionId        string
@@ -67,7 +81,18 @@ type cmdRecoder struct {
 	wLock            *sync.Mutex
 }
 
+type nopRecorder struct{}
+
+func (r nopRecorder) Start() {}
+
+func (r nopRecorder) Write(userInput string, ptyOutput string) {}
+
+// NewCmdRecorder returns the recorder of commands parsed by the PS1 prompt,
+// which is only reliable for ssh shells
 func NewCmdRecorder(s *mcclient.ClientSession, obj *Object, sessionId string, accessedAt time.Time) Recoder {
+	if obj == nil || obj.GetCommandType() != models.CommandTypeSSH {
+		return nopRecorder{}
+	}
 	return &cmdRecoder{
 		cs:             s,
 		sessionId:      sessionId,
@@ -185,7 +210,7 @@ func (r *cmdRecoder) newModelInput(userCred mcclient.TokenCredential, command st
 		SessionId:       r.sessionId,
 		AccessedAt:      r.accessedAt,
 		LoginUser:       r.object.LoginUser,
-		Type:            models.CommandTypeSSH,
+		Type:            r.object.GetCommandType(),
 		StartTime:       time.Now(),
 		Ps1:             r.ps1,
 		Command:         command,
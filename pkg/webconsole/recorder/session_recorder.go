@@ -0,0 +1,258 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"yunion.io/x/jsonutils"
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+
+	"yunion.io/x/onecloud/pkg/mcclient"
+	"yunion.io/x/onecloud/pkg/webconsole/models"
+	o "yunion.io/x/onecloud/pkg/webconsole/options"
+)
+
+// sessionRecordingQueueSize is the number of terminal events buffered
+// between the pty and the recording file
+const sessionRecordingQueueSize = 4096
+
+// sessionRecordingSendTimeout is how long the pty waits for the recording
+// when the queue is full before the recording is truncated
+const sessionRecordingSendTimeout = 5 * time.Second
+
+// SessionRecorder records the complete pty stream of a session in asciicast
+// v2 format, unlike cmdRecoder it keeps output and full-screen programs.
+// The recording is written to a local file while the session is alive and
+// moved to the configured storage when the session is closed.
+type SessionRecorder struct {
+	cs         *mcclient.ClientSession
+	object     *Object
+	sessionId  string
+	accessedAt time.Time
+	withInput  bool
+	startTime  time.Time
+
+	lock      *sync.Mutex
+	closed    bool
+	truncated bool
+	events    chan func(w *AsciicastWriter) error
+	done      chan struct{}
+
+	// owned by the writing goroutine until done is closed
+	localPath string
+	file      *os.File
+	buf       *bufio.Writer
+	writer    *AsciicastWriter
+	failed    bool
+}
+
+func NewSessionRecorder(s *mcclient.ClientSession, obj *Object, sessionId string, accessedAt time.Time) *SessionRecorder {
+	r := &SessionRecorder{
+		cs:         s,
+		object:     obj,
+		sessionId:  sessionId,
+		accessedAt: accessedAt,
+		withInput:  o.Options.SessionRecordingWithInput,
+		startTime:  time.Now(),
+		lock:       new(sync.Mutex),
+		events:     make(chan func(w *AsciicastWriter) error, sessionRecordingQueueSize),
+		done:       make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *SessionRecorder) open() error {
+	if r.writer != nil {
+		return nil
+	}
+	dir := filepath.Join(o.Options.SessionRecordingDir, r.startTime.Format("20060102"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "mkdir %s", dir)
+	}
+	r.localPath = filepath.Join(dir, fmt.Sprintf("%s-%d.cast", r.sessionId, r.startTime.UnixNano()))
+	f, err := os.OpenFile(r.localPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "create %s", r.localPath)
+	}
+	r.file = f
+	r.buf = bufio.NewWriter(f)
+	header := AsciicastHeader{
+		Title: fmt.Sprintf("%s %s@%s", r.object.Type, r.object.LoginUser, r.object.Name),
+		Env: map[string]string{
+			"TERM": "xterm",
+		},
+	}
+	r.writer = NewAsciicastWriter(r.buf, header, r.startTime)
+	return nil
+}
+
+// run writes the queued events to the recording file, so that the pty is
+// never blocked by the disk
+func (r *SessionRecorder) run() {
+	defer close(r.done)
+	for ev := range r.events {
+		if r.failed {
+			continue
+		}
+		if err := r.open(); err != nil {
+			log.Errorf("[session %s] open recording: %v", r.sessionId, err)
+			r.failed = true
+			continue
+		}
+		if err := ev(r.writer); err != nil {
+			log.Errorf("[session %s] write recording: %v", r.sessionId, err)
+		}
+	}
+}
+
+// record queues an event, if the queue is full it waits for the writing
+// goroutine up to sessionRecordingSendTimeout. When the wait times out the
+// recording is marked truncated and the rest of the session is not recorded,
+// so that a recording never silently misses events in the middle
+func (r *SessionRecorder) record(ev func(w *AsciicastWriter) error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed || r.truncated {
+		return
+	}
+	select {
+	case r.events <- ev:
+		return
+	default:
+	}
+	timer := time.NewTimer(sessionRecordingSendTimeout)
+	defer timer.Stop()
+	select {
+	case r.events <- ev:
+	case <-timer.C:
+		r.truncated = true
+		log.Errorf("[session %s] recording falls behind the terminal for %s, truncate recording at %s", r.sessionId, sessionRecordingSendTimeout, time.Now())
+	}
+}
+
+func (r *SessionRecorder) WriteOutput(data []byte) {
+	now := time.Now()
+	// the pty reuses its buffer
+	data = append([]byte{}, data...)
+	r.record(func(w *AsciicastWriter) error {
+		return w.WriteOutput(now, data)
+	})
+}
+
+func (r *SessionRecorder) WriteInput(data []byte) {
+	if !r.withInput {
+		return
+	}
+	now := time.Now()
+	data = append([]byte{}, data...)
+	r.record(func(w *AsciicastWriter) error {
+		return w.WriteInput(now, data)
+	})
+}
+
+func (r *SessionRecorder) Resize(cols, rows uint16) {
+	now := time.Now()
+	r.record(func(w *AsciicastWriter) error {
+		return w.SetSize(now, int(cols), int(rows))
+	})
+}
+
+func (r *SessionRecorder) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.events)
+	truncated := r.truncated
+	r.lock.Unlock()
+
+	<-r.done
+	if r.writer == nil {
+		// nothing recorded
+		return nil
+	}
+	endTime := time.Now()
+	if err := r.writer.Flush(endTime); err != nil {
+		log.Errorf("[session %s] flush recording: %v", r.sessionId, err)
+	}
+	if err := r.buf.Flush(); err != nil {
+		log.Errorf("[session %s] flush recording file: %v", r.sessionId, err)
+	}
+	if err := r.file.Close(); err != nil {
+		return errors.Wrapf(err, "close %s", r.localPath)
+	}
+	fi, err := os.Stat(r.localPath)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", r.localPath)
+	}
+
+	storage, err := GetRecordingStorage(o.Options.SessionRecordingStorage)
+	if err != nil {
+		return errors.Wrap(err, "GetRecordingStorage")
+	}
+	location, err := storage.Save(r.localPath)
+	if err != nil {
+		return errors.Wrapf(err, "save recording %s", r.localPath)
+	}
+
+	userCred := r.cs.GetToken()
+	header := r.writer.Header()
+	input := &models.SessionRecordingCreateInput{
+		ObjId:           r.object.Id,
+		ObjName:         r.object.Name,
+		ObjType:         r.object.Type,
+		Notes:           r.object.Notes,
+		Action:          "record",
+		UserId:          userCred.GetUserId(),
+		User:            userCred.GetUserName(),
+		TenantId:        userCred.GetTenantId(),
+		Tenant:          userCred.GetTenantName(),
+		DomainId:        userCred.GetDomainId(),
+		Domain:          userCred.GetDomainName(),
+		ProjectDomainId: userCred.GetProjectDomainId(),
+		ProjectDomain:   userCred.GetProjectDomain(),
+		Roles:           strings.Join(userCred.GetRoles(), ","),
+		SessionId:       r.sessionId,
+		AccessedAt:      r.accessedAt,
+		Type:            r.object.GetCommandType(),
+		LoginUser:       r.object.LoginUser,
+		StartTime:       r.startTime,
+		EndTime:         endTime,
+		Duration:        endTime.Sub(r.startTime).Seconds(),
+		Width:           header.Width,
+		Height:          header.Height,
+		Size:            fi.Size(),
+		StorageType:     storage.GetType(),
+		Location:        location,
+		Truncated:       truncated,
+	}
+	_, err = models.GetSessionRecordingManager().Create(r.cs.GetContext(), userCred, input)
+	if err != nil {
+		return errors.Wrapf(err, "Create session recording by input: %s", jsonutils.Marshal(input))
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Yunion
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"yunion.io/x/log"
+	"yunion.io/x/pkg/errors"
+	"yunion.io/x/s3cli"
+
+	api "yunion.io/x/onecloud/pkg/apis/webconsole"
+	"yunion.io/x/onecloud/pkg/util/httputils"
+	o "yunion.io/x/onecloud/pkg/webconsole/options"
+)
+
+// IRecordingStorage persists finished session recordings
+type IRecordingStorage interface {
+	GetType() string
+	// Save moves the local recording file into storage and returns its location
+	Save(localPath string) (string, error)
+	Open(location string) (io.ReadCloser, error)
+}
+
+func GetRecordingStorage(storageType string) (IRecordingStorage, error) {
+	switch storageType {
+	case api.SESSION_RECORDING_STORAGE_LOCAL, "":
+		return &sLocalRecordingStorage{dir: o.Options.SessionRecordingDir}, nil
+	case api.SESSION_RECORDING_STORAGE_OBJECT:
+		return newObjectRecordingStorage(
+			o.Options.SessionRecordingObjectBucketUrl,
+			o.Options.SessionRecordingObjectAccessKey,
+			o.Options.SessionRecordingObjectSecret,
+		)
+	}
+	return nil, errors.Wrapf(errors.ErrNotSupported, "recording storage %s", storageType)
+}
+
+type sLocalRecordingStorage struct {
+	dir string
+}
+
+func (s *sLocalRecordingStorage) GetType() string {
+	return api.SESSION_RECORDING_STORAGE_LOCAL
+}
+
+func (s *sLocalRecordingStorage) Save(localPath string) (string, error) {
+	// recording is written inside recording dir already
+	rel, err := filepath.Rel(s.dir, localPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "recording %s not in %s", localPath, s.dir)
+	}
+	return rel, nil
+}
+
+func (s *sLocalRecordingStorage) Open(location string) (io.ReadCloser, error) {
+	fullPath := filepath.Join(s.dir, filepath.Clean("/"+location))
+	f, err := os.Open(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(errors.ErrNotFound, "recording %s", location)
+		}
+		return nil, errors.Wrapf(err, "open %s", fullPath)
+	}
+	return f, nil
+}
+
+type sObjectRecordingStorage struct {
+	bucket string
+	prefix string
+	client *s3cli.Client
+}
+
+func newObjectRecordingStorage(bucketUrl, accessKey, secret string) (*sObjectRecordingStorage, error) {
+	parts, err := url.Parse(bucketUrl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse bucket url %s", bucketUrl)
+	}
+	segs := strings.SplitN(strings.Trim(parts.Path, "/"), "/", 2)
+	if len(parts.Host) == 0 || len(segs[0]) == 0 {
+		return nil, errors.Errorf("invalid bucket url %q", bucketUrl)
+	}
+	cli, err := s3cli.New(parts.Host, accessKey, secret, parts.Scheme == "https", false)
+	if err != nil {
+		return nil, errors.Wrap(err, "s3cli.New")
+	}
+	cli.SetCustomTransport(httputils.GetTransport(true))
+	s := &sObjectRecordingStorage{
+		bucket: segs[0],
+		client: cli,
+	}
+	if len(segs) > 1 {
+		s.prefix = segs[1]
+	}
+	return s, nil
+}
+
+func (s *sObjectRecordingStorage) GetType() string {
+	return api.SESSION_RECORDING_STORAGE_OBJECT
+}
+
+func (s *sObjectRecordingStorage) Save(localPath string) (string, error) {
+	rel, err := filepath.Rel(o.Options.SessionRecordingDir, localPath)
+	if err != nil {
+		rel = filepath.Base(localPath)
+	}
+	key := path.Join(s.prefix, filepath.ToSlash(rel))
+	_, err = s.client.FPutObject(s.bucket, key, localPath, s3cli.PutObjectOptions{
+		ContentType: "application/x-asciicast",
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "upload %s to %s", localPath, key)
+	}
+	if err := os.Remove(localPath); err != nil {
+		log.Warningf("remove uploaded recording %s: %v", localPath, err)
+	}
+	return key, nil
+}
+
+func (s *sObjectRecordingStorage) Open(location string) (io.ReadCloser, error) {
+	if _, err := s.client.StatObject(s.bucket, location, s3cli.StatObjectOptions{}); err != nil {
+		if s3cli.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, errors.Wrapf(errors.ErrNotFound, "recording %s", location)
+		}
+		return nil, errors.Wrapf(err, "StatObject %s", location)
+	}
+	obj, err := s.client.GetObject(s.bucket, location, s3cli.GetObjectOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetObject %s", location)
+	}
+	return obj, nil
+}
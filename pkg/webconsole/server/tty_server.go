@@ -84,6 +84,7 @@ func initSocketHandler(so socketio.Socket, p *session.Pty) {
 				} else {
 					// log.Errorf("--p.Pty.output data: %q", data)
 					so.Emit(OUTPUT_EVENT, string(data))
+					p.Session.RecordOutput(data)
 					go p.Session.GetRecorder().Write("", string(data))
 				}
 				continue
@@ -122,6 +123,7 @@ func initSocketHandler(so socketio.Socket, p *session.Pty) {
 			}
 		} else {
 			p.Pty.Write([]byte(data))
+			p.Session.RecordInput([]byte(data))
 			go p.Session.GetRecorder().Write(data, "")
 		}
 	})
@@ -143,6 +145,7 @@ func initSocketHandler(so socketio.Socket, p *session.Pty) {
 			Rows: colRow[1],
 		}
 		p.Resize(&newSize)
+		p.Session.RecordResize(newSize.Cols, newSize.Rows)
 	})
 
 	// handle disconnection
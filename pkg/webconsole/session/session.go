@@ -73,6 +73,8 @@ func (man *SSessionManager) Save(data ISessionData) (*SSession, error) {
 		Id:           idStr,
 		ISessionData: data,
 		AccessToken:  token,
+
+		sessionRecorderLock: new(sync.Mutex),
 	}
 	man.Store(idStr, session)
 	return session, nil
@@ -126,6 +128,9 @@ type SSession struct {
 	AccessedAt    time.Time
 	duplicateHook func()
 	recorder      recorder.Recoder
+
+	sessionRecorderLock *sync.Mutex
+	sessionRecorder     *recorder.SessionRecorder
 }
 
 func (s SSession) GetConnectParams(params url.Values) (string, error) {
@@ -156,6 +161,14 @@ func (s *SSession) Close() error {
 	if err := s.ISessionData.Cleanup(); err != nil {
 		log.Errorf("Clean up command error: %v", err)
 	}
+	s.sessionRecorderLock.Lock()
+	rec := s.sessionRecorder
+	s.sessionRecorderLock.Unlock()
+	if rec != nil {
+		if err := rec.Close(); err != nil {
+			log.Errorf("Close session recorder error: %v", err)
+		}
+	}
 	if curS, ok := Manager.Load(s.GetId()); ok {
 		if reflect.DeepEqual(curS, s) {
 			Manager.Delete(s.Id)
@@ -175,3 +188,39 @@ func (s *SSession) GetRecorder() recorder.Recoder {
 	}
 	return s.recorder
 }
+
+// getSessionRecorder returns the asciicast recorder of the session, nil if
+// session recording is disabled or the command has nothing to record
+func (s *SSession) getSessionRecorder() *recorder.SessionRecorder {
+	if !o.Options.EnableSessionRecording {
+		return nil
+	}
+	s.sessionRecorderLock.Lock()
+	defer s.sessionRecorderLock.Unlock()
+	if s.sessionRecorder == nil {
+		obj := s.GetRecordObject()
+		if obj == nil {
+			return nil
+		}
+		s.sessionRecorder = recorder.NewSessionRecorder(s.GetClientSession(), obj, s.GetId(), s.AccessedAt)
+	}
+	return s.sessionRecorder
+}
+
+func (s *SSession) RecordOutput(data []byte) {
+	if rec := s.getSessionRecorder(); rec != nil {
+		rec.WriteOutput(data)
+	}
+}
+
+func (s *SSession) RecordInput(data []byte) {
+	if rec := s.getSessionRecorder(); rec != nil {
+		rec.WriteInput(data)
+	}
+}
+
+func (s *SSession) RecordResize(cols, rows uint16) {
+	if rec := s.getSessionRecorder(); rec != nil {
+		rec.Resize(cols, rows)
+	}
+}